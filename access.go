@@ -0,0 +1,101 @@
+package redkit
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+// AllowCIDRs restricts the server to clients whose address is in one of the
+// given networks, e.g. "10.0.0.0/8" or "::1/128". A bare IP address is treated
+// as a single-host network. Calls add to the list; with an empty list, every
+// address not denied is allowed. It may be called while the server is running.
+func (s *Server) AllowCIDRs(cidrs ...string) error {
+	prefixes, err := parseCIDRs(cidrs)
+	if err != nil {
+		return err
+	}
+	s.configMu.Lock()
+	s.allowed = append(s.allowed, prefixes...)
+	s.configMu.Unlock()
+	return nil
+}
+
+// DenyCIDRs rejects clients whose address is in one of the given networks.
+// Denied networks take precedence over allowed ones.
+func (s *Server) DenyCIDRs(cidrs ...string) error {
+	prefixes, err := parseCIDRs(cidrs)
+	if err != nil {
+		return err
+	}
+	s.configMu.Lock()
+	s.denied = append(s.denied, prefixes...)
+	s.configMu.Unlock()
+	return nil
+}
+
+func parseCIDRs(cidrs []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(cidr)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid CIDR %q: %w", cidr, err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// acceptConn reports whether a client connecting from addr may be served,
+// applying the deny list, the allow list and then AcceptFilter
+func (s *Server) acceptConn(addr net.Addr) bool {
+	s.configMu.RLock()
+	allowed, denied := s.allowed, s.denied
+	s.configMu.RUnlock()
+
+	if len(allowed) > 0 || len(denied) > 0 {
+		ip, ok := addrIP(addr)
+		if !ok {
+			return false
+		}
+		for _, prefix := range denied {
+			if prefix.Contains(ip) {
+				return false
+			}
+		}
+		if len(allowed) > 0 && !containsIP(allowed, ip) {
+			return false
+		}
+	}
+
+	if s.AcceptFilter != nil {
+		return s.AcceptFilter(addr)
+	}
+	return true
+}
+
+func containsIP(prefixes []netip.Prefix, ip netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// addrIP extracts the IP address of a TCP peer, unmapping IPv4-mapped IPv6 addresses
+func addrIP(addr net.Addr) (netip.Addr, bool) {
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		ip, ok := netip.AddrFromSlice(tcpAddr.IP)
+		return ip.Unmap(), ok
+	}
+	addrPort, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addrPort.Addr().Unmap(), true
+}
@@ -0,0 +1,69 @@
+package redkit
+
+import (
+	"net"
+	"testing"
+)
+
+func TestAcceptConnRules(t *testing.T) {
+	server := NewServer(":0", WithLogger(NewDefaultLogger(nil, LogLevelOff)))
+	defer server.cancel()
+
+	if err := server.AllowCIDRs("10.0.0.0/8", "2001:db8::/32", "192.168.1.7"); err != nil {
+		t.Fatalf("AllowCIDRs failed: %v", err)
+	}
+	if err := server.DenyCIDRs("10.1.0.0/16"); err != nil {
+		t.Fatalf("DenyCIDRs failed: %v", err)
+	}
+
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"10.2.3.4", true},
+		{"10.1.2.3", false},
+		{"192.168.1.7", true},
+		{"192.168.1.8", false},
+		{"::ffff:10.2.3.4", true},
+		{"2001:db8::1", true},
+		{"2001:db9::1", false},
+	}
+	for _, tt := range tests {
+		addr := &net.TCPAddr{IP: net.ParseIP(tt.ip), Port: 1234}
+		if got := server.acceptConn(addr); got != tt.want {
+			t.Errorf("acceptConn(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+
+	if err := server.AllowCIDRs("not-a-network"); err == nil {
+		t.Error("Expected an error for an invalid CIDR")
+	}
+}
+
+func TestDeniedClientIsClosed(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	if err := server.DenyCIDRs("127.0.0.0/8"); err != nil {
+		t.Fatalf("DenyCIDRs failed: %v", err)
+	}
+
+	client := dialRaw(t, address)
+	client.send(t, "PING")
+	client.expectClosed(t)
+}
+
+func TestAcceptFilter(t *testing.T) {
+	config := DefaultServerConfig()
+	seen := make(chan net.Addr, 1)
+	config.AcceptFilter = func(addr net.Addr) bool {
+		seen <- addr
+		return false
+	}
+	_, address := startTestServer(t, config)
+
+	client := dialRaw(t, address)
+	client.send(t, "PING")
+	client.expectClosed(t)
+	if addr := <-seen; addr == nil {
+		t.Error("Expected AcceptFilter to receive the client address")
+	}
+}
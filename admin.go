@@ -0,0 +1,93 @@
+package redkit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+)
+
+// AdminHandler returns the HTTP handler of the admin endpoint, for mounting on
+// an existing HTTP server. It serves:
+//
+//	/healthz       200 while the server has not been shut down
+//	/readyz        200 while the server is accepting connections and every
+//	               health check passes, 503 otherwise
+//	/stats         Server.Stats as JSON
+//	/debug/pprof/  the net/http/pprof profiles
+func (s *Server) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	mux.HandleFunc("/stats", s.handleStats)
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if s.IsShutdown() {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if s.IsDraining() {
+		http.Error(w, "draining", http.StatusServiceUnavailable)
+		return
+	}
+	if !s.listening.Load() {
+		http.Error(w, "not listening", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), defaultHealthTimeout)
+	defer cancel()
+	writeHealthReport(w, s.CheckHealth(ctx))
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.Stats()); err != nil {
+		s.logger().Debug("Failed to write admin stats: %v", err)
+	}
+}
+
+// startAdmin starts the admin HTTP listener on AdminAddress
+func (s *Server) startAdmin() error {
+	listener, err := net.Listen("tcp", s.AdminAddress)
+	if err != nil {
+		return fmt.Errorf("failed to listen on admin address %s: %w", s.AdminAddress, err)
+	}
+
+	s.admin = &http.Server{
+		Handler:           s.AdminHandler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	s.logger().Info("Admin endpoint listening on %s", listener.Addr())
+
+	admin := s.admin
+	go func() {
+		if err := admin.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger().Error("Admin endpoint failed: %v", err)
+		}
+	}()
+	return nil
+}
+
+// stopAdmin shuts the admin HTTP listener down
+func (s *Server) stopAdmin(ctx context.Context) error {
+	if s.admin == nil {
+		return nil
+	}
+	return s.admin.Shutdown(ctx)
+}
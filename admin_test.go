@@ -0,0 +1,120 @@
+package redkit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAdminHandler(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	admin := httptest.NewServer(server.AdminHandler())
+	defer admin.Close()
+
+	client := dialRaw(t, address)
+	client.send(t, "PING")
+	client.readLine(t)
+
+	for _, path := range []string{"/healthz", "/readyz", "/debug/pprof/"} {
+		resp, err := http.Get(admin.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s: expected 200, got %d", path, resp.StatusCode)
+		}
+	}
+
+	resp, err := http.Get(admin.URL + "/stats")
+	if err != nil {
+		t.Fatalf("GET /stats failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var stats Stats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		t.Fatalf("Failed to decode stats: %v", err)
+	}
+	if stats.Commands["PING"].Calls != 1 {
+		t.Errorf("Expected 1 PING in stats, got %+v", stats.Commands)
+	}
+
+	if err := server.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain failed: %v", err)
+	}
+	resp, err = http.Get(admin.URL + "/readyz")
+	if err != nil {
+		t.Fatalf("GET /readyz failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz to fail while draining, got %d", resp.StatusCode)
+	}
+}
+
+// TestAdminReadyzListen tests /readyz while the server starts listening
+func TestAdminReadyzListen(t *testing.T) {
+	server := NewServer("127.0.0.1:0", WithLogger(NewDefaultLogger(nil, LogLevelOff)))
+	admin := httptest.NewServer(server.AdminHandler())
+	defer admin.Close()
+	readyz := func() int {
+		resp, err := http.Get(admin.URL + "/readyz")
+		if err != nil {
+			t.Errorf("GET /readyz failed: %v", err)
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := readyz(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz to fail before Listen, got %d", code)
+	}
+
+	polled := make(chan struct{})
+	go func() {
+		defer close(polled)
+		for range 10 {
+			readyz()
+		}
+	}()
+	if err := server.Listen(); err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer server.closeListener()
+	<-polled
+	if code := readyz(); code != http.StatusOK {
+		t.Errorf("Expected /readyz to pass once listening, got %d", code)
+	}
+}
+
+func TestAdminAddress(t *testing.T) {
+	port, err := getFreePort()
+	if err != nil {
+		t.Fatalf("Failed to get free port: %v", err)
+	}
+	config := DefaultServerConfig()
+	config.AdminAddress = fmt.Sprintf("127.0.0.1:%d", port)
+	server, _ := startTestServer(t, config)
+
+	resp, err := http.Get("http://" + config.AdminAddress + "/healthz")
+	if err != nil {
+		t.Fatalf("GET /healthz failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "ok\n" {
+		t.Errorf("Unexpected /healthz response %d %q", resp.StatusCode, body)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	server.Shutdown(ctx)
+	if _, err := http.Get("http://" + config.AdminAddress + "/healthz"); err == nil {
+		t.Error("Expected the admin endpoint to stop with the server")
+	}
+}
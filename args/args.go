@@ -0,0 +1,290 @@
+// Package args provides a cursor-style parser for Redis command arguments.
+//
+// A Parser walks the arguments left to right. Methods reading a value record
+// the first error and keep returning zero values afterwards, so handlers can
+// parse a whole command and check Err once:
+//
+//	p := args.New(cmd.Args)
+//	key := p.NextString()
+//	var seconds int64
+//	for p.More() {
+//		switch {
+//		case p.MatchKeyword("EX", &seconds):
+//		case p.MatchFlag("NX"):
+//			nx = true
+//		default:
+//			p.Fail(args.ErrSyntax)
+//		}
+//	}
+//	if err := p.Err(); err != nil {
+//		return redkit.ErrorValue(err)
+//	}
+//
+// Errors carry the message Redis uses, without the ERR prefix that
+// redkit.ErrorValue adds.
+package args
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Errors reported by the parser
+var (
+	ErrSyntax      = errors.New("syntax error")
+	ErrNotInteger  = errors.New("value is not an integer or out of range")
+	ErrNotFloat    = errors.New("value is not a valid float")
+	ErrInvalidTime = errors.New("invalid expire time")
+)
+
+// Parser reads command arguments one at a time
+type Parser struct {
+	args []string
+	pos  int
+	err  error
+}
+
+// New returns a parser positioned at the first of args
+func New(args []string) *Parser {
+	return &Parser{args: args}
+}
+
+// Err returns the first error the parser ran into
+func (p *Parser) Err() error {
+	return p.err
+}
+
+// Fail records err unless an error was already recorded
+func (p *Parser) Fail(err error) {
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+// More reports whether arguments are left and no error occurred
+func (p *Parser) More() bool {
+	return p.err == nil && p.pos < len(p.args)
+}
+
+// Remaining returns the number of arguments not consumed yet
+func (p *Parser) Remaining() int {
+	return len(p.args) - p.pos
+}
+
+// Rest consumes and returns all remaining arguments
+func (p *Parser) Rest() []string {
+	if p.err != nil {
+		return nil
+	}
+	rest := p.args[p.pos:]
+	p.pos = len(p.args)
+	return rest
+}
+
+// Peek returns the next argument without consuming it, or "" if there is none
+func (p *Parser) Peek() string {
+	if p.err != nil || p.pos >= len(p.args) {
+		return ""
+	}
+	return p.args[p.pos]
+}
+
+// NextString consumes the next argument. A missing argument is a syntax error.
+func (p *Parser) NextString() string {
+	if p.err != nil {
+		return ""
+	}
+	if p.pos >= len(p.args) {
+		p.err = ErrSyntax
+		return ""
+	}
+	arg := p.args[p.pos]
+	p.pos++
+	return arg
+}
+
+// NextInt consumes the next argument as a 64-bit integer
+func (p *Parser) NextInt() int64 {
+	arg := p.NextString()
+	if p.err != nil {
+		return 0
+	}
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		p.err = ErrNotInteger
+		return 0
+	}
+	return n
+}
+
+// NextFloat consumes the next argument as a float, accepting inf and -inf
+func (p *Parser) NextFloat() float64 {
+	arg := p.NextString()
+	if p.err != nil {
+		return 0
+	}
+	f, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(f) {
+		p.err = ErrNotFloat
+		return 0
+	}
+	return f
+}
+
+// NextKeyword consumes the next argument if it is one of keywords, ignoring
+// case, and returns it upper-cased. Anything else is a syntax error.
+func (p *Parser) NextKeyword(keywords ...string) string {
+	arg := p.NextString()
+	if p.err != nil {
+		return ""
+	}
+	for _, keyword := range keywords {
+		if strings.EqualFold(arg, keyword) {
+			return strings.ToUpper(keyword)
+		}
+	}
+	p.err = ErrSyntax
+	return ""
+}
+
+// MatchFlag consumes the next argument if it equals keyword, ignoring case
+func (p *Parser) MatchFlag(keyword string) bool {
+	if p.err != nil || p.pos >= len(p.args) || !strings.EqualFold(p.args[p.pos], keyword) {
+		return false
+	}
+	p.pos++
+	return true
+}
+
+// MatchKeyword consumes keyword and the value following it if the next
+// argument equals keyword, ignoring case. The value is parsed into target,
+// which must be a *string, *int64, *int, *float64 or *[]byte. A keyword
+// without a value is a syntax error.
+func (p *Parser) MatchKeyword(keyword string, target any) bool {
+	if !p.MatchFlag(keyword) {
+		return false
+	}
+	switch t := target.(type) {
+	case *string:
+		*t = p.NextString()
+	case *[]byte:
+		*t = []byte(p.NextString())
+	case *int64:
+		*t = p.NextInt()
+	case *int:
+		n := p.NextInt()
+		if n < math.MinInt || n > math.MaxInt {
+			p.Fail(ErrNotInteger)
+		}
+		*t = int(n)
+	case *float64:
+		*t = p.NextFloat()
+	default:
+		panic("args: unsupported MatchKeyword target")
+	}
+	return true
+}
+
+// NextPair consumes the next two arguments, as in field value pairs. It
+// returns false once the arguments are exhausted; an odd argument left over
+// is a syntax error.
+func (p *Parser) NextPair() (key, value string, ok bool) {
+	if !p.More() {
+		return "", "", false
+	}
+	if p.Remaining() < 2 {
+		p.err = ErrSyntax
+		return "", "", false
+	}
+	key, value = p.args[p.pos], p.args[p.pos+1]
+	p.pos += 2
+	return key, value, true
+}
+
+// Done records a syntax error if arguments are left unconsumed and returns Err
+func (p *Parser) Done() error {
+	if p.err == nil && p.pos < len(p.args) {
+		p.err = ErrSyntax
+	}
+	return p.err
+}
+
+// SetOptions holds the options of the SET command
+type SetOptions struct {
+	TTL      time.Duration // from EX or PX
+	ExpireAt time.Time     // from EXAT or PXAT
+	KeepTTL  bool
+	NX       bool
+	XX       bool
+	Get      bool
+}
+
+// ParseSetOptions parses the options following SET key value:
+// [NX | XX] [GET] [EX seconds | PX milliseconds | EXAT unix-time-seconds |
+// PXAT unix-time-milliseconds | KEEPTTL]
+func ParseSetOptions(args []string) (SetOptions, error) {
+	var opts SetOptions
+	p := New(args)
+	expire := false
+	for p.More() {
+		var n int64
+		switch {
+		case p.MatchFlag("NX"):
+			opts.NX = true
+		case p.MatchFlag("XX"):
+			opts.XX = true
+		case p.MatchFlag("GET"):
+			opts.Get = true
+		case p.MatchFlag("KEEPTTL"):
+			opts.KeepTTL = true
+			if expire {
+				p.Fail(ErrSyntax)
+			}
+			expire = true
+		case p.MatchKeyword("EX", &n):
+			opts.TTL = p.expireIn(n, time.Second, &expire)
+		case p.MatchKeyword("PX", &n):
+			opts.TTL = p.expireIn(n, time.Millisecond, &expire)
+		case p.MatchKeyword("EXAT", &n):
+			p.expireIn(n, time.Second, &expire)
+			opts.ExpireAt = time.Unix(n, 0)
+		case p.MatchKeyword("PXAT", &n):
+			p.expireIn(n, time.Millisecond, &expire)
+			opts.ExpireAt = time.UnixMilli(n)
+		default:
+			p.Fail(ErrSyntax)
+		}
+	}
+	if opts.NX && opts.XX {
+		p.Fail(ErrSyntax)
+	}
+	if err := p.Err(); err != nil {
+		if err == ErrInvalidTime {
+			err = fmt.Errorf("%w in 'set' command", err)
+		}
+		return SetOptions{}, err
+	}
+	return opts, nil
+}
+
+// expireIn validates an expiration option and converts it to a duration.
+// expire tracks whether an expiration option was already given.
+func (p *Parser) expireIn(n int64, unit time.Duration, expire *bool) time.Duration {
+	if p.err != nil {
+		return 0
+	}
+	if *expire {
+		p.Fail(ErrSyntax)
+		return 0
+	}
+	*expire = true
+	if n <= 0 || n > math.MaxInt64/int64(unit) {
+		p.Fail(ErrInvalidTime)
+		return 0
+	}
+	return time.Duration(n) * unit
+}
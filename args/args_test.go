@@ -0,0 +1,102 @@
+package args
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParserCursor(t *testing.T) {
+	p := New([]string{"key", "10", "1.5", "LIMIT", "5", "withscores", "a", "b"})
+	if key := p.NextString(); key != "key" {
+		t.Errorf("Expected key, got %q", key)
+	}
+	if n := p.NextInt(); n != 10 {
+		t.Errorf("Expected 10, got %d", n)
+	}
+	if f := p.NextFloat(); f != 1.5 {
+		t.Errorf("Expected 1.5, got %v", f)
+	}
+	var limit int
+	if !p.MatchKeyword("limit", &limit) || limit != 5 {
+		t.Errorf("Expected LIMIT 5, got %d", limit)
+	}
+	if p.MatchFlag("NX") {
+		t.Error("Expected NX not to match")
+	}
+	if !p.MatchFlag("WITHSCORES") {
+		t.Error("Expected WITHSCORES to match")
+	}
+	if k, v, ok := p.NextPair(); !ok || k != "a" || v != "b" {
+		t.Errorf("Expected pair a b, got %q %q %v", k, v, ok)
+	}
+	if _, _, ok := p.NextPair(); ok {
+		t.Error("Expected no more pairs")
+	}
+	if err := p.Done(); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestParserErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		parse func(p *Parser)
+		args  []string
+		want  error
+	}{
+		{"missing", func(p *Parser) { p.NextString(); p.NextString() }, []string{"a"}, ErrSyntax},
+		{"integer", func(p *Parser) { p.NextInt() }, []string{"x"}, ErrNotInteger},
+		{"float", func(p *Parser) { p.NextFloat() }, []string{"nan"}, ErrNotFloat},
+		{"keyword value", func(p *Parser) { var n int64; p.MatchKeyword("COUNT", &n) }, []string{"COUNT"}, ErrSyntax},
+		{"keyword choice", func(p *Parser) { p.NextKeyword("ASC", "DESC") }, []string{"up"}, ErrSyntax},
+		{"odd pairs", func(p *Parser) {
+			for _, _, ok := p.NextPair(); ok; _, _, ok = p.NextPair() {
+			}
+		}, []string{"a", "b", "c"}, ErrSyntax},
+		{"leftover", func(p *Parser) { p.NextString(); p.Done() }, []string{"a", "b"}, ErrSyntax},
+	}
+	for _, tt := range tests {
+		p := New(tt.args)
+		tt.parse(p)
+		if !errors.Is(p.Err(), tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, p.Err())
+		}
+	}
+
+	// The first error sticks and later reads return zero values
+	p := New([]string{"x", "5"})
+	p.NextInt()
+	if n := p.NextInt(); n != 0 || p.Err() != ErrNotInteger {
+		t.Errorf("Expected the first error to stick, got %d %v", n, p.Err())
+	}
+}
+
+func TestParseSetOptions(t *testing.T) {
+	opts, err := ParseSetOptions([]string{"nx", "GET", "EX", "10"})
+	if err != nil || !opts.NX || !opts.Get || opts.TTL != 10*time.Second {
+		t.Errorf("Unexpected options %+v, %v", opts, err)
+	}
+	opts, err = ParseSetOptions([]string{"PXAT", "1700000000000", "XX"})
+	if err != nil || !opts.XX || !opts.ExpireAt.Equal(time.UnixMilli(1700000000000)) {
+		t.Errorf("Unexpected options %+v, %v", opts, err)
+	}
+	if opts, err = ParseSetOptions([]string{"KEEPTTL"}); err != nil || !opts.KeepTTL {
+		t.Errorf("Unexpected options %+v, %v", opts, err)
+	}
+
+	for _, bad := range [][]string{
+		{"NX", "XX"},
+		{"EX", "1", "PX", "1"},
+		{"EX", "1", "KEEPTTL"},
+		{"EX"},
+		{"BOGUS"},
+	} {
+		if _, err := ParseSetOptions(bad); !errors.Is(err, ErrSyntax) {
+			t.Errorf("%v: expected syntax error, got %v", bad, err)
+		}
+	}
+	if _, err := ParseSetOptions([]string{"EX", "0"}); !errors.Is(err, ErrInvalidTime) || err.Error() != "invalid expire time in 'set' command" {
+		t.Errorf("Expected invalid expire time, got %v", err)
+	}
+}
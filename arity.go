@@ -0,0 +1,74 @@
+package redkit
+
+import "sync/atomic"
+
+// Arity describes how many arguments a command accepts, not counting its name.
+// The dispatcher rejects calls outside it with "wrong number of arguments"
+// before the handler runs.
+type Arity struct {
+	Min  int // minimum number of arguments
+	Max  int // maximum number of arguments, or -1 for no limit
+	Step int // if set, arguments beyond Min must come in groups of Step
+}
+
+// Accepts reports whether n arguments satisfy the arity
+func (a Arity) Accepts(n int) bool {
+	if n < a.Min || (a.Max >= 0 && n > a.Max) {
+		return false
+	}
+	return a.Step <= 1 || (n-a.Min)%a.Step == 0
+}
+
+// CommandOption configures a command registered with RegisterCommand or RegisterCommandFunc
+type CommandOption func(*commandEntry)
+
+// commandEntry is a registered command
+type commandEntry struct {
+	handler CommandHandler
+	arity   *Arity // nil when the handler checks its own arguments
+	info    CommandInfo
+
+	// subcommands is set on containers created by RegisterSubcommand, and
+	// fallback is the plain handler the container replaced, if any
+	subcommands map[string]*commandEntry
+	fallback    CommandHandler
+
+	disabled atomic.Bool       // set by DisableCommand
+	limit    *concurrencyLimit // set by MaxConcurrent and MaxConcurrentQueued
+
+	// exclusive commands take execMu themselves, as EXEC does
+	exclusive bool
+
+	// scoped caches the handler wrapped in the middleware of UseFor and
+	// UseForCategory, see scopedHandler
+	scoped atomic.Pointer[scopedChain]
+}
+
+// WithArity declares the arguments the command accepts
+func WithArity(arity Arity) CommandOption {
+	return func(e *commandEntry) {
+		e.arity = &arity
+	}
+}
+
+// ExactArgs declares a command taking exactly n arguments
+func ExactArgs(n int) CommandOption {
+	return WithArity(Arity{Min: n, Max: n})
+}
+
+// MinArgs declares a command taking at least n arguments
+func MinArgs(n int) CommandOption {
+	return WithArity(Arity{Min: n, Max: -1})
+}
+
+// RangeArgs declares a command taking between min and max arguments
+func RangeArgs(min, max int) CommandOption {
+	return WithArity(Arity{Min: min, Max: max})
+}
+
+// VariadicArgs declares a command taking min arguments followed by any number
+// of groups of step arguments, such as MSET key value [key value ...] with
+// VariadicArgs(2, 2)
+func VariadicArgs(min, step int) CommandOption {
+	return WithArity(Arity{Min: min, Max: -1, Step: step})
+}
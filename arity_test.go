@@ -0,0 +1,59 @@
+package redkit
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func TestArityAccepts(t *testing.T) {
+	tests := []struct {
+		name  string
+		arity Arity
+		ok    []int
+		bad   []int
+	}{
+		{"exact", Arity{Min: 2, Max: 2}, []int{2}, []int{0, 1, 3}},
+		{"min", Arity{Min: 1, Max: -1}, []int{1, 2, 10}, []int{0}},
+		{"range", Arity{Min: 0, Max: 1}, []int{0, 1}, []int{2}},
+		{"pairs", Arity{Min: 2, Max: -1, Step: 2}, []int{2, 4, 6}, []int{0, 1, 3, 5}},
+	}
+	for _, tt := range tests {
+		for _, n := range tt.ok {
+			if !tt.arity.Accepts(n) {
+				t.Errorf("%s: expected %d arguments to be accepted", tt.name, n)
+			}
+		}
+		for _, n := range tt.bad {
+			if tt.arity.Accepts(n) {
+				t.Errorf("%s: expected %d arguments to be rejected", tt.name, n)
+			}
+		}
+	}
+}
+
+func TestArityValidatedBeforeHandler(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	var calls atomic.Int32
+	server.RegisterCommandFunc("MSET", func(conn *Connection, cmd *Command) RedisValue {
+		calls.Add(1)
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	}, VariadicArgs(2, 2))
+
+	client := dialRaw(t, address)
+	client.send(t, "MSET", "a", "1", "b")
+	if line := client.readLine(t); line != "-ERR wrong number of arguments for 'mset' command" {
+		t.Errorf("Expected arity error, got %q", line)
+	}
+	client.send(t, "MSET", "a", "1", "b", "2")
+	if line := client.readLine(t); line != "+OK" {
+		t.Errorf("Expected +OK, got %q", line)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected the handler to run once, ran %d times", n)
+	}
+
+	client.send(t, "ECHO")
+	if line := client.readLine(t); line != "-ERR wrong number of arguments for 'echo' command" {
+		t.Errorf("Expected arity error for the built-in ECHO, got %q", line)
+	}
+}
@@ -0,0 +1,92 @@
+package redkit
+
+import (
+	"fmt"
+	"time"
+)
+
+// ArrayWriter streams the elements of an array reply directly to the client,
+// so handlers producing huge replies don't need to build the whole []RedisValue.
+type ArrayWriter struct {
+	conn    *Connection
+	size    int
+	written int
+	closed  bool
+}
+
+// ArrayWriter writes the header of an array reply with size elements and returns
+// a writer for its elements. Once a handler starts a streamed reply, the value it
+// returns is discarded; it must write exactly size elements and then call Close.
+func (c *Connection) ArrayWriter(size int) (*ArrayWriter, error) {
+	if size < 0 {
+		return nil, fmt.Errorf("invalid array size: %d", size)
+	}
+	if c.streamed {
+		return nil, fmt.Errorf("reply already started for this command")
+	}
+	if c.inExec {
+		return nil, fmt.Errorf("replies can't be streamed inside a transaction or script")
+	}
+
+	if c.server != nil && c.conn != nil {
+		if timeout := c.server.writeTimeout(); timeout > 0 {
+			if err := c.conn.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// The write lock is held until Close so that pushes from other goroutines
+	// can't land in the middle of the array
+	c.writeMu.Lock()
+	c.streamed = true
+	w := &ArrayWriter{conn: c, size: size}
+	c.arrayWriter = w
+	if err := c.writeHeader('*', int64(size)); err != nil {
+		w.release()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write writes the next element of the array
+func (w *ArrayWriter) Write(value RedisValue) error {
+	if w.closed {
+		return fmt.Errorf("array reply already closed")
+	}
+	if w.written >= w.size {
+		return fmt.Errorf("array reply already has %d elements", w.size)
+	}
+	if err := w.conn.writeValue(value); err != nil {
+		return err
+	}
+	w.written++
+	return nil
+}
+
+// Remaining returns how many elements still have to be written
+func (w *ArrayWriter) Remaining() int {
+	return w.size - w.written
+}
+
+// Close finishes the reply. It fails if fewer elements than announced were
+// written, in which case the connection can no longer be used and is closed.
+func (w *ArrayWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.release()
+
+	if w.written != w.size {
+		w.conn.Close()
+		return fmt.Errorf("array reply closed after %d of %d elements", w.written, w.size)
+	}
+	return nil
+}
+
+// release gives up the connection's write lock
+func (w *ArrayWriter) release() {
+	w.closed = true
+	w.conn.arrayWriter = nil
+	w.conn.writeMu.Unlock()
+}
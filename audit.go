@@ -0,0 +1,288 @@
+package redkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redacted replaces the arguments audit events must not carry, such as passwords
+const redacted = "(redacted)"
+
+// AuditEvent describes a command run by a client, as passed to an AuditSink
+type AuditEvent struct {
+	Time     time.Time     `json:"time"` // when the command started
+	ConnID   uint64        `json:"conn_id"`
+	Addr     string        `json:"addr,omitempty"`
+	User     string        `json:"user,omitempty"`
+	Command  string        `json:"command"` // lower-case command name
+	Args     []string      `json:"args"`    // with the sensitive ones redacted
+	Keys     []string      `json:"keys,omitempty"`
+	Status   string        `json:"status"` // "ok", or the error class such as "ERR" or "NOAUTH"
+	Duration time.Duration `json:"duration"`
+}
+
+// AuditSink receives the events of Server.Audit. Audit is called on the
+// goroutine that ran the command, after the reply is built, so it must not
+// block. A sink that is also an io.Closer is closed on shutdown.
+type AuditSink interface {
+	Audit(event AuditEvent)
+}
+
+// AuditSinkFunc adapts a function to an AuditSink
+type AuditSinkFunc func(event AuditEvent)
+
+// Audit implements AuditSink
+func (f AuditSinkFunc) Audit(event AuditEvent) {
+	f(event)
+}
+
+// AuditOption configures the events of Server.Audit
+type AuditOption func(*auditor)
+
+// AuditRedact sets the function redacting the arguments of command in audit
+// events, replacing the built-in rule if there is one. It gets a copy of the
+// arguments it may change in place.
+func AuditRedact(command string, redact func(args []string) []string) AuditOption {
+	return func(a *auditor) {
+		a.redact[strings.ToUpper(command)] = redact
+	}
+}
+
+// AuditSkip leaves the given commands, such as PING, out of the audit events
+func AuditSkip(commands ...string) AuditOption {
+	return func(a *auditor) {
+		for _, name := range commands {
+			a.skip[strings.ToUpper(name)] = struct{}{}
+		}
+	}
+}
+
+// auditor turns commands into the events of one sink
+type auditor struct {
+	sink   AuditSink
+	redact map[string]func(args []string) []string
+	skip   map[string]struct{}
+}
+
+// defaultRedactions hide the credentials Redis commands carry
+func defaultRedactions() map[string]func(args []string) []string {
+	return map[string]func(args []string) []string{
+		"AUTH": redactFrom(0),
+		"HELLO": func(args []string) []string {
+			return redactAfterToken(args, "AUTH", 2)
+		},
+		"MIGRATE": func(args []string) []string {
+			args = redactAfterToken(args, "AUTH", 1)
+			return redactAfterToken(args, "AUTH2", 2)
+		},
+		"CONFIG": func(args []string) []string {
+			if len(args) > 0 && strings.EqualFold(args[0], "SET") {
+				for i := 1; i+1 < len(args); i += 2 {
+					switch strings.ToLower(args[i]) {
+					case "requirepass", "masterauth", "masteruser":
+						args[i+1] = redacted
+					}
+				}
+			}
+			return args
+		},
+		"ACL": func(args []string) []string {
+			if len(args) > 0 && strings.EqualFold(args[0], "SETUSER") {
+				return redactFrom(2)(args)
+			}
+			return args
+		},
+	}
+}
+
+// redactFrom returns a rule redacting every argument from index i on
+func redactFrom(from int) func(args []string) []string {
+	return func(args []string) []string {
+		for i := from; i < len(args); i++ {
+			args[i] = redacted
+		}
+		return args
+	}
+}
+
+// redactAfterToken redacts the n arguments following token
+func redactAfterToken(args []string, token string, n int) []string {
+	for i := 0; i < len(args); i++ {
+		if !strings.EqualFold(args[i], token) {
+			continue
+		}
+		for j := i + 1; j <= i+n && j < len(args); j++ {
+			args[j] = redacted
+		}
+		i += n
+	}
+	return args
+}
+
+// Audit sends an event for every command clients run to sink, with the
+// credentials of AUTH, HELLO, CONFIG SET, ACL SETUSER and MIGRATE redacted.
+// Commands run by EXEC and scripts get events of their own. Audit may be
+// called more than once to add sinks.
+func (s *Server) Audit(sink AuditSink, opts ...AuditOption) {
+	a := &auditor{
+		sink:   sink,
+		redact: defaultRedactions(),
+		skip:   make(map[string]struct{}),
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	if closer, ok := sink.(io.Closer); ok {
+		s.OnShutdown(func() { closer.Close() })
+	}
+	s.AfterCommand(func(conn *Connection, cmd *Command, reply RedisValue, duration time.Duration) {
+		s.audit(a, conn, cmd, reply, duration)
+	})
+}
+
+func (s *Server) audit(a *auditor, conn *Connection, cmd *Command, reply RedisValue, duration time.Duration) {
+	if cmd == nil || cmd.Name == "" {
+		return
+	}
+	name, entry, _ := s.handlerTable().lookup(cmd.Name)
+	if name == "" {
+		name = strings.ToUpper(cmd.Name)
+	}
+	if _, ok := a.skip[name]; ok {
+		return
+	}
+
+	args := append([]string(nil), cmd.Args...)
+	if redact := a.redact[name]; redact != nil {
+		args = redact(args)
+	}
+	event := AuditEvent{
+		Time:     time.Now().Add(-duration),
+		Command:  strings.ToLower(name),
+		Args:     args,
+		Status:   "ok",
+		Duration: duration,
+	}
+	if entry != nil {
+		event.Keys = entry.info.ExtractKeys(cmd)
+	}
+	if reply.Type == ErrorReply {
+		event.Status, _, _ = strings.Cut(reply.Str, " ")
+	}
+	if conn != nil {
+		event.ConnID = conn.ID()
+		event.User = conn.User()
+		if addr := conn.RemoteAddr(); addr != nil {
+			event.Addr = addr.String()
+		}
+	}
+	a.sink.Audit(event)
+}
+
+// NewAuditWriter returns a sink writing events to w as JSON, one per line
+func NewAuditWriter(w io.Writer) AuditSink {
+	return &auditWriter{enc: json.NewEncoder(w)}
+}
+
+type auditWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (w *auditWriter) Audit(event AuditEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.enc.Encode(event)
+}
+
+// NewAuditChannel returns a sink sending events to ch. Events are dropped
+// while ch is full, so commands never wait for the reader.
+func NewAuditChannel(ch chan<- AuditEvent) AuditSink {
+	return AuditSinkFunc(func(event AuditEvent) {
+		select {
+		case ch <- event:
+		default:
+		}
+	})
+}
+
+// AuditWebhook is a sink POSTing events to a URL as JSON, see NewAuditWebhook
+type AuditWebhook struct {
+	url     string
+	client  *http.Client
+	events  chan AuditEvent
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// NewAuditWebhook returns a sink POSTing every event to url from a background
+// goroutine. Up to buffer events wait to be sent; more are dropped, as are the
+// ones the endpoint fails to accept. If client is nil, http.DefaultClient is used.
+func NewAuditWebhook(url string, client *http.Client, buffer int) *AuditWebhook {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	w := &AuditWebhook{
+		url:     url,
+		client:  client,
+		events:  make(chan AuditEvent, buffer),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Audit implements AuditSink
+func (w *AuditWebhook) Audit(event AuditEvent) {
+	select {
+	case <-w.done:
+	case w.events <- event:
+	default:
+	}
+}
+
+// Close sends the events still buffered and stops the sink
+func (w *AuditWebhook) Close() error {
+	w.once.Do(func() { close(w.done) })
+	<-w.stopped
+	return nil
+}
+
+func (w *AuditWebhook) run() {
+	defer close(w.stopped)
+	for {
+		select {
+		case event := <-w.events:
+			w.post(event)
+		case <-w.done:
+			for {
+				select {
+				case event := <-w.events:
+					w.post(event)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (w *AuditWebhook) post(event AuditEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
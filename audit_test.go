@@ -0,0 +1,87 @@
+package redkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAudit(t *testing.T) {
+	server := NewServer(":0")
+	server.RegisterCommandFunc("SET", func(conn *Connection, cmd *Command) RedisValue {
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	}, MinArgs(2), WithKeys(1, 1, 1))
+
+	events := make(chan AuditEvent, 10)
+	server.Audit(NewAuditChannel(events), AuditSkip("ping"))
+
+	server.handleCommand(nil, &Command{Name: "set", Args: []string{"k", "v"}})
+	server.handleCommand(nil, &Command{Name: "PING"})
+	server.handleCommand(nil, &Command{Name: "AUTH", Args: []string{"alice", "secret"}})
+	server.handleCommand(nil, &Command{Name: "HELLO", Args: []string{"3", "AUTH", "alice", "secret", "SETNAME", "x"}})
+
+	expected := []AuditEvent{
+		{Command: "set", Args: []string{"k", "v"}, Keys: []string{"k"}, Status: "ok"},
+		{Command: "auth", Args: []string{redacted, redacted}},
+		{Command: "hello", Args: []string{"3", "AUTH", redacted, redacted, "SETNAME", "x"}},
+	}
+	for _, want := range expected {
+		got := <-events
+		if got.Command != want.Command || !reflect.DeepEqual(got.Args, want.Args) {
+			t.Errorf("Expected %s %v, got %s %v", want.Command, want.Args, got.Command, got.Args)
+		}
+		if want.Keys != nil && !reflect.DeepEqual(got.Keys, want.Keys) {
+			t.Errorf("Expected keys %v, got %v", want.Keys, got.Keys)
+		}
+		if want.Status != "" && got.Status != want.Status {
+			t.Errorf("Expected status %s, got %s", want.Status, got.Status)
+		}
+		if got.Time.IsZero() {
+			t.Error("Expected the event to have a time")
+		}
+	}
+	if len(events) != 0 {
+		t.Errorf("Expected PING to be skipped, got %+v", <-events)
+	}
+
+	server.handleCommand(nil, &Command{Name: "NOPE"})
+	if got := <-events; got.Status != "ERR" || got.Command != "nope" {
+		t.Errorf("Expected an ERR event for nope, got %+v", got)
+	}
+}
+
+func TestAuditWriterAndWebhook(t *testing.T) {
+	received := make(chan AuditEvent, 10)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event AuditEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("Failed to decode webhook body: %v", err)
+		}
+		received <- event
+	}))
+	defer endpoint.Close()
+
+	var out strings.Builder
+	server := NewServer(":0")
+	webhook := NewAuditWebhook(endpoint.URL, nil, 10)
+	server.Audit(NewAuditWriter(&out))
+	server.Audit(webhook)
+
+	server.handleCommand(nil, &Command{Name: "CONFIG", Args: []string{"SET", "requirepass", "hunter2"}})
+	webhook.Close()
+
+	if strings.Contains(out.String(), "hunter2") || !strings.Contains(out.String(), `"command":"config"`) {
+		t.Errorf("Unexpected audit log %s", out.String())
+	}
+	select {
+	case event := <-received:
+		if !reflect.DeepEqual(event.Args, []string{"SET", "requirepass", redacted}) {
+			t.Errorf("Expected the password redacted, got %v", event.Args)
+		}
+	default:
+		t.Error("Expected Close to send the buffered event")
+	}
+}
@@ -0,0 +1,90 @@
+package redkit
+
+import (
+	"crypto/subtle"
+	"errors"
+)
+
+// defaultUser is the user AUTH password authenticates as, as in Redis
+const defaultUser = "default"
+
+// SetAuthenticated marks the connection as authenticated as user. Auth
+// middleware and AUTH handlers call it once the credentials are checked.
+func (c *Connection) SetAuthenticated(user string) {
+	c.mu.Lock()
+	c.user = user
+	c.mu.Unlock()
+	c.authenticated.Store(true)
+}
+
+// clearAuthenticated undoes SetAuthenticated, as RESET does
+func (c *Connection) clearAuthenticated() {
+	c.authenticated.Store(false)
+	c.mu.Lock()
+	c.user = ""
+	c.mu.Unlock()
+}
+
+// IsAuthenticated reports whether SetAuthenticated was called on the connection
+func (c *Connection) IsAuthenticated() bool {
+	return c.authenticated.Load()
+}
+
+// User returns the user the connection authenticated as, or an empty string
+func (c *Connection) User() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.user
+}
+
+// PasswordAuthenticator returns an Authenticator accepting password for the
+// default user, like Redis requirepass
+func PasswordAuthenticator(password string) func(conn *Connection, username, password string) error {
+	want := []byte(password)
+	return func(conn *Connection, username, password string) error {
+		if username != defaultUser || subtle.ConstantTimeCompare([]byte(password), want) != 1 {
+			return errWrongPass
+		}
+		return nil
+	}
+}
+
+var errWrongPass = NewError(ErrPrefixWrongPass, "invalid username-password pair or user is disabled.")
+
+// requiresAuth reports whether conn must authenticate before running cmd
+func (s *Server) requiresAuth(conn *Connection, entry *commandEntry, name string) bool {
+	if !s.RequireAuth && s.Authenticator == nil {
+		return false
+	}
+	if conn.IsAuthenticated() {
+		return false
+	}
+	return !entry.allowedWithoutAuth(name)
+}
+
+// handleAuth implements AUTH [username] password using the server's Authenticator
+func (s *Server) handleAuth(conn *Connection, cmd *Command) RedisValue {
+	var username, password string
+	switch len(cmd.Args) {
+	case 1:
+		username, password = defaultUser, cmd.Args[0]
+	case 2:
+		username, password = cmd.Args[0], cmd.Args[1]
+	default:
+		return WrongArity(cmd.Name).Value()
+	}
+
+	if s.Authenticator == nil {
+		return NewError(ErrPrefixGeneric, "AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?").Value()
+	}
+	if err := s.Authenticator(conn, username, password); err != nil {
+		s.logConn(LogLevelWarn, conn, "Authentication failed", errAttr(err))
+		var redisErr *RedisError
+		if errors.As(err, &redisErr) {
+			return redisErr.Value()
+		}
+		return errWrongPass.Value()
+	}
+	conn.SetAuthenticated(username)
+	return RedisValue{Type: SimpleString, Str: "OK"}
+}
@@ -0,0 +1,84 @@
+package redkit
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestPasswordAuth(t *testing.T) {
+	config := DefaultServerConfig()
+	WithPassword("secret")(config)
+	server, address := startTestServer(t, config)
+
+	raw := dialRaw(t, address)
+	raw.send(t, "PING")
+	if line := raw.readLine(t); line != "-NOAUTH Authentication required." {
+		t.Fatalf("Expected NOAUTH, got %q", line)
+	}
+	raw.send(t, "AUTH", "wrong")
+	if line := raw.readLine(t); !strings.HasPrefix(line, "-WRONGPASS ") {
+		t.Errorf("Expected WRONGPASS, got %q", line)
+	}
+	raw.send(t, "AUTH", "admin", "secret")
+	if line := raw.readLine(t); !strings.HasPrefix(line, "-WRONGPASS ") {
+		t.Errorf("Expected WRONGPASS for another user, got %q", line)
+	}
+
+	rdb := redis.NewClient(&redis.Options{Addr: address, Password: "secret", Protocol: 2})
+	defer rdb.Close()
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		t.Fatalf("Ping after AUTH failed: %v", err)
+	}
+	conns := server.Connections()
+	if conns[0].IsAuthenticated() {
+		t.Error("Expected the raw connection to stay unauthenticated")
+	}
+	if last := conns[len(conns)-1]; !last.IsAuthenticated() || last.User() != "default" {
+		t.Errorf("Expected go-redis connection authenticated as default, got %v %q", last.IsAuthenticated(), last.User())
+	}
+}
+
+func TestAuthWithoutAuthenticator(t *testing.T) {
+	_, address := startTestServer(t, nil)
+	raw := dialRaw(t, address)
+
+	raw.send(t, "PING")
+	if line := raw.readLine(t); line != "+PONG" {
+		t.Fatalf("Expected +PONG without auth configured, got %q", line)
+	}
+	raw.send(t, "AUTH", "secret")
+	if line := raw.readLine(t); !strings.HasPrefix(line, "-ERR AUTH <password> called without any password configured") {
+		t.Errorf("Expected no password error, got %q", line)
+	}
+}
+
+func TestRequireAuthMiddleware(t *testing.T) {
+	config := DefaultServerConfig()
+	config.RequireAuth = true
+	server, address := startTestServer(t, config)
+	server.UseFunc(func(conn *Connection, cmd *Command, next CommandHandler) RedisValue {
+		if strings.EqualFold(cmd.Name, "AUTH") && len(cmd.Args) == 2 && cmd.Args[1] == "token" {
+			conn.SetAuthenticated(cmd.Args[0])
+			return RedisValue{Type: SimpleString, Str: "OK"}
+		}
+		return next.Handle(conn, cmd)
+	})
+
+	raw := dialRaw(t, address)
+	raw.send(t, "ECHO", "hi")
+	if line := raw.readLine(t); line != "-NOAUTH Authentication required." {
+		t.Fatalf("Expected NOAUTH, got %q", line)
+	}
+	raw.send(t, "AUTH", "alice", "token")
+	if line := raw.readLine(t); line != "+OK" {
+		t.Fatalf("Expected +OK, got %q", line)
+	}
+	raw.send(t, "CLIENT", "INFO")
+	raw.readLine(t)
+	if info := raw.readLine(t); !strings.Contains(info, " user=alice ") {
+		t.Errorf("Expected user=alice in %q", info)
+	}
+}
@@ -0,0 +1,183 @@
+package redkit
+
+import (
+	"sync"
+	"time"
+)
+
+// blocker is a connection parked by BlockOnKeys
+type blocker struct {
+	keys   []watchKey
+	signal chan string // the key that was signalled, buffered so SignalKey never waits
+}
+
+// blockingTable holds, for every key, the connections blocked on it in the
+// order they blocked
+type blockingTable struct {
+	mu     sync.Mutex
+	queues map[watchKey][]*blocker
+}
+
+func newBlockingTable() *blockingTable {
+	return &blockingTable{queues: make(map[watchKey][]*blocker)}
+}
+
+func (t *blockingTable) add(b *blocker) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, k := range b.keys {
+		t.queues[k] = append(t.queues[k], b)
+	}
+}
+
+func (t *blockingTable) remove(b *blocker) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, k := range b.keys {
+		queue := t.queues[k]
+		for i, other := range queue {
+			if other == b {
+				queue = append(queue[:i], queue[i+1:]...)
+				break
+			}
+		}
+		if len(queue) == 0 {
+			delete(t.queues, k)
+		} else {
+			t.queues[k] = queue
+		}
+	}
+}
+
+// release removes b, then hands any key signalled to it that it didn't
+// take on to the next connection in line, so the signal isn't lost
+func (t *blockingTable) release(b *blocker) {
+	t.remove(b)
+	select {
+	case key := <-b.signal:
+		t.signal(watchKey{db: b.keys[0].db, key: key})
+	default:
+	}
+}
+
+// signal wakes the connection that has been blocked on k the longest
+func (t *blockingTable) signal(k watchKey) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	handOut(t.queues[k], k.key)
+}
+
+// signalDB wakes, for every key of database db, the connection that has
+// been blocked on it the longest
+func (t *blockingTable) signalDB(db int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for k, queue := range t.queues {
+		if k.db == db {
+			handOut(queue, k.key)
+		}
+	}
+}
+
+// handOut gives key to the first blocker of queue that has no signal to
+// handle yet. One that has tries all its keys if its own signal doesn't
+// serve it, so a key none takes isn't missed.
+func handOut(queue []*blocker, key string) {
+	for _, b := range queue {
+		select {
+		case b.signal <- key:
+			return
+		default:
+		}
+	}
+}
+
+// SignalKey tells the connections blocked on key of database db that it may
+// now serve them, as BLPOP waits for LPUSH. Stores call it after adding data
+// to a key. The connection blocked the longest tries first; when it is
+// served, the next one is signalled in turn.
+func (s *Server) SignalKey(db int, key string) {
+	s.blocking.signal(watchKey{db: db, key: key})
+}
+
+// BlockOnKeys parks the connection until one of keys of its selected
+// database is signalled with SignalKey, for blocking commands such as BLPOP
+// or XREAD BLOCK. Each time, wake is called with the signalled key and
+// returns the reply and true if it could serve the command, or false to keep
+// waiting. wake is also tried for every key right after the connection is
+// parked, so data added meanwhile isn't missed.
+//
+// It returns a null array once timeout elapses (0 waits forever) or the
+// connection is closed. Inside MULTI/EXEC or a script it doesn't wait and
+// returns the null array right away, like Redis. Other connections' commands,
+// including EXEC, keep running while it waits.
+func (c *Connection) BlockOnKeys(keys []string, timeout time.Duration, wake func(key string) (RedisValue, bool)) RedisValue {
+	timedOut := RedisValue{Type: NullArray}
+	if c.inExec {
+		return timedOut
+	}
+
+	s := c.server
+	db := c.DB()
+	b := &blocker{keys: make([]watchKey, len(keys)), signal: make(chan string, 1)}
+	for i, key := range keys {
+		b.keys[i] = watchKey{db: db, key: key}
+	}
+	s.blocking.add(b)
+	defer s.blocking.release(b)
+
+	for _, key := range keys {
+		if reply, ok := wake(key); ok {
+			return reply
+		}
+	}
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	c.flushPending()
+	c.setState(StateBlocked)
+	defer c.setState(StateProcessing)
+	for {
+		if c.execLocked {
+			s.execMu.RUnlock()
+		}
+		var key string
+		var done bool
+		select {
+		case key = <-b.signal:
+		case <-expired:
+			done = true
+		case <-c.ctx.Done():
+			done = true
+		}
+		if c.execLocked {
+			s.execMu.RLock()
+		}
+		if done {
+			return timedOut
+		}
+		if reply, ok := wake(key); ok {
+			// Leave the rest of the data to the next connection in line
+			s.blocking.remove(b)
+			s.SignalKey(db, key)
+			return reply
+		}
+		// Another connection took the data first. Keys signalled while this
+		// one was pending were passed over, so try them all.
+		for _, other := range keys {
+			if other == key {
+				continue
+			}
+			if reply, ok := wake(other); ok {
+				s.blocking.remove(b)
+				s.SignalKey(db, other)
+				return reply
+			}
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package redkit
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// registerTestList registers PUSH key value and BPOP key timeout-ms on a
+// minimal list store that signals blocked connections
+func registerTestList(server *Server) {
+	var mu sync.Mutex
+	lists := make(map[string][]string)
+	pop := func(key string) (RedisValue, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(lists[key]) == 0 {
+			return RedisValue{}, false
+		}
+		value := lists[key][0]
+		lists[key] = lists[key][1:]
+		return RedisValue{Type: BulkString, Bulk: []byte(value)}, true
+	}
+	server.RegisterCommandFunc("PUSH", func(conn *Connection, cmd *Command) RedisValue {
+		mu.Lock()
+		lists[cmd.Args[0]] = append(lists[cmd.Args[0]], cmd.Args[1:]...)
+		n := len(lists[cmd.Args[0]])
+		mu.Unlock()
+		server.SignalKey(conn.DB(), cmd.Args[0])
+		return RedisValue{Type: Integer, Int: int64(n)}
+	}, MinArgs(2))
+	server.RegisterCommandFunc("BPOP", func(conn *Connection, cmd *Command) RedisValue {
+		if reply, ok := pop(cmd.Args[0]); ok {
+			return reply
+		}
+		ms, _ := strconv.Atoi(cmd.Args[1])
+		return conn.BlockOnKeys(cmd.Args[:1], time.Duration(ms)*time.Millisecond, pop)
+	}, ExactArgs(2), WithFlags(CmdBlocking))
+}
+
+// readAsync returns a channel receiving the next lines sent to client
+func readAsync(client *rawClient, n int) <-chan string {
+	lines := make(chan string, n)
+	go func() {
+		for i := 0; i < n; i++ {
+			line, err := client.reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			lines <- line[:len(line)-2]
+		}
+	}()
+	return lines
+}
+
+func expectLine(t *testing.T, lines <-chan string, want string) {
+	t.Helper()
+	select {
+	case line := <-lines:
+		if line != want {
+			t.Errorf("Expected %q, got %q", want, line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Timed out waiting for %q", want)
+	}
+}
+
+func TestBlockOnKeys(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	registerTestList(server)
+
+	first := dialRaw(t, address)
+	second := dialRaw(t, address)
+	pusher := dialRaw(t, address)
+
+	first.send(t, "BPOP", "list", "0")
+	firstLines := readAsync(first, 2)
+	waitForState(t, server, StateBlocked, 1)
+	second.send(t, "BPOP", "list", "0")
+	secondLines := readAsync(second, 2)
+	waitForState(t, server, StateBlocked, 2)
+
+	// Other commands, including transactions, run while clients are blocked
+	pusher.send(t, "MULTI")
+	pusher.readLine(t)
+	pusher.send(t, "PING")
+	pusher.readLine(t)
+	pusher.send(t, "EXEC")
+	pusher.readLine(t)
+	pusher.readLine(t)
+
+	// The connection blocked first is served first, then the next in line
+	pusher.send(t, "PUSH", "list", "a", "b")
+	pusher.readLine(t)
+	expectLine(t, firstLines, "$1")
+	expectLine(t, firstLines, "a")
+	expectLine(t, secondLines, "$1")
+	expectLine(t, secondLines, "b")
+}
+
+// TestBlockOnKeysSignalledTogether tests that keys signalled while the
+// connection first in line still has a signal pending go to the next one
+func TestBlockOnKeysSignalledTogether(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	server.EnableBuiltinStore()
+	first := dialRaw(t, address)
+	second := dialRaw(t, address)
+	pusher := dialRaw(t, address)
+
+	first.send(t, "BLPOP", "a", "b", "0")
+	firstLines := readAsync(first, 5)
+	waitForState(t, server, StateBlocked, 1)
+	second.send(t, "BLPOP", "b", "0")
+	secondLines := readAsync(second, 5)
+	waitForState(t, server, StateBlocked, 2)
+
+	pusher.send(t, "MULTI")
+	pusher.send(t, "RPUSH", "a", "x")
+	pusher.send(t, "RPUSH", "b", "y")
+	pusher.send(t, "EXEC")
+	expectLines(t, pusher, "+OK", "+QUEUED", "+QUEUED", "*2", ":1", ":1")
+	for _, want := range []string{"*2", "$1", "a", "$1", "x"} {
+		expectLine(t, firstLines, want)
+	}
+	for _, want := range []string{"*2", "$1", "b", "$1", "y"} {
+		expectLine(t, secondLines, want)
+	}
+}
+
+// TestBlockOnKeysFlushesPipelined tests that replies to commands pipelined
+// ahead of a blocking command are sent before the connection waits
+func TestBlockOnKeysFlushesPipelined(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	server.EnableBuiltinStore()
+	client := dialRaw(t, address)
+
+	client.sendRaw(t, "*3\r\n$3\r\nSET\r\n$1\r\na\r\n$1\r\n1\r\n*3\r\n$5\r\nBLPOP\r\n$1\r\nx\r\n$1\r\n0\r\n")
+	lines := readAsync(client, 6)
+	waitForState(t, server, StateBlocked, 1)
+	expectLine(t, lines, "+OK")
+
+	pusher := dialRaw(t, address)
+	pusher.send(t, "RPUSH", "x", "y")
+	expectLines(t, pusher, ":1")
+	for _, want := range []string{"*2", "$1", "x", "$1", "y"} {
+		expectLine(t, lines, want)
+	}
+}
+
+func TestBlockOnKeysTimeout(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	registerTestList(server)
+	client := dialRaw(t, address)
+
+	start := time.Now()
+	client.send(t, "BPOP", "list", "50")
+	if line := client.readLine(t); line != "*-1" {
+		t.Errorf("Expected a null array on timeout, got %q", line)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected BPOP to wait for the timeout, returned after %v", elapsed)
+	}
+
+	// Inside a transaction a blocking command doesn't wait
+	client.send(t, "MULTI")
+	client.readLine(t)
+	client.send(t, "BPOP", "list", "0")
+	client.readLine(t)
+	client.send(t, "EXEC")
+	if line := client.readLine(t); line != "*1" {
+		t.Fatalf("Expected a one-element array, got %q", line)
+	}
+	if line := client.readLine(t); line != "*-1" {
+		t.Errorf("Expected a null array, got %q", line)
+	}
+}
+
+// waitForState waits until n connections are in state
+func waitForState(t *testing.T, server *Server, state ConnState, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		count := 0
+		for _, conn := range server.Connections() {
+			if conn.GetState() == state {
+				count++
+			}
+		}
+		if count == n {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %d connections in state %s", n, state)
+}
@@ -0,0 +1,358 @@
+package redkit
+
+import (
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// handleClient implements the CLIENT command family
+func (s *Server) handleClient(conn *Connection, cmd *Command) RedisValue {
+	switch strings.ToUpper(cmd.Args[0]) {
+	case "ID":
+		if len(cmd.Args) != 1 {
+			return WrongArity("client|id").Value()
+		}
+		return RedisValue{Type: Integer, Int: int64(conn.ID())}
+	case "SETNAME":
+		if len(cmd.Args) != 2 {
+			return WrongArity("client|setname").Value()
+		}
+		if !validClientName(cmd.Args[1]) {
+			return NewError(ErrPrefixGeneric, "Client names cannot contain spaces, newlines or special characters.").Value()
+		}
+		conn.SetName(cmd.Args[1])
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	case "GETNAME":
+		if len(cmd.Args) != 1 {
+			return WrongArity("client|getname").Value()
+		}
+		name := conn.Name()
+		if name == "" {
+			return RedisValue{Type: Null}
+		}
+		return RedisValue{Type: BulkString, Bulk: []byte(name)}
+	case "SETINFO":
+		return clientSetInfo(conn, cmd.Args[1:])
+	case "INFO":
+		if len(cmd.Args) != 1 {
+			return WrongArity("client|info").Value()
+		}
+		return RedisValue{Type: Verbatim, Str: conn.clientInfo() + "\n", Format: VerbatimText}
+	case "LIST":
+		return s.clientList(cmd.Args[1:])
+	case "KILL":
+		return s.clientKill(conn, cmd.Args[1:])
+	case "PAUSE":
+		return s.clientPause(cmd.Args[1:])
+	case "UNPAUSE":
+		if len(cmd.Args) != 1 {
+			return WrongArity("client|unpause").Value()
+		}
+		s.Unpause()
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	case "REPLY":
+		if len(cmd.Args) != 2 {
+			return WrongArity("client|reply").Value()
+		}
+		return clientReply(conn, cmd.Args[1])
+	case "NO-EVICT":
+		if len(cmd.Args) != 2 {
+			return WrongArity("client|no-evict").Value()
+		}
+		return clientFlagSwitch(conn, FlagNoEvict, cmd.Args[1])
+	case "NO-TOUCH":
+		if len(cmd.Args) != 2 {
+			return WrongArity("client|no-touch").Value()
+		}
+		return clientFlagSwitch(conn, FlagNoTouch, cmd.Args[1])
+	case "TRACKING":
+		return s.clientTracking(conn, cmd.Args[1:])
+	default:
+		return UnknownSubcommand("CLIENT", cmd.Args[0]).Value()
+	}
+}
+
+// clientReply implements CLIENT REPLY ON|OFF|SKIP. The +OK returned for OFF
+// and SKIP is itself dropped, as the flag applies to the reply being written.
+func clientReply(conn *Connection, mode string) RedisValue {
+	switch strings.ToUpper(mode) {
+	case "ON":
+		conn.ClearFlag(FlagReplyOff | FlagReplySkip | flagReplySkipNext)
+	case "OFF":
+		conn.SetFlag(FlagReplyOff)
+	case "SKIP":
+		if !conn.HasFlag(FlagReplyOff) {
+			conn.SetFlag(flagReplySkipNext)
+		}
+	default:
+		return NewError(ErrPrefixGeneric, "syntax error").Value()
+	}
+	return RedisValue{Type: SimpleString, Str: "OK"}
+}
+
+// clientFlagSwitch implements the ON|OFF argument of CLIENT NO-EVICT and NO-TOUCH
+func clientFlagSwitch(conn *Connection, flag ConnFlag, value string) RedisValue {
+	switch strings.ToUpper(value) {
+	case "ON":
+		conn.SetFlag(flag)
+	case "OFF":
+		conn.ClearFlag(flag)
+	default:
+		return NewError(ErrPrefixGeneric, "syntax error").Value()
+	}
+	return RedisValue{Type: SimpleString, Str: "OK"}
+}
+
+// clientList implements CLIENT LIST [TYPE type] [ID id [id ...]]
+func (s *Server) clientList(args []string) RedisValue {
+	filter := &killFilter{}
+	var ids map[uint64]bool
+	if len(args) > 0 {
+		switch strings.ToUpper(args[0]) {
+		case "TYPE":
+			if len(args) != 2 {
+				return NewError(ErrPrefixGeneric, "syntax error").Value()
+			}
+			typ, ok := clientType(args[1])
+			if !ok {
+				return NewError(ErrPrefixGeneric, "Unknown client type '%s'", args[1]).Value()
+			}
+			filter.typ = typ
+		case "ID":
+			if len(args) < 2 {
+				return NewError(ErrPrefixGeneric, "syntax error").Value()
+			}
+			ids = make(map[uint64]bool, len(args)-1)
+			for _, arg := range args[1:] {
+				id, err := strconv.ParseUint(arg, 10, 64)
+				if err != nil || id == 0 {
+					return NewError(ErrPrefixGeneric, "Invalid client ID").Value()
+				}
+				ids[id] = true
+			}
+		default:
+			return NewError(ErrPrefixGeneric, "syntax error").Value()
+		}
+	}
+
+	var b strings.Builder
+	for _, conn := range s.Connections() {
+		if ids != nil && !ids[conn.ID()] {
+			continue
+		}
+		if !filter.matches(conn, nil) {
+			continue
+		}
+		b.WriteString(conn.clientInfo())
+		b.WriteByte('\n')
+	}
+	return RedisValue{Type: Verbatim, Str: b.String(), Format: VerbatimText}
+}
+
+// clientType normalizes a CLIENT KILL / CLIENT LIST type name
+func clientType(name string) (string, bool) {
+	typ := strings.ToLower(name)
+	switch typ {
+	case "normal", "master", "replica", "pubsub":
+		return typ, true
+	case "slave":
+		return "replica", true
+	default:
+		return "", false
+	}
+}
+
+// killFilter selects the connections CLIENT KILL closes and CLIENT LIST shows
+type killFilter struct {
+	id     uint64
+	addr   string
+	laddr  string
+	typ    string
+	maxAge time.Duration
+	skipMe bool
+}
+
+func (f *killFilter) matches(conn, self *Connection) bool {
+	if f.skipMe && conn == self {
+		return false
+	}
+	if f.id != 0 && conn.ID() != f.id {
+		return false
+	}
+	if f.addr != "" && addrString(conn.RemoteAddr()) != f.addr {
+		return false
+	}
+	if f.laddr != "" && addrString(conn.LocalAddr()) != f.laddr {
+		return false
+	}
+	switch f.typ {
+	case "normal":
+		if conn.IsSubscribed() {
+			return false
+		}
+	case "pubsub":
+		if !conn.IsSubscribed() {
+			return false
+		}
+	case "master", "replica":
+		return false // replication isn't supported
+	}
+	if f.maxAge > 0 && time.Since(conn.created) < f.maxAge {
+		return false
+	}
+	return true
+}
+
+// clientKill implements CLIENT KILL addr:port and
+// CLIENT KILL [ID id] [ADDR addr] [LADDR addr] [TYPE type] [MAXAGE secs] [SKIPME yes|no]
+func (s *Server) clientKill(conn *Connection, args []string) RedisValue {
+	if len(args) == 0 {
+		return WrongArity("client|kill").Value()
+	}
+
+	// Old form: a single address, replying +OK
+	if len(args) == 1 {
+		filter := &killFilter{addr: args[0]}
+		if s.killClients(conn, filter) == 0 {
+			return NewError(ErrPrefixGeneric, "No such client").Value()
+		}
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	}
+
+	if len(args)%2 != 0 {
+		return NewError(ErrPrefixGeneric, "syntax error").Value()
+	}
+	filter := &killFilter{skipMe: true}
+	for i := 0; i < len(args); i += 2 {
+		value := args[i+1]
+		switch strings.ToUpper(args[i]) {
+		case "ID":
+			id, err := strconv.ParseUint(value, 10, 64)
+			if err != nil || id == 0 {
+				return NewError(ErrPrefixGeneric, "client-id should be greater than 0").Value()
+			}
+			filter.id = id
+		case "ADDR":
+			filter.addr = value
+		case "LADDR":
+			filter.laddr = value
+		case "TYPE":
+			typ, ok := clientType(value)
+			if !ok {
+				return NewError(ErrPrefixGeneric, "Unknown client type '%s'", value).Value()
+			}
+			filter.typ = typ
+		case "MAXAGE":
+			secs, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || secs < 0 {
+				return NewError(ErrPrefixGeneric, "syntax error").Value()
+			}
+			filter.maxAge = time.Duration(secs) * time.Second
+		case "SKIPME":
+			switch strings.ToLower(value) {
+			case "yes":
+				filter.skipMe = true
+			case "no":
+				filter.skipMe = false
+			default:
+				return NewError(ErrPrefixGeneric, "syntax error").Value()
+			}
+		default:
+			return NewError(ErrPrefixGeneric, "syntax error").Value()
+		}
+	}
+	return RedisValue{Type: Integer, Int: int64(s.killClients(conn, filter))}
+}
+
+// killClients closes every connection matching filter and returns how many it
+// closed. The calling connection is closed only after its reply is written.
+func (s *Server) killClients(self *Connection, filter *killFilter) int {
+	killed := 0
+	for _, conn := range s.Connections() {
+		if !filter.matches(conn, self) {
+			continue
+		}
+		killed++
+		if conn == self {
+			conn.closeAfterReply.Store(true)
+			continue
+		}
+		s.logConn(LogLevelInfo, conn, "Killed by CLIENT KILL", slog.Uint64("killer", self.ID()))
+		conn.closeWithReason(ErrClientKilled)
+	}
+	return killed
+}
+
+// clientSetInfo implements CLIENT SETINFO LIB-NAME|LIB-VER value
+func clientSetInfo(conn *Connection, args []string) RedisValue {
+	if len(args) != 2 {
+		return WrongArity("client|setinfo").Value()
+	}
+	if !validClientName(args[1]) {
+		return NewError(ErrPrefixGeneric, "%s cannot contain spaces, newlines or special characters.", args[0]).Value()
+	}
+
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	switch strings.ToUpper(args[0]) {
+	case "LIB-NAME":
+		conn.libName = args[1]
+	case "LIB-VER":
+		conn.libVersion = args[1]
+	default:
+		return NewError(ErrPrefixGeneric, "Unrecognized option '%s'", args[0]).Value()
+	}
+	return RedisValue{Type: SimpleString, Str: "OK"}
+}
+
+// validClientName reports whether name only contains printable, non-space ASCII
+func validClientName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] < '!' || name[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// clientInfo formats the connection as a CLIENT INFO / CLIENT LIST line
+func (c *Connection) clientInfo() string {
+	c.mu.RLock()
+	name, user, libName, libVersion := c.name, c.user, c.libName, c.libVersion
+	lastUsed, lastCommand := c.lastUsed, c.lastCommand
+	c.mu.RUnlock()
+
+	now := time.Now()
+	var b strings.Builder
+	b.WriteString("id=")
+	b.WriteString(strconv.FormatUint(c.ID(), 10))
+	b.WriteString(" addr=")
+	b.WriteString(addrString(c.RemoteAddr()))
+	b.WriteString(" laddr=")
+	b.WriteString(addrString(c.LocalAddr()))
+	b.WriteString(" name=")
+	b.WriteString(name)
+	b.WriteString(" age=")
+	b.WriteString(strconv.FormatInt(int64(now.Sub(c.created)/time.Second), 10))
+	b.WriteString(" idle=")
+	b.WriteString(strconv.FormatInt(int64(now.Sub(lastUsed)/time.Second), 10))
+	b.WriteString(" cmd=")
+	b.WriteString(lastCommand)
+	b.WriteString(" flags=")
+	b.WriteString(c.Flags().String())
+	b.WriteString(" user=")
+	b.WriteString(user)
+	b.WriteString(" db=")
+	b.WriteString(strconv.Itoa(c.DB()))
+	b.WriteString(" state=")
+	b.WriteString(c.GetState().String())
+	b.WriteString(" resp=")
+	b.WriteString(strconv.Itoa(c.Protocol()))
+	b.WriteString(" lib-name=")
+	b.WriteString(libName)
+	b.WriteString(" lib-ver=")
+	b.WriteString(libVersion)
+	return b.String()
+}
@@ -0,0 +1,339 @@
+package redkit
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestClientSetNameGetName(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	client := dialRaw(t, address)
+
+	client.send(t, "CLIENT", "GETNAME")
+	if line := client.readLine(t); line != "$-1" {
+		t.Fatalf("Expected null name, got %q", line)
+	}
+
+	client.send(t, "CLIENT", "SETNAME", "worker-1")
+	if line := client.readLine(t); line != "+OK" {
+		t.Fatalf("Expected +OK, got %q", line)
+	}
+	client.send(t, "CLIENT", "GETNAME")
+	client.readLine(t)
+	if line := client.readLine(t); line != "worker-1" {
+		t.Errorf("Expected worker-1, got %q", line)
+	}
+	if name := server.Connections()[0].Name(); name != "worker-1" {
+		t.Errorf("Expected Connection.Name to be worker-1, got %q", name)
+	}
+
+	client.send(t, "CLIENT", "SETNAME", "bad name")
+	if line := client.readLine(t); !strings.HasPrefix(line, "-ERR Client names cannot contain spaces") {
+		t.Errorf("Expected invalid name error, got %q", line)
+	}
+}
+
+func TestClientInfo(t *testing.T) {
+	_, address := startTestServer(t, nil)
+	client := dialRaw(t, address)
+
+	client.send(t, "CLIENT", "SETNAME", "reporter")
+	client.readLine(t)
+	client.send(t, "CLIENT", "SETINFO", "LIB-NAME", "raw")
+	client.readLine(t)
+	client.send(t, "CLIENT", "INFO")
+	client.readLine(t)
+	info := client.readLine(t)
+
+	for _, field := range []string{"id=", " addr=127.0.0.1:", " name=reporter ", " cmd=client ", " resp=2 ", " lib-name=raw "} {
+		if !strings.Contains(info, field) {
+			t.Errorf("Expected %q in CLIENT INFO %q", field, info)
+		}
+	}
+}
+
+func TestClientNameFromGoRedis(t *testing.T) {
+	server, address := startTestServer(t, nil)
+
+	rdb := redis.NewClient(&redis.Options{Addr: address, ClientName: "go-app", Protocol: 2})
+	defer rdb.Close()
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		t.Fatalf("Ping failed: %v", err)
+	}
+
+	conns := server.Connections()
+	if len(conns) != 1 || conns[0].Name() != "go-app" {
+		t.Fatalf("Expected one connection named go-app, got %d", len(conns))
+	}
+}
+
+func TestClientList(t *testing.T) {
+	_, address := startTestServer(t, nil)
+
+	worker := dialRaw(t, address)
+	worker.send(t, "CLIENT", "SETNAME", "worker")
+	worker.readLine(t)
+	worker.send(t, "CLIENT", "ID")
+	workerID := strings.TrimPrefix(worker.readLine(t), ":")
+
+	rdb := redis.NewClient(&redis.Options{Addr: address, ClientName: "lister", Protocol: 2})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	list, err := rdb.ClientList(ctx).Result()
+	if err != nil {
+		t.Fatalf("CLIENT LIST failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(list, "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 clients, got %q", list)
+	}
+	if !strings.Contains(lines[0], " name=worker ") || !strings.Contains(lines[0], " cmd=client ") || !strings.Contains(lines[0], " state=active ") {
+		t.Errorf("Unexpected line for worker: %q", lines[0])
+	}
+	if !strings.Contains(lines[1], " name=lister ") || !strings.Contains(lines[1], " state=processing ") {
+		t.Errorf("Unexpected line for lister: %q", lines[1])
+	}
+
+	list, err = rdb.Do(ctx, "CLIENT", "LIST", "ID", workerID).Text()
+	if err != nil {
+		t.Fatalf("CLIENT LIST ID failed: %v", err)
+	}
+	if !strings.HasPrefix(list, "id="+workerID+" ") || strings.Count(list, "\n") != 1 {
+		t.Errorf("Expected only the worker, got %q", list)
+	}
+
+	list, err = rdb.Do(ctx, "CLIENT", "LIST", "TYPE", "pubsub").Text()
+	if err != nil || list != "" {
+		t.Errorf("Expected no pubsub clients, got %q, %v", list, err)
+	}
+	if err := rdb.Do(ctx, "CLIENT", "LIST", "TYPE", "bogus").Err(); err == nil || !strings.Contains(err.Error(), "Unknown client type") {
+		t.Errorf("Expected unknown type error, got %v", err)
+	}
+}
+
+func TestClientKill(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	reasons := make(chan error, 4)
+	server.OnDisconnect(func(conn *Connection, info DisconnectInfo) {
+		reasons <- info.Reason
+	})
+
+	killer := dialRaw(t, address)
+	victim := dialRaw(t, address)
+	victim.send(t, "CLIENT", "ID")
+	victimID := strings.TrimPrefix(victim.readLine(t), ":")
+
+	killer.send(t, "CLIENT", "KILL", "ID", victimID)
+	if line := killer.readLine(t); line != ":1" {
+		t.Fatalf("Expected :1, got %q", line)
+	}
+	victim.expectClosed(t)
+	select {
+	case reason := <-reasons:
+		if !errors.Is(reason, ErrClientKilled) {
+			t.Errorf("Expected ErrClientKilled, got %v", reason)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for the killed connection")
+	}
+
+	// SKIPME defaults to yes, so the caller survives a filter matching it
+	killer.send(t, "CLIENT", "KILL", "ADDR", killer.conn.LocalAddr().String())
+	if line := killer.readLine(t); line != ":0" {
+		t.Fatalf("Expected :0, got %q", line)
+	}
+
+	killer.send(t, "CLIENT", "KILL", "TYPE", "bogus")
+	if line := killer.readLine(t); line != "-ERR Unknown client type 'bogus'" {
+		t.Errorf("Expected unknown type error, got %q", line)
+	}
+	killer.send(t, "CLIENT", "KILL", "127.0.0.1:1")
+	if line := killer.readLine(t); line != "-ERR No such client" {
+		t.Errorf("Expected no such client, got %q", line)
+	}
+
+	// The old form may kill the caller, which still gets its reply
+	killer.send(t, "CLIENT", "KILL", killer.conn.LocalAddr().String())
+	if line := killer.readLine(t); line != "+OK" {
+		t.Fatalf("Expected +OK, got %q", line)
+	}
+	killer.expectClosed(t)
+}
+
+func TestClientPause(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	server.RegisterCommandFunc("SET", func(conn *Connection, cmd *Command) RedisValue {
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	})
+
+	admin := dialRaw(t, address)
+	client := dialRaw(t, address)
+
+	admin.send(t, "CLIENT", "PAUSE", "10000", "WRITE")
+	if line := admin.readLine(t); line != "+OK" {
+		t.Fatalf("Expected +OK, got %q", line)
+	}
+
+	client.send(t, "SET", "key", "value")
+	client.send(t, "PING")
+	replies := make(chan string, 2)
+	go func() {
+		for i := 0; i < 2; i++ {
+			line, err := client.reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			replies <- strings.TrimSuffix(line, "\r\n")
+		}
+	}()
+	select {
+	case line := <-replies:
+		t.Fatalf("Expected SET to be paused, got %q", line)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Reads are not held back by a write pause
+	other := dialRaw(t, address)
+	other.send(t, "PING")
+	if line := other.readLine(t); line != "+PONG" {
+		t.Fatalf("Expected +PONG during write pause, got %q", line)
+	}
+
+	admin.send(t, "CLIENT", "UNPAUSE")
+	admin.readLine(t)
+	for _, want := range []string{"+OK", "+PONG"} {
+		select {
+		case line := <-replies:
+			if line != want {
+				t.Errorf("Expected %q, got %q", want, line)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timed out waiting for the paused command")
+		}
+	}
+
+	// A pause of all commands ends by itself after the timeout
+	admin.send(t, "CLIENT", "PAUSE", "100", "ALL")
+	admin.readLine(t)
+	start := time.Now()
+	other.send(t, "PING")
+	other.readLine(t)
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected PING to be paused, returned after %v", elapsed)
+	}
+
+	admin.send(t, "CLIENT", "PAUSE", "100", "SOME")
+	if line := admin.readLine(t); line != "-ERR CLIENT PAUSE mode must be WRITE or ALL" {
+		t.Errorf("Expected mode error, got %q", line)
+	}
+}
+
+// TestClientPauseFlushesPipelined tests that replies to commands pipelined
+// ahead of a paused one are sent while it waits
+func TestClientPauseFlushesPipelined(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	server.RegisterCommandFunc("SET", func(conn *Connection, cmd *Command) RedisValue {
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	})
+	server.Pause(2*time.Second, true)
+	defer server.Unpause()
+
+	client := dialRaw(t, address)
+	client.sendRaw(t, "*1\r\n$4\r\nPING\r\n*3\r\n$3\r\nSET\r\n$1\r\na\r\n$1\r\n1\r\n")
+	client.conn.SetReadDeadline(time.Now().Add(time.Second))
+	if line := client.readLine(t); line != "+PONG" {
+		t.Fatalf("Expected +PONG, got %q", line)
+	}
+}
+
+func TestClientReply(t *testing.T) {
+	_, address := startTestServer(t, nil)
+	client := dialRaw(t, address)
+
+	client.send(t, "CLIENT", "REPLY", "OFF")
+	client.send(t, "PING")
+	client.send(t, "CLIENT", "REPLY", "ON")
+	if line := client.readLine(t); line != "+OK" {
+		t.Fatalf("Expected only the +OK of CLIENT REPLY ON, got %q", line)
+	}
+
+	client.send(t, "CLIENT", "REPLY", "SKIP")
+	client.send(t, "ECHO", "skipped")
+	client.send(t, "ECHO", "kept")
+	client.readLine(t)
+	if line := client.readLine(t); line != "kept" {
+		t.Errorf("Expected the reply after the skipped one, got %q", line)
+	}
+
+	client.send(t, "CLIENT", "REPLY", "MAYBE")
+	if line := client.readLine(t); line != "-ERR syntax error" {
+		t.Errorf("Expected syntax error, got %q", line)
+	}
+}
+
+func TestClientNoEvictNoTouch(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	client := dialRaw(t, address)
+
+	client.send(t, "CLIENT", "NO-EVICT", "on")
+	client.readLine(t)
+	client.send(t, "CLIENT", "NO-TOUCH", "on")
+	client.readLine(t)
+
+	conn := server.Connections()[0]
+	if !conn.HasFlag(FlagNoEvict | FlagNoTouch) {
+		t.Errorf("Expected NO-EVICT and NO-TOUCH, got %v", conn.Flags())
+	}
+	client.send(t, "CLIENT", "INFO")
+	client.readLine(t)
+	if info := client.readLine(t); !strings.Contains(info, " flags=eT ") {
+		t.Errorf("Expected flags=eT in %q", info)
+	}
+	client.readLine(t) // the CRLF closing the bulk string
+
+	client.send(t, "CLIENT", "NO-EVICT", "off")
+	client.readLine(t)
+	if conn.HasFlag(FlagNoEvict) || !conn.HasFlag(FlagNoTouch) {
+		t.Errorf("Expected only NO-TOUCH, got %v", conn.Flags())
+	}
+}
+
+func TestReadOnlyMode(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	server.RegisterCommandFunc("SET", func(conn *Connection, cmd *Command) RedisValue {
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	})
+	server.RegisterCommandFunc("GET", func(conn *Connection, cmd *Command) RedisValue {
+		return RedisValue{Type: Null}
+	})
+	client := dialRaw(t, address)
+
+	client.send(t, "READONLY")
+	if line := client.readLine(t); line != "+OK" {
+		t.Fatalf("Expected +OK, got %q", line)
+	}
+	client.send(t, "SET", "key", "value")
+	if line := client.readLine(t); line != "-READONLY You can't write against a read only connection." {
+		t.Errorf("Expected READONLY error, got %q", line)
+	}
+	client.send(t, "GET", "key")
+	if line := client.readLine(t); line != "$-1" {
+		t.Errorf("Expected reads to pass, got %q", line)
+	}
+	if flags := server.Connections()[0].Flags(); flags.String() != "r" {
+		t.Errorf("Expected flags r, got %q", flags)
+	}
+
+	client.send(t, "READWRITE")
+	client.readLine(t)
+	client.send(t, "SET", "key", "value")
+	if line := client.readLine(t); line != "+OK" {
+		t.Errorf("Expected SET to pass after READWRITE, got %q", line)
+	}
+}
@@ -0,0 +1,52 @@
+package redkit
+
+import "context"
+
+// ArgBytes returns argument i (0-based, excluding the command name) as bytes.
+// For bulk string arguments this references the parsed request data without
+// copying, so the slice must not be modified. It returns nil if i is out of range.
+func (c *Command) ArgBytes(i int) []byte {
+	if i < 0 || i >= len(c.Args) {
+		return nil
+	}
+
+	// Raw includes the command name at index 0. Middleware may rewrite Args or
+	// construct commands without Raw, in which case Args is authoritative.
+	if len(c.Raw) == len(c.Args)+1 && c.Raw[i+1].Type == BulkString && string(c.Raw[i+1].Bulk) == c.Args[i] {
+		return c.Raw[i+1].Bulk
+	}
+	return []byte(c.Args[i])
+}
+
+// ArgsBytes returns all arguments as byte slices, see ArgBytes
+func (c *Command) ArgsBytes() [][]byte {
+	args := make([][]byte, len(c.Args))
+	for i := range c.Args {
+		args[i] = c.ArgBytes(i)
+	}
+	return args
+}
+
+// Context returns the command's context. For commands read from a client it is
+// derived from the connection and cancelled when the connection is closed, the
+// server shuts down, the CommandTimeout elapses or, with CancelOnDisconnect,
+// the client hangs up while the command runs; context.Cause reports which.
+// Long-running handlers should watch it and abort their work. Commands built
+// by hand have a background context.
+func (c *Command) Context() context.Context {
+	if c.ctx != nil {
+		return c.ctx
+	}
+	return context.Background()
+}
+
+// WithContext returns a shallow copy of the command using ctx, so middleware can
+// attach values or tighten deadlines before calling the next handler
+func (c *Command) WithContext(ctx context.Context) *Command {
+	if ctx == nil {
+		panic("nil context")
+	}
+	copied := *c
+	copied.ctx = ctx
+	return &copied
+}
@@ -0,0 +1,57 @@
+package redkit
+
+import "strings"
+
+// writeCommands lists the standard commands that may modify the keyspace. For
+// commands registered without flags, it decides which commands CLIENT PAUSE
+// WRITE holds back and READONLY connections reject.
+var writeCommands = commandSet(
+	// Strings
+	APPEND, DECR, DECRBY, DELEX, GETDEL, GETEX, GETSET, INCR, INCRBY, INCRBYFLOAT,
+	MSET, MSETEX, MSETNX, PSETEX, SET, SETEX, SETNX, SETRANGE,
+	// Hashes
+	HDEL, HEXPIRE, HEXPIREAT, HGETDEL, HGETEX, HINCRBY, HINCRBYFLOAT, HMSET,
+	HPERSIST, HPEXPIRE, HPEXPIREAT, HSET, HSETEX, HSETNX,
+	// Lists
+	BLMOVE, BLMPOP, BLPOP, BRPOP, BRPOPLPUSH, LINSERT, LMOVE, LMPOP, LPOP, LPUSH,
+	LPUSHX, LREM, LSET, LTRIM, RPOP, RPOPLPUSH, RPUSH, RPUSHX,
+	// Sets
+	SADD, SDIFFSTORE, SINTERSTORE, SMOVE, SPOP, SREM, SUNIONSTORE,
+	// Sorted sets
+	BZMPOP, BZPOPMAX, BZPOPMIN, ZADD, ZDIFFSTORE, ZINCRBY, ZINTERSTORE, ZMPOP,
+	ZPOPMAX, ZPOPMIN, ZRANGESTORE, ZREM, ZREMRANGEBYLEX, ZREMRANGEBYRANK,
+	ZREMRANGEBYSCORE, ZUNIONSTORE,
+	// Streams
+	XACK, XACKDEL, XADD, XAUTOCLAIM, XCLAIM, XDEL, XDELEX, XGROUP, XREADGROUP, XSETID, XTRIM,
+	// Bitmaps, HyperLogLog and geo
+	BITFIELD, BITOP, SETBIT, PFADD, PFMERGE, GEOADD, GEOSEARCHSTORE,
+	// JSON, time series and vector sets
+	JSON_ARRAPPEND, JSON_ARRINSERT, JSON_ARRPOP, JSON_ARRTRIM, JSON_CLEAR, JSON_DEL,
+	JSON_FORGET, JSON_MERGE, JSON_MSET, JSON_NUMINCRBY, JSON_NUMMULTBY, JSON_SET,
+	JSON_STRAPPEND, JSON_TOGGLE,
+	TS_ADD, TS_ALTER, TS_CREATE, TS_CREATERULE, TS_DECRBY, TS_DEL, TS_DELETERULE, TS_INCRBY, TS_MADD,
+	VADD, VREM, VSETATTR,
+	// Generic and server
+	COPY, DEL, EXPIRE, EXPIREAT, MIGRATE, MOVE, PERSIST, PEXPIRE, PEXPIREAT, RENAME,
+	RENAMENX, RESTORE, SORT, UNLINK, FLUSHALL, FLUSHDB, SWAPDB,
+	// Commands that can run writes
+	EVAL, EVALSHA, FCALL, PUBLISH, SPUBLISH,
+)
+
+// noAuthCommands may run before the connection has authenticated, unless
+// registered with flags
+var noAuthCommands = commandSet(AUTH, HELLO, QUIT, RESET)
+
+func commandSet(names ...CommandType) map[string]struct{} {
+	set := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		set[string(name)] = struct{}{}
+	}
+	return set
+}
+
+// isWriteCommand reports whether the command named name may modify data
+func isWriteCommand(name string) bool {
+	_, ok := writeCommands[strings.ToUpper(name)]
+	return ok
+}
@@ -0,0 +1,437 @@
+package redkit
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CommandFlag describes a property of a command
+type CommandFlag uint32
+
+const (
+	// CmdReadOnly marks commands that only read data
+	CmdReadOnly CommandFlag = 1 << iota
+	// CmdWrite marks commands that may modify data. They are held back by
+	// CLIENT PAUSE WRITE and rejected on READONLY connections.
+	CmdWrite
+	// CmdAdmin marks administrative commands
+	CmdAdmin
+	// CmdBlocking marks commands that may block the client
+	CmdBlocking
+	// CmdPubSub marks Pub/Sub commands
+	CmdPubSub
+	// CmdNoAuth marks commands allowed before the connection authenticates
+	CmdNoAuth
+	// CmdFast marks commands running in constant or logarithmic time
+	CmdFast
+)
+
+// CommandInfo is the metadata of a registered command: its flags, where its
+// keys are, and the ACL categories it belongs to
+type CommandInfo struct {
+	Flags CommandFlag
+	// FirstKey is the position of the first key argument, 1 being the first
+	// argument after the command name, or 0 for commands without keys
+	FirstKey int
+	// LastKey is the position of the last key; -1 means the last argument,
+	// -2 the one before it, and so on. Zero means FirstKey is the only key.
+	LastKey int
+	// KeyStep is the distance between keys, such as 2 for MSET key value ...
+	KeyStep int
+	// ACLCategories lists the categories such as "string" or "dangerous",
+	// without the leading @
+	ACLCategories []string
+	// Keys, if set, finds the keys of commands whose key positions depend on
+	// their arguments, such as EVAL or GEORADIUS ... STORE. Its result is
+	// used instead of FirstKey, LastKey and KeyStep.
+	Keys func(cmd *Command) []string
+	// Summary is the one-line description returned by COMMAND DOCS
+	Summary string
+	// Deprecated marks a command kept for old clients, see the Deprecated
+	// option, and ReplacedBy is what they should call instead
+	Deprecated bool
+	ReplacedBy string
+}
+
+// commandFlagNames maps flags to the names COMMAND reports
+var commandFlagNames = []struct {
+	flag CommandFlag
+	name string
+}{
+	{CmdWrite, "write"},
+	{CmdReadOnly, "readonly"},
+	{CmdAdmin, "admin"},
+	{CmdPubSub, "pubsub"},
+	{CmdNoAuth, "no_auth"},
+	{CmdBlocking, "blocking"},
+	{CmdFast, "fast"},
+}
+
+// Has reports whether all of the given flags are set
+func (i CommandInfo) Has(flag CommandFlag) bool {
+	return i.Flags&flag == flag
+}
+
+// WithInfo attaches metadata to a command
+func WithInfo(info CommandInfo) CommandOption {
+	return func(e *commandEntry) {
+		e.info = info
+	}
+}
+
+// WithFlags sets the flags of a command
+func WithFlags(flags CommandFlag) CommandOption {
+	return func(e *commandEntry) {
+		e.info.Flags |= flags
+	}
+}
+
+// WithKeys declares where a command's keys are, see CommandInfo
+func WithKeys(first, last, step int) CommandOption {
+	return func(e *commandEntry) {
+		e.info.FirstKey, e.info.LastKey, e.info.KeyStep = first, last, step
+	}
+}
+
+// WithSummary sets the description of a command returned by COMMAND DOCS
+func WithSummary(summary string) CommandOption {
+	return func(e *commandEntry) {
+		e.info.Summary = summary
+	}
+}
+
+// WithCategories adds the command to ACL categories such as "string"
+func WithCategories(categories ...string) CommandOption {
+	return func(e *commandEntry) {
+		e.info.ACLCategories = append(e.info.ACLCategories, categories...)
+	}
+}
+
+// WithKeysFunc sets the function finding a command's keys, see CommandInfo.Keys
+func WithKeysFunc(keys func(cmd *Command) []string) CommandOption {
+	return func(e *commandEntry) {
+		e.info.Keys = keys
+	}
+}
+
+// NumKeysAt returns a key finder for commands that give their key count at
+// argument position pos, followed by that many keys, as EVAL script numkeys
+// key [key ...] does with NumKeysAt(2)
+func NumKeysAt(pos int) func(cmd *Command) []string {
+	return func(cmd *Command) []string {
+		if pos < 1 || pos > len(cmd.Args) {
+			return nil
+		}
+		n, err := strconv.Atoi(cmd.Args[pos-1])
+		if err != nil || n <= 0 || pos+n > len(cmd.Args) {
+			return nil
+		}
+		return cmd.Args[pos : pos+n]
+	}
+}
+
+// ExtractKeys returns the keys cmd operates on according to the metadata
+// its command was registered with. It returns nil for unknown commands and
+// commands without keys.
+func (s *Server) ExtractKeys(cmd *Command) []string {
+	info, ok := s.CommandInfo(cmd.Name)
+	if !ok {
+		return nil
+	}
+	return info.ExtractKeys(cmd)
+}
+
+// ExtractKeys returns the keys of cmd described by the info
+func (i CommandInfo) ExtractKeys(cmd *Command) []string {
+	if i.Keys != nil {
+		return i.Keys(cmd)
+	}
+	if i.FirstKey <= 0 || i.FirstKey > len(cmd.Args) {
+		return nil
+	}
+
+	last := i.LastKey
+	switch {
+	case last == 0:
+		last = i.FirstKey
+	case last < 0:
+		last = len(cmd.Args) + 1 + last
+	}
+	if last > len(cmd.Args) {
+		last = len(cmd.Args)
+	}
+	step := i.KeyStep
+	if step <= 0 {
+		step = 1
+	}
+
+	var keys []string
+	for pos := i.FirstKey; pos <= last; pos += step {
+		keys = append(keys, cmd.Args[pos-1])
+	}
+	return keys
+}
+
+// CommandInfo returns the metadata registered for the command name
+func (s *Server) CommandInfo(name string) (CommandInfo, bool) {
+	entry, ok := s.commandEntry(name)
+	if !ok {
+		return CommandInfo{}, false
+	}
+	return entry.info, true
+}
+
+// isWrite reports whether the command may modify data, from its registered
+// flags or, for commands registered without any, the standard command table
+func (e *commandEntry) isWrite(name string) bool {
+	if e.info.Flags != 0 {
+		return e.info.Has(CmdWrite)
+	}
+	return isWriteCommand(name)
+}
+
+// allowedWithoutAuth reports whether the command may run before AUTH
+func (e *commandEntry) allowedWithoutAuth(name string) bool {
+	if e.info.Flags != 0 {
+		return e.info.Has(CmdNoAuth)
+	}
+	_, ok := noAuthCommands[name]
+	return ok
+}
+
+// commandIsWrite looks the command up and reports whether it may modify data
+func (s *Server) commandIsWrite(name string) bool {
+	upper, entry, ok := s.handlerTable().lookup(name)
+	if !ok {
+		return isWriteCommand(name)
+	}
+	return entry.isWrite(upper)
+}
+
+// handleCommandCommand implements COMMAND [COUNT|LIST|INFO|DOCS|GETKEYS|HELP]
+func (s *Server) handleCommandCommand(conn *Connection, cmd *Command) RedisValue {
+	if len(cmd.Args) == 0 {
+		return s.commandInfoReply(nil)
+	}
+
+	switch strings.ToUpper(cmd.Args[0]) {
+	case "COUNT":
+		if len(cmd.Args) != 1 {
+			return WrongArity("command|count").Value()
+		}
+		return RedisValue{Type: Integer, Int: int64(len(s.handlerTable()))}
+	case "LIST":
+		if len(cmd.Args) != 1 {
+			return NewError(ErrPrefixGeneric, "syntax error").Value()
+		}
+		names := s.commandNames()
+		list := make([]RedisValue, len(names))
+		for i, name := range names {
+			list[i] = RedisValue{Type: BulkString, Bulk: []byte(strings.ToLower(name))}
+		}
+		return RedisValue{Type: Array, Array: list}
+	case "INFO":
+		return s.commandInfoReply(cmd.Args[1:])
+	case "DOCS":
+		return s.commandDocsReply(cmd.Args[1:])
+	case "GETKEYS":
+		if len(cmd.Args) < 2 {
+			return WrongArity("command|getkeys").Value()
+		}
+		target := &Command{Name: cmd.Args[1], Args: cmd.Args[2:]}
+		entry, ok := s.commandEntry(target.Name)
+		if !ok {
+			return NewError(ErrPrefixGeneric, "Invalid command specified").Value()
+		}
+		if entry.arity != nil && !entry.arity.Accepts(len(target.Args)) {
+			return NewError(ErrPrefixGeneric, "Invalid number of arguments specified for command").Value()
+		}
+		keys := entry.info.ExtractKeys(target)
+		if len(keys) == 0 {
+			return NewError(ErrPrefixGeneric, "The command has no key arguments").Value()
+		}
+		reply := make([]RedisValue, len(keys))
+		for i, key := range keys {
+			reply[i] = RedisValue{Type: BulkString, Bulk: []byte(key)}
+		}
+		return RedisValue{Type: Array, Array: reply}
+	case "HELP":
+		lines := []string{
+			"COMMAND <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"(no subcommand)",
+			"    Return details about all commands.",
+			"COUNT",
+			"    Return the total number of commands in this server.",
+			"LIST",
+			"    Return a list of all commands in this server.",
+			"INFO [<command-name> ...]",
+			"    Return details about multiple commands.",
+			"DOCS [<command-name> ...]",
+			"    Return documentation details about multiple commands.",
+			"GETKEYS <full-command>",
+			"    Return the keys from a full command.",
+		}
+		reply := make([]RedisValue, len(lines))
+		for i, line := range lines {
+			reply[i] = RedisValue{Type: SimpleString, Str: line}
+		}
+		return RedisValue{Type: Array, Array: reply}
+	default:
+		return UnknownSubcommand("COMMAND", cmd.Args[0]).Value()
+	}
+}
+
+// commandEntry looks up the registered command name, which may be a
+// subcommand in the container|subcommand form
+func (s *Server) commandEntry(name string) (*commandEntry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	container, sub, isSub := strings.Cut(strings.ToUpper(name), "|")
+	slot, ok := s.handlerTable()[container]
+	entry := slot.entry
+	if ok && isSub {
+		entry, ok = entry.subcommands[sub]
+	}
+	return entry, ok
+}
+
+// commandNames returns the registered command names in sorted order
+func (s *Server) commandNames() []string {
+	table := s.handlerTable()
+	names := make([]string, 0, len(table))
+	for name := range table {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// commandInfoReply describes the named commands, or all of them if names is
+// empty, in the format of COMMAND INFO
+func (s *Server) commandInfoReply(names []string) RedisValue {
+	if len(names) == 0 {
+		names = s.commandNames()
+	}
+	reply := make([]RedisValue, len(names))
+	for i, name := range names {
+		entry, ok := s.commandEntry(name)
+		if !ok {
+			reply[i] = RedisValue{Type: NullArray}
+			continue
+		}
+		reply[i] = s.describe(entry, strings.ToLower(name))
+	}
+	return RedisValue{Type: Array, Array: reply}
+}
+
+// describe formats the command as an element of the COMMAND reply
+func (s *Server) describe(e *commandEntry, name string) RedisValue {
+	var flags []RedisValue
+	for _, f := range commandFlagNames {
+		if e.info.Has(f.flag) || (f.flag == CmdWrite && e.info.Flags == 0 && isWriteCommand(name)) {
+			flags = append(flags, RedisValue{Type: SimpleString, Str: f.name})
+		}
+	}
+	if e.info.Keys != nil {
+		flags = append(flags, RedisValue{Type: SimpleString, Str: "movablekeys"})
+	}
+
+	// Redis counts both names in the arity of a subcommand
+	arity := e.redisArity()
+	if strings.Contains(name, "|") {
+		if arity > 0 {
+			arity++
+		} else {
+			arity--
+		}
+	}
+
+	var subcommands []RedisValue
+	if e.subcommands != nil {
+		for _, sub := range s.subcommandNames(e) {
+			s.mu.RLock()
+			subEntry := e.subcommands[sub]
+			s.mu.RUnlock()
+			subcommands = append(subcommands, s.describe(subEntry, name+"|"+strings.ToLower(sub)))
+		}
+	}
+
+	categories := make([]RedisValue, len(e.info.ACLCategories))
+	for i, category := range e.info.ACLCategories {
+		categories[i] = RedisValue{Type: SimpleString, Str: "@" + category}
+	}
+
+	return RedisValue{Type: Array, Array: []RedisValue{
+		{Type: BulkString, Bulk: []byte(name)},
+		{Type: Integer, Int: int64(arity)},
+		{Type: Array, Array: flags},
+		{Type: Integer, Int: int64(e.info.FirstKey)},
+		{Type: Integer, Int: int64(e.lastKey())},
+		{Type: Integer, Int: int64(e.keyStep())},
+		{Type: Array, Array: categories},
+		{Type: Array, Array: []RedisValue{}}, // tips
+		{Type: Array, Array: []RedisValue{}}, // key specs
+		{Type: Array, Array: subcommands},
+	}}
+}
+
+// redisArity returns the arity in Redis' convention: the argument count
+// including the command name, negated when it is a minimum
+func (e *commandEntry) redisArity() int {
+	if e.arity == nil {
+		return -1
+	}
+	if e.arity.Min == e.arity.Max {
+		return e.arity.Min + 1
+	}
+	return -(e.arity.Min + 1)
+}
+
+func (e *commandEntry) lastKey() int {
+	if e.info.FirstKey > 0 && e.info.LastKey == 0 {
+		return e.info.FirstKey
+	}
+	return e.info.LastKey
+}
+
+func (e *commandEntry) keyStep() int {
+	if e.info.FirstKey > 0 && e.info.KeyStep <= 0 {
+		return 1
+	}
+	return e.info.KeyStep
+}
+
+// commandDocsReply implements COMMAND DOCS, mapping each known command to its summary
+func (s *Server) commandDocsReply(names []string) RedisValue {
+	if len(names) == 0 {
+		names = s.commandNames()
+	}
+	var docs []MapEntry
+	for _, name := range names {
+		entry, ok := s.commandEntry(name)
+		if !ok {
+			continue
+		}
+		doc := []MapEntry{
+			{Key: RedisValue{Type: BulkString, Bulk: []byte("summary")}, Value: RedisValue{Type: BulkString, Bulk: []byte(entry.info.Summary)}},
+		}
+		if entry.info.Deprecated {
+			doc = append(doc, MapEntry{
+				Key:   RedisValue{Type: BulkString, Bulk: []byte("doc_flags")},
+				Value: RedisValue{Type: Set, Array: []RedisValue{{Type: SimpleString, Str: "deprecated"}}},
+			})
+			if entry.info.ReplacedBy != "" {
+				doc = append(doc, MapEntry{
+					Key:   RedisValue{Type: BulkString, Bulk: []byte("replaced_by")},
+					Value: RedisValue{Type: BulkString, Bulk: []byte(entry.info.ReplacedBy)},
+				})
+			}
+		}
+		docs = append(docs, MapEntry{
+			Key:   RedisValue{Type: BulkString, Bulk: []byte(strings.ToLower(name))},
+			Value: RedisValue{Type: Map, Map: doc},
+		})
+	}
+	return RedisValue{Type: Map, Map: docs}
+}
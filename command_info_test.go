@@ -0,0 +1,148 @@
+package redkit
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestCommandInfoRegistration(t *testing.T) {
+	server := NewServer(":0", WithLogger(NewDefaultLogger(nil, LogLevelOff)))
+	ok := func(conn *Connection, cmd *Command) RedisValue {
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	}
+	server.RegisterCommandFunc("mset", ok, VariadicArgs(2, 2), WithInfo(CommandInfo{
+		Flags:         CmdWrite,
+		FirstKey:      1,
+		LastKey:       -1,
+		KeyStep:       2,
+		ACLCategories: []string{"write", "string"},
+	}))
+
+	info, found := server.CommandInfo("MSET")
+	if !found {
+		t.Fatal("Expected MSET to be registered")
+	}
+	if !info.Has(CmdWrite) || info.Has(CmdReadOnly) || info.FirstKey != 1 || info.LastKey != -1 || info.KeyStep != 2 {
+		t.Errorf("Unexpected info: %+v", info)
+	}
+	if _, found := server.CommandInfo("NOPE"); found {
+		t.Error("Expected no info for an unknown command")
+	}
+
+	server.RegisterCommandFunc("GETRANGE", ok, WithFlags(CmdReadOnly), WithKeys(1, 1, 1))
+	if info, _ := server.CommandInfo("getrange"); !info.Has(CmdReadOnly) || info.FirstKey != 1 {
+		t.Errorf("Unexpected info: %+v", info)
+	}
+}
+
+func TestCommandFlagsDriveDispatch(t *testing.T) {
+	config := DefaultServerConfig()
+	config.RequireAuth = true
+	server, address := startTestServer(t, config)
+	ok := func(conn *Connection, cmd *Command) RedisValue {
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	}
+	server.RegisterCommandFunc("STORE", ok, WithFlags(CmdWrite|CmdNoAuth))
+	// Flags take precedence over the standard table, which lists SET as a write
+	server.RegisterCommandFunc("SET", ok, WithFlags(CmdReadOnly|CmdNoAuth))
+
+	client := dialRaw(t, address)
+	client.send(t, "STORE")
+	if line := client.readLine(t); line != "+OK" {
+		t.Fatalf("Expected CmdNoAuth to skip the auth check, got %q", line)
+	}
+
+	server.Connections()[0].SetFlag(FlagReadOnly)
+	client.send(t, "STORE")
+	if line := client.readLine(t); line != "-READONLY You can't write against a read only connection." {
+		t.Errorf("Expected READONLY error, got %q", line)
+	}
+	client.send(t, "SET", "k", "v")
+	if line := client.readLine(t); line != "+OK" {
+		t.Errorf("Expected SET registered as read-only to pass, got %q", line)
+	}
+}
+
+func TestExtractKeys(t *testing.T) {
+	server := NewServer(":0", WithLogger(NewDefaultLogger(nil, LogLevelOff)))
+	ok := func(conn *Connection, cmd *Command) RedisValue { return RedisValue{} }
+	server.RegisterCommandFunc("GET", ok, WithKeys(1, 0, 0))
+	server.RegisterCommandFunc("MSET", ok, WithKeys(1, -1, 2))
+	server.RegisterCommandFunc("BLPOP", ok, WithKeys(1, -2, 1))
+	server.RegisterCommandFunc("EVAL", ok, WithKeysFunc(NumKeysAt(2)))
+
+	tests := []struct {
+		cmd  *Command
+		want []string
+	}{
+		{&Command{Name: "get", Args: []string{"a"}}, []string{"a"}},
+		{&Command{Name: "MSET", Args: []string{"a", "1", "b", "2"}}, []string{"a", "b"}},
+		{&Command{Name: "BLPOP", Args: []string{"a", "b", "0"}}, []string{"a", "b"}},
+		{&Command{Name: "EVAL", Args: []string{"return 1", "2", "a", "b", "arg"}}, []string{"a", "b"}},
+		{&Command{Name: "EVAL", Args: []string{"return 1", "0"}}, nil},
+		{&Command{Name: "EVAL", Args: []string{"return 1", "5", "a"}}, nil},
+		{&Command{Name: "PING"}, nil},
+		{&Command{Name: "UNKNOWN", Args: []string{"a"}}, nil},
+	}
+	for _, tt := range tests {
+		got := server.ExtractKeys(tt.cmd)
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("ExtractKeys(%s %v) = %v, want %v", tt.cmd.Name, tt.cmd.Args, got, tt.want)
+		}
+	}
+}
+
+func TestCommandCommand(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	server.RegisterCommandFunc("MSET", func(conn *Connection, cmd *Command) RedisValue {
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	}, VariadicArgs(2, 2), WithInfo(CommandInfo{Flags: CmdWrite, FirstKey: 1, LastKey: -1, KeyStep: 2, ACLCategories: []string{"write", "string"}}))
+
+	rdb := redis.NewClient(&redis.Options{Addr: address, Protocol: 2})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	infos, err := rdb.Command(ctx).Result()
+	if err != nil {
+		t.Fatalf("COMMAND failed: %v", err)
+	}
+	mset := infos["mset"]
+	if mset == nil {
+		t.Fatalf("Expected mset in COMMAND reply, got %v", infos)
+	}
+	if mset.Arity != -3 || mset.FirstKeyPos != 1 || mset.LastKeyPos != -1 || mset.StepCount != 2 {
+		t.Errorf("Unexpected mset info: %+v", mset)
+	}
+	if fmt.Sprint(mset.Flags) != "[write]" || fmt.Sprint(mset.ACLFlags) != "[@write @string]" {
+		t.Errorf("Unexpected mset flags: %v %v", mset.Flags, mset.ACLFlags)
+	}
+	if echo := infos["echo"]; echo == nil || echo.Arity != 2 || fmt.Sprint(echo.Flags) != "[fast]" {
+		t.Errorf("Unexpected echo info: %+v", echo)
+	}
+
+	count, err := rdb.Do(ctx, "COMMAND", "COUNT").Int()
+	if err != nil || count != len(infos) {
+		t.Errorf("Expected COMMAND COUNT %d, got %d, %v", len(infos), count, err)
+	}
+
+	info, err := rdb.Do(ctx, "COMMAND", "INFO", "echo", "nope").Slice()
+	if err != nil || len(info) != 2 || info[1] != nil {
+		t.Errorf("Expected echo info and nil for an unknown command, got %v, %v", info, err)
+	}
+
+	keys, err := rdb.Do(ctx, "COMMAND", "GETKEYS", "MSET", "a", "1", "b", "2").StringSlice()
+	if err != nil || fmt.Sprint(keys) != "[a b]" {
+		t.Errorf("Expected keys [a b], got %v, %v", keys, err)
+	}
+	if err := rdb.Do(ctx, "COMMAND", "GETKEYS", "PING").Err(); err == nil || err.Error() != "ERR The command has no key arguments" {
+		t.Errorf("Expected no key arguments error, got %v", err)
+	}
+
+	docs, err := rdb.Do(ctx, "COMMAND", "DOCS", "echo").Slice()
+	if err != nil || fmt.Sprint(docs) != "[echo [summary Returns the given string.]]" {
+		t.Errorf("Unexpected COMMAND DOCS reply: %v, %v", docs, err)
+	}
+}
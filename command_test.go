@@ -0,0 +1,170 @@
+package redkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestArgBytes tests binary-safe argument access
+func TestArgBytes(t *testing.T) {
+	payload := []byte{0x00, 0xff, '\r', '\n', 0x7f}
+	input := "*3\r\n$3\r\nSET\r\n$3\r\nbin\r\n$5\r\n" + string(payload) + "\r\n"
+	conn, _ := newTestConnection(input)
+
+	cmd, err := conn.readCommand()
+	if err != nil {
+		t.Fatalf("readCommand failed: %v", err)
+	}
+
+	if !bytes.Equal(cmd.ArgBytes(1), payload) {
+		t.Errorf("Expected %v, got %v", payload, cmd.ArgBytes(1))
+	}
+	if &cmd.ArgBytes(1)[0] != &cmd.Raw[2].Bulk[0] {
+		t.Error("Expected ArgBytes to reference the parsed bulk data")
+	}
+	if cmd.ArgBytes(2) != nil || cmd.ArgBytes(-1) != nil {
+		t.Error("Expected nil for out of range arguments")
+	}
+	if len(cmd.ArgsBytes()) != 2 {
+		t.Errorf("Expected 2 arguments, got %d", len(cmd.ArgsBytes()))
+	}
+}
+
+// TestArgBytesRewrittenArgs tests that Args rewritten by middleware take precedence over Raw
+func TestArgBytesRewrittenArgs(t *testing.T) {
+	cmd := &Command{
+		Name: "GET",
+		Args: []string{"modified-key"},
+		Raw:  []RedisValue{{Type: BulkString, Bulk: []byte("GET")}, {Type: BulkString, Bulk: []byte("key")}},
+	}
+	if string(cmd.ArgBytes(0)) != "modified-key" {
+		t.Errorf("Expected 'modified-key', got '%s'", cmd.ArgBytes(0))
+	}
+}
+
+func TestCommandContextCancelledOnDisconnect(t *testing.T) {
+	config := DefaultServerConfig()
+	config.CancelOnDisconnect = true
+	server, address := startTestServer(t, config)
+
+	started := make(chan struct{})
+	cause := make(chan error, 1)
+	server.RegisterCommandFunc("WAITFOREVER", func(conn *Connection, cmd *Command) RedisValue {
+		close(started)
+		<-cmd.Context().Done()
+		cause <- context.Cause(cmd.Context())
+		return RedisValue{Type: Null}
+	})
+
+	client := dialRaw(t, address)
+	client.send(t, "WAITFOREVER")
+	<-started
+	client.conn.Close()
+
+	select {
+	case err := <-cause:
+		if !errors.Is(err, ErrClientDisconnected) {
+			t.Errorf("Expected ErrClientDisconnected, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Command context was not cancelled")
+	}
+}
+
+func TestCommandContextTimeoutKeepsPipeline(t *testing.T) {
+	config := DefaultServerConfig()
+	config.CommandTimeout = 20 * time.Millisecond
+	config.CancelOnDisconnect = true
+	server, address := startTestServer(t, config)
+
+	server.RegisterCommandFunc("SLOWOP", func(conn *Connection, cmd *Command) RedisValue {
+		<-cmd.Context().Done()
+		return RedisValue{Type: ErrorReply, Str: "ERR " + cmd.Context().Err().Error()}
+	})
+
+	client := dialRaw(t, address)
+	client.send(t, "SLOWOP")
+	time.Sleep(5 * time.Millisecond)
+	// Sent while SLOWOP runs, so the disconnect watcher reads it ahead
+	client.send(t, "PING")
+
+	if line := client.readLine(t); line != "-ERR context deadline exceeded" {
+		t.Errorf("Expected deadline error, got %q", line)
+	}
+	if line := client.readLine(t); line != "+PONG" {
+		t.Errorf("Expected the pipelined PING to survive, got %q", line)
+	}
+}
+
+func TestCommandWithContext(t *testing.T) {
+	cmd := &Command{Name: "GET", Args: []string{"k"}}
+	if cmd.Context() != context.Background() {
+		t.Error("Expected a background context for hand-built commands")
+	}
+
+	type key struct{}
+	derived := cmd.WithContext(context.WithValue(context.Background(), key{}, "v"))
+	if derived.Context().Value(key{}) != "v" || derived.Name != "GET" {
+		t.Error("Expected WithContext to keep the command and replace the context")
+	}
+	if cmd.Context().Value(key{}) != nil {
+		t.Error("WithContext must not modify the original command")
+	}
+}
+
+func TestRegisterCommandE(t *testing.T) {
+	config := DefaultServerConfig()
+	config.CommandTimeout = time.Minute
+	server, address := startTestServer(t, config)
+	reported := make(chan error, 2)
+	server.OnError(func(conn *Connection, phase ErrorPhase, err error) {
+		if phase == ErrorPhaseHandler {
+			reported <- err
+		}
+	})
+	server.RegisterCommandE("FETCH", func(ctx context.Context, conn *Connection, cmd *Command) (RedisValue, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			return RedisValue{}, errors.New("missing deadline")
+		}
+		switch cmd.Args[0] {
+		case "wrongtype":
+			return RedisValue{}, WrongType()
+		case "fail":
+			return RedisValue{}, fmt.Errorf("backend: %w", errors.New("disk full"))
+		}
+		return RedisValue{Type: BulkString, Bulk: []byte(cmd.Args[0])}, nil
+	}, ExactArgs(1))
+
+	client := dialRaw(t, address)
+	client.send(t, "FETCH", "value")
+	client.readLine(t)
+	if line := client.readLine(t); line != "value" {
+		t.Errorf("Expected value, got %q", line)
+	}
+	client.send(t, "FETCH", "wrongtype")
+	if line := client.readLine(t); line != "-WRONGTYPE Operation against a key holding the wrong kind of value" {
+		t.Errorf("Expected WRONGTYPE, got %q", line)
+	}
+	client.send(t, "FETCH", "fail")
+	if line := client.readLine(t); line != "-ERR backend: disk full" {
+		t.Errorf("Expected ERR backend: disk full, got %q", line)
+	}
+
+	select {
+	case err := <-reported:
+		if err.Error() != "backend: disk full" {
+			t.Errorf("Expected the backend error to be reported, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the error to reach OnError")
+	}
+	select {
+	case err := <-reported:
+		t.Errorf("Expected only one reported error, also got %v", err)
+	default:
+	}
+}
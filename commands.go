@@ -10,6 +10,8 @@ const (
 	QUIT CommandType = "QUIT" // Close the connection
 	HELP CommandType = "HELP" // Show help information
 
+	HEALTHCHECK CommandType = "HEALTHCHECK" // Run the server's health checks
+
 	// String Commands
 	APPEND      CommandType = "APPEND"
 	DECR        CommandType = "DECR"
@@ -312,6 +314,7 @@ const (
 	CLIENT CommandType = "CLIENT"
 	HELLO  CommandType = "HELLO"
 	RESET  CommandType = "RESET"
+	SELECT CommandType = "SELECT"
 
 	//Server Commands
 	ACL            CommandType = "ACL"
@@ -320,6 +323,7 @@ const (
 	COMMAND        CommandType = "COMMAND"
 	CONFIG         CommandType = "CONFIG"
 	DBSIZE         CommandType = "DBSIZE"
+	DEBUG          CommandType = "DEBUG"
 	FAILOVER       CommandType = "FAILOVER"
 	FLUSHALL       CommandType = "FLUSHALL"
 	FLUSHDB        CommandType = "FLUSHDB"
@@ -385,37 +389,101 @@ const (
 func (s *Server) registerDefaultHandlers() {
 	// PING command
 	s.RegisterCommandFunc(string(PING), func(conn *Connection, cmd *Command) RedisValue {
+		// Subscribed RESP2 clients can't tell a reply from a message
+		// unless it is shaped like one
+		if conn != nil && conn.IsSubscribed() && conn.Protocol() < RESP3 {
+			message := ""
+			if len(cmd.Args) > 0 {
+				message = cmd.Args[0]
+			}
+			return RedisValue{Type: Array, Array: []RedisValue{
+				{Type: BulkString, Bulk: []byte("pong")},
+				{Type: BulkString, Bulk: []byte(message)},
+			}}
+		}
 		if len(cmd.Args) == 0 {
 			return RedisValue{Type: SimpleString, Str: "PONG"}
 		}
 		return RedisValue{Type: BulkString, Bulk: []byte(cmd.Args[0])}
-	})
+	}, RangeArgs(0, 1), WithFlags(CmdFast), WithSummary("Returns the server's liveliness response."))
 
 	// ECHO command
 	s.RegisterCommandFunc(string(ECHO), func(conn *Connection, cmd *Command) RedisValue {
-		if len(cmd.Args) != 1 {
-			return RedisValue{Type: ErrorReply, Str: "ERR wrong number of arguments for 'echo' command"}
-		}
 		return RedisValue{Type: BulkString, Bulk: []byte(cmd.Args[0])}
-	})
+	}, ExactArgs(1), WithFlags(CmdFast), WithSummary("Returns the given string."))
 
 	s.RegisterCommandFunc(string(HELP), func(conn *Connection, cmd *Command) RedisValue {
 		helpText := "RedKit Redis Server - Supported commands:\n" +
 			"PING [message] - Returns PONG or the provided message\n" +
 			"ECHO message - Echoes the provided message\n" +
 			"QUIT - Closes the connection\n" +
+			"RESET - Resets the connection to its initial state\n" +
+			"SELECT index - Switches the connection to another logical database\n" +
+			"MULTI / EXEC / DISCARD - Queues commands and runs them as a transaction\n" +
+			"EVAL script numkeys [key ...] [arg ...] - Runs a Lua script atomically\n" +
+			"COMMAND [INFO|COUNT|LIST|DOCS|GETKEYS] - Describes the registered commands\n" +
+			"HEALTHCHECK - Runs the server health checks\n" +
+			"INFO [section ...] - Reports information and statistics about the server\n" +
 			"(Other commands may be supported depending on the server configuration)"
-		return RedisValue{Type: BulkString, Bulk: []byte(helpText)}
-	})
+		return RedisValue{Type: Verbatim, Str: helpText, Format: VerbatimText}
+	}, WithSummary("Lists the supported commands."))
+
+	// CLIENT command
+	s.RegisterCommandFunc(string(CLIENT), s.handleClient, MinArgs(1), WithSummary("A container for client connection commands."))
+
+	// COMMAND command
+	s.RegisterCommandFunc(string(COMMAND), s.handleCommandCommand, WithSummary("Returns detailed information about all commands."))
+
+	// READONLY and READWRITE commands
+	s.RegisterCommandFunc(string(READONLY), func(conn *Connection, cmd *Command) RedisValue {
+		conn.SetFlag(FlagReadOnly)
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	}, ExactArgs(0), WithFlags(CmdFast), WithSummary("Rejects write commands on the connection."))
+	s.RegisterCommandFunc(string(READWRITE), func(conn *Connection, cmd *Command) RedisValue {
+		conn.ClearFlag(FlagReadOnly)
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	}, ExactArgs(0), WithFlags(CmdFast), WithSummary("Allows write commands on the connection again."))
+
+	// AUTH command
+	s.RegisterCommandFunc(string(AUTH), s.handleAuth, RangeArgs(1, 2), WithFlags(CmdNoAuth|CmdFast), WithSummary("Authenticates the connection."))
+
+	// SELECT and SWAPDB commands
+	s.RegisterCommandFunc(string(SELECT), s.handleSelect, ExactArgs(1), WithFlags(CmdFast), WithSummary("Changes the selected database."))
+	s.RegisterCommandFunc(string(SWAPDB), s.handleSwapDB, ExactArgs(2), WithFlags(CmdWrite|CmdFast), WithSummary("Swaps two databases."))
+
+	// MULTI, EXEC, DISCARD, WATCH and UNWATCH commands
+	s.RegisterCommandFunc(string(MULTI), s.handleMulti, ExactArgs(0), WithFlags(CmdFast), WithSummary("Starts a transaction."))
+	s.RegisterCommandFunc(string(EXEC), s.handleExec, ExactArgs(0), exclusive(), WithSummary("Executes all commands in a transaction."))
+	s.RegisterCommandFunc(string(DISCARD), s.handleDiscard, ExactArgs(0), WithFlags(CmdFast), WithSummary("Discards a transaction."))
+	s.RegisterCommandFunc(string(WATCH), s.handleWatch, MinArgs(1), WithKeys(1, -1, 1), WithFlags(CmdFast), WithSummary("Monitors changes to keys to determine the execution of a transaction."))
+	s.RegisterCommandFunc(string(UNWATCH), s.handleUnwatch, ExactArgs(0), WithFlags(CmdFast), WithSummary("Forgets about watched keys of a transaction."))
+
+	// RESET command
+	s.registerReset()
+
+	// SUBSCRIBE, PUBLISH and the other Pub/Sub commands
+	s.registerPubSub()
+
+	// EVAL, EVALSHA and SCRIPT commands
+	s.registerScripting()
+
+	// FCALL and FUNCTION commands
+	s.registerFunctions()
+
+	// HEALTHCHECK command
+	s.RegisterCommandFunc(string(HEALTHCHECK), s.handleHealthCheck, ExactArgs(0), WithSummary("Runs the server health checks."))
+
+	// INFO command
+	s.RegisterCommandFunc(string(INFO), s.handleInfo, WithSummary("Returns information and statistics about the server."))
 
 	// QUIT command
 	s.RegisterCommandFunc(string(QUIT), func(conn *Connection, cmd *Command) RedisValue {
-		err := conn.Close()
+		err := conn.closeWithReason(ErrClientQuit)
 		if err != nil {
 			return RedisValue{}
 		}
 		return RedisValue{Type: SimpleString, Str: "OK"}
-	})
+	}, WithFlags(CmdNoAuth|CmdFast), WithSummary("Closes the connection."))
 }
 
 // registerPingHandler registers a custom handler for the PING command
@@ -0,0 +1,127 @@
+package redkit
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// CommandSet bundles related commands and the middleware that applies to them,
+// such as a "strings" or "hashes" package, so they can be built and tested on
+// their own and mounted onto a Server with Mount
+type CommandSet struct {
+	name        string
+	commands    []setCommand
+	middlewares []Middleware
+}
+
+// setCommand is a command or subcommand waiting in a CommandSet to be mounted
+type setCommand struct {
+	container string // set for subcommands
+	name      string
+	handler   CommandHandler
+	opts      []CommandOption
+}
+
+// NewCommandSet creates an empty command set. The name is only used for logging.
+func NewCommandSet(name string) *CommandSet {
+	return &CommandSet{name: name}
+}
+
+// Name returns the name of the set
+func (cs *CommandSet) Name() string {
+	return cs.name
+}
+
+// Register adds a command to the set, with the same options as Server.RegisterCommand
+func (cs *CommandSet) Register(name string, handler CommandHandler, opts ...CommandOption) error {
+	if name == "" || handler == nil {
+		return fmt.Errorf("empty command name")
+	}
+	cs.commands = append(cs.commands, setCommand{name: name, handler: handler, opts: opts})
+	return nil
+}
+
+// RegisterFunc adds a function as a command handler to the set
+func (cs *CommandSet) RegisterFunc(name string, handler func(*Connection, *Command) RedisValue, opts ...CommandOption) error {
+	if handler == nil {
+		return fmt.Errorf("empty command name")
+	}
+	return cs.Register(name, CommandHandlerFunc(handler), opts...)
+}
+
+// RegisterSubcommand adds a subcommand to the set, see Server.RegisterSubcommand
+func (cs *CommandSet) RegisterSubcommand(container, name string, handler CommandHandler, opts ...CommandOption) error {
+	if container == "" || name == "" || handler == nil {
+		return fmt.Errorf("empty command name")
+	}
+	cs.commands = append(cs.commands, setCommand{container: container, name: name, handler: handler, opts: opts})
+	return nil
+}
+
+// RegisterSubcommandFunc adds a function as a subcommand handler to the set
+func (cs *CommandSet) RegisterSubcommandFunc(container, name string, handler func(*Connection, *Command) RedisValue, opts ...CommandOption) error {
+	if handler == nil {
+		return fmt.Errorf("empty command name")
+	}
+	return cs.RegisterSubcommand(container, name, CommandHandlerFunc(handler), opts...)
+}
+
+// Use adds a middleware that runs for the set's commands only, after the
+// server's global and scoped middleware
+func (cs *CommandSet) Use(middleware Middleware) {
+	cs.middlewares = append(cs.middlewares, middleware)
+}
+
+// UseFunc adds a middleware function to the set, see Use
+func (cs *CommandSet) UseFunc(fn func(*Connection, *Command, CommandHandler) RedisValue) {
+	cs.Use(MiddlewareFunc(fn))
+}
+
+// Commands returns the upper-case names of the set's commands, with
+// subcommands as "CONTAINER|NAME", in registration order
+func (cs *CommandSet) Commands() []string {
+	names := make([]string, len(cs.commands))
+	for i, c := range cs.commands {
+		names[i] = strings.ToUpper(c.name)
+		if c.container != "" {
+			names[i] = strings.ToUpper(c.container) + "|" + names[i]
+		}
+	}
+	return names
+}
+
+// Mount registers the commands of each set on the server. Like RegisterCommand,
+// a command replaces any command of the same name registered before it. The
+// set's middleware is captured when it is mounted, so a set can be mounted
+// onto several servers and changes made to it afterwards don't apply.
+//
+// A command that can't be registered doesn't stop the others being mounted;
+// Mount returns the errors of all of them, joined.
+func (s *Server) Mount(sets ...*CommandSet) error {
+	var errs []error
+	for _, cs := range sets {
+		var chain *MiddlewareChain
+		if len(cs.middlewares) > 0 {
+			chain = &MiddlewareChain{middlewares: append([]Middleware(nil), cs.middlewares...)}
+		}
+		for _, c := range cs.commands {
+			handler := c.handler
+			if chain != nil {
+				handler = chain.Handler(handler)
+			}
+			var err error
+			if c.container != "" {
+				err = s.RegisterSubcommand(c.container, c.name, handler, c.opts...)
+			} else {
+				err = s.RegisterCommand(c.name, handler, c.opts...)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("command set %s: %w", cs.name, err))
+			}
+		}
+		s.logAttrs(LogLevelDebug, "Mounted command set", slog.String("set", cs.name), slog.Int("commands", len(cs.commands)))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,74 @@
+package redkit
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestMountCommandSet(t *testing.T) {
+	strs := NewCommandSet("strings")
+	var calls []string
+	strs.UseFunc(func(conn *Connection, cmd *Command, next CommandHandler) RedisValue {
+		calls = append(calls, cmd.Name)
+		return next.Handle(conn, cmd)
+	})
+	strs.RegisterFunc("set", func(conn *Connection, cmd *Command) RedisValue {
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	}, ExactArgs(2), WithFlags(CmdWrite))
+	strs.RegisterSubcommandFunc("object", "encoding", func(conn *Connection, cmd *Command) RedisValue {
+		return RedisValue{Type: BulkString, Bulk: []byte("raw")}
+	}, ExactArgs(1))
+	if err := strs.RegisterFunc("", nil); err == nil {
+		t.Error("Expected an error for an empty command")
+	}
+
+	if names := fmt.Sprint(strs.Commands()); names != "[SET OBJECT|ENCODING]" {
+		t.Errorf("Unexpected commands %s", names)
+	}
+
+	server := NewServer(":0")
+	if err := server.Mount(strs); err != nil {
+		t.Fatalf("Mount failed: %v", err)
+	}
+
+	if result := server.handleCommand(nil, &Command{Name: "SET", Args: []string{"k", "v"}}); result.Str != "OK" {
+		t.Errorf("Expected OK, got %+v", result)
+	}
+	if result := server.handleCommand(nil, &Command{Name: "SET", Args: []string{"k"}}); result.Type != ErrorReply {
+		t.Errorf("Expected the arity error, got %+v", result)
+	}
+	if result := server.handleCommand(nil, &Command{Name: "OBJECT", Args: []string{"ENCODING", "k"}}); string(result.Bulk) != "raw" {
+		t.Errorf("Expected raw, got %+v", result)
+	}
+	server.handleCommand(nil, &Command{Name: "PING"})
+	if info, ok := server.CommandInfo("SET"); !ok || !info.Has(CmdWrite) {
+		t.Error("Expected the options of SET to apply")
+	}
+
+	// The set's middleware only sees its own commands
+	if fmt.Sprint(calls) != "[SET OBJECT|ENCODING]" {
+		t.Errorf("Unexpected middleware calls %v", calls)
+	}
+}
+
+func TestMountCommandSetErrors(t *testing.T) {
+	broken := NewCommandSet("broken")
+	broken.RegisterFunc("ok", func(conn *Connection, cmd *Command) RedisValue {
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	})
+	// Commands the server refuses, which the set doesn't check
+	broken.commands = append(broken.commands, setCommand{name: "", handler: broken.commands[0].handler}, setCommand{container: "x", handler: broken.commands[0].handler})
+
+	server := NewServer(":0")
+	err := server.Mount(broken)
+	if err == nil || !strings.Contains(err.Error(), "command set broken: empty command name") {
+		t.Errorf("Expected the errors of the refused commands, got %v", err)
+	}
+	if n := len(strings.Split(err.Error(), "\n")); n != 2 {
+		t.Errorf("Expected 2 errors, got %d: %v", n, err)
+	}
+	if result := server.handleCommand(nil, &Command{Name: "OK"}); result.Str != "OK" {
+		t.Errorf("Expected the other commands to be mounted, got %+v", result)
+	}
+}
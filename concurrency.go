@@ -0,0 +1,58 @@
+package redkit
+
+import "strings"
+
+// concurrencyLimit caps how many calls of a command run at the same time
+type concurrencyLimit struct {
+	slots chan struct{}
+	queue bool // wait for a free slot instead of failing
+}
+
+// MaxConcurrent limits the command to n calls running at the same time, to
+// protect a shared backend its handler calls into. Calls over the limit fail
+// right away with a BUSY error.
+func MaxConcurrent(n int) CommandOption {
+	return withConcurrencyLimit(n, false)
+}
+
+// MaxConcurrentQueued limits the command to n calls running at the same time
+// like MaxConcurrent, but calls over the limit wait for a running one to
+// finish. A call gives up with an error when its context is done, e.g. after
+// CommandTimeout.
+func MaxConcurrentQueued(n int) CommandOption {
+	return withConcurrencyLimit(n, true)
+}
+
+func withConcurrencyLimit(n int, queue bool) CommandOption {
+	return func(e *commandEntry) {
+		if n <= 0 {
+			e.limit = nil
+			return
+		}
+		e.limit = &concurrencyLimit{slots: make(chan struct{}, n), queue: queue}
+	}
+}
+
+// acquire takes a slot for cmd, which must be given back with release
+func (l *concurrencyLimit) acquire(cmd *Command) *RedisError {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+	if !l.queue {
+		return NewError(ErrPrefixBusy, "too many concurrent '%s' commands, try again later", strings.ToLower(cmd.Name))
+	}
+
+	ctx := cmd.Context()
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return NewError(ErrPrefixGeneric, "'%s' command gave up waiting to run: %v", strings.ToLower(cmd.Name), ctx.Err())
+	}
+}
+
+func (l *concurrencyLimit) release() {
+	<-l.slots
+}
@@ -0,0 +1,75 @@
+package redkit
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaxConcurrent(t *testing.T) {
+	server := NewServer(":0")
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	server.RegisterCommandFunc("BGSAVE", func(conn *Connection, cmd *Command) RedisValue {
+		started <- struct{}{}
+		<-unblock
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	}, MaxConcurrent(1))
+
+	done := make(chan RedisValue)
+	go func() { done <- server.handleCommand(nil, &Command{Name: "BGSAVE"}) }()
+	<-started
+
+	result := server.handleCommand(nil, &Command{Name: "BGSAVE"})
+	if result.Type != ErrorReply || !strings.HasPrefix(result.Str, "BUSY ") {
+		t.Errorf("Expected a BUSY error, got %+v", result)
+	}
+	close(unblock)
+	if result := <-done; result.Str != "OK" {
+		t.Errorf("Expected OK, got %+v", result)
+	}
+
+	// The slot is free again
+	go func() { <-started }()
+	if result := server.handleCommand(nil, &Command{Name: "BGSAVE"}); result.Str != "OK" {
+		t.Errorf("Expected OK after the first call finished, got %+v", result)
+	}
+}
+
+func TestMaxConcurrentQueued(t *testing.T) {
+	server := NewServer(":0")
+	started := make(chan struct{}, 2)
+	unblock := make(chan struct{})
+	server.RegisterCommandFunc("EVAL", func(conn *Connection, cmd *Command) RedisValue {
+		started <- struct{}{}
+		<-unblock
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	}, MaxConcurrentQueued(1))
+
+	first := make(chan RedisValue)
+	go func() { first <- server.handleCommand(nil, &Command{Name: "EVAL"}) }()
+	<-started
+
+	// A queued call gives up when its context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	result := server.handleCommand(nil, (&Command{Name: "EVAL"}).WithContext(ctx))
+	if result.Type != ErrorReply || !strings.Contains(result.Str, "gave up waiting") {
+		t.Errorf("Expected a timeout error, got %+v", result)
+	}
+
+	second := make(chan RedisValue)
+	go func() { second <- server.handleCommand(nil, &Command{Name: "EVAL"}) }()
+	select {
+	case <-started:
+		t.Fatal("Expected the second call to wait for the first")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(unblock)
+	for _, ch := range []chan RedisValue{first, second} {
+		if result := <-ch; result.Str != "OK" {
+			t.Errorf("Expected OK, got %+v", result)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package redkit
 import (
 	"bufio"
 	"context"
+	"errors"
+	"fmt"
 	"net"
 	"sync"
 	"sync/atomic"
@@ -11,26 +13,112 @@ import (
 
 // Connection represents a client connection to the Redis server
 type Connection struct {
-	conn      net.Conn
-	reader    *bufio.Reader
-	writer    *bufio.Writer
-	server    *Server
-	state     atomic.Int32
-	closeOnce sync.Once
-	ctx       context.Context
-	cancel    context.CancelFunc
-	mu        sync.RWMutex
-	lastUsed  time.Time
-}
-
-// setState updates the connection state
+	id          uint64
+	conn        net.Conn
+	reader      *bufio.Reader
+	writer      *bufio.Writer
+	server      *Server
+	state       atomic.Int32
+	stateMu     sync.Mutex // orders state changes with their ConnStateHook calls
+	stateSet    bool       // setState was called at least once
+	subscribed  atomic.Bool
+	protocol    atomic.Int32
+	closeOnce   sync.Once
+	ctx         context.Context
+	cancel      context.CancelFunc
+	mu          sync.RWMutex
+	lastUsed    time.Time
+	created     time.Time
+	commands    atomic.Uint64 // commands executed on this connection
+	reason      error         // why the connection was closed, set once
+	meta        map[string]any
+	name        string // set by CLIENT SETNAME
+	libName     string // set by CLIENT SETINFO LIB-NAME
+	libVersion  string // set by CLIENT SETINFO LIB-VER
+	lastCommand string // lower-case name of the last command, for CLIENT INFO
+	running     string // name of the command running, inside EXEC or a script too
+
+	flags           atomic.Uint32
+	db              atomic.Int32 // selected with SELECT
+	authenticated   atomic.Bool
+	user            string      // set by SetAuthenticated
+	closeAfterReply atomic.Bool // close once the current command's reply is written
+	tlsIdentity     string
+	numBuf          [24]byte   // scratch space for formatting reply headers
+	writeMu         sync.Mutex // serializes replies with pushes sent from other goroutines
+	streamed        bool       // the current command's reply was written through an ArrayWriter
+	arrayWriter     *ArrayWriter
+
+	tx         *transaction // set between MULTI and EXEC or DISCARD
+	inExec     bool         // EXEC or a script is running commands while holding execMu
+	execLocked bool         // the running command holds execMu for reading
+
+	warned map[string]struct{} // deprecated commands the connection was told about
+}
+
+// setState moves the connection to state and reports the transition to the
+// ConnStateHook. Setting the current state again is a no-op, and a closed
+// connection stays closed, so the hook sees each transition exactly once and
+// StateClosed last.
 func (c *Connection) setState(state ConnState) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+
+	current := ConnState(c.state.Load())
+	if current == StateClosed || (c.stateSet && current == state) {
+		return
+	}
 	c.state.Store(int32(state))
+	c.stateSet = true
 	if c.server.ConnStateHook != nil {
 		c.server.ConnStateHook(c.conn, state)
 	}
 }
 
+// restingState is the state of a connection between commands
+func (c *Connection) restingState() ConnState {
+	if c.subscribed.Load() {
+		return StateSubscribed
+	}
+	return StateActive
+}
+
+// SetSubscribed marks whether the connection is in Pub/Sub push mode. A
+// subscribed connection rests in StateSubscribed instead of StateActive
+// between commands and is not closed by the idle timeout.
+func (c *Connection) SetSubscribed(subscribed bool) {
+	c.subscribed.Store(subscribed)
+	if state := c.GetState(); state == StateActive || state == StateSubscribed {
+		c.setState(c.restingState())
+	}
+}
+
+// IsSubscribed reports whether the connection is in Pub/Sub push mode
+func (c *Connection) IsSubscribed() bool {
+	return c.subscribed.Load()
+}
+
+// closeWithReason records why the connection is being closed and closes it.
+// Only the first recorded reason is kept.
+func (c *Connection) closeWithReason(reason error) error {
+	c.setCloseReason(reason)
+	return c.Close()
+}
+
+func (c *Connection) setCloseReason(reason error) {
+	c.mu.Lock()
+	if c.reason == nil {
+		c.reason = reason
+	}
+	c.mu.Unlock()
+}
+
+func (c *Connection) closeReason() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.reason
+}
+
 // Close closes the connection
 func (c *Connection) Close() error {
 	var err error
@@ -42,6 +130,158 @@ func (c *Connection) Close() error {
 	return err
 }
 
+// Name returns the name the client set with CLIENT SETNAME, or an empty string
+func (c *Connection) Name() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.name
+}
+
+// SetName names the connection, as CLIENT SETNAME does. An empty name clears it.
+func (c *Connection) SetName(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.name = name
+}
+
+// ConnFlag is a per-connection option set through CLIENT subcommands
+type ConnFlag uint32
+
+const (
+	// FlagNoEvict exempts the connection from client eviction (CLIENT NO-EVICT)
+	FlagNoEvict ConnFlag = 1 << iota
+	// FlagNoTouch asks that the connection's commands leave key access times
+	// alone, so they don't affect LRU/LFU eviction or OBJECT IDLETIME (CLIENT NO-TOUCH)
+	FlagNoTouch
+	// FlagReplyOff suppresses every reply (CLIENT REPLY OFF)
+	FlagReplyOff
+	// FlagReplySkip suppresses the reply to the next command (CLIENT REPLY SKIP)
+	FlagReplySkip
+	// FlagReadOnly rejects write commands with a READONLY error (READONLY)
+	FlagReadOnly
+
+	// flagReplySkipNext marks the CLIENT REPLY SKIP command itself; it turns
+	// into FlagReplySkip once that command's reply is dropped
+	flagReplySkipNext
+)
+
+// String formats the flags as CLIENT LIST does: r for READONLY, e for
+// NO-EVICT, T for NO-TOUCH, or N when none is set
+func (f ConnFlag) String() string {
+	var b []byte
+	if f&FlagReadOnly != 0 {
+		b = append(b, 'r')
+	}
+	if f&FlagNoEvict != 0 {
+		b = append(b, 'e')
+	}
+	if f&FlagNoTouch != 0 {
+		b = append(b, 'T')
+	}
+	if len(b) == 0 {
+		return "N"
+	}
+	return string(b)
+}
+
+// Flags returns the flags currently set on the connection
+func (c *Connection) Flags() ConnFlag {
+	return ConnFlag(c.flags.Load()) &^ flagReplySkipNext
+}
+
+// HasFlag reports whether all of the given flags are set
+func (c *Connection) HasFlag(flag ConnFlag) bool {
+	return ConnFlag(c.flags.Load())&flag == flag
+}
+
+// SetFlag sets the given flags
+func (c *Connection) SetFlag(flag ConnFlag) {
+	c.flags.Or(uint32(flag))
+}
+
+// ClearFlag clears the given flags
+func (c *Connection) ClearFlag(flag ConnFlag) {
+	c.flags.And(^uint32(flag))
+}
+
+// suppressReply reports whether the reply to the command just handled must
+// be dropped because of CLIENT REPLY OFF or SKIP, consuming a pending skip
+func (c *Connection) suppressReply() bool {
+	for {
+		flags := ConnFlag(c.flags.Load())
+		if flags&FlagReplyOff != 0 {
+			return true
+		}
+		next := flags
+		switch {
+		case flags&FlagReplySkip != 0:
+			next &^= FlagReplySkip
+		case flags&flagReplySkipNext != 0:
+			next = next&^flagReplySkipNext | FlagReplySkip
+		default:
+			return false
+		}
+		if c.flags.CompareAndSwap(uint32(flags), uint32(next)) {
+			return true
+		}
+	}
+}
+
+// watchDisconnect reads ahead from the client while a command runs and calls
+// cancel if the connection turns out to be closed. Data that arrives, such as
+// the next command, stays buffered for the read loop. The returned function
+// stops watching and must be called before the connection is read again.
+func (c *Connection) watchDisconnect(cancel context.CancelCauseFunc) func() {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := c.reader.Peek(1); err != nil {
+			var netErr net.Error
+			if !errors.As(err, &netErr) || !netErr.Timeout() {
+				cancel(ErrClientDisconnected)
+			}
+		}
+	}()
+
+	return func() {
+		c.conn.SetReadDeadline(time.Now())
+		<-done
+		c.conn.SetReadDeadline(time.Time{})
+	}
+}
+
+// Set stores a value on the connection under key, so middleware and handlers
+// can keep per-connection state such as an auth identity or rate-limit bucket.
+// The value lives until the connection closes or Delete is called.
+func (c *Connection) Set(key string, value any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.meta == nil {
+		c.meta = make(map[string]any)
+	}
+	c.meta[key] = value
+}
+
+// Get returns the value stored under key and whether it was present
+func (c *Connection) Get(key string) (any, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	value, ok := c.meta[key]
+	return value, ok
+}
+
+// Delete removes the value stored under key
+func (c *Connection) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.meta, key)
+}
+
+// ID returns the unique, monotonically increasing ID assigned when the connection was accepted
+func (c *Connection) ID() uint64 {
+	return c.id
+}
+
 // GetState returns the current connection state
 func (c *Connection) GetState() ConnState {
 	return ConnState(c.state.Load())
@@ -56,3 +296,73 @@ func (c *Connection) RemoteAddr() net.Addr {
 func (c *Connection) LocalAddr() net.Addr {
 	return c.conn.LocalAddr()
 }
+
+// addrString formats an address for CLIENT INFO, tolerating a missing one
+func addrString(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	return addr.String()
+}
+
+// Protocol returns the RESP protocol version used for replies on this connection
+func (c *Connection) Protocol() int {
+	if p := c.protocol.Load(); p != 0 {
+		return int(p)
+	}
+	return RESP2
+}
+
+// SetProtocol switches the RESP protocol version used for replies, typically
+// from a HELLO handler
+func (c *Connection) SetProtocol(version int) error {
+	if version != RESP2 && version != RESP3 {
+		return fmt.Errorf("unsupported protocol version: %d", version)
+	}
+	c.protocol.Store(int32(version))
+	return nil
+}
+
+// WriteValue writes a value to the client outside the normal request/reply
+// cycle, such as a Pub/Sub message, a MONITOR line or a RESP3 push. It is safe
+// to call from any goroutine: writes are serialized with command replies, the
+// write timeout is applied and the value is flushed immediately. It must not
+// be called by the goroutine holding an open ArrayWriter on the same connection.
+func (c *Connection) WriteValue(value RedisValue) error {
+	if c.GetState() == StateClosed {
+		return net.ErrClosed
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.server != nil {
+		if timeout := c.server.writeTimeout(); timeout > 0 {
+			if err := c.conn.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+				return err
+			}
+		}
+	}
+	if err := c.writeValue(value); err != nil {
+		return err
+	}
+	return c.writer.Flush()
+}
+
+// flushPending writes out replies held back for pipelined commands, so they
+// reach the client before the connection waits on a blocking command or a
+// pause. A failed flush is picked up by the next reply written.
+func (c *Connection) flushPending() {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.writer.Buffered() == 0 {
+		return
+	}
+	if c.server != nil && c.conn != nil {
+		if timeout := c.server.writeTimeout(); timeout > 0 {
+			c.conn.SetWriteDeadline(time.Now().Add(timeout))
+		}
+	}
+	c.writer.Flush()
+}
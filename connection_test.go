@@ -0,0 +1,156 @@
+package redkit
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConnectionMetadata(t *testing.T) {
+	conn, _ := newTestConnection("")
+
+	if _, ok := conn.Get("user"); ok {
+		t.Fatal("Expected no value before Set")
+	}
+	conn.Set("user", "alice")
+	if value, ok := conn.Get("user"); !ok || value != "alice" {
+		t.Errorf("Expected alice, got %v (%v)", value, ok)
+	}
+	conn.Delete("user")
+	if _, ok := conn.Get("user"); ok {
+		t.Error("Expected value to be deleted")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			conn.Set("counter", i)
+			conn.Get("counter")
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestWriteValueFromOtherGoroutines(t *testing.T) {
+	server, address := startTestServer(t, nil)
+
+	server.RegisterCommandFunc("SUBSCRIBEME", func(conn *Connection, cmd *Command) RedisValue {
+		for i := 0; i < 4; i++ {
+			go func() {
+				for j := 0; j < 25; j++ {
+					conn.WriteValue(RedisValue{Type: SimpleString, Str: "note"})
+				}
+			}()
+		}
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	})
+
+	client := dialRaw(t, address)
+	client.send(t, "SUBSCRIBEME")
+	for i := 0; i < 20; i++ {
+		client.send(t, "PING")
+	}
+
+	notes, pongs := 0, 0
+	for notes+pongs < 121 {
+		switch line := client.readLine(t); line {
+		case "+note":
+			notes++
+		case "+PONG", "+OK":
+			pongs++
+		default:
+			t.Fatalf("Interleaved write produced %q", line)
+		}
+	}
+	if notes != 100 {
+		t.Errorf("Expected 100 notes, got %d", notes)
+	}
+}
+
+func TestWriteValueAfterClose(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	client := dialRaw(t, address)
+	client.send(t, "PING")
+	client.readLine(t)
+
+	conn := server.Connections()[0]
+	conn.Close()
+	if err := conn.WriteValue(RedisValue{Type: SimpleString, Str: "late"}); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Expected net.ErrClosed, got %v", err)
+	}
+}
+
+func TestConnStateHookTransitions(t *testing.T) {
+	var mu sync.Mutex
+	var states []ConnState
+	closed := make(chan struct{})
+	config := DefaultServerConfig()
+	config.ConnStateHook = func(_ net.Conn, state ConnState) {
+		mu.Lock()
+		states = append(states, state)
+		mu.Unlock()
+		if state == StateClosed {
+			close(closed)
+		}
+	}
+	server, address := startTestServer(t, config)
+	// Closing mid-command must not let the connection go back to StateActive
+	server.RegisterCommandFunc("HANGUP", func(conn *Connection, cmd *Command) RedisValue {
+		conn.Close()
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	})
+
+	client := dialRaw(t, address)
+	client.send(t, "PING")
+	client.readLine(t)
+	client.send(t, "HANGUP")
+	client.expectClosed(t)
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for StateClosed")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []ConnState{StateNew, StateActive, StateProcessing, StateActive, StateProcessing, StateClosed}
+	if fmt.Sprint(states) != fmt.Sprint(want) {
+		t.Errorf("Expected transitions %v, got %v", want, states)
+	}
+}
+
+func TestSubscribedState(t *testing.T) {
+	config := DefaultServerConfig()
+	config.IdleTimeout = 10 * time.Millisecond
+	server, address := startTestServer(t, config)
+	server.RegisterCommandFunc("SUBSCRIBE", func(conn *Connection, cmd *Command) RedisValue {
+		conn.SetSubscribed(true)
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	})
+
+	client := dialRaw(t, address)
+	client.send(t, "SUBSCRIBE")
+	client.readLine(t)
+
+	conn := server.Connections()[0]
+	if state := conn.GetState(); state != StateSubscribed {
+		t.Fatalf("Expected StateSubscribed, got %v", state)
+	}
+	time.Sleep(20 * time.Millisecond)
+	server.TriggerIdleCheck()
+	if conn.GetState() == StateClosed {
+		t.Error("Expected subscribed connections to be exempt from the idle timeout")
+	}
+
+	other := dialRaw(t, address)
+	other.send(t, "CLIENT", "KILL", "TYPE", "pubsub")
+	if line := other.readLine(t); line != ":1" {
+		t.Errorf("Expected CLIENT KILL TYPE pubsub to match the subscriber, got %q", line)
+	}
+	client.expectClosed(t)
+}
@@ -0,0 +1,87 @@
+package redkit
+
+import "strconv"
+
+// defaultDatabases is the number of logical databases when ServerConfig.Databases is zero
+const defaultDatabases = 16
+
+// databases returns the number of logical databases SELECT accepts
+func (s *Server) databases() int {
+	if s.Databases > 0 {
+		return s.Databases
+	}
+	return defaultDatabases
+}
+
+// DB returns the index of the logical database selected with SELECT, 0 by default.
+// Handlers keeping data use it to pick the keyspace a command operates on.
+func (c *Connection) DB() int {
+	return int(c.db.Load())
+}
+
+// SelectDB switches the connection to the logical database index, as SELECT does
+func (c *Connection) SelectDB(index int) error {
+	if c.server != nil && (index < 0 || index >= c.server.databases()) {
+		return NewError(ErrPrefixGeneric, "DB index is out of range")
+	}
+	c.db.Store(int32(index))
+	return nil
+}
+
+// OnSwapDB registers a function called by SWAPDB with the two database
+// indexes, once both are validated. Storage implementations use it to
+// exchange the datasets, as the built-in commands exchange the keyspaces of
+// EnableBuiltinStore before; connections stay on the index they selected.
+func (s *Server) OnSwapDB(fn func(a, b int)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onSwapDB = append(s.onSwapDB, fn)
+}
+
+func (s *Server) runSwapDBHooks(a, b int) {
+	s.mu.RLock()
+	hooks := s.onSwapDB
+	s.mu.RUnlock()
+
+	for _, fn := range hooks {
+		fn(a, b)
+	}
+}
+
+// handleSelect implements SELECT index
+func (s *Server) handleSelect(conn *Connection, cmd *Command) RedisValue {
+	index, err := strconv.Atoi(cmd.Args[0])
+	if err != nil {
+		return NewError(ErrPrefixGeneric, "value is not an integer or out of range").Value()
+	}
+	if err := conn.SelectDB(index); err != nil {
+		return ErrorValue(err)
+	}
+	return RedisValue{Type: SimpleString, Str: "OK"}
+}
+
+// handleSwapDB implements SWAPDB index1 index2
+func (s *Server) handleSwapDB(conn *Connection, cmd *Command) RedisValue {
+	a, err := strconv.Atoi(cmd.Args[0])
+	if err != nil {
+		return NewError(ErrPrefixGeneric, "invalid first DB index").Value()
+	}
+	b, err := strconv.Atoi(cmd.Args[1])
+	if err != nil {
+		return NewError(ErrPrefixGeneric, "invalid second DB index").Value()
+	}
+	if n := s.databases(); a < 0 || a >= n || b < 0 || b >= n {
+		return NewError(ErrPrefixGeneric, "DB index is out of range").Value()
+	}
+	if a != b {
+		s.swapDatabases(a, b)
+		s.runSwapDBHooks(a, b)
+		s.TouchDB(a)
+		s.TouchDB(b)
+		// Keys the connections blocked in either database wait for may
+		// exist now
+		s.blocking.signalDB(a)
+		s.blocking.signalDB(b)
+	}
+	return RedisValue{Type: SimpleString, Str: "OK"}
+}
@@ -0,0 +1,86 @@
+package redkit
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestSelect(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	server.RegisterCommandFunc("WHICHDB", func(conn *Connection, cmd *Command) RedisValue {
+		return RedisValue{Type: Integer, Int: int64(conn.DB())}
+	})
+
+	// go-redis sends SELECT itself when Options.DB is set
+	rdb := redis.NewClient(&redis.Options{Addr: address, DB: 3, Protocol: 2})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	if db, err := rdb.Do(ctx, "WHICHDB").Int(); err != nil || db != 3 {
+		t.Fatalf("Expected DB 3, got %d, %v", db, err)
+	}
+
+	raw := dialRaw(t, address)
+	raw.send(t, "WHICHDB")
+	if line := raw.readLine(t); line != ":0" {
+		t.Errorf("Expected a new connection on DB 0, got %q", line)
+	}
+	raw.send(t, "SELECT", "16")
+	if line := raw.readLine(t); line != "-ERR DB index is out of range" {
+		t.Errorf("Expected out of range error, got %q", line)
+	}
+	raw.send(t, "SELECT", "x")
+	if line := raw.readLine(t); !strings.HasPrefix(line, "-ERR value is not an integer") {
+		t.Errorf("Expected integer error, got %q", line)
+	}
+	raw.send(t, "SELECT", "15")
+	raw.readLine(t)
+	raw.send(t, "CLIENT", "INFO")
+	raw.readLine(t)
+	if info := raw.readLine(t); !strings.Contains(info, " db=15 ") {
+		t.Errorf("Expected db=15 in %q", info)
+	}
+}
+
+func TestSelectDatabasesOption(t *testing.T) {
+	server := NewServer(":0", WithDatabases(2))
+	conn := &Connection{server: server}
+	if err := conn.SelectDB(1); err != nil {
+		t.Errorf("SelectDB(1) failed: %v", err)
+	}
+	if err := conn.SelectDB(2); err == nil {
+		t.Error("Expected SelectDB(2) to fail with 2 databases")
+	}
+	if conn.DB() != 1 {
+		t.Errorf("Expected DB 1, got %d", conn.DB())
+	}
+}
+
+func TestSwapDB(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	swapped := make(chan [2]int, 1)
+	server.OnSwapDB(func(a, b int) {
+		swapped <- [2]int{a, b}
+	})
+
+	raw := dialRaw(t, address)
+	raw.send(t, "SWAPDB", "0", "20")
+	if line := raw.readLine(t); line != "-ERR DB index is out of range" {
+		t.Errorf("Expected out of range error, got %q", line)
+	}
+	raw.send(t, "SWAPDB", "1", "2")
+	if line := raw.readLine(t); line != "+OK" {
+		t.Fatalf("Expected +OK, got %q", line)
+	}
+	select {
+	case got := <-swapped:
+		if got != [2]int{1, 2} {
+			t.Errorf("Expected swap of 1 and 2, got %v", got)
+		}
+	default:
+		t.Error("Expected the OnSwapDB hook to run")
+	}
+}
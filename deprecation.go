@@ -0,0 +1,79 @@
+package redkit
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// DeprecationNotice selects how clients calling a deprecated command are told
+type DeprecationNotice int
+
+const (
+	// DeprecationLogOnly only logs and counts the calls
+	DeprecationLogOnly DeprecationNotice = iota
+	// DeprecationAttribute attaches a "warning" RESP3 attribute to every reply
+	// of a deprecated command sent to a RESP3 client
+	DeprecationAttribute
+	// DeprecationPush sends RESP3 clients a "warning" push the first time
+	// their connection calls each deprecated command
+	DeprecationPush
+)
+
+// Deprecated marks a command as kept for old clients only. replacement, if
+// not empty, is what they should call instead, such as "SET" for SETEX. The
+// command keeps working; COMMAND DOCS reports it as deprecated and the
+// server's DeprecationNotice decides how clients are warned.
+func Deprecated(replacement string) CommandOption {
+	return func(e *commandEntry) {
+		e.info.Deprecated = true
+		e.info.ReplacedBy = replacement
+	}
+}
+
+// deprecationWarning is the text clients and the log get for a deprecated command
+func deprecationWarning(name, replacement string) string {
+	if replacement == "" {
+		return fmt.Sprintf("'%s' command is deprecated", strings.ToLower(name))
+	}
+	return fmt.Sprintf("'%s' command is deprecated, use %s instead", strings.ToLower(name), replacement)
+}
+
+// deprecationNotice counts a call to a deprecated command, logs the first one
+// of each connection and adds the client warning to reply, if enabled
+func (s *Server) deprecationNotice(conn *Connection, name, replacement string, reply RedisValue) RedisValue {
+	s.stats.deprecatedCalls.Add(1)
+	if conn == nil {
+		return reply
+	}
+
+	_, warned := conn.warned[name]
+	if !warned {
+		if conn.warned == nil {
+			conn.warned = make(map[string]struct{})
+		}
+		conn.warned[name] = struct{}{}
+		s.logConn(LogLevelWarn, conn, "Deprecated command called", slog.String("cmd", name), slog.String("replaced_by", replacement))
+	}
+	if conn.Protocol() < RESP3 {
+		return reply
+	}
+
+	warning := RedisValue{Type: BulkString, Bulk: []byte(deprecationWarning(name, replacement))}
+	switch s.DeprecationNotice {
+	case DeprecationAttribute:
+		return RedisValue{
+			Type:  Attribute,
+			Map:   []MapEntry{{Key: RedisValue{Type: BulkString, Bulk: []byte("warning")}, Value: warning}},
+			Array: []RedisValue{reply},
+		}
+	case DeprecationPush:
+		if !warned {
+			push := RedisValue{Type: Push, Array: []RedisValue{{Type: BulkString, Bulk: []byte("warning")}, warning}}
+			if err := conn.WriteValue(push); err != nil {
+				s.logConn(LogLevelDebug, conn, "Failed to send deprecation warning", errAttr(err))
+			}
+		}
+	}
+	return reply
+}
@@ -0,0 +1,51 @@
+package redkit
+
+import "testing"
+
+func startDeprecationServer(t *testing.T, notice DeprecationNotice) (*Server, string) {
+	t.Helper()
+	config := DefaultServerConfig()
+	config.DeprecationNotice = notice
+	server, address := startTestServer(t, config)
+	server.RegisterCommandFunc("HELLO", func(conn *Connection, cmd *Command) RedisValue {
+		conn.SetProtocol(RESP3)
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	})
+	server.RegisterCommandFunc("OLDPING", func(conn *Connection, cmd *Command) RedisValue {
+		return RedisValue{Type: SimpleString, Str: "PONG"}
+	}, ExactArgs(0), Deprecated("PING"))
+	return server, address
+}
+
+func TestDeprecatedAttribute(t *testing.T) {
+	server, address := startDeprecationServer(t, DeprecationAttribute)
+
+	// RESP2 clients get the reply alone
+	client := dialRaw(t, address)
+	client.send(t, "OLDPING")
+	expectLines(t, client, "+PONG")
+
+	client.send(t, "HELLO", "3")
+	client.send(t, "OLDPING")
+	expectLines(t, client, "+OK", "|1", "$7", "warning", "$49", "'oldping' command is deprecated, use PING instead", "+PONG")
+
+	if calls := server.Stats().DeprecatedCalls; calls != 2 {
+		t.Errorf("Expected 2 deprecated calls, got %d", calls)
+	}
+}
+
+func TestDeprecatedPush(t *testing.T) {
+	server, address := startDeprecationServer(t, DeprecationPush)
+
+	client := dialRaw(t, address)
+	client.send(t, "HELLO", "3")
+	client.send(t, "OLDPING")
+	client.send(t, "OLDPING")
+	expectLines(t, client, "+OK", ">2", "$7", "warning", "$49", "'oldping' command is deprecated, use PING instead", "+PONG", "+PONG")
+
+	docs := server.commandDocsReply([]string{"oldping"})
+	doc := docs.Map[0].Value.Map
+	if len(doc) != 3 || string(doc[1].Key.Bulk) != "doc_flags" || string(doc[2].Value.Bulk) != "PING" {
+		t.Errorf("Expected COMMAND DOCS to report the deprecation, got %+v", doc)
+	}
+}
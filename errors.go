@@ -0,0 +1,180 @@
+package redkit
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/l00pss/redkit/store"
+)
+
+// Redis error class prefixes
+const (
+	ErrPrefixGeneric   = "ERR"
+	ErrPrefixWrongType = "WRONGTYPE"
+	ErrPrefixNoAuth    = "NOAUTH"
+	ErrPrefixWrongPass = "WRONGPASS"
+	ErrPrefixMoved     = "MOVED"
+	ErrPrefixAsk       = "ASK"
+	ErrPrefixBusy      = "BUSY"
+	ErrPrefixLoading   = "LOADING"
+	ErrPrefixReadOnly  = "READONLY"
+	ErrPrefixExecAbort = "EXECABORT"
+	ErrPrefixNoScript  = "NOSCRIPT"
+)
+
+// RedisError is a Go error carrying a Redis error class prefix (ERR, WRONGTYPE, ...).
+// A handler that panics with a *RedisError gets it sent to the client as an error reply.
+type RedisError struct {
+	Prefix  string
+	Message string
+}
+
+// NewError creates a RedisError with the given prefix and formatted message
+func NewError(prefix, format string, args ...interface{}) *RedisError {
+	return &RedisError{Prefix: prefix, Message: fmt.Sprintf(format, args...)}
+}
+
+// Error implements the error interface
+func (e *RedisError) Error() string {
+	if e.Prefix == "" {
+		return e.Message
+	}
+	return e.Prefix + " " + e.Message
+}
+
+// Value converts the error into an ErrorReply value
+func (e *RedisError) Value() RedisValue {
+	return RedisValue{Type: ErrorReply, Str: e.Error()}
+}
+
+// ErrorValue converts any error into an ErrorReply value. store.ErrWrongType
+// is reported as WrongType, so that every command given a key of the wrong
+// type replies alike without checking for it; other errors that aren't a
+// *RedisError are reported with the generic ERR prefix.
+func ErrorValue(err error) RedisValue {
+	var redisErr *RedisError
+	if errors.As(err, &redisErr) {
+		return redisErr.Value()
+	}
+	if errors.Is(err, store.ErrWrongType) {
+		return WrongType().Value()
+	}
+	return RedisValue{Type: ErrorReply, Str: ErrPrefixGeneric + " " + err.Error()}
+}
+
+// WrongType is returned when an operation targets a key holding another data type
+func WrongType() *RedisError {
+	return NewError(ErrPrefixWrongType, "Operation against a key holding the wrong kind of value")
+}
+
+// WrongArity is returned when a command is called with the wrong number of arguments
+func WrongArity(cmd string) *RedisError {
+	return NewError(ErrPrefixGeneric, "wrong number of arguments for '%s' command", strings.ToLower(cmd))
+}
+
+// maxErrorArgLen bounds how much of the client's input an error message echoes
+// back, as Redis does
+const maxErrorArgLen = 128
+
+// UnknownCommand is returned for a command that isn't registered. Like Redis it
+// quotes the name and the first arguments, each followed by a space.
+func UnknownCommand(cmd string, args []string) *RedisError {
+	var quoted strings.Builder
+	for _, arg := range args {
+		if quoted.Len() >= maxErrorArgLen {
+			break
+		}
+		quoted.WriteString("'" + truncateErrorArg(arg, maxErrorArgLen-quoted.Len()) + "' ")
+	}
+	return NewError(ErrPrefixGeneric, "unknown command '%s', with args beginning with: %s",
+		truncateErrorArg(cmd, maxErrorArgLen), quoted.String())
+}
+
+// UnknownSubcommand is returned for a subcommand the container command doesn't have
+func UnknownSubcommand(container, sub string) *RedisError {
+	return NewError(ErrPrefixGeneric, "unknown subcommand '%s'. Try %s HELP.",
+		truncateErrorArg(sub, maxErrorArgLen), strings.ToUpper(container))
+}
+
+// truncateErrorArg cuts s to at most n bytes and replaces line breaks, which
+// would end the error reply early
+func truncateErrorArg(s string, n int) string {
+	if len(s) > n {
+		s = s[:n]
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '\r' || r == '\n' {
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+// NoAuth is returned when a command requires authentication
+func NoAuth() *RedisError {
+	return NewError(ErrPrefixNoAuth, "Authentication required.")
+}
+
+// Moved redirects a cluster client to the node serving the slot
+func Moved(slot int, addr string) *RedisError {
+	return NewError(ErrPrefixMoved, "%d %s", slot, addr)
+}
+
+// Ask redirects a cluster client to another node for a single command during slot migration
+func Ask(slot int, addr string) *RedisError {
+	return NewError(ErrPrefixAsk, "%d %s", slot, addr)
+}
+
+// Busy is returned while the server is running a script
+func Busy() *RedisError {
+	return NewError(ErrPrefixBusy, "Redis is busy running a script. You can only call SCRIPT KILL or SHUTDOWN NOSAVE.")
+}
+
+// Loading is returned while the dataset is being loaded
+func Loading() *RedisError {
+	return NewError(ErrPrefixLoading, "Redis is loading the dataset in memory")
+}
+
+// ReadOnly is returned when a write command is sent on a read-only connection
+func ReadOnly() *RedisError {
+	return NewError(ErrPrefixReadOnly, "You can't write against a read only connection.")
+}
+
+// ExecAbort is returned by EXEC when a command failed to queue after MULTI
+func ExecAbort() *RedisError {
+	return NewError(ErrPrefixExecAbort, "Transaction discarded because of previous errors.")
+}
+
+// NoScript is returned by EVALSHA when no script has the given SHA1
+func NoScript() *RedisError {
+	return NewError(ErrPrefixNoScript, "No matching script. Please use EVAL.")
+}
+
+// ProtocolError describes a malformed frame sent by a client
+type ProtocolError struct {
+	Message string
+	// Fatal is set when the stream can no longer be framed and the connection must be dropped
+	Fatal bool
+}
+
+// Error implements the error interface
+func (e *ProtocolError) Error() string {
+	return "Protocol error: " + e.Message
+}
+
+// protocolError creates a recoverable ProtocolError: the offending frame was consumed entirely
+func protocolError(format string, args ...interface{}) *ProtocolError {
+	return &ProtocolError{Message: fmt.Sprintf(format, args...)}
+}
+
+// fatalProtocolError creates a ProtocolError after which the connection can't be resynchronized
+func fatalProtocolError(format string, args ...interface{}) *ProtocolError {
+	return &ProtocolError{Message: fmt.Sprintf(format, args...), Fatal: true}
+}
+
+// isRecoverable reports whether err is a ProtocolError that leaves the stream aligned on a frame boundary
+func isRecoverable(err error) bool {
+	var protoErr *ProtocolError
+	return errors.As(err, &protoErr) && !protoErr.Fatal
+}
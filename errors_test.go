@@ -0,0 +1,67 @@
+package redkit
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/l00pss/redkit/store"
+)
+
+// TestErrorHelpers tests that helpers produce correctly prefixed error replies
+func TestErrorHelpers(t *testing.T) {
+	tests := []struct {
+		err      *RedisError
+		expected string
+	}{
+		{WrongType(), "WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{WrongArity("GET"), "ERR wrong number of arguments for 'get' command"},
+		{UnknownCommand("foo", nil), "ERR unknown command 'foo', with args beginning with: "},
+		{UnknownCommand("foo", []string{"a", "b c"}), "ERR unknown command 'foo', with args beginning with: 'a' 'b c' "},
+		{UnknownCommand("foo\r\n", []string{strings.Repeat("x", 200), "y"}), "ERR unknown command 'foo  ', with args beginning with: '" + strings.Repeat("x", 128) + "' "},
+		{UnknownSubcommand("config", "NOPE"), "ERR unknown subcommand 'NOPE'. Try CONFIG HELP."},
+		{NoAuth(), "NOAUTH Authentication required."},
+		{Moved(3999, "127.0.0.1:6381"), "MOVED 3999 127.0.0.1:6381"},
+		{Ask(3999, "127.0.0.1:6381"), "ASK 3999 127.0.0.1:6381"},
+		{Loading(), "LOADING Redis is loading the dataset in memory"},
+	}
+
+	for _, tt := range tests {
+		value := tt.err.Value()
+		if value.Type != ErrorReply || value.Str != tt.expected {
+			t.Errorf("Expected error reply '%s', got %v '%s'", tt.expected, value.Type, value.Str)
+		}
+	}
+}
+
+// TestErrorValue tests conversion of wrapped and plain Go errors
+func TestErrorValue(t *testing.T) {
+	wrapped := fmt.Errorf("lookup failed: %w", WrongType())
+	if got := ErrorValue(wrapped).Str; got != WrongType().Error() {
+		t.Errorf("Expected wrapped RedisError to keep its prefix, got '%s'", got)
+	}
+
+	for _, err := range []error{store.ErrWrongType, fmt.Errorf("update failed: %w", store.ErrWrongType)} {
+		if got := ErrorValue(err).Str; got != WrongType().Error() {
+			t.Errorf("Expected the store's ErrWrongType as WRONGTYPE, got '%s'", got)
+		}
+	}
+
+	if got := ErrorValue(errors.New("boom")).Str; got != "ERR boom" {
+		t.Errorf("Expected 'ERR boom', got '%s'", got)
+	}
+}
+
+// TestHandlerPanicWithRedisError tests that the dispatcher replies with a panicked RedisError
+func TestHandlerPanicWithRedisError(t *testing.T) {
+	server := NewServer(":0")
+	server.RegisterCommandFunc("FAIL", func(conn *Connection, cmd *Command) RedisValue {
+		panic(WrongType())
+	})
+
+	result := server.handleCommand(nil, &Command{Name: "fail"})
+	if result.Type != ErrorReply || result.Str != WrongType().Error() {
+		t.Errorf("Expected WRONGTYPE error reply, got %v '%s'", result.Type, result.Str)
+	}
+}
@@ -51,12 +51,10 @@ func main() {
 	})
 
 	// Add rate limiting middleware - max 100 commands per connection
-	var commandCounts sync.Map // map[*Connection]int
-
 	server.UseFunc(func(conn *redkit.Connection, cmd *redkit.Command, next redkit.CommandHandler) redkit.RedisValue {
 		// Get current count
-		val, _ := commandCounts.LoadOrStore(conn, 0)
-		count := val.(int)
+		value, _ := conn.Get("commandCount")
+		count, _ := value.(int)
 
 		// Check rate limit
 		if count >= 100 {
@@ -67,7 +65,7 @@ func main() {
 		}
 
 		// Increment counter
-		commandCounts.Store(conn, count+1)
+		conn.Set("commandCount", count+1)
 
 		return next.Handle(conn, cmd)
 	})
@@ -84,59 +82,26 @@ func main() {
 			Type: redkit.BulkString,
 			Bulk: []byte(fmt.Sprintf("Hello, %s!", cmd.Args[0])),
 		}
-	})
-
-	// Register a simple SET/GET simulation with thread-safe storage
-	storage := make(map[string]string)
-	var storageMu sync.RWMutex
+	}, redkit.RangeArgs(0, 1))
 
-	server.RegisterCommandFunc(string(redkit.SET), func(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
-		if len(cmd.Args) != 2 {
-			return redkit.RedisValue{
-				Type: redkit.ErrorReply,
-				Str:  "ERR wrong number of arguments for 'set' command",
-			}
-		}
-		storageMu.Lock()
-		storage[cmd.Args[0]] = cmd.Args[1]
-		storageMu.Unlock()
-		return redkit.RedisValue{
-			Type: redkit.SimpleString,
-			Str:  "OK",
-		}
-	})
+	// Mount a simple SET/GET simulation with thread-safe storage as a command set
+	if err := server.Mount(stringCommands()); err != nil {
+		log.Fatal(err)
+	}
 
-	server.RegisterCommandFunc(string(redkit.GET), func(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
-		if len(cmd.Args) != 1 {
-			return redkit.RedisValue{
-				Type: redkit.ErrorReply,
-				Str:  "ERR wrong number of arguments for 'get' command",
-			}
-		}
-		storageMu.RLock()
-		value, exists := storage[cmd.Args[0]]
-		storageMu.RUnlock()
-		if !exists {
-			return redkit.RedisValue{Type: redkit.Null}
-		}
+	// CONFIG GET/SET stubs for clients that probe the configuration
+	server.RegisterSubcommandFunc("CONFIG", "GET", func(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
 		return redkit.RedisValue{
-			Type: redkit.BulkString,
-			Bulk: []byte(value),
-		}
-	})
-
-	server.RegisterCommandFunc("CONFIG", func(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
-		if len(cmd.Args) >= 2 && cmd.Args[0] == "GET" {
-			return redkit.RedisValue{
-				Type:  redkit.Array,
-				Array: []redkit.RedisValue{},
-			}
+			Type:  redkit.Array,
+			Array: []redkit.RedisValue{},
 		}
+	}, redkit.MinArgs(1))
+	server.RegisterSubcommandFunc("CONFIG", "SET", func(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
 		return redkit.RedisValue{
 			Type: redkit.SimpleString,
 			Str:  "OK",
 		}
-	})
+	}, redkit.VariadicArgs(2, 2))
 
 	// Handle graceful shutdown
 	go func() {
@@ -163,3 +128,35 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// stringCommands returns the SET and GET commands, backed by an in-memory map
+func stringCommands() *redkit.CommandSet {
+	storage := make(map[string]string)
+	var storageMu sync.RWMutex
+
+	strs := redkit.NewCommandSet("strings")
+	// ExactArgs lets the server reply with the arity error before the handler runs
+	strs.RegisterFunc(string(redkit.SET), func(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+		storageMu.Lock()
+		storage[cmd.Args[0]] = cmd.Args[1]
+		storageMu.Unlock()
+		return redkit.RedisValue{
+			Type: redkit.SimpleString,
+			Str:  "OK",
+		}
+	}, redkit.ExactArgs(2))
+
+	strs.RegisterFunc(string(redkit.GET), func(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+		storageMu.RLock()
+		value, exists := storage[cmd.Args[0]]
+		storageMu.RUnlock()
+		if !exists {
+			return redkit.RedisValue{Type: redkit.Null}
+		}
+		return redkit.RedisValue{
+			Type: redkit.BulkString,
+			Bulk: []byte(value),
+		}
+	}, redkit.ExactArgs(1))
+	return strs
+}
@@ -0,0 +1,212 @@
+package redkit
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// Expirer keeps when keys expire and calls back once they do, for handlers
+// keeping data in storage of their own. Such a storage registers a key with
+// Expire when a command gives it a TTL and removes the key's data from the
+// OnExpire callbacks; Expired tells reads that a key is past its expiration
+// before the callbacks ran. Every server has one (see Server.Expirer), which
+// also aborts the transactions watching an expired key and invalidates it
+// for client tracking. It is safe for concurrent use.
+type Expirer struct {
+	server *Server
+	mu     sync.Mutex
+	keys   map[watchKey]*expiring
+	queue  expiryQueue
+	wake   chan struct{} // buffered, so changes never wait for the timer
+	hooks  []func(db int, key string)
+}
+
+// expiring is a key registered with the Expirer and when it expires
+type expiring struct {
+	watchKey
+	at    time.Time
+	index int // in the queue
+}
+
+// expiryQueue is a min-heap of keys by expiration
+type expiryQueue []*expiring
+
+func (q expiryQueue) Len() int           { return len(q) }
+func (q expiryQueue) Less(i, j int) bool { return q[i].at.Before(q[j].at) }
+func (q expiryQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index, q[j].index = i, j
+}
+func (q *expiryQueue) Push(x any) {
+	e := x.(*expiring)
+	e.index = len(*q)
+	*q = append(*q, e)
+}
+func (q *expiryQueue) Pop() any {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return e
+}
+
+func newExpirer(s *Server) *Expirer {
+	x := &Expirer{
+		server: s,
+		keys:   make(map[watchKey]*expiring),
+		wake:   make(chan struct{}, 1),
+	}
+	s.OnSwapDB(x.swapDB)
+	return x
+}
+
+// Expirer returns the server's Expirer
+func (s *Server) Expirer() *Expirer {
+	return s.expirer
+}
+
+// OnExpire registers a function called with every key that expires, from
+// the Expirer's goroutine, in order of expiration. The key is no longer
+// registered by then.
+func (x *Expirer) OnExpire(fn func(db int, key string)) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.hooks = append(x.hooks, fn)
+}
+
+// Expire registers key of database db to expire at at, replacing the
+// expiration it had, or unregisters it if at is zero. A time already passed
+// expires the key right away.
+func (x *Expirer) Expire(db int, key string, at time.Time) {
+	if at.IsZero() {
+		x.Persist(db, key)
+		return
+	}
+	x.mu.Lock()
+	k := watchKey{db: db, key: key}
+	if e, ok := x.keys[k]; ok {
+		e.at = at
+		heap.Fix(&x.queue, e.index)
+	} else {
+		e = &expiring{watchKey: k, at: at}
+		x.keys[k] = e
+		heap.Push(&x.queue, e)
+	}
+	first := x.queue[0].watchKey == k
+	x.mu.Unlock()
+
+	if first {
+		x.signal()
+	}
+}
+
+// Persist unregisters key of database db, so it no longer expires, and
+// reports whether it was registered
+func (x *Expirer) Persist(db int, key string) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	k := watchKey{db: db, key: key}
+	e, ok := x.keys[k]
+	if ok {
+		delete(x.keys, k)
+		heap.Remove(&x.queue, e.index)
+	}
+	return ok
+}
+
+// ExpireTime returns when key of database db expires, zero if it isn't
+// registered
+func (x *Expirer) ExpireTime(db int, key string) time.Time {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if e, ok := x.keys[watchKey{db: db, key: key}]; ok {
+		return e.at
+	}
+	return time.Time{}
+}
+
+// Expired reports whether key of database db is registered to expire at or
+// before now, for reads to treat it as missing until the OnExpire
+// callbacks removed it
+func (x *Expirer) Expired(db int, key string) bool {
+	at := x.ExpireTime(db, key)
+	return !at.IsZero() && !at.After(time.Now())
+}
+
+// Len returns the number of registered keys
+func (x *Expirer) Len() int {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return len(x.keys)
+}
+
+// signal wakes the Expirer's goroutine to look at the earliest expiration again
+func (x *Expirer) signal() {
+	select {
+	case x.wake <- struct{}{}:
+	default:
+	}
+}
+
+// swapDB exchanges the keys of databases a and b, as SWAPDB does
+func (x *Expirer) swapDB(a, b int) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	keys := make(map[watchKey]*expiring, len(x.keys))
+	for k, e := range x.keys {
+		switch k.db {
+		case a:
+			e.db = b
+		case b:
+			e.db = a
+		}
+		keys[e.watchKey] = e
+	}
+	x.keys = keys
+}
+
+// due unregisters the keys whose expiration passed by now and returns them
+// with the OnExpire callbacks, and how long until the next one expires, a
+// negative duration if none is registered
+func (x *Expirer) due(now time.Time) ([]watchKey, []func(db int, key string), time.Duration) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	var expired []watchKey
+	for len(x.queue) > 0 && !x.queue[0].at.After(now) {
+		e := heap.Pop(&x.queue).(*expiring)
+		delete(x.keys, e.watchKey)
+		expired = append(expired, e.watchKey)
+	}
+	if len(x.queue) == 0 {
+		return expired, x.hooks, -1
+	}
+	return expired, x.hooks, x.queue[0].at.Sub(now)
+}
+
+// start runs the goroutine expiring keys until the server shuts down
+func (x *Expirer) start() {
+	go func() {
+		timer := time.NewTimer(time.Hour)
+		defer timer.Stop()
+		for {
+			expired, hooks, wait := x.due(time.Now())
+			for _, k := range expired {
+				for _, fn := range hooks {
+					fn(k.db, k.key)
+				}
+				x.server.keyEvent(k.db, KeyEventExpired, k.key)
+			}
+			if wait < 0 {
+				wait = time.Hour
+			}
+			timer.Reset(wait)
+
+			select {
+			case <-x.server.ctx.Done():
+				return
+			case <-timer.C:
+			case <-x.wake:
+			}
+		}
+	}()
+}
@@ -0,0 +1,82 @@
+package redkit
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestExpirer tests that registered keys expire in order and can be
+// rescheduled or persisted before
+func TestExpirer(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	x := server.Expirer()
+
+	var mu sync.Mutex
+	var expired []string
+	done := make(chan struct{})
+	x.OnExpire(func(db int, key string) {
+		mu.Lock()
+		defer mu.Unlock()
+		expired = append(expired, key)
+		if len(expired) == 2 {
+			close(done)
+		}
+	})
+
+	now := time.Now()
+	x.Expire(0, "late", now.Add(80*time.Millisecond))
+	x.Expire(0, "early", now.Add(time.Hour))
+	x.Expire(0, "early", now.Add(40*time.Millisecond))
+	x.Expire(1, "kept", now.Add(20*time.Millisecond))
+	if !x.Persist(1, "kept") || x.Persist(1, "kept") {
+		t.Error("Expected kept to be persisted once")
+	}
+	if at := x.ExpireTime(0, "early"); !at.Equal(now.Add(40 * time.Millisecond)) {
+		t.Errorf("Unexpected expiration %v", at)
+	}
+	if x.Expired(0, "early") {
+		t.Error("Expected early not to have expired yet")
+	}
+
+	client := dialRaw(t, address)
+	client.send(t, "WATCH", "late")
+	expectLines(t, client, "+OK")
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the keys to expire")
+	}
+	mu.Lock()
+	if len(expired) != 2 || expired[0] != "early" || expired[1] != "late" {
+		t.Errorf("Expected early then late to expire, got %v", expired)
+	}
+	mu.Unlock()
+	if n := x.Len(); n != 0 {
+		t.Errorf("Expected no key left, got %d", n)
+	}
+
+	client.send(t, "MULTI")
+	expectLines(t, client, "+OK")
+	client.send(t, "PING")
+	expectLines(t, client, "+QUEUED")
+	client.send(t, "EXEC")
+	expectLines(t, client, "*-1")
+}
+
+// TestExpirerSwapDB tests that SWAPDB moves registered keys along
+func TestExpirerSwapDB(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	x := server.Expirer()
+	at := time.Now().Add(time.Hour)
+	x.Expire(0, "a", at)
+	x.Expire(1, "b", at)
+
+	client := dialRaw(t, address)
+	client.send(t, "SWAPDB", "0", "1")
+	expectLines(t, client, "+OK")
+	if x.ExpireTime(1, "a").IsZero() || x.ExpireTime(0, "b").IsZero() || !x.ExpireTime(0, "a").IsZero() {
+		t.Error("Expected the keys to swap databases")
+	}
+}
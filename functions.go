@@ -0,0 +1,246 @@
+package redkit
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// FunctionCall is what a function registered with RegisterFunction gets when
+// it is called with FCALL or FCALL_RO
+type FunctionCall struct {
+	Conn *Connection
+	Keys []string
+	Args []string
+
+	server   *Server
+	ctx      context.Context
+	readOnly bool
+}
+
+// Context returns the context of the FCALL command
+func (c *FunctionCall) Context() context.Context {
+	if c.ctx != nil {
+		return c.ctx
+	}
+	return context.Background()
+}
+
+// Call runs a command from the function, like redis.call in a script, and
+// returns its reply; an error is returned as an ErrorReply value. The calls
+// of a function run atomically: other connections' commands wait until the
+// function returns.
+func (c *FunctionCall) Call(name string, args ...string) RedisValue {
+	upper := strings.ToUpper(name)
+	if _, ok := noScriptCommands[upper]; ok {
+		return NewError(ErrPrefixGeneric, "This Redis command is not allowed from script").Value()
+	}
+	if c.readOnly && c.server.commandIsWrite(upper) {
+		return NewError(ErrPrefixGeneric, "Write commands are not allowed from read-only scripts.").Value()
+	}
+	return c.server.handleCommand(c.Conn, &Command{Name: name, Args: args, ctx: c.ctx})
+}
+
+// FunctionOption configures a function registered with RegisterFunction
+type FunctionOption func(*registeredFunction)
+
+// FunctionNoWrites declares that the function doesn't write, so it can be
+// called with FCALL_RO and on read-only connections. Its Call refuses write commands.
+func FunctionNoWrites() FunctionOption {
+	return func(f *registeredFunction) {
+		f.noWrites = true
+	}
+}
+
+// FunctionDescription sets the description shown by FUNCTION LIST
+func FunctionDescription(description string) FunctionOption {
+	return func(f *registeredFunction) {
+		f.description = description
+	}
+}
+
+// registeredFunction is a function of a library
+type registeredFunction struct {
+	name        string
+	library     string
+	fn          func(call *FunctionCall) RedisValue
+	noWrites    bool
+	description string
+}
+
+// functionRegistry holds the registered functions by library and by name,
+// which is unique across libraries
+type functionRegistry struct {
+	mu        sync.RWMutex
+	libraries map[string]map[string]*registeredFunction
+	functions map[string]*registeredFunction
+}
+
+func newFunctionRegistry() *functionRegistry {
+	return &functionRegistry{
+		libraries: make(map[string]map[string]*registeredFunction),
+		functions: make(map[string]*registeredFunction),
+	}
+}
+
+// RegisterFunction registers a Go function callable with FCALL name numkeys
+// [key ...] [arg ...], giving atomic multi-step operations like a script
+// without embedding Lua. Function names are unique across libraries.
+func (s *Server) RegisterFunction(library, name string, fn func(call *FunctionCall) RedisValue, opts ...FunctionOption) error {
+	if library == "" || name == "" || fn == nil {
+		return fmt.Errorf("empty function name")
+	}
+	f := &registeredFunction{name: name, library: library, fn: fn}
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	r := s.functions
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.functions[name]; exists {
+		return fmt.Errorf("function already exists: %s", name)
+	}
+	if r.libraries[library] == nil {
+		r.libraries[library] = make(map[string]*registeredFunction)
+	}
+	r.libraries[library][name] = f
+	r.functions[name] = f
+	return nil
+}
+
+// DeleteFunctionLibrary removes a library and its functions and reports
+// whether it existed
+func (s *Server) DeleteFunctionLibrary(library string) bool {
+	r := s.functions
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	funcs, ok := r.libraries[library]
+	if !ok {
+		return false
+	}
+	for name := range funcs {
+		delete(r.functions, name)
+	}
+	delete(r.libraries, library)
+	return true
+}
+
+func (r *functionRegistry) lookup(name string) (*registeredFunction, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	f, ok := r.functions[name]
+	return f, ok
+}
+
+// fcallHandler returns the handler of FCALL or FCALL_RO
+func (s *Server) fcallHandler(readOnly bool) func(*Connection, *Command) RedisValue {
+	return func(conn *Connection, cmd *Command) RedisValue {
+		keys, args, keyErr := scriptKeys(cmd.Args[1:])
+		if keyErr != nil {
+			return keyErr.Value()
+		}
+		f, ok := s.functions.lookup(cmd.Args[0])
+		if !ok {
+			return NewError(ErrPrefixGeneric, "Function not found").Value()
+		}
+		if readOnly && !f.noWrites {
+			return NewError(ErrPrefixGeneric, "Can not execute a script with write flag using *_ro command.").Value()
+		}
+
+		call := &FunctionCall{Conn: conn, Keys: keys, Args: args, server: s, ctx: cmd.ctx, readOnly: f.noWrites}
+		var reply RedisValue
+		s.runExclusive(conn, func() {
+			reply = f.fn(call)
+		})
+		return reply
+	}
+}
+
+// functionList implements FUNCTION LIST [LIBRARYNAME pattern]
+func (s *Server) functionList(conn *Connection, cmd *Command) RedisValue {
+	pattern := "*"
+	switch {
+	case len(cmd.Args) == 2 && strings.EqualFold(cmd.Args[0], "LIBRARYNAME"):
+		pattern = cmd.Args[1]
+	case len(cmd.Args) != 0:
+		return NewError(ErrPrefixGeneric, "syntax error").Value()
+	}
+
+	r := s.functions
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.libraries))
+	for name := range r.libraries {
+		if ok, _ := path.Match(pattern, name); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	libraries := make([]RedisValue, len(names))
+	for i, name := range names {
+		funcNames := make([]string, 0, len(r.libraries[name]))
+		for funcName := range r.libraries[name] {
+			funcNames = append(funcNames, funcName)
+		}
+		sort.Strings(funcNames)
+
+		funcs := make([]RedisValue, len(funcNames))
+		for j, funcName := range funcNames {
+			f := r.libraries[name][funcName]
+			description := RedisValue{Type: Null}
+			if f.description != "" {
+				description = RedisValue{Type: BulkString, Bulk: []byte(f.description)}
+			}
+			flags := RedisValue{Type: Set, Array: []RedisValue{}}
+			if f.noWrites {
+				flags.Array = append(flags.Array, RedisValue{Type: BulkString, Bulk: []byte("no-writes")})
+			}
+			funcs[j] = RedisValue{Type: Map, Map: []MapEntry{
+				{Key: RedisValue{Type: BulkString, Bulk: []byte("name")}, Value: RedisValue{Type: BulkString, Bulk: []byte(f.name)}},
+				{Key: RedisValue{Type: BulkString, Bulk: []byte("description")}, Value: description},
+				{Key: RedisValue{Type: BulkString, Bulk: []byte("flags")}, Value: flags},
+			}}
+		}
+		libraries[i] = RedisValue{Type: Map, Map: []MapEntry{
+			{Key: RedisValue{Type: BulkString, Bulk: []byte("library_name")}, Value: RedisValue{Type: BulkString, Bulk: []byte(name)}},
+			{Key: RedisValue{Type: BulkString, Bulk: []byte("engine")}, Value: RedisValue{Type: BulkString, Bulk: []byte("GO")}},
+			{Key: RedisValue{Type: BulkString, Bulk: []byte("functions")}, Value: RedisValue{Type: Array, Array: funcs}},
+		}}
+	}
+	return RedisValue{Type: Array, Array: libraries}
+}
+
+// registerFunctions registers FCALL, FCALL_RO and FUNCTION
+func (s *Server) registerFunctions() {
+	s.RegisterCommandFunc(string(FCALL), s.fcallHandler(false), MinArgs(2), WithKeysFunc(NumKeysAt(2)), exclusive(),
+		WithSummary("Invokes a function."))
+	s.RegisterCommandFunc(string(FCALL_RO), s.fcallHandler(true), MinArgs(2), WithKeysFunc(NumKeysAt(2)), exclusive(),
+		WithFlags(CmdReadOnly), WithSummary("Invokes a read-only function."))
+
+	s.RegisterSubcommandFunc(string(FUNCTION), "LIST", s.functionList, WithSummary("Returns information about all libraries."))
+	s.RegisterSubcommandFunc(string(FUNCTION), "DELETE", func(conn *Connection, cmd *Command) RedisValue {
+		if !s.DeleteFunctionLibrary(cmd.Args[0]) {
+			return NewError(ErrPrefixGeneric, "Library not found").Value()
+		}
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	}, ExactArgs(1), WithFlags(CmdWrite), WithSummary("Deletes a library and its functions."))
+	s.RegisterSubcommandFunc(string(FUNCTION), "FLUSH", func(conn *Connection, cmd *Command) RedisValue {
+		if len(cmd.Args) == 1 && !strings.EqualFold(cmd.Args[0], "ASYNC") && !strings.EqualFold(cmd.Args[0], "SYNC") {
+			return NewError(ErrPrefixGeneric, "FUNCTION FLUSH only supports SYNC|ASYNC option").Value()
+		}
+		r := s.functions
+		r.mu.Lock()
+		r.libraries = make(map[string]map[string]*registeredFunction)
+		r.functions = make(map[string]*registeredFunction)
+		r.mu.Unlock()
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	}, RangeArgs(0, 1), WithFlags(CmdWrite), WithSummary("Deletes all libraries and functions."))
+	s.RegisterSubcommandFunc(string(FUNCTION), "LOAD", func(conn *Connection, cmd *Command) RedisValue {
+		return NewError(ErrPrefixGeneric, "Functions are registered by the server in Go, FUNCTION LOAD is not supported").Value()
+	}, MinArgs(1), WithSummary("Not supported: functions are registered with RegisterFunction."))
+}
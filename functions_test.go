@@ -0,0 +1,74 @@
+package redkit
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestFCall(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	counters := make(map[string]int64)
+	server.RegisterCommandFunc("INCR", func(conn *Connection, cmd *Command) RedisValue {
+		counters[cmd.Args[0]]++
+		return RedisValue{Type: Integer, Int: counters[cmd.Args[0]]}
+	}, ExactArgs(1))
+
+	err := server.RegisterFunction("counters", "incr_both", func(call *FunctionCall) RedisValue {
+		a := call.Call("INCR", call.Keys[0])
+		b := call.Call("incr", call.Keys[1])
+		return RedisValue{Type: Integer, Int: a.Int + b.Int}
+	}, FunctionDescription("Increments two counters"))
+	if err != nil {
+		t.Fatalf("RegisterFunction failed: %v", err)
+	}
+	server.RegisterFunction("counters", "peek", func(call *FunctionCall) RedisValue {
+		return call.Call("INCR", call.Keys[0])
+	}, FunctionNoWrites())
+	if err := server.RegisterFunction("other", "peek", func(call *FunctionCall) RedisValue { return RedisValue{} }); err == nil {
+		t.Error("Expected an error for a duplicate function name")
+	}
+
+	rdb := redis.NewClient(&redis.Options{Addr: address, Protocol: 2})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	if n, err := rdb.FCall(ctx, "incr_both", []string{"a", "b"}).Int64(); err != nil || n != 2 {
+		t.Errorf("Expected 2, got %d, %v", n, err)
+	}
+	if err := rdb.FCall(ctx, "missing", nil).Err(); err == nil || err.Error() != "ERR Function not found" {
+		t.Errorf("Expected function not found, got %v", err)
+	}
+	if err := rdb.FCallRO(ctx, "incr_both", []string{"a", "b"}).Err(); err == nil || !strings.Contains(err.Error(), "write flag") {
+		t.Errorf("Expected FCALL_RO to refuse a writing function, got %v", err)
+	}
+	if err := rdb.FCallRO(ctx, "peek", []string{"a"}).Err(); err == nil || !strings.Contains(err.Error(), "read-only scripts") {
+		t.Errorf("Expected writes to be refused from a no-writes function, got %v", err)
+	}
+
+	libs, err := rdb.FunctionList(ctx, redis.FunctionListQuery{}).Result()
+	if err != nil {
+		t.Fatalf("FUNCTION LIST failed: %v", err)
+	}
+	if len(libs) != 1 || libs[0].Name != "counters" || len(libs[0].Functions) != 2 {
+		t.Fatalf("Unexpected libraries %+v", libs)
+	}
+	if f := libs[0].Functions[0]; f.Name != "incr_both" || f.Description != "Increments two counters" {
+		t.Errorf("Unexpected function %+v", f)
+	}
+	if f := libs[0].Functions[1]; len(f.Flags) != 1 || f.Flags[0] != "no-writes" {
+		t.Errorf("Expected the no-writes flag, got %+v", f)
+	}
+
+	if err := rdb.FunctionDelete(ctx, "counters").Err(); err != nil {
+		t.Fatalf("FUNCTION DELETE failed: %v", err)
+	}
+	if err := rdb.FCall(ctx, "incr_both", []string{"a", "b"}).Err(); err == nil {
+		t.Error("Expected the deleted function to be gone")
+	}
+	if err := rdb.FunctionDelete(ctx, "counters").Err(); err == nil || err.Error() != "ERR Library not found" {
+		t.Errorf("Expected library not found, got %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package redkit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultHealthTimeout bounds how long Healthy and HEALTHCHECK wait for checks
+const defaultHealthTimeout = 5 * time.Second
+
+// HealthCheck reports whether a dependency of the server, such as its storage
+// or a replication link, is working. It should return promptly once ctx is done.
+type HealthCheck func(ctx context.Context) error
+
+// HealthReport is the result of running every registered health check
+type HealthReport struct {
+	Healthy bool
+	// Checks maps each check name to its error, or nil if it passed
+	Checks map[string]error
+}
+
+// RegisterHealthCheck adds a named check consulted by Healthy, the HEALTHCHECK
+// command and the admin /readyz endpoint. Registering a name again replaces it.
+func (s *Server) RegisterHealthCheck(name string, check HealthCheck) error {
+	if name == "" {
+		return fmt.Errorf("empty health check name")
+	}
+	if check == nil {
+		return fmt.Errorf("nil health check %s", name)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.healthChecks == nil {
+		s.healthChecks = make(map[string]HealthCheck)
+	}
+	s.healthChecks[name] = check
+	return nil
+}
+
+// CheckHealth runs every registered health check concurrently. A server that was
+// shut down is never healthy.
+func (s *Server) CheckHealth(ctx context.Context) HealthReport {
+	s.mu.RLock()
+	checks := make(map[string]HealthCheck, len(s.healthChecks))
+	for name, check := range s.healthChecks {
+		checks[name] = check
+	}
+	s.mu.RUnlock()
+
+	type result struct {
+		name string
+		err  error
+	}
+	results := make(chan result, len(checks))
+	for name, check := range checks {
+		go func(name string, check HealthCheck) {
+			results <- result{name, runHealthCheck(ctx, check)}
+		}(name, check)
+	}
+
+	report := HealthReport{Healthy: !s.IsShutdown(), Checks: make(map[string]error, len(checks))}
+	for range checks {
+		select {
+		case r := <-results:
+			report.Checks[r.name] = r.err
+			if r.err != nil {
+				report.Healthy = false
+			}
+		case <-ctx.Done():
+			for name := range checks {
+				if _, done := report.Checks[name]; !done {
+					report.Checks[name] = ctx.Err()
+				}
+			}
+			report.Healthy = false
+			return report
+		}
+	}
+	return report
+}
+
+func runHealthCheck(ctx context.Context, check HealthCheck) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("health check panicked: %v", r)
+		}
+	}()
+	return check(ctx)
+}
+
+// Healthy reports whether the server is running and every health check passes
+func (s *Server) Healthy() bool {
+	ctx, cancel := context.WithTimeout(s.ctx, defaultHealthTimeout)
+	defer cancel()
+	return s.CheckHealth(ctx).Healthy
+}
+
+// Failures returns "name: error" for every failed check, sorted by name
+func (r HealthReport) Failures() []string {
+	var failures []string
+	for name, err := range r.Checks {
+		if err != nil {
+			failures = append(failures, name+": "+err.Error())
+		}
+	}
+	sort.Strings(failures)
+	return failures
+}
+
+// handleHealthCheck implements HEALTHCHECK, replying +OK or an error naming the failed checks
+func (s *Server) handleHealthCheck(conn *Connection, cmd *Command) RedisValue {
+	ctx, cancel := context.WithTimeout(conn.ctx, defaultHealthTimeout)
+	defer cancel()
+	report := s.CheckHealth(ctx)
+	if !report.Healthy {
+		failures := report.Failures()
+		if len(failures) == 0 {
+			failures = []string{"server shutting down"}
+		}
+		return NewError(ErrPrefixGeneric, "unhealthy: %s", strings.Join(failures, "; ")).Value()
+	}
+	return RedisValue{Type: SimpleString, Str: "OK"}
+}
+
+// writeHealthReport writes a plain-text health report for the admin endpoint
+func writeHealthReport(w http.ResponseWriter, report HealthReport) {
+	names := make([]string, 0, len(report.Checks))
+	for name := range report.Checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if !report.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	for _, name := range names {
+		if err := report.Checks[name]; err != nil {
+			fmt.Fprintf(w, "%s: %v\n", name, err)
+		} else {
+			fmt.Fprintf(w, "%s: ok\n", name)
+		}
+	}
+	if report.Healthy {
+		fmt.Fprintln(w, "ok")
+	}
+}
@@ -0,0 +1,75 @@
+package redkit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHealthChecks(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	client := dialRaw(t, address)
+
+	client.send(t, "HEALTHCHECK")
+	if line := client.readLine(t); line != "+OK" {
+		t.Fatalf("Expected +OK without checks, got %q", line)
+	}
+
+	if err := server.RegisterHealthCheck("", func(ctx context.Context) error { return nil }); err == nil || err.Error() != "empty health check name" {
+		t.Errorf("Expected an error for an empty name, got %v", err)
+	}
+	if err := server.RegisterHealthCheck("storage", nil); err == nil || err.Error() != "nil health check storage" {
+		t.Errorf("Expected an error for a nil check, got %v", err)
+	}
+
+	var storageErr error
+	server.RegisterHealthCheck("storage", func(ctx context.Context) error { return storageErr })
+	server.RegisterHealthCheck("replication", func(ctx context.Context) error { return nil })
+	if !server.Healthy() {
+		t.Fatal("Expected server to be healthy")
+	}
+
+	storageErr = errors.New("disk unavailable")
+	if server.Healthy() {
+		t.Fatal("Expected server to be unhealthy")
+	}
+	client.send(t, "HEALTHCHECK")
+	if line := client.readLine(t); line != "-ERR unhealthy: storage: disk unavailable" {
+		t.Errorf("Unexpected HEALTHCHECK reply %q", line)
+	}
+
+	admin := httptest.NewServer(server.AdminHandler())
+	defer admin.Close()
+	resp, err := http.Get(admin.URL + "/readyz")
+	if err != nil {
+		t.Fatalf("GET /readyz failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || !strings.Contains(string(body), "storage: disk unavailable") {
+		t.Errorf("Unexpected /readyz response %d %q", resp.StatusCode, body)
+	}
+}
+
+func TestCheckHealthTimeout(t *testing.T) {
+	server := NewServer(":0", WithLogger(NewDefaultLogger(nil, LogLevelOff)))
+	defer server.cancel()
+
+	server.RegisterHealthCheck("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	report := server.CheckHealth(ctx)
+	if report.Healthy || !errors.Is(report.Checks["slow"], context.DeadlineExceeded) {
+		t.Errorf("Expected the slow check to time out, got %+v", report)
+	}
+}
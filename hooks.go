@@ -0,0 +1,248 @@
+package redkit
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+)
+
+// Reasons reported in DisconnectInfo for connections closed by the server
+var (
+	ErrServerClosed = errors.New("redkit: server closed")
+	ErrIdleTimeout  = errors.New("redkit: idle timeout")
+	ErrClientQuit   = errors.New("redkit: client sent QUIT")
+	ErrClientKilled = errors.New("redkit: killed by CLIENT KILL")
+	// ErrSlowSubscriber is reported for subscribers disconnected because
+	// more than ServerConfig.PubSubBuffer messages published to them
+	// waited to be written
+	ErrSlowSubscriber = errors.New("redkit: subscriber falling behind")
+)
+
+// ErrClientDisconnected is the cause of a command context cancelled because
+// the client hung up while the command was running (see CancelOnDisconnect)
+var ErrClientDisconnected = errors.New("redkit: client disconnected")
+
+// PanicError is reported to OnError and OnPanic when a command handler
+// panics. The client gets an "ERR internal error" reply.
+type PanicError struct {
+	Command string // name of the command, as sent by the client
+	Value   any    // value passed to panic
+	Stack   []byte // stack trace of the panicking goroutine
+}
+
+// Error implements the error interface
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic in command handler '%s': %v", e.Command, e.Value)
+}
+
+// errInternal is the reply to a command whose handler panicked
+var errInternal = NewError(ErrPrefixGeneric, "internal error")
+
+// ErrorPhase tells where in the request cycle an error reported to OnError happened
+type ErrorPhase int
+
+const (
+	ErrorPhaseRead     ErrorPhase = iota // reading a command failed, e.g. a network error or timeout
+	ErrorPhaseProtocol                   // the client sent a malformed RESP frame
+	ErrorPhaseHandler                    // a command handler panicked
+	ErrorPhaseWrite                      // writing or flushing a reply failed
+)
+
+// String returns the lowercase name of the phase
+func (p ErrorPhase) String() string {
+	switch p {
+	case ErrorPhaseRead:
+		return "read"
+	case ErrorPhaseProtocol:
+		return "protocol"
+	case ErrorPhaseHandler:
+		return "handler"
+	case ErrorPhaseWrite:
+		return "write"
+	default:
+		return "unknown"
+	}
+}
+
+// DisconnectInfo describes a connection that was torn down
+type DisconnectInfo struct {
+	Duration time.Duration // time since the connection was accepted
+	Commands uint64        // number of commands executed
+	// Reason tells why the connection ended: io.EOF when the client hung up,
+	// ErrServerClosed, ErrIdleTimeout, ErrClientQuit, ErrClientKilled, the error
+	// returned by an OnConnect hook, or the read or write error that broke the
+	// connection.
+	Reason error
+}
+
+// OnConnect registers a function called for every accepted connection before it
+// reads its first command (after the TLS handshake). Returning an error rejects
+// the connection: the error is sent to the client as an error reply and the
+// connection is closed. Hooks run in registration order; the first error wins.
+func (s *Server) OnConnect(fn func(conn *Connection) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onConnect = append(s.onConnect, fn)
+}
+
+// OnDisconnect registers a function called when a connection is torn down,
+// including connections rejected by an OnConnect hook
+func (s *Server) OnDisconnect(fn func(conn *Connection, info DisconnectInfo)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onDisconnect = append(s.onDisconnect, fn)
+}
+
+// runConnectHooks calls the OnConnect hooks, returning the first error
+func (s *Server) runConnectHooks(conn *Connection) error {
+	s.mu.RLock()
+	hooks := s.onConnect
+	s.mu.RUnlock()
+
+	for _, fn := range hooks {
+		if err := fn(conn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runDisconnectHooks calls the OnDisconnect hooks for a closed connection
+func (s *Server) runDisconnectHooks(conn *Connection) {
+	s.mu.RLock()
+	hooks := s.onDisconnect
+	s.mu.RUnlock()
+	if len(hooks) == 0 {
+		return
+	}
+
+	info := DisconnectInfo{
+		Duration: time.Since(conn.created),
+		Commands: conn.commands.Load(),
+		Reason:   conn.closeReason(),
+	}
+	for _, fn := range hooks {
+		fn(conn, info)
+	}
+}
+
+// OnError registers a function called on read errors, protocol violations,
+// handler panics and write errors, so applications can count, alert or close
+// clients based on error patterns. It runs on the connection's goroutine and may
+// call conn.Close. A client hanging up cleanly is not reported. Handler panics
+// are reported as a *PanicError carrying the stack trace.
+func (s *Server) OnError(fn func(conn *Connection, phase ErrorPhase, err error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onError = append(s.onError, fn)
+}
+
+// OnPanic registers a function called when a command handler panics, before
+// the error reply is sent, e.g. to report the stack trace to a crash tracker.
+// Handlers panicking with a *RedisError are not reported: that is a way to
+// reply with an error.
+func (s *Server) OnPanic(fn func(conn *Connection, cmd *Command, err *PanicError)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onPanic = append(s.onPanic, fn)
+}
+
+// OnListenerError registers a function called when the listener fails
+// permanently and Serve is about to return, e.g. to restart it or exit
+func (s *Server) OnListenerError(fn func(err error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onListenerError = append(s.onListenerError, fn)
+}
+
+func (s *Server) runListenerErrorHooks(err error) {
+	s.mu.RLock()
+	hooks := s.onListenerError
+	s.mu.RUnlock()
+
+	for _, fn := range hooks {
+		fn(err)
+	}
+}
+
+// BeforeCommand registers a function called before every command is
+// dispatched, including commands that are then rejected, e.g. for an audit
+// trail. Unlike middleware it can't change the command or its reply. It runs
+// on the connection's goroutine, so it should be quick. A panic in it, or in
+// an AfterCommand hook, is logged and reported to the OnPanic hooks.
+func (s *Server) BeforeCommand(fn func(conn *Connection, cmd *Command)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.beforeCommand = append(s.beforeCommand, fn)
+}
+
+// AfterCommand registers a function called with the reply to every command
+// and how long it took, e.g. to record metrics. It also runs when the handler
+// panicked, with the error reply sent instead. The reply must not be modified.
+func (s *Server) AfterCommand(fn func(conn *Connection, cmd *Command, reply RedisValue, duration time.Duration)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.afterCommand = append(s.afterCommand, fn)
+}
+
+// runBeforeCommandHooks calls the BeforeCommand hooks and returns the
+// function calling the AfterCommand hooks, or nil if there are none
+func (s *Server) runBeforeCommandHooks(conn *Connection, cmd *Command) func(RedisValue) {
+	s.mu.RLock()
+	before, after := s.beforeCommand, s.afterCommand
+	s.mu.RUnlock()
+
+	for _, fn := range before {
+		s.runCommandHook(conn, cmd, func() { fn(conn, cmd) })
+	}
+	if len(after) == 0 {
+		return nil
+	}
+	start := time.Now()
+	return func(reply RedisValue) {
+		duration := time.Since(start)
+		for _, fn := range after {
+			s.runCommandHook(conn, cmd, func() { fn(conn, cmd, reply, duration) })
+		}
+	}
+}
+
+// runCommandHook calls a BeforeCommand or AfterCommand hook, logging a panic
+// and reporting it to the OnPanic hooks rather than crashing the server
+func (s *Server) runCommandHook(conn *Connection, cmd *Command, hook func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicErr := &PanicError{Command: cmd.Name, Value: r, Stack: debug.Stack()}
+			s.logConn(LogLevelError, conn, "Panic in command hook", slog.String("cmd", cmd.Name), slog.Any("panic", r), slog.String("stack", string(panicErr.Stack)))
+			s.runPanicHooks(conn, cmd, panicErr)
+			s.reportError(conn, ErrorPhaseHandler, panicErr)
+		}
+	}()
+	hook()
+}
+
+// runPanicHooks calls the OnPanic hooks
+func (s *Server) runPanicHooks(conn *Connection, cmd *Command, err *PanicError) {
+	s.mu.RLock()
+	hooks := s.onPanic
+	s.mu.RUnlock()
+
+	for _, fn := range hooks {
+		fn(conn, cmd, err)
+	}
+}
+
+// reportError calls the OnError hooks
+func (s *Server) reportError(conn *Connection, phase ErrorPhase, err error) {
+	s.stats.errors.Add(1)
+
+	s.mu.RLock()
+	hooks := s.onError
+	s.mu.RUnlock()
+
+	for _, fn := range hooks {
+		fn(conn, phase, err)
+	}
+}
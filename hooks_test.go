@@ -0,0 +1,234 @@
+package redkit
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOnConnectRejects(t *testing.T) {
+	server, address := startTestServer(t, nil)
+
+	disconnected := make(chan DisconnectInfo, 1)
+	server.OnConnect(func(conn *Connection) error {
+		return NewError(ErrPrefixNoAuth, "connections from this host are not allowed")
+	})
+	server.OnDisconnect(func(conn *Connection, info DisconnectInfo) {
+		disconnected <- info
+	})
+
+	client := dialRaw(t, address)
+	if line := client.readLine(t); line != "-NOAUTH connections from this host are not allowed" {
+		t.Fatalf("Unexpected rejection reply %q", line)
+	}
+	client.expectClosed(t)
+
+	info := <-disconnected
+	var redisErr *RedisError
+	if !errors.As(info.Reason, &redisErr) || redisErr.Prefix != ErrPrefixNoAuth {
+		t.Errorf("Expected the hook error as reason, got %v", info.Reason)
+	}
+}
+
+func TestOnDisconnectInfo(t *testing.T) {
+	server, address := startTestServer(t, nil)
+
+	connected := make(chan uint64, 1)
+	disconnected := make(chan DisconnectInfo, 1)
+	server.OnConnect(func(conn *Connection) error {
+		connected <- conn.ID()
+		return nil
+	})
+	server.OnDisconnect(func(conn *Connection, info DisconnectInfo) {
+		disconnected <- info
+	})
+
+	client := dialRaw(t, address)
+	for i := 0; i < 3; i++ {
+		client.send(t, "PING")
+		client.readLine(t)
+	}
+	<-connected
+	client.conn.Close()
+
+	select {
+	case info := <-disconnected:
+		if info.Commands != 3 {
+			t.Errorf("Expected 3 commands, got %d", info.Commands)
+		}
+		if info.Duration <= 0 {
+			t.Errorf("Expected a positive duration, got %v", info.Duration)
+		}
+		if !errors.Is(info.Reason, io.EOF) {
+			t.Errorf("Expected io.EOF as reason, got %v", info.Reason)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for OnDisconnect")
+	}
+}
+
+func TestOnDisconnectQuitAndShutdown(t *testing.T) {
+	server, address := startTestServer(t, nil)
+
+	reasons := make(chan error, 2)
+	server.OnDisconnect(func(conn *Connection, info DisconnectInfo) {
+		reasons <- info.Reason
+	})
+
+	quitter := dialRaw(t, address)
+	quitter.send(t, "QUIT")
+	if reason := <-reasons; !errors.Is(reason, ErrClientQuit) {
+		t.Errorf("Expected ErrClientQuit, got %v", reason)
+	}
+
+	idle := dialRaw(t, address)
+	idle.send(t, "PING")
+	idle.readLine(t)
+	server.Shutdown(t.Context())
+	if reason := <-reasons; !errors.Is(reason, ErrServerClosed) {
+		t.Errorf("Expected ErrServerClosed, got %v", reason)
+	}
+}
+
+type reportedError struct {
+	phase ErrorPhase
+	err   error
+}
+
+func TestOnErrorPhases(t *testing.T) {
+	server, address := startTestServer(t, nil)
+
+	reported := make(chan reportedError, 4)
+	server.OnError(func(conn *Connection, phase ErrorPhase, err error) {
+		reported <- reportedError{phase, err}
+	})
+	server.RegisterCommandFunc("CRASH", func(conn *Connection, cmd *Command) RedisValue {
+		panic("boom")
+	})
+
+	client := dialRaw(t, address)
+	client.send(t, "CRASH")
+	got := <-reported
+	if got.phase != ErrorPhaseHandler || got.err == nil {
+		t.Errorf("Expected a handler error, got %v %v", got.phase, got.err)
+	}
+	client.readLine(t)
+
+	client.sendRaw(t, "*1\r\n$x\r\n")
+	got = <-reported
+	var protoErr *ProtocolError
+	if got.phase != ErrorPhaseProtocol || !errors.As(got.err, &protoErr) {
+		t.Errorf("Expected a protocol error, got %v %v", got.phase, got.err)
+	}
+	client.expectClosed(t)
+
+	// A clean disconnect is not an error
+	quiet := dialRaw(t, address)
+	quiet.send(t, "PING")
+	quiet.readLine(t)
+	quiet.conn.Close()
+	select {
+	case got := <-reported:
+		t.Errorf("Unexpected error report %v %v", got.phase, got.err)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestErrorPhaseString(t *testing.T) {
+	if ErrorPhaseWrite.String() != "write" || ErrorPhase(42).String() != "unknown" {
+		t.Errorf("Unexpected phase names %q %q", ErrorPhaseWrite, ErrorPhase(42))
+	}
+}
+
+func TestHandlerPanicReplies(t *testing.T) {
+	server, address := startTestServer(t, nil)
+
+	panics := make(chan *PanicError, 1)
+	server.OnPanic(func(conn *Connection, cmd *Command, err *PanicError) {
+		panics <- err
+	})
+	reported := make(chan error, 1)
+	server.OnError(func(conn *Connection, phase ErrorPhase, err error) {
+		reported <- err
+	})
+	server.RegisterCommandFunc("CRASH", func(conn *Connection, cmd *Command) RedisValue {
+		panic("boom")
+	})
+
+	client := dialRaw(t, address)
+	client.send(t, "CRASH")
+	if line := client.readLine(t); line != "-ERR internal error" {
+		t.Errorf("Expected -ERR internal error, got %q", line)
+	}
+	got := <-panics
+	if got.Command != "CRASH" || got.Value != "boom" || !strings.Contains(string(got.Stack), "TestHandlerPanicReplies") {
+		t.Errorf("Unexpected panic report %+v", got)
+	}
+	var panicErr *PanicError
+	if err := <-reported; !errors.As(err, &panicErr) || len(panicErr.Stack) == 0 {
+		t.Errorf("Expected a PanicError with a stack, got %v", err)
+	}
+
+	// The connection keeps serving commands
+	client.send(t, "PING")
+	if line := client.readLine(t); line != "+PONG" {
+		t.Errorf("Expected +PONG, got %q", line)
+	}
+}
+
+func TestBeforeAfterCommand(t *testing.T) {
+	server := NewServer(":0")
+	server.RegisterCommandFunc("CRASH", func(conn *Connection, cmd *Command) RedisValue {
+		panic("boom")
+	})
+
+	var before, after []string
+	server.BeforeCommand(func(conn *Connection, cmd *Command) {
+		before = append(before, cmd.Name)
+	})
+	server.AfterCommand(func(conn *Connection, cmd *Command, reply RedisValue, duration time.Duration) {
+		if duration < 0 {
+			t.Errorf("Unexpected duration %v", duration)
+		}
+		after = append(after, cmd.Name+"="+reply.Str)
+	})
+
+	for _, name := range []string{"PING", "NOPE", "CRASH"} {
+		server.handleCommand(nil, &Command{Name: name})
+	}
+
+	if strings.Join(before, ",") != "PING,NOPE,CRASH" {
+		t.Errorf("Unexpected BeforeCommand calls %v", before)
+	}
+	expected := "PING=PONG,NOPE=ERR unknown command 'NOPE', with args beginning with: ,CRASH=ERR internal error"
+	if strings.Join(after, ",") != expected {
+		t.Errorf("Expected AfterCommand calls %s, got %v", expected, after)
+	}
+}
+
+func TestCommandHookPanics(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	panics := make(chan *PanicError, 4)
+	server.OnPanic(func(conn *Connection, cmd *Command, err *PanicError) {
+		panics <- err
+	})
+	server.BeforeCommand(func(conn *Connection, cmd *Command) {
+		panic("before")
+	})
+	server.AfterCommand(func(conn *Connection, cmd *Command, reply RedisValue, duration time.Duration) {
+		panic("after")
+	})
+
+	// The command still runs and the server keeps serving
+	client := dialRaw(t, address)
+	client.send(t, "PING")
+	client.send(t, "ECHO", "x")
+	expectLines(t, client, "+PONG", "$1", "x")
+	for _, expected := range []string{"before", "after"} {
+		if got := <-panics; got.Command != "PING" || got.Value != expected {
+			t.Errorf("Expected the %s hook to panic on PING, got %+v", expected, got)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package redkit
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/l00pss/redkit/store"
+)
+
+// infoField is a line of an INFO section
+type infoField struct {
+	name, value string
+}
+
+// infoSection is a section of INFO and the function reading its fields
+type infoSection struct {
+	name string
+	// byDefault tells whether a bare INFO reports the section, rather than
+	// only INFO all or naming it
+	byDefault bool
+	fields    func(s *Server) []infoField
+}
+
+// infoSections are the sections of INFO in the order it reports them
+var infoSections = []infoSection{
+	{name: "server", byDefault: true, fields: (*Server).infoServer},
+	{name: "clients", byDefault: true, fields: (*Server).infoClients},
+	{name: "memory", byDefault: true, fields: (*Server).infoMemory},
+	{name: "stats", byDefault: true, fields: (*Server).infoStats},
+	{name: "keyspace", byDefault: true, fields: (*Server).infoKeyspace},
+}
+
+// handleInfo implements INFO [section [section ...]]. A section can also be
+// "default", "all" or "everything" as in Redis; sections that don't exist
+// are left out.
+func (s *Server) handleInfo(conn *Connection, cmd *Command) RedisValue {
+	names := cmd.Args
+	if len(names) == 0 {
+		names = []string{"default"}
+	}
+	wanted := make(map[string]bool)
+	all := false
+	for _, name := range names {
+		switch name = strings.ToLower(name); name {
+		case "all", "everything":
+			all = true
+		case "default":
+			for _, section := range infoSections {
+				wanted[section.name] = wanted[section.name] || section.byDefault
+			}
+		default:
+			wanted[name] = true
+		}
+	}
+
+	var b strings.Builder
+	for _, section := range infoSections {
+		if !all && !wanted[section.name] {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\r\n")
+		}
+		fmt.Fprintf(&b, "# %s\r\n", strings.ToUpper(section.name[:1])+section.name[1:])
+		for _, field := range section.fields(s) {
+			fmt.Fprintf(&b, "%s:%s\r\n", field.name, field.value)
+		}
+	}
+	return RedisValue{Type: Verbatim, Str: b.String(), Format: VerbatimText}
+}
+
+func (s *Server) infoServer() []infoField {
+	uptime := time.Since(s.stats.started)
+	port := "0"
+	if s.netListener != nil {
+		if addr, ok := s.netListener.Addr().(*net.TCPAddr); ok {
+			port = strconv.Itoa(addr.Port)
+		}
+	}
+	return []infoField{
+		{"redis_mode", "standalone"},
+		{"os", runtime.GOOS},
+		{"arch_bits", strconv.Itoa(strconv.IntSize)},
+		{"go_version", runtime.Version()},
+		{"process_id", strconv.Itoa(os.Getpid())},
+		{"tcp_port", port},
+		{"uptime_in_seconds", strconv.FormatInt(int64(uptime/time.Second), 10)},
+		{"uptime_in_days", strconv.FormatInt(int64(uptime/(24*time.Hour)), 10)},
+	}
+}
+
+func (s *Server) infoClients() []infoField {
+	return []infoField{
+		{"connected_clients", strconv.FormatInt(s.connCount.Load(), 10)},
+		{"maxclients", strconv.Itoa(s.maxConnections())},
+	}
+}
+
+// infoMemory reports the numbers of MEMORY STATS, leaving out the dataset
+// when the storage doesn't account for its memory or fails to
+func (s *Server) infoMemory() []infoField {
+	report, err := s.memoryReport()
+	if err != nil {
+		report.dataset = false
+	}
+	fields := []infoField{
+		{"used_memory", strconv.FormatUint(report.used, 10)},
+		{"used_memory_human", humanBytes(report.used)},
+		{"used_memory_rss", strconv.FormatUint(report.rss, 10)},
+		{"used_memory_rss_human", humanBytes(report.rss)},
+		{"used_memory_peak", strconv.FormatUint(report.peak, 10)},
+		{"used_memory_peak_human", humanBytes(report.peak)},
+		{"used_memory_peak_perc", fmt.Sprintf("%.2f%%", report.peakPercentage())},
+		{"used_memory_startup", strconv.FormatUint(report.startup, 10)},
+	}
+	if report.dataset {
+		fields = append(fields,
+			infoField{"used_memory_overhead", strconv.FormatInt(int64(report.startup)+report.store.Overhead, 10)},
+			infoField{"used_memory_dataset", strconv.FormatInt(report.datasetBytes(), 10)},
+			infoField{"used_memory_dataset_perc", fmt.Sprintf("%.2f%%", report.datasetPercentage())},
+		)
+	}
+	var lazy store.LazyFreeStats
+	lazyFree := false
+	s.distinctDatabases(func(index int, db *database) {
+		if db.lazy != nil {
+			stats := db.lazy.LazyFreeStats()
+			lazy.Pending += stats.Pending
+			lazy.Freed += stats.Freed
+			lazyFree = true
+		}
+	})
+	if lazyFree {
+		fields = append(fields,
+			infoField{"lazyfree_pending_objects", strconv.Itoa(lazy.Pending)},
+			infoField{"lazyfreed_objects", strconv.FormatUint(lazy.Freed, 10)},
+		)
+	}
+	return append(fields,
+		infoField{"mem_fragmentation_ratio", fmt.Sprintf("%.2f", report.fragmentation())},
+		infoField{"mem_fragmentation_bytes", strconv.FormatInt(int64(report.rss)-int64(report.used), 10)},
+		infoField{"mem_allocator", "go"},
+	)
+}
+
+func (s *Server) infoStats() []infoField {
+	stats := s.Stats()
+	return []infoField{
+		{"total_connections_received", strconv.FormatUint(stats.TotalConnections, 10)},
+		{"total_commands_processed", strconv.FormatUint(stats.CommandsProcessed, 10)},
+		{"instantaneous_ops_per_sec", strconv.FormatInt(int64(stats.CommandsPerSecond), 10)},
+		{"total_net_input_bytes", strconv.FormatUint(stats.BytesIn, 10)},
+		{"total_net_output_bytes", strconv.FormatUint(stats.BytesOut, 10)},
+		{"rejected_connections", strconv.FormatUint(stats.RejectedConnections, 10)},
+		{"expired_keys", strconv.FormatUint(stats.ExpiredKeys, 10)},
+		{"total_error_replies", strconv.FormatUint(stats.ErrorReplies, 10)},
+		{"pubsub_channels", strconv.Itoa(len(s.Channels()))},
+		{"pubsub_patterns", strconv.Itoa(s.NumPat())},
+		{"pubsub_shardchannels", strconv.Itoa(len(s.pubsub.names(shardKind, "")))},
+	}
+}
+
+// infoKeyspace reports the keys of every database holding any, with those
+// having an expiration when the storage accounts for them
+func (s *Server) infoKeyspace() []infoField {
+	var fields []infoField
+	s.distinctDatabases(func(index int, db *database) {
+		if db.flush == nil {
+			return
+		}
+		keys, expires := db.flush.Len(), 0
+		if keys == 0 {
+			return
+		}
+		if db.memory != nil {
+			if stats, err := db.memory.MemoryStats(); err == nil {
+				expires = stats.Expires
+			}
+		}
+		fields = append(fields, infoField{"db" + strconv.Itoa(index), fmt.Sprintf("keys=%d,expires=%d", keys, expires)})
+	})
+	return fields
+}
@@ -0,0 +1,102 @@
+package redkit
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// parseInfo returns the sections of an INFO reply and their fields
+func parseInfo(t *testing.T, info string) map[string]map[string]string {
+	t.Helper()
+	sections := make(map[string]map[string]string)
+	var section map[string]string
+	for _, line := range strings.Split(info, "\r\n") {
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "# "):
+			section = make(map[string]string)
+			sections[line[2:]] = section
+		default:
+			name, value, ok := strings.Cut(line, ":")
+			if !ok || section == nil {
+				t.Fatalf("Unexpected INFO line %q", line)
+			}
+			section[name] = value
+		}
+	}
+	return sections
+}
+
+func TestInfo(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	rdb := redis.NewClient(&redis.Options{Addr: address, Protocol: 2})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	info, err := rdb.Info(ctx).Result()
+	if err != nil {
+		t.Fatalf("INFO failed: %v", err)
+	}
+	sections := parseInfo(t, info)
+	for _, name := range []string{"Server", "Clients", "Memory", "Stats"} {
+		if sections[name] == nil {
+			t.Errorf("Expected a %s section, got %q", name, info)
+		}
+	}
+	port := address[strings.LastIndex(address, ":")+1:]
+	if got := sections["Server"]["tcp_port"]; got != port {
+		t.Errorf("Expected tcp_port %s, got %s", port, got)
+	}
+	if got := sections["Clients"]["connected_clients"]; got != "1" {
+		t.Errorf("Expected 1 connected client, got %s", got)
+	}
+	if used, err := strconv.ParseUint(sections["Memory"]["used_memory"], 10, 64); err != nil || used == 0 {
+		t.Errorf("Expected the used memory, got %q", sections["Memory"]["used_memory"])
+	}
+	if _, ok := sections["Memory"]["used_memory_dataset"]; ok {
+		t.Error("Expected no dataset without a storage accounting for its memory")
+	}
+
+	server.EnableBuiltinStore()
+	info, err = rdb.Info(ctx, "memory", "CLIENTS", "nope").Result()
+	if err != nil {
+		t.Fatalf("INFO memory clients failed: %v", err)
+	}
+	sections = parseInfo(t, info)
+	if len(sections) != 2 || sections["Memory"] == nil || sections["Clients"] == nil {
+		t.Errorf("Expected the memory and clients sections, got %q", info)
+	}
+	if _, ok := sections["Memory"]["used_memory_dataset"]; !ok {
+		t.Errorf("Expected the dataset of the built-in store, got %q", info)
+	}
+
+	info, err = rdb.Info(ctx, "everything").Result()
+	if err != nil || len(parseInfo(t, info)) != len(infoSections) {
+		t.Errorf("Expected every section, got %q, %v", info, err)
+	}
+}
+
+func TestHumanBytes(t *testing.T) {
+	tests := []struct {
+		n        uint64
+		expected string
+	}{
+		{0, "0B"},
+		{1023, "1023B"},
+		{1024, "1.00K"},
+		{1536, "1.50K"},
+		{5 << 20, "5.00M"},
+		{3 << 30, "3.00G"},
+		{2 << 50, "2.00P"},
+		{2048 << 50, "2048.00P"},
+	}
+	for _, tt := range tests {
+		if got := humanBytes(tt.n); got != tt.expected {
+			t.Errorf("humanBytes(%d) = %s, expected %s", tt.n, got, tt.expected)
+		}
+	}
+}
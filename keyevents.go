@@ -0,0 +1,195 @@
+package redkit
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Key events that happen to keys other than by a command writing them in
+// place, named as in Redis' keyspace notifications and published as such
+// when ServerConfig.KeyspaceEvents enables them
+const (
+	// KeyEventExpired is reported for keys removed because they expired,
+	// whether found so by the background cycles of the built-in store or by
+	// a write, and for keys of the Expirer once their time comes
+	KeyEventExpired = "expired"
+	// KeyEventRenameFrom and KeyEventRenameTo are reported for the source
+	// and the destination of RENAME and RENAMENX
+	KeyEventRenameFrom = "rename_from"
+	KeyEventRenameTo   = "rename_to"
+	// KeyEventCopyTo is reported for the destination of COPY
+	KeyEventCopyTo = "copy_to"
+	// KeyEventMoveFrom and KeyEventMoveTo are reported for a key MOVE takes
+	// out of its database and puts into another
+	KeyEventMoveFrom = "move_from"
+	KeyEventMoveTo   = "move_to"
+	// KeyEventWrite is reported for keys written outside of a command, by a
+	// handler calling KeysWritten without a connection
+	KeyEventWrite = "write"
+)
+
+// OnKeyEvent registers a function called for every key a command writes,
+// with the database, the lower-case name of the command as the event and
+// the key, and for the key events above. Applications embedding the server
+// use it to react to changes in-process, such as to invalidate a cache or
+// capture changes, without subscribing over the network. It runs on the
+// goroutine that wrote the key, once the write is done.
+func (s *Server) OnKeyEvent(fn func(db int, event, key string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onKeyEvent = append(s.onKeyEvent, fn)
+}
+
+// keyspaceFlags selects the key events published as keyspace notifications,
+// parsed from the letters of ServerConfig.KeyspaceEvents
+type keyspaceFlags uint16
+
+const (
+	keyspaceChannel keyspaceFlags = 1 << iota // K: __keyspace@<db>__:<key>
+	keyeventChannel                           // E: __keyevent@<db>__:<event>
+	genericEvents                             // g: DEL, EXPIRE, RENAME, COPY, MOVE...
+	stringEvents                              // $
+	listEvents                                // l
+	setEvents                                 // s
+	hashEvents                                // h
+	zsetEvents                                // z
+	expiredEvents                             // x
+	streamEvents                              // t
+
+	allEvents = genericEvents | stringEvents | listEvents | setEvents | hashEvents | zsetEvents | expiredEvents | streamEvents // A
+)
+
+// parseKeyspaceEvents parses the letters of notify-keyspace-events,
+// ignoring those of event classes the server doesn't report
+func parseKeyspaceEvents(letters string) keyspaceFlags {
+	var flags keyspaceFlags
+	for _, letter := range letters {
+		switch letter {
+		case 'K':
+			flags |= keyspaceChannel
+		case 'E':
+			flags |= keyeventChannel
+		case 'g':
+			flags |= genericEvents
+		case '$':
+			flags |= stringEvents
+		case 'l':
+			flags |= listEvents
+		case 's':
+			flags |= setEvents
+		case 'h':
+			flags |= hashEvents
+		case 'z':
+			flags |= zsetEvents
+		case 'x':
+			flags |= expiredEvents
+		case 't':
+			flags |= streamEvents
+		case 'A':
+			flags |= allEvents
+		}
+	}
+	return flags
+}
+
+// eventClass returns the class of a key event: the type of data of the
+// command named by the event, or generic for commands working on keys of
+// any type, those of no data type, and the key events above but expired
+func (s *Server) eventClass(event string) keyspaceFlags {
+	switch event {
+	case KeyEventExpired:
+		return expiredEvents
+	case KeyEventRenameFrom, KeyEventRenameTo, KeyEventCopyTo, KeyEventMoveFrom, KeyEventMoveTo, KeyEventWrite:
+		return genericEvents
+	}
+	if _, entry, ok := s.handlerTable().lookup(event); ok {
+		for _, category := range entry.info.ACLCategories {
+			switch category {
+			case "string":
+				return stringEvents
+			case "list":
+				return listEvents
+			case "set":
+				return setEvents
+			case "hash":
+				return hashEvents
+			case "sortedset":
+				return zsetEvents
+			case "stream":
+				return streamEvents
+			}
+		}
+	}
+	return genericEvents
+}
+
+// notifyKeyspace publishes event on keys of database db to the keyspace
+// and keyevent channels ServerConfig.KeyspaceEvents enables, as Redis does
+func (s *Server) notifyKeyspace(db int, event string, keys []string) {
+	if s.KeyspaceEvents == "" {
+		return
+	}
+	flags := parseKeyspaceEvents(s.KeyspaceEvents)
+	if flags&(keyspaceChannel|keyeventChannel) == 0 || flags&s.eventClass(event) == 0 {
+		return
+	}
+
+	prefix := "@" + strconv.Itoa(db) + "__:"
+	for _, key := range keys {
+		if flags&keyspaceChannel != 0 {
+			s.publish(channelKind, "__keyspace"+prefix+key, []byte(event))
+		}
+		if flags&keyeventChannel != 0 {
+			s.publish(channelKind, "__keyevent"+prefix+event, []byte(key))
+		}
+	}
+}
+
+// runKeyEventHooks calls the OnKeyEvent hooks for keys of database db
+func (s *Server) runKeyEventHooks(db int, event string, keys []string) {
+	s.mu.RLock()
+	hooks := s.onKeyEvent
+	s.mu.RUnlock()
+
+	for _, fn := range hooks {
+		for _, key := range keys {
+			fn(db, event, key)
+		}
+	}
+}
+
+// writeEvent returns the key event of the keys conn's command writes
+func writeEvent(conn *Connection) string {
+	if conn == nil || conn.running == "" {
+		return KeyEventWrite
+	}
+	return strings.ToLower(conn.running)
+}
+
+// keyEvent reports that event happened to keys of database db: the
+// transactions watching them are aborted and the clients tracking them are
+// sent invalidations, as when a command writes them
+func (s *Server) keyEvent(db int, event string, keys ...string) {
+	s.keyEventBy(nil, db, event, keys...)
+}
+
+// keyEventBy is keyEvent for an event caused by a command of conn, which
+// NOLOOP tracking leaves out of the invalidations. Keys given a value wake
+// the connections blocked on them.
+func (s *Server) keyEventBy(conn *Connection, db int, event string, keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+	switch event {
+	case KeyEventExpired:
+		s.stats.expiredKeys.Add(uint64(len(keys)))
+	case KeyEventRenameTo, KeyEventCopyTo, KeyEventMoveTo:
+		for _, key := range keys {
+			s.SignalKey(db, key)
+		}
+	}
+	s.TouchKey(db, keys...)
+	s.NotifyKeyModifiedBy(conn, keys...)
+	s.runKeyEventHooks(db, event, keys)
+	s.notifyKeyspace(db, event, keys)
+}
@@ -0,0 +1,129 @@
+package redkit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// keyEventCall is a call of an OnKeyEvent hook
+type keyEventCall struct {
+	db         int
+	event, key string
+}
+
+func TestOnKeyEvent(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	server.EnableBuiltinStore()
+	events := make(chan keyEventCall, 16)
+	server.OnKeyEvent(func(db int, event, key string) {
+		events <- keyEventCall{db, event, key}
+	})
+	client := dialRaw(t, address)
+
+	commands := [][]string{
+		{"SET", "a", "1"},
+		{"DEL", "missing"},
+		{"SELECT", "2"},
+		{"HSET", "h", "f", "v"},
+		{"MULTI"},
+		{"INCR", "n"},
+		{"EXEC"},
+		{"RENAME", "n", "m"},
+		{"SET", "short", "v", "PX", "1"},
+	}
+	for _, args := range commands {
+		client.send(t, args...)
+		client.readLine(t)
+	}
+	client.readLine(t) // the reply of INCR in the array of EXEC
+
+	expected := []keyEventCall{
+		{0, "set", "a"},
+		{2, "hset", "h"},
+		{2, "incr", "n"},
+		{2, KeyEventRenameFrom, "n"},
+		{2, KeyEventRenameTo, "m"},
+		{2, "set", "short"},
+		{2, KeyEventExpired, "short"},
+	}
+	for _, want := range expected {
+		select {
+		case got := <-events:
+			if got != want {
+				t.Errorf("Expected %+v, got %+v", want, got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected %+v, got nothing", want)
+		}
+	}
+
+	server.KeysWritten(nil, "seeded")
+	if got := <-events; got != (keyEventCall{0, KeyEventWrite, "seeded"}) {
+		t.Errorf("Expected a write without a command, got %+v", got)
+	}
+}
+
+// TestKeyspaceNotifications tests that key events are published to the
+// keyspace and keyevent channels of the classes KeyspaceEvents selects
+func TestKeyspaceNotifications(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		letters string
+		want    [][2]string // channel and payload
+	}{
+		{"KEA", [][2]string{
+			{"__keyspace@0__:a", "set"},
+			{"__keyevent@0__:set", "a"},
+			{"__keyspace@0__:a", KeyEventRenameFrom},
+			{"__keyevent@0__:rename_from", "a"},
+			{"__keyspace@0__:b", KeyEventRenameTo},
+			{"__keyevent@0__:rename_to", "b"},
+			{"__keyspace@0__:l", "rpush"},
+			{"__keyevent@0__:rpush", "l"},
+			{"__keyspace@0__:short", "set"},
+			{"__keyevent@0__:set", "short"},
+			{"__keyspace@0__:short", KeyEventExpired},
+			{"__keyevent@0__:expired", "short"},
+		}},
+		{"Egx", [][2]string{
+			{"__keyevent@0__:rename_from", "a"},
+			{"__keyevent@0__:rename_to", "b"},
+			{"__keyevent@0__:expired", "short"},
+		}},
+	} {
+		t.Run(tc.letters, func(t *testing.T) {
+			config := DefaultServerConfig()
+			config.KeyspaceEvents = tc.letters
+			server, address := startTestServer(t, config)
+			server.EnableBuiltinStore()
+			rdb := redis.NewClient(&redis.Options{Addr: address, Protocol: 2})
+			defer rdb.Close()
+
+			sub := rdb.PSubscribe(ctx, "__key*__:*")
+			defer sub.Close()
+			if _, err := sub.Receive(ctx); err != nil {
+				t.Fatalf("PSUBSCRIBE failed: %v", err)
+			}
+			messages := sub.Channel()
+
+			rdb.Set(ctx, "a", "1", 0)
+			rdb.Rename(ctx, "a", "b")
+			rdb.RPush(ctx, "l", "x")
+			rdb.Set(ctx, "short", "v", time.Millisecond)
+
+			for _, want := range tc.want {
+				select {
+				case msg := <-messages:
+					if got := [2]string{msg.Channel, msg.Payload}; got != want {
+						t.Errorf("Expected %v, got %v", want, got)
+					}
+				case <-time.After(2 * time.Second):
+					t.Fatalf("Expected %v, got nothing", want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package redkit
+
+import (
+	"math"
+
+	"github.com/l00pss/redkit/args"
+	"github.com/l00pss/redkit/store"
+)
+
+// defaultKeyStats is the number of keys DEBUG BIGKEYS and HOTKEYS report
+// unless given COUNT
+const defaultKeyStats = 10
+
+// registerKeyStats registers the DEBUG subcommands reporting the largest
+// and the most accessed keys of a database
+func (c *storeCommands) registerKeyStats() {
+	s := c.server
+	s.RegisterSubcommandFunc(string(DEBUG), "BIGKEYS", c.keyStats(store.KeyStatsStorage.BigKeys), RangeArgs(0, 2), WithFlags(CmdReadOnly), WithCategories("keyspace", "slow"), WithSummary("Lists the keys taking the most memory."))
+	s.RegisterSubcommandFunc(string(DEBUG), "HOTKEYS", c.keyStats(store.KeyStatsStorage.HotKeys), RangeArgs(0, 2), WithFlags(CmdReadOnly), WithCategories("keyspace", "slow"), WithSummary("Lists the most frequently accessed keys."))
+}
+
+// keyStats returns the handler of a DEBUG subcommand replying with the keys
+// report finds in the selected database, each as a map of its name, type,
+// bytes, elements and access frequency: [COUNT count]
+func (c *storeCommands) keyStats(report func(store.KeyStatsStorage, int) ([]store.KeyStat, error)) func(*Connection, *Command) RedisValue {
+	return func(conn *Connection, cmd *Command) RedisValue {
+		count := int64(defaultKeyStats)
+		p := args.New(cmd.Args)
+		for p.More() {
+			if !p.MatchKeyword("COUNT", &count) {
+				p.Fail(args.ErrSyntax)
+			}
+		}
+		if err := p.Err(); err != nil {
+			return argsError(cmd, err)
+		}
+		if count <= 0 {
+			return ErrorValue(args.ErrSyntax)
+		}
+		keys, err := report(c.db(conn).keyStats, int(min(count, math.MaxInt)))
+		if err != nil {
+			return ErrorValue(err)
+		}
+		reply := make([]RedisValue, len(keys))
+		for i, k := range keys {
+			reply[i] = RedisValue{Type: Map, Map: []MapEntry{
+				{Key: RedisValue{Type: BulkString, Bulk: []byte("key")}, Value: RedisValue{Type: BulkString, Bulk: []byte(k.Key)}},
+				{Key: RedisValue{Type: BulkString, Bulk: []byte("type")}, Value: RedisValue{Type: BulkString, Bulk: []byte(k.Type)}},
+				{Key: RedisValue{Type: BulkString, Bulk: []byte("bytes")}, Value: RedisValue{Type: Integer, Int: k.Bytes}},
+				{Key: RedisValue{Type: BulkString, Bulk: []byte("elements")}, Value: RedisValue{Type: Integer, Int: int64(k.Elements)}},
+				{Key: RedisValue{Type: BulkString, Bulk: []byte("freq")}, Value: RedisValue{Type: Integer, Int: int64(k.Freq)}},
+			}}
+		}
+		return RedisValue{Type: Array, Array: reply}
+	}
+}
@@ -0,0 +1,168 @@
+package redkit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// StructuredLogger is a Logger that also accepts structured records. The server
+// logs per-connection events through LogAttrs when the configured Logger
+// implements it, with attributes such as conn_id, remote_addr, cmd, duration
+// and error; other loggers get the attributes appended as key=value pairs.
+type StructuredLogger interface {
+	Logger
+	Enabled(level LogLevel) bool
+	LogAttrs(level LogLevel, msg string, attrs ...slog.Attr)
+}
+
+// Enabled reports whether messages at level are written
+func (l *defaultLogger) Enabled(level LogLevel) bool {
+	return l.level <= level
+}
+
+// LogAttrs writes msg followed by the attributes as key=value pairs
+func (l *defaultLogger) LogAttrs(level LogLevel, msg string, attrs ...slog.Attr) {
+	if l.level > level {
+		return
+	}
+	l.logger.Print(levelTag(level) + " " + formatAttrs(msg, attrs))
+}
+
+func levelTag(level LogLevel) string {
+	switch level {
+	case LogLevelDebug:
+		return "[DEBUG]"
+	case LogLevelInfo:
+		return "[INFO]"
+	case LogLevelWarn:
+		return "[WARN]"
+	default:
+		return "[ERROR]"
+	}
+}
+
+func formatAttrs(msg string, attrs []slog.Attr) string {
+	var b strings.Builder
+	b.WriteString(msg)
+	for _, attr := range attrs {
+		b.WriteByte(' ')
+		b.WriteString(attr.Key)
+		b.WriteByte('=')
+		value := attr.Value.String()
+		if strings.ContainsAny(value, " \"=") || value == "" {
+			fmt.Fprintf(&b, "%q", value)
+		} else {
+			b.WriteString(value)
+		}
+	}
+	return b.String()
+}
+
+// slogLogger adapts a *slog.Logger to the Logger interface
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger returns a Logger writing to logger, so server logs can be routed
+// into JSON or other slog pipelines. Verbosity is controlled by the slog handler.
+func NewSlogLogger(logger *slog.Logger) Logger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &slogLogger{logger: logger}
+}
+
+func (l *slogLogger) Debug(format string, v ...interface{}) {
+	l.logf(slog.LevelDebug, format, v...)
+}
+
+func (l *slogLogger) Info(format string, v ...interface{}) {
+	l.logf(slog.LevelInfo, format, v...)
+}
+
+func (l *slogLogger) Warn(format string, v ...interface{}) {
+	l.logf(slog.LevelWarn, format, v...)
+}
+
+func (l *slogLogger) Error(format string, v ...interface{}) {
+	l.logf(slog.LevelError, format, v...)
+}
+
+func (l *slogLogger) logf(level slog.Level, format string, v ...interface{}) {
+	ctx := context.Background()
+	if l.logger.Enabled(ctx, level) {
+		l.logger.Log(ctx, level, fmt.Sprintf(format, v...))
+	}
+}
+
+// Enabled reports whether the slog handler accepts records at level
+func (l *slogLogger) Enabled(level LogLevel) bool {
+	return l.logger.Enabled(context.Background(), slogLevel(level))
+}
+
+// LogAttrs writes a structured record
+func (l *slogLogger) LogAttrs(level LogLevel, msg string, attrs ...slog.Attr) {
+	l.logger.LogAttrs(context.Background(), slogLevel(level), msg, attrs...)
+}
+
+func slogLevel(level LogLevel) slog.Level {
+	switch level {
+	case LogLevelDebug:
+		return slog.LevelDebug
+	case LogLevelInfo:
+		return slog.LevelInfo
+	case LogLevelWarn:
+		return slog.LevelWarn
+	default:
+		return slog.LevelError
+	}
+}
+
+// logConn logs an event about conn, tagging it with the connection ID and
+// remote address. A nil conn, as for commands dispatched directly, adds no tags.
+func (s *Server) logConn(level LogLevel, conn *Connection, msg string, attrs ...slog.Attr) {
+	if structured, ok := s.logger().(StructuredLogger); ok && !structured.Enabled(level) {
+		return
+	}
+	if conn == nil {
+		s.logAttrs(level, msg, attrs...)
+		return
+	}
+	base := []slog.Attr{
+		slog.Uint64("conn_id", conn.ID()),
+		slog.String("remote_addr", conn.RemoteAddr().String()),
+	}
+	if name := conn.Name(); name != "" {
+		base = append(base, slog.String("name", name))
+	}
+	attrs = append(base, attrs...)
+	s.logAttrs(level, msg, attrs...)
+}
+
+// logAttrs logs a structured record through the configured logger
+func (s *Server) logAttrs(level LogLevel, msg string, attrs ...slog.Attr) {
+	logger := s.logger()
+	if structured, ok := logger.(StructuredLogger); ok {
+		structured.LogAttrs(level, msg, attrs...)
+		return
+	}
+
+	line := formatAttrs(msg, attrs)
+	switch level {
+	case LogLevelDebug:
+		logger.Debug("%s", line)
+	case LogLevelInfo:
+		logger.Info("%s", line)
+	case LogLevelWarn:
+		logger.Warn("%s", line)
+	default:
+		logger.Error("%s", line)
+	}
+}
+
+// errAttr returns the attribute for an error
+func errAttr(err error) slog.Attr {
+	return slog.Any("error", err)
+}
@@ -0,0 +1,59 @@
+package redkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestDefaultLoggerAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewDefaultLogger(log.New(&buf, "", 0), LogLevelInfo).(StructuredLogger)
+
+	logger.LogAttrs(LogLevelDebug, "hidden")
+	logger.LogAttrs(LogLevelWarn, "Command failed", slog.String("cmd", "GET"), slog.String("error", "bad value"))
+
+	if got := strings.TrimSpace(buf.String()); got != `[WARN] Command failed cmd=GET error="bad value"` {
+		t.Errorf("Unexpected log line %q", got)
+	}
+}
+
+func TestSlogLoggerStructuredRecords(t *testing.T) {
+	server, address := startTestServer(t, nil)
+
+	var buf lockedBuffer
+	config := DefaultServerConfig()
+	config.Logger = NewSlogLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	if err := server.Reload(config); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	client := dialRaw(t, address)
+	client.send(t, "PING")
+	client.readLine(t)
+
+	var command map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Expected JSON records, got %q: %v", line, err)
+		}
+		if record["msg"] == "Command" {
+			command = record
+		}
+	}
+	if command == nil {
+		t.Fatalf("No command record in %q", buf.String())
+	}
+	if command["cmd"] != "PING" || command["level"] != "DEBUG" {
+		t.Errorf("Unexpected record %v", command)
+	}
+	for _, key := range []string{"conn_id", "remote_addr", "duration"} {
+		if _, ok := command[key]; !ok {
+			t.Errorf("Expected %s in record %v", key, command)
+		}
+	}
+}
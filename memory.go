@@ -0,0 +1,215 @@
+package redkit
+
+import (
+	"fmt"
+	"math"
+	"runtime/metrics"
+	"strings"
+
+	"github.com/l00pss/redkit/args"
+	"github.com/l00pss/redkit/store"
+)
+
+// Names of the runtime metrics the process memory is read from
+const (
+	metricHeapObjects  = "/memory/classes/heap/objects:bytes"
+	metricHeapReleased = "/memory/classes/heap/released:bytes"
+	metricTotal        = "/memory/classes/total:bytes"
+)
+
+// Thresholds of the issues MEMORY DOCTOR reports, as Redis has them
+const (
+	doctorMinUsed         = 5 << 20 // below which there's nothing to diagnose
+	doctorPeakRatio       = 1.5
+	doctorFragmentation   = 1.4
+	doctorFragmentedBytes = 10 << 20
+)
+
+// processMemory is the memory of the process as the Go runtime sees it
+type processMemory struct {
+	used uint64 // bytes of live and not yet swept heap objects
+	rss  uint64 // bytes mapped by the runtime and not returned to the OS
+}
+
+// readMemory reads the memory of the process from the runtime's metrics
+func readMemory() processMemory {
+	samples := []metrics.Sample{{Name: metricHeapObjects}, {Name: metricHeapReleased}, {Name: metricTotal}}
+	metrics.Read(samples)
+	return processMemory{
+		used: samples[0].Value.Uint64(),
+		rss:  samples[2].Value.Uint64() - samples[1].Value.Uint64(),
+	}
+}
+
+// memoryReport is what INFO memory and MEMORY STATS and DOCTOR report
+type memoryReport struct {
+	processMemory
+	peak    uint64
+	startup uint64 // used when the server was created
+	// dataset holds whether the storage accounts for its memory, and its
+	// accounting summed over the databases if so
+	dataset bool
+	store   store.MemoryStats
+}
+
+// memoryReport reads the memory of the process and of the storage, failing
+// if the storage can't tell its own
+func (s *Server) memoryReport() (memoryReport, error) {
+	report := memoryReport{
+		processMemory: s.stats.memory(),
+		peak:          s.stats.peakMemory.Load(),
+		startup:       s.stats.startupMemory,
+	}
+	var err error
+	s.distinctDatabases(func(index int, db *database) {
+		if db.memory == nil || err != nil {
+			return
+		}
+		var stats store.MemoryStats
+		if stats, err = db.memory.MemoryStats(); err == nil {
+			report.dataset = true
+			report.store.Keys += stats.Keys
+			report.store.Expires += stats.Expires
+			report.store.Bytes += stats.Bytes
+			report.store.Overhead += stats.Overhead
+		}
+	})
+	return report, err
+}
+
+// net returns the memory used beyond what the server used when created
+func (r memoryReport) net() uint64 {
+	if r.used <= r.startup {
+		return 1
+	}
+	return r.used - r.startup
+}
+
+// datasetBytes returns the bytes of the keys and values beyond the
+// structures of the keyspace
+func (r memoryReport) datasetBytes() int64 {
+	return r.store.Bytes - r.store.Overhead
+}
+
+func (r memoryReport) datasetPercentage() float64 {
+	return float64(r.datasetBytes()) * 100 / float64(r.net())
+}
+
+func (r memoryReport) peakPercentage() float64 {
+	return float64(r.used) * 100 / float64(max(r.peak, 1))
+}
+
+func (r memoryReport) fragmentation() float64 {
+	return float64(r.rss) / float64(max(r.used, 1))
+}
+
+// humanBytes formats n bytes as Redis does in the _human fields of INFO
+func humanBytes(n uint64) string {
+	if n < 1024 {
+		return fmt.Sprintf("%dB", n)
+	}
+	value, units := float64(n)/1024, "KMGTP"
+	for value >= 1024 && len(units) > 1 {
+		value, units = value/1024, units[1:]
+	}
+	return fmt.Sprintf("%.2f%c", value, units[0])
+}
+
+// registerMemory registers the MEMORY subcommands reporting the memory the
+// storage and the server take
+func (c *storeCommands) registerMemory() {
+	s := c.server
+	s.RegisterSubcommandFunc(string(MEMORY), "USAGE", c.memoryUsage, MinArgs(1), WithKeys(1, 1, 1), WithFlags(CmdReadOnly), WithCategories("keyspace"), WithSummary("Estimates the memory usage of a key."))
+	s.RegisterSubcommandFunc(string(MEMORY), "STATS", c.memoryStats, ExactArgs(0), WithFlags(CmdReadOnly), WithSummary("Returns details about memory usage."))
+	s.RegisterSubcommandFunc(string(MEMORY), "DOCTOR", c.memoryDoctor, ExactArgs(0), WithFlags(CmdReadOnly), WithSummary("Outputs a memory problems report."))
+}
+
+// memoryUsage implements MEMORY USAGE key [SAMPLES count]
+func (c *storeCommands) memoryUsage(conn *Connection, cmd *Command) RedisValue {
+	samples := int64(store.DefaultMemorySamples)
+	p := args.New(cmd.Args[1:])
+	for p.More() {
+		if !p.MatchKeyword("SAMPLES", &samples) {
+			p.Fail(args.ErrSyntax)
+		}
+	}
+	if err := p.Err(); err != nil {
+		return argsError(cmd, err)
+	}
+	if samples < 0 {
+		return ErrorValue(args.ErrSyntax)
+	}
+	size, ok, err := c.db(conn).memory.MemoryUsage(cmd.Args[0], int(min(samples, math.MaxInt)))
+	if err != nil {
+		return ErrorValue(err)
+	}
+	if !ok {
+		return RedisValue{Type: Null}
+	}
+	return RedisValue{Type: Integer, Int: size}
+}
+
+// memoryStats implements MEMORY STATS
+func (c *storeCommands) memoryStats(conn *Connection, cmd *Command) RedisValue {
+	report, err := c.server.memoryReport()
+	if err != nil {
+		return ErrorValue(err)
+	}
+	integer := func(n int64) RedisValue { return RedisValue{Type: Integer, Int: n} }
+	double := func(f float64) RedisValue { return RedisValue{Type: Double, Float: f} }
+	bytesPerKey := int64(0)
+	if report.store.Keys > 0 {
+		bytesPerKey = int64(report.net()) / int64(report.store.Keys)
+	}
+	entries := []struct {
+		name  string
+		value RedisValue
+	}{
+		{"peak.allocated", integer(int64(report.peak))},
+		{"total.allocated", integer(int64(report.used))},
+		{"startup.allocated", integer(int64(report.startup))},
+		{"overhead.total", integer(int64(report.startup) + report.store.Overhead)},
+		{"keys.count", integer(int64(report.store.Keys))},
+		{"keys.bytes-per-key", integer(bytesPerKey)},
+		{"dataset.bytes", integer(report.datasetBytes())},
+		{"dataset.percentage", double(report.datasetPercentage())},
+		{"peak.percentage", double(report.peakPercentage())},
+		{"fragmentation", double(report.fragmentation())},
+		{"fragmentation.bytes", integer(int64(report.rss) - int64(report.used))},
+	}
+	stats := make([]MapEntry, len(entries))
+	for i, entry := range entries {
+		stats[i] = MapEntry{Key: RedisValue{Type: BulkString, Bulk: []byte(entry.name)}, Value: entry.value}
+	}
+	return RedisValue{Type: Map, Map: stats}
+}
+
+// memoryDoctor implements MEMORY DOCTOR, reporting the issues Redis looks for
+// that apply to a Go process: a peak far above the current usage and memory
+// the runtime holds but doesn't use
+func (c *storeCommands) memoryDoctor(conn *Connection, cmd *Command) RedisValue {
+	report, err := c.server.memoryReport()
+	if err != nil {
+		return ErrorValue(err)
+	}
+	var issues []string
+	if float64(report.peak) > float64(report.used)*doctorPeakRatio {
+		issues = append(issues, fmt.Sprintf("Peak memory: the server once used %s, more than 150%% of the %s it uses now. "+
+			"This is normal after deleting many keys; Go returns the freed memory to the OS over time.", humanBytes(report.peak), humanBytes(report.used)))
+	}
+	if report.fragmentation() > doctorFragmentation && report.rss-min(report.rss, report.used) > doctorFragmentedBytes {
+		issues = append(issues, fmt.Sprintf("High fragmentation: the process holds %.2f times the memory of its live heap. "+
+			"Collections of the garbage collector and returning memory to the OS bring it down.", report.fragmentation()))
+	}
+
+	var text string
+	switch {
+	case report.used < doctorMinUsed:
+		text = "This instance is empty or uses very little memory, so there is nothing to diagnose yet."
+	case len(issues) == 0:
+		text = "No memory issues detected in this instance."
+	default:
+		text = "A few memory issues were detected in this instance:\n\n * " + strings.Join(issues, "\n\n * ")
+	}
+	return RedisValue{Type: Verbatim, Str: text, Format: VerbatimText}
+}
@@ -0,0 +1,98 @@
+package redkit
+
+import "strings"
+
+// UseFor adds a middleware that only runs for the named command, after the
+// global middleware chain
+func (s *Server) UseFor(name string, middleware Middleware) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.commandMiddleware == nil {
+		s.commandMiddleware = make(map[string][]Middleware)
+	}
+	name = strings.ToUpper(name)
+	s.commandMiddleware[name] = append(s.commandMiddleware[name], middleware)
+	s.scopedGen.Add(1)
+}
+
+// UseForCategory adds a middleware that only runs for commands in the ACL
+// category, such as "write" or "dangerous", after the global chain and before
+// middleware added with UseFor. Commands registered with CmdWrite or
+// CmdReadOnly are in the "write" or "read" category respectively.
+func (s *Server) UseForCategory(category string, middleware Middleware) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.categoryMiddleware == nil {
+		s.categoryMiddleware = make(map[string][]Middleware)
+	}
+	category = strings.ToLower(strings.TrimPrefix(category, "@"))
+	s.categoryMiddleware[category] = append(s.categoryMiddleware[category], middleware)
+	s.scopedGen.Add(1)
+}
+
+// scopedChain is a handler wrapped in the scoped middleware of the command
+// it was built for, as of a generation of that middleware
+type scopedChain struct {
+	gen     uint64
+	name    string
+	handler CommandHandler
+}
+
+// scopedHandler returns the command's handler wrapped in the middleware
+// added for it with UseFor and UseForCategory. The chain is built once and
+// cached on the entry until that middleware changes, or the command is
+// renamed.
+func (s *Server) scopedHandler(entry *commandEntry, name string) CommandHandler {
+	if c := entry.scoped.Load(); c != nil && c.gen == s.scopedGen.Load() && c.name == name {
+		return c.handler
+	}
+	s.mu.RLock()
+	c := &scopedChain{gen: s.scopedGen.Load(), name: name, handler: s.buildScopedHandler(entry, name)}
+	s.mu.RUnlock()
+	entry.scoped.Store(c)
+	return c.handler
+}
+
+// buildScopedHandler wraps the command's handler in its scoped middleware.
+// The caller holds s.mu.
+func (s *Server) buildScopedHandler(entry *commandEntry, name string) CommandHandler {
+	if len(s.commandMiddleware) == 0 && len(s.categoryMiddleware) == 0 {
+		return entry.handler
+	}
+
+	var middlewares []Middleware
+	for _, category := range entry.categories(name) {
+		middlewares = append(middlewares, s.categoryMiddleware[category]...)
+	}
+	middlewares = append(middlewares, s.commandMiddleware[name]...)
+	if len(middlewares) == 0 {
+		return entry.handler
+	}
+	chain := &MiddlewareChain{middlewares: middlewares}
+	return chain.Handler(entry.handler)
+}
+
+// categories returns the ACL categories of the command, lower-case and
+// without duplicates, including those implied by its flags
+func (e *commandEntry) categories(name string) []string {
+	categories := make([]string, 0, len(e.info.ACLCategories)+1)
+	add := func(category string) {
+		category = strings.ToLower(strings.TrimPrefix(category, "@"))
+		for _, c := range categories {
+			if c == category {
+				return
+			}
+		}
+		categories = append(categories, category)
+	}
+	for _, category := range e.info.ACLCategories {
+		add(category)
+	}
+	if e.isWrite(name) {
+		add("write")
+	}
+	if e.info.Has(CmdReadOnly) {
+		add("read")
+	}
+	return categories
+}
@@ -262,3 +262,48 @@ func TestMiddlewareChainExample(t *testing.T) {
 
 	t.Logf("\nMiddleware chain execution flow:\n%s", strings.Join(log, "\n"))
 }
+
+// TestScopedMiddleware tests that UseFor and UseForCategory only run for their commands
+func TestScopedMiddleware(t *testing.T) {
+	server := NewServer(":0")
+	server.RegisterCommandFunc("SET", func(conn *Connection, cmd *Command) RedisValue {
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	}, WithFlags(CmdWrite))
+	server.RegisterCommandFunc("GET", func(conn *Connection, cmd *Command) RedisValue {
+		return RedisValue{Type: Null}
+	}, WithFlags(CmdReadOnly))
+
+	var calls []string
+	record := func(label string) Middleware {
+		return MiddlewareFunc(func(conn *Connection, cmd *Command, next CommandHandler) RedisValue {
+			calls = append(calls, label+":"+cmd.Name)
+			return next.Handle(conn, cmd)
+		})
+	}
+	server.Use(record("global"))
+	server.UseFor("set", record("set"))
+	server.UseForCategory("@write", record("write"))
+	server.UseForCategory("read", record("read"))
+
+	for _, name := range []string{"PING", "SET", "GET"} {
+		server.handleCommand(nil, &Command{Name: name})
+	}
+
+	expected := []string{"global:PING", "global:SET", "write:SET", "set:SET", "global:GET", "read:GET"}
+	if fmt.Sprint(calls) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v, got %v", expected, calls)
+	}
+
+	// The chains are cached on the commands, until middleware is added
+	name, entry, _ := server.handlerTable().lookup("SET")
+	if allocs := testing.AllocsPerRun(100, func() { server.scopedHandler(entry, name) }); allocs != 0 {
+		t.Errorf("Expected the chain of SET to be cached, got %v allocations", allocs)
+	}
+	calls = nil
+	server.UseFor("get", record("get"))
+	server.handleCommand(nil, &Command{Name: "GET"})
+	expected = []string{"global:GET", "read:GET", "get:GET"}
+	if fmt.Sprint(calls) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v, got %v", expected, calls)
+	}
+}
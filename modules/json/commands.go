@@ -0,0 +1,966 @@
+package json
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/l00pss/redkit"
+	"github.com/l00pss/redkit/args"
+	"github.com/l00pss/redkit/store"
+)
+
+// module implements the JSON commands over a server's storage
+type module struct {
+	server *redkit.Server
+}
+
+// storage returns the storage of the database conn selected, which Register
+// found to be a store.ValueStorage
+func (m *module) storage(conn *redkit.Connection) store.ValueStorage {
+	return m.server.Database(conn.DB()).(store.ValueStorage)
+}
+
+// commands returns the JSON commands as a command set
+func (m *module) commands() *redkit.CommandSet {
+	cs := redkit.NewCommandSet("json")
+	cs.RegisterFunc(string(redkit.JSON_SET), m.set, redkit.RangeArgs(3, 4), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdWrite), redkit.WithCategories("json"), redkit.WithSummary("Sets or updates the JSON value at a path."))
+	cs.RegisterFunc(string(redkit.JSON_GET), m.get, redkit.MinArgs(1), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdReadOnly), redkit.WithCategories("json"), redkit.WithSummary("Gets the value at one or more paths in JSON serialized form."))
+	cs.RegisterFunc(string(redkit.JSON_MGET), m.mget, redkit.MinArgs(2), redkit.WithKeys(1, -2, 1), redkit.WithFlags(redkit.CmdReadOnly), redkit.WithCategories("json"), redkit.WithSummary("Returns the values at a path from one or more keys."))
+	cs.RegisterFunc(string(redkit.JSON_MSET), m.mset, redkit.MinArgs(3), redkit.WithKeys(1, -1, 3), redkit.WithFlags(redkit.CmdWrite), redkit.WithCategories("json"), redkit.WithSummary("Sets or updates the JSON value of one or more keys."))
+	cs.RegisterFunc(string(redkit.JSON_MERGE), m.merge, redkit.ExactArgs(3), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdWrite), redkit.WithCategories("json"), redkit.WithSummary("Merges a given JSON value into matching paths."))
+	cs.RegisterFunc(string(redkit.JSON_DEL), m.del, redkit.RangeArgs(1, 2), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdWrite), redkit.WithCategories("json"), redkit.WithSummary("Deletes a value."))
+	cs.RegisterFunc(string(redkit.JSON_FORGET), m.del, redkit.RangeArgs(1, 2), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdWrite), redkit.WithCategories("json"), redkit.WithSummary("Deletes a value."))
+	cs.RegisterFunc(string(redkit.JSON_CLEAR), m.clear, redkit.RangeArgs(1, 2), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdWrite), redkit.WithCategories("json"), redkit.WithSummary("Clears all values from an array or an object and sets numeric values to 0."))
+	cs.RegisterFunc(string(redkit.JSON_TYPE), m.typ, redkit.RangeArgs(1, 2), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdReadOnly|redkit.CmdFast), redkit.WithCategories("json"), redkit.WithSummary("Returns the type of the JSON value at a path."))
+	cs.RegisterFunc(string(redkit.JSON_TOGGLE), m.toggle, redkit.ExactArgs(2), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdWrite), redkit.WithCategories("json"), redkit.WithSummary("Toggles a boolean value."))
+	cs.RegisterFunc(string(redkit.JSON_NUMINCRBY), m.arith(false), redkit.ExactArgs(3), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdWrite), redkit.WithCategories("json"), redkit.WithSummary("Increments the numeric value at a path by a value."))
+	cs.RegisterFunc(string(redkit.JSON_NUMMULTBY), m.arith(true), redkit.ExactArgs(3), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdWrite), redkit.WithCategories("json"), redkit.WithSummary("Multiplies the numeric value at a path by a value."))
+	cs.RegisterFunc(string(redkit.JSON_STRAPPEND), m.strappend, redkit.RangeArgs(2, 3), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdWrite), redkit.WithCategories("json"), redkit.WithSummary("Appends a string to a JSON string value at a path."))
+	cs.RegisterFunc(string(redkit.JSON_STRLEN), m.query("string", strlen), redkit.RangeArgs(1, 2), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdReadOnly|redkit.CmdFast), redkit.WithCategories("json"), redkit.WithSummary("Returns the length of the JSON string at a path."))
+	cs.RegisterFunc(string(redkit.JSON_ARRAPPEND), m.arrappend, redkit.MinArgs(3), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdWrite), redkit.WithCategories("json"), redkit.WithSummary("Appends one or more JSON values into the array at a path after the last element in it."))
+	cs.RegisterFunc(string(redkit.JSON_ARRINDEX), m.arrindex, redkit.RangeArgs(3, 5), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdReadOnly), redkit.WithCategories("json"), redkit.WithSummary("Returns the index of the first occurrence of a JSON scalar value in the array at a path."))
+	cs.RegisterFunc(string(redkit.JSON_ARRINSERT), m.arrinsert, redkit.MinArgs(4), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdWrite), redkit.WithCategories("json"), redkit.WithSummary("Inserts the JSON scalar(s) value at the specified index in the array at a path."))
+	cs.RegisterFunc(string(redkit.JSON_ARRLEN), m.query("array", length(kindArray)), redkit.RangeArgs(1, 2), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdReadOnly|redkit.CmdFast), redkit.WithCategories("json"), redkit.WithSummary("Returns the length of the array at a path."))
+	cs.RegisterFunc(string(redkit.JSON_ARRPOP), m.arrpop, redkit.RangeArgs(1, 3), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdWrite), redkit.WithCategories("json"), redkit.WithSummary("Removes and returns the element at the specified index in the array at a path."))
+	cs.RegisterFunc(string(redkit.JSON_ARRTRIM), m.arrtrim, redkit.ExactArgs(4), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdWrite), redkit.WithCategories("json"), redkit.WithSummary("Trims the array at a path to contain only the specified inclusive range of indices from start to stop."))
+	cs.RegisterFunc(string(redkit.JSON_OBJKEYS), m.query("object", objkeys), redkit.RangeArgs(1, 2), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdReadOnly), redkit.WithCategories("json"), redkit.WithSummary("Returns the JSON keys of the object at a path."))
+	cs.RegisterFunc(string(redkit.JSON_OBJLEN), m.query("object", length(kindObject)), redkit.RangeArgs(1, 2), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdReadOnly|redkit.CmdFast), redkit.WithCategories("json"), redkit.WithSummary("Returns the number of keys of the object at a path."))
+	cs.RegisterFunc(string(redkit.JSON_RESP), m.query("", func(n *node) (redkit.RedisValue, bool) { return respOf(n), true }), redkit.RangeArgs(1, 2), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdReadOnly), redkit.WithCategories("json"), redkit.WithSummary("Returns the JSON value at a path in Redis Serialization Protocol (RESP)."))
+	cs.RegisterSubcommandFunc(string(redkit.JSON_DEBUG), "MEMORY", m.debugMemory, redkit.RangeArgs(1, 2), redkit.WithFlags(redkit.CmdReadOnly), redkit.WithCategories("json"), redkit.WithSummary("Reports the size in bytes of a key."))
+	return cs
+}
+
+var (
+	null = redkit.RedisValue{Type: redkit.Null}
+
+	errNoKey   = redkit.NewError(redkit.ErrPrefixGeneric, "could not perform this operation on a key that doesn't exist")
+	errNotRoot = redkit.NewError(redkit.ErrPrefixGeneric, "new objects must be created at the root")
+)
+
+func integer(n int) redkit.RedisValue {
+	return redkit.RedisValue{Type: redkit.Integer, Int: int64(n)}
+}
+
+func bulk(s string) redkit.RedisValue {
+	return redkit.RedisValue{Type: redkit.BulkString, Bulk: []byte(s)}
+}
+
+func array(values []redkit.RedisValue) redkit.RedisValue {
+	return redkit.RedisValue{Type: redkit.Array, Array: values}
+}
+
+// pathMissing is the error of a legacy path selecting no value
+func pathMissing(p *path) *redkit.RedisError {
+	return redkit.NewError(redkit.ErrPrefixGeneric, "Path '%s' does not exist", p.text)
+}
+
+// wrongType is the error of a legacy path selecting a value of the wrong type
+func wrongType(expected string, n *node) redkit.RedisValue {
+	return redkit.NewError(redkit.ErrPrefixWrongType, "wrong type of path value - expected %s but found %s", expected, n.kind).Value()
+}
+
+// optionalPath parses the path at args[i], the root if there is none
+func optionalPath(args []string, i int) (*path, error) {
+	if i >= len(args) {
+		return rootPath, nil
+	}
+	return parsePath(args[i])
+}
+
+// parseInt parses an integer argument
+func parseInt(arg string) (int, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil {
+		return 0, args.ErrNotInteger
+	}
+	return n, nil
+}
+
+// view replies with fn applied to the document at key, null if it's missing
+func (m *module) view(conn *redkit.Connection, key string, fn func(root *node) redkit.RedisValue) redkit.RedisValue {
+	reply := null
+	err := m.storage(conn).ViewValues([]string{key}, TypeName, func(values []store.Value) {
+		if values[0] != nil {
+			reply = fn(values[0].(*Document).root)
+		}
+	})
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	m.server.KeysRead(conn, key)
+	return reply
+}
+
+// update replies with fn applied to the document at key, which must exist.
+// fn also reports whether it changed the document.
+func (m *module) update(conn *redkit.Connection, key string, fn func(root *node) (redkit.RedisValue, bool)) redkit.RedisValue {
+	var reply redkit.RedisValue
+	changed := false
+	err := m.storage(conn).UpdateValues([]string{key}, TypeName, func(values []store.Value) error {
+		if values[0] == nil {
+			return errNoKey
+		}
+		reply, changed = fn(values[0].(*Document).root)
+		return nil
+	})
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	if changed {
+		m.server.KeysWritten(conn, key)
+	}
+	return reply
+}
+
+// eachValue replies with fn applied to the values p selects in root. fn
+// returns false, before changing anything, for a value of the wrong type:
+// it's null in the array a JSONPath gets, and a WRONGTYPE error naming the
+// expected type as the value of a legacy path. changed reports whether fn
+// accepted any value.
+func eachValue(root *node, p *path, expected string, fn func(n *node) (redkit.RedisValue, bool)) (reply redkit.RedisValue, changed bool) {
+	matches := p.eval(root)
+	if p.legacy {
+		if len(matches) == 0 {
+			return pathMissing(p).Value(), false
+		}
+		reply, ok := fn(matches[0].node)
+		if !ok {
+			return wrongType(expected, matches[0].node), false
+		}
+		return reply, true
+	}
+	replies := make([]redkit.RedisValue, len(matches))
+	for i, match := range matches {
+		var ok bool
+		if replies[i], ok = fn(match.node); !ok {
+			replies[i] = null
+		}
+		changed = changed || ok
+	}
+	return array(replies), changed
+}
+
+// query returns the handler of a read command taking a key and an optional
+// path, replying as eachValue does with fn
+func (m *module) query(expected string, fn func(n *node) (redkit.RedisValue, bool)) func(*redkit.Connection, *redkit.Command) redkit.RedisValue {
+	return func(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+		p, err := optionalPath(cmd.Args, 1)
+		if err != nil {
+			return redkit.ErrorValue(err)
+		}
+		return m.view(conn, cmd.Args[0], func(root *node) redkit.RedisValue {
+			reply, _ := eachValue(root, p, expected, fn)
+			return reply
+		})
+	}
+}
+
+// target is a value a write selects: an existing one, or with node nil the
+// member key of parent it creates
+type target struct {
+	node, parent *node
+	key          string
+}
+
+// targets returns the values p selects in root for JSON.SET and JSON.MERGE,
+// reporting whether they exist. If p selects none and ends with a member
+// name, they are new members of that name in the objects the rest of p
+// selects.
+func targets(root *node, p *path) (bool, []target) {
+	if matches := p.eval(root); len(matches) > 0 {
+		ts := make([]target, len(matches))
+		for i, match := range matches {
+			ts[i] = target{node: match.node, parent: match.parent}
+		}
+		return true, ts
+	}
+	last := p.segments[len(p.segments)-1]
+	if last.descend || len(last.selectors) != 1 || last.selectors[0].kind != selectName {
+		return false, nil
+	}
+	var ts []target
+	for _, match := range evalSegments(p.segments[:len(p.segments)-1], []match{{node: root}}, root) {
+		if match.node.kind == kindObject {
+			ts = append(ts, target{parent: match.node, key: last.selectors[0].name})
+		}
+	}
+	return false, ts
+}
+
+// setValue sets the values p selects in root, nil for a missing key, to
+// value, under the condition NX or XX if given. It returns the new root and
+// whether it set anything.
+func setValue(root *node, p *path, value *node, cond string) (*node, bool, error) {
+	if root == nil {
+		if !p.isRoot() {
+			return nil, false, errNotRoot
+		}
+		return value, cond != "XX", nil
+	}
+	exists, ts := targets(root, p)
+	if len(ts) == 0 || exists && cond == "NX" || !exists && cond == "XX" {
+		return root, false, nil
+	}
+	for _, t := range ts {
+		if t.node != nil {
+			*t.node = *value.clone()
+		} else {
+			t.parent.set(t.key, value.clone())
+		}
+	}
+	return root, true, nil
+}
+
+// JSON.SET key path value [NX | XX]
+func (m *module) set(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	key := cmd.Args[0]
+	p, err := parsePath(cmd.Args[1])
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	value, err := parse(cmd.Args[2])
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	var cond string
+	if len(cmd.Args) > 3 {
+		parser := args.New(cmd.Args[3:])
+		cond = parser.NextKeyword("NX", "XX")
+		if err := parser.Err(); err != nil {
+			return redkit.ErrorValue(err)
+		}
+	}
+
+	set := false
+	err = m.storage(conn).UpdateValues([]string{key}, TypeName, func(values []store.Value) error {
+		var root *node
+		if values[0] != nil {
+			root = values[0].(*Document).root
+		}
+		root, set, err = setValue(root, p, value, cond)
+		if set && values[0] == nil {
+			values[0] = &Document{root: root}
+		}
+		return err
+	})
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	if !set {
+		return null
+	}
+	m.server.KeysWritten(conn, key)
+	return redkit.RedisValue{Type: redkit.SimpleString, Str: "OK"}
+}
+
+// JSON.MSET key path value [key path value ...]
+func (m *module) mset(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	if len(cmd.Args)%3 != 0 {
+		return redkit.WrongArity(cmd.Name).Value()
+	}
+	type triple struct {
+		index int
+		path  *path
+		value *node
+	}
+	var keys []string
+	indexes := make(map[string]int)
+	triples := make([]triple, 0, len(cmd.Args)/3)
+	for i := 0; i < len(cmd.Args); i += 3 {
+		p, err := parsePath(cmd.Args[i+1])
+		if err != nil {
+			return redkit.ErrorValue(err)
+		}
+		value, err := parse(cmd.Args[i+2])
+		if err != nil {
+			return redkit.ErrorValue(err)
+		}
+		index, ok := indexes[cmd.Args[i]]
+		if !ok {
+			index = len(keys)
+			indexes[cmd.Args[i]] = index
+			keys = append(keys, cmd.Args[i])
+		}
+		triples = append(triples, triple{index, p, value})
+	}
+
+	// The sets apply to copies, so that none is stored if one fails
+	err := m.storage(conn).UpdateValues(keys, TypeName, func(values []store.Value) error {
+		roots := make([]*node, len(values))
+		for i, v := range values {
+			if v != nil {
+				roots[i] = v.(*Document).root.clone()
+			}
+		}
+		for _, t := range triples {
+			var err error
+			if roots[t.index], _, err = setValue(roots[t.index], t.path, t.value, ""); err != nil {
+				return err
+			}
+		}
+		for i, root := range roots {
+			if root != nil {
+				values[i] = &Document{root: root}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	m.server.KeysWritten(conn, keys...)
+	return redkit.RedisValue{Type: redkit.SimpleString, Str: "OK"}
+}
+
+// mergeValue merges patch into the values p selects in root, nil for a
+// missing key, and returns the new root, nil if the patch deleted it
+func mergeValue(root *node, p *path, patch *node) (*node, error) {
+	if root == nil {
+		if !p.isRoot() {
+			return nil, errNotRoot
+		}
+		return merge(nil, patch), nil
+	}
+	exists, ts := targets(root, p)
+	for _, t := range ts {
+		switch {
+		case !exists:
+			if patch.kind != kindNull {
+				t.parent.set(t.key, merge(nil, patch))
+			}
+		case patch.kind != kindNull:
+			*t.node = *merge(t.node, patch)
+		case t.parent == nil:
+			return nil, nil
+		default:
+			t.parent.remove(t.node)
+		}
+	}
+	return root, nil
+}
+
+// JSON.MERGE key path value
+func (m *module) merge(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	key := cmd.Args[0]
+	p, err := parsePath(cmd.Args[1])
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	patch, err := parse(cmd.Args[2])
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	err = m.storage(conn).UpdateValues([]string{key}, TypeName, func(values []store.Value) error {
+		var root *node
+		if values[0] != nil {
+			root = values[0].(*Document).root
+		}
+		root, err := mergeValue(root, p, patch)
+		if err != nil {
+			return err
+		}
+		if root == nil {
+			values[0] = nil
+		} else if values[0] == nil {
+			values[0] = &Document{root: root}
+		}
+		return nil
+	})
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	m.server.KeysWritten(conn, key)
+	return redkit.RedisValue{Type: redkit.SimpleString, Str: "OK"}
+}
+
+// JSON.GET key [INDENT indent] [NEWLINE newline] [SPACE space] [path ...]
+func (m *module) get(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	var f format
+	var paths []*path
+	parser := args.New(cmd.Args[1:])
+	for parser.More() {
+		switch {
+		case parser.MatchKeyword("INDENT", &f.indent):
+		case parser.MatchKeyword("NEWLINE", &f.newline):
+		case parser.MatchKeyword("SPACE", &f.space):
+		default:
+			p, err := parsePath(parser.NextString())
+			if err != nil {
+				return redkit.ErrorValue(err)
+			}
+			paths = append(paths, p)
+		}
+	}
+	if err := parser.Err(); err != nil {
+		return redkit.ErrorValue(err)
+	}
+	if len(paths) == 0 {
+		paths = []*path{rootPath}
+	}
+
+	return m.view(conn, cmd.Args[0], func(root *node) redkit.RedisValue {
+		if len(paths) == 1 {
+			n, err := selected(root, paths[0], paths[0].legacy)
+			if err != nil {
+				return err.Value()
+			}
+			return bulk(n.format(f))
+		}
+
+		// Several paths get an object of their values, arrays of them
+		// unless all paths are legacy ones
+		legacy := true
+		for _, p := range paths {
+			legacy = legacy && p.legacy
+		}
+		obj := &node{kind: kindObject}
+		for _, p := range paths {
+			n, err := selected(root, p, legacy)
+			if err != nil {
+				return err.Value()
+			}
+			obj.set(p.text, n)
+		}
+		return bulk(obj.format(f))
+	})
+}
+
+// selected returns what p selects in root as one value: the first it selects
+// if legacy, an array of all of them otherwise
+func selected(root *node, p *path, legacy bool) (*node, *redkit.RedisError) {
+	matches := p.eval(root)
+	if legacy {
+		if len(matches) == 0 {
+			return nil, pathMissing(p)
+		}
+		return matches[0].node, nil
+	}
+	arr := &node{kind: kindArray, arr: make([]*node, len(matches))}
+	for i, match := range matches {
+		arr.arr[i] = match.node
+	}
+	return arr, nil
+}
+
+// JSON.MGET key [key ...] path
+func (m *module) mget(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	keys := cmd.Args[:len(cmd.Args)-1]
+	p, err := parsePath(cmd.Args[len(cmd.Args)-1])
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	replies := make([]redkit.RedisValue, len(keys))
+	err = m.storage(conn).ViewValues(keys, TypeName, func(values []store.Value) {
+		for i, v := range values {
+			replies[i] = null
+			if v == nil {
+				continue
+			}
+			if n, err := selected(v.(*Document).root, p, p.legacy); err == nil {
+				replies[i] = bulk(n.String())
+			}
+		}
+	})
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	m.server.KeysRead(conn, keys...)
+	return array(replies)
+}
+
+// JSON.DEL key [path] and JSON.FORGET key [path]
+func (m *module) del(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	key := cmd.Args[0]
+	p, err := optionalPath(cmd.Args, 1)
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	deleted := 0
+	err = m.storage(conn).UpdateValues([]string{key}, TypeName, func(values []store.Value) error {
+		switch {
+		case values[0] == nil:
+		case p.isRoot():
+			values[0], deleted = nil, 1
+		default:
+			for _, match := range p.eval(values[0].(*Document).root) {
+				if match.parent != nil && match.parent.remove(match.node) {
+					deleted++
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	if deleted > 0 {
+		m.server.KeysWritten(conn, key)
+	}
+	return integer(deleted)
+}
+
+// JSON.CLEAR key [path]
+func (m *module) clear(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	p, err := optionalPath(cmd.Args, 1)
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	return m.update(conn, cmd.Args[0], func(root *node) (redkit.RedisValue, bool) {
+		cleared := 0
+		for _, match := range p.eval(root) {
+			switch n := match.node; n.kind {
+			case kindArray:
+				n.arr = []*node{}
+			case kindObject:
+				n.members = []member{}
+			case kindInteger, kindNumber:
+				*n = *newInteger(0)
+			default:
+				continue
+			}
+			cleared++
+		}
+		return integer(cleared), cleared > 0
+	})
+}
+
+// JSON.TYPE key [path]
+func (m *module) typ(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	p, err := optionalPath(cmd.Args, 1)
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	return m.view(conn, cmd.Args[0], func(root *node) redkit.RedisValue {
+		matches := p.eval(root)
+		if p.legacy {
+			if len(matches) == 0 {
+				return null
+			}
+			return redkit.RedisValue{Type: redkit.SimpleString, Str: matches[0].node.kind.String()}
+		}
+		types := make([]redkit.RedisValue, len(matches))
+		for i, match := range matches {
+			types[i] = bulk(match.node.kind.String())
+		}
+		return array(types)
+	})
+}
+
+// JSON.TOGGLE key path
+func (m *module) toggle(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	p, err := parsePath(cmd.Args[1])
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	return m.update(conn, cmd.Args[0], func(root *node) (redkit.RedisValue, bool) {
+		return eachValue(root, p, "boolean", func(n *node) (redkit.RedisValue, bool) {
+			if n.kind != kindBool {
+				return null, false
+			}
+			n.b = !n.b
+			if p.legacy {
+				return bulk(strconv.FormatBool(n.b)), true
+			}
+			if n.b {
+				return integer(1), true
+			}
+			return integer(0), true
+		})
+	})
+}
+
+// arith returns the handler of JSON.NUMINCRBY key path value, or of
+// JSON.NUMMULTBY if mult. They reply with the new values as JSON.
+func (m *module) arith(mult bool) func(*redkit.Connection, *redkit.Command) redkit.RedisValue {
+	return func(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+		p, err := parsePath(cmd.Args[1])
+		if err != nil {
+			return redkit.ErrorValue(err)
+		}
+		by, err := parse(cmd.Args[2])
+		if err != nil || !by.isNumber() {
+			return redkit.NewError(redkit.ErrPrefixGeneric, "expected a number but found '%s'", cmd.Args[2]).Value()
+		}
+		return m.update(conn, cmd.Args[0], func(root *node) (redkit.RedisValue, bool) {
+			matches := p.eval(root)
+			if p.legacy {
+				if len(matches) == 0 {
+					return pathMissing(p).Value(), false
+				}
+				if !matches[0].node.isNumber() {
+					return wrongType("number", matches[0].node), false
+				}
+				matches = matches[:1]
+			}
+
+			// Compute every result before storing any, so that an
+			// overflow changes nothing
+			results := &node{kind: kindArray, arr: make([]*node, len(matches))}
+			for i, match := range matches {
+				results.arr[i] = &node{}
+				if match.node.isNumber() {
+					if results.arr[i], err = compute(match.node, by, mult); err != nil {
+						return redkit.ErrorValue(err), false
+					}
+				}
+			}
+			changed := false
+			for i, match := range matches {
+				if match.node.isNumber() {
+					*match.node = *results.arr[i]
+					changed = true
+				}
+			}
+			if p.legacy {
+				return bulk(results.arr[0].String()), changed
+			}
+			return bulk(results.String()), changed
+		})
+	}
+}
+
+// errOverflow is the error of arithmetic giving an infinite result
+var errOverflow = redkit.NewError(redkit.ErrPrefixGeneric, "result is an infinite number")
+
+// compute returns n plus by, or n times by if mult. Integers stay integers
+// unless the result overflows.
+func compute(n, by *node, mult bool) (*node, error) {
+	if n.kind == kindInteger && by.kind == kindInteger {
+		a, b := n.i, by.i
+		if mult {
+			if r := a * b; a == 0 || r/a == b && !(a == -1 && b == math.MinInt64) {
+				return newInteger(r), nil
+			}
+		} else if r := a + b; (r > a) == (b > 0) {
+			return newInteger(r), nil
+		}
+	}
+	f := n.float() + by.float()
+	if mult {
+		f = n.float() * by.float()
+	}
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil, errOverflow
+	}
+	return newNumber(f), nil
+}
+
+// JSON.STRAPPEND key [path] value
+func (m *module) strappend(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	p, err := optionalPath(cmd.Args[:len(cmd.Args)-1], 1)
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	value, err := parse(cmd.Args[len(cmd.Args)-1])
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	if value.kind != kindString {
+		return wrongType("string", value)
+	}
+	return m.update(conn, cmd.Args[0], func(root *node) (redkit.RedisValue, bool) {
+		return eachValue(root, p, "string", func(n *node) (redkit.RedisValue, bool) {
+			if n.kind != kindString {
+				return null, false
+			}
+			n.s += value.s
+			return integer(len(n.s)), true
+		})
+	})
+}
+
+func strlen(n *node) (redkit.RedisValue, bool) {
+	if n.kind != kindString {
+		return null, false
+	}
+	return integer(len(n.s)), true
+}
+
+// length returns the eachValue function of JSON.ARRLEN or JSON.OBJLEN
+func length(k kind) func(n *node) (redkit.RedisValue, bool) {
+	return func(n *node) (redkit.RedisValue, bool) {
+		if n.kind != k {
+			return null, false
+		}
+		return integer(n.length()), true
+	}
+}
+
+func objkeys(n *node) (redkit.RedisValue, bool) {
+	if n.kind != kindObject {
+		return null, false
+	}
+	keys := make([]redkit.RedisValue, len(n.members))
+	for i, m := range n.members {
+		keys[i] = bulk(m.key)
+	}
+	return array(keys), true
+}
+
+// parseValues parses JSON values from args
+func parseValues(args []string) ([]*node, error) {
+	values := make([]*node, len(args))
+	for i, arg := range args {
+		var err error
+		if values[i], err = parse(arg); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// insert inserts copies of values into the array n at index i
+func insert(n *node, i int, values []*node) {
+	copies := make([]*node, len(values))
+	for j, v := range values {
+		copies[j] = v.clone()
+	}
+	n.arr = append(n.arr[:i], append(copies, n.arr[i:]...)...)
+}
+
+// JSON.ARRAPPEND key path value [value ...]
+func (m *module) arrappend(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	p, err := parsePath(cmd.Args[1])
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	values, err := parseValues(cmd.Args[2:])
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	return m.update(conn, cmd.Args[0], func(root *node) (redkit.RedisValue, bool) {
+		return eachValue(root, p, "array", func(n *node) (redkit.RedisValue, bool) {
+			if n.kind != kindArray {
+				return null, false
+			}
+			insert(n, len(n.arr), values)
+			return integer(len(n.arr)), true
+		})
+	})
+}
+
+// errIndex is the error of JSON.ARRINSERT at an index outside the array
+var errIndex = redkit.NewError(redkit.ErrPrefixGeneric, "index out of bounds")
+
+// JSON.ARRINSERT key path index value [value ...]
+func (m *module) arrinsert(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	p, err := parsePath(cmd.Args[1])
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	index, err := parseInt(cmd.Args[2])
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	values, err := parseValues(cmd.Args[3:])
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	// position returns where index is in the array n, false if outside it
+	position := func(n *node) (int, bool) {
+		i := index
+		if i < 0 {
+			i += len(n.arr)
+		}
+		return i, i >= 0 && i <= len(n.arr)
+	}
+	return m.update(conn, cmd.Args[0], func(root *node) (redkit.RedisValue, bool) {
+		for _, match := range p.eval(root) {
+			if _, ok := position(match.node); match.node.kind == kindArray && !ok {
+				return errIndex.Value(), false
+			}
+		}
+		return eachValue(root, p, "array", func(n *node) (redkit.RedisValue, bool) {
+			if n.kind != kindArray {
+				return null, false
+			}
+			i, _ := position(n)
+			insert(n, i, values)
+			return integer(len(n.arr)), true
+		})
+	})
+}
+
+// JSON.ARRINDEX key path value [start [stop]]
+func (m *module) arrindex(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	p, err := parsePath(cmd.Args[1])
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	value, err := parse(cmd.Args[2])
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	var bounds [2]int
+	for i, arg := range cmd.Args[3:] {
+		if bounds[i], err = parseInt(arg); err != nil {
+			return redkit.ErrorValue(err)
+		}
+	}
+	return m.view(conn, cmd.Args[0], func(root *node) redkit.RedisValue {
+		reply, _ := eachValue(root, p, "array", func(n *node) (redkit.RedisValue, bool) {
+			if n.kind != kindArray {
+				return null, false
+			}
+			// A stop of 0 means the end of the array
+			start, stop := bounds[0], bounds[1]
+			if start < 0 {
+				start = max(start+len(n.arr), 0)
+			}
+			if stop < 0 {
+				stop += len(n.arr)
+			} else if stop == 0 || stop > len(n.arr) {
+				stop = len(n.arr)
+			}
+			for i := start; i < stop; i++ {
+				if n.arr[i].equal(value) {
+					return integer(i), true
+				}
+			}
+			return integer(-1), true
+		})
+		return reply
+	})
+}
+
+// JSON.ARRPOP key [path [index]]
+func (m *module) arrpop(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	p, err := optionalPath(cmd.Args, 1)
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	index := -1
+	if len(cmd.Args) > 2 {
+		if index, err = parseInt(cmd.Args[2]); err != nil {
+			return redkit.ErrorValue(err)
+		}
+	}
+	return m.update(conn, cmd.Args[0], func(root *node) (redkit.RedisValue, bool) {
+		reply, _ := eachValue(root, p, "array", func(n *node) (redkit.RedisValue, bool) {
+			if n.kind != kindArray {
+				return null, false
+			}
+			if len(n.arr) == 0 {
+				return null, true
+			}
+			// An index past either end pops the element at that end
+			i := index
+			if i < 0 {
+				i += len(n.arr)
+			}
+			i = min(max(i, 0), len(n.arr)-1)
+			popped := n.arr[i]
+			n.arr = append(n.arr[:i], n.arr[i+1:]...)
+			return bulk(popped.String()), true
+		})
+		return reply, reply.Type != redkit.ErrorReply
+	})
+}
+
+// JSON.ARRTRIM key path start stop
+func (m *module) arrtrim(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	p, err := parsePath(cmd.Args[1])
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	start, err := parseInt(cmd.Args[2])
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	stop, err := parseInt(cmd.Args[3])
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	return m.update(conn, cmd.Args[0], func(root *node) (redkit.RedisValue, bool) {
+		return eachValue(root, p, "array", func(n *node) (redkit.RedisValue, bool) {
+			if n.kind != kindArray {
+				return null, false
+			}
+			// The inclusive range start..stop, counted from the end if
+			// negative, as LTRIM takes it
+			first, last := start, stop
+			if first < 0 {
+				first = max(first+len(n.arr), 0)
+			}
+			if last < 0 {
+				last += len(n.arr)
+			}
+			last = min(last, len(n.arr)-1)
+			if first > last {
+				n.arr = []*node{}
+			} else {
+				n.arr = append([]*node{}, n.arr[first:last+1]...)
+			}
+			return integer(len(n.arr)), true
+		})
+	})
+}
+
+// respOf returns n as JSON.RESP replies with it: arrays start with [ and
+// objects with {, followed by their elements or keys and values
+func respOf(n *node) redkit.RedisValue {
+	switch n.kind {
+	case kindBool:
+		return redkit.RedisValue{Type: redkit.SimpleString, Str: strconv.FormatBool(n.b)}
+	case kindInteger:
+		return redkit.RedisValue{Type: redkit.Integer, Int: n.i}
+	case kindNumber:
+		return bulk(formatFloat(n.f))
+	case kindString:
+		return bulk(n.s)
+	case kindArray:
+		reply := []redkit.RedisValue{{Type: redkit.SimpleString, Str: "["}}
+		for _, elem := range n.arr {
+			reply = append(reply, respOf(elem))
+		}
+		return array(reply)
+	case kindObject:
+		reply := []redkit.RedisValue{{Type: redkit.SimpleString, Str: "{"}}
+		for _, m := range n.members {
+			reply = append(reply, bulk(m.key), respOf(m.value))
+		}
+		return array(reply)
+	}
+	return null
+}
+
+// JSON.DEBUG MEMORY key [path]
+func (m *module) debugMemory(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	p, err := optionalPath(cmd.Args, 1)
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	reply := m.view(conn, cmd.Args[0], func(root *node) redkit.RedisValue {
+		reply, _ := eachValue(root, p, "", func(n *node) (redkit.RedisValue, bool) {
+			return integer(n.memory()), true
+		})
+		return reply
+	})
+	if reply.Type == redkit.Null {
+		if p.legacy {
+			return integer(0)
+		}
+		return array(nil)
+	}
+	return reply
+}
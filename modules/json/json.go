@@ -0,0 +1,81 @@
+// Package json adds the RedisJSON commands to a redkit server: JSON.SET,
+// JSON.GET, JSON.ARRAPPEND, JSON.NUMINCRBY and the rest of the JSON.*
+// commands, over JSON documents kept in the server's storage.
+//
+// Commands take JSONPath paths, such as $.store.book[?(@.price < 10)].title,
+// which select any number of values and get an array reply, and the legacy
+// paths of RedisJSON 1, such as .store.book[0], which select one value:
+//
+//	server := redkit.NewServer(":6379")
+//	server.EnableBuiltinStore()
+//	if err := json.Register(server); err != nil {
+//		log.Fatal(err)
+//	}
+//
+// Documents are Values of the store, so their keys expire, are deleted and
+// are scanned like any other, and are of type ReJSON-RL.
+package json
+
+import (
+	"errors"
+
+	"github.com/l00pss/redkit"
+	"github.com/l00pss/redkit/store"
+)
+
+// TypeName is the type of keys holding documents, as TYPE reports it
+const TypeName = "ReJSON-RL"
+
+// Document is a JSON document, the value the JSON commands keep at a key
+type Document struct {
+	root *node
+}
+
+var (
+	_ store.MemoryValue   = (*Document)(nil)
+	_ store.CopyableValue = (*Document)(nil)
+)
+
+// ParseDocument parses a JSON text into a document
+func ParseDocument(text string) (*Document, error) {
+	root, err := parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &Document{root: root}, nil
+}
+
+// Type returns TypeName
+func (d *Document) Type() string {
+	return TypeName
+}
+
+// MemoryUsage returns the approximate bytes the document takes, as JSON.DEBUG
+// MEMORY reports for its root
+func (d *Document) MemoryUsage() int {
+	return d.root.memory()
+}
+
+// Copy returns a deep copy of the document, as COPY makes
+func (d *Document) Copy() store.Value {
+	return &Document{root: d.root.clone()}
+}
+
+// String returns the document as compact JSON
+func (d *Document) String() string {
+	return d.root.String()
+}
+
+// ErrNoValueStorage is returned by Register for a server whose storage can't
+// hold documents
+var ErrNoValueStorage = errors.New("json: the server's storage doesn't implement store.ValueStorage")
+
+// Register registers the JSON commands with server, which must have a
+// storage implementing store.ValueStorage, as EnableBuiltinStore's does
+func Register(server *redkit.Server) error {
+	if _, ok := server.Storage().(store.ValueStorage); !ok {
+		return ErrNoValueStorage
+	}
+	m := &module{server: server}
+	return server.Mount(m.commands())
+}
@@ -0,0 +1,227 @@
+package json
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/l00pss/redkit"
+	"github.com/redis/go-redis/v9"
+)
+
+// startServer starts a server with the built-in store and the JSON commands
+func startServer(t *testing.T) (*redkit.Server, *redis.Client) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to get a free port: %v", err)
+	}
+	address := l.Addr().String()
+	l.Close()
+
+	config := redkit.DefaultServerConfig()
+	config.Address = address
+	config.Logger = redkit.NewDefaultLogger(nil, redkit.LogLevelOff)
+	server := redkit.NewServerWithConfig(config)
+	server.EnableBuiltinStore()
+	if err := Register(server); err != nil {
+		t.Fatalf("Failed to register the JSON commands: %v", err)
+	}
+	if err := server.Listen(); err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go server.Serve()
+
+	rdb := redis.NewClient(&redis.Options{Addr: address, Protocol: 2})
+	t.Cleanup(func() {
+		rdb.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	})
+	return server, rdb
+}
+
+// TestRegister tests that Register needs a storage holding values
+func TestRegister(t *testing.T) {
+	if err := Register(redkit.NewServer("127.0.0.1:0")); err != ErrNoValueStorage {
+		t.Errorf("Expected ErrNoValueStorage without a storage, got %v", err)
+	}
+}
+
+// TestDatabases tests that documents live in the database of the connection
+// writing them
+func TestDatabases(t *testing.T) {
+	_, rdb := startServer(t)
+	ctx := context.Background()
+	other := redis.NewClient(&redis.Options{Addr: rdb.Options().Addr, DB: 1, Protocol: 2})
+	defer other.Close()
+
+	if err := other.Do(ctx, "JSON.SET", "doc", "$", `{"a":1}`).Err(); err != nil {
+		t.Fatalf("JSON.SET failed: %v", err)
+	}
+	if err := rdb.Do(ctx, "JSON.GET", "doc").Err(); err != redis.Nil {
+		t.Errorf("Expected no document in database 0, got %v", err)
+	}
+	if got, err := other.Do(ctx, "JSON.GET", "doc", "$.a").Text(); err != nil || got != "[1]" {
+		t.Errorf("Expected [1] from database 1, got %q, %v", got, err)
+	}
+}
+
+// TestCommands tests the JSON commands, printing their replies as go-redis
+// returns them
+func TestCommands(t *testing.T) {
+	_, rdb := startServer(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		args     []any
+		expected string
+	}{
+		{[]any{"JSON.SET", "doc", ".a", "1"}, "ERR new objects must be created at the root"},
+		{[]any{"JSON.SET", "doc", "$", `{"a":1,"b":[1,2],"c":{"d":"x"},"e":true}`}, "OK"},
+		{[]any{"JSON.SET", "doc", "$", `{}`, "NX"}, "redis: nil"},
+		{[]any{"JSON.SET", "doc", "$.f", `null`, "XX"}, "redis: nil"},
+		{[]any{"JSON.SET", "doc", "$.f", `null`}, "OK"},
+		{[]any{"JSON.SET", "doc", "$.x.y", `1`}, "redis: nil"},
+		{[]any{"JSON.SET", "doc", "$", `{`}, "ERR invalid JSON: unexpected end of JSON input"},
+		{[]any{"JSON.GET", "doc"}, `{"a":1,"b":[1,2],"c":{"d":"x"},"e":true,"f":null}`},
+		{[]any{"JSON.GET", "doc", "$.a"}, "[1]"},
+		{[]any{"JSON.GET", "doc", ".c.d"}, `"x"`},
+		{[]any{"JSON.GET", "doc", ".missing"}, "ERR Path '.missing' does not exist"},
+		{[]any{"JSON.GET", "doc", "$.missing"}, "[]"},
+		{[]any{"JSON.GET", "doc", ".a", ".e"}, `{".a":1,".e":true}`},
+		{[]any{"JSON.GET", "doc", "$.a", ".e"}, `{"$.a":[1],".e":[true]}`},
+		{[]any{"JSON.GET", "doc", "INDENT", "\t", "NEWLINE", "\n", "SPACE", " ", ".c"}, "{\n\t\"d\": \"x\"\n}"},
+		{[]any{"JSON.GET", "missing"}, "redis: nil"},
+		{[]any{"JSON.TYPE", "doc"}, "object"},
+		{[]any{"COPY", "doc", "copy"}, "1"},
+		{[]any{"JSON.SET", "copy", "$.c.d", `"y"`}, "OK"},
+		{[]any{"JSON.GET", "doc", ".c.d"}, `"x"`},
+		{[]any{"JSON.TYPE", "doc", "$..*"}, "[integer array object boolean null integer integer string]"},
+		{[]any{"JSON.TYPE", "doc", ".missing"}, "redis: nil"},
+		{[]any{"JSON.NUMINCRBY", "doc", "$..*", "2"}, "[3,null,null,null,null,3,4,null]"},
+		{[]any{"JSON.NUMINCRBY", "doc", ".a", "0.5"}, "3.5"},
+		{[]any{"JSON.NUMMULTBY", "doc", ".a", "2"}, "7.0"},
+		{[]any{"JSON.NUMINCRBY", "doc", ".c", "1"}, "WRONGTYPE wrong type of path value - expected number but found object"},
+		{[]any{"JSON.NUMINCRBY", "doc", ".a", "x"}, "ERR expected a number but found 'x'"},
+		{[]any{"JSON.SET", "n", "$", "9223372036854775807"}, "OK"},
+		{[]any{"JSON.NUMINCRBY", "n", "$", "1"}, "[9.223372036854776e18]"},
+		{[]any{"JSON.NUMMULTBY", "n", "$", "1e308"}, "ERR result is an infinite number"},
+		{[]any{"JSON.STRAPPEND", "doc", "$.c.d", `"yz"`}, "[3]"},
+		{[]any{"JSON.STRAPPEND", "doc", ".c.d", `"!"`}, "4"},
+		{[]any{"JSON.STRAPPEND", "doc", ".c.d", `1`}, "WRONGTYPE wrong type of path value - expected string but found integer"},
+		{[]any{"JSON.STRLEN", "doc", "$..d"}, "[4]"},
+		{[]any{"JSON.STRLEN", "doc", "$.*"}, "[<nil> <nil> <nil> <nil> <nil>]"},
+		{[]any{"JSON.TOGGLE", "doc", "$.e"}, "[0]"},
+		{[]any{"JSON.TOGGLE", "doc", ".e"}, "true"},
+		{[]any{"JSON.ARRAPPEND", "doc", "$.b", "3", `"four"`}, "[4]"},
+		{[]any{"JSON.ARRAPPEND", "doc", ".a", "1"}, "WRONGTYPE wrong type of path value - expected array but found number"},
+		{[]any{"JSON.ARRINDEX", "doc", "$.b", `"four"`}, "[3]"},
+		{[]any{"JSON.ARRINDEX", "doc", "$.b", "4", "0", "-1"}, "[1]"},
+		{[]any{"JSON.ARRINDEX", "doc", "$.b", "4", "3"}, "[-1]"},
+		{[]any{"JSON.ARRINSERT", "doc", "$.b", "0", "0"}, "[5]"},
+		{[]any{"JSON.ARRINSERT", "doc", "$.b", "-1", "5"}, "[6]"},
+		{[]any{"JSON.ARRINSERT", "doc", "$.b", "9", "5"}, "ERR index out of bounds"},
+		{[]any{"JSON.GET", "doc", ".b"}, `[0,3,4,3,5,"four"]`},
+		{[]any{"JSON.ARRLEN", "doc"}, "WRONGTYPE wrong type of path value - expected array but found object"},
+		{[]any{"JSON.ARRLEN", "doc", "$..b"}, "[6]"},
+		{[]any{"JSON.ARRPOP", "doc", ".b"}, `"four"`},
+		{[]any{"JSON.ARRPOP", "doc", "$.b", "0"}, "[0]"},
+		{[]any{"JSON.ARRPOP", "doc", "$.b", "99"}, "[5]"},
+		{[]any{"JSON.ARRTRIM", "doc", "$.b", "1", "-2"}, "[1]"},
+		{[]any{"JSON.GET", "doc", "$.b"}, "[[4]]"},
+		{[]any{"JSON.ARRTRIM", "doc", ".b", "5", "9"}, "0"},
+		{[]any{"JSON.ARRPOP", "doc", ".b"}, "redis: nil"},
+		{[]any{"JSON.OBJKEYS", "doc"}, "[a b c e f]"},
+		{[]any{"JSON.OBJKEYS", "doc", "$..c"}, "[[d]]"},
+		{[]any{"JSON.OBJLEN", "doc", "$.c"}, "[1]"},
+		{[]any{"JSON.RESP", "doc", ".c"}, "[{ d xyz!]"},
+		{[]any{"JSON.MERGE", "doc", "$", `{"a":null,"c":{"g":[1]},"h":2}`}, "OK"},
+		{[]any{"JSON.MERGE", "doc", "$.c.i", `{"j":null,"k":1}`}, "OK"},
+		{[]any{"JSON.GET", "doc"}, `{"b":[],"c":{"d":"xyz!","g":[1],"i":{"k":1}},"e":true,"f":null,"h":2}`},
+		{[]any{"JSON.CLEAR", "doc", "$.*"}, "3"},
+		{[]any{"JSON.GET", "doc"}, `{"b":[],"c":{},"e":true,"f":null,"h":0}`},
+		{[]any{"JSON.DEL", "doc", "$.b"}, "1"},
+		{[]any{"JSON.FORGET", "doc", "$.missing"}, "0"},
+		{[]any{"JSON.DEL", "doc", ".c"}, "1"},
+		{[]any{"JSON.GET", "doc"}, `{"e":true,"f":null,"h":0}`},
+		{[]any{"JSON.MSET", "m1", "$", `{"a":1}`, "m2", "$", `[1]`, "m1", "$.b", "2"}, "OK"},
+		{[]any{"JSON.MGET", "m1", "m2", "missing", "$.b"}, "[[2] [] <nil>]"},
+		{[]any{"JSON.MGET", "m1", "m2", ".a"}, "[1 <nil>]"},
+		{[]any{"JSON.MSET", "m1", "$.c", "3", "m3", "$.a", "1"}, "ERR new objects must be created at the root"},
+		{[]any{"JSON.GET", "m1"}, `{"a":1,"b":2}`},
+		{[]any{"EXISTS", "m3"}, "0"},
+		{[]any{"JSON.MSET", "m1", "$", "1", "m2"}, "ERR wrong number of arguments for 'json.mset' command"},
+		{[]any{"JSON.DEBUG", "MEMORY", "missing"}, "0"},
+		{[]any{"JSON.DEL", "doc"}, "1"},
+		{[]any{"JSON.DEL", "doc"}, "0"},
+		{[]any{"JSON.TOGGLE", "doc", "$"}, "ERR could not perform this operation on a key that doesn't exist"},
+		{[]any{"SET", "str", "v"}, "OK"},
+		{[]any{"JSON.GET", "str"}, "WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{[]any{"GET", "m1"}, "WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{[]any{"JSON.GET", "m1", "$[?(@ > 1)]"}, "[2]"},
+		{[]any{"JSON.GET", "m1", "$["}, `ERR invalid JSONPath "$[": at offset 1: expected a selector`},
+	}
+	for _, tt := range tests {
+		got, err := rdb.Do(ctx, tt.args...).Result()
+		reply := fmt.Sprint(got)
+		if err != nil {
+			reply = err.Error()
+		}
+		if reply != tt.expected {
+			t.Errorf("%v: expected %s, got %s", tt.args, tt.expected, reply)
+		}
+	}
+}
+
+// TestClient tests the JSON commands through go-redis's JSON API
+func TestClient(t *testing.T) {
+	_, rdb := startServer(t)
+	ctx := context.Background()
+
+	if err := rdb.JSONSet(ctx, "doc", "$", map[string]any{"name": "redkit", "tags": []string{"go"}}).Err(); err != nil {
+		t.Fatalf("JSONSet failed: %v", err)
+	}
+	if got, err := rdb.JSONGet(ctx, "doc", "$.name").Result(); err != nil || got != `["redkit"]` {
+		t.Errorf("Expected [\"redkit\"], got %q %v", got, err)
+	}
+	if got, err := rdb.JSONArrAppend(ctx, "doc", "$.tags", `"redis"`).Result(); err != nil || len(got) != 1 || got[0] != 2 {
+		t.Errorf("Expected [2], got %v %v", got, err)
+	}
+	if got, err := rdb.JSONType(ctx, "doc", "$.tags").Result(); err != nil || fmt.Sprint(got) != "[array]" {
+		t.Errorf("Expected [array], got %v %v", got, err)
+	}
+	if got, err := rdb.JSONDel(ctx, "doc", "$.tags[0]").Result(); err != nil || got != 1 {
+		t.Errorf("Expected 1, got %v %v", got, err)
+	}
+	if got, err := rdb.JSONGet(ctx, "doc").Result(); err != nil || got != `{"name":"redkit","tags":["redis"]}` {
+		t.Errorf("Unexpected document %q %v", got, err)
+	}
+
+	// Documents are keys like any other
+	if got, err := rdb.Del(ctx, "doc").Result(); err != nil || got != 1 {
+		t.Errorf("Expected DEL to delete the document, got %v %v", got, err)
+	}
+}
+
+// TestWatch tests that writes to documents abort transactions watching them
+func TestWatch(t *testing.T) {
+	_, rdb := startServer(t)
+	ctx := context.Background()
+	rdb.JSONSet(ctx, "doc", "$", `{"n":1}`)
+
+	err := rdb.Watch(ctx, func(tx *redis.Tx) error {
+		rdb.JSONNumIncrBy(ctx, "doc", "$.n", 1)
+		_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.JSONSet(ctx, "doc", "$.n", "0")
+			return nil
+		})
+		return err
+	}, "doc")
+	if err != redis.TxFailedErr {
+		t.Errorf("Expected the transaction to fail, got %v", err)
+	}
+}
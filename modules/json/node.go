@@ -0,0 +1,429 @@
+package json
+
+import (
+	stdjson "encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// kind is the type of a JSON value
+type kind int
+
+const (
+	kindNull kind = iota
+	kindBool
+	kindInteger
+	kindNumber
+	kindString
+	kindArray
+	kindObject
+)
+
+// names are the type names JSON.TYPE reports
+var names = [...]string{"null", "boolean", "integer", "number", "string", "array", "object"}
+
+func (k kind) String() string {
+	return names[k]
+}
+
+// node is a JSON value. Integers are kept apart from other numbers so that
+// arithmetic on them stays exact, as RedisJSON does. Objects keep their
+// members in insertion order and look them up by a linear scan, which suits
+// the small objects documents are made of.
+type node struct {
+	kind    kind
+	b       bool
+	i       int64
+	f       float64
+	s       string
+	arr     []*node
+	members []member
+}
+
+// member is a key and value of an object
+type member struct {
+	key   string
+	value *node
+}
+
+func newInteger(i int64) *node  { return &node{kind: kindInteger, i: i} }
+func newNumber(f float64) *node { return &node{kind: kindNumber, f: f} }
+func newString(s string) *node  { return &node{kind: kindString, s: s} }
+func newBool(b bool) *node      { return &node{kind: kindBool, b: b} }
+
+// parse parses a JSON text into a node
+func parse(text string) (*node, error) {
+	dec := stdjson.NewDecoder(strings.NewReader(text))
+	dec.UseNumber()
+	n, err := parseValue(dec)
+	if err == nil {
+		if _, err = dec.Token(); err != io.EOF {
+			err = errors.New("trailing characters")
+		} else {
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	return n, nil
+}
+
+// parseValue parses the next value from dec
+func parseValue(dec *stdjson.Decoder) (*node, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case nil:
+		return &node{}, nil
+	case bool:
+		return newBool(t), nil
+	case string:
+		return newString(t), nil
+	case stdjson.Number:
+		if i, err := strconv.ParseInt(string(t), 10, 64); err == nil {
+			return newInteger(i), nil
+		}
+		f, err := strconv.ParseFloat(string(t), 64)
+		if err != nil {
+			return nil, err
+		}
+		return newNumber(f), nil
+	case stdjson.Delim:
+		if t == '[' {
+			n := &node{kind: kindArray, arr: []*node{}}
+			for dec.More() {
+				elem, err := parseValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				n.arr = append(n.arr, elem)
+			}
+			_, err := dec.Token()
+			return n, err
+		}
+		n := &node{kind: kindObject, members: []member{}}
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := parseValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			n.set(tok.(string), value)
+		}
+		_, err := dec.Token()
+		return n, err
+	}
+	return nil, fmt.Errorf("unexpected %v", tok)
+}
+
+// get returns the member key of an object, nil if it has none
+func (n *node) get(key string) *node {
+	for _, m := range n.members {
+		if m.key == key {
+			return m.value
+		}
+	}
+	return nil
+}
+
+// set sets the member key of an object, keeping its position if it exists
+func (n *node) set(key string, value *node) {
+	for i, m := range n.members {
+		if m.key == key {
+			n.members[i].value = value
+			return
+		}
+	}
+	n.members = append(n.members, member{key, value})
+}
+
+// remove removes child, a member or element of n by identity, and reports
+// whether it found it
+func (n *node) remove(child *node) bool {
+	for i, m := range n.members {
+		if m.value == child {
+			n.members = append(n.members[:i], n.members[i+1:]...)
+			return true
+		}
+	}
+	for i, elem := range n.arr {
+		if elem == child {
+			n.arr = append(n.arr[:i], n.arr[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// length returns the number of elements, members or bytes of n
+func (n *node) length() int {
+	switch n.kind {
+	case kindArray:
+		return len(n.arr)
+	case kindObject:
+		return len(n.members)
+	case kindString:
+		return len(n.s)
+	}
+	return 0
+}
+
+// float returns a number as a float64
+func (n *node) float() float64 {
+	if n.kind == kindInteger {
+		return float64(n.i)
+	}
+	return n.f
+}
+
+// isNumber reports whether n is an integer or another number
+func (n *node) isNumber() bool {
+	return n.kind == kindInteger || n.kind == kindNumber
+}
+
+// clone returns a deep copy of n
+func (n *node) clone() *node {
+	c := *n
+	if n.arr != nil {
+		c.arr = make([]*node, len(n.arr))
+		for i, elem := range n.arr {
+			c.arr[i] = elem.clone()
+		}
+	}
+	if n.members != nil {
+		c.members = make([]member, len(n.members))
+		for i, m := range n.members {
+			c.members[i] = member{m.key, m.value.clone()}
+		}
+	}
+	return &c
+}
+
+// equal reports whether n and other are the same JSON value. Numbers compare
+// by value, so 1 equals 1.0.
+func (n *node) equal(other *node) bool {
+	if n.isNumber() && other.isNumber() {
+		if n.kind == kindInteger && other.kind == kindInteger {
+			return n.i == other.i
+		}
+		return n.float() == other.float()
+	}
+	if n.kind != other.kind {
+		return false
+	}
+	switch n.kind {
+	case kindBool:
+		return n.b == other.b
+	case kindString:
+		return n.s == other.s
+	case kindArray:
+		if len(n.arr) != len(other.arr) {
+			return false
+		}
+		for i, elem := range n.arr {
+			if !elem.equal(other.arr[i]) {
+				return false
+			}
+		}
+	case kindObject:
+		if len(n.members) != len(other.members) {
+			return false
+		}
+		for _, m := range n.members {
+			if o := other.get(m.key); o == nil || !m.value.equal(o) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// merge applies patch to n as a JSON Merge Patch (RFC 7386) and returns the
+// result: members of an object patch are merged into an object, null members
+// removing theirs, and any other patch replaces n
+func merge(n, patch *node) *node {
+	if patch.kind != kindObject {
+		return patch.clone()
+	}
+	if n == nil || n.kind != kindObject {
+		n = &node{kind: kindObject, members: []member{}}
+	}
+	for _, m := range patch.members {
+		old := n.get(m.key)
+		switch {
+		case m.value.kind == kindNull:
+			if old != nil {
+				n.remove(old)
+			}
+		default:
+			n.set(m.key, merge(old, m.value))
+		}
+	}
+	return n
+}
+
+// memory estimates the bytes n takes, as JSON.DEBUG MEMORY reports
+func (n *node) memory() int {
+	size := 48 // the node itself
+	size += len(n.s)
+	for _, elem := range n.arr {
+		size += 8 + elem.memory()
+	}
+	for _, m := range n.members {
+		size += 24 + len(m.key) + m.value.memory()
+	}
+	return size
+}
+
+// format is how String lays out JSON: the indentation per level, what ends
+// a line and what follows the colon of a member. The zero format is compact.
+type format struct {
+	indent, newline, space string
+}
+
+// String returns n as compact JSON
+func (n *node) String() string {
+	return n.format(format{})
+}
+
+// format returns n as JSON laid out per f
+func (n *node) format(f format) string {
+	var b strings.Builder
+	n.write(&b, f, 0)
+	return b.String()
+}
+
+// write writes n at nesting depth level
+func (n *node) write(b *strings.Builder, f format, level int) {
+	switch n.kind {
+	case kindNull:
+		b.WriteString("null")
+	case kindBool:
+		b.WriteString(strconv.FormatBool(n.b))
+	case kindInteger:
+		b.WriteString(strconv.FormatInt(n.i, 10))
+	case kindNumber:
+		b.WriteString(formatFloat(n.f))
+	case kindString:
+		writeString(b, n.s)
+	case kindArray:
+		if len(n.arr) == 0 {
+			b.WriteString("[]")
+			return
+		}
+		b.WriteByte('[')
+		for i, elem := range n.arr {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			f.breakLine(b, level+1)
+			elem.write(b, f, level+1)
+		}
+		f.breakLine(b, level)
+		b.WriteByte(']')
+	case kindObject:
+		if len(n.members) == 0 {
+			b.WriteString("{}")
+			return
+		}
+		b.WriteByte('{')
+		for i, m := range n.members {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			f.breakLine(b, level+1)
+			writeString(b, m.key)
+			b.WriteByte(':')
+			b.WriteString(f.space)
+			m.value.write(b, f, level+1)
+		}
+		f.breakLine(b, level)
+		b.WriteByte('}')
+	}
+}
+
+// breakLine starts a line indented to level
+func (f format) breakLine(b *strings.Builder, level int) {
+	b.WriteString(f.newline)
+	for range level {
+		b.WriteString(f.indent)
+	}
+}
+
+// formatFloat formats a number that isn't an integer the way RedisJSON
+// does, always with a fraction or an exponent: 3.0, 0.5, 1e21
+func formatFloat(f float64) string {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return "null"
+	}
+	abs := math.Abs(f)
+	if abs != 0 && (abs < 1e-5 || abs >= 1e16) {
+		s := strconv.FormatFloat(f, 'e', -1, 64)
+		mantissa, exp, _ := strings.Cut(s, "e")
+		exp = strings.TrimPrefix(exp, "+")
+		if neg := strings.HasPrefix(exp, "-"); neg {
+			exp = "-" + strings.TrimLeft(exp[1:], "0")
+		} else {
+			exp = strings.TrimLeft(exp, "0")
+		}
+		return mantissa + "e" + exp
+	}
+	s := strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
+}
+
+// writeString writes s as a JSON string. Unlike encoding/json it leaves <, >
+// and & unescaped.
+func writeString(b *strings.Builder, s string) {
+	const hex = "0123456789abcdef"
+	b.WriteByte('"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if r == utf8.RuneError && size == 1 {
+				b.WriteString("\ufffd")
+			} else {
+				b.WriteString(s[i : i+size])
+			}
+			i += size
+			continue
+		}
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '\r':
+			b.WriteString(`\r`)
+		case c == '\t':
+			b.WriteString(`\t`)
+		case c < 0x20:
+			b.WriteString(`\u00`)
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&0xf])
+		default:
+			b.WriteByte(c)
+		}
+		i++
+	}
+	b.WriteByte('"')
+}
@@ -0,0 +1,611 @@
+package json
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// path is a parsed path into a document. A JSONPath starts with $ and
+// selects any number of values; commands reply with an array for it. A
+// legacy path such as .a.b or a[0], from RedisJSON 1, is converted to the
+// JSONPath $.a.b, but commands reply with its first value only and fail if
+// it selects none.
+type path struct {
+	text     string
+	legacy   bool
+	segments []segment
+}
+
+// segment is a step of a path: selectors applied to the children of the
+// current values, or with descend to those of all their descendants too
+type segment struct {
+	descend   bool
+	selectors []selector
+}
+
+// selectorKind is the type of a selector
+type selectorKind int
+
+const (
+	selectName     selectorKind = iota // .name or ['name']
+	selectWildcard                     // .* or [*]
+	selectIndex                        // [1] or [-1]
+	selectSlice                        // [start:end:step]
+	selectFilter                       // [?@.a > 1]
+)
+
+// selector picks children of a value
+type selector struct {
+	kind             selectorKind
+	name             string
+	index            int
+	start, end, step *int
+	filter           expr
+}
+
+// rootPath is the path of the whole document, the default of most commands
+var rootPath = &path{text: ".", legacy: true}
+
+// isRoot reports whether p selects only the whole document
+func (p *path) isRoot() bool {
+	return len(p.segments) == 0
+}
+
+// parsePath parses a JSONPath or a legacy path
+func parsePath(text string) (*path, error) {
+	p := &path{text: text}
+	var rest string
+	switch {
+	case strings.HasPrefix(text, "$"):
+		rest = text[1:]
+	case text == ".":
+		p.legacy = true
+	case strings.HasPrefix(text, ".") || strings.HasPrefix(text, "["):
+		p.legacy, rest = true, text
+	default:
+		p.legacy, rest = true, "."+text
+	}
+	parser := &pathParser{s: rest}
+	var err error
+	if p.segments, err = parser.segments(); err == nil && parser.pos < len(parser.s) {
+		err = parser.errorf("unexpected %q", parser.s[parser.pos:])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSONPath %q: %w", text, err)
+	}
+	return p, nil
+}
+
+// match is a value selected by a path and the array or object holding it,
+// nil for the document itself
+type match struct {
+	node   *node
+	parent *node
+}
+
+// eval returns the values p selects in root
+func (p *path) eval(root *node) []match {
+	return evalSegments(p.segments, []match{{node: root}}, root)
+}
+
+// evalSegments applies segments in turn to the values in
+func evalSegments(segments []segment, in []match, root *node) []match {
+	for _, s := range segments {
+		var out []match
+		for _, m := range in {
+			if s.descend {
+				descendants(m.node, func(n *node) {
+					out = s.apply(n, root, out)
+				})
+			} else {
+				out = s.apply(m.node, root, out)
+			}
+		}
+		in = out
+	}
+	return in
+}
+
+// descendants calls fn for n and every value nested in it
+func descendants(n *node, fn func(n *node)) {
+	fn(n)
+	for _, elem := range n.arr {
+		descendants(elem, fn)
+	}
+	for _, m := range n.members {
+		descendants(m.value, fn)
+	}
+}
+
+// apply appends the children of n the segment's selectors pick to out
+func (s *segment) apply(n *node, root *node, out []match) []match {
+	for _, sel := range s.selectors {
+		switch sel.kind {
+		case selectName:
+			if n.kind == kindObject {
+				if child := n.get(sel.name); child != nil {
+					out = append(out, match{child, n})
+				}
+			}
+		case selectWildcard:
+			children(n, func(child *node) {
+				out = append(out, match{child, n})
+			})
+		case selectIndex:
+			if n.kind == kindArray {
+				i := sel.index
+				if i < 0 {
+					i += len(n.arr)
+				}
+				if i >= 0 && i < len(n.arr) {
+					out = append(out, match{n.arr[i], n})
+				}
+			}
+		case selectSlice:
+			if n.kind == kindArray {
+				for _, i := range sel.sliceIndexes(len(n.arr)) {
+					out = append(out, match{n.arr[i], n})
+				}
+			}
+		case selectFilter:
+			children(n, func(child *node) {
+				if sel.filter.eval(child, root) {
+					out = append(out, match{child, n})
+				}
+			})
+		}
+	}
+	return out
+}
+
+// children calls fn for the elements of an array or the member values of an
+// object
+func children(n *node, fn func(child *node)) {
+	for _, elem := range n.arr {
+		fn(elem)
+	}
+	for _, m := range n.members {
+		fn(m.value)
+	}
+}
+
+// sliceIndexes returns the indexes a slice selects in an array of n elements,
+// as a Python slice does
+func (sel *selector) sliceIndexes(n int) []int {
+	step := 1
+	if sel.step != nil {
+		step = *sel.step
+	}
+	if step == 0 {
+		return nil
+	}
+	bound := func(p *int, def int) int {
+		if p == nil {
+			return def
+		}
+		i := *p
+		if i < 0 {
+			i += n
+		}
+		if step > 0 {
+			return min(max(i, 0), n)
+		}
+		return min(max(i, -1), n-1)
+	}
+	var indexes []int
+	if step > 0 {
+		for i := bound(sel.start, 0); i < bound(sel.end, n); i += step {
+			indexes = append(indexes, i)
+		}
+	} else {
+		for i := bound(sel.start, n-1); i > bound(sel.end, -1); i += step {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// pathParser parses the segments of a path and the filters in them
+type pathParser struct {
+	s   string
+	pos int
+}
+
+func (p *pathParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("at offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *pathParser) peek() byte {
+	if p.pos < len(p.s) {
+		return p.s[p.pos]
+	}
+	return 0
+}
+
+func (p *pathParser) skipSpaces() {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// consume consumes prefix if the input continues with it
+func (p *pathParser) consume(prefix string) bool {
+	if strings.HasPrefix(p.s[p.pos:], prefix) {
+		p.pos += len(prefix)
+		return true
+	}
+	return false
+}
+
+// segments parses segments for as long as the input continues with . or [
+func (p *pathParser) segments() ([]segment, error) {
+	var segments []segment
+	for {
+		var s segment
+		switch {
+		case p.consume(".."):
+			s.descend = true
+			if p.peek() == '[' {
+				p.pos++
+				sels, err := p.brackets()
+				if err != nil {
+					return nil, err
+				}
+				s.selectors = sels
+				break
+			}
+			fallthrough
+		case p.consume("."):
+			if p.consume("*") {
+				s.selectors = []selector{{kind: selectWildcard}}
+				break
+			}
+			name := p.name()
+			if name == "" {
+				return nil, p.errorf("expected a member name")
+			}
+			s.selectors = []selector{{kind: selectName, name: name}}
+		case p.consume("["):
+			sels, err := p.brackets()
+			if err != nil {
+				return nil, err
+			}
+			s.selectors = sels
+		default:
+			return segments, nil
+		}
+		segments = append(segments, s)
+	}
+}
+
+// name consumes a member name written without quotes
+func (p *pathParser) name() string {
+	start := p.pos
+	for p.pos < len(p.s) {
+		c := rune(p.s[p.pos])
+		if strings.ContainsRune(".[]()=!<>&|,'\" ~", c) || unicode.IsSpace(c) {
+			break
+		}
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+// brackets parses the selectors of a bracketed segment after its [
+func (p *pathParser) brackets() ([]selector, error) {
+	var sels []selector
+	for {
+		p.skipSpaces()
+		sel, err := p.selector()
+		if err != nil {
+			return nil, err
+		}
+		sels = append(sels, sel)
+		p.skipSpaces()
+		switch {
+		case p.consume("]"):
+			return sels, nil
+		case !p.consume(","):
+			return nil, p.errorf("expected , or ]")
+		}
+	}
+}
+
+// selector parses a selector of a bracketed segment
+func (p *pathParser) selector() (selector, error) {
+	switch c := p.peek(); {
+	case c == '\'' || c == '"':
+		name, err := p.quoted()
+		return selector{kind: selectName, name: name}, err
+	case c == '*':
+		p.pos++
+		return selector{kind: selectWildcard}, nil
+	case c == '?':
+		p.pos++
+		filter, err := p.or()
+		return selector{kind: selectFilter, filter: filter}, err
+	}
+
+	// An index, or a slice of up to three optional integers
+	var parts [3]*int
+	n := 0
+	for ; n < 3; n++ {
+		p.skipSpaces()
+		start := p.pos
+		if p.peek() == '-' {
+			p.pos++
+		}
+		for p.pos < len(p.s) && p.s[p.pos] >= '0' && p.s[p.pos] <= '9' {
+			p.pos++
+		}
+		if p.pos > start {
+			i, err := strconv.Atoi(p.s[start:p.pos])
+			if err != nil {
+				return selector{}, p.errorf("invalid index %q", p.s[start:p.pos])
+			}
+			parts[n] = &i
+		}
+		p.skipSpaces()
+		if !p.consume(":") {
+			break
+		}
+	}
+	switch {
+	case n == 0 && parts[0] != nil:
+		return selector{kind: selectIndex, index: *parts[0]}, nil
+	case n > 0:
+		return selector{kind: selectSlice, start: parts[0], end: parts[1], step: parts[2]}, nil
+	}
+	return selector{}, p.errorf("expected a selector")
+}
+
+// quoted parses a string in single or double quotes
+func (p *pathParser) quoted() (string, error) {
+	quote := p.s[p.pos]
+	p.pos++
+	var b strings.Builder
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		p.pos++
+		switch {
+		case c == quote:
+			return b.String(), nil
+		case c == '\\' && p.pos < len(p.s):
+			b.WriteByte(p.s[p.pos])
+			p.pos++
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// expr is a filter expression, true for the values a filter selects
+type expr interface {
+	eval(cur, root *node) bool
+}
+
+type orExpr []expr
+type andExpr []expr
+type notExpr struct{ e expr }
+
+// existsExpr is a path alone, true if it selects a value
+type existsExpr struct{ o operand }
+
+// compareExpr compares two operands with ==, !=, <, <=, >, >= or =~
+type compareExpr struct {
+	left, right operand
+	op          string
+	re          *regexp.Regexp
+}
+
+// operand is a literal, or a path from the current value (@) or the root ($)
+type operand struct {
+	literal  *node
+	fromRoot bool
+	segments []segment
+}
+
+func (e orExpr) eval(cur, root *node) bool {
+	for _, sub := range e {
+		if sub.eval(cur, root) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e andExpr) eval(cur, root *node) bool {
+	for _, sub := range e {
+		if !sub.eval(cur, root) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e notExpr) eval(cur, root *node) bool {
+	return !e.e.eval(cur, root)
+}
+
+func (e existsExpr) eval(cur, root *node) bool {
+	return e.o.value(cur, root) != nil
+}
+
+// value returns the value of the operand, nil if its path selects none
+func (o *operand) value(cur, root *node) *node {
+	if o.literal != nil {
+		return o.literal
+	}
+	start := cur
+	if o.fromRoot {
+		start = root
+	}
+	matches := evalSegments(o.segments, []match{{node: start}}, root)
+	if len(matches) == 0 {
+		return nil
+	}
+	return matches[0].node
+}
+
+func (e *compareExpr) eval(cur, root *node) bool {
+	left, right := e.left.value(cur, root), e.right.value(cur, root)
+	if left == nil || right == nil {
+		// Only != holds against a value that doesn't exist
+		return e.op == "!=" && (left != nil || right != nil)
+	}
+	switch e.op {
+	case "==":
+		return left.equal(right)
+	case "!=":
+		return !left.equal(right)
+	case "=~":
+		return left.kind == kindString && e.re != nil && e.re.MatchString(left.s)
+	}
+	var c int
+	switch {
+	case left.isNumber() && right.isNumber():
+		c = compareFloats(left.float(), right.float())
+	case left.kind == kindString && right.kind == kindString:
+		c = strings.Compare(left.s, right.s)
+	default:
+		return false
+	}
+	switch e.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c >= 0
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// or parses expr || expr ...
+func (p *pathParser) or() (expr, error) {
+	var e orExpr
+	for {
+		sub, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		e = append(e, sub)
+		p.skipSpaces()
+		if !p.consume("||") {
+			break
+		}
+	}
+	if len(e) == 1 {
+		return e[0], nil
+	}
+	return e, nil
+}
+
+// and parses expr && expr ...
+func (p *pathParser) and() (expr, error) {
+	var e andExpr
+	for {
+		sub, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		e = append(e, sub)
+		p.skipSpaces()
+		if !p.consume("&&") {
+			break
+		}
+	}
+	if len(e) == 1 {
+		return e[0], nil
+	}
+	return e, nil
+}
+
+// compareOps are the comparison operators, longest first
+var compareOps = []string{"==", "!=", "<=", ">=", "=~", "<", ">"}
+
+// unary parses !expr, (expr), or a comparison or path
+func (p *pathParser) unary() (expr, error) {
+	p.skipSpaces()
+	switch {
+	case p.consume("!") && !strings.HasPrefix(p.s[p.pos:], "="):
+		e, err := p.unary()
+		return notExpr{e}, err
+	case p.consume("("):
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpaces()
+		if !p.consume(")") {
+			return nil, p.errorf("expected )")
+		}
+		return e, nil
+	}
+
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	for _, op := range compareOps {
+		if !p.consume(op) {
+			continue
+		}
+		p.skipSpaces()
+		right, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		e := &compareExpr{left: left, right: right, op: op}
+		if op == "=~" {
+			if right.literal == nil || right.literal.kind != kindString {
+				return nil, p.errorf("=~ needs a string pattern")
+			}
+			if e.re, err = regexp.Compile(right.literal.s); err != nil {
+				return nil, p.errorf("invalid pattern: %v", err)
+			}
+		}
+		return e, nil
+	}
+	if left.literal != nil {
+		return nil, p.errorf("expected a comparison")
+	}
+	return existsExpr{left}, nil
+}
+
+// operand parses a path from @ or $, or a literal
+func (p *pathParser) operand() (operand, error) {
+	switch c := p.peek(); {
+	case c == '@' || c == '$':
+		p.pos++
+		segments, err := p.segments()
+		return operand{fromRoot: c == '$', segments: segments}, err
+	case c == '\'' || c == '"':
+		s, err := p.quoted()
+		return operand{literal: newString(s)}, err
+	}
+	start := p.pos
+	for p.pos < len(p.s) && !strings.ContainsRune(" )]&|=!<>,", rune(p.s[p.pos])) {
+		p.pos++
+	}
+	literal, err := parse(p.s[start:p.pos])
+	if err != nil || p.pos == start {
+		return operand{}, p.errorf("invalid operand %q", p.s[start:p.pos])
+	}
+	return operand{literal: literal}, nil
+}
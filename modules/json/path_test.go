@@ -0,0 +1,128 @@
+package json
+
+import (
+	"strings"
+	"testing"
+)
+
+const storeDoc = `{
+	"store": {
+		"book": [
+			{"category": "reference", "author": "Nigel Rees", "title": "Sayings of the Century", "price": 8.95},
+			{"category": "fiction", "author": "Evelyn Waugh", "title": "Sword of Honour", "price": 12.99},
+			{"category": "fiction", "author": "Herman Melville", "title": "Moby Dick", "isbn": "0-553-21311-3", "price": 8.99},
+			{"category": "fiction", "author": "J. R. R. Tolkien", "title": "The Lord of the Rings", "isbn": "0-395-19395-8", "price": 22.99}
+		],
+		"bicycle": {"color": "red", "price": 19.95},
+		"a.b": 1
+	}
+}`
+
+// TestPaths tests the values paths select from a document
+func TestPaths(t *testing.T) {
+	root, err := parse(storeDoc)
+	if err != nil {
+		t.Fatalf("Failed to parse the document: %v", err)
+	}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"$.store.book[*].author", `["Nigel Rees","Evelyn Waugh","Herman Melville","J. R. R. Tolkien"]`},
+		{"$..author", `["Nigel Rees","Evelyn Waugh","Herman Melville","J. R. R. Tolkien"]`},
+		{"$.store.*.color", `["red"]`},
+		{"$..book[2].title", `["Moby Dick"]`},
+		{"$..book[-1].title", `["The Lord of the Rings"]`},
+		{"$..book[0,1].price", `[8.95,12.99]`},
+		{"$..book[:2].category", `["reference","fiction"]`},
+		{"$..book[1:].category", `["fiction","fiction","fiction"]`},
+		{"$..book[::-2].price", `[22.99,12.99]`},
+		{"$..book[?(@.isbn)].title", `["Moby Dick","The Lord of the Rings"]`},
+		{"$..book[?(@.price < 10)].title", `["Sayings of the Century","Moby Dick"]`},
+		{"$..book[?@.price > 10 && @.category == 'fiction'].price", `[12.99,22.99]`},
+		{"$..book[?(@.price < 9 || !(@.author =~ 'T.*'))].price", `[8.95,12.99,8.99]`},
+		{"$..book[?(@.price > $.store.bicycle.price)].title", `["The Lord of the Rings"]`},
+		{"$..book[?(@.missing != 1)].price", `[8.95,12.99,8.99,22.99]`},
+		{"$.store['a.b']", `[1]`},
+		{`$.store["bicycle"]["color"]`, `["red"]`},
+		{"$.missing", `[]`},
+		{"$", `[` + mustParse(t, storeDoc).String() + `]`},
+		{".store.bicycle.color", `["red"]`},
+		{"store.bicycle", `[{"color":"red","price":19.95}]`},
+		{"[\"store\"].bicycle.price", `[19.95]`},
+		{".", `[` + mustParse(t, storeDoc).String() + `]`},
+	}
+	for _, tt := range tests {
+		p, err := parsePath(tt.path)
+		if err != nil {
+			t.Errorf("Failed to parse %s: %v", tt.path, err)
+			continue
+		}
+		got := &node{kind: kindArray, arr: []*node{}}
+		for _, m := range p.eval(root) {
+			got.arr = append(got.arr, m.node)
+		}
+		if got.String() != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.path, tt.expected, got)
+		}
+	}
+}
+
+// TestPathErrors tests paths that don't parse
+func TestPathErrors(t *testing.T) {
+	for _, text := range []string{"$.", "$[", "$[1", "$['a", "$[?(@.a ==)]", "$[?(@.a =~ 1)]", "$.a)", "$..", "$[a]"} {
+		if _, err := parsePath(text); err == nil || !strings.Contains(err.Error(), "invalid JSONPath") {
+			t.Errorf("Expected an error parsing %q, got %v", text, err)
+		}
+	}
+}
+
+// TestPathLegacy tests which paths are legacy ones
+func TestPathLegacy(t *testing.T) {
+	for text, legacy := range map[string]bool{".": true, "a": true, ".a[0]": true, "[0]": true, "$": false, "$.a": false} {
+		p, err := parsePath(text)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", text, err)
+		}
+		if p.legacy != legacy {
+			t.Errorf("%s: expected legacy %v", text, legacy)
+		}
+	}
+}
+
+// TestNodeFormat tests the JSON text of values
+func TestNodeFormat(t *testing.T) {
+	n := mustParse(t, `{"a":[1,2.5,1e21,"x<y"],"b":{},"c":[],"d":null}`)
+	if got, expected := n.String(), `{"a":[1,2.5,1e21,"x<y"],"b":{},"c":[],"d":null}`; got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+	expected := "{\n  \"a\": [\n    1,\n    2.5,\n    1e21,\n    \"x<y\"\n  ],\n  \"b\": {},\n  \"c\": [],\n  \"d\": null\n}"
+	if got := n.format(format{indent: "  ", newline: "\n", space: " "}); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+	if got := newNumber(3).String(); got != "3.0" {
+		t.Errorf("Expected 3.0, got %s", got)
+	}
+	if _, err := parse(`{"a":1} x`); err == nil {
+		t.Error("Expected an error for trailing characters")
+	}
+}
+
+// TestMerge tests JSON Merge Patch
+func TestMerge(t *testing.T) {
+	n := mustParse(t, `{"a":1,"b":{"c":2,"d":3},"e":[1]}`)
+	got := merge(n, mustParse(t, `{"a":null,"b":{"c":4,"x":null},"e":{"f":5},"g":6}`))
+	if expected := `{"b":{"c":4,"d":3},"e":{"f":5},"g":6}`; got.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+}
+
+func mustParse(t *testing.T, text string) *node {
+	t.Helper()
+	n, err := parse(text)
+	if err != nil {
+		t.Fatalf("Failed to parse %s: %v", text, err)
+	}
+	return n
+}
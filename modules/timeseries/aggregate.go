@@ -0,0 +1,156 @@
+package timeseries
+
+import (
+	"math"
+	"slices"
+	"strings"
+)
+
+// aggregations are the aggregation types of AGGREGATION, of compaction rules
+// and of REDUCE
+var aggregations = []string{"avg", "sum", "min", "max", "range", "count", "first", "last", "std.p", "std.s", "var.p", "var.s"}
+
+// parseAggregation returns the aggregation type named by arg, false if it
+// names none
+func parseAggregation(arg string) (string, bool) {
+	agg := strings.ToLower(arg)
+	return agg, slices.Contains(aggregations, agg)
+}
+
+// aggregator accumulates the values of a bucket. It keeps the running mean
+// and sum of squared deviations (Welford's method) for the variance.
+type aggregator struct {
+	agg                   string
+	n                     int
+	sum, min, max         float64
+	first, last, mean, sq float64
+}
+
+func (a *aggregator) add(v float64) {
+	if a.n == 0 {
+		a.min, a.max, a.first = v, v, v
+	}
+	a.n++
+	a.sum += v
+	a.min, a.max, a.last = min(a.min, v), max(a.max, v), v
+	delta := v - a.mean
+	a.mean += delta / float64(a.n)
+	a.sq += delta * (v - a.mean)
+}
+
+// value returns the aggregate of the values added
+func (a *aggregator) value() float64 {
+	switch a.agg {
+	case "avg":
+		return a.mean
+	case "sum":
+		return a.sum
+	case "min":
+		return a.min
+	case "max":
+		return a.max
+	case "range":
+		return a.max - a.min
+	case "count":
+		return float64(a.n)
+	case "first":
+		return a.first
+	case "last":
+		return a.last
+	case "var.p":
+		return a.sq / float64(a.n)
+	case "var.s":
+		if a.n < 2 {
+			return 0
+		}
+		return a.sq / float64(a.n-1)
+	case "std.p":
+		return math.Sqrt(a.sq / float64(a.n))
+	case "std.s":
+		if a.n < 2 {
+			return 0
+		}
+		return math.Sqrt(a.sq / float64(a.n-1))
+	}
+	return math.NaN()
+}
+
+// aggregate returns the aggregate of values
+func aggregate(agg string, values []float64) float64 {
+	a := aggregator{agg: agg}
+	for _, v := range values {
+		a.add(v)
+	}
+	return a.value()
+}
+
+// bucketStart returns the start of the bucket of ts, buckets being duration
+// long and one of them starting at align
+func bucketStart(ts, duration, align int64) int64 {
+	offset := (ts - align) % duration
+	if offset < 0 {
+		offset += duration
+	}
+	return ts - offset
+}
+
+// bucketing is how a range query aggregates samples into buckets
+type bucketing struct {
+	agg       string
+	duration  int64
+	align     int64
+	timestamp string // -, + or ~: report the start, end or middle of buckets
+	empty     bool   // report buckets without samples too
+}
+
+// apply aggregates samples, in timestamp order, into a sample per bucket
+func (b *bucketing) apply(samples []Sample) []Sample {
+	var out []Sample
+	a := aggregator{agg: b.agg}
+	start := int64(0)
+	for _, sample := range samples {
+		bucket := bucketStart(sample.Timestamp, b.duration, b.align)
+		if a.n > 0 && bucket != start {
+			out = append(out, Sample{b.report(start), a.value()})
+			if b.empty {
+				out = b.fill(out, start+b.duration, bucket, a.last)
+			}
+			a = aggregator{agg: b.agg}
+		}
+		if a.n == 0 {
+			start = bucket
+		}
+		a.add(sample.Value)
+	}
+	if a.n > 0 {
+		out = append(out, Sample{b.report(start), a.value()})
+	}
+	return out
+}
+
+// fill appends the empty buckets from start up to end: 0 for sum and count,
+// the last value before them for last, and NaN otherwise
+func (b *bucketing) fill(out []Sample, start, end int64, last float64) []Sample {
+	value := math.NaN()
+	switch b.agg {
+	case "sum", "count":
+		value = 0
+	case "last":
+		value = last
+	}
+	for ts := start; ts < end; ts += b.duration {
+		out = append(out, Sample{b.report(ts), value})
+	}
+	return out
+}
+
+// report returns the timestamp reported for the bucket starting at start
+func (b *bucketing) report(start int64) int64 {
+	switch b.timestamp {
+	case "+":
+		return start + b.duration
+	case "~":
+		return start + b.duration/2
+	}
+	return start
+}
@@ -0,0 +1,734 @@
+package timeseries
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/l00pss/redkit"
+	"github.com/l00pss/redkit/args"
+	"github.com/l00pss/redkit/store"
+)
+
+// commands returns the TS commands as a command set
+func (m *module) commands() *redkit.CommandSet {
+	cs := redkit.NewCommandSet("timeseries")
+	cs.RegisterFunc(string(redkit.TS_CREATE), m.create, redkit.MinArgs(1), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdWrite), redkit.WithCategories("timeseries"), redkit.WithSummary("Create a new time series"))
+	cs.RegisterFunc(string(redkit.TS_ALTER), m.alter, redkit.MinArgs(1), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdWrite), redkit.WithCategories("timeseries"), redkit.WithSummary("Update the retention, chunk size, duplicate policy, and labels of an existing time series"))
+	cs.RegisterFunc(string(redkit.TS_ADD), m.add, redkit.MinArgs(3), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdWrite), redkit.WithCategories("timeseries"), redkit.WithSummary("Append a sample to a time series"))
+	cs.RegisterFunc(string(redkit.TS_MADD), m.madd, redkit.MinArgs(3), redkit.WithKeys(1, -1, 3), redkit.WithFlags(redkit.CmdWrite), redkit.WithCategories("timeseries"), redkit.WithSummary("Append new samples to one or more time series"))
+	cs.RegisterFunc(string(redkit.TS_INCRBY), m.incrby(1), redkit.MinArgs(2), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdWrite), redkit.WithCategories("timeseries"), redkit.WithSummary("Increase the value of the sample with the maximum existing timestamp, or create a new sample with a value equal to the value of the sample with the maximum existing timestamp with a given increment"))
+	cs.RegisterFunc(string(redkit.TS_DECRBY), m.incrby(-1), redkit.MinArgs(2), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdWrite), redkit.WithCategories("timeseries"), redkit.WithSummary("Decrease the value of the sample with the maximum existing timestamp, or create a new sample with a value equal to the value of the sample with the maximum existing timestamp with a given decrement"))
+	cs.RegisterFunc(string(redkit.TS_DEL), m.del, redkit.ExactArgs(3), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdWrite), redkit.WithCategories("timeseries"), redkit.WithSummary("Delete all samples between two timestamps for a given time series"))
+	cs.RegisterFunc(string(redkit.TS_GET), m.get, redkit.RangeArgs(1, 2), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdReadOnly|redkit.CmdFast), redkit.WithCategories("timeseries"), redkit.WithSummary("Get the sample with the highest timestamp from a given time series"))
+	cs.RegisterFunc(string(redkit.TS_INFO), m.info, redkit.RangeArgs(1, 2), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdReadOnly), redkit.WithCategories("timeseries"), redkit.WithSummary("Returns information and statistics for a time series"))
+	cs.RegisterFunc(string(redkit.TS_RANGE), m.rangeSamples(false), redkit.MinArgs(3), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdReadOnly), redkit.WithCategories("timeseries"), redkit.WithSummary("Query a range in forward direction"))
+	cs.RegisterFunc(string(redkit.TS_REVRANGE), m.rangeSamples(true), redkit.MinArgs(3), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdReadOnly), redkit.WithCategories("timeseries"), redkit.WithSummary("Query a range in reverse direction"))
+	cs.RegisterFunc(string(redkit.TS_MRANGE), m.mrange(false), redkit.MinArgs(4), redkit.WithFlags(redkit.CmdReadOnly), redkit.WithCategories("timeseries"), redkit.WithSummary("Query a range across multiple time series by filters in forward direction"))
+	cs.RegisterFunc(string(redkit.TS_MREVRANGE), m.mrange(true), redkit.MinArgs(4), redkit.WithFlags(redkit.CmdReadOnly), redkit.WithCategories("timeseries"), redkit.WithSummary("Query a range across multiple time-series by filters in reverse direction"))
+	cs.RegisterFunc(string(redkit.TS_MGET), m.mget, redkit.MinArgs(2), redkit.WithFlags(redkit.CmdReadOnly), redkit.WithCategories("timeseries"), redkit.WithSummary("Get the sample with the highest timestamp from each time series matching a specific filter"))
+	cs.RegisterFunc(string(redkit.TS_QUERYINDEX), m.queryindex, redkit.MinArgs(1), redkit.WithFlags(redkit.CmdReadOnly), redkit.WithCategories("timeseries"), redkit.WithSummary("Get all time series keys matching a filter list"))
+	cs.RegisterFunc(string(redkit.TS_CREATERULE), m.createrule, redkit.RangeArgs(5, 6), redkit.WithKeys(1, 2, 1), redkit.WithFlags(redkit.CmdWrite), redkit.WithCategories("timeseries"), redkit.WithSummary("Create a compaction rule"))
+	cs.RegisterFunc(string(redkit.TS_DELETERULE), m.deleterule, redkit.ExactArgs(2), redkit.WithKeys(1, 2, 1), redkit.WithFlags(redkit.CmdWrite), redkit.WithCategories("timeseries"), redkit.WithSummary("Delete a compaction rule"))
+	return cs
+}
+
+var (
+	errNoKey       = errors.New("TSDB: the key does not exist")
+	errKeyExists   = errors.New("TSDB: key already exists")
+	errRetention   = errors.New("TSDB: Couldn't parse RETENTION")
+	errChunkSize   = errors.New("TSDB: CHUNK_SIZE value must be a multiple of 8 in the range [48 .. 1048576]")
+	errPolicy      = errors.New("TSDB: Unknown DUPLICATE_POLICY")
+	errEncoding    = errors.New("TSDB: unknown ENCODING parameter")
+	errLabels      = errors.New("TSDB: Invalid labels")
+	errIncrTime    = errors.New("TSDB: timestamp must be equal to or higher than the maximum existing timestamp")
+	errSameKey     = errors.New("TSDB: the source key and destination key should be different")
+	errHasSource   = errors.New("TSDB: the destination key already has a src rule")
+	errChained     = errors.New("TSDB: compaction rules can't be chained")
+	errNoRule      = errors.New("TSDB: compaction rule does not exist")
+	errAggregateBy = errors.New("TSDB: AGGREGATION needs an aggregation type and a bucket duration")
+)
+
+func integer(n int64) redkit.RedisValue {
+	return redkit.RedisValue{Type: redkit.Integer, Int: n}
+}
+
+func bulk(s string) redkit.RedisValue {
+	return redkit.RedisValue{Type: redkit.BulkString, Bulk: []byte(s)}
+}
+
+func array(values []redkit.RedisValue) redkit.RedisValue {
+	return redkit.RedisValue{Type: redkit.Array, Array: values}
+}
+
+var ok = redkit.RedisValue{Type: redkit.SimpleString, Str: "OK"}
+
+// sampleReply returns a sample as its timestamp and value
+func sampleReply(sample Sample) redkit.RedisValue {
+	return array([]redkit.RedisValue{integer(sample.Timestamp), {Type: redkit.Double, Float: sample.Value}})
+}
+
+// samplesReply returns samples as an array of sampleReply
+func samplesReply(samples []Sample) redkit.RedisValue {
+	reply := make([]redkit.RedisValue, len(samples))
+	for i, sample := range samples {
+		reply[i] = sampleReply(sample)
+	}
+	return array(reply)
+}
+
+// labelsReply returns labels as an array of name and value pairs
+func labelsReply(labels []Label) redkit.RedisValue {
+	reply := make([]redkit.RedisValue, len(labels))
+	for i, l := range labels {
+		reply[i] = array([]redkit.RedisValue{bulk(l.Name), bulk(l.Value)})
+	}
+	return array(reply)
+}
+
+// options are the settings TS.CREATE, TS.ALTER, TS.ADD and TS.INCRBY take
+// for a series, nil or empty if not given
+type options struct {
+	retention   *int64
+	chunkSize   *int64
+	compressed  *bool
+	policy      string
+	onDuplicate string // TS.ADD only
+	labels      []Label
+	hasLabels   bool
+	timestamp   *int64 // TS.INCRBY and TS.DECRBY only
+}
+
+// parseOptions parses the options of cmd
+func parseOptions(p *args.Parser, cmd redkit.CommandType) (*options, error) {
+	o := &options{}
+	for p.More() && p.Err() == nil {
+		var n int64
+		var s string
+		switch {
+		case p.MatchKeyword("RETENTION", &n):
+			if n < 0 {
+				return nil, errRetention
+			}
+			o.retention = &n
+		case p.MatchKeyword("CHUNK_SIZE", &n):
+			if n < 48 || n > 1048576 || n%8 != 0 {
+				return nil, errChunkSize
+			}
+			o.chunkSize = &n
+		case cmd != redkit.TS_ALTER && p.MatchKeyword("ENCODING", &s):
+			compressed := strings.EqualFold(s, "COMPRESSED")
+			if !compressed && !strings.EqualFold(s, "UNCOMPRESSED") {
+				return nil, errEncoding
+			}
+			o.compressed = &compressed
+		case cmd != redkit.TS_ALTER && p.MatchFlag("UNCOMPRESSED"):
+			o.compressed = new(bool)
+		case p.MatchKeyword("DUPLICATE_POLICY", &s):
+			if o.policy = strings.ToUpper(s); !slices.Contains(policies, o.policy) {
+				return nil, errPolicy
+			}
+		case cmd == redkit.TS_ADD && p.MatchKeyword("ON_DUPLICATE", &s):
+			if o.onDuplicate = strings.ToUpper(s); !slices.Contains(policies, o.onDuplicate) {
+				return nil, errPolicy
+			}
+		case (cmd == redkit.TS_INCRBY || cmd == redkit.TS_DECRBY) && p.MatchKeyword("TIMESTAMP", &s):
+			ts, err := parseSampleTime(s)
+			if err != nil {
+				return nil, err
+			}
+			o.timestamp = &ts
+		case p.MatchFlag("LABELS"):
+			o.hasLabels = true
+			for p.More() {
+				name, value, _ := p.NextPair()
+				if p.Err() != nil {
+					return nil, errLabels
+				}
+				o.labels = append(o.labels, Label{name, value})
+			}
+		default:
+			p.Fail(args.ErrSyntax)
+		}
+	}
+	if err := p.Done(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// apply sets the options given on s
+func (o *options) apply(s *Series) {
+	if o.retention != nil {
+		s.retention = *o.retention
+		s.trim()
+	}
+	if o.chunkSize != nil {
+		s.chunkSize = int(*o.chunkSize)
+	}
+	if o.compressed != nil {
+		s.compressed = *o.compressed
+	}
+	if o.policy != "" {
+		s.policy = o.policy
+	}
+	if o.hasLabels {
+		s.labels = o.labels
+	}
+}
+
+// newSeries returns an empty series with the options given
+func (o *options) newSeries() *Series {
+	s := newSeries()
+	o.apply(s)
+	return s
+}
+
+// parseSampleTime parses the timestamp of a new sample, * for now
+func parseSampleTime(arg string) (int64, error) {
+	if arg == "*" {
+		return time.Now().UnixMilli(), nil
+	}
+	return parseTimestamp(arg)
+}
+
+// TS.CREATE key [RETENTION ms] [ENCODING enc] [CHUNK_SIZE size] [DUPLICATE_POLICY policy] [LABELS label value ...]
+func (m *module) create(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	key := cmd.Args[0]
+	o, err := parseOptions(args.New(cmd.Args[1:]), redkit.TS_CREATE)
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	if n, err := m.storage(conn).Exists(key); err != nil || n > 0 {
+		return redkit.ErrorValue(errors.Join(err, errKeyExists))
+	}
+	err = m.update(conn, []string{key}, func(t *txn) error {
+		if t.series[key] != nil {
+			return errKeyExists
+		}
+		t.series[key] = o.newSeries()
+		t.write(key)
+		return nil
+	})
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	return ok
+}
+
+// TS.ALTER key [RETENTION ms] [CHUNK_SIZE size] [DUPLICATE_POLICY policy] [LABELS label value ...]
+func (m *module) alter(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	key := cmd.Args[0]
+	o, err := parseOptions(args.New(cmd.Args[1:]), redkit.TS_ALTER)
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	err = m.update(conn, []string{key}, func(t *txn) error {
+		s := t.series[key]
+		if s == nil {
+			return errNoKey
+		}
+		o.apply(s)
+		t.write(key)
+		return nil
+	})
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	return ok
+}
+
+// TS.ADD key timestamp value [RETENTION ms] [ENCODING enc] [CHUNK_SIZE size] [ON_DUPLICATE policy] [LABELS label value ...]
+func (m *module) add(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	key := cmd.Args[0]
+	ts, err := parseSampleTime(cmd.Args[1])
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	value, err := parseValue(cmd.Args[2])
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	o, err := parseOptions(args.New(cmd.Args[3:]), redkit.TS_ADD)
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	err = m.update(conn, []string{key}, func(t *txn) error {
+		if t.series[key] == nil {
+			t.series[key] = o.newSeries()
+		}
+		return t.add(key, Sample{ts, value}, o.onDuplicate)
+	})
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	return integer(ts)
+}
+
+// add adds a sample to the series of key and updates its compactions
+func (t *txn) add(key string, sample Sample, policy string) error {
+	if _, err := t.series[key].add(sample, policy); err != nil {
+		return err
+	}
+	t.write(key)
+	t.added(key, sample.Timestamp)
+	return nil
+}
+
+// TS.MADD key timestamp value [key timestamp value ...]
+func (m *module) madd(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	if len(cmd.Args)%3 != 0 {
+		return redkit.WrongArity(cmd.Name).Value()
+	}
+	var keys []string
+	samples := make([]Sample, 0, len(cmd.Args)/3)
+	for i := 0; i < len(cmd.Args); i += 3 {
+		ts, err := parseSampleTime(cmd.Args[i+1])
+		if err != nil {
+			return redkit.ErrorValue(err)
+		}
+		value, err := parseValue(cmd.Args[i+2])
+		if err != nil {
+			return redkit.ErrorValue(err)
+		}
+		keys = append(keys, cmd.Args[i])
+		samples = append(samples, Sample{ts, value})
+	}
+
+	replies := make([]redkit.RedisValue, len(keys))
+	err := m.update(conn, keys, func(t *txn) error {
+		for i, key := range keys {
+			err := errNoKey
+			if t.series[key] != nil {
+				err = t.add(key, samples[i], "")
+			}
+			if err != nil {
+				replies[i] = redkit.ErrorValue(err)
+			} else {
+				replies[i] = integer(samples[i].Timestamp)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	return array(replies)
+}
+
+// incrby returns the handler of TS.INCRBY key value [TIMESTAMP timestamp]
+// [RETENTION ms] [UNCOMPRESSED] [CHUNK_SIZE size] [LABELS label value ...],
+// or of TS.DECRBY if sign is -1
+func (m *module) incrby(sign float64) func(*redkit.Connection, *redkit.Command) redkit.RedisValue {
+	return func(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+		key := cmd.Args[0]
+		by, err := parseValue(cmd.Args[1])
+		if err != nil {
+			return redkit.ErrorValue(err)
+		}
+		o, err := parseOptions(args.New(cmd.Args[2:]), redkit.CommandType(strings.ToUpper(cmd.Name)))
+		if err != nil {
+			return redkit.ErrorValue(err)
+		}
+		ts := time.Now().UnixMilli()
+		if o.timestamp != nil {
+			ts = *o.timestamp
+		}
+		err = m.update(conn, []string{key}, func(t *txn) error {
+			s := t.series[key]
+			if s == nil {
+				s = o.newSeries()
+				t.series[key] = s
+			}
+			value := sign * by
+			if last, ok := s.last(); ok {
+				if ts < last.Timestamp {
+					return errIncrTime
+				}
+				value += last.Value
+			}
+			return t.add(key, Sample{ts, value}, policyLast)
+		})
+		if err != nil {
+			return redkit.ErrorValue(err)
+		}
+		return integer(ts)
+	}
+}
+
+// TS.DEL key from to
+func (m *module) del(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	key := cmd.Args[0]
+	from, err := parseBound(cmd.Args[1])
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	to, err := parseBound(cmd.Args[2])
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	deleted := 0
+	err = m.update(conn, []string{key}, func(t *txn) error {
+		s := t.series[key]
+		if s == nil {
+			return errNoKey
+		}
+		removed := s.remove(from, to)
+		if deleted = len(removed); deleted > 0 {
+			t.write(key)
+			t.removed(key, removed)
+		}
+		return nil
+	})
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	return integer(int64(deleted))
+}
+
+// lastSample returns the newest sample of the series of key, or with latest
+// the aggregate of the bucket its source's rule is filling if newer
+func lastSample(key string, s *Series, series map[string]*Series, latestBucket bool) (Sample, bool) {
+	sample, found := s.last()
+	if latestBucket && s.source != "" && series[s.source] != nil {
+		if l, ok := latest(series[s.source], key); ok && (!found || l.Timestamp > sample.Timestamp) {
+			return l, true
+		}
+	}
+	return sample, found
+}
+
+// TS.GET key [LATEST]
+func (m *module) get(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	key := cmd.Args[0]
+	q, err := parseQuery(args.New(cmd.Args[1:]), false, false)
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	var reply redkit.RedisValue
+	err = m.view(conn, []string{key}, func(series map[string]*Series) {
+		s := series[key]
+		if s == nil {
+			reply = redkit.ErrorValue(errNoKey)
+			return
+		}
+		if sample, ok := lastSample(key, s, series, q.latest); ok {
+			reply = sampleReply(sample)
+		} else {
+			reply = array([]redkit.RedisValue{})
+		}
+	})
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	return reply
+}
+
+// TS.INFO key [DEBUG]
+func (m *module) info(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	key := cmd.Args[0]
+	if len(cmd.Args) > 1 && !strings.EqualFold(cmd.Args[1], "DEBUG") {
+		return redkit.ErrorValue(args.ErrSyntax)
+	}
+	var reply redkit.RedisValue
+	err := m.view(conn, []string{key}, func(series map[string]*Series) {
+		s := series[key]
+		if s == nil {
+			reply = redkit.ErrorValue(errNoKey)
+			return
+		}
+		first, _ := s.first()
+		last, _ := s.last()
+		chunkType := "uncompressed"
+		if s.compressed {
+			chunkType = "compressed"
+		}
+		policy := redkit.RedisValue{Type: redkit.Null}
+		if s.policy != "" {
+			policy = bulk(strings.ToLower(s.policy))
+		}
+		source := redkit.RedisValue{Type: redkit.Null}
+		if s.source != "" {
+			source = bulk(s.source)
+		}
+		rules := make([]redkit.RedisValue, len(s.rules))
+		for i, r := range s.rules {
+			rules[i] = array([]redkit.RedisValue{bulk(r.dest), integer(r.duration), bulk(strings.ToUpper(r.agg)), integer(r.align)})
+		}
+		fields := []struct {
+			name  string
+			value redkit.RedisValue
+		}{
+			{"totalSamples", integer(int64(s.count))},
+			{"memoryUsage", integer(int64(s.memory()))},
+			{"firstTimestamp", integer(first.Timestamp)},
+			{"lastTimestamp", integer(last.Timestamp)},
+			{"retentionTime", integer(s.retention)},
+			{"chunkCount", integer(int64(len(s.chunks)))},
+			{"chunkSize", integer(int64(s.chunkSize))},
+			{"chunkType", bulk(chunkType)},
+			{"duplicatePolicy", policy},
+			{"labels", labelsReply(s.labels)},
+			{"sourceKey", source},
+			{"rules", array(rules)},
+		}
+		reply = redkit.RedisValue{Type: redkit.Map}
+		for _, f := range fields {
+			reply.Map = append(reply.Map, redkit.MapEntry{Key: bulk(f.name), Value: f.value})
+		}
+	})
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	return reply
+}
+
+// rangeSamples returns the handler of TS.RANGE key from to [options], or of
+// TS.REVRANGE if reverse
+func (m *module) rangeSamples(reverse bool) func(*redkit.Connection, *redkit.Command) redkit.RedisValue {
+	return func(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+		key := cmd.Args[0]
+		q, err := parseQuery(args.New(cmd.Args[1:]), true, false)
+		if err != nil {
+			return redkit.ErrorValue(err)
+		}
+		var reply redkit.RedisValue
+		err = m.view(conn, []string{key}, func(series map[string]*Series) {
+			if s := series[key]; s != nil {
+				reply = samplesReply(q.run(key, s, series, reverse))
+			} else {
+				reply = redkit.ErrorValue(errNoKey)
+			}
+		})
+		if err != nil {
+			return redkit.ErrorValue(err)
+		}
+		return reply
+	}
+}
+
+// viewMatching calls fn with the keys of the series q's filters select, in
+// order, and every series by key
+func (m *module) viewMatching(conn *redkit.Connection, q *query, fn func(keys []string, series map[string]*Series)) error {
+	var matched []string
+	err := m.storage(conn).ViewAllValues(TypeName, func(keys []string, values []store.Value) {
+		series := make(map[string]*Series, len(keys))
+		for i, v := range values {
+			s := v.(*Series)
+			series[keys[i]] = s
+			if matches(s, q.filters) {
+				matched = append(matched, keys[i])
+			}
+		}
+		sort.Strings(matched)
+		fn(matched, series)
+	})
+	if err == nil {
+		m.server.KeysRead(conn, matched...)
+	}
+	return err
+}
+
+// selectedLabels returns the labels of s that q reports
+func (q *query) selectedLabels(s *Series) redkit.RedisValue {
+	if q.withLabels {
+		return labelsReply(s.labels)
+	}
+	reply := make([]redkit.RedisValue, len(q.selected))
+	for i, name := range q.selected {
+		value := redkit.RedisValue{Type: redkit.Null}
+		if v, ok := s.label(name); ok {
+			value = bulk(v)
+		}
+		reply[i] = array([]redkit.RedisValue{bulk(name), value})
+	}
+	return array(reply)
+}
+
+// mrange returns the handler of TS.MRANGE from to [options] FILTER
+// filter... [GROUPBY label REDUCE reducer], or of TS.MREVRANGE if reverse
+func (m *module) mrange(reverse bool) func(*redkit.Connection, *redkit.Command) redkit.RedisValue {
+	return func(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+		q, err := parseQuery(args.New(cmd.Args), true, true)
+		if err != nil {
+			return redkit.ErrorValue(err)
+		}
+		var reply redkit.RedisValue
+		err = m.viewMatching(conn, q, func(keys []string, series map[string]*Series) {
+			if q.groupBy != "" {
+				reply = q.grouped(keys, series, reverse)
+				return
+			}
+			replies := make([]redkit.RedisValue, len(keys))
+			for i, key := range keys {
+				s := series[key]
+				replies[i] = array([]redkit.RedisValue{bulk(key), q.selectedLabels(s), samplesReply(q.run(key, s, series, reverse))})
+			}
+			reply = array(replies)
+		})
+		if err != nil {
+			return redkit.ErrorValue(err)
+		}
+		return reply
+	}
+}
+
+// grouped returns the reply of TS.MRANGE with GROUPBY: a series per value of
+// the label, reducing the samples of the series having it
+func (q *query) grouped(keys []string, series map[string]*Series, reverse bool) redkit.RedisValue {
+	var values []string
+	groups := make(map[string][]string)
+	for _, key := range keys {
+		if value, ok := series[key].label(q.groupBy); ok {
+			if groups[value] == nil {
+				values = append(values, value)
+			}
+			groups[value] = append(groups[value], key)
+		}
+	}
+	sort.Strings(values)
+	replies := make([]redkit.RedisValue, len(values))
+	for i, value := range values {
+		var samples [][]Sample
+		for _, key := range groups[value] {
+			samples = append(samples, q.run(key, series[key], series, reverse))
+		}
+		reduced := reduce(q.reducer, samples, reverse)
+		if q.count >= 0 && len(reduced) > q.count {
+			reduced = reduced[:q.count]
+		}
+		labels := labelsReply([]Label{
+			{q.groupBy, value},
+			{"__reducer__", q.reducer},
+			{"__source__", strings.Join(groups[value], ",")},
+		})
+		replies[i] = array([]redkit.RedisValue{bulk(q.groupBy + "=" + value), labels, samplesReply(reduced)})
+	}
+	return array(replies)
+}
+
+// TS.MGET [LATEST] [WITHLABELS | SELECTED_LABELS label...] FILTER filter...
+func (m *module) mget(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	q, err := parseQuery(args.New(cmd.Args), false, true)
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	var reply redkit.RedisValue
+	err = m.viewMatching(conn, q, func(keys []string, series map[string]*Series) {
+		replies := make([]redkit.RedisValue, len(keys))
+		for i, key := range keys {
+			s := series[key]
+			sample := array([]redkit.RedisValue{})
+			if last, ok := lastSample(key, s, series, q.latest); ok {
+				sample = sampleReply(last)
+			}
+			replies[i] = array([]redkit.RedisValue{bulk(key), q.selectedLabels(s), sample})
+		}
+		reply = array(replies)
+	})
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	return reply
+}
+
+// TS.QUERYINDEX filter...
+func (m *module) queryindex(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	filters, err := parseFilters(cmd.Args)
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	var reply redkit.RedisValue
+	err = m.viewMatching(conn, &query{filters: filters}, func(keys []string, _ map[string]*Series) {
+		replies := make([]redkit.RedisValue, len(keys))
+		for i, key := range keys {
+			replies[i] = bulk(key)
+		}
+		reply = array(replies)
+	})
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	return reply
+}
+
+// TS.CREATERULE sourceKey destKey AGGREGATION aggregator bucketDuration [alignTimestamp]
+func (m *module) createrule(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	src, dst := cmd.Args[0], cmd.Args[1]
+	if !strings.EqualFold(cmd.Args[2], "AGGREGATION") {
+		return redkit.ErrorValue(errAggregateBy)
+	}
+	agg, known := parseAggregation(cmd.Args[3])
+	if !known {
+		return redkit.ErrorValue(errAggregation)
+	}
+	p := args.New(cmd.Args[4:])
+	r := &rule{dest: dst, agg: agg, duration: p.NextInt()}
+	if p.More() {
+		r.align = p.NextInt()
+	}
+	if err := p.Err(); err != nil {
+		return redkit.ErrorValue(err)
+	}
+	if r.duration <= 0 {
+		return redkit.ErrorValue(errDuration)
+	}
+	if src == dst {
+		return redkit.ErrorValue(errSameKey)
+	}
+
+	err := m.update(conn, []string{src, dst}, func(t *txn) error {
+		s, d := t.series[src], t.series[dst]
+		if s == nil || d == nil {
+			return errNoKey
+		}
+		// Rules whose destination was deleted or replaced are dropped
+		s.rules = slices.DeleteFunc(s.rules, func(r *rule) bool {
+			d := t.series[r.dest]
+			return d == nil || d.source != src
+		})
+		switch {
+		case d.source != "":
+			return errHasSource
+		case s.source != "" || len(d.rules) > 0:
+			return errChained
+		}
+		s.rules = append(s.rules, r)
+		d.source = src
+		t.write(src)
+		t.write(dst)
+		return nil
+	})
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	return ok
+}
+
+// TS.DELETERULE sourceKey destKey
+func (m *module) deleterule(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	src, dst := cmd.Args[0], cmd.Args[1]
+	err := m.update(conn, []string{src}, func(t *txn) error {
+		s := t.series[src]
+		if s == nil {
+			return errNoKey
+		}
+		i := slices.IndexFunc(s.rules, func(r *rule) bool { return r.dest == dst })
+		if i < 0 {
+			return errNoRule
+		}
+		s.rules = slices.Delete(s.rules, i, i+1)
+		if d := t.series[dst]; d != nil && d.source == src {
+			d.source = ""
+			t.write(dst)
+		}
+		t.write(src)
+		return nil
+	})
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	return ok
+}
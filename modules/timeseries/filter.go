@@ -0,0 +1,67 @@
+package timeseries
+
+import (
+	"errors"
+	"slices"
+	"strings"
+)
+
+// matcher is an expression of FILTER selecting series by a label:
+//
+//	label=value      the label has the value
+//	label=(v1,v2)    the label has one of the values
+//	label=           the series doesn't have the label
+//	label!=...       the negation of label=...
+type matcher struct {
+	label  string
+	values []string // "" stands for not having the label
+	negate bool
+}
+
+var (
+	errFilter    = errors.New("TSDB: failed parsing labels")
+	errNoMatcher = errors.New("TSDB: please provide at least one matcher")
+)
+
+// parseFilters parses the expressions of FILTER, of which one at least must
+// select series by a label value
+func parseFilters(exprs []string) ([]matcher, error) {
+	matchers := make([]matcher, len(exprs))
+	positive := false
+	for i, expr := range exprs {
+		m := &matchers[i]
+		eq := strings.IndexByte(expr, '=')
+		if eq < 1 {
+			return nil, errFilter
+		}
+		m.label, m.negate = expr[:eq], expr[eq-1] == '!'
+		if m.negate {
+			m.label = expr[:eq-1]
+		}
+		value := expr[eq+1:]
+		if strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") {
+			m.values = strings.Split(value[1:len(value)-1], ",")
+		} else {
+			m.values = []string{value}
+		}
+		if m.label == "" {
+			return nil, errFilter
+		}
+		positive = positive || !m.negate && !slices.Contains(m.values, "")
+	}
+	if !positive {
+		return nil, errNoMatcher
+	}
+	return matchers, nil
+}
+
+// matches reports whether s has the labels all of matchers select
+func matches(s *Series, matchers []matcher) bool {
+	for _, m := range matchers {
+		value, _ := s.label(m.label)
+		if slices.Contains(m.values, value) == m.negate {
+			return false
+		}
+	}
+	return true
+}
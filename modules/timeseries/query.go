@@ -0,0 +1,253 @@
+package timeseries
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/l00pss/redkit/args"
+)
+
+// query is the range and options of TS.RANGE, TS.MRANGE and TS.MGET
+type query struct {
+	from, to int64
+	latest   bool
+	byTS     []int64
+	byValue  bool
+	min, max float64
+	count    int // -1 for no limit
+	buckets  *bucketing
+
+	// For TS.MRANGE and TS.MGET
+	withLabels bool
+	selected   []string
+	filters    []matcher
+	groupBy    string
+	reducer    string
+}
+
+var (
+	errTimestamp   = errors.New("TSDB: invalid timestamp")
+	errValue       = errors.New("TSDB: invalid value")
+	errDuration    = errors.New("TSDB: bucketDuration must be greater than zero")
+	errAggregation = errors.New("TSDB: Unknown aggregation type")
+	errCount       = errors.New("TSDB: Couldn't parse COUNT")
+	errGroupBy     = errors.New("TSDB: GROUPBY needs a label and REDUCE a reducer")
+	errFilterless  = errors.New("TSDB: missing FILTER argument")
+)
+
+// parseTimestamp parses a timestamp in milliseconds, which can't be negative
+func parseTimestamp(arg string) (int64, error) {
+	ts, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || ts < 0 {
+		return 0, errTimestamp
+	}
+	return ts, nil
+}
+
+// parseValue parses the value of a sample
+func parseValue(arg string) (float64, error) {
+	v, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(v) {
+		return 0, errValue
+	}
+	return v, nil
+}
+
+// parseBound parses an end of a range: a timestamp, or - and + for the
+// earliest and latest
+func parseBound(arg string) (int64, error) {
+	switch arg {
+	case "-":
+		return 0, nil
+	case "+":
+		return math.MaxInt64, nil
+	}
+	return parseTimestamp(arg)
+}
+
+// parseQuery parses the from and to of a range followed by the options of
+// a range query, with FILTER, WITHLABELS, SELECTED_LABELS and GROUPBY if
+// multi. TS.MGET takes no range.
+func parseQuery(p *args.Parser, withRange, multi bool) (*query, error) {
+	q := &query{count: -1, to: math.MaxInt64}
+	if withRange {
+		var err error
+		if q.from, err = parseBound(p.NextString()); err != nil {
+			return nil, err
+		}
+		if q.to, err = parseBound(p.NextString()); err != nil {
+			return nil, err
+		}
+	}
+	var align string
+	var count int64
+	for p.More() && p.Err() == nil {
+		switch {
+		case p.MatchFlag("LATEST"):
+			q.latest = true
+		case withRange && p.MatchFlag("FILTER_BY_TS"):
+			for p.More() {
+				ts, err := parseTimestamp(p.Peek())
+				if err != nil {
+					break
+				}
+				p.NextString()
+				q.byTS = append(q.byTS, ts)
+			}
+			if len(q.byTS) == 0 {
+				return nil, errTimestamp
+			}
+		case withRange && p.MatchFlag("FILTER_BY_VALUE"):
+			var err error
+			q.byValue = true
+			if q.min, err = parseValue(p.NextString()); err != nil {
+				return nil, err
+			}
+			if q.max, err = parseValue(p.NextString()); err != nil {
+				return nil, err
+			}
+		case withRange && p.MatchKeyword("COUNT", &count):
+			if count < 0 {
+				return nil, errCount
+			}
+			q.count = int(count)
+		case withRange && p.MatchKeyword("ALIGN", &align):
+		case withRange && p.MatchFlag("AGGREGATION"):
+			agg, ok := parseAggregation(p.NextString())
+			if !ok && p.Err() == nil {
+				return nil, errAggregation
+			}
+			duration := p.NextInt()
+			if p.Err() == nil && duration <= 0 {
+				return nil, errDuration
+			}
+			q.buckets = &bucketing{agg: agg, duration: duration, timestamp: "-"}
+		case q.buckets != nil && p.MatchFlag("BUCKETTIMESTAMP"):
+			switch arg := strings.ToLower(p.NextString()); arg {
+			case "-", "start":
+			case "+", "end":
+				q.buckets.timestamp = "+"
+			case "~", "mid":
+				q.buckets.timestamp = "~"
+			default:
+				p.Fail(args.ErrSyntax)
+			}
+		case q.buckets != nil && p.MatchFlag("EMPTY"):
+			q.buckets.empty = true
+		case multi && p.MatchFlag("WITHLABELS"):
+			q.withLabels = true
+		case multi && p.MatchFlag("SELECTED_LABELS"):
+			for p.More() && !isKeyword(p.Peek()) {
+				q.selected = append(q.selected, p.NextString())
+			}
+		case multi && p.MatchFlag("FILTER"):
+			var exprs []string
+			for p.More() && strings.Contains(p.Peek(), "=") {
+				exprs = append(exprs, p.NextString())
+			}
+			var err error
+			if q.filters, err = parseFilters(exprs); err != nil {
+				return nil, err
+			}
+		case multi && withRange && p.MatchFlag("GROUPBY"):
+			q.groupBy = p.NextString()
+			if !p.MatchFlag("REDUCE") {
+				return nil, errGroupBy
+			}
+			var ok bool
+			if q.reducer, ok = parseAggregation(p.NextString()); !ok && p.Err() == nil {
+				return nil, errGroupBy
+			}
+		default:
+			p.Fail(args.ErrSyntax)
+		}
+	}
+	if err := p.Done(); err != nil {
+		return nil, err
+	}
+	if multi && q.filters == nil {
+		return nil, errFilterless
+	}
+	if q.buckets != nil {
+		switch align {
+		case "":
+		case "-", "start":
+			q.buckets.align = q.from
+		case "+", "end":
+			q.buckets.align = q.to
+		default:
+			ts, err := parseTimestamp(align)
+			if err != nil {
+				return nil, err
+			}
+			q.buckets.align = ts
+		}
+	}
+	return q, nil
+}
+
+// isKeyword reports whether arg is an option of TS.MRANGE or TS.MGET, which
+// ends the labels of SELECTED_LABELS
+func isKeyword(arg string) bool {
+	switch strings.ToUpper(arg) {
+	case "LATEST", "FILTER_BY_TS", "FILTER_BY_VALUE", "COUNT", "ALIGN", "AGGREGATION", "WITHLABELS", "FILTER", "GROUPBY":
+		return true
+	}
+	return false
+}
+
+// run returns the samples of the series of key the query selects, newest
+// first if reverse. series holds the source of the series, which LATEST
+// needs.
+func (q *query) run(key string, s *Series, series map[string]*Series, reverse bool) []Sample {
+	samples := s.Range(q.from, q.to)
+	if q.latest && s.source != "" && series[s.source] != nil {
+		sample, ok := latest(series[s.source], key)
+		if ok && sample.Timestamp >= q.from && sample.Timestamp <= q.to && (len(samples) == 0 || sample.Timestamp > samples[len(samples)-1].Timestamp) {
+			samples = append(samples, sample)
+		}
+	}
+	if q.byTS != nil || q.byValue {
+		samples = slices.DeleteFunc(samples, func(sample Sample) bool {
+			return q.byTS != nil && !slices.Contains(q.byTS, sample.Timestamp) ||
+				q.byValue && (sample.Value < q.min || sample.Value > q.max)
+		})
+	}
+	if q.buckets != nil {
+		samples = q.buckets.apply(samples)
+	}
+	if reverse {
+		slices.Reverse(samples)
+	}
+	if q.count >= 0 && len(samples) > q.count {
+		samples = samples[:q.count]
+	}
+	return samples
+}
+
+// reduce combines the samples of a group of series into one per timestamp,
+// the reducer's aggregate of their values at it
+func reduce(reducer string, groups [][]Sample, reverse bool) []Sample {
+	values := make(map[int64][]float64)
+	var timestamps []int64
+	for _, samples := range groups {
+		for _, sample := range samples {
+			if _, ok := values[sample.Timestamp]; !ok {
+				timestamps = append(timestamps, sample.Timestamp)
+			}
+			values[sample.Timestamp] = append(values[sample.Timestamp], sample.Value)
+		}
+	}
+	slices.Sort(timestamps)
+	if reverse {
+		slices.Reverse(timestamps)
+	}
+	samples := make([]Sample, len(timestamps))
+	for i, ts := range timestamps {
+		samples[i] = Sample{ts, aggregate(reducer, values[ts])}
+	}
+	return samples
+}
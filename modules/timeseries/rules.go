@@ -0,0 +1,105 @@
+package timeseries
+
+import "slices"
+
+// rule is a compaction rule of a series, writing the aggregate of each of its
+// buckets to the destination series
+type rule struct {
+	dest     string
+	agg      string
+	duration int64
+	align    int64
+	open     int64 // start of the bucket the last samples went into
+	opened   bool  // whether a sample was added since the rule was created
+}
+
+// txn holds the series a write works on: those of the keys it names and of
+// the destinations of their compaction rules, by key, nil for missing keys
+type txn struct {
+	series  map[string]*Series
+	written []string
+}
+
+// write records that the series of key changed
+func (t *txn) write(key string) {
+	if !slices.Contains(t.written, key) {
+		t.written = append(t.written, key)
+	}
+}
+
+// added updates the destinations of the rules of the series of key after a
+// sample was added at ts. Once a sample falls into a later bucket, the
+// bucket before is complete and its aggregate is written; a sample into an
+// earlier bucket rewrites that one.
+func (t *txn) added(key string, ts int64) {
+	src := t.series[key]
+	for _, r := range src.rules {
+		bucket := bucketStart(ts, r.duration, r.align)
+		switch {
+		case !r.opened:
+			r.open, r.opened = bucket, true
+		case bucket > r.open:
+			t.compact(key, r, r.open)
+			r.open = bucket
+		case bucket < r.open:
+			t.compact(key, r, bucket)
+		}
+	}
+}
+
+// removed updates the destinations of the rules of the series of key after
+// the samples at timestamps, in ascending order, were removed
+func (t *txn) removed(key string, timestamps []int64) {
+	for _, r := range t.series[key].rules {
+		last := int64(-1)
+		for _, ts := range timestamps {
+			bucket := bucketStart(ts, r.duration, r.align)
+			if r.opened && bucket < r.open && bucket != last {
+				t.compact(key, r, bucket)
+				last = bucket
+			}
+		}
+	}
+}
+
+// compact writes what r gives for the bucket starting at start to its
+// destination, or removes the destination's sample if the bucket is empty.
+// A destination that was deleted, or replaced by a series the rule doesn't
+// write to, is left alone.
+func (t *txn) compact(key string, r *rule, start int64) {
+	dest := t.series[r.dest]
+	if dest == nil || dest.source != key {
+		return
+	}
+	if sample, ok := bucketAggregate(t.series[key], r, start); ok {
+		dest.add(sample, policyLast)
+	} else {
+		dest.remove(start, start)
+	}
+	t.write(r.dest)
+}
+
+// bucketAggregate returns the aggregate r gives for the samples of src in
+// the bucket starting at start, false if it has none
+func bucketAggregate(src *Series, r *rule, start int64) (Sample, bool) {
+	samples := src.Range(start, start+r.duration-1)
+	if len(samples) == 0 {
+		return Sample{}, false
+	}
+	a := aggregator{agg: r.agg}
+	for _, sample := range samples {
+		a.add(sample.Value)
+	}
+	return Sample{start, a.value()}, true
+}
+
+// latest returns the aggregate of the bucket of src's rule writing to dest
+// still taking samples, as LATEST reports for dest, false if there is none
+func latest(src *Series, dest string) (Sample, bool) {
+	for _, r := range src.rules {
+		if r.dest == dest && r.opened {
+			return bucketAggregate(src, r, r.open)
+		}
+	}
+	return Sample{}, false
+}
@@ -0,0 +1,265 @@
+package timeseries
+
+import (
+	"errors"
+	"slices"
+	"sort"
+
+	"github.com/l00pss/redkit/store"
+)
+
+// Sample is a value of a series at a timestamp in milliseconds
+type Sample struct {
+	Timestamp int64
+	Value     float64
+}
+
+// Label is a name and value describing a series, which TS.MRANGE and the
+// other multi-series commands filter by
+type Label struct {
+	Name, Value string
+}
+
+// Duplicate policies, deciding what adding a sample at a timestamp the
+// series already has does
+const (
+	policyBlock = "BLOCK" // fail
+	policyFirst = "FIRST" // keep the old value
+	policyLast  = "LAST"  // take the new value
+	policyMin   = "MIN"   // keep the lower value
+	policyMax   = "MAX"   // keep the higher value
+	policySum   = "SUM"   // add the new value to the old one
+)
+
+var policies = []string{policyBlock, policyFirst, policyLast, policyMin, policyMax, policySum}
+
+const (
+	// sampleSize is the bytes a sample takes in a chunk
+	sampleSize = 16
+	// defaultChunkSize is the bytes of a chunk unless CHUNK_SIZE says
+	// otherwise
+	defaultChunkSize = 4096
+)
+
+var (
+	errTooOld    = errors.New("TSDB: Timestamp is older than retention")
+	errDuplicate = errors.New("TSDB: Error at upsert, update is not supported when DUPLICATE_POLICY is set to BLOCK mode")
+)
+
+// Series is a time series, the value the TS commands keep at a key. Its
+// samples are kept in timestamp order in chunks of a bounded size, so that
+// inserting a late sample moves only the samples of one chunk.
+type Series struct {
+	retention  int64 // milliseconds to keep samples for before the last, 0 for ever
+	chunkSize  int   // bytes
+	compressed bool  // the encoding TS.INFO reports
+	policy     string
+	labels     []Label
+	chunks     []*chunk
+	count      int
+	source     string // key whose compaction rule writes to the series
+	rules      []*rule
+}
+
+// chunk is a run of consecutive samples
+type chunk struct {
+	samples []Sample
+}
+
+// newSeries returns an empty series
+func newSeries() *Series {
+	return &Series{chunkSize: defaultChunkSize, compressed: true}
+}
+
+// Type returns TypeName
+func (s *Series) Type() string {
+	return TypeName
+}
+
+// MemoryUsage returns the approximate bytes the series takes, as TS.INFO
+// reports
+func (s *Series) MemoryUsage() int {
+	return s.memory()
+}
+
+// Copy returns a copy of the series with its samples and labels, as COPY
+// makes. The copy is neither the source nor the destination of compaction
+// rules, as in RedisTimeSeries.
+func (s *Series) Copy() store.Value {
+	c := *s
+	c.labels = slices.Clone(s.labels)
+	c.chunks = make([]*chunk, len(s.chunks))
+	for i, ch := range s.chunks {
+		c.chunks[i] = &chunk{samples: slices.Clone(ch.samples)}
+	}
+	c.source, c.rules = "", nil
+	return &c
+}
+
+// Len returns the number of samples
+func (s *Series) Len() int {
+	return s.count
+}
+
+// Labels returns the labels of the series
+func (s *Series) Labels() []Label {
+	return append([]Label(nil), s.labels...)
+}
+
+// Range returns the samples from timestamp from to timestamp to inclusive
+func (s *Series) Range(from, to int64) []Sample {
+	var samples []Sample
+	for _, c := range s.chunks[s.chunkAt(from):] {
+		if c.samples[0].Timestamp > to {
+			break
+		}
+		i := sort.Search(len(c.samples), func(i int) bool { return c.samples[i].Timestamp >= from })
+		for _, sample := range c.samples[i:] {
+			if sample.Timestamp > to {
+				break
+			}
+			samples = append(samples, sample)
+		}
+	}
+	return samples
+}
+
+// label returns the value of the label name and whether the series has it
+func (s *Series) label(name string) (string, bool) {
+	for _, l := range s.labels {
+		if l.Name == name {
+			return l.Value, true
+		}
+	}
+	return "", false
+}
+
+// first returns the oldest sample and whether there is one
+func (s *Series) first() (Sample, bool) {
+	if s.count == 0 {
+		return Sample{}, false
+	}
+	return s.chunks[0].samples[0], true
+}
+
+// last returns the newest sample and whether there is one
+func (s *Series) last() (Sample, bool) {
+	if s.count == 0 {
+		return Sample{}, false
+	}
+	c := s.chunks[len(s.chunks)-1]
+	return c.samples[len(c.samples)-1], true
+}
+
+// capacity returns the number of samples a chunk holds
+func (s *Series) capacity() int {
+	return max(s.chunkSize/sampleSize, 2)
+}
+
+// chunkAt returns the index of the chunk holding timestamp ts, or where a
+// sample at ts goes: the last chunk starting at or before it, or the first
+func (s *Series) chunkAt(ts int64) int {
+	i := sort.Search(len(s.chunks), func(i int) bool { return s.chunks[i].samples[0].Timestamp > ts })
+	return max(i-1, 0)
+}
+
+// add adds a sample, resolving a duplicate timestamp with policy, or the
+// series' own policy if it is empty. It returns the value stored at the
+// timestamp.
+func (s *Series) add(sample Sample, policy string) (float64, error) {
+	if last, ok := s.last(); ok && s.retention > 0 && sample.Timestamp < last.Timestamp-s.retention {
+		return 0, errTooOld
+	}
+	if s.count == 0 {
+		s.chunks = []*chunk{{samples: []Sample{sample}}}
+		s.count = 1
+		return sample.Value, nil
+	}
+
+	ci := s.chunkAt(sample.Timestamp)
+	c := s.chunks[ci]
+	i := sort.Search(len(c.samples), func(i int) bool { return c.samples[i].Timestamp >= sample.Timestamp })
+	if i < len(c.samples) && c.samples[i].Timestamp == sample.Timestamp {
+		if policy == "" {
+			policy = s.policy
+		}
+		old := &c.samples[i].Value
+		switch policy {
+		case policyFirst:
+		case policyLast:
+			*old = sample.Value
+		case policyMin:
+			*old = min(*old, sample.Value)
+		case policyMax:
+			*old = max(*old, sample.Value)
+		case policySum:
+			*old += sample.Value
+		default:
+			return 0, errDuplicate
+		}
+		return *old, nil
+	}
+
+	switch {
+	case len(c.samples) < s.capacity():
+		c.samples = append(c.samples[:i], append([]Sample{sample}, c.samples[i:]...)...)
+	case i == len(c.samples) && ci == len(s.chunks)-1:
+		// Appending to a full last chunk starts a new one
+		s.chunks = append(s.chunks, &chunk{samples: []Sample{sample}})
+	default:
+		// A full chunk splits in two around the new sample
+		samples := append(append(append([]Sample{}, c.samples[:i]...), sample), c.samples[i:]...)
+		half := len(samples) / 2
+		c.samples = samples[:half]
+		next := &chunk{samples: append([]Sample{}, samples[half:]...)}
+		s.chunks = append(s.chunks[:ci+1], append([]*chunk{next}, s.chunks[ci+1:]...)...)
+	}
+	s.count++
+	s.trim()
+	return sample.Value, nil
+}
+
+// trim drops the samples older than the retention period before the last
+func (s *Series) trim() {
+	last, ok := s.last()
+	if !ok || s.retention == 0 {
+		return
+	}
+	s.remove(0, last.Timestamp-s.retention-1)
+}
+
+// remove removes the samples from timestamp from to timestamp to inclusive
+// and returns their timestamps
+func (s *Series) remove(from, to int64) []int64 {
+	var removed []int64
+	chunks := s.chunks[:0]
+	for _, c := range s.chunks {
+		kept := c.samples[:0]
+		for _, sample := range c.samples {
+			if sample.Timestamp >= from && sample.Timestamp <= to {
+				removed = append(removed, sample.Timestamp)
+			} else {
+				kept = append(kept, sample)
+			}
+		}
+		if c.samples = kept; len(kept) > 0 {
+			chunks = append(chunks, c)
+		}
+	}
+	clear(s.chunks[len(chunks):])
+	s.chunks = chunks
+	s.count -= len(removed)
+	return removed
+}
+
+// memory estimates the bytes the series takes, as TS.INFO reports
+func (s *Series) memory() int {
+	size := 128
+	for _, l := range s.labels {
+		size += len(l.Name) + len(l.Value) + 32
+	}
+	for _, r := range s.rules {
+		size += len(r.dest) + 64
+	}
+	return size + len(s.chunks)*s.chunkSize
+}
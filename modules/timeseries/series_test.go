@@ -0,0 +1,147 @@
+package timeseries
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// TestSeriesChunks tests that samples stay in order across chunks when added
+// out of order
+func TestSeriesChunks(t *testing.T) {
+	s := newSeries()
+	s.chunkSize = 4 * sampleSize
+	for _, ts := range []int64{10, 20, 30, 40, 50, 60, 5, 25, 35, 45} {
+		if _, err := s.add(Sample{ts, float64(ts)}, ""); err != nil {
+			t.Fatalf("Failed to add %d: %v", ts, err)
+		}
+	}
+	if s.Len() != 10 {
+		t.Errorf("Expected 10 samples, got %d", s.Len())
+	}
+	for _, c := range s.chunks {
+		if len(c.samples) > s.capacity() {
+			t.Errorf("Chunk holds %d samples, more than %d", len(c.samples), s.capacity())
+		}
+	}
+	if got := fmt.Sprint(s.Range(0, math.MaxInt64)); got != "[{5 5} {10 10} {20 20} {25 25} {30 30} {35 35} {40 40} {45 45} {50 50} {60 60}]" {
+		t.Errorf("Unexpected samples %s", got)
+	}
+	if got := fmt.Sprint(s.Range(21, 45)); got != "[{25 25} {30 30} {35 35} {40 40} {45 45}]" {
+		t.Errorf("Unexpected range %s", got)
+	}
+
+	if removed := s.remove(20, 40); fmt.Sprint(removed) != "[20 25 30 35 40]" {
+		t.Errorf("Unexpected removed timestamps %v", removed)
+	}
+	if got := fmt.Sprint(s.Range(0, math.MaxInt64)); got != "[{5 5} {10 10} {45 45} {50 50} {60 60}]" || s.Len() != 5 {
+		t.Errorf("Unexpected samples after remove %s", got)
+	}
+}
+
+// TestSeriesRetention tests that samples older than the retention period are
+// dropped and refused
+func TestSeriesRetention(t *testing.T) {
+	s := newSeries()
+	s.retention = 100
+	for _, ts := range []int64{0, 50, 100, 150} {
+		s.add(Sample{ts, 1}, "")
+	}
+	if first, _ := s.first(); first.Timestamp != 50 {
+		t.Errorf("Expected the oldest sample at 50, got %d", first.Timestamp)
+	}
+	if _, err := s.add(Sample{49, 1}, ""); err != errTooOld {
+		t.Errorf("Expected errTooOld, got %v", err)
+	}
+	if _, err := s.add(Sample{60, 1}, ""); err != nil {
+		t.Errorf("Failed to add a late sample within retention: %v", err)
+	}
+}
+
+// TestSeriesDuplicates tests the duplicate policies
+func TestSeriesDuplicates(t *testing.T) {
+	tests := []struct {
+		policy   string
+		expected float64
+	}{
+		{policyFirst, 2},
+		{policyLast, 3},
+		{policyMin, 2},
+		{policyMax, 3},
+		{policySum, 5},
+	}
+	for _, tt := range tests {
+		s := newSeries()
+		s.add(Sample{1, 2}, "")
+		if got, err := s.add(Sample{1, 3}, tt.policy); err != nil || got != tt.expected {
+			t.Errorf("%s: expected %v, got %v %v", tt.policy, tt.expected, got, err)
+		}
+	}
+
+	s := newSeries()
+	s.add(Sample{1, 2}, "")
+	if _, err := s.add(Sample{1, 3}, ""); err != errDuplicate {
+		t.Errorf("Expected errDuplicate by default, got %v", err)
+	}
+	s.policy = policyMax
+	if got, _ := s.add(Sample{1, 3}, ""); got != 3 {
+		t.Errorf("Expected the series' policy to apply, got %v", got)
+	}
+}
+
+// TestAggregations tests the aggregation types and bucketing
+func TestAggregations(t *testing.T) {
+	values := []float64{2, 4, 4, 4, 5, 5, 7, 9}
+	tests := map[string]float64{
+		"avg": 5, "sum": 40, "min": 2, "max": 9, "range": 7, "count": 8,
+		"first": 2, "last": 9, "var.p": 4, "std.p": 2, "var.s": 32.0 / 7, "std.s": math.Sqrt(32.0 / 7),
+	}
+	for agg, expected := range tests {
+		if got := aggregate(agg, values); math.Abs(got-expected) > 1e-9 {
+			t.Errorf("%s: expected %v, got %v", agg, expected, got)
+		}
+	}
+
+	if got := bucketStart(25, 10, 3); got != 23 {
+		t.Errorf("Expected the bucket of 25 aligned to 3 to start at 23, got %d", got)
+	}
+	samples := []Sample{{1, 1}, {5, 2}, {12, 3}, {35, 4}}
+	b := &bucketing{agg: "sum", duration: 10, timestamp: "-"}
+	if got := fmt.Sprint(b.apply(samples)); got != "[{0 3} {10 3} {30 4}]" {
+		t.Errorf("Unexpected buckets %s", got)
+	}
+	b.empty, b.timestamp = true, "+"
+	if got := fmt.Sprint(b.apply(samples)); got != "[{10 3} {20 3} {30 0} {40 4}]" {
+		t.Errorf("Unexpected buckets with EMPTY %s", got)
+	}
+}
+
+// TestFilters tests selecting series by their labels
+func TestFilters(t *testing.T) {
+	s := newSeries()
+	s.labels = []Label{{"sensor", "temp"}, {"room", "kitchen"}}
+
+	tests := []struct {
+		exprs    []string
+		expected string
+	}{
+		{[]string{"sensor=temp"}, "true"},
+		{[]string{"sensor=temp", "room!=kitchen"}, "false"},
+		{[]string{"room=(hall,kitchen)"}, "true"},
+		{[]string{"sensor=temp", "floor="}, "true"},
+		{[]string{"sensor=temp", "floor!="}, "false"},
+		{[]string{"sensor!=(humidity,pressure)", "room=kitchen"}, "true"},
+		{[]string{"floor="}, "TSDB: please provide at least one matcher"},
+		{[]string{"sensor"}, "TSDB: failed parsing labels"},
+	}
+	for _, tt := range tests {
+		matchers, err := parseFilters(tt.exprs)
+		got := fmt.Sprint(matches(s, matchers))
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tt.expected {
+			t.Errorf("%v: expected %s, got %s", tt.exprs, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Package timeseries adds the RedisTimeSeries commands to a redkit server:
+// TS.CREATE, TS.ADD, TS.RANGE with aggregation, TS.MRANGE selecting series by
+// their labels, compaction rules from TS.CREATERULE and the rest of the TS.*
+// commands, over series kept in the server's storage.
+//
+//	server := redkit.NewServer(":6379")
+//	server.EnableBuiltinStore()
+//	if err := timeseries.Register(server); err != nil {
+//		log.Fatal(err)
+//	}
+//
+// Series are Values of the store, so their keys expire, are deleted and are
+// scanned like any other, and are of type TSDB-TYPE.
+package timeseries
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/l00pss/redkit"
+	"github.com/l00pss/redkit/store"
+)
+
+// TypeName is the type of keys holding series
+const TypeName = "TSDB-TYPE"
+
+var (
+	_ store.MemoryValue   = (*Series)(nil)
+	_ store.CopyableValue = (*Series)(nil)
+)
+
+// ErrNoValueStorage is returned by Register for a server whose storage can't
+// hold series
+var ErrNoValueStorage = errors.New("timeseries: the server's storage doesn't implement store.ValueStorage")
+
+// Register registers the TS commands with server, which must have a storage
+// implementing store.ValueStorage, as EnableBuiltinStore's does
+func Register(server *redkit.Server) error {
+	if _, ok := server.Storage().(store.ValueStorage); !ok {
+		return ErrNoValueStorage
+	}
+	m := &module{server: server}
+	return server.Mount(m.commands())
+}
+
+// module implements the TS commands over a server's storage
+type module struct {
+	server *redkit.Server
+}
+
+// storage returns the storage of the database conn selected, which Register
+// found to be a store.ValueStorage
+func (m *module) storage(conn *redkit.Connection) store.ValueStorage {
+	return m.server.Database(conn.DB()).(store.ValueStorage)
+}
+
+// errStale aborts an update whose series gained compaction rules since their
+// destinations were looked up
+var errStale = errors.New("stale compaction rules")
+
+// update calls fn with a txn holding the series of keys and of the
+// destinations of their compaction rules, and stores what fn leaves in it
+// unless it fails. Destinations holding something else than a series are
+// left out.
+func (m *module) update(conn *redkit.Connection, keys []string, fn func(t *txn) error) error {
+	for {
+		all, others, err := m.withDestinations(conn, keys)
+		if err != nil {
+			return err
+		}
+		t := &txn{series: make(map[string]*Series, len(all))}
+		err = m.storage(conn).UpdateValues(all, TypeName, func(values []store.Value) error {
+			for i, v := range values {
+				s, _ := v.(*Series)
+				t.series[all[i]] = s
+			}
+			for _, key := range keys {
+				if s := t.series[key]; s != nil {
+					for _, r := range s.rules {
+						if _, ok := t.series[r.dest]; !ok && !slices.Contains(others, r.dest) {
+							return errStale
+						}
+					}
+				}
+			}
+			if err := fn(t); err != nil {
+				return err
+			}
+			for i, key := range all {
+				if s := t.series[key]; s != nil {
+					values[i] = s
+				} else {
+					values[i] = nil
+				}
+			}
+			return nil
+		})
+		if err == errStale {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		m.server.KeysWritten(conn, t.written...)
+		return nil
+	}
+}
+
+// withDestinations returns keys followed by the destinations of the
+// compaction rules of their series, and apart the destinations holding
+// something else than a series
+func (m *module) withDestinations(conn *redkit.Connection, keys []string) (all, others []string, err error) {
+	all = slices.Clone(keys)
+	err = m.storage(conn).ViewValues(keys, TypeName, func(values []store.Value) {
+		for _, v := range values {
+			if s, ok := v.(*Series); ok {
+				for _, r := range s.rules {
+					if !slices.Contains(all, r.dest) {
+						all = append(all, r.dest)
+					}
+				}
+			}
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := len(keys); i < len(all); i++ {
+		if typ, err := m.storage(conn).Type(all[i]); err == nil && typ != TypeName && typ != store.TypeNone {
+			others = append(others, all[i])
+		}
+	}
+	all = slices.DeleteFunc(all, func(key string) bool { return slices.Contains(others, key) })
+	return all, others, nil
+}
+
+// view calls fn with the series of keys, nil for missing keys, and those of
+// the keys whose compaction rules write to them, which LATEST needs
+func (m *module) view(conn *redkit.Connection, keys []string, fn func(series map[string]*Series)) error {
+	all := slices.Clone(keys)
+	err := m.storage(conn).ViewValues(keys, TypeName, func(values []store.Value) {
+		for _, v := range values {
+			if s, ok := v.(*Series); ok && s.source != "" && !slices.Contains(all, s.source) {
+				all = append(all, s.source)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for i := len(keys); i < len(all); {
+		if typ, _ := m.storage(conn).Type(all[i]); typ != TypeName {
+			all = slices.Delete(all, i, i+1)
+		} else {
+			i++
+		}
+	}
+	err = m.storage(conn).ViewValues(all, TypeName, func(values []store.Value) {
+		series := make(map[string]*Series, len(all))
+		for i, v := range values {
+			s, _ := v.(*Series)
+			series[all[i]] = s
+		}
+		fn(series)
+	})
+	if err == nil {
+		m.server.KeysRead(conn, keys...)
+	}
+	return err
+}
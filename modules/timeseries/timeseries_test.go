@@ -0,0 +1,203 @@
+package timeseries
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/l00pss/redkit"
+	"github.com/redis/go-redis/v9"
+)
+
+// startServer starts a server with the built-in store and the TS commands
+func startServer(t *testing.T) (*redkit.Server, *redis.Client) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to get a free port: %v", err)
+	}
+	address := l.Addr().String()
+	l.Close()
+
+	config := redkit.DefaultServerConfig()
+	config.Address = address
+	config.Logger = redkit.NewDefaultLogger(nil, redkit.LogLevelOff)
+	server := redkit.NewServerWithConfig(config)
+	server.EnableBuiltinStore()
+	if err := Register(server); err != nil {
+		t.Fatalf("Failed to register the TS commands: %v", err)
+	}
+	if err := server.Listen(); err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go server.Serve()
+
+	rdb := redis.NewClient(&redis.Options{Addr: address, Protocol: 2})
+	t.Cleanup(func() {
+		rdb.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	})
+	return server, rdb
+}
+
+// TestRegister tests that Register needs a storage holding values
+func TestRegister(t *testing.T) {
+	if err := Register(redkit.NewServer("127.0.0.1:0")); err != ErrNoValueStorage {
+		t.Errorf("Expected ErrNoValueStorage without a storage, got %v", err)
+	}
+}
+
+// run sends each command and compares its reply, printed as go-redis returns
+// it, with the expected one
+func run(t *testing.T, rdb *redis.Client, tests []struct {
+	args     []any
+	expected string
+}) {
+	t.Helper()
+	ctx := context.Background()
+	for _, tt := range tests {
+		got, err := rdb.Do(ctx, tt.args...).Result()
+		reply := fmt.Sprint(got)
+		if err != nil {
+			reply = err.Error()
+		}
+		if reply != tt.expected {
+			t.Errorf("%v: expected %s, got %s", tt.args, tt.expected, reply)
+		}
+	}
+}
+
+// TestCommands tests the single series commands
+func TestCommands(t *testing.T) {
+	_, rdb := startServer(t)
+	run(t, rdb, []struct {
+		args     []any
+		expected string
+	}{
+		{[]any{"TS.CREATE", "temp", "RETENTION", "1000", "DUPLICATE_POLICY", "sum", "LABELS", "sensor", "temp", "room", "kitchen"}, "OK"},
+		{[]any{"TS.CREATE", "temp"}, "ERR TSDB: key already exists"},
+		{[]any{"TS.CREATE", "bad", "CHUNK_SIZE", "10"}, "ERR TSDB: CHUNK_SIZE value must be a multiple of 8 in the range [48 .. 1048576]"},
+		{[]any{"TS.CREATE", "bad", "DUPLICATE_POLICY", "newest"}, "ERR TSDB: Unknown DUPLICATE_POLICY"},
+		{[]any{"TS.CREATE", "bad", "LABELS", "odd"}, "ERR TSDB: Invalid labels"},
+		{[]any{"TS.ADD", "temp", "1000", "20"}, "1000"},
+		{[]any{"TS.ADD", "temp", "1010", "21.5"}, "1010"},
+		{[]any{"TS.ADD", "temp", "1010", "0.5"}, "1010"},
+		{[]any{"TS.ADD", "temp", "1010", "1", "ON_DUPLICATE", "first"}, "1010"},
+		{[]any{"TS.ADD", "temp", "1020", "x"}, "ERR TSDB: invalid value"},
+		{[]any{"TS.ADD", "temp", "-1", "1"}, "ERR TSDB: invalid timestamp"},
+		{[]any{"TS.ADD", "temp", "1500", "23"}, "1500"},
+		{[]any{"TS.ADD", "temp", "2000", "24"}, "2000"},
+		{[]any{"TS.ADD", "temp", "999", "24"}, "ERR TSDB: Timestamp is older than retention"},
+		{[]any{"TS.RANGE", "temp", "-", "+"}, "[[1000 20] [1010 22] [1500 23] [2000 24]]"},
+		{[]any{"TS.REVRANGE", "temp", "1001", "+", "COUNT", "2"}, "[[2000 24] [1500 23]]"},
+		{[]any{"TS.RANGE", "temp", "-", "+", "FILTER_BY_TS", "1000", "2000", "FILTER_BY_VALUE", "21", "30"}, "[[2000 24]]"},
+		{[]any{"TS.RANGE", "temp", "-", "+", "AGGREGATION", "avg", "500"}, "[[1000 21] [1500 23] [2000 24]]"},
+		{[]any{"TS.RANGE", "temp", "-", "+", "ALIGN", "10", "AGGREGATION", "max", "500", "BUCKETTIMESTAMP", "end"}, "[[1010 20] [1510 23] [2010 24]]"},
+		{[]any{"TS.RANGE", "temp", "-", "+", "AGGREGATION", "count", "250", "EMPTY"}, "[[1000 2] [1250 0] [1500 1] [1750 0] [2000 1]]"},
+		{[]any{"TS.RANGE", "temp", "-", "+", "AGGREGATION", "median", "10"}, "ERR TSDB: Unknown aggregation type"},
+		{[]any{"TS.RANGE", "temp", "-", "+", "AGGREGATION", "sum", "0"}, "ERR TSDB: bucketDuration must be greater than zero"},
+		{[]any{"TS.RANGE", "temp", "-", "+", "BUCKETTIMESTAMP", "end"}, "ERR syntax error"},
+		{[]any{"TS.RANGE", "missing", "-", "+"}, "ERR TSDB: the key does not exist"},
+		{[]any{"TS.GET", "temp"}, "[2000 24]"},
+		{[]any{"TS.DEL", "temp", "1000", "1010"}, "2"},
+		{[]any{"TS.GET", "missing"}, "ERR TSDB: the key does not exist"},
+		{[]any{"TS.INCRBY", "counter", "5", "TIMESTAMP", "100"}, "100"},
+		{[]any{"TS.INCRBY", "counter", "2", "TIMESTAMP", "100"}, "100"},
+		{[]any{"TS.DECRBY", "counter", "1.5", "TIMESTAMP", "200"}, "200"},
+		{[]any{"TS.INCRBY", "counter", "1", "TIMESTAMP", "150"}, "ERR TSDB: timestamp must be equal to or higher than the maximum existing timestamp"},
+		{[]any{"TS.RANGE", "counter", "-", "+"}, "[[100 7] [200 5.5]]"},
+		{[]any{"TS.MADD", "temp", "2100", "25", "missing", "1", "1", "counter", "300", "6"}, "[2100 ERR TSDB: the key does not exist 300]"},
+		{[]any{"TS.MADD", "temp", "2100"}, "ERR wrong number of arguments for 'ts.madd' command"},
+		{[]any{"TS.ALTER", "temp", "RETENTION", "0", "LABELS", "sensor", "temp"}, "OK"},
+		{[]any{"TS.ALTER", "missing", "RETENTION", "0"}, "ERR TSDB: the key does not exist"},
+		{[]any{"TS.INFO", "temp"}, "[totalSamples 3 memoryUsage 4266 firstTimestamp 1500 lastTimestamp 2100 retentionTime 0 chunkCount 1 chunkSize 4096 chunkType compressed duplicatePolicy sum labels [[sensor temp]] sourceKey <nil> rules []]"},
+		{[]any{"SET", "str", "v"}, "OK"},
+		{[]any{"TS.ADD", "str", "1", "1"}, "WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{[]any{"TS.CREATE", "str"}, "ERR TSDB: key already exists"},
+		{[]any{"DEL", "temp"}, "1"},
+		{[]any{"TS.GET", "temp"}, "ERR TSDB: the key does not exist"},
+	})
+}
+
+// TestRules tests compaction rules and LATEST
+func TestRules(t *testing.T) {
+	_, rdb := startServer(t)
+	run(t, rdb, []struct {
+		args     []any
+		expected string
+	}{
+		{[]any{"TS.CREATE", "raw"}, "OK"},
+		{[]any{"TS.CREATE", "avg"}, "OK"},
+		{[]any{"TS.CREATE", "other"}, "OK"},
+		{[]any{"TS.CREATERULE", "raw", "avg", "AGGREGATION", "avg", "10"}, "OK"},
+		{[]any{"TS.CREATERULE", "raw", "missing", "AGGREGATION", "avg", "10"}, "ERR TSDB: the key does not exist"},
+		{[]any{"TS.CREATERULE", "raw", "raw", "AGGREGATION", "avg", "10"}, "ERR TSDB: the source key and destination key should be different"},
+		{[]any{"TS.CREATERULE", "other", "avg", "AGGREGATION", "sum", "10"}, "ERR TSDB: the destination key already has a src rule"},
+		{[]any{"TS.CREATERULE", "avg", "other", "AGGREGATION", "sum", "10"}, "ERR TSDB: compaction rules can't be chained"},
+		{[]any{"TS.CREATERULE", "raw", "other", "AGGREGATION", "median", "10"}, "ERR TSDB: Unknown aggregation type"},
+		{[]any{"TS.ADD", "raw", "1", "1"}, "1"},
+		{[]any{"TS.ADD", "raw", "5", "3"}, "5"},
+		{[]any{"TS.RANGE", "avg", "-", "+"}, "[]"},
+		{[]any{"TS.RANGE", "avg", "-", "+", "LATEST"}, "[[0 2]]"},
+		{[]any{"TS.GET", "avg", "LATEST"}, "[0 2]"},
+		{[]any{"TS.ADD", "raw", "12", "10"}, "12"},
+		{[]any{"TS.RANGE", "avg", "-", "+"}, "[[0 2]]"},
+		{[]any{"TS.ADD", "raw", "3", "5"}, "3"},
+		{[]any{"TS.RANGE", "avg", "-", "+"}, "[[0 3]]"},
+		{[]any{"TS.DEL", "raw", "0", "9"}, "3"},
+		{[]any{"TS.RANGE", "avg", "-", "+"}, "[]"},
+		{[]any{"TS.ADD", "raw", "25", "20"}, "25"},
+		{[]any{"TS.RANGE", "avg", "-", "+", "LATEST"}, "[[10 10] [20 20]]"},
+		{[]any{"TS.INFO", "raw"}, "[totalSamples 2 memoryUsage 4291 firstTimestamp 12 lastTimestamp 25 retentionTime 0 chunkCount 1 chunkSize 4096 chunkType compressed duplicatePolicy <nil> labels [] sourceKey <nil> rules [[avg 10 AVG 0]]]"},
+		{[]any{"TS.DELETERULE", "raw", "avg"}, "OK"},
+		{[]any{"TS.DELETERULE", "raw", "avg"}, "ERR TSDB: compaction rule does not exist"},
+		{[]any{"TS.ADD", "raw", "35", "1"}, "35"},
+		{[]any{"TS.RANGE", "avg", "-", "+"}, "[[10 10]]"},
+
+		// Deleting a destination drops its rule
+		{[]any{"TS.CREATERULE", "raw", "other", "AGGREGATION", "sum", "100"}, "OK"},
+		{[]any{"DEL", "other"}, "1"},
+		{[]any{"TS.ADD", "raw", "200", "1"}, "200"},
+		{[]any{"EXISTS", "other"}, "0"},
+		{[]any{"SET", "other", "v"}, "OK"},
+		{[]any{"TS.ADD", "raw", "300", "1"}, "300"},
+		{[]any{"GET", "other"}, "v"},
+		{[]any{"TS.CREATE", "avg2"}, "OK"},
+		{[]any{"TS.CREATERULE", "raw", "avg2", "AGGREGATION", "last", "100", "50"}, "OK"},
+		{[]any{"TS.INFO", "raw"}, "[totalSamples 5 memoryUsage 4292 firstTimestamp 12 lastTimestamp 300 retentionTime 0 chunkCount 1 chunkSize 4096 chunkType compressed duplicatePolicy <nil> labels [] sourceKey <nil> rules [[avg2 100 LAST 50]]]"},
+
+		// A copy keeps the samples but not the rules
+		{[]any{"COPY", "raw", "copy"}, "1"},
+		{[]any{"TS.ADD", "copy", "400", "1"}, "400"},
+		{[]any{"TS.INFO", "copy"}, "[totalSamples 6 memoryUsage 4224 firstTimestamp 12 lastTimestamp 400 retentionTime 0 chunkCount 1 chunkSize 4096 chunkType compressed duplicatePolicy <nil> labels [] sourceKey <nil> rules []]"},
+	})
+}
+
+// TestMultiSeries tests the commands selecting series by their labels
+func TestMultiSeries(t *testing.T) {
+	_, rdb := startServer(t)
+	run(t, rdb, []struct {
+		args     []any
+		expected string
+	}{
+		{[]any{"TS.CREATE", "t:kitchen", "LABELS", "sensor", "temp", "room", "kitchen"}, "OK"},
+		{[]any{"TS.CREATE", "t:hall", "LABELS", "sensor", "temp", "room", "hall"}, "OK"},
+		{[]any{"TS.CREATE", "h:kitchen", "LABELS", "sensor", "humidity", "room", "kitchen"}, "OK"},
+		{[]any{"TS.MADD", "t:kitchen", "10", "20", "t:hall", "10", "18", "h:kitchen", "10", "60", "t:kitchen", "20", "22", "t:hall", "30", "19"}, "[10 10 10 20 30]"},
+		{[]any{"TS.QUERYINDEX", "sensor=temp"}, "[t:hall t:kitchen]"},
+		{[]any{"TS.QUERYINDEX", "room=kitchen", "sensor!=temp"}, "[h:kitchen]"},
+		{[]any{"TS.QUERYINDEX", "sensor!=temp"}, "ERR TSDB: please provide at least one matcher"},
+		{[]any{"TS.MGET", "FILTER", "room=kitchen"}, "[[h:kitchen [] [10 60]] [t:kitchen [] [20 22]]]"},
+		{[]any{"TS.MGET", "SELECTED_LABELS", "room", "floor", "FILTER", "sensor=temp"}, "[[t:hall [[room hall] [floor <nil>]] [30 19]] [t:kitchen [[room kitchen] [floor <nil>]] [20 22]]]"},
+		{[]any{"TS.MRANGE", "-", "+", "WITHLABELS", "FILTER", "sensor=humidity"}, "[[h:kitchen [[sensor humidity] [room kitchen]] [[10 60]]]]"},
+		{[]any{"TS.MRANGE", "-", "+", "AGGREGATION", "max", "100", "FILTER", "sensor=temp"}, "[[t:hall [] [[0 19]]] [t:kitchen [] [[0 22]]]]"},
+		{[]any{"TS.MREVRANGE", "-", "+", "COUNT", "1", "FILTER", "sensor=temp"}, "[[t:hall [] [[30 19]]] [t:kitchen [] [[20 22]]]]"},
+		{[]any{"TS.MRANGE", "-", "+", "FILTER", "room=(hall,kitchen)", "GROUPBY", "sensor", "REDUCE", "max"}, "[[sensor=humidity [[sensor humidity] [__reducer__ max] [__source__ h:kitchen]] [[10 60]]] [sensor=temp [[sensor temp] [__reducer__ max] [__source__ t:hall,t:kitchen]] [[10 20] [20 22] [30 19]]]]"},
+		{[]any{"TS.MRANGE", "-", "+", "GROUPBY", "sensor", "REDUCE", "max"}, "ERR TSDB: missing FILTER argument"},
+		{[]any{"TS.MRANGE", "-", "+", "FILTER", "sensor=temp", "GROUPBY", "sensor"}, "ERR TSDB: GROUPBY needs a label and REDUCE a reducer"},
+	})
+}
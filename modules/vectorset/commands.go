@@ -0,0 +1,657 @@
+package vectorset
+
+import (
+	"cmp"
+	"encoding/json"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/l00pss/redkit"
+	"github.com/l00pss/redkit/args"
+	"github.com/l00pss/redkit/store"
+)
+
+// module implements the V* commands over a server's storage
+type module struct {
+	server *redkit.Server
+}
+
+// storage returns the storage of the database conn selected, which Register
+// found to be a store.ValueStorage
+func (m *module) storage(conn *redkit.Connection) store.ValueStorage {
+	return m.server.Database(conn.DB()).(store.ValueStorage)
+}
+
+// commands returns the V* commands as a command set
+func (m *module) commands() *redkit.CommandSet {
+	cs := redkit.NewCommandSet("vectorset")
+	cs.RegisterFunc(string(redkit.VADD), m.vadd, redkit.MinArgs(4), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdWrite), redkit.WithCategories("vectorset"), redkit.WithSummary("Add one or more elements to a vector set, or update its vector if it already exists"))
+	cs.RegisterFunc(string(redkit.VSIM), m.vsim, redkit.MinArgs(3), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdReadOnly), redkit.WithCategories("vectorset"), redkit.WithSummary("Return elements by vector similarity"))
+	cs.RegisterFunc(string(redkit.VCARD), m.vcard, redkit.ExactArgs(1), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdReadOnly|redkit.CmdFast), redkit.WithCategories("vectorset"), redkit.WithSummary("Return the number of elements in a vector set"))
+	cs.RegisterFunc(string(redkit.VDIM), m.vdim, redkit.ExactArgs(1), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdReadOnly|redkit.CmdFast), redkit.WithCategories("vectorset"), redkit.WithSummary("Return the dimension of vectors in the vector set"))
+	cs.RegisterFunc(string(redkit.VEMB), m.vemb, redkit.RangeArgs(2, 3), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdReadOnly|redkit.CmdFast), redkit.WithCategories("vectorset"), redkit.WithSummary("Return the vector associated with an element"))
+	cs.RegisterFunc(string(redkit.VREM), m.vrem, redkit.ExactArgs(2), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdWrite), redkit.WithCategories("vectorset"), redkit.WithSummary("Remove an element from a vector set"))
+	cs.RegisterFunc(string(redkit.VISMEMBER), m.vismember, redkit.ExactArgs(2), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdReadOnly|redkit.CmdFast), redkit.WithCategories("vectorset"), redkit.WithSummary("Check if an element exists in a vector set"))
+	cs.RegisterFunc(string(redkit.VGETATTR), m.vgetattr, redkit.ExactArgs(2), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdReadOnly|redkit.CmdFast), redkit.WithCategories("vectorset"), redkit.WithSummary("Retrieve the JSON attributes of elements"))
+	cs.RegisterFunc(string(redkit.VSETATTR), m.vsetattr, redkit.ExactArgs(3), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdWrite|redkit.CmdFast), redkit.WithCategories("vectorset"), redkit.WithSummary("Associate or remove the JSON attributes of elements"))
+	cs.RegisterFunc(string(redkit.VINFO), m.vinfo, redkit.ExactArgs(1), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdReadOnly|redkit.CmdFast), redkit.WithCategories("vectorset"), redkit.WithSummary("Return information about a vector set"))
+	cs.RegisterFunc(string(redkit.VLINKS), m.vlinks, redkit.RangeArgs(2, 3), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdReadOnly), redkit.WithCategories("vectorset"), redkit.WithSummary("Return the neighbors of an element at each layer in the HNSW graph"))
+	cs.RegisterFunc(string(redkit.VRANDMEMBER), m.vrandmember, redkit.RangeArgs(1, 2), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdReadOnly), redkit.WithCategories("vectorset"), redkit.WithSummary("Return one or multiple random members from a vector set"))
+	cs.RegisterFunc(string(redkit.VRANGE), m.vrange, redkit.RangeArgs(3, 4), redkit.WithKeys(1, 1, 1), redkit.WithFlags(redkit.CmdReadOnly), redkit.WithCategories("vectorset"), redkit.WithSummary("Return elements in a lexicographical range"))
+	return cs
+}
+
+var (
+	null = redkit.RedisValue{Type: redkit.Null}
+
+	errNoKey       = redkit.NewError(redkit.ErrPrefixGeneric, "key does not exist")
+	errNoElement   = redkit.NewError(redkit.ErrPrefixGeneric, "element not found in set")
+	errVector      = redkit.NewError(redkit.ErrPrefixGeneric, "invalid vector specification")
+	errVectorKind  = redkit.NewError(redkit.ErrPrefixGeneric, "expected FP32 or VALUES")
+	errQuery       = redkit.NewError(redkit.ErrPrefixGeneric, "expected ELE, FP32 or VALUES")
+	errQuantFlags  = redkit.NewError(redkit.ErrPrefixGeneric, "use only one of NOQUANT, Q8 or BIN")
+	errQuantChange = redkit.NewError(redkit.ErrPrefixGeneric, "asked quantization mismatch with existing vector set")
+	errReduce      = redkit.NewError(redkit.ErrPrefixGeneric, "REDUCE dimension must be positive and smaller than the vector dimension")
+	errReduceSet   = redkit.NewError(redkit.ErrPrefixGeneric, "REDUCE dimension mismatch with existing vector set")
+	errM           = redkit.NewError(redkit.ErrPrefixGeneric, "M must be between 4 and 4096")
+	errEF          = redkit.NewError(redkit.ErrPrefixGeneric, "EF must be between 1 and 1000000")
+	errCount       = redkit.NewError(redkit.ErrPrefixGeneric, "COUNT must be positive")
+	errEpsilon     = redkit.NewError(redkit.ErrPrefixGeneric, "EPSILON must be between 0 and 1")
+	errAttributes  = redkit.NewError(redkit.ErrPrefixGeneric, "attributes must be a JSON object")
+	errRange       = redkit.NewError(redkit.ErrPrefixGeneric, "range must start with [ or ( or be - or +")
+)
+
+func integer(n int) redkit.RedisValue {
+	return redkit.RedisValue{Type: redkit.Integer, Int: int64(n)}
+}
+
+func bulk(s string) redkit.RedisValue {
+	return redkit.RedisValue{Type: redkit.BulkString, Bulk: []byte(s)}
+}
+
+func double(f float64) redkit.RedisValue {
+	return redkit.RedisValue{Type: redkit.Double, Float: f}
+}
+
+// widen returns x as the float64 printing like it, 0.1 rather than
+// 0.10000000149011612
+func widen(x float32) float64 {
+	f, _ := strconv.ParseFloat(strconv.FormatFloat(float64(x), 'g', -1, 32), 64)
+	return f
+}
+
+func array(values []redkit.RedisValue) redkit.RedisValue {
+	return redkit.RedisValue{Type: redkit.Array, Array: values}
+}
+
+func boolean(b bool) redkit.RedisValue {
+	if b {
+		return integer(1)
+	}
+	return integer(0)
+}
+
+// dimMismatch is the error for a vector of got components given to a set of
+// vectors of want
+func dimMismatch(got, want int) *redkit.RedisError {
+	return redkit.NewError(redkit.ErrPrefixGeneric, "Vector dimension mismatch - got %d but set has %d", got, want)
+}
+
+// view calls fn with the set at key and returns its reply, or missing if
+// there is none
+func (m *module) view(conn *redkit.Connection, key string, missing redkit.RedisValue, fn func(s *Set) redkit.RedisValue) redkit.RedisValue {
+	reply := missing
+	err := m.storage(conn).ViewValues([]string{key}, TypeName, func(values []store.Value) {
+		if values[0] != nil {
+			reply = fn(values[0].(*Set))
+		}
+	})
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	m.server.KeysRead(conn, key)
+	return reply
+}
+
+// update calls fn with the set at key and returns its reply, or missing if
+// there is none. A set fn empties is deleted.
+func (m *module) update(conn *redkit.Connection, key string, missing redkit.RedisValue, fn func(s *Set) (redkit.RedisValue, bool)) redkit.RedisValue {
+	reply := missing
+	changed := false
+	err := m.storage(conn).UpdateValues([]string{key}, TypeName, func(values []store.Value) error {
+		if values[0] == nil {
+			return nil
+		}
+		s := values[0].(*Set)
+		if reply, changed = fn(s); s.Len() == 0 {
+			values[0] = nil
+		}
+		return nil
+	})
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	if changed {
+		m.server.KeysWritten(conn, key)
+	}
+	return reply
+}
+
+// parseVector parses FP32 blob or VALUES num value...
+func parseVector(p *args.Parser) ([]float32, error) {
+	var blob string
+	var n int64
+	switch {
+	case p.MatchKeyword("FP32", &blob):
+		if err := p.Err(); err != nil {
+			return nil, err
+		}
+		v, ok := parseFP32(blob)
+		if !ok {
+			return nil, errVector
+		}
+		return v, nil
+	case p.MatchKeyword("VALUES", &n):
+		if err := p.Err(); err != nil {
+			return nil, err
+		}
+		if n <= 0 || n > int64(p.Remaining()) {
+			return nil, errVector
+		}
+		v := make([]float32, n)
+		for i := range v {
+			f := p.NextFloat()
+			if p.Err() != nil || math.IsInf(float64(float32(f)), 0) {
+				return nil, errVector
+			}
+			v[i] = float32(f)
+		}
+		return v, nil
+	}
+	return nil, errVectorKind
+}
+
+// parseAttributes parses the JSON object of SETATTR and VSETATTR, nil for
+// the empty string
+func parseAttributes(text string) (map[string]any, error) {
+	if text == "" {
+		return nil, nil
+	}
+	var parsed map[string]any
+	if err := json.Unmarshal([]byte(text), &parsed); err != nil || parsed == nil {
+		return nil, errAttributes
+	}
+	return parsed, nil
+}
+
+// VADD key [REDUCE dim] (FP32 blob | VALUES num value...) element [CAS]
+// [NOQUANT | Q8 | BIN] [EF build-exploration-factor] [SETATTR attributes]
+// [M numlinks]
+func (m *module) vadd(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	key := cmd.Args[0]
+	p := args.New(cmd.Args[1:])
+	var reduce int64
+	p.MatchKeyword("REDUCE", &reduce)
+	v, err := parseVector(p)
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	name := p.NextString()
+
+	quant := ""
+	var links, ef int64
+	var attrs *string
+	for p.More() && p.Err() == nil {
+		var text string
+		switch {
+		case p.MatchFlag("CAS"), p.MatchFlag("NOTHREAD"):
+			// Insertions run in the command's goroutine anyway
+		case p.MatchFlag("NOQUANT"):
+			quant = setOnce(p, quant, quantFP32)
+		case p.MatchFlag("Q8"):
+			quant = setOnce(p, quant, quantQ8)
+		case p.MatchFlag("BIN"):
+			quant = setOnce(p, quant, quantBin)
+		case p.MatchKeyword("EF", &ef):
+			if p.Err() == nil && (ef < 1 || ef > 1000000) {
+				return errEF.Value()
+			}
+		case p.MatchKeyword("M", &links):
+			if p.Err() == nil && (links < 4 || links > 4096) {
+				return errM.Value()
+			}
+		case p.MatchKeyword("SETATTR", &text):
+			attrs = &text
+		default:
+			p.Fail(args.ErrSyntax)
+		}
+	}
+	if err := p.Done(); err != nil {
+		return redkit.ErrorValue(err)
+	}
+	if reduce != 0 && (reduce < 0 || reduce >= int64(len(v))) {
+		return errReduce.Value()
+	}
+	var parsed map[string]any
+	if attrs != nil {
+		if parsed, err = parseAttributes(*attrs); err != nil {
+			return redkit.ErrorValue(err)
+		}
+	}
+
+	added := false
+	err = m.storage(conn).UpdateValues([]string{key}, TypeName, func(values []store.Value) error {
+		s, _ := values[0].(*Set)
+		if s == nil {
+			dim := len(v)
+			var proj *projection
+			if reduce > 0 {
+				dim, proj = int(reduce), newProjection(len(v), int(reduce))
+			}
+			s = newSet(dim, cmp.Or(quant, quantQ8), proj, int(cmp.Or(links, defaultM)), int(cmp.Or(ef, defaultEF)))
+			values[0] = s
+		}
+		switch {
+		case len(v) != s.inputDim():
+			return dimMismatch(len(v), s.inputDim())
+		case reduce > 0 && (s.proj == nil || int(reduce) != s.dim):
+			return errReduceSet
+		case quant != "" && quant != s.quant:
+			return errQuantChange
+		}
+		added = s.add(name, v)
+		if attrs != nil {
+			s.setAttrs(s.elements[name], *attrs, parsed)
+		}
+		return nil
+	})
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	m.server.KeysWritten(conn, key)
+	return boolean(added)
+}
+
+// setOnce returns value for an option that can be given once, failing p if
+// current is already set
+func setOnce(p *args.Parser, current, value string) string {
+	if current != "" && current != value {
+		p.Fail(errQuantFlags)
+	}
+	return value
+}
+
+// VSIM key (ELE element | FP32 blob | VALUES num value...) [WITHSCORES]
+// [WITHATTRIBS] [COUNT num] [EPSILON delta] [EF search-exploration-factor]
+// [FILTER expression] [FILTER-EF max-filtering-effort] [TRUTH] [NOTHREAD]
+func (m *module) vsim(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	key := cmd.Args[0]
+	p := args.New(cmd.Args[1:])
+	var ele string
+	var v []float32
+	if !p.MatchKeyword("ELE", &ele) {
+		var err error
+		if v, err = parseVector(p); err == errVectorKind {
+			return errQuery.Value()
+		} else if err != nil {
+			return redkit.ErrorValue(err)
+		}
+	}
+
+	var withScores, withAttribs, truth bool
+	count, ef, filterEF := int64(10), int64(0), int64(0)
+	epsilon := -1.0
+	var f *filter
+	for p.More() && p.Err() == nil {
+		var expr string
+		switch {
+		case p.MatchFlag("WITHSCORES"):
+			withScores = true
+		case p.MatchFlag("WITHATTRIBS"):
+			withAttribs = true
+		case p.MatchFlag("TRUTH"):
+			truth = true
+		case p.MatchFlag("NOTHREAD"):
+		case p.MatchKeyword("COUNT", &count):
+			if p.Err() == nil && count <= 0 {
+				return errCount.Value()
+			}
+		case p.MatchKeyword("EPSILON", &epsilon):
+			if p.Err() == nil && (epsilon < 0 || epsilon > 1) {
+				return errEpsilon.Value()
+			}
+		case p.MatchKeyword("EF", &ef):
+			if p.Err() == nil && (ef < 1 || ef > 1000000) {
+				return errEF.Value()
+			}
+		case p.MatchKeyword("FILTER-EF", &filterEF):
+			if p.Err() == nil && filterEF < 0 {
+				return errEF.Value()
+			}
+		case p.MatchKeyword("FILTER", &expr):
+			var err error
+			if f, err = parseFilter(expr); err != nil {
+				return redkit.NewError(redkit.ErrPrefixGeneric, "syntax error in FILTER expression: %v", err).Value()
+			}
+		default:
+			p.Fail(args.ErrSyntax)
+		}
+	}
+	if err := p.Done(); err != nil {
+		return redkit.ErrorValue(err)
+	}
+
+	return m.view(conn, key, array([]redkit.RedisValue{}), func(s *Set) redkit.RedisValue {
+		var q []float32
+		if v == nil {
+			e, ok := s.elements[ele]
+			if !ok {
+				return errNoElement.Value()
+			}
+			q = e.vec
+		} else if len(v) != s.inputDim() {
+			return dimMismatch(len(v), s.inputDim()).Value()
+		} else {
+			q = s.query(v)
+		}
+
+		maxVisits := 0
+		if f != nil {
+			maxVisits = int(cmp.Or(filterEF, count*100))
+		}
+		matches := s.search(q, int(count), int(cmp.Or(ef, int64(s.ef))), f, maxVisits, truth)
+		if epsilon >= 0 {
+			matches = slices.DeleteFunc(matches, func(m match) bool { return similarity(m.dist) < 1-epsilon })
+		}
+		return similarReply(conn, matches, withScores, withAttribs)
+	})
+}
+
+// query returns v, given to the set, as a query: projected and at unit
+// length, but not quantized
+func (s *Set) query(v []float32) []float32 {
+	if s.proj != nil {
+		v = s.proj.apply(v)
+	}
+	unit, _ := normalize(v)
+	return unit
+}
+
+// similarReply returns the elements VSIM found: by name, or with the scores
+// and attributes asked for in a map under RESP3 and flat under RESP2
+func similarReply(conn *redkit.Connection, matches []match, withScores, withAttribs bool) redkit.RedisValue {
+	if !withScores && !withAttribs {
+		reply := make([]redkit.RedisValue, len(matches))
+		for i, m := range matches {
+			reply[i] = bulk(m.e.name)
+		}
+		return array(reply)
+	}
+
+	resp3 := conn != nil && conn.Protocol() >= redkit.RESP3
+	var flat []redkit.RedisValue
+	var entries []redkit.MapEntry
+	for _, m := range matches {
+		var fields []redkit.RedisValue
+		if withScores {
+			fields = append(fields, double(similarity(m.dist)))
+		}
+		if withAttribs {
+			fields = append(fields, attributesReply(m.e))
+		}
+		switch {
+		case !resp3:
+			flat = append(append(flat, bulk(m.e.name)), fields...)
+		case len(fields) == 1:
+			entries = append(entries, redkit.MapEntry{Key: bulk(m.e.name), Value: fields[0]})
+		default:
+			entries = append(entries, redkit.MapEntry{Key: bulk(m.e.name), Value: array(fields)})
+		}
+	}
+	if resp3 {
+		return redkit.RedisValue{Type: redkit.Map, Map: entries}
+	}
+	return array(flat)
+}
+
+// attributesReply returns the attributes of e, null if it has none
+func attributesReply(e *element) redkit.RedisValue {
+	if e.attrs == "" {
+		return null
+	}
+	return bulk(e.attrs)
+}
+
+// VCARD key
+func (m *module) vcard(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	return m.view(conn, cmd.Args[0], integer(0), func(s *Set) redkit.RedisValue {
+		return integer(s.Len())
+	})
+}
+
+// VDIM key
+func (m *module) vdim(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	return m.view(conn, cmd.Args[0], errNoKey.Value(), func(s *Set) redkit.RedisValue {
+		return integer(s.dim)
+	})
+}
+
+// VEMB key element [RAW]
+func (m *module) vemb(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	if len(cmd.Args) == 3 && !strings.EqualFold(cmd.Args[2], "RAW") {
+		return redkit.ErrorValue(args.ErrSyntax)
+	}
+	return m.view(conn, cmd.Args[0], null, func(s *Set) redkit.RedisValue {
+		e, ok := s.elements[cmd.Args[1]]
+		if !ok {
+			return null
+		}
+		if len(cmd.Args) == 3 {
+			reply := []redkit.RedisValue{bulk(s.quant), bulk(string(raw(e.vec, s.quant))), double(widen(e.norm))}
+			if s.quant == quantQ8 {
+				reply = append(reply, double(widen(q8Scale(e.vec)*127)))
+			}
+			return array(reply)
+		}
+		reply := make([]redkit.RedisValue, len(e.vec))
+		for i, x := range e.vec {
+			reply[i] = double(widen(x * e.norm))
+		}
+		return array(reply)
+	})
+}
+
+// VREM key element
+func (m *module) vrem(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	return m.update(conn, cmd.Args[0], integer(0), func(s *Set) (redkit.RedisValue, bool) {
+		removed := s.remove(cmd.Args[1])
+		return boolean(removed), removed
+	})
+}
+
+// VISMEMBER key element
+func (m *module) vismember(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	return m.view(conn, cmd.Args[0], integer(0), func(s *Set) redkit.RedisValue {
+		_, ok := s.elements[cmd.Args[1]]
+		return boolean(ok)
+	})
+}
+
+// VGETATTR key element
+func (m *module) vgetattr(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	return m.view(conn, cmd.Args[0], null, func(s *Set) redkit.RedisValue {
+		if e, ok := s.elements[cmd.Args[1]]; ok {
+			return attributesReply(e)
+		}
+		return null
+	})
+}
+
+// VSETATTR key element attributes, removing the attributes if they are the
+// empty string
+func (m *module) vsetattr(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	parsed, err := parseAttributes(cmd.Args[2])
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	return m.update(conn, cmd.Args[0], integer(0), func(s *Set) (redkit.RedisValue, bool) {
+		e, ok := s.elements[cmd.Args[1]]
+		if ok {
+			s.setAttrs(e, cmd.Args[2], parsed)
+		}
+		return boolean(ok), ok
+	})
+}
+
+// VINFO key
+func (m *module) vinfo(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	return m.view(conn, cmd.Args[0], null, func(s *Set) redkit.RedisValue {
+		index, level := "flat", 0
+		if s.graph != nil {
+			index, level = "hnsw", s.graph.level()
+		}
+		projected := 0
+		if s.proj != nil {
+			projected = s.proj.in
+		}
+		fields := []struct {
+			name  string
+			value redkit.RedisValue
+		}{
+			{"quant-type", bulk(s.quant)},
+			{"hnsw-m", integer(s.m)},
+			{"vector-dim", integer(s.dim)},
+			{"projection-input-dim", integer(projected)},
+			{"size", integer(s.Len())},
+			{"max-level", integer(level)},
+			{"attributes-count", integer(s.attrs)},
+			{"vset-uid", integer(int(s.id))},
+			{"hnsw-max-node-uid", integer(int(s.nextID))},
+			{"index", bulk(index)},
+		}
+		reply := redkit.RedisValue{Type: redkit.Map}
+		for _, f := range fields {
+			reply.Map = append(reply.Map, redkit.MapEntry{Key: bulk(f.name), Value: f.value})
+		}
+		return reply
+	})
+}
+
+// VLINKS key element [WITHSCORES] replies with the neighbours of the
+// element on each level of the HNSW graph, level 0 first. A set searched
+// exhaustively has no graph, and no levels.
+func (m *module) vlinks(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	withScores := len(cmd.Args) == 3
+	if withScores && !strings.EqualFold(cmd.Args[2], "WITHSCORES") {
+		return redkit.ErrorValue(args.ErrSyntax)
+	}
+	return m.view(conn, cmd.Args[0], null, func(s *Set) redkit.RedisValue {
+		e, ok := s.elements[cmd.Args[1]]
+		if !ok {
+			return null
+		}
+		levels := []redkit.RedisValue{}
+		if s.graph != nil {
+			for _, links := range s.graph.nodes[e].links {
+				matches := make([]match, len(links))
+				for i, nb := range links {
+					matches[i] = match{nb.e, distance(e.vec, nb.e.vec)}
+				}
+				levels = append(levels, similarReply(conn, matches, withScores, false))
+			}
+		}
+		return array(levels)
+	})
+}
+
+// VRANDMEMBER key [count], following SRANDMEMBER: distinct elements for a
+// positive count and possibly repeated ones for a negative count
+func (m *module) vrandmember(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	withCount := len(cmd.Args) == 2
+	var count int64
+	if withCount {
+		p := args.New(cmd.Args[1:])
+		if count = p.NextInt(); p.Err() != nil {
+			return redkit.ErrorValue(p.Err())
+		}
+	}
+	missing := null
+	if withCount {
+		missing = array([]redkit.RedisValue{})
+	}
+	return m.view(conn, cmd.Args[0], missing, func(s *Set) redkit.RedisValue {
+		names := s.Members()
+		if !withCount {
+			return bulk(names[rand.IntN(len(names))])
+		}
+		var reply []redkit.RedisValue
+		if count >= 0 {
+			rand.Shuffle(len(names), func(i, j int) { names[i], names[j] = names[j], names[i] })
+			for _, name := range names[:min(int(count), len(names))] {
+				reply = append(reply, bulk(name))
+			}
+		} else {
+			for range -count {
+				reply = append(reply, bulk(names[rand.IntN(len(names))]))
+			}
+		}
+		return array(reply)
+	})
+}
+
+// parseLexBound parses an end of a VRANGE range: [name or (name, inclusive
+// or exclusive, or - and + for the first and last elements
+func parseLexBound(arg string) (name string, exclusive, infinite bool, err error) {
+	switch {
+	case arg == "-" || arg == "+":
+		return arg, false, true, nil
+	case strings.HasPrefix(arg, "["):
+		return arg[1:], false, false, nil
+	case strings.HasPrefix(arg, "("):
+		return arg[1:], true, false, nil
+	}
+	return "", false, false, errRange
+}
+
+// VRANGE key start end [count] replies with the elements from start to end
+// in lexicographical order, up to count of them unless it is negative
+func (m *module) vrange(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+	start, startEx, startInf, err := parseLexBound(cmd.Args[1])
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	end, endEx, endInf, err := parseLexBound(cmd.Args[2])
+	if err != nil {
+		return redkit.ErrorValue(err)
+	}
+	count := int64(-1)
+	if len(cmd.Args) == 4 {
+		p := args.New(cmd.Args[3:])
+		if count = p.NextInt(); p.Err() != nil {
+			return redkit.ErrorValue(p.Err())
+		}
+	}
+	return m.view(conn, cmd.Args[0], array([]redkit.RedisValue{}), func(s *Set) redkit.RedisValue {
+		names := s.Members()
+		slices.Sort(names)
+		reply := []redkit.RedisValue{}
+		for _, name := range names {
+			if count >= 0 && len(reply) == int(count) {
+				break
+			}
+			switch {
+			case startInf && start == "+", endInf && end == "-":
+				return array(reply)
+			case !startInf && (name < start || startEx && name == start):
+				continue
+			case !endInf && (name > end || endEx && name == end):
+				return array(reply)
+			}
+			reply = append(reply, bulk(name))
+		}
+		return array(reply)
+	})
+}
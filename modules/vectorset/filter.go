@@ -0,0 +1,466 @@
+package vectorset
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// filter is a compiled FILTER expression of VSIM, evaluated against the
+// JSON attributes of an element:
+//
+//	.year >= 1980 and .genre in ["drama", "thriller"]
+//	not (.rating < 3.5) || .title == "Alien"
+//
+// Selectors such as .year name the attributes' top-level fields; literals
+// are numbers, quoted strings, true, false and arrays of them. Operators are
+// the arithmetic + - * / % and **, the comparisons == != < <= > >=, in for
+// membership of an array or a substring, and and, or and not, also spelled
+// && || and !. An element without attributes or without a field the
+// expression selects doesn't match.
+type filter struct {
+	root expr
+}
+
+// expr is a node of a filter, evaluating to a float64, string, bool or []any;
+// false reports a missing field
+type expr func(attrs map[string]any) (any, bool)
+
+// parseFilter compiles a FILTER expression
+func parseFilter(text string) (*filter, error) {
+	tokens, err := tokenize(text)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = p.errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &filter{root: root}, nil
+}
+
+// matches reports whether attrs, the parsed attributes of an element, make
+// the expression true
+func (f *filter) matches(attrs map[string]any) bool {
+	if attrs == nil {
+		return false
+	}
+	v, ok := f.root(attrs)
+	return ok && truthy(v)
+}
+
+// token is a lexical element of a filter
+type token struct {
+	kind byte // 'n' number, 's' string, '.' selector, 'w' word, 'o' operator
+	text string
+	num  float64
+	pos  int
+}
+
+// operators are the operator tokens, longer ones first
+var operators = []string{"**", "==", "!=", "<=", ">=", "&&", "||", "+", "-", "*", "/", "%", "<", ">", "!", "(", ")", "[", "]", ","}
+
+func tokenize(text string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(text) && text[i+1] >= '0' && text[i+1] <= '9':
+			j := i + 1
+			for j < len(text) && (text[j] >= '0' && text[j] <= '9' || text[j] == '.' || text[j] == 'e' || text[j] == 'E' ||
+				(text[j] == '+' || text[j] == '-') && (text[j-1] == 'e' || text[j-1] == 'E')) {
+				j++
+			}
+			n, err := strconv.ParseFloat(text[i:j], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at offset %d", text[i:j], i)
+			}
+			tokens = append(tokens, token{kind: 'n', text: text[i:j], num: n, pos: i})
+			i = j
+		case c == '"' || c == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(text) && text[j] != c; j++ {
+				if text[j] == '\\' && j+1 < len(text) {
+					j++
+				}
+				b.WriteByte(text[j])
+			}
+			if j == len(text) {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			tokens = append(tokens, token{kind: 's', text: b.String(), pos: i})
+			i = j + 1
+		case c == '.' || isWordChar(c):
+			j := i + 1
+			for j < len(text) && isWordChar(text[j]) {
+				j++
+			}
+			kind := byte('w')
+			if c == '.' {
+				if j == i+1 {
+					return nil, fmt.Errorf("expected a field name at offset %d", i)
+				}
+				kind = '.'
+			}
+			tokens = append(tokens, token{kind: kind, text: text[i:j], pos: i})
+			i = j
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(text[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q at offset %d", c, i)
+			}
+			tokens = append(tokens, token{kind: 'o', text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return tokens, nil
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c < 0x80 && (unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)))
+}
+
+// filterParser parses tokens by recursive descent, from the lowest
+// precedence: or, and, equality, ordering and in, sums, products, powers
+// and then the unary operators
+type filterParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *filterParser) errorf(format string, a ...any) error {
+	offset := -1
+	if p.pos < len(p.tokens) {
+		offset = p.tokens[p.pos].pos
+	}
+	msg := fmt.Sprintf(format, a...)
+	if offset < 0 {
+		return fmt.Errorf("%s at the end of the expression", msg)
+	}
+	return fmt.Errorf("%s at offset %d", msg, offset)
+}
+
+// match consumes the next token if it is one of ops, operators or words
+func (p *filterParser) match(ops ...string) (string, bool) {
+	if p.pos < len(p.tokens) {
+		t := p.tokens[p.pos]
+		if (t.kind == 'o' || t.kind == 'w') && slices.Contains(ops, t.text) {
+			p.pos++
+			return t.text, true
+		}
+	}
+	return "", false
+}
+
+// binary parses operands with next, joined by ops left to right
+func (p *filterParser) binary(next func() (expr, error), ops ...string) (expr, error) {
+	left, err := next()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.match(ops...)
+		if !ok {
+			return left, nil
+		}
+		right, err := next()
+		if err != nil {
+			return nil, err
+		}
+		left = apply(op, left, right)
+	}
+}
+
+func (p *filterParser) parseOr() (expr, error) {
+	return p.binary(p.parseAnd, "or", "||")
+}
+
+func (p *filterParser) parseAnd() (expr, error) {
+	return p.binary(p.parseEquality, "and", "&&")
+}
+
+func (p *filterParser) parseEquality() (expr, error) {
+	return p.binary(p.parseOrdering, "==", "!=")
+}
+
+func (p *filterParser) parseOrdering() (expr, error) {
+	return p.binary(p.parseSum, "<", "<=", ">", ">=", "in")
+}
+
+func (p *filterParser) parseSum() (expr, error) {
+	return p.binary(p.parseProduct, "+", "-")
+}
+
+func (p *filterParser) parseProduct() (expr, error) {
+	return p.binary(p.parsePower, "*", "/", "%")
+}
+
+// parsePower parses **, which is right associative
+func (p *filterParser) parsePower() (expr, error) {
+	base, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := p.match("**"); !ok {
+		return base, nil
+	}
+	exp, err := p.parsePower()
+	if err != nil {
+		return nil, err
+	}
+	return apply("**", base, exp), nil
+}
+
+func (p *filterParser) parseUnary() (expr, error) {
+	op, ok := p.match("not", "!", "-")
+	if !ok {
+		return p.parsePrimary()
+	}
+	operand, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	if op == "-" {
+		return func(attrs map[string]any) (any, bool) {
+			v, ok := operand(attrs)
+			n, isNum := number(v)
+			return -n, ok && isNum
+		}, nil
+	}
+	return func(attrs map[string]any) (any, bool) {
+		v, ok := operand(attrs)
+		return !truthy(v), ok
+	}, nil
+}
+
+func (p *filterParser) parsePrimary() (expr, error) {
+	if p.pos == len(p.tokens) {
+		return nil, p.errorf("expected a value")
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	switch t.kind {
+	case 'n':
+		return constant(t.num), nil
+	case 's':
+		return constant(t.text), nil
+	case '.':
+		field := t.text[1:]
+		return func(attrs map[string]any) (any, bool) {
+			v, ok := attrs[field]
+			return v, ok && v != nil
+		}, nil
+	case 'w':
+		switch t.text {
+		case "true":
+			return constant(true), nil
+		case "false":
+			return constant(false), nil
+		}
+	case 'o':
+		switch t.text {
+		case "(":
+			e, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := p.match(")"); !ok {
+				return nil, p.errorf("expected )")
+			}
+			return e, nil
+		case "[":
+			return p.parseArray()
+		}
+	}
+	p.pos--
+	return nil, p.errorf("unexpected %q", t.text)
+}
+
+// parseArray parses the elements of an array literal after its [
+func (p *filterParser) parseArray() (expr, error) {
+	var items []expr
+	if _, ok := p.match("]"); ok {
+		return constant([]any{}), nil
+	}
+	for {
+		item, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		if _, ok := p.match("]"); ok {
+			break
+		}
+		if _, ok := p.match(","); !ok {
+			return nil, p.errorf("expected , or ]")
+		}
+	}
+	return func(attrs map[string]any) (any, bool) {
+		values := make([]any, len(items))
+		for i, item := range items {
+			v, ok := item(attrs)
+			if !ok {
+				return nil, false
+			}
+			values[i] = v
+		}
+		return values, true
+	}, nil
+}
+
+func constant(v any) expr {
+	return func(map[string]any) (any, bool) { return v, true }
+}
+
+// apply returns the expression applying the binary operator op
+func apply(op string, left, right expr) expr {
+	return func(attrs map[string]any) (any, bool) {
+		a, ok := left(attrs)
+		if !ok {
+			return nil, false
+		}
+		// and and or short-circuit
+		switch op {
+		case "and", "&&":
+			if !truthy(a) {
+				return false, true
+			}
+		case "or", "||":
+			if truthy(a) {
+				return true, true
+			}
+		}
+		b, ok := right(attrs)
+		if !ok {
+			return nil, false
+		}
+		switch op {
+		case "and", "&&", "or", "||":
+			return truthy(b), true
+		case "==":
+			return equal(a, b), true
+		case "!=":
+			return !equal(a, b), true
+		case "in":
+			return contains(b, a), true
+		}
+		if x, ok := a.(string); ok && op != "+" {
+			if y, ok := b.(string); ok {
+				switch op {
+				case "<":
+					return x < y, true
+				case "<=":
+					return x <= y, true
+				case ">":
+					return x > y, true
+				case ">=":
+					return x >= y, true
+				}
+			}
+		}
+		x, okX := number(a)
+		y, okY := number(b)
+		if !okX || !okY {
+			return nil, false
+		}
+		switch op {
+		case "<":
+			return x < y, true
+		case "<=":
+			return x <= y, true
+		case ">":
+			return x > y, true
+		case ">=":
+			return x >= y, true
+		case "+":
+			return x + y, true
+		case "-":
+			return x - y, true
+		case "*":
+			return x * y, true
+		case "/":
+			return x / y, true
+		case "%":
+			return math.Mod(x, y), true
+		case "**":
+			return math.Pow(x, y), true
+		}
+		return nil, false
+	}
+}
+
+// number returns v as a number: booleans are 1 and 0, and strings holding a
+// number convert
+func number(v any) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		n, err := strconv.ParseFloat(v, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// truthy reports whether v counts as true: non-zero numbers, true and
+// non-empty strings and arrays
+func truthy(v any) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	case []any:
+		return len(v) > 0
+	}
+	return v != nil
+}
+
+// equal reports whether a and b are equal, comparing strings as strings and
+// anything else as numbers
+func equal(a, b any) bool {
+	x, okX := a.(string)
+	y, okY := b.(string)
+	if okX && okY {
+		return x == y
+	}
+	n, okN := number(a)
+	m, okM := number(b)
+	return okN && okM && n == m
+}
+
+// contains reports whether the array haystack has needle, or the string
+// haystack has the string needle
+func contains(haystack, needle any) bool {
+	switch h := haystack.(type) {
+	case []any:
+		return slices.ContainsFunc(h, func(v any) bool { return equal(v, needle) })
+	case string:
+		n, ok := needle.(string)
+		return ok && strings.Contains(h, n)
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package vectorset
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+// TestFilter tests evaluating FILTER expressions against attributes
+func TestFilter(t *testing.T) {
+	var attrs map[string]any
+	json.Unmarshal([]byte(`{"year": 1984, "genre": "drama", "rating": 4.5, "tags": ["a", "b"], "seen": true}`), &attrs)
+
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		{".year > 1980", "true"},
+		{".year >= 1984 and .genre == 'drama'", "true"},
+		{".year > 1990 || .rating >= 4.5", "true"},
+		{"not (.year > 1980)", "false"},
+		{"!.seen", "false"},
+		{".genre in [\"comedy\", \"drama\"]", "true"},
+		{"'b' in .tags", "true"},
+		{"\"ram\" in .genre", "true"},
+		{".year % 100 == 84", "true"},
+		{"2 ** 3 ** 2 == 512", "true"},
+		{"-.rating + 1 == -3.5", "true"},
+		{"(.year - 1900) / 2 * 4 == 168", "true"},
+		{".genre < 'thriller'", "true"},
+		{".missing == 1", "false"},
+		{".missing == 1 or .year == 1984", "false"},
+		{".year == 1984 or .missing == 1", "true"},
+		{".seen && .year", "true"},
+		{".year >", "expected a value at the end of the expression"},
+		{".year > 1 1", `unexpected "1" at offset 10`},
+		{"(.year", "expected ) at the end of the expression"},
+		{".year = 1", "unexpected character '=' at offset 6"},
+		{"'open", "unterminated string at offset 0"},
+		{"maybe", `unexpected "maybe" at offset 0`},
+	}
+	for _, tt := range tests {
+		f, err := parseFilter(tt.expr)
+		var got string
+		if err != nil {
+			got = err.Error()
+		} else {
+			got = fmt.Sprint(f.matches(attrs))
+		}
+		if got != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.expr, tt.expected, got)
+		}
+	}
+
+	f, _ := parseFilter(".year > 0")
+	if f.matches(nil) {
+		t.Error("Expected an element without attributes not to match")
+	}
+}
@@ -0,0 +1,280 @@
+package vectorset
+
+import (
+	"cmp"
+	"container/heap"
+	"math"
+	"math/rand/v2"
+	"slices"
+)
+
+// maxLevel caps the levels of an HNSW graph
+const maxLevel = 16
+
+// hnsw is a Hierarchical Navigable Small World graph over the elements of a
+// set: each node links to its nearest neighbours on level 0 and on the
+// upper levels it was drawn for, which get exponentially sparser, so that a
+// search descends greedily from the top and explores only near level 0.
+type hnsw struct {
+	m              int // links per node on the upper levels, twice that on level 0
+	efConstruction int
+	levelMult      float64
+	nodes          map[*element]*node
+	entry          *node
+	rng            *rand.Rand
+}
+
+// node is an element in the graph, with its links on each of its levels
+type node struct {
+	e     *element
+	links [][]*node
+}
+
+// candidate is a node found by a search and its distance to the query
+type candidate struct {
+	n    *node
+	dist float32
+}
+
+// newHNSW returns an empty graph with m links per node and exploring
+// efConstruction candidates to link a new node
+func newHNSW(m, efConstruction int) *hnsw {
+	return &hnsw{
+		m:              m,
+		efConstruction: efConstruction,
+		levelMult:      1 / math.Log(float64(m)),
+		nodes:          make(map[*element]*node),
+		rng:            rand.New(rand.NewPCG(uint64(m), uint64(efConstruction))),
+	}
+}
+
+// clone returns a copy of h linking the elements copies maps the elements
+// of h to
+func (h *hnsw) clone(copies map[*element]*element) *hnsw {
+	c := newHNSW(h.m, h.efConstruction)
+	nodes := make(map[*node]*node, len(h.nodes))
+	for e, n := range h.nodes {
+		nodes[n] = &node{e: copies[e], links: make([][]*node, len(n.links))}
+		c.nodes[copies[e]] = nodes[n]
+	}
+	for n, copied := range nodes {
+		for level, links := range n.links {
+			copied.links[level] = make([]*node, len(links), cap(links))
+			for i, link := range links {
+				copied.links[level][i] = nodes[link]
+			}
+		}
+	}
+	c.entry = nodes[h.entry]
+	return c
+}
+
+// maxLinks returns the number of links a node keeps on level
+func (h *hnsw) maxLinks(level int) int {
+	if level == 0 {
+		return 2 * h.m
+	}
+	return h.m
+}
+
+// level returns the top level of the graph, -1 if it is empty
+func (h *hnsw) level() int {
+	if h.entry == nil {
+		return -1
+	}
+	return len(h.entry.links) - 1
+}
+
+// insert adds e to the graph, linking it to its nearest neighbours on each
+// of a random number of levels
+func (h *hnsw) insert(e *element) {
+	level := min(int(-math.Log(1-h.rng.Float64())*h.levelMult), maxLevel)
+	n := &node{e: e, links: make([][]*node, level+1)}
+	h.nodes[e] = n
+	if h.entry == nil {
+		h.entry = n
+		return
+	}
+
+	ep, top := h.entry, h.level()
+	for l := top; l > level; l-- {
+		ep = h.searchLayer(e.vec, ep, 1, l, nil, 0)[0].n
+	}
+	for l := min(level, top); l >= 0; l-- {
+		candidates := h.searchLayer(e.vec, ep, h.efConstruction, l, nil, 0)
+		for _, nb := range h.selectNeighbours(candidates, h.maxLinks(l)) {
+			n.links[l] = append(n.links[l], nb)
+			nb.links[l] = append(nb.links[l], n)
+			if len(nb.links[l]) > h.maxLinks(l) {
+				h.relink(nb, l, nb.links[l])
+			}
+		}
+		ep = candidates[0].n
+	}
+	if level > top {
+		h.entry = n
+	}
+}
+
+// remove removes e from the graph. The nodes that linked to it are linked
+// again among their remaining links and e's.
+func (h *hnsw) remove(e *element) {
+	n := h.nodes[e]
+	if n == nil {
+		return
+	}
+	delete(h.nodes, e)
+	for _, other := range h.nodes {
+		for l := range min(len(other.links), len(n.links)) {
+			i := slices.Index(other.links[l], n)
+			if i < 0 {
+				continue
+			}
+			links := slices.Delete(other.links[l], i, i+1)
+			for _, nb := range n.links[l] {
+				if nb != other && nb != n && !slices.Contains(links, nb) {
+					links = append(links, nb)
+				}
+			}
+			h.relink(other, l, links)
+		}
+	}
+	if h.entry == n {
+		h.entry = nil
+		for _, other := range h.nodes {
+			if h.entry == nil || len(other.links) > len(h.entry.links) {
+				h.entry = other
+			}
+		}
+	}
+}
+
+// relink sets the links of n on level to the best of candidates
+func (h *hnsw) relink(n *node, level int, candidates []*node) {
+	sorted := make([]candidate, len(candidates))
+	for i, c := range candidates {
+		sorted[i] = candidate{c, distance(n.e.vec, c.e.vec)}
+	}
+	slices.SortFunc(sorted, compareCandidates)
+	n.links[level] = h.selectNeighbours(sorted, h.maxLinks(level))
+}
+
+// selectNeighbours returns up to m of candidates, sorted nearest first,
+// preferring those nearer to the query than to the ones already selected so
+// that links spread in every direction
+func (h *hnsw) selectNeighbours(candidates []candidate, m int) []*node {
+	selected := make([]*node, 0, m)
+	var skipped []*node
+	for _, c := range candidates {
+		if len(selected) == m {
+			break
+		}
+		diverse := true
+		for _, s := range selected {
+			if distance(c.n.e.vec, s.e.vec) < c.dist {
+				diverse = false
+				break
+			}
+		}
+		if diverse {
+			selected = append(selected, c.n)
+		} else {
+			skipped = append(skipped, c.n)
+		}
+	}
+	for _, n := range skipped {
+		if len(selected) == m {
+			break
+		}
+		selected = append(selected, n)
+	}
+	return selected
+}
+
+// search returns up to k of the nodes nearest to q that accept takes, nil
+// taking all, nearest first. ef is the number of candidates explored on
+// level 0; with accept, up to maxVisits nodes are visited looking for
+// enough of them.
+func (h *hnsw) search(q []float32, k, ef int, accept func(*element) bool, maxVisits int) []candidate {
+	if h.entry == nil {
+		return nil
+	}
+	ep := h.entry
+	for l := h.level(); l > 0; l-- {
+		ep = h.searchLayer(q, ep, 1, l, nil, 0)[0].n
+	}
+	found := h.searchLayer(q, ep, max(ef, k), 0, accept, maxVisits)
+	return found[:min(k, len(found))]
+}
+
+// searchLayer returns the up to ef nodes nearest to q accept takes on level,
+// exploring from ep, nearest first
+func (h *hnsw) searchLayer(q []float32, ep *node, ef, level int, accept func(*element) bool, maxVisits int) []candidate {
+	visited := map[*node]bool{ep: true}
+	first := candidate{ep, distance(q, ep.e.vec)}
+	candidates := &candidateHeap{items: []candidate{first}}
+	results := &candidateHeap{farthest: true}
+	if accept == nil || accept(ep.e) {
+		results.items = append(results.items, first)
+	}
+	for candidates.Len() > 0 {
+		c := heap.Pop(candidates).(candidate)
+		if results.Len() >= ef && c.dist > results.items[0].dist {
+			break
+		}
+		if maxVisits > 0 && len(visited) >= maxVisits {
+			break
+		}
+		for _, nb := range c.n.links[level] {
+			if visited[nb] {
+				continue
+			}
+			visited[nb] = true
+			d := distance(q, nb.e.vec)
+			if results.Len() < ef || d < results.items[0].dist {
+				heap.Push(candidates, candidate{nb, d})
+				if accept == nil || accept(nb.e) {
+					heap.Push(results, candidate{nb, d})
+					if results.Len() > ef {
+						heap.Pop(results)
+					}
+				}
+			}
+		}
+	}
+	slices.SortFunc(results.items, compareCandidates)
+	return results.items
+}
+
+// compareCandidates orders candidates nearest first, then by element name
+func compareCandidates(a, b candidate) int {
+	if c := cmp.Compare(a.dist, b.dist); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.n.e.name, b.n.e.name)
+}
+
+// candidateHeap is a heap of candidates, nearest on top unless farthest
+type candidateHeap struct {
+	items    []candidate
+	farthest bool
+}
+
+func (h *candidateHeap) Len() int { return len(h.items) }
+
+func (h *candidateHeap) Less(i, j int) bool {
+	if h.farthest {
+		return h.items[i].dist > h.items[j].dist
+	}
+	return h.items[i].dist < h.items[j].dist
+}
+
+func (h *candidateHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *candidateHeap) Push(x any) { h.items = append(h.items, x.(candidate)) }
+
+func (h *candidateHeap) Pop() any {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
@@ -0,0 +1,136 @@
+package vectorset
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+)
+
+// randomSet returns a set of n random vectors of dim components, searched
+// through an HNSW graph
+func randomSet(t *testing.T, n, dim int) *Set {
+	t.Helper()
+	rng := rand.New(rand.NewPCG(1, 2))
+	s := newSet(dim, quantFP32, nil, defaultM, 64)
+	for i := range n {
+		v := make([]float32, dim)
+		for j := range v {
+			v[j] = float32(rng.NormFloat64())
+		}
+		s.add(fmt.Sprintf("e%d", i), v)
+	}
+	if s.graph == nil {
+		t.Fatalf("Expected a set of %d elements to have a graph", n)
+	}
+	return s
+}
+
+// recall returns the share of the exact k nearest neighbours of the first
+// queries elements the graph finds
+func recall(s *Set, queries, k int) float64 {
+	found, total := 0, 0
+	for i := range queries {
+		q := s.elements[fmt.Sprintf("e%d", i)].vec
+		exact := make(map[*element]bool)
+		for _, m := range s.search(q, k, 0, nil, 0, true) {
+			exact[m.e] = true
+		}
+		for _, m := range s.search(q, k, defaultEF, nil, 0, false) {
+			if exact[m.e] {
+				found++
+			}
+		}
+		total += len(exact)
+	}
+	return float64(found) / float64(total)
+}
+
+// TestHNSWRecall tests that searching the graph finds nearly all of the
+// nearest neighbours, also after removing elements
+func TestHNSWRecall(t *testing.T) {
+	s := randomSet(t, 1000, 16)
+	if r := recall(s, 50, 10); r < 0.95 {
+		t.Errorf("Expected a recall of at least 0.95, got %.3f", r)
+	}
+
+	for i := 600; i < 900; i++ {
+		s.remove(fmt.Sprintf("e%d", i))
+	}
+	if s.graph == nil || len(s.graph.nodes) != 700 {
+		t.Fatalf("Expected the graph to keep 700 nodes")
+	}
+	for _, n := range s.graph.nodes {
+		for _, links := range n.links {
+			for _, nb := range links {
+				if _, ok := s.graph.nodes[nb.e]; !ok {
+					t.Fatalf("%s links to the removed %s", n.e.name, nb.e.name)
+				}
+			}
+		}
+	}
+	if r := recall(s, 50, 10); r < 0.95 {
+		t.Errorf("Expected a recall of at least 0.95 after removals, got %.3f", r)
+	}
+}
+
+// TestHNSWFilter tests searching the graph for elements a filter takes
+func TestHNSWFilter(t *testing.T) {
+	s := randomSet(t, 600, 8)
+	for i := range 600 {
+		e := s.elements[fmt.Sprintf("e%d", i)]
+		s.setAttrs(e, "", map[string]any{"even": i%2 == 0})
+	}
+	f, err := parseFilter(".even")
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches := s.search(s.elements["e1"].vec, 10, defaultEF, f, 600, false)
+	if len(matches) != 10 {
+		t.Fatalf("Expected 10 matches, got %d", len(matches))
+	}
+	for _, m := range matches {
+		if m.e.parsed["even"] != true {
+			t.Errorf("Filtered search found %s", m.e.name)
+		}
+	}
+}
+
+// TestSetShrinks tests that a set drops its graph when it shrinks
+func TestSetShrinks(t *testing.T) {
+	s := randomSet(t, flatLimit+1, 4)
+	for i := range flatLimit/2 + 1 {
+		s.remove(fmt.Sprintf("e%d", i))
+	}
+	if s.graph != nil {
+		t.Errorf("Expected a set of %d elements to drop its graph", s.Len())
+	}
+}
+
+// TestQuantization tests what the quantization types keep of a vector
+func TestQuantization(t *testing.T) {
+	unit, norm := normalize([]float32{3, -4})
+	if norm != 5 || unit[0] != 0.6 || unit[1] != -0.8 {
+		t.Fatalf("Unexpected normalization %v %v", unit, norm)
+	}
+	if got := quantize(unit, quantFP32); got[0] != unit[0] || got[1] != unit[1] {
+		t.Errorf("NOQUANT changed the vector to %v", got)
+	}
+	if got := quantize(unit, quantBin); fmt.Sprintf("%.3f", got) != "[0.707 -0.707]" {
+		t.Errorf("Unexpected BIN vector %v", got)
+	}
+	q8 := quantize(unit, quantQ8)
+	if fmt.Sprintf("%.2f", q8) != "[0.60 -0.80]" {
+		t.Errorf("Unexpected Q8 vector %v", q8)
+	}
+	if got := raw(q8, quantQ8); int8(got[0]) != 95 || int8(got[1]) != -127 {
+		t.Errorf("Unexpected Q8 bytes %v", got)
+	}
+	if d := distance(unit, unit); d > 1e-6 {
+		t.Errorf("Expected no distance from itself, got %v", d)
+	}
+
+	p := newProjection(8, 3)
+	if got := p.apply(make([]float32, 8)); len(got) != 3 {
+		t.Errorf("Expected 3 components, got %d", len(got))
+	}
+}
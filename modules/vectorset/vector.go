@@ -0,0 +1,163 @@
+package vectorset
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand/v2"
+)
+
+// Quantization types, as VINFO reports them. Vectors are kept with the
+// precision of their set's type, so Q8 and BIN trade accuracy for memory as
+// they do in Redis.
+const (
+	quantFP32 = "f32"  // NOQUANT: 32-bit floats
+	quantQ8   = "int8" // Q8: 8-bit integers scaled by the largest component
+	quantBin  = "bin"  // BIN: the sign of each component
+)
+
+// parseFP32 parses the FP32 blob of VADD and VSIM: little-endian 32-bit
+// floats
+func parseFP32(blob string) ([]float32, bool) {
+	if len(blob) == 0 || len(blob)%4 != 0 {
+		return nil, false
+	}
+	b := []byte(blob)
+	v := make([]float32, len(b)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[i*4:]))
+		if math.IsNaN(float64(v[i])) || math.IsInf(float64(v[i]), 0) {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// normalize returns v scaled to unit length and its length. The zero vector
+// is left as it is.
+func normalize(v []float32) ([]float32, float32) {
+	var sq float64
+	for _, x := range v {
+		sq += float64(x) * float64(x)
+	}
+	norm := float32(math.Sqrt(sq))
+	unit := make([]float32, len(v))
+	for i, x := range v {
+		if norm > 0 {
+			unit[i] = x / norm
+		}
+	}
+	return unit, norm
+}
+
+// quantize returns the unit vector v as the quantization type quant keeps
+// it, scaled back to floats
+func quantize(v []float32, quant string) []float32 {
+	out := make([]float32, len(v))
+	switch quant {
+	case quantQ8:
+		scale := q8Scale(v)
+		for i, x := range v {
+			if scale > 0 {
+				out[i] = float32(math.Round(float64(x/scale))) * scale
+			}
+		}
+	case quantBin:
+		x := float32(1 / math.Sqrt(float64(len(v))))
+		for i := range v {
+			if v[i] < 0 {
+				out[i] = -x
+			} else {
+				out[i] = x
+			}
+		}
+	default:
+		copy(out, v)
+	}
+	return out
+}
+
+// q8Scale returns the value of a step of the 8-bit integers of v under Q8
+func q8Scale(v []float32) float32 {
+	var top float32
+	for _, x := range v {
+		top = max(top, float32(math.Abs(float64(x))))
+	}
+	return top / 127
+}
+
+// raw returns the bytes the quantization type quant keeps for the unit
+// vector v, as VEMB RAW reports them
+func raw(v []float32, quant string) []byte {
+	switch quant {
+	case quantQ8:
+		scale := q8Scale(v)
+		b := make([]byte, len(v))
+		for i, x := range v {
+			if scale > 0 {
+				b[i] = byte(int8(math.Round(float64(x / scale))))
+			}
+		}
+		return b
+	case quantBin:
+		b := make([]byte, (len(v)+7)/8)
+		for i, x := range v {
+			if x >= 0 {
+				b[i/8] |= 1 << (i % 8)
+			}
+		}
+		return b
+	}
+	b := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(b[i*4:], math.Float32bits(x))
+	}
+	return b
+}
+
+// distance returns the cosine distance of the unit vectors a and b, from 0
+// for the same direction to 2 for opposite ones
+func distance(a, b []float32) float32 {
+	var dot float32
+	for i := range a {
+		dot += a[i] * b[i]
+	}
+	return 1 - dot
+}
+
+// similarity returns the score VSIM reports for a distance, from 1 for the
+// same direction to 0 for opposite ones
+func similarity(d float32) float64 {
+	return math.Max(0, math.Min(1, 1-float64(d)/2))
+}
+
+// projection is the random projection of REDUCE, reducing vectors of in
+// components to out, which keeps distances approximately
+type projection struct {
+	in, out int
+	matrix  []float32 // out rows of in columns
+}
+
+// newProjection returns the projection from in to out components. Its
+// matrix is drawn from a normal distribution with a seed depending only on
+// the dimensions, so sets reduced alike project alike.
+func newProjection(in, out int) *projection {
+	rng := rand.New(rand.NewPCG(uint64(in), uint64(out)))
+	p := &projection{in: in, out: out, matrix: make([]float32, in*out)}
+	scale := 1 / math.Sqrt(float64(out))
+	for i := range p.matrix {
+		p.matrix[i] = float32(rng.NormFloat64() * scale)
+	}
+	return p
+}
+
+// apply returns v projected
+func (p *projection) apply(v []float32) []float32 {
+	out := make([]float32, p.out)
+	for i := range out {
+		row := p.matrix[i*p.in : (i+1)*p.in]
+		for j, x := range v {
+			out[i] += row[j] * x
+		}
+	}
+	return out
+}
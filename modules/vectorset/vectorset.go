@@ -0,0 +1,299 @@
+// Package vectorset adds the vector set commands of Redis 8 to a redkit
+// server: VADD, VSIM, VCARD, VDIM, VEMB and the rest of the V* commands, over
+// sets of named vectors kept in the server's storage, so that embedding and
+// RAG workloads can be prototyped against redkit.
+//
+//	server := redkit.NewServer(":6379")
+//	server.EnableBuiltinStore()
+//	if err := vectorset.Register(server); err != nil {
+//		log.Fatal(err)
+//	}
+//
+// VSIM ranks the elements of a set by cosine similarity to a vector or to
+// another element. Small sets are searched exhaustively; once a set grows
+// past a few hundred elements it builds an HNSW graph and searches it
+// approximately, which TRUTH bypasses. Elements can carry JSON attributes
+// that FILTER expressions select on.
+//
+// Sets are Values of the store, so their keys expire, are deleted and are
+// scanned like any other, and are of type vectorset.
+package vectorset
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"sync/atomic"
+
+	"github.com/l00pss/redkit"
+	"github.com/l00pss/redkit/store"
+)
+
+// TypeName is the type of keys holding vector sets
+const TypeName = "vectorset"
+
+const (
+	// flatLimit is the number of elements up to which a set is searched
+	// exhaustively. A set growing past it builds an HNSW graph, which it
+	// drops again once it shrinks to half of it.
+	flatLimit = 512
+	// defaultM is the number of links per HNSW node unless VADD's M says
+	// otherwise
+	defaultM = 16
+	// defaultEF is the exploration factor of building and searching the
+	// HNSW graph unless VADD's or VSIM's EF says otherwise
+	defaultEF = 200
+)
+
+// setIDs numbers sets for VINFO's vset-uid
+var setIDs atomic.Int64
+
+// Set is a vector set, the value the V* commands keep at a key: named
+// vectors of one dimension, with optional JSON attributes
+type Set struct {
+	id       int64
+	dim      int
+	quant    string
+	proj     *projection // REDUCE's, nil if not reduced
+	m        int
+	ef       int
+	elements map[string]*element
+	graph    *hnsw // nil while the set is searched exhaustively
+	nextID   int64
+	attrs    int // elements having attributes
+}
+
+var (
+	_ store.MemoryValue   = (*Set)(nil)
+	_ store.CopyableValue = (*Set)(nil)
+)
+
+// element is a named vector of a set
+type element struct {
+	name   string
+	id     int64
+	vec    []float32 // unit length, at the set's quantization
+	norm   float32
+	attrs  string // JSON text, empty for none
+	parsed map[string]any
+}
+
+// newSet returns an empty set of vectors with dim components after proj
+func newSet(dim int, quant string, proj *projection, m, ef int) *Set {
+	return &Set{
+		id:       setIDs.Add(1),
+		dim:      dim,
+		quant:    quant,
+		proj:     proj,
+		m:        m,
+		ef:       ef,
+		elements: make(map[string]*element),
+	}
+}
+
+// Type returns TypeName
+func (s *Set) Type() string {
+	return TypeName
+}
+
+// Copy returns a copy of the set with its graph, as COPY makes
+func (s *Set) Copy() store.Value {
+	c := *s
+	c.id = setIDs.Add(1)
+	c.elements = make(map[string]*element, len(s.elements))
+	copies := make(map[*element]*element, len(s.elements))
+	for name, e := range s.elements {
+		copied := *e
+		copied.vec = slices.Clone(e.vec)
+		c.elements[name], copies[e] = &copied, &copied
+	}
+	if s.graph != nil {
+		c.graph = s.graph.clone(copies)
+	}
+	return &c
+}
+
+// Len returns the number of elements
+func (s *Set) Len() int {
+	return len(s.elements)
+}
+
+// Approximate sizes in bytes of an element and of its node in the graph,
+// beyond its name, vector, attributes and links
+const (
+	elementOverhead = 112 // the element, its slot in the set and its vector's header
+	nodeOverhead    = 64  // the node, its slot in the graph and its levels' header
+	levelOverhead   = 24  // the links' header of a level
+)
+
+// MemoryUsage returns the approximate bytes the set takes with its graph
+func (s *Set) MemoryUsage() int {
+	size := 0
+	for _, e := range s.elements {
+		size += elementOverhead + len(e.name) + 4*cap(e.vec) + len(e.attrs)
+	}
+	if s.graph != nil {
+		for _, n := range s.graph.nodes {
+			size += nodeOverhead
+			for _, links := range n.links {
+				size += levelOverhead + 8*cap(links)
+			}
+		}
+	}
+	return size
+}
+
+// Dim returns the number of components of the vectors
+func (s *Set) Dim() int {
+	return s.dim
+}
+
+// Members returns the names of the elements, in no particular order
+func (s *Set) Members() []string {
+	names := make([]string, 0, len(s.elements))
+	for name := range s.elements {
+		names = append(names, name)
+	}
+	return names
+}
+
+// inputDim returns the number of components vectors given to the set have
+func (s *Set) inputDim() int {
+	if s.proj != nil {
+		return s.proj.in
+	}
+	return s.dim
+}
+
+// prepare returns v, given to the set, as the set keeps it: projected, at
+// unit length and quantized, and its length
+func (s *Set) prepare(v []float32) ([]float32, float32) {
+	if s.proj != nil {
+		v = s.proj.apply(v)
+	}
+	unit, norm := normalize(v)
+	return quantize(unit, s.quant), norm
+}
+
+// add adds the element name with vector v, replacing the vector of an
+// existing one. It reports whether the element is new.
+func (s *Set) add(name string, v []float32) bool {
+	vec, norm := s.prepare(v)
+	e, exists := s.elements[name]
+	if exists {
+		if s.graph != nil {
+			s.graph.remove(e)
+		}
+		e.vec, e.norm = vec, norm
+	} else {
+		s.nextID++
+		e = &element{name: name, id: s.nextID, vec: vec, norm: norm}
+		s.elements[name] = e
+	}
+	switch {
+	case s.graph != nil:
+		s.graph.insert(e)
+	case len(s.elements) > flatLimit:
+		s.buildGraph()
+	}
+	return !exists
+}
+
+// buildGraph indexes the elements in a new HNSW graph, in the order they
+// were added
+func (s *Set) buildGraph() {
+	elements := make([]*element, 0, len(s.elements))
+	for _, e := range s.elements {
+		elements = append(elements, e)
+	}
+	slices.SortFunc(elements, func(a, b *element) int { return cmp.Compare(a.id, b.id) })
+	s.graph = newHNSW(s.m, s.ef)
+	for _, e := range elements {
+		s.graph.insert(e)
+	}
+}
+
+// remove removes the element name and reports whether there was one
+func (s *Set) remove(name string) bool {
+	e, ok := s.elements[name]
+	if !ok {
+		return false
+	}
+	delete(s.elements, name)
+	if e.attrs != "" {
+		s.attrs--
+	}
+	if s.graph != nil {
+		if len(s.elements) <= flatLimit/2 {
+			s.graph = nil
+		} else {
+			s.graph.remove(e)
+		}
+	}
+	return true
+}
+
+// setAttrs sets the attributes of e to the JSON object text, parsed by
+// parseAttributes, removing them if it is empty
+func (s *Set) setAttrs(e *element, text string, parsed map[string]any) {
+	switch {
+	case e.attrs == "" && text != "":
+		s.attrs++
+	case e.attrs != "" && text == "":
+		s.attrs--
+	}
+	e.attrs, e.parsed = text, parsed
+}
+
+// match is an element VSIM found and its distance to the query
+type match struct {
+	e    *element
+	dist float32
+}
+
+// search returns the k elements nearest to the set's vector q that f takes,
+// nil taking all, nearest first. Exhaustive searches are exact; with exact
+// unset, those of a set with a graph explore ef candidates and, filtering,
+// visit up to maxVisits elements.
+func (s *Set) search(q []float32, k, ef int, f *filter, maxVisits int, exact bool) []match {
+	var accept func(*element) bool
+	if f != nil {
+		accept = func(e *element) bool { return f.matches(e.parsed) }
+	}
+	if s.graph != nil && !exact {
+		found := s.graph.search(q, k, ef, accept, maxVisits)
+		matches := make([]match, len(found))
+		for i, c := range found {
+			matches[i] = match{c.n.e, c.dist}
+		}
+		return matches
+	}
+
+	var matches []match
+	for _, e := range s.elements {
+		if accept == nil || accept(e) {
+			matches = append(matches, match{e, distance(q, e.vec)})
+		}
+	}
+	slices.SortFunc(matches, func(a, b match) int {
+		if c := cmp.Compare(a.dist, b.dist); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.e.name, b.e.name)
+	})
+	return matches[:min(k, len(matches))]
+}
+
+// ErrNoValueStorage is returned by Register for a server whose storage can't
+// hold vector sets
+var ErrNoValueStorage = errors.New("vectorset: the server's storage doesn't implement store.ValueStorage")
+
+// Register registers the V* commands with server, which must have a storage
+// implementing store.ValueStorage, as EnableBuiltinStore's does
+func Register(server *redkit.Server) error {
+	if _, ok := server.Storage().(store.ValueStorage); !ok {
+		return ErrNoValueStorage
+	}
+	m := &module{server: server}
+	return server.Mount(m.commands())
+}
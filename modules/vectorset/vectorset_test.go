@@ -0,0 +1,245 @@
+package vectorset
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/l00pss/redkit"
+	"github.com/redis/go-redis/v9"
+)
+
+// startServer starts a server with the built-in store and the V* commands
+func startServer(t *testing.T) (*redkit.Server, *redis.Client) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to get a free port: %v", err)
+	}
+	address := l.Addr().String()
+	l.Close()
+
+	config := redkit.DefaultServerConfig()
+	config.Address = address
+	config.Logger = redkit.NewDefaultLogger(nil, redkit.LogLevelOff)
+	server := redkit.NewServerWithConfig(config)
+	server.EnableBuiltinStore()
+	if err := Register(server); err != nil {
+		t.Fatalf("Failed to register the vector set commands: %v", err)
+	}
+	if err := server.Listen(); err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go server.Serve()
+
+	rdb := redis.NewClient(&redis.Options{Addr: address, Protocol: 2})
+	t.Cleanup(func() {
+		rdb.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	})
+	return server, rdb
+}
+
+// TestRegister tests that Register needs a storage holding values
+func TestRegister(t *testing.T) {
+	if err := Register(redkit.NewServer("127.0.0.1:0")); err != ErrNoValueStorage {
+		t.Errorf("Expected ErrNoValueStorage without a storage, got %v", err)
+	}
+}
+
+// fp32 returns v as the blob of FP32
+func fp32(v ...float32) string {
+	b := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(b[i*4:], math.Float32bits(x))
+	}
+	return string(b)
+}
+
+// vsetUID matches the vset-uid of VINFO, which depends on the sets created
+// before
+var vsetUID = regexp.MustCompile(`vset-uid \d+`)
+
+// TestCommands tests the V* commands, printing their replies as go-redis
+// returns them
+func TestCommands(t *testing.T) {
+	_, rdb := startServer(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		args     []any
+		expected string
+	}{
+		{[]any{"VADD", "points", "VALUES", "2", "1", "0", "east", "NOQUANT"}, "1"},
+		{[]any{"VADD", "points", "FP32", fp32(0, 1), "north"}, "1"},
+		{[]any{"VADD", "points", "VALUES", "2", "-1", "0", "west", "SETATTR", `{"side":"left","n":3}`}, "1"},
+		{[]any{"VADD", "points", "VALUES", "2", "1", "1", "northeast", "SETATTR", `{"side":"right","n":1}`}, "1"},
+		{[]any{"VADD", "points", "VALUES", "2", "2", "0.1", "east"}, "0"},
+		{[]any{"VADD", "points", "VALUES", "3", "1", "0", "0", "up"}, "ERR Vector dimension mismatch - got 3 but set has 2"},
+		{[]any{"VADD", "points", "VALUES", "2", "1", "0", "q8", "Q8"}, "ERR asked quantization mismatch with existing vector set"},
+		{[]any{"VADD", "points", "VALUES", "2", "1", "0", "both", "Q8", "BIN"}, "ERR use only one of NOQUANT, Q8 or BIN"},
+		{[]any{"VADD", "points", "VALUES", "3", "1", "0", "short"}, "ERR invalid vector specification"},
+		{[]any{"VADD", "points", "FP32", "abc", "bad"}, "ERR invalid vector specification"},
+		{[]any{"VADD", "points", "1", "0", "bad"}, "ERR expected FP32 or VALUES"},
+		{[]any{"VADD", "points", "VALUES", "2", "1", "0", "bad", "SETATTR", "[1]"}, "ERR attributes must be a JSON object"},
+		{[]any{"VADD", "points", "VALUES", "2", "1", "0", "bad", "M", "2"}, "ERR M must be between 4 and 4096"},
+		{[]any{"VADD", "points", "VALUES", "2", "1", "0", "bad", "NOPE"}, "ERR syntax error"},
+		{[]any{"VCARD", "points"}, "4"},
+		{[]any{"VCARD", "missing"}, "0"},
+		{[]any{"VDIM", "points"}, "2"},
+		{[]any{"VDIM", "missing"}, "ERR key does not exist"},
+		{[]any{"VISMEMBER", "points", "north"}, "1"},
+		{[]any{"VISMEMBER", "points", "south"}, "0"},
+		{[]any{"VEMB", "points", "east"}, "[2 0.1]"},
+		{[]any{"VEMB", "points", "south"}, "redis: nil"},
+		{[]any{"VEMB", "points", "north", "RAW"}, "[f32 \x00\x00\x00\x00\x00\x00\x80? 1]"},
+		{[]any{"VSIM", "points", "VALUES", "2", "1", "0"}, "[east northeast north west]"},
+		{[]any{"VSIM", "points", "ELE", "north", "WITHSCORES", "COUNT", "2"}, "[north 1 northeast 0.8535533845424652]"},
+		{[]any{"VSIM", "points", "ELE", "west", "WITHATTRIBS", "COUNT", "1"}, `[west {"side":"left","n":3}]`},
+		{[]any{"VSIM", "points", "ELE", "north", "WITHSCORES", "WITHATTRIBS", "COUNT", "2", "TRUTH"}, "[north 1 <nil> northeast 0.8535533845424652 {\"side\":\"right\",\"n\":1}]"},
+		{[]any{"VSIM", "points", "ELE", "north", "EPSILON", "0.2"}, "[north northeast]"},
+		{[]any{"VSIM", "points", "FP32", fp32(1, 0), "FILTER", ".side == 'left' or .n < 2"}, "[northeast west]"},
+		{[]any{"VSIM", "points", "ELE", "north", "FILTER", ".n >"}, "ERR syntax error in FILTER expression: expected a value at the end of the expression"},
+		{[]any{"VSIM", "points", "ELE", "south"}, "ERR element not found in set"},
+		{[]any{"VSIM", "points", "VALUES", "1", "1"}, "ERR Vector dimension mismatch - got 1 but set has 2"},
+		{[]any{"VSIM", "points", "east", "west"}, "ERR expected ELE, FP32 or VALUES"},
+		{[]any{"VSIM", "points", "ELE", "east", "COUNT", "0"}, "ERR COUNT must be positive"},
+		{[]any{"VSIM", "missing", "ELE", "east"}, "[]"},
+		{[]any{"VGETATTR", "points", "west"}, `{"side":"left","n":3}`},
+		{[]any{"VGETATTR", "points", "north"}, "redis: nil"},
+		{[]any{"VSETATTR", "points", "north", `{"side":"up"}`}, "1"},
+		{[]any{"VSETATTR", "points", "west", ""}, "1"},
+		{[]any{"VSETATTR", "points", "south", `{}`}, "0"},
+		{[]any{"VSETATTR", "points", "north", `{`}, "ERR attributes must be a JSON object"},
+		{[]any{"VGETATTR", "points", "west"}, "redis: nil"},
+		{[]any{"VINFO", "points"}, "[quant-type f32 hnsw-m 16 vector-dim 2 projection-input-dim 0 size 4 max-level 0 attributes-count 2 vset-uid * hnsw-max-node-uid 4 index flat]"},
+		{[]any{"VINFO", "missing"}, "redis: nil"},
+		{[]any{"VLINKS", "points", "north"}, "[]"},
+		{[]any{"VLINKS", "points", "south"}, "redis: nil"},
+		{[]any{"VRANGE", "points", "-", "+"}, "[east north northeast west]"},
+		{[]any{"VRANGE", "points", "(north", "+", "1"}, "[northeast]"},
+		{[]any{"VRANGE", "points", "[e", "[north"}, "[east north]"},
+		{[]any{"VRANGE", "points", "north", "+"}, "ERR range must start with [ or ( or be - or +"},
+		{[]any{"VRANDMEMBER", "points", "-6"}, "len 6"},
+		{[]any{"VRANDMEMBER", "points", "9"}, "len 4"},
+		{[]any{"VRANDMEMBER", "missing"}, "redis: nil"},
+		{[]any{"VRANDMEMBER", "missing", "2"}, "[]"},
+		{[]any{"VREM", "points", "north"}, "1"},
+		{[]any{"VREM", "points", "north"}, "0"},
+		{[]any{"VREM", "points", "east"}, "1"},
+		{[]any{"VREM", "points", "west"}, "1"},
+		{[]any{"VREM", "points", "northeast"}, "1"},
+		{[]any{"EXISTS", "points"}, "0"},
+
+		{[]any{"VADD", "reduced", "REDUCE", "2", "VALUES", "4", "1", "2", "3", "4", "a"}, "1"},
+		{[]any{"VADD", "reduced", "VALUES", "4", "1", "2", "3", "4.1", "b", "BIN"}, "ERR asked quantization mismatch with existing vector set"},
+		{[]any{"VADD", "reduced", "REDUCE", "3", "VALUES", "4", "1", "2", "3", "4", "b"}, "ERR REDUCE dimension mismatch with existing vector set"},
+		{[]any{"VADD", "other", "REDUCE", "4", "VALUES", "4", "1", "2", "3", "4", "a"}, "ERR REDUCE dimension must be positive and smaller than the vector dimension"},
+		{[]any{"VDIM", "reduced"}, "2"},
+		{[]any{"VSIM", "reduced", "VALUES", "4", "1", "2", "3", "4"}, "[a]"},
+		{[]any{"VINFO", "reduced"}, "[quant-type int8 hnsw-m 16 vector-dim 2 projection-input-dim 4 size 1 max-level 0 attributes-count 0 vset-uid * hnsw-max-node-uid 1 index flat]"},
+
+		{[]any{"SET", "str", "v"}, "OK"},
+		{[]any{"VADD", "str", "VALUES", "1", "1", "a"}, "WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{[]any{"VCARD", "str"}, "WRONGTYPE Operation against a key holding the wrong kind of value"},
+	}
+	for _, tt := range tests {
+		got, err := rdb.Do(ctx, tt.args...).Result()
+		reply := vsetUID.ReplaceAllString(fmt.Sprint(got), "vset-uid *")
+		if values, ok := got.([]any); ok && len(tt.expected) > 4 && tt.expected[:4] == "len " {
+			reply = fmt.Sprint("len ", len(values))
+		}
+		if err != nil {
+			reply = err.Error()
+		}
+		if reply != tt.expected {
+			t.Errorf("%v: expected %s, got %s", tt.args, tt.expected, reply)
+		}
+	}
+}
+
+// TestLargeSet tests VSIM and VLINKS on a set large enough to be searched
+// through an HNSW graph
+func TestLargeSet(t *testing.T) {
+	_, rdb := startServer(t)
+	ctx := context.Background()
+
+	pipe := rdb.Pipeline()
+	for i := range flatLimit + 100 {
+		angle := 2 * math.Pi * float64(i) / float64(flatLimit+100)
+		pipe.Do(ctx, "VADD", "circle", "VALUES", "2", math.Cos(angle), math.Sin(angle), fmt.Sprint(i), "NOQUANT", "SETATTR", fmt.Sprintf(`{"i":%d}`, i))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		t.Fatalf("VADD failed: %v", err)
+	}
+
+	info, err := rdb.Do(ctx, "VINFO", "circle").Slice()
+	if err != nil || info[len(info)-1] != "hnsw" {
+		t.Fatalf("Expected the set to be indexed by HNSW, got %v %v", info, err)
+	}
+	got, err := rdb.Do(ctx, "VSIM", "circle", "ELE", "100", "COUNT", "3").StringSlice()
+	if err != nil || fmt.Sprint(got) != "[100 101 99]" && fmt.Sprint(got) != "[100 99 101]" {
+		t.Errorf("Expected the neighbours of 100, got %v %v", got, err)
+	}
+	got, err = rdb.Do(ctx, "VSIM", "circle", "ELE", "100", "COUNT", "2", "FILTER", ".i % 2 == 1").StringSlice()
+	if err != nil || fmt.Sprint(got) != "[101 99]" && fmt.Sprint(got) != "[99 101]" {
+		t.Errorf("Expected the odd neighbours of 100, got %v %v", got, err)
+	}
+	links, err := rdb.Do(ctx, "VLINKS", "circle", "100").Slice()
+	if err != nil || len(links) == 0 || len(links[0].([]any)) == 0 {
+		t.Errorf("Expected links on level 0, got %v %v", links, err)
+	}
+	if usage, err := rdb.MemoryUsage(ctx, "circle").Result(); err != nil || usage < int64(flatLimit+100)*elementOverhead {
+		t.Errorf("Expected MEMORY USAGE to count the elements, got %d %v", usage, err)
+	}
+
+	// A copy has a graph of its own
+	if err := rdb.Copy(ctx, "circle", "copy", 0, false).Err(); err != nil {
+		t.Fatalf("COPY failed: %v", err)
+	}
+	if err := rdb.Do(ctx, "VREM", "copy", "100").Err(); err != nil {
+		t.Fatalf("VREM failed: %v", err)
+	}
+	got, err = rdb.Do(ctx, "VSIM", "copy", "ELE", "101", "COUNT", "2").StringSlice()
+	if err != nil || fmt.Sprint(got) != "[101 102]" {
+		t.Errorf("Expected the neighbours of 101 in the copy, got %v %v", got, err)
+	}
+	got, err = rdb.Do(ctx, "VSIM", "circle", "ELE", "101", "COUNT", "2").StringSlice()
+	if err != nil || fmt.Sprint(got) != "[101 100]" && fmt.Sprint(got) != "[101 102]" {
+		t.Errorf("Expected the neighbours of 101 in the original, got %v %v", got, err)
+	}
+	if n, err := rdb.Do(ctx, "VCARD", "circle").Int(); err != nil || n != flatLimit+100 {
+		t.Errorf("Expected the original to keep its elements, got %d %v", n, err)
+	}
+}
+
+// TestRESP3 tests the map reply of VSIM under RESP3
+func TestRESP3(t *testing.T) {
+	server, _ := startServer(t)
+	server.RegisterCommandFunc("HELLO", func(conn *redkit.Connection, cmd *redkit.Command) redkit.RedisValue {
+		conn.SetProtocol(redkit.RESP3)
+		return redkit.RedisValue{Type: redkit.Map, Map: []redkit.MapEntry{
+			{Key: redkit.RedisValue{Type: redkit.BulkString, Bulk: []byte("proto")}, Value: redkit.RedisValue{Type: redkit.Integer, Int: 3}},
+		}}
+	})
+	rdb := redis.NewClient(&redis.Options{Addr: server.Address, Protocol: 3})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	rdb.Do(ctx, "VADD", "points", "VALUES", "2", "1", "0", "east", "SETATTR", `{"a":1}`)
+	got, err := rdb.Do(ctx, "VSIM", "points", "ELE", "east", "WITHSCORES").Result()
+	if err != nil || fmt.Sprint(got) != "map[east:1]" {
+		t.Errorf("Unexpected reply %v %v", got, err)
+	}
+	got, err = rdb.Do(ctx, "VSIM", "points", "ELE", "east", "WITHSCORES", "WITHATTRIBS").Result()
+	if err != nil || fmt.Sprint(got) != `map[east:[1 {"a":1}]]` {
+		t.Errorf("Unexpected reply %v %v", got, err)
+	}
+}
@@ -0,0 +1,151 @@
+package redkit
+
+import "strings"
+
+// transaction is the MULTI state of a connection. Like the rest of the
+// per-command state it is only used by the connection's goroutine.
+type transaction struct {
+	queued []*Command
+	dirty  bool // a command failed to queue, so EXEC aborts
+}
+
+// txControlCommands run right away between MULTI and EXEC instead of being queued
+var txControlCommands = commandSet(EXEC, DISCARD, MULTI, WATCH, QUIT, RESET)
+
+// exclusive marks a command that takes execMu itself
+func exclusive() CommandOption {
+	return func(e *commandEntry) {
+		e.exclusive = true
+	}
+}
+
+// lockShared takes execMu for reading, as commands do, waiting for the
+// transaction or script holding it. Once a script has run for the
+// ScriptTimeLimit, commands are refused with BUSY instead, except SCRIPT
+// KILL, which runs without execMu to stop it.
+func (s *Server) lockShared(name string, cmd *Command) (bool, *RedisError) {
+	if s.execMu.TryRLock() {
+		return true, nil
+	}
+	run := s.scripts.current()
+	if run == nil {
+		s.execMu.RLock()
+		return true, nil
+	}
+	select {
+	case <-run.busy:
+	default:
+		acquired := make(chan struct{})
+		go func() {
+			s.execMu.RLock()
+			close(acquired)
+		}()
+		select {
+		case <-acquired:
+			return true, nil
+		case <-run.busy:
+			go func() {
+				<-acquired
+				s.execMu.RUnlock()
+			}()
+		}
+	}
+	if name == string(SCRIPT) && len(cmd.Args) > 0 && strings.EqualFold(cmd.Args[0], "KILL") {
+		return false, nil
+	}
+	return false, Busy()
+}
+
+// InMulti reports whether the connection is queueing commands after MULTI
+func (c *Connection) InMulti() bool {
+	return c.tx != nil
+}
+
+// queueCommand queues cmd if the connection is in a transaction and cmd isn't
+// one of the commands controlling it
+func (c *Connection) queueCommand(name string, cmd *Command) bool {
+	if c == nil || c.tx == nil {
+		return false
+	}
+	if _, ok := txControlCommands[name]; ok {
+		return false
+	}
+	c.tx.queued = append(c.tx.queued, cmd)
+	return true
+}
+
+// rejectQueued marks the transaction, if any, to abort on EXEC because a
+// command was rejected before it could be queued, and returns reply
+func (c *Connection) rejectQueued(reply RedisValue) RedisValue {
+	if c != nil && c.tx != nil {
+		c.tx.dirty = true
+	}
+	return reply
+}
+
+// handleMulti implements MULTI
+func (s *Server) handleMulti(conn *Connection, cmd *Command) RedisValue {
+	if conn.tx != nil {
+		return NewError(ErrPrefixGeneric, "MULTI calls can not be nested").Value()
+	}
+	conn.tx = &transaction{}
+	return RedisValue{Type: SimpleString, Str: "OK"}
+}
+
+// handleDiscard implements DISCARD
+func (s *Server) handleDiscard(conn *Connection, cmd *Command) RedisValue {
+	if conn.tx == nil {
+		return NewError(ErrPrefixGeneric, "DISCARD without MULTI").Value()
+	}
+	conn.tx = nil
+	s.watches.unwatch(conn)
+	return RedisValue{Type: SimpleString, Str: "OK"}
+}
+
+// handleExec implements EXEC: the queued commands run one after the other
+// while commands of other connections wait, and their replies are returned as
+// an array. Each runs through the middleware chain like any other command. If
+// a key the connection WATCHed was touched, nothing runs and the reply is null.
+func (s *Server) handleExec(conn *Connection, cmd *Command) RedisValue {
+	tx := conn.tx
+	if tx == nil {
+		return NewError(ErrPrefixGeneric, "EXEC without MULTI").Value()
+	}
+	conn.tx = nil
+	if tx.dirty {
+		s.watches.unwatch(conn)
+		return ExecAbort().Value()
+	}
+
+	var reply RedisValue
+	s.runExclusive(conn, func() {
+		// Writers hold execMu, so no watched key can change once it is taken
+		if s.watches.unwatch(conn) {
+			reply = RedisValue{Type: NullArray}
+			return
+		}
+		replies := make([]RedisValue, len(tx.queued))
+		for i, queued := range tx.queued {
+			// The context the command was queued with ended with that call
+			queued.ctx = cmd.ctx
+			replies[i] = s.handleCommand(conn, queued)
+		}
+		reply = RedisValue{Type: Array, Array: replies}
+	})
+	return reply
+}
+
+// runExclusive runs fn while the commands of other connections wait. The
+// commands fn runs on conn with handleCommand don't wait, and neither does a
+// script run from EXEC, which already holds execMu.
+func (s *Server) runExclusive(conn *Connection, fn func()) {
+	if conn.inExec {
+		fn()
+		return
+	}
+	s.execMu.Lock()
+	defer s.execMu.Unlock()
+	conn.inExec = true
+	defer func() { conn.inExec = false }()
+	fn()
+}
@@ -0,0 +1,184 @@
+package redkit
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestMultiExec(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	values := make(map[string]string)
+	server.RegisterCommandFunc("SET", func(conn *Connection, cmd *Command) RedisValue {
+		values[cmd.Args[0]] = cmd.Args[1]
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	}, ExactArgs(2))
+	server.RegisterCommandFunc("GET", func(conn *Connection, cmd *Command) RedisValue {
+		return RedisValue{Type: BulkString, Bulk: []byte(values[cmd.Args[0]])}
+	}, ExactArgs(1))
+
+	rdb := redis.NewClient(&redis.Options{Addr: address, Protocol: 2})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	var get *redis.StringCmd
+	cmds, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, "key", "value", 0)
+		get = pipe.Get(ctx, "key")
+		return nil
+	})
+	if err != nil || len(cmds) != 2 {
+		t.Fatalf("Transaction failed: %v", err)
+	}
+	if get.Val() != "value" {
+		t.Errorf("Expected GET to see the queued SET, got %q", get.Val())
+	}
+}
+
+func TestMultiErrors(t *testing.T) {
+	_, address := startTestServer(t, nil)
+	client := dialRaw(t, address)
+
+	for _, step := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"EXEC"}, "-ERR EXEC without MULTI"},
+		{[]string{"DISCARD"}, "-ERR DISCARD without MULTI"},
+		{[]string{"MULTI"}, "+OK"},
+		{[]string{"MULTI"}, "-ERR MULTI calls can not be nested"},
+		{[]string{"PING"}, "+QUEUED"},
+		{[]string{"DISCARD"}, "+OK"},
+		{[]string{"MULTI"}, "+OK"},
+		{[]string{"NOPE", "a"}, "-ERR unknown command 'NOPE', with args beginning with: 'a' "},
+		{[]string{"ECHO"}, "-ERR wrong number of arguments for 'echo' command"},
+		{[]string{"PING"}, "+QUEUED"},
+		{[]string{"EXEC"}, "-EXECABORT Transaction discarded because of previous errors."},
+		{[]string{"PING"}, "+PONG"},
+	} {
+		client.send(t, step.args...)
+		if line := client.readLine(t); line != step.want {
+			t.Fatalf("%s: expected %q, got %q", strings.Join(step.args, " "), step.want, line)
+		}
+	}
+}
+
+func TestExecIsNotInterleaved(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	server.RegisterCommandFunc("SLOW", func(conn *Connection, cmd *Command) RedisValue {
+		close(started)
+		<-unblock
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	})
+
+	client := dialRaw(t, address)
+	client.send(t, "MULTI")
+	client.readLine(t)
+	client.send(t, "SLOW")
+	client.readLine(t)
+	client.send(t, "EXEC")
+	<-started
+
+	other := dialRaw(t, address)
+	other.send(t, "PING")
+	replied := make(chan string, 1)
+	go func() {
+		line, _ := other.reader.ReadString('\n')
+		replied <- line
+	}()
+	select {
+	case line := <-replied:
+		t.Fatalf("Expected PING to wait for EXEC, got %q", line)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(unblock)
+	if line := client.readLine(t); line != "*1" {
+		t.Fatalf("Expected a one-element array, got %q", line)
+	}
+	if line := client.readLine(t); line != "+OK" {
+		t.Errorf("Expected +OK, got %q", line)
+	}
+	select {
+	case line := <-replied:
+		if line != "+PONG\r\n" {
+			t.Errorf("Expected +PONG, got %q", line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for PING after EXEC")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	server.RegisterCommandFunc("SET", func(conn *Connection, cmd *Command) RedisValue {
+		server.TouchKey(conn.DB(), cmd.Args[0])
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	}, ExactArgs(2))
+
+	rdb := redis.NewClient(&redis.Options{Addr: address, Protocol: 2})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	// A key touched by another connection aborts the transaction
+	err := rdb.Watch(ctx, func(tx *redis.Tx) error {
+		if err := rdb.Set(ctx, "key", "other", 0).Err(); err != nil {
+			return err
+		}
+		_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, "key", "mine", 0)
+			return nil
+		})
+		return err
+	}, "key")
+	if err != redis.TxFailedErr {
+		t.Errorf("Expected the transaction to fail, got %v", err)
+	}
+
+	// Touching another key or database doesn't
+	err = rdb.Watch(ctx, func(tx *redis.Tx) error {
+		server.TouchKey(0, "unrelated")
+		server.TouchKey(1, "key")
+		_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, "key", "mine", 0)
+			return nil
+		})
+		return err
+	}, "key")
+	if err != nil {
+		t.Errorf("Expected the transaction to succeed, got %v", err)
+	}
+
+	client := dialRaw(t, address)
+	for _, step := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"WATCH", "key"}, "+OK"},
+		{[]string{"UNWATCH"}, "+OK"},
+		{[]string{"SET", "key", "value"}, "+OK"},
+		{[]string{"MULTI"}, "+OK"},
+		{[]string{"WATCH", "key"}, "-ERR WATCH inside MULTI is not allowed"},
+		{[]string{"EXEC"}, "*0"},
+		{[]string{"WATCH", "key"}, "+OK"},
+		{[]string{"SWAPDB", "0", "1"}, "+OK"},
+		{[]string{"MULTI"}, "+OK"},
+		{[]string{"EXEC"}, "*-1"},
+	} {
+		client.send(t, step.args...)
+		if line := client.readLine(t); line != step.want {
+			t.Fatalf("%s: expected %q, got %q", strings.Join(step.args, " "), step.want, line)
+		}
+	}
+	server.watches.mu.Lock()
+	n := len(server.watches.conns)
+	server.watches.mu.Unlock()
+	if n != 0 {
+		t.Errorf("Expected no watching connections after EXEC, got %d", n)
+	}
+}
@@ -0,0 +1,205 @@
+package redkit
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"time"
+)
+
+// Option configures a server created by NewServer or NewServerWithConfig
+type Option func(*ServerConfig)
+
+// WithTLS serves connections over TLS using the given configuration
+func WithTLS(config *tls.Config) Option {
+	return func(c *ServerConfig) {
+		c.TLSConfig = config
+	}
+}
+
+// WithClientCertHook sets the policy applied to client certificates after the TLS handshake
+func WithClientCertHook(hook func(conn *Connection, state tls.ConnectionState) (string, error)) Option {
+	return func(c *ServerConfig) {
+		c.ClientCertHook = hook
+	}
+}
+
+// WithTimeouts sets the read, write and idle timeouts. A zero value disables the timeout.
+func WithTimeouts(read, write, idle time.Duration) Option {
+	return func(c *ServerConfig) {
+		c.ReadTimeout = read
+		c.WriteTimeout = write
+		c.IdleTimeout = idle
+	}
+}
+
+// WithIdleGoodbye sends an error reply to idle clients before disconnecting them
+func WithIdleGoodbye(goodbye bool) Option {
+	return func(c *ServerConfig) {
+		c.IdleGoodbye = goodbye
+	}
+}
+
+// WithIdleCheckFrequency sets how often idle connections are looked for
+func WithIdleCheckFrequency(d time.Duration) Option {
+	return func(c *ServerConfig) {
+		c.IdleCheckFrequency = d
+	}
+}
+
+// WithLogger sets the server logger
+func WithLogger(logger Logger) Option {
+	return func(c *ServerConfig) {
+		c.Logger = logger
+	}
+}
+
+// WithMaxConnections limits the number of concurrent connections. Zero means unlimited.
+func WithMaxConnections(n int) Option {
+	return func(c *ServerConfig) {
+		c.MaxConnections = n
+	}
+}
+
+// WithMaxInlineSize limits the length of inline commands
+func WithMaxInlineSize(n int) Option {
+	return func(c *ServerConfig) {
+		c.MaxInlineSize = n
+	}
+}
+
+// WithMaxNestingDepth limits how deeply client arrays may be nested
+func WithMaxNestingDepth(n int) Option {
+	return func(c *ServerConfig) {
+		c.MaxNestingDepth = n
+	}
+}
+
+// WithConnStateHook sets the function called on every connection state change
+func WithConnStateHook(hook func(net.Conn, ConnState)) Option {
+	return func(c *ServerConfig) {
+		c.ConnStateHook = hook
+	}
+}
+
+// WithProtocolTrace dumps raw RESP traffic to w
+func WithProtocolTrace(w io.Writer) Option {
+	return func(c *ServerConfig) {
+		c.ProtocolTrace = w
+	}
+}
+
+// WithStrictProtocol makes the server reply with protocol errors instead of dropping connections
+func WithStrictProtocol(strict bool) Option {
+	return func(c *ServerConfig) {
+		c.StrictProtocol = strict
+	}
+}
+
+// WithDrainReject makes a draining server reply "-ERR server shutting down" to new commands
+func WithDrainReject(reject bool) Option {
+	return func(c *ServerConfig) {
+		c.DrainReject = reject
+	}
+}
+
+// WithAcceptFilter sets the function deciding whether a new client may connect
+func WithAcceptFilter(filter func(net.Addr) bool) Option {
+	return func(c *ServerConfig) {
+		c.AcceptFilter = filter
+	}
+}
+
+// WithAdminAddress starts the admin HTTP endpoint on addr
+func WithAdminAddress(addr string) Option {
+	return func(c *ServerConfig) {
+		c.AdminAddress = addr
+	}
+}
+
+// WithRequireAuth rejects commands with NOAUTH until the connection is authenticated
+func WithRequireAuth(require bool) Option {
+	return func(c *ServerConfig) {
+		c.RequireAuth = require
+	}
+}
+
+// WithAuthenticator sets the function checking AUTH credentials
+func WithAuthenticator(auth func(conn *Connection, username, password string) error) Option {
+	return func(c *ServerConfig) {
+		c.Authenticator = auth
+	}
+}
+
+// WithPassword requires clients to AUTH with password, like Redis requirepass
+func WithPassword(password string) Option {
+	return WithAuthenticator(PasswordAuthenticator(password))
+}
+
+// WithDatabases sets the number of logical databases SELECT accepts
+func WithDatabases(n int) Option {
+	return func(c *ServerConfig) {
+		c.Databases = n
+	}
+}
+
+// WithCommandTimeout sets the deadline of the context handlers get from Command.Context
+func WithCommandTimeout(d time.Duration) Option {
+	return func(c *ServerConfig) {
+		c.CommandTimeout = d
+	}
+}
+
+// WithCancelOnDisconnect cancels a command's context when its client hangs up mid-command
+func WithCancelOnDisconnect(cancel bool) Option {
+	return func(c *ServerConfig) {
+		c.CancelOnDisconnect = cancel
+	}
+}
+
+// WithDeprecationNotice sets how clients are warned about deprecated commands
+func WithDeprecationNotice(notice DeprecationNotice) Option {
+	return func(c *ServerConfig) {
+		c.DeprecationNotice = notice
+	}
+}
+
+// WithPubSubBuffer sets how many messages can wait to be written to a
+// subscriber before it is disconnected
+func WithPubSubBuffer(n int) Option {
+	return func(c *ServerConfig) {
+		c.PubSubBuffer = n
+	}
+}
+
+// WithScriptTimeLimit sets how long a script runs before other connections
+// are refused with BUSY
+func WithScriptTimeLimit(d time.Duration) Option {
+	return func(c *ServerConfig) {
+		c.ScriptTimeLimit = d
+	}
+}
+
+// WithHandshakeTimeout sets how long a client has to complete the TLS handshake
+func WithHandshakeTimeout(d time.Duration) Option {
+	return func(c *ServerConfig) {
+		c.HandshakeTimeout = d
+	}
+}
+
+// WithKeyspaceEvents sets the key events published as keyspace
+// notifications, with the letters of notify-keyspace-events such as "KEA"
+func WithKeyspaceEvents(letters string) Option {
+	return func(c *ServerConfig) {
+		c.KeyspaceEvents = letters
+	}
+}
+
+// WithActiveExpire sets how often and how hard the built-in store removes
+// expired keys in the background; a negative frequency disables it
+func WithActiveExpire(frequency time.Duration, effort int) Option {
+	return func(c *ServerConfig) {
+		c.ExpireFrequency = frequency
+		c.ExpireEffort = effort
+	}
+}
@@ -0,0 +1,53 @@
+package redkit
+
+import (
+	"crypto/tls"
+	"testing"
+	"time"
+)
+
+// TestServerOptions tests that functional options override the configuration
+func TestServerOptions(t *testing.T) {
+	tlsConfig := &tls.Config{}
+	logger := NewDefaultLogger(nil, LogLevelOff)
+
+	server := NewServer(":7000",
+		WithTLS(tlsConfig),
+		WithTimeouts(time.Second, 2*time.Second, 3*time.Second),
+		WithLogger(logger),
+		WithMaxConnections(10),
+		WithStrictProtocol(true),
+	)
+
+	if server.Address != ":7000" {
+		t.Errorf("Expected address :7000, got %s", server.Address)
+	}
+	if server.TLSConfig != tlsConfig {
+		t.Error("Expected TLS config to be set")
+	}
+	if server.ReadTimeout != time.Second || server.WriteTimeout != 2*time.Second || server.IdleTimeout != 3*time.Second {
+		t.Errorf("Unexpected timeouts: %v %v %v", server.ReadTimeout, server.WriteTimeout, server.IdleTimeout)
+	}
+	if server.Logger != logger {
+		t.Error("Expected logger to be set")
+	}
+	if server.MaxConnections != 10 {
+		t.Errorf("Expected MaxConnections 10, got %d", server.MaxConnections)
+	}
+	if !server.StrictProtocol {
+		t.Error("Expected strict protocol")
+	}
+}
+
+// TestNewServerWithConfigDoesNotModifyConfig tests that options apply to a copy of the config
+func TestNewServerWithConfigDoesNotModifyConfig(t *testing.T) {
+	config := DefaultServerConfig()
+	server := NewServerWithConfig(config, WithMaxConnections(5))
+
+	if server.MaxConnections != 5 {
+		t.Errorf("Expected MaxConnections 5, got %d", server.MaxConnections)
+	}
+	if config.MaxConnections != 1000 {
+		t.Errorf("Expected config to keep MaxConnections 1000, got %d", config.MaxConnections)
+	}
+}
@@ -0,0 +1,108 @@
+package redkit
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pauseState holds an active CLIENT PAUSE
+type pauseState struct {
+	mu        sync.Mutex
+	until     time.Time
+	writeOnly bool
+	resume    chan struct{} // closed when the pause ends early through UNPAUSE
+}
+
+// Pause suspends command processing until d elapses or Unpause is called.
+// With writeOnly, only commands that may modify data are held back. Commands
+// already running are not affected, and CLIENT commands are never paused so
+// the pause can always be lifted. Pausing again extends the pause and widens
+// it to all commands if either call asked for that.
+func (s *Server) Pause(d time.Duration, writeOnly bool) {
+	p := &s.pause
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	until := time.Now().Add(d)
+	if time.Now().Before(p.until) {
+		p.writeOnly = p.writeOnly && writeOnly
+		if until.After(p.until) {
+			p.until = until
+		}
+		return
+	}
+	p.until = until
+	p.writeOnly = writeOnly
+	p.resume = make(chan struct{})
+}
+
+// Unpause ends a pause started by Pause or CLIENT PAUSE
+func (s *Server) Unpause() {
+	p := &s.pause
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.resume != nil && time.Now().Before(p.until) {
+		close(p.resume)
+	}
+	p.until = time.Time{}
+	p.resume = nil
+}
+
+// waitIfPaused blocks while cmd is held back by a pause, or until conn is
+// closed. Replies to commands pipelined before cmd are flushed first.
+func (s *Server) waitIfPaused(conn *Connection, cmd *Command) {
+	if strings.EqualFold(cmd.Name, string(CLIENT)) {
+		return
+	}
+
+	p := &s.pause
+	for {
+		p.mu.Lock()
+		remaining := time.Until(p.until)
+		if remaining <= 0 || (p.writeOnly && !s.commandIsWrite(cmd.Name)) {
+			p.mu.Unlock()
+			return
+		}
+		resume := p.resume
+		p.mu.Unlock()
+
+		conn.flushPending()
+		timer := time.NewTimer(remaining)
+		select {
+		case <-resume:
+		case <-timer.C:
+		case <-conn.ctx.Done():
+			timer.Stop()
+			return
+		}
+		timer.Stop()
+	}
+}
+
+// clientPause implements CLIENT PAUSE timeout [WRITE|ALL]
+func (s *Server) clientPause(args []string) RedisValue {
+	if len(args) < 1 || len(args) > 2 {
+		return WrongArity("client|pause").Value()
+	}
+	ms, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || ms < 0 {
+		return NewError(ErrPrefixGeneric, "timeout is not an integer or out of range").Value()
+	}
+
+	writeOnly := false
+	if len(args) == 2 {
+		switch strings.ToUpper(args[1]) {
+		case "WRITE":
+			writeOnly = true
+		case "ALL":
+		default:
+			return NewError(ErrPrefixGeneric, "CLIENT PAUSE mode must be WRITE or ALL").Value()
+		}
+	}
+
+	s.Pause(time.Duration(ms)*time.Millisecond, writeOnly)
+	return RedisValue{Type: SimpleString, Str: "OK"}
+}
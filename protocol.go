@@ -1,63 +1,469 @@
 package redkit
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"io"
+	"math"
+	"math/big"
 	"strconv"
+	"sync"
 )
 
-// readCommand reads and parses a Redis command from the connection
+// defaultMaxInlineSize is the inline request limit used when the server does not set one
+const defaultMaxInlineSize = 64 * 1024
+
+// defaultMaxNestingDepth is the array nesting limit used when the server does not set one
+const defaultMaxNestingDepth = 32
+
+const (
+	maxBulkStringSize = 512 * 1024 * 1024
+	maxArraySize      = 1024 * 1024 // 1M elements
+
+	// pooledBulkLimit is the largest argument read into the pooled buffer;
+	// bigger payloads take the general path so a bogus size can't force a huge allocation
+	pooledBulkLimit = 1024 * 1024
+
+	// maxPooledBufferSize caps the capacity of buffers returned to the pool
+	maxPooledBufferSize = 4 * 1024 * 1024
+)
+
+// bufferPool holds scratch buffers used to collect command arguments
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, 4096)
+		return &buf
+	},
+}
+
+func getBuffer() *[]byte {
+	buf := bufferPool.Get().(*[]byte)
+	*buf = (*buf)[:0]
+	return buf
+}
+
+func putBuffer(buf *[]byte) {
+	if cap(*buf) > maxPooledBufferSize {
+		return
+	}
+	bufferPool.Put(buf)
+}
+
+// readCommand reads and parses a Redis command from the connection.
+//
+// Arguments sent as bulk strings are collected into a pooled scratch buffer and
+// then copied out once, so Args and the Bulk slices in Raw share a single backing
+// allocation instead of one allocation per argument.
 func (c *Connection) readCommand() (*Command, error) {
-	value, err := c.readValue()
+	prefix, err := c.reader.Peek(1)
 	if err != nil {
 		return nil, err
 	}
+	if prefix[0] != '*' {
+		return c.readInlineCommand()
+	}
 
-	if value.Type != Array {
-		return nil, fmt.Errorf("expected array, got %v", value.Type)
+	header, err := c.readHeaderLine()
+	if err != nil {
+		return nil, err
+	}
+	size, err := parseLength(header[1:])
+	if err != nil {
+		return nil, fatalProtocolError("invalid array size: %v", err)
 	}
 
-	if len(value.Array) == 0 {
-		return nil, fmt.Errorf("empty command array")
+	if size == -1 {
+		return nil, protocolError("expected array, got null array")
+	}
+	if size < 0 {
+		return nil, fatalProtocolError("invalid array size: %d", size)
 	}
+	if size == 0 {
+		return nil, protocolError("empty command array")
+	}
+	if size > maxArraySize {
+		return nil, fatalProtocolError("array too large: %d elements (max: %d)", size, maxArraySize)
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
 
-	cmd := &Command{
-		Raw: value.Array,
+	raw := make([]RedisValue, size)
+	// offsets[2*i] and offsets[2*i+1] delimit element i in buf; -1 marks
+	// elements that were read through the general path
+	var offsetsBuf [32]int
+	offsets := offsetsBuf[:]
+	if 2*size > len(offsetsBuf) {
+		offsets = make([]int, 2*size)
 	}
 
-	switch value.Array[0].Type {
-	case BulkString:
-		cmd.Name = string(value.Array[0].Bulk)
-	case SimpleString:
-		cmd.Name = value.Array[0].Str
-	default:
-		return nil, fmt.Errorf("invalid command name type")
+	// A recoverable error in one element is reported only after the remaining
+	// elements are consumed, so the next command starts on a frame boundary
+	var elemErr error
+
+	for i := 0; i < size; i++ {
+		offsets[2*i] = -1
+
+		p, err := c.reader.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+		if p[0] != '$' {
+			raw[i], err = c.readValueAt(1)
+			if err != nil {
+				if !isRecoverable(err) {
+					return nil, err
+				}
+				if elemErr == nil {
+					elemErr = err
+				}
+			}
+			continue
+		}
+
+		line, err := c.readHeaderLine()
+		if err != nil {
+			return nil, err
+		}
+		n, err := parseLength(line[1:])
+		if err != nil || n < 0 || n > pooledBulkLimit {
+			raw[i], err = c.readBulkString(line[1:])
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		start := len(*buf)
+		if cap(*buf)-start < n {
+			grown := make([]byte, start, 2*cap(*buf)+n)
+			copy(grown, *buf)
+			*buf = grown
+		}
+		*buf = (*buf)[:start+n]
+		if _, err := io.ReadFull(c.reader, (*buf)[start:]); err != nil {
+			return nil, err
+		}
+		if err := c.readCRLF(); err != nil {
+			return nil, err
+		}
+		offsets[2*i] = start
+		offsets[2*i+1] = start + n
+	}
+
+	if elemErr != nil {
+		return nil, elemErr
 	}
 
-	cmd.Args = make([]string, len(value.Array)-1)
-	for i := 1; i < len(value.Array); i++ {
-		switch value.Array[i].Type {
+	data := make([]byte, len(*buf))
+	copy(data, *buf)
+	str := string(data)
+
+	args := make([]string, size)
+	for i := 0; i < size; i++ {
+		if s := offsets[2*i]; s >= 0 {
+			e := offsets[2*i+1]
+			raw[i] = RedisValue{Type: BulkString, Bulk: data[s:e:e]}
+			args[i] = str[s:e]
+			continue
+		}
+
+		switch raw[i].Type {
 		case BulkString:
-			cmd.Args[i-1] = string(value.Array[i].Bulk)
+			args[i] = string(raw[i].Bulk)
 		case SimpleString:
-			cmd.Args[i-1] = value.Array[i].Str
+			args[i] = raw[i].Str
 		default:
-			return nil, fmt.Errorf("invalid argument type at index %d", i)
+			if i == 0 {
+				return nil, protocolError("invalid command name type")
+			}
+			return nil, protocolError("invalid argument type at index %d", i)
 		}
 	}
 
-	return cmd, nil
+	return &Command{
+		Name: args[0],
+		Args: args[1:],
+		Raw:  raw,
+	}, nil
+}
+
+// commandBuffered reports whether the read buffer already holds a complete
+// command, so the next readCommand won't wait for the client
+func (c *Connection) commandBuffered() bool {
+	n := c.reader.Buffered()
+	if n == 0 {
+		return false
+	}
+	buf, _ := c.reader.Peek(n)
+	return completeCommand(buf)
+}
+
+// completeCommand reports whether buf starts with a whole command, either an
+// inline line or an array of bulk strings. Other framing, including malformed
+// input, reports false: the caller then just flushes early.
+func completeCommand(buf []byte) bool {
+	if buf[0] != '*' {
+		// Empty inline lines are skipped by readInlineCommand
+		for {
+			line, rest, ok := bytes.Cut(buf, []byte{'\n'})
+			if !ok {
+				return false
+			}
+			if len(bytes.TrimSpace(line)) > 0 {
+				return true
+			}
+			buf = rest
+		}
+	}
+
+	line, rest, ok := bytes.Cut(buf, []byte{'\n'})
+	if !ok {
+		return false
+	}
+	size, err := parseLength(bytes.TrimSuffix(line[1:], []byte{'\r'}))
+	if err != nil || size <= 0 {
+		return false
+	}
+	for i := 0; i < size; i++ {
+		if len(rest) == 0 || rest[0] != '$' {
+			return false
+		}
+		line, rest, ok = bytes.Cut(rest, []byte{'\n'})
+		if !ok {
+			return false
+		}
+		n, err := parseLength(bytes.TrimSuffix(line[1:], []byte{'\r'}))
+		if err != nil || n < 0 || len(rest) < n+2 {
+			return false
+		}
+		rest = rest[n+2:]
+	}
+	return true
+}
+
+// readHeaderLine reads a CRLF-terminated type header without copying it.
+// The returned slice is only valid until the next read from the connection.
+func (c *Connection) readHeaderLine() ([]byte, error) {
+	line, err := c.reader.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, fatalProtocolError("too big header line")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) >= 2 && line[len(line)-2] == '\r' {
+		return line[:len(line)-2], nil
+	}
+	return line[:len(line)-1], nil
+}
+
+// parseLength parses a decimal length prefix without allocating
+func parseLength(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, fmt.Errorf("empty length")
+	}
+
+	neg := false
+	if b[0] == '-' {
+		neg = true
+		b = b[1:]
+		if len(b) == 0 {
+			return 0, fmt.Errorf("invalid length %q", "-")
+		}
+	}
+
+	n := 0
+	for _, ch := range b {
+		if ch < '0' || ch > '9' {
+			return 0, fmt.Errorf("invalid length %q", b)
+		}
+		n = n*10 + int(ch-'0')
+		if n > maxBulkStringSize {
+			return 0, fmt.Errorf("length out of range")
+		}
+	}
+
+	if neg {
+		return -n, nil
+	}
+	return n, nil
+}
+
+// readInlineCommand reads a command sent in the inline format, e.g. "SET foo bar\r\n".
+// Empty lines are skipped, as Redis does.
+func (c *Connection) readInlineCommand() (*Command, error) {
+	for {
+		line, err := c.readInlineLine()
+		if err != nil {
+			return nil, err
+		}
+
+		args, err := splitInlineArgs(line)
+		if err != nil {
+			return nil, err
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		cmd := &Command{
+			Name: args[0],
+			Args: args[1:],
+			Raw:  make([]RedisValue, len(args)),
+		}
+		for i, arg := range args {
+			cmd.Raw[i] = RedisValue{Type: BulkString, Bulk: []byte(arg)}
+		}
+		return cmd, nil
+	}
+}
+
+// readInlineLine reads a CRLF-terminated line, failing once it exceeds the inline size limit
+func (c *Connection) readInlineLine() ([]byte, error) {
+	limit := defaultMaxInlineSize
+	if c.server != nil {
+		if size := c.server.maxInlineSize(); size > 0 {
+			limit = size
+		}
+	}
+
+	var line []byte
+	for {
+		chunk, err := c.reader.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > limit+2 {
+			return nil, fatalProtocolError("too big inline request")
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+
+	if len(line) >= 2 && line[len(line)-2] == '\r' {
+		line = line[:len(line)-2]
+	} else {
+		line = line[:len(line)-1]
+	}
+	return line, nil
+}
+
+// splitInlineArgs splits an inline request into arguments following the quoting
+// rules of redis-cli: double quotes support escape sequences, single quotes only \'
+func splitInlineArgs(line []byte) ([]string, error) {
+	var args []string
+	i := 0
+	for {
+		for i < len(line) && isInlineSpace(line[i]) {
+			i++
+		}
+		if i >= len(line) {
+			return args, nil
+		}
+
+		var current []byte
+		inDouble, inSingle := false, false
+		done := false
+		for !done {
+			if inDouble {
+				if i >= len(line) {
+					return nil, protocolError("unbalanced quotes in request")
+				}
+				if line[i] == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHexDigit(line[i+2]) && isHexDigit(line[i+3]) {
+					n, _ := strconv.ParseUint(string(line[i+2:i+4]), 16, 8)
+					current = append(current, byte(n))
+					i += 3
+				} else if line[i] == '\\' && i+1 < len(line) {
+					i++
+					switch line[i] {
+					case 'n':
+						current = append(current, '\n')
+					case 'r':
+						current = append(current, '\r')
+					case 't':
+						current = append(current, '\t')
+					case 'b':
+						current = append(current, '\b')
+					case 'a':
+						current = append(current, '\a')
+					default:
+						current = append(current, line[i])
+					}
+				} else if line[i] == '"' {
+					// Closing quote must be followed by a space or nothing at all
+					if i+1 < len(line) && !isInlineSpace(line[i+1]) {
+						return nil, protocolError("unbalanced quotes in request")
+					}
+					done = true
+				} else {
+					current = append(current, line[i])
+				}
+			} else if inSingle {
+				if i >= len(line) {
+					return nil, protocolError("unbalanced quotes in request")
+				}
+				if line[i] == '\\' && i+1 < len(line) && line[i+1] == '\'' {
+					i++
+					current = append(current, '\'')
+				} else if line[i] == '\'' {
+					if i+1 < len(line) && !isInlineSpace(line[i+1]) {
+						return nil, protocolError("unbalanced quotes in request")
+					}
+					done = true
+				} else {
+					current = append(current, line[i])
+				}
+			} else {
+				if i >= len(line) {
+					break
+				}
+				switch line[i] {
+				case ' ', '\t', '\n', '\r', 0:
+					done = true
+				case '"':
+					inDouble = true
+				case '\'':
+					inSingle = true
+				default:
+					current = append(current, line[i])
+				}
+			}
+			if i < len(line) {
+				i++
+			}
+		}
+		args = append(args, string(current))
+	}
+}
+
+func isInlineSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == 0
+}
+
+func isHexDigit(b byte) bool {
+	return (b >= '0' && b <= '9') || (b >= 'a' && b <= 'f') || (b >= 'A' && b <= 'F')
 }
 
 // readValue reads a Redis protocol value
 func (c *Connection) readValue() (RedisValue, error) {
+	return c.readValueAt(0)
+}
+
+// readValueAt reads a value nested inside depth enclosing arrays
+func (c *Connection) readValueAt(depth int) (RedisValue, error) {
 	line, err := c.readLine()
 	if err != nil {
 		return RedisValue{}, err
 	}
 
 	if len(line) == 0 {
-		return RedisValue{}, fmt.Errorf("empty line")
+		return RedisValue{}, protocolError("empty line")
 	}
 
 	switch line[0] {
@@ -68,15 +474,21 @@ func (c *Connection) readValue() (RedisValue, error) {
 	case ':': // Integer
 		n, err := strconv.ParseInt(string(line[1:]), 10, 64)
 		if err != nil {
-			return RedisValue{}, fmt.Errorf("invalid integer: %v", err)
+			return RedisValue{}, protocolError("invalid integer: %v", err)
 		}
 		return RedisValue{Type: Integer, Int: n}, nil
+	case '(': // Big number
+		n, ok := new(big.Int).SetString(string(line[1:]), 10)
+		if !ok {
+			return RedisValue{}, protocolError("invalid big number")
+		}
+		return RedisValue{Type: BigNumber, Big: n}, nil
 	case '$': // Bulk string
 		return c.readBulkString(line[1:])
 	case '*': // Array
-		return c.readArray(line[1:])
+		return c.readArray(line[1:], depth+1)
 	default:
-		return RedisValue{}, fmt.Errorf("invalid RESP protocol indicator: %c (0x%02x)", line[0], line[0])
+		return RedisValue{}, protocolError("invalid RESP protocol indicator: %c (0x%02x)", line[0], line[0])
 	}
 }
 
@@ -101,7 +513,7 @@ func (c *Connection) readLine() ([]byte, error) {
 func (c *Connection) readBulkString(sizeBytes []byte) (RedisValue, error) {
 	size, err := strconv.Atoi(string(sizeBytes))
 	if err != nil {
-		return RedisValue{}, fmt.Errorf("invalid bulk string size: %v", err)
+		return RedisValue{}, fatalProtocolError("invalid bulk string size: %v", err)
 	}
 
 	if size == -1 {
@@ -109,12 +521,11 @@ func (c *Connection) readBulkString(sizeBytes []byte) (RedisValue, error) {
 	}
 
 	if size < 0 {
-		return RedisValue{}, fmt.Errorf("invalid bulk string size: %d", size)
+		return RedisValue{}, fatalProtocolError("invalid bulk string size: %d", size)
 	}
 
-	const maxBulkStringSize = 512 * 1024 * 1024
 	if size > maxBulkStringSize {
-		return RedisValue{}, fmt.Errorf("bulk string too large: %d bytes (max: %d)", size, maxBulkStringSize)
+		return RedisValue{}, fatalProtocolError("bulk string too large: %d bytes (max: %d)", size, maxBulkStringSize)
 	}
 
 	// Read the bulk data plus CRLF
@@ -135,80 +546,276 @@ func (c *Connection) readBulkString(sizeBytes []byte) (RedisValue, error) {
 			return RedisValue{}, err
 		}
 	}
+	if data[size] != '\r' || data[size+1] != '\n' {
+		return RedisValue{}, fatalProtocolError("expected CRLF after bulk string")
+	}
 
 	return RedisValue{Type: BulkString, Bulk: data[:size]}, nil
 }
 
-// readArray reads an array of Redis values
-func (c *Connection) readArray(sizeBytes []byte) (RedisValue, error) {
+// readCRLF reads the CRLF ending a bulk string
+func (c *Connection) readCRLF() error {
+	end, err := c.reader.Peek(2)
+	if err != nil {
+		return err
+	}
+	if end[0] != '\r' || end[1] != '\n' {
+		return fatalProtocolError("expected CRLF after bulk string")
+	}
+	_, err = c.reader.Discard(2)
+	return err
+}
+
+// maxNestingDepth returns the deepest array nesting accepted from clients
+func (c *Connection) maxNestingDepth() int {
+	if c.server != nil {
+		if depth := c.server.maxNestingDepth(); depth > 0 {
+			return depth
+		}
+	}
+	return defaultMaxNestingDepth
+}
+
+// readArray reads an array of Redis values; depth is the nesting level of this array
+func (c *Connection) readArray(sizeBytes []byte, depth int) (RedisValue, error) {
+	if limit := c.maxNestingDepth(); depth > limit {
+		return RedisValue{}, fatalProtocolError("too many nested arrays (max depth: %d)", limit)
+	}
+
 	size, err := strconv.Atoi(string(sizeBytes))
 	if err != nil {
-		return RedisValue{}, fmt.Errorf("invalid array size: %v", err)
+		return RedisValue{}, fatalProtocolError("invalid array size: %v", err)
 	}
 
 	if size == -1 {
-		return RedisValue{Type: Null}, nil
+		return RedisValue{Type: NullArray}, nil
 	}
 
 	if size < 0 {
-		return RedisValue{}, fmt.Errorf("invalid array size: %d", size)
+		return RedisValue{}, fatalProtocolError("invalid array size: %d", size)
 	}
 
-	const maxArraySize = 1024 * 1024 // 1M elements
 	if size > maxArraySize {
-		return RedisValue{}, fmt.Errorf("array too large: %d elements (max: %d)", size, maxArraySize)
+		return RedisValue{}, fatalProtocolError("array too large: %d elements (max: %d)", size, maxArraySize)
 	}
 
+	var elemErr error
 	array := make([]RedisValue, size)
 	for i := 0; i < size; i++ {
-		value, err := c.readValue()
+		value, err := c.readValueAt(depth)
 		if err != nil {
-			return RedisValue{}, err
+			if !isRecoverable(err) {
+				return RedisValue{}, err
+			}
+			if elemErr == nil {
+				elemErr = err
+			}
 		}
 		array[i] = value
 	}
 
+	if elemErr != nil {
+		return RedisValue{}, elemErr
+	}
 	return RedisValue{Type: Array, Array: array}, nil
 }
 
 // writeValue writes a Redis value to the connection in RESP format
 func (c *Connection) writeValue(value RedisValue) error {
+	resp3 := c.Protocol() >= RESP3
+
 	switch value.Type {
 	case SimpleString:
-		_, err := c.writer.WriteString("+" + value.Str + "\r\n")
-		return err
+		return c.writeLine('+', value.Str)
 	case ErrorReply:
-		_, err := c.writer.WriteString("-" + value.Str + "\r\n")
-		return err
+		return c.writeLine('-', value.Str)
 	case Integer:
-		_, err := c.writer.WriteString(":" + strconv.FormatInt(value.Int, 10) + "\r\n")
-		return err
+		return c.writeHeader(':', value.Int)
 	case BulkString:
-		_, err := c.writer.WriteString("$" + strconv.Itoa(len(value.Bulk)) + "\r\n")
-		if err != nil {
+		return c.writeBulk(value.Bulk)
+	case Array:
+		return c.writeAggregate('*', value.Array)
+	case Null:
+		if resp3 {
+			_, err := c.writer.WriteString("_\r\n")
 			return err
 		}
-		_, err = c.writer.Write(value.Bulk)
-		if err != nil {
+		_, err := c.writer.WriteString("$-1\r\n")
+		return err
+	case NullArray:
+		if resp3 {
+			_, err := c.writer.WriteString("_\r\n")
 			return err
 		}
-		_, err = c.writer.WriteString("\r\n")
+		_, err := c.writer.WriteString("*-1\r\n")
 		return err
-	case Array:
-		_, err := c.writer.WriteString("*" + strconv.Itoa(len(value.Array)) + "\r\n")
+	case Map:
+		var err error
+		if resp3 {
+			err = c.writeHeader('%', int64(len(value.Map)))
+		} else {
+			err = c.writeHeader('*', int64(len(value.Map)*2))
+		}
 		if err != nil {
 			return err
 		}
-		for _, item := range value.Array {
-			if err := c.writeValue(item); err != nil {
+		for _, entry := range value.Map {
+			if err := c.writeValue(entry.Key); err != nil {
+				return err
+			}
+			if err := c.writeValue(entry.Value); err != nil {
 				return err
 			}
 		}
 		return nil
-	case Null:
-		_, err := c.writer.WriteString("$-1\r\n")
+	case Set:
+		if resp3 {
+			return c.writeAggregate('~', value.Array)
+		}
+		return c.writeAggregate('*', value.Array)
+	case Double:
+		if resp3 {
+			return c.writeLine(',', formatDouble(value.Float))
+		}
+		return c.writeBulkString(formatDouble(value.Float))
+	case Boolean:
+		if resp3 {
+			if value.Bool {
+				return c.writeLine('#', "t")
+			}
+			return c.writeLine('#', "f")
+		}
+		if value.Bool {
+			return c.writeHeader(':', 1)
+		}
+		return c.writeHeader(':', 0)
+	case BigNumber:
+		digits := value.Str
+		if value.Big != nil {
+			digits = value.Big.String()
+		}
+		if resp3 {
+			return c.writeLine('(', digits)
+		}
+		return c.writeBulkString(digits)
+	case Verbatim:
+		if resp3 {
+			format := value.Format
+			if format == "" {
+				format = VerbatimText
+			}
+			if len(format) != 3 {
+				return fmt.Errorf("invalid verbatim string format: %q", format)
+			}
+			if err := c.writeHeader('=', int64(len(value.Str)+4)); err != nil {
+				return err
+			}
+			if _, err := c.writer.WriteString(format + ":"); err != nil {
+				return err
+			}
+			return c.writeLine(0, value.Str)
+		}
+		return c.writeBulkString(value.Str)
+	case Push:
+		if resp3 {
+			return c.writeAggregate('>', value.Array)
+		}
+		return c.writeAggregate('*', value.Array)
+	case Attribute:
+		if resp3 {
+			if err := c.writeHeader('|', int64(len(value.Map))); err != nil {
+				return err
+			}
+			for _, entry := range value.Map {
+				if err := c.writeValue(entry.Key); err != nil {
+					return err
+				}
+				if err := c.writeValue(entry.Value); err != nil {
+					return err
+				}
+			}
+		}
+		if len(value.Array) == 0 {
+			return fmt.Errorf("attribute without a reply")
+		}
+		return c.writeValue(value.Array[0])
+	case Raw:
+		// The caller is responsible for Bulk holding complete, valid RESP frames
+		_, err := c.writer.Write(value.Bulk)
 		return err
 	default:
 		return fmt.Errorf("unsupported value type: %v", value.Type)
 	}
 }
+
+// writeLine writes a prefix byte followed by s and CRLF. A zero prefix is omitted.
+func (c *Connection) writeLine(prefix byte, s string) error {
+	if prefix != 0 {
+		if err := c.writer.WriteByte(prefix); err != nil {
+			return err
+		}
+	}
+	if _, err := c.writer.WriteString(s); err != nil {
+		return err
+	}
+	_, err := c.writer.WriteString("\r\n")
+	return err
+}
+
+// writeHeader writes a prefix byte followed by a decimal number and CRLF
+func (c *Connection) writeHeader(prefix byte, n int64) error {
+	if err := c.writer.WriteByte(prefix); err != nil {
+		return err
+	}
+	if _, err := c.writer.Write(strconv.AppendInt(c.numBuf[:0], n, 10)); err != nil {
+		return err
+	}
+	_, err := c.writer.WriteString("\r\n")
+	return err
+}
+
+// writeBulk writes a length-prefixed bulk string
+func (c *Connection) writeBulk(data []byte) error {
+	if err := c.writeHeader('$', int64(len(data))); err != nil {
+		return err
+	}
+	if _, err := c.writer.Write(data); err != nil {
+		return err
+	}
+	_, err := c.writer.WriteString("\r\n")
+	return err
+}
+
+// writeBulkString is writeBulk for string payloads
+func (c *Connection) writeBulkString(s string) error {
+	if err := c.writeHeader('$', int64(len(s))); err != nil {
+		return err
+	}
+	return c.writeLine(0, s)
+}
+
+// writeAggregate writes an aggregate header with the given prefix followed by its elements
+func (c *Connection) writeAggregate(prefix byte, items []RedisValue) error {
+	if err := c.writeHeader(prefix, int64(len(items))); err != nil {
+		return err
+	}
+	for _, item := range items {
+		if err := c.writeValue(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatDouble formats a float the way Redis does, including inf/-inf/nan
+func formatDouble(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,376 @@
+package redkit
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"math"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// newTestConnection creates a connection reading from input and writing into the returned buffer
+func newTestConnection(input string) (*Connection, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	conn := &Connection{
+		reader: bufio.NewReader(strings.NewReader(input)),
+		writer: bufio.NewWriter(out),
+		server: NewServer(":0"),
+	}
+	return conn, out
+}
+
+// encode writes value on a fresh connection using the given protocol version
+func encode(t *testing.T, protocol int, value RedisValue) string {
+	t.Helper()
+	conn, out := newTestConnection("")
+	if err := conn.SetProtocol(protocol); err != nil {
+		t.Fatalf("SetProtocol failed: %v", err)
+	}
+	if err := conn.writeValue(value); err != nil {
+		t.Fatalf("writeValue failed: %v", err)
+	}
+	if err := conn.writer.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	return out.String()
+}
+
+// TestWriteRESP3Types tests native RESP3 encoding and the RESP2 downgrade
+func TestWriteRESP3Types(t *testing.T) {
+	tests := []struct {
+		name  string
+		value RedisValue
+		resp2 string
+		resp3 string
+	}{
+		{
+			name: "Map",
+			value: RedisValue{Type: Map, Map: []MapEntry{
+				{Key: RedisValue{Type: BulkString, Bulk: []byte("a")}, Value: RedisValue{Type: Integer, Int: 1}},
+			}},
+			resp2: "*2\r\n$1\r\na\r\n:1\r\n",
+			resp3: "%1\r\n$1\r\na\r\n:1\r\n",
+		},
+		{
+			name:  "Set",
+			value: RedisValue{Type: Set, Array: []RedisValue{{Type: BulkString, Bulk: []byte("x")}}},
+			resp2: "*1\r\n$1\r\nx\r\n",
+			resp3: "~1\r\n$1\r\nx\r\n",
+		},
+		{
+			name:  "Double",
+			value: RedisValue{Type: Double, Float: 1.5},
+			resp2: "$3\r\n1.5\r\n",
+			resp3: ",1.5\r\n",
+		},
+		{
+			name:  "Double infinity",
+			value: RedisValue{Type: Double, Float: math.Inf(-1)},
+			resp2: "$4\r\n-inf\r\n",
+			resp3: ",-inf\r\n",
+		},
+		{
+			name:  "Boolean",
+			value: RedisValue{Type: Boolean, Bool: true},
+			resp2: ":1\r\n",
+			resp3: "#t\r\n",
+		},
+		{
+			name:  "BigNumber",
+			value: RedisValue{Type: BigNumber, Str: "3492890328409238509324850943850943825024385"},
+			resp2: "$43\r\n3492890328409238509324850943850943825024385\r\n",
+			resp3: "(3492890328409238509324850943850943825024385\r\n",
+		},
+		{
+			name:  "BigNumber from big.Int",
+			value: RedisValue{Type: BigNumber, Big: new(big.Int).Lsh(big.NewInt(1), 100)},
+			resp2: "$31\r\n1267650600228229401496703205376\r\n",
+			resp3: "(1267650600228229401496703205376\r\n",
+		},
+		{
+			name:  "Verbatim",
+			value: RedisValue{Type: Verbatim, Str: "hello"},
+			resp2: "$5\r\nhello\r\n",
+			resp3: "=9\r\ntxt:hello\r\n",
+		},
+		{
+			name:  "Verbatim markdown",
+			value: RedisValue{Type: Verbatim, Str: "# hi", Format: VerbatimMarkdown},
+			resp2: "$4\r\n# hi\r\n",
+			resp3: "=8\r\nmkd:# hi\r\n",
+		},
+		{
+			name:  "Null",
+			value: RedisValue{Type: Null},
+			resp2: "$-1\r\n",
+			resp3: "_\r\n",
+		},
+		{
+			name:  "NullArray",
+			value: RedisValue{Type: NullArray},
+			resp2: "*-1\r\n",
+			resp3: "_\r\n",
+		},
+		{
+			name:  "Raw",
+			value: RedisValue{Type: Raw, Bulk: []byte("*1\r\n$3\r\nfoo\r\n")},
+			resp2: "*1\r\n$3\r\nfoo\r\n",
+			resp3: "*1\r\n$3\r\nfoo\r\n",
+		},
+		{
+			name:  "Raw inside array",
+			value: RedisValue{Type: Array, Array: []RedisValue{{Type: Raw, Bulk: []byte(":1\r\n")}}},
+			resp2: "*1\r\n:1\r\n",
+			resp3: "*1\r\n:1\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := encode(t, RESP2, tt.value); got != tt.resp2 {
+				t.Errorf("RESP2: expected %q, got %q", tt.resp2, got)
+			}
+			if got := encode(t, RESP3, tt.value); got != tt.resp3 {
+				t.Errorf("RESP3: expected %q, got %q", tt.resp3, got)
+			}
+		})
+	}
+}
+
+// TestSetProtocolRejectsUnknownVersion tests protocol version validation
+func TestSetProtocolRejectsUnknownVersion(t *testing.T) {
+	conn, _ := newTestConnection("")
+	if conn.Protocol() != RESP2 {
+		t.Errorf("Expected default protocol %d, got %d", RESP2, conn.Protocol())
+	}
+	if err := conn.SetProtocol(4); err == nil {
+		t.Error("Expected error for unsupported protocol version")
+	}
+}
+
+// TestReadInlineCommand tests parsing of inline commands and their quoting rules
+func TestReadInlineCommand(t *testing.T) {
+	tests := []struct {
+		input string
+		name  string
+		args  []string
+	}{
+		{"PING\r\n", "PING", []string{}},
+		{"SET foo bar\r\n", "SET", []string{"foo", "bar"}},
+		{"\r\nECHO   spaced\n", "ECHO", []string{"spaced"}},
+		{"SET k \"hello world\\n\"\r\n", "SET", []string{"k", "hello world\n"}},
+		{"SET k \"\\x41\\x42\"\r\n", "SET", []string{"k", "AB"}},
+		{"SET k 'it\\'s'\r\n", "SET", []string{"k", "it's"}},
+		{"SET k \"\"\r\n", "SET", []string{"k", ""}},
+	}
+
+	for _, tt := range tests {
+		conn, _ := newTestConnection(tt.input)
+		cmd, err := conn.readCommand()
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.input, err)
+			continue
+		}
+		if cmd.Name != tt.name {
+			t.Errorf("%q: expected name %s, got %s", tt.input, tt.name, cmd.Name)
+		}
+		if strings.Join(cmd.Args, "|") != strings.Join(tt.args, "|") || len(cmd.Args) != len(tt.args) {
+			t.Errorf("%q: expected args %q, got %q", tt.input, tt.args, cmd.Args)
+		}
+		if len(cmd.Raw) != len(tt.args)+1 {
+			t.Errorf("%q: expected %d raw values, got %d", tt.input, len(tt.args)+1, len(cmd.Raw))
+		}
+	}
+}
+
+// TestReadInlineCommandErrors tests unbalanced quotes and the inline size limit
+func TestReadInlineCommandErrors(t *testing.T) {
+	for _, input := range []string{"SET k \"open\r\n", "SET k 'open\r\n", "SET k \"a\"b\r\n"} {
+		conn, _ := newTestConnection(input)
+		if _, err := conn.readCommand(); err == nil || !strings.Contains(err.Error(), "unbalanced quotes") {
+			t.Errorf("%q: expected unbalanced quotes error, got %v", input, err)
+		}
+	}
+
+	conn, _ := newTestConnection("SET k " + strings.Repeat("x", 10000) + "\r\n")
+	conn.server.MaxInlineSize = 1024
+	if _, err := conn.readCommand(); err == nil || !strings.Contains(err.Error(), "too big inline request") {
+		t.Errorf("Expected too big inline request error, got %v", err)
+	}
+}
+
+// repeatReader endlessly replays the same input
+type repeatReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		copied := copy(p[n:], r.data[r.pos:])
+		n += copied
+		r.pos = (r.pos + copied) % len(r.data)
+	}
+	return n, nil
+}
+
+// newBenchConnection creates a connection that replays input forever and discards replies
+func newBenchConnection(input string) *Connection {
+	return &Connection{
+		reader: bufio.NewReader(&repeatReader{data: []byte(input)}),
+		writer: bufio.NewWriter(io.Discard),
+	}
+}
+
+const pipelinedSetGet = "*3\r\n$3\r\nSET\r\n$8\r\nkey:1234\r\n$16\r\nvalue-0123456789\r\n" +
+	"*2\r\n$3\r\nGET\r\n$8\r\nkey:1234\r\n"
+
+// BenchmarkReadCommand measures the pooled command parser on a pipelined SET/GET workload
+func BenchmarkReadCommand(b *testing.B) {
+	conn := newBenchConnection(pipelinedSetGet)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := conn.readCommand(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkReadValue measures the general value parser on the same workload,
+// which allocates once per argument
+func BenchmarkReadValue(b *testing.B) {
+	conn := newBenchConnection(pipelinedSetGet)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := conn.readValue(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkWriteValue measures reply encoding for typical SET/GET replies
+func BenchmarkWriteValue(b *testing.B) {
+	conn := newBenchConnection(pipelinedSetGet)
+	ok := RedisValue{Type: SimpleString, Str: "OK"}
+	bulk := RedisValue{Type: BulkString, Bulk: []byte("value-0123456789")}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := conn.writeValue(ok); err != nil {
+			b.Fatal(err)
+		}
+		if err := conn.writeValue(bulk); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// TestReadCommandMixedArguments tests that non-bulk elements still parse alongside pooled ones
+func TestReadCommandMixedArguments(t *testing.T) {
+	conn, _ := newTestConnection("*3\r\n$3\r\nSET\r\n+key\r\n$5\r\nvalue\r\n*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n")
+
+	cmd, err := conn.readCommand()
+	if err != nil {
+		t.Fatalf("readCommand failed: %v", err)
+	}
+	if cmd.Name != "SET" || len(cmd.Args) != 2 || cmd.Args[0] != "key" || cmd.Args[1] != "value" {
+		t.Errorf("Unexpected command: %s %q", cmd.Name, cmd.Args)
+	}
+	if string(cmd.Raw[2].Bulk) != "value" {
+		t.Errorf("Expected raw bulk 'value', got %q", cmd.Raw[2].Bulk)
+	}
+
+	// The next command reuses the pooled buffer; the previous one must be unaffected
+	next, err := conn.readCommand()
+	if err != nil {
+		t.Fatalf("readCommand failed: %v", err)
+	}
+	if next.Name != "GET" || next.Args[0] != "key" {
+		t.Errorf("Unexpected command: %s %q", next.Name, next.Args)
+	}
+	if cmd.Args[1] != "value" || string(cmd.Raw[2].Bulk) != "value" {
+		t.Errorf("Previous command was modified: %q", cmd.Args)
+	}
+}
+
+// TestReadCommandBulkTerminator tests that a bulk string not followed by
+// CRLF is a fatal protocol error, in pooled and standalone bulk strings
+func TestReadCommandBulkTerminator(t *testing.T) {
+	for _, frame := range []string{
+		"*2\r\n$4\r\nECHO\r\n$1\r\nxyz\r\n",
+		"*2\r\n$4\r\nECHOab$1\r\nx\r\n",
+		"*2\r\n$4\r\nECHO\r\n*1\r\n$1\r\nx\n\n",
+	} {
+		conn, _ := newTestConnection(frame)
+		_, err := conn.readCommand()
+		protoErr, ok := err.(*ProtocolError)
+		if !ok || !protoErr.Fatal || !strings.Contains(err.Error(), "expected CRLF after bulk string") {
+			t.Errorf("%q: expected a fatal CRLF error, got %v", frame, err)
+		}
+	}
+}
+
+// TestCommandBuffered tests which read buffers hold a complete command
+func TestCommandBuffered(t *testing.T) {
+	for input, want := range map[string]bool{
+		"":                                 false,
+		"PING\r\n":                         true,
+		"PI":                               false,
+		"\r\n\r\nPING\r\n":                 true,
+		"\r\n":                             false,
+		"*1\r\n$4\r\nPING\r\n":             true,
+		"*1\r\n$4\r\nPI":                   false,
+		"*2\r\n$4\r\nECHO\r\n":             false,
+		"*1\r\n$4\r\nPING\r":               false,
+		"*1":                               false,
+		"*x\r\n":                           false,
+		"*1\r\n:1\r\n":                     false,
+		"*2\r\n$3\r\nGET\r\n$1\r\na\r\n*1": true,
+	} {
+		conn, _ := newTestConnection(input)
+		conn.reader.Peek(len(input))
+		if got := conn.commandBuffered(); got != want {
+			t.Errorf("%q: expected %v, got %v", input, want, got)
+		}
+	}
+}
+
+// TestMaxNestingDepth tests that deeply nested arrays are rejected with a fatal protocol error
+func TestMaxNestingDepth(t *testing.T) {
+	conn, _ := newTestConnection("*2\r\n$4\r\nECHO\r\n" + strings.Repeat("*1\r\n", 10) + ":1\r\n")
+	conn.server.MaxNestingDepth = 5
+
+	_, err := conn.readCommand()
+	protoErr, ok := err.(*ProtocolError)
+	if !ok || !protoErr.Fatal || !strings.Contains(err.Error(), "too many nested arrays") {
+		t.Fatalf("Expected fatal nesting error, got %v", err)
+	}
+
+	conn, _ = newTestConnection(strings.Repeat("*1\r\n", 4) + ":1\r\n")
+	conn.server.MaxNestingDepth = 5
+	if _, err := conn.readValue(); err != nil {
+		t.Errorf("Expected nesting within the limit to parse, got %v", err)
+	}
+}
+
+// TestReadBigNumber tests parsing RESP3 big numbers beyond int64
+func TestReadBigNumber(t *testing.T) {
+	conn, _ := newTestConnection("(3492890328409238509324850943850943825024385\r\n(12x\r\n")
+
+	value, err := conn.readValue()
+	if err != nil {
+		t.Fatalf("readValue failed: %v", err)
+	}
+	if value.Type != BigNumber || value.Big.String() != "3492890328409238509324850943850943825024385" {
+		t.Errorf("Unexpected value %v %v", value.Type, value.Big)
+	}
+
+	if _, err := conn.readValue(); !isRecoverable(err) {
+		t.Errorf("Expected recoverable protocol error, got %v", err)
+	}
+}
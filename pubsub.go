@@ -0,0 +1,417 @@
+package redkit
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/l00pss/redkit/store"
+)
+
+// defaultPubSubBuffer is the number of messages a subscriber can fall behind
+// by when ServerConfig.PubSubBuffer is zero
+const defaultPubSubBuffer = 1024
+
+// pubSubBuffer returns the number of messages a subscriber can fall behind
+// by before it is disconnected
+func (s *Server) pubSubBuffer() int {
+	if s.PubSubBuffer > 0 {
+		return s.PubSubBuffer
+	}
+	return defaultPubSubBuffer
+}
+
+// subscriptionKind is what a subscription is to: a channel, a pattern of
+// channels or a shard channel, each with commands and messages of its own
+type subscriptionKind int
+
+const (
+	channelKind subscriptionKind = iota
+	patternKind
+	shardKind
+	subscriptionKinds
+)
+
+// subscriptionNames are the names of the confirmations and messages of each
+// kind of subscription
+var subscriptionNames = [subscriptionKinds]struct{ subscribe, unsubscribe, message string }{
+	channelKind: {"subscribe", "unsubscribe", "message"},
+	patternKind: {"psubscribe", "punsubscribe", "pmessage"},
+	shardKind:   {"ssubscribe", "sunsubscribe", "smessage"},
+}
+
+// pubsubRegistry holds the subscriptions of every connection, by channel or
+// pattern for publishing and by connection for unsubscribing
+type pubsubRegistry struct {
+	mu          sync.RWMutex
+	subs        [subscriptionKinds]map[string]map[*subscriber]struct{}
+	subscribers map[*Connection]*subscriber
+}
+
+func newPubSubRegistry() *pubsubRegistry {
+	r := &pubsubRegistry{subscribers: make(map[*Connection]*subscriber)}
+	for kind := range r.subs {
+		r.subs[kind] = make(map[string]map[*subscriber]struct{})
+	}
+	return r
+}
+
+// subscriber is a connection with subscriptions. Messages published to it
+// wait in queue for its goroutine to write them, so that publishers never
+// wait for a slow client.
+type subscriber struct {
+	conn  *Connection
+	subs  [subscriptionKinds]map[string]struct{} // guarded by the registry's lock
+	queue chan pubsubMessage
+	done  chan struct{} // closed once the connection is removed from the registry
+}
+
+// pubsubMessage is a message waiting to be written to a subscriber
+type pubsubMessage struct {
+	kind    subscriptionKind
+	pattern string // the pattern the channel matched, for patternKind
+	channel string
+	payload []byte
+}
+
+// value returns the push the message is written as
+func (m pubsubMessage) value() RedisValue {
+	items := []RedisValue{{Type: BulkString, Bulk: []byte(subscriptionNames[m.kind].message)}}
+	if m.kind == patternKind {
+		items = append(items, RedisValue{Type: BulkString, Bulk: []byte(m.pattern)})
+	}
+	items = append(items,
+		RedisValue{Type: BulkString, Bulk: []byte(m.channel)},
+		RedisValue{Type: BulkString, Bulk: m.payload})
+	return RedisValue{Type: Push, Array: items}
+}
+
+// count returns the number of subscriptions the confirmations of kind
+// report: shard channels count apart from channels and patterns
+func (sub *subscriber) count(kind subscriptionKind) int {
+	if kind == shardKind {
+		return len(sub.subs[shardKind])
+	}
+	return len(sub.subs[channelKind]) + len(sub.subs[patternKind])
+}
+
+// total returns the number of subscriptions of every kind
+func (sub *subscriber) total() int {
+	return len(sub.subs[channelKind]) + len(sub.subs[patternKind]) + len(sub.subs[shardKind])
+}
+
+// run writes the messages queued for sub until it is removed
+func (sub *subscriber) run(s *Server) {
+	for {
+		select {
+		case <-sub.done:
+			return
+		case m := <-sub.queue:
+			if err := sub.conn.WriteValue(m.value()); err != nil {
+				s.logConn(LogLevelDebug, sub.conn, "Failed to send message", errAttr(err))
+			}
+		}
+	}
+}
+
+// confirmation returns the reply to a subscription change of kind
+func confirmation(name string, channel *string, count int) RedisValue {
+	target := RedisValue{Type: Null}
+	if channel != nil {
+		target = RedisValue{Type: BulkString, Bulk: []byte(*channel)}
+	}
+	return RedisValue{Type: Push, Array: []RedisValue{
+		{Type: BulkString, Bulk: []byte(name)},
+		target,
+		{Type: Integer, Int: int64(count)},
+	}}
+}
+
+// subscribe subscribes conn to names of kind and returns a confirmation for
+// each, starting the goroutine writing its messages on its first
+func (s *Server) subscribe(conn *Connection, kind subscriptionKind, names []string) []RedisValue {
+	r := s.pubsub
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sub := r.subscribers[conn]
+	if sub == nil {
+		sub = &subscriber{conn: conn, queue: make(chan pubsubMessage, s.pubSubBuffer()), done: make(chan struct{})}
+		for k := range sub.subs {
+			sub.subs[k] = make(map[string]struct{})
+		}
+		r.subscribers[conn] = sub
+		go sub.run(s)
+	}
+	replies := make([]RedisValue, len(names))
+	for i, name := range names {
+		if _, ok := sub.subs[kind][name]; !ok {
+			sub.subs[kind][name] = struct{}{}
+			subs := r.subs[kind][name]
+			if subs == nil {
+				subs = make(map[*subscriber]struct{})
+				r.subs[kind][name] = subs
+			}
+			subs[sub] = struct{}{}
+		}
+		replies[i] = confirmation(subscriptionNames[kind].subscribe, &name, sub.count(kind))
+	}
+	conn.SetSubscribed(true)
+	return replies
+}
+
+// unsubscribe unsubscribes conn from names of kind, or from every
+// subscription of kind if names is empty, and returns a confirmation for
+// each
+func (s *Server) unsubscribe(conn *Connection, kind subscriptionKind, names []string) []RedisValue {
+	r := s.pubsub
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sub := r.subscribers[conn]
+	if len(names) == 0 && sub != nil {
+		for name := range sub.subs[kind] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	if len(names) == 0 {
+		count := 0
+		if sub != nil {
+			count = sub.count(kind)
+		}
+		return []RedisValue{confirmation(subscriptionNames[kind].unsubscribe, nil, count)}
+	}
+	replies := make([]RedisValue, len(names))
+	for i, name := range names {
+		count := 0
+		if sub != nil {
+			r.removeLocked(sub, kind, name)
+			count = sub.count(kind)
+		}
+		replies[i] = confirmation(subscriptionNames[kind].unsubscribe, &name, count)
+	}
+	conn.SetSubscribed(sub != nil && sub.total() > 0)
+	return replies
+}
+
+// removeLocked removes the subscription of sub to name of kind; the caller
+// holds r.mu
+func (r *pubsubRegistry) removeLocked(sub *subscriber, kind subscriptionKind, name string) {
+	delete(sub.subs[kind], name)
+	if subs := r.subs[kind][name]; subs != nil {
+		delete(subs, sub)
+		if len(subs) == 0 {
+			delete(r.subs[kind], name)
+		}
+	}
+}
+
+// remove drops every subscription of conn and stops the goroutine writing
+// its messages, as when it disconnects or sends RESET
+func (r *pubsubRegistry) remove(conn *Connection) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sub := r.subscribers[conn]
+	if sub == nil {
+		return
+	}
+	for kind := range sub.subs {
+		for name := range sub.subs[kind] {
+			r.removeLocked(sub, subscriptionKind(kind), name)
+		}
+	}
+	delete(r.subscribers, conn)
+	close(sub.done)
+}
+
+// publish queues payload for the subscribers of channel of kind, and of the
+// patterns matching it for channelKind, and returns how many it was queued
+// for. Subscribers too far behind to take it are disconnected.
+func (s *Server) publish(kind subscriptionKind, channel string, payload []byte) int {
+	r := s.pubsub
+	var slow []*Connection
+	receivers := 0
+	deliver := func(sub *subscriber, m pubsubMessage) {
+		select {
+		case sub.queue <- m:
+			receivers++
+		default:
+			slow = append(slow, sub.conn)
+		}
+	}
+
+	r.mu.RLock()
+	for sub := range r.subs[kind][channel] {
+		deliver(sub, pubsubMessage{kind: kind, channel: channel, payload: payload})
+	}
+	if kind == channelKind {
+		for pattern, subs := range r.subs[patternKind] {
+			if !store.Match(pattern, channel) {
+				continue
+			}
+			for sub := range subs {
+				deliver(sub, pubsubMessage{kind: patternKind, pattern: pattern, channel: channel, payload: payload})
+			}
+		}
+	}
+	r.mu.RUnlock()
+
+	for _, conn := range slow {
+		s.logConn(LogLevelWarn, conn, "Disconnecting subscriber falling behind")
+		conn.closeWithReason(ErrSlowSubscriber)
+	}
+	return receivers
+}
+
+// pubsubCommands are the commands a RESP2 connection can send while
+// subscribed, its replies being mixed with the messages it receives
+var pubsubCommands = commandSet(SUBSCRIBE, PSUBSCRIBE, SSUBSCRIBE, UNSUBSCRIBE, PUNSUBSCRIBE, SUNSUBSCRIBE, PING, QUIT, RESET)
+
+// subscribedError returns the error replying to a command other than
+// pubsubCommands sent by a subscribed RESP2 connection
+func subscribedError(name string) RedisValue {
+	return NewError(ErrPrefixGeneric, "Can't execute '%s': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context", strings.ToLower(name)).Value()
+}
+
+// registerPubSub registers the Pub/Sub commands
+func (s *Server) registerPubSub() {
+	s.OnReset(s.pubsub.remove)
+
+	s.RegisterCommandFunc(string(SUBSCRIBE), s.subscriptions(s.subscribe, channelKind), MinArgs(1), WithFlags(CmdPubSub), WithSummary("Listens for messages published to channels."))
+	s.RegisterCommandFunc(string(PSUBSCRIBE), s.subscriptions(s.subscribe, patternKind), MinArgs(1), WithFlags(CmdPubSub), WithSummary("Listens for messages published to channels that match one or more patterns."))
+	s.RegisterCommandFunc(string(SSUBSCRIBE), s.subscriptions(s.subscribe, shardKind), MinArgs(1), WithFlags(CmdPubSub), WithSummary("Listens for messages published to shard channels."))
+	s.RegisterCommandFunc(string(UNSUBSCRIBE), s.subscriptions(s.unsubscribe, channelKind), WithFlags(CmdPubSub), WithSummary("Stops listening to messages posted to channels."))
+	s.RegisterCommandFunc(string(PUNSUBSCRIBE), s.subscriptions(s.unsubscribe, patternKind), WithFlags(CmdPubSub), WithSummary("Stops listening to messages published to channels that match one or more patterns."))
+	s.RegisterCommandFunc(string(SUNSUBSCRIBE), s.subscriptions(s.unsubscribe, shardKind), WithFlags(CmdPubSub), WithSummary("Stops listening to messages posted to shard channels."))
+	s.RegisterCommandFunc(string(PUBLISH), s.publishCommand(channelKind), ExactArgs(2), WithFlags(CmdPubSub|CmdFast), WithSummary("Posts a message to a channel."))
+	s.RegisterCommandFunc(string(SPUBLISH), s.publishCommand(shardKind), ExactArgs(2), WithFlags(CmdPubSub|CmdFast), WithSummary("Post a message to a shard channel"))
+
+	s.RegisterSubcommandFunc(string(PUBSUB), "CHANNELS", s.pubsubChannels(channelKind), RangeArgs(0, 1), WithFlags(CmdPubSub), WithSummary("Returns the active channels."))
+	s.RegisterSubcommandFunc(string(PUBSUB), "SHARDCHANNELS", s.pubsubChannels(shardKind), RangeArgs(0, 1), WithFlags(CmdPubSub), WithSummary("Returns the active shard channels."))
+	s.RegisterSubcommandFunc(string(PUBSUB), "NUMSUB", s.pubsubNumSub(channelKind), WithFlags(CmdPubSub), WithSummary("Returns a count of subscribers to channels."))
+	s.RegisterSubcommandFunc(string(PUBSUB), "SHARDNUMSUB", s.pubsubNumSub(shardKind), WithFlags(CmdPubSub), WithSummary("Returns the count of subscribers of shard channels."))
+	s.RegisterSubcommandFunc(string(PUBSUB), "NUMPAT", func(conn *Connection, cmd *Command) RedisValue {
+		return RedisValue{Type: Integer, Int: int64(s.NumPat())}
+	}, ExactArgs(0), WithFlags(CmdPubSub), WithSummary("Returns a count of unique pattern subscriptions."))
+}
+
+// subscriptions returns the handler of a command changing the subscriptions
+// of kind with change: channel [channel ...]. It replies with a confirmation
+// for each channel, written before any message published to them since.
+func (s *Server) subscriptions(change func(*Connection, subscriptionKind, []string) []RedisValue, kind subscriptionKind) func(*Connection, *Command) RedisValue {
+	return func(conn *Connection, cmd *Command) RedisValue {
+		if conn == nil {
+			return NewError(ErrPrefixGeneric, "Pub/Sub needs a connection").Value()
+		}
+		// A transaction replies with its own array
+		if conn.inExec {
+			return RedisValue{Type: Array, Array: change(conn, kind, cmd.Args)}
+		}
+		// Holding the write lock keeps the goroutine of the subscriber from
+		// writing a message before the confirmations
+		conn.writeMu.Lock()
+		defer conn.writeMu.Unlock()
+		replies := change(conn, kind, cmd.Args)
+		conn.streamed = true
+		if conn.suppressReply() {
+			return RedisValue{}
+		}
+		for _, reply := range replies {
+			if err := conn.writeValue(reply); err != nil {
+				conn.setCloseReason(err)
+				break
+			}
+		}
+		return RedisValue{}
+	}
+}
+
+// pubsubChannels returns the handler of PUBSUB CHANNELS, or SHARDCHANNELS
+// for shardKind: [pattern]
+func (s *Server) pubsubChannels(kind subscriptionKind) func(*Connection, *Command) RedisValue {
+	return func(conn *Connection, cmd *Command) RedisValue {
+		pattern := ""
+		if len(cmd.Args) > 0 {
+			pattern = cmd.Args[0]
+		}
+		channels := s.pubsub.names(kind, pattern)
+		reply := make([]RedisValue, len(channels))
+		for i, channel := range channels {
+			reply[i] = RedisValue{Type: BulkString, Bulk: []byte(channel)}
+		}
+		return RedisValue{Type: Array, Array: reply}
+	}
+}
+
+// pubsubNumSub returns the handler of PUBSUB NUMSUB, or SHARDNUMSUB for
+// shardKind: [channel ...]
+func (s *Server) pubsubNumSub(kind subscriptionKind) func(*Connection, *Command) RedisValue {
+	return func(conn *Connection, cmd *Command) RedisValue {
+		reply := make([]MapEntry, len(cmd.Args))
+		for i, channel := range cmd.Args {
+			reply[i] = MapEntry{
+				Key:   RedisValue{Type: BulkString, Bulk: []byte(channel)},
+				Value: RedisValue{Type: Integer, Int: int64(s.pubsub.count(kind, channel))},
+			}
+		}
+		return RedisValue{Type: Map, Map: reply}
+	}
+}
+
+// names returns the channels of kind with subscribers, or the patterns for
+// patternKind, that match pattern, all of them if it is empty, sorted
+func (r *pubsubRegistry) names(kind subscriptionKind, pattern string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.subs[kind]))
+	for name := range r.subs[kind] {
+		if pattern == "" || store.Match(pattern, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// count returns the number of subscribers to name of kind
+func (r *pubsubRegistry) count(kind subscriptionKind, name string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.subs[kind][name])
+}
+
+// Publish sends payload to the subscribers of channel and of the patterns
+// matching it, as PUBLISH does, and returns how many it reached. It lets Go
+// code push messages to clients, such as events forwarded from a queue;
+// payload is copied, so the caller may reuse it.
+func (s *Server) Publish(channel string, payload []byte) int {
+	return s.publish(channelKind, channel, bytes.Clone(payload))
+}
+
+// Channels returns the channels with at least one subscriber, sorted, as
+// PUBSUB CHANNELS does. Subscribers to patterns only don't count.
+func (s *Server) Channels() []string {
+	return s.pubsub.names(channelKind, "")
+}
+
+// NumSub returns the number of connections subscribed to channel, not
+// counting those subscribed to patterns matching it, as PUBSUB NUMSUB does
+func (s *Server) NumSub(channel string) int {
+	return s.pubsub.count(channelKind, channel)
+}
+
+// NumPat returns the number of patterns with at least one subscriber, as
+// PUBSUB NUMPAT does
+func (s *Server) NumPat() int {
+	s.pubsub.mu.RLock()
+	defer s.pubsub.mu.RUnlock()
+	return len(s.pubsub.subs[patternKind])
+}
+
+// publishCommand returns the handler of PUBLISH, or SPUBLISH for shardKind:
+// channel message
+func (s *Server) publishCommand(kind subscriptionKind) func(*Connection, *Command) RedisValue {
+	return func(conn *Connection, cmd *Command) RedisValue {
+		return RedisValue{Type: Integer, Int: int64(s.publish(kind, cmd.Args[0], []byte(cmd.Args[1])))}
+	}
+}
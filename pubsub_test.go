@@ -0,0 +1,287 @@
+package redkit
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TestPubSub tests subscriptions to channels and patterns over the wire
+func TestPubSub(t *testing.T) {
+	_, address := startTestServer(t, nil)
+	subscriber := dialRaw(t, address)
+	publisher := dialRaw(t, address)
+
+	subscriber.send(t, "SUBSCRIBE", "a", "b")
+	expectLines(t, subscriber,
+		"*3", "$9", "subscribe", "$1", "a", ":1",
+		"*3", "$9", "subscribe", "$1", "b", ":2")
+	subscriber.send(t, "PSUBSCRIBE", "news.*")
+	expectLines(t, subscriber, "*3", "$10", "psubscribe", "$6", "news.*", ":3")
+
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"PUBLISH", "a", "hello"}, []string{"*3", "$7", "message", "$1", "a", "$5", "hello"}},
+		{[]string{"PUBLISH", "news.tech", "x"}, []string{"*4", "$8", "pmessage", "$6", "news.*", "$9", "news.tech", "$1", "x"}},
+	}
+	for _, tt := range tests {
+		publisher.send(t, tt.args...)
+		expectLines(t, publisher, ":1")
+		expectLines(t, subscriber, tt.expected...)
+	}
+	publisher.send(t, "PUBLISH", "nobody", "x")
+	expectLines(t, publisher, ":0")
+
+	subscriber.send(t, "ECHO", "x")
+	expectLines(t, subscriber, "-ERR Can't execute 'echo': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context")
+	subscriber.send(t, "PING")
+	expectLines(t, subscriber, "*2", "$4", "pong", "$0", "")
+	subscriber.send(t, "UNSUBSCRIBE")
+	expectLines(t, subscriber,
+		"*3", "$11", "unsubscribe", "$1", "a", ":2",
+		"*3", "$11", "unsubscribe", "$1", "b", ":1")
+	subscriber.send(t, "PUNSUBSCRIBE", "news.*")
+	expectLines(t, subscriber, "*3", "$12", "punsubscribe", "$6", "news.*", ":0")
+	subscriber.send(t, "UNSUBSCRIBE")
+	expectLines(t, subscriber, "*3", "$11", "unsubscribe", "$-1", ":0")
+	subscriber.send(t, "PING")
+	expectLines(t, subscriber, "+PONG")
+
+	publisher.send(t, "PUBLISH", "a", "x")
+	expectLines(t, publisher, ":0")
+}
+
+// TestPubSubIntrospection tests PUBSUB and the Go API it shares
+func TestPubSubIntrospection(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	first := dialRaw(t, address)
+	first.send(t, "SUBSCRIBE", "news", "sports")
+	first.send(t, "PSUBSCRIBE", "n*")
+	first.send(t, "SSUBSCRIBE", "orders")
+	second := dialRaw(t, address)
+	second.send(t, "SUBSCRIBE", "news")
+	second.send(t, "PSUBSCRIBE", "n*", "s*")
+	expectLines(t, second,
+		"*3", "$9", "subscribe", "$4", "news", ":1",
+		"*3", "$10", "psubscribe", "$2", "n*", ":2",
+		"*3", "$10", "psubscribe", "$2", "s*", ":3")
+	for range 4 {
+		expectLines(t, first, "*3")
+		first.readLine(t)
+		first.readLine(t)
+		first.readLine(t)
+		first.readLine(t)
+		first.readLine(t)
+	}
+
+	client := dialRaw(t, address)
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"PUBSUB", "CHANNELS"}, []string{"*2", "$4", "news", "$6", "sports"}},
+		{[]string{"PUBSUB", "CHANNELS", "n*"}, []string{"*1", "$4", "news"}},
+		{[]string{"PUBSUB", "NUMSUB", "news", "sports", "none"}, []string{"*6", "$4", "news", ":2", "$6", "sports", ":1", "$4", "none", ":0"}},
+		{[]string{"PUBSUB", "NUMSUB"}, []string{"*0"}},
+		{[]string{"PUBSUB", "NUMPAT"}, []string{":2"}},
+		{[]string{"PUBSUB", "SHARDCHANNELS"}, []string{"*1", "$6", "orders"}},
+		{[]string{"PUBSUB", "SHARDNUMSUB", "orders"}, []string{"*2", "$6", "orders", ":1"}},
+		{[]string{"PUBSUB", "CHANNELS", "a", "b"}, []string{"-ERR wrong number of arguments for 'pubsub|channels' command"}},
+	}
+	for _, tt := range tests {
+		client.send(t, tt.args...)
+		expectLines(t, client, tt.expected...)
+	}
+
+	if channels := server.Channels(); strings.Join(channels, ",") != "news,sports" {
+		t.Errorf("Expected news and sports, got %v", channels)
+	}
+	if n := server.NumSub("news"); n != 2 {
+		t.Errorf("Expected 2 subscribers to news, got %d", n)
+	}
+	if n := server.NumPat(); n != 2 {
+		t.Errorf("Expected 2 patterns, got %d", n)
+	}
+	stats := make(map[string]string)
+	for _, field := range server.infoStats() {
+		stats[field.name] = field.value
+	}
+	if stats["pubsub_channels"] != "2" || stats["pubsub_patterns"] != "2" || stats["pubsub_shardchannels"] != "1" {
+		t.Errorf("Unexpected Pub/Sub fields of INFO: %v", stats)
+	}
+
+	second.send(t, "UNSUBSCRIBE", "news")
+	expectLines(t, second, "*3", "$11", "unsubscribe", "$4", "news", ":2")
+	if n := server.NumSub("news"); n != 1 {
+		t.Errorf("Expected 1 subscriber left to news, got %d", n)
+	}
+}
+
+// TestPubSubPublish tests publishing from Go code
+func TestPubSubPublish(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	if n := server.Publish("a", []byte("x")); n != 0 {
+		t.Errorf("Expected no receivers, got %d", n)
+	}
+	subscriber := dialRaw(t, address)
+	subscriber.send(t, "SUBSCRIBE", "a")
+	subscriber.send(t, "PSUBSCRIBE", "*")
+	expectLines(t, subscriber,
+		"*3", "$9", "subscribe", "$1", "a", ":1",
+		"*3", "$10", "psubscribe", "$1", "*", ":2")
+
+	payload := []byte("hello")
+	if n := server.Publish("a", payload); n != 2 {
+		t.Errorf("Expected 2 receivers, got %d", n)
+	}
+	copy(payload, "HELLO")
+	expectLines(t, subscriber,
+		"*3", "$7", "message", "$1", "a", "$5", "hello",
+		"*4", "$8", "pmessage", "$1", "*", "$1", "a", "$5", "hello")
+}
+
+// TestPubSubShardChannels tests that shard channels are apart from channels
+func TestPubSubShardChannels(t *testing.T) {
+	_, address := startTestServer(t, nil)
+	subscriber := dialRaw(t, address)
+	publisher := dialRaw(t, address)
+
+	subscriber.send(t, "SUBSCRIBE", "c")
+	subscriber.send(t, "SSUBSCRIBE", "c")
+	expectLines(t, subscriber,
+		"*3", "$9", "subscribe", "$1", "c", ":1",
+		"*3", "$10", "ssubscribe", "$1", "c", ":1")
+	publisher.send(t, "SPUBLISH", "c", "x")
+	expectLines(t, publisher, ":1")
+	expectLines(t, subscriber, "*3", "$8", "smessage", "$1", "c", "$1", "x")
+	subscriber.send(t, "SUNSUBSCRIBE")
+	expectLines(t, subscriber, "*3", "$12", "sunsubscribe", "$1", "c", ":0")
+	publisher.send(t, "PUBLISH", "c", "y")
+	expectLines(t, publisher, ":1")
+	expectLines(t, subscriber, "*3", "$7", "message", "$1", "c", "$1", "y")
+}
+
+// TestPubSubRESP3 tests that RESP3 subscribers get pushes and can run any
+// command
+func TestPubSubRESP3(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	server.RegisterCommandFunc("HELLO", func(conn *Connection, cmd *Command) RedisValue {
+		conn.SetProtocol(RESP3)
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	})
+	subscriber := dialRaw(t, address)
+	subscriber.send(t, "HELLO", "3")
+	subscriber.send(t, "SUBSCRIBE", "a")
+	expectLines(t, subscriber, "+OK", ">3", "$9", "subscribe", "$1", "a", ":1")
+	subscriber.send(t, "ECHO", "x")
+	expectLines(t, subscriber, "$1", "x")
+
+	publisher := dialRaw(t, address)
+	publisher.send(t, "PUBLISH", "a", "hello")
+	expectLines(t, publisher, ":1")
+	expectLines(t, subscriber, ">3", "$7", "message", "$1", "a", "$5", "hello")
+}
+
+// TestPubSubReset tests that RESET and disconnecting drop subscriptions
+func TestPubSubReset(t *testing.T) {
+	_, address := startTestServer(t, nil)
+	subscriber := dialRaw(t, address)
+	subscriber.send(t, "SUBSCRIBE", "a")
+	subscriber.send(t, "RESET")
+	expectLines(t, subscriber, "*3", "$9", "subscribe", "$1", "a", ":1", "+RESET")
+	subscriber.send(t, "ECHO", "x")
+	expectLines(t, subscriber, "$1", "x")
+
+	publisher := dialRaw(t, address)
+	publisher.send(t, "PUBLISH", "a", "x")
+	expectLines(t, publisher, ":0")
+
+	subscriber.send(t, "SUBSCRIBE", "a")
+	expectLines(t, subscriber, "*3", "$9", "subscribe", "$1", "a", ":1")
+	subscriber.conn.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		publisher.send(t, "PUBLISH", "a", "x")
+		if publisher.readLine(t) == ":0" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the subscription to end with the connection")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestPubSubClient tests Pub/Sub with a real client
+func TestPubSubClient(t *testing.T) {
+	_, address := startTestServer(t, nil)
+	rdb := redis.NewClient(&redis.Options{Addr: address, Protocol: 2})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	sub := rdb.PSubscribe(ctx, "orders:*")
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		t.Fatalf("PSUBSCRIBE failed: %v", err)
+	}
+	if err := sub.Subscribe(ctx, "alerts"); err != nil {
+		t.Fatalf("SUBSCRIBE failed: %v", err)
+	}
+	messages := sub.Channel()
+
+	for _, channel := range []string{"alerts", "orders:1"} {
+		if n, err := rdb.Publish(ctx, channel, "payload:"+channel).Result(); err != nil || n != 1 {
+			t.Fatalf("Expected PUBLISH to %s to reach 1 subscriber, got %d, %v", channel, n, err)
+		}
+	}
+	for _, expected := range []struct{ channel, pattern string }{{"alerts", ""}, {"orders:1", "orders:*"}} {
+		select {
+		case m := <-messages:
+			if m.Channel != expected.channel || m.Pattern != expected.pattern || m.Payload != "payload:"+expected.channel {
+				t.Errorf("Unexpected message %+v", m)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timed out waiting for the message to %s", expected.channel)
+		}
+	}
+}
+
+// TestPubSubSlowSubscriber tests that a subscriber not reading its messages
+// is disconnected rather than holding publishers back
+func TestPubSubSlowSubscriber(t *testing.T) {
+	config := DefaultServerConfig()
+	config.PubSubBuffer = 4
+	server, address := startTestServer(t, config)
+	reasons := make(chan error, 1)
+	server.OnDisconnect(func(conn *Connection, info DisconnectInfo) {
+		if conn.IsSubscribed() {
+			reasons <- info.Reason
+		}
+	})
+
+	subscriber := dialRaw(t, address)
+	subscriber.send(t, "SUBSCRIBE", "a")
+	expectLines(t, subscriber, "*3", "$9", "subscribe", "$1", "a", ":1")
+
+	publisher := dialRaw(t, address)
+	payload := strings.Repeat("x", 1<<20)
+	for range 100 {
+		publisher.send(t, "PUBLISH", "a", payload)
+		publisher.readLine(t)
+		select {
+		case reason := <-reasons:
+			if !errors.Is(reason, ErrSlowSubscriber) {
+				t.Errorf("Expected ErrSlowSubscriber, got %v", reason)
+			}
+			return
+		default:
+		}
+	}
+	t.Fatal("Expected the subscriber to be disconnected")
+}
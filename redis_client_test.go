@@ -1556,3 +1556,33 @@ func TestStressOperations(t *testing.T) {
 		}
 	})
 }
+
+// Pipelining tests
+func TestPipelinedCommands(t *testing.T) {
+	_, client, cleanup := startRedisServer(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	t.Run("Pipeline of SET and GET", func(t *testing.T) {
+		const numCommands = 500
+		pipe := client.Pipeline()
+		for i := 0; i < numCommands; i++ {
+			pipe.Set(ctx, fmt.Sprintf("pipe:key:%d", i), fmt.Sprintf("value_%d", i), 0)
+		}
+		gets := make([]*redis.StringCmd, numCommands)
+		for i := 0; i < numCommands; i++ {
+			gets[i] = pipe.Get(ctx, fmt.Sprintf("pipe:key:%d", i))
+		}
+
+		if _, err := pipe.Exec(ctx); err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+
+		for i, get := range gets {
+			expected := fmt.Sprintf("value_%d", i)
+			if get.Val() != expected {
+				t.Errorf("Expected '%s', got '%s'", expected, get.Val())
+			}
+		}
+	})
+}
@@ -0,0 +1,161 @@
+package redkit
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// UnregisterCommand removes a command, or a subcommand given as
+// "container|sub", and reports whether it was registered. Later calls to it
+// get the unknown command error.
+func (s *Server) UnregisterCommand(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	container, sub, isSub := strings.Cut(strings.ToUpper(name), "|")
+	slot, ok := s.handlerTable()[container]
+	if !ok {
+		return false
+	}
+	if isSub {
+		if _, ok := slot.entry.subcommands[sub]; !ok {
+			return false
+		}
+		delete(slot.entry.subcommands, sub)
+		return true
+	}
+	s.editCommands(func(t commandTable) {
+		delete(t, container)
+	})
+	return true
+}
+
+// RenameCommand makes a command available under a new name only, like the
+// rename-command directive of redis.conf. Renaming to an unguessable string
+// keeps a dangerous command usable by operators who know the name, and
+// renaming to "" removes it. It fails if the command isn't registered or the
+// new name is already taken.
+func (s *Server) RenameCommand(name, newName string) error {
+	from, to := strings.ToUpper(name), strings.ToUpper(newName)
+	if strings.Contains(from, "|") || strings.Contains(to, "|") {
+		return fmt.Errorf("subcommands can't be renamed: %s", name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	table := s.handlerTable()
+	slot, ok := table[from]
+	if !ok {
+		return fmt.Errorf("unknown command: %s", name)
+	}
+	if to == from {
+		return nil
+	}
+	if _, taken := table[to]; taken && to != "" {
+		return fmt.Errorf("command already registered: %s", newName)
+	}
+	s.editCommands(func(t commandTable) {
+		delete(t, from)
+		if to != "" {
+			t.set(to, slot.entry)
+		}
+	})
+	return nil
+}
+
+// DisableCommand makes a command, or a subcommand given as "container|sub",
+// reply with an error instead of running, such as FLUSHALL or KEYS on a
+// production server. It stays listed by COMMAND and can be turned back on
+// with EnableCommand. It fails if the command isn't registered.
+func (s *Server) DisableCommand(name string) error {
+	return s.setDisabled(name, true)
+}
+
+// EnableCommand turns a command disabled with DisableCommand back on
+func (s *Server) EnableCommand(name string) error {
+	return s.setDisabled(name, false)
+}
+
+// CommandDisabled reports whether the command was disabled with DisableCommand
+func (s *Server) CommandDisabled(name string) bool {
+	entry, ok := s.commandEntry(name)
+	if !ok {
+		return false
+	}
+	return entry.disabled.Load()
+}
+
+func (s *Server) setDisabled(name string, disabled bool) error {
+	entry, ok := s.commandEntry(name)
+	if !ok {
+		return fmt.Errorf("unknown command: %s", name)
+	}
+	entry.disabled.Store(disabled)
+	return nil
+}
+
+// commandDisabled is the reply to a command disabled with DisableCommand
+func commandDisabled(name string) *RedisError {
+	return NewError(ErrPrefixGeneric, "'%s' command is disabled", strings.ToLower(name))
+}
+
+// commandTable maps upper-case command names to their entries. A published
+// table is never modified: RegisterCommand and the functions above swap in an
+// edited copy, so the dispatcher looks commands up without taking s.mu.
+type commandTable map[string]commandSlot
+
+// commandSlot is a command table entry. It keeps the name it is stored under
+// so lookups can return that string instead of upper-casing the client's.
+type commandSlot struct {
+	name  string
+	entry *commandEntry
+}
+
+// maxLookupName is the longest name lookup upper-cases on the stack
+const maxLookupName = 64
+
+// set stores entry under name, which must be upper-case
+func (t commandTable) set(name string, entry *commandEntry) {
+	t[name] = commandSlot{name: name, entry: entry}
+}
+
+// lookup finds a command ignoring case and returns its registered name. It
+// doesn't allocate for ASCII names up to maxLookupName bytes long.
+func (t commandTable) lookup(name string) (string, *commandEntry, bool) {
+	slot, ok := t[name]
+	if !ok && len(name) <= maxLookupName {
+		var buf [maxLookupName]byte
+		for i := 0; i < len(name); i++ {
+			c := name[i]
+			if c >= utf8.RuneSelf {
+				slot, ok = t[strings.ToUpper(name)]
+				return slot.name, slot.entry, ok
+			}
+			if 'a' <= c && c <= 'z' {
+				c -= 'a' - 'A'
+			}
+			buf[i] = c
+		}
+		slot, ok = t[string(buf[:len(name)])]
+	} else if !ok {
+		slot, ok = t[strings.ToUpper(name)]
+	}
+	return slot.name, slot.entry, ok
+}
+
+// handlerTable returns the current command table, which must not be modified
+func (s *Server) handlerTable() commandTable {
+	return *s.handlers.Load()
+}
+
+// editCommands publishes a copy of the command table changed by edit. The
+// caller holds s.mu, which serializes the writers.
+func (s *Server) editCommands(edit func(commandTable)) {
+	current := s.handlerTable()
+	table := make(commandTable, len(current)+1)
+	for name, slot := range current {
+		table[name] = slot
+	}
+	edit(table)
+	s.handlers.Store(&table)
+}
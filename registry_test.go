@@ -0,0 +1,108 @@
+package redkit
+
+import "testing"
+
+func TestUnregisterAndRenameCommand(t *testing.T) {
+	server := NewServer(":0")
+	server.RegisterCommandFunc("FLUSHALL", func(conn *Connection, cmd *Command) RedisValue {
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	})
+	server.RegisterSubcommandFunc("CONFIG", "SET", func(conn *Connection, cmd *Command) RedisValue {
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	})
+
+	if err := server.RenameCommand("flushall", "b840fc02d524045429941cc15f59e41cb7be6c52"); err != nil {
+		t.Fatalf("RenameCommand failed: %v", err)
+	}
+	if result := server.handleCommand(nil, &Command{Name: "FLUSHALL"}); result.Str != "ERR unknown command 'FLUSHALL', with args beginning with: " {
+		t.Errorf("Expected the old name to be unknown, got %+v", result)
+	}
+	if result := server.handleCommand(nil, &Command{Name: "b840fc02d524045429941cc15f59e41cb7be6c52"}); result.Str != "OK" {
+		t.Errorf("Expected the new name to work, got %+v", result)
+	}
+	if err := server.RenameCommand("FLUSHALL", "X"); err == nil {
+		t.Error("Expected an error renaming an unknown command")
+	}
+	if err := server.RenameCommand("b840fc02d524045429941cc15f59e41cb7be6c52", "PING"); err == nil {
+		t.Error("Expected an error renaming onto a registered command")
+	}
+	if err := server.RenameCommand("b840fc02d524045429941cc15f59e41cb7be6c52", ""); err != nil {
+		t.Fatalf("RenameCommand to \"\" failed: %v", err)
+	}
+	if _, ok := server.CommandInfo("b840fc02d524045429941cc15f59e41cb7be6c52"); ok {
+		t.Error("Expected renaming to \"\" to remove the command")
+	}
+
+	if !server.UnregisterCommand("config|set") {
+		t.Fatal("Expected CONFIG SET to be unregistered")
+	}
+	if result := server.handleCommand(nil, &Command{Name: "CONFIG", Args: []string{"SET", "a", "b"}}); result.Type != ErrorReply {
+		t.Errorf("Expected an unknown subcommand error, got %+v", result)
+	}
+	if !server.UnregisterCommand("CONFIG") || server.UnregisterCommand("CONFIG") {
+		t.Error("Expected CONFIG to be unregistered once")
+	}
+}
+
+func TestDisableCommand(t *testing.T) {
+	server := NewServer(":0")
+	server.RegisterCommandFunc("KEYS", func(conn *Connection, cmd *Command) RedisValue {
+		return RedisValue{Type: Array}
+	})
+	server.RegisterSubcommandFunc("DEBUG", "SLEEP", func(conn *Connection, cmd *Command) RedisValue {
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	})
+
+	if err := server.DisableCommand("keys"); err != nil {
+		t.Fatalf("DisableCommand failed: %v", err)
+	}
+	if err := server.DisableCommand("debug|sleep"); err != nil {
+		t.Fatalf("DisableCommand failed: %v", err)
+	}
+	if err := server.DisableCommand("FLUSHALL"); err == nil {
+		t.Error("Expected an error disabling an unknown command")
+	}
+	if !server.CommandDisabled("KEYS") || server.CommandDisabled("PING") {
+		t.Error("Unexpected CommandDisabled result")
+	}
+
+	if result := server.handleCommand(nil, &Command{Name: "KEYS", Args: []string{"*"}}); result.Str != "ERR 'keys' command is disabled" {
+		t.Errorf("Expected the disabled error, got %+v", result)
+	}
+	if result := server.handleCommand(nil, &Command{Name: "DEBUG", Args: []string{"SLEEP", "0"}}); result.Str != "ERR 'debug|sleep' command is disabled" {
+		t.Errorf("Expected the disabled error, got %+v", result)
+	}
+
+	server.EnableCommand("KEYS")
+	if result := server.handleCommand(nil, &Command{Name: "KEYS", Args: []string{"*"}}); result.Type != Array {
+		t.Errorf("Expected KEYS to run once enabled, got %+v", result)
+	}
+}
+
+func TestCommandTableLookup(t *testing.T) {
+	server := NewServer(":0")
+	table := server.handlerTable()
+
+	for _, name := range []string{"ECHO", "echo", "EcHo"} {
+		if registered, entry, ok := table.lookup(name); !ok || entry == nil || registered != "ECHO" {
+			t.Errorf("Expected %s to find ECHO, got %q %v", name, registered, ok)
+		}
+	}
+	if _, _, ok := table.lookup("nope"); ok {
+		t.Error("Expected an unknown command to be missing")
+	}
+	if allocs := testing.AllocsPerRun(100, func() { table.lookup("client") }); allocs != 0 {
+		t.Errorf("Expected lookup not to allocate, got %v allocations", allocs)
+	}
+
+	// Registering publishes a new table and leaves the old one untouched
+	server.RegisterCommandFunc("fresh", func(conn *Connection, cmd *Command) RedisValue {
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	})
+	if _, _, ok := table.lookup("FRESH"); ok {
+		t.Error("Expected the old table not to change")
+	}
+	if _, _, ok := server.handlerTable().lookup("fresh"); !ok {
+		t.Error("Expected the new table to have FRESH")
+	}
+}
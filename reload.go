@@ -0,0 +1,143 @@
+package redkit
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// OnReload registers a function called with the new configuration after every
+// successful Reload, so applications can apply settings of their own
+func (s *Server) OnReload(fn func(*ServerConfig)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onReload = append(s.onReload, fn)
+}
+
+// Reload applies the timeouts, limits and logger of config to the running
+// server. Commands already in progress keep the settings they started with;
+// everything else, including existing connections, uses the new ones from
+// their next command on. The address, TLS settings and hooks cannot be changed
+// this way. A nil Logger keeps the current one.
+func (s *Server) Reload(config *ServerConfig) error {
+	if config == nil {
+		return fmt.Errorf("nil config")
+	}
+	if config.ReadTimeout < 0 || config.WriteTimeout < 0 || config.IdleTimeout < 0 {
+		return fmt.Errorf("timeouts must not be negative")
+	}
+	if config.MaxConnections < 0 || config.MaxInlineSize < 0 || config.MaxNestingDepth < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+
+	s.configMu.Lock()
+	s.ReadTimeout = config.ReadTimeout
+	s.WriteTimeout = config.WriteTimeout
+	s.IdleTimeout = config.IdleTimeout
+	s.MaxConnections = config.MaxConnections
+	s.MaxInlineSize = config.MaxInlineSize
+	s.MaxNestingDepth = config.MaxNestingDepth
+	if config.Logger != nil {
+		s.Logger = config.Logger
+	}
+	s.configMu.Unlock()
+
+	s.mu.RLock()
+	hooks := make([]func(*ServerConfig), len(s.onReload))
+	copy(hooks, s.onReload)
+	s.mu.RUnlock()
+
+	for _, fn := range hooks {
+		fn(config)
+	}
+
+	s.logger().Info("Configuration reloaded")
+	return nil
+}
+
+// ReloadOnSignal calls load and applies the configuration it returns every
+// time the process receives SIGHUP, until the server shuts down. If TLS
+// certificate files were set with SetTLSCertFiles they are reloaded as well.
+func (s *Server) ReloadOnSignal(load func() (*ServerConfig, error)) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-signals:
+				s.reloadFrom(load)
+			}
+		}
+	}()
+}
+
+func (s *Server) reloadFrom(load func() (*ServerConfig, error)) {
+	config, err := load()
+	if err != nil {
+		s.logger().Error("Failed to load configuration: %v", err)
+		return
+	}
+	if err := s.Reload(config); err != nil {
+		s.logger().Error("Failed to reload configuration: %v", err)
+		return
+	}
+
+	s.mu.RLock()
+	hasCerts := s.certReloader != nil
+	s.mu.RUnlock()
+	if hasCerts {
+		if err := s.ReloadTLS(); err != nil {
+			s.logger().Error("TLS certificate reload failed: %v", err)
+		}
+	}
+}
+
+// The accessors below read settings that Reload may change concurrently
+
+func (s *Server) logger() Logger {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	return s.Logger
+}
+
+func (s *Server) readTimeout() time.Duration {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	return s.ReadTimeout
+}
+
+func (s *Server) writeTimeout() time.Duration {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	return s.WriteTimeout
+}
+
+func (s *Server) idleTimeout() time.Duration {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	return s.IdleTimeout
+}
+
+func (s *Server) maxConnections() int {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	return s.MaxConnections
+}
+
+func (s *Server) maxInlineSize() int {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	return s.MaxInlineSize
+}
+
+func (s *Server) maxNestingDepth() int {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	return s.MaxNestingDepth
+}
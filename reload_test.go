@@ -0,0 +1,86 @@
+package redkit
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestReloadAppliesLimits(t *testing.T) {
+	server, address := startTestServer(t, nil)
+
+	var reloaded *ServerConfig
+	server.OnReload(func(config *ServerConfig) {
+		reloaded = config
+	})
+
+	client := dialRaw(t, address)
+	client.sendRaw(t, "ECHO "+strings.Repeat("a", 100)+"\r\n")
+	if line := client.readLine(t); line != "$100" {
+		t.Fatalf("Expected $100 before reload, got %q", line)
+	}
+	client.readLine(t)
+
+	config := DefaultServerConfig()
+	config.MaxInlineSize = 16
+	config.Logger = NewDefaultLogger(nil, LogLevelOff)
+	if err := server.Reload(config); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if reloaded != config {
+		t.Fatal("Expected OnReload hook to receive the new config")
+	}
+
+	// The existing connection picks up the new inline limit
+	client.sendRaw(t, "ECHO "+strings.Repeat("a", 100)+"\r\n")
+	client.expectClosed(t)
+}
+
+func TestReloadRejectsInvalidConfig(t *testing.T) {
+	server := NewServer(":0", WithLogger(NewDefaultLogger(nil, LogLevelOff)))
+	defer server.cancel()
+
+	config := DefaultServerConfig()
+	config.ReadTimeout = -time.Second
+	if err := server.Reload(config); err == nil {
+		t.Fatal("Expected an error for a negative timeout")
+	}
+	if server.ReadTimeout != 30*time.Second {
+		t.Errorf("Expected ReadTimeout to stay unchanged, got %v", server.ReadTimeout)
+	}
+}
+
+func TestReloadOnSignal(t *testing.T) {
+	server, _ := startTestServer(t, nil)
+
+	done := make(chan struct{})
+	server.OnReload(func(*ServerConfig) { close(done) })
+	server.ReloadOnSignal(func() (*ServerConfig, error) {
+		config := DefaultServerConfig()
+		config.MaxConnections = 5
+		config.Logger = NewDefaultLogger(nil, LogLevelOff)
+		return config, nil
+	})
+
+	if runtime.GOOS == "windows" {
+		t.Skip("SIGHUP cannot be sent on Windows")
+	}
+	process, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatalf("Failed to find own process: %v", err)
+	}
+	if err := process.Signal(syscall.SIGHUP); err != nil {
+		t.Fatalf("Failed to send SIGHUP: %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for reload")
+	}
+	if got := server.maxConnections(); got != 5 {
+		t.Errorf("Expected MaxConnections 5, got %d", got)
+	}
+}
@@ -0,0 +1,48 @@
+package redkit
+
+// OnReset registers a function called when a connection sends RESET, to put
+// the state kept for it back to that of a new connection. The server
+// registers its own subsystems the same way, so fn runs after the
+// transaction, watches, tracking, flags, database, protocol and
+// authentication of the connection are reset.
+func (s *Server) OnReset(fn func(conn *Connection)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onReset = append(s.onReset, fn)
+}
+
+func (s *Server) runResetHooks(conn *Connection) {
+	s.mu.RLock()
+	hooks := s.onReset
+	s.mu.RUnlock()
+
+	for _, fn := range hooks {
+		fn(conn)
+	}
+}
+
+// registerReset registers RESET and the reset of the connection state the
+// server keeps
+func (s *Server) registerReset() {
+	s.OnReset(func(conn *Connection) {
+		conn.tx = nil
+		s.watches.unwatch(conn)
+	})
+	s.OnReset(s.tracking.remove)
+	s.OnReset(func(conn *Connection) {
+		// READWRITE, CLIENT REPLY ON, NO-EVICT OFF and NO-TOUCH OFF
+		conn.flags.Store(0)
+		conn.db.Store(0)
+		conn.SetProtocol(RESP2)
+		conn.SetSubscribed(false)
+		conn.clearAuthenticated()
+	})
+
+	s.RegisterCommandFunc(string(RESET), s.handleReset, ExactArgs(0), WithFlags(CmdNoAuth|CmdFast), WithSummary("Resets the connection."))
+}
+
+// handleReset implements RESET
+func (s *Server) handleReset(conn *Connection, cmd *Command) RedisValue {
+	s.runResetHooks(conn)
+	return RedisValue{Type: SimpleString, Str: "RESET"}
+}
@@ -0,0 +1,48 @@
+package redkit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReset(t *testing.T) {
+	config := DefaultServerConfig()
+	WithPassword("secret")(config)
+	server, address := startTestServer(t, config)
+
+	var state []string
+	server.OnReset(func(conn *Connection) {
+		state = append(state, conn.Flags().String())
+	})
+	server.RegisterCommandFunc("STATE", func(conn *Connection, cmd *Command) RedisValue {
+		return RedisValue{Type: SimpleString, Str: conn.Flags().String() + " " + string(rune('0'+conn.DB()))}
+	})
+
+	client := dialRaw(t, address)
+	client.send(t, "AUTH", "secret")
+	client.send(t, "SELECT", "3")
+	client.send(t, "READONLY")
+	client.send(t, "CLIENT", "NO-EVICT", "on")
+	client.send(t, "STATE")
+	client.send(t, "WATCH", "k")
+	client.send(t, "MULTI")
+	client.send(t, "RESET")
+	expectLines(t, client, "+OK", "+OK", "+OK", "+OK", "+re 3", "+OK", "+OK", "+RESET")
+
+	if strings.Join(state, ",") != "N" {
+		t.Errorf("Expected OnReset to run after the built-in reset, got %v", state)
+	}
+	client.send(t, "EXEC")
+	expectLines(t, client, "-NOAUTH Authentication required.")
+	client.send(t, "AUTH", "secret")
+	client.send(t, "EXEC")
+	client.send(t, "STATE")
+	expectLines(t, client, "+OK", "-ERR EXEC without MULTI", "+N 0")
+
+	server.watches.mu.Lock()
+	watching := len(server.watches.conns)
+	server.watches.mu.Unlock()
+	if watching != 0 {
+		t.Errorf("Expected RESET to unwatch the keys, got %d watching connections", watching)
+	}
+}
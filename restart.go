@@ -0,0 +1,101 @@
+package redkit
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// ListenFDEnv names the environment variable through which Restart hands the
+// listening socket to the new process. Listen uses the inherited descriptor
+// instead of binding Address when it is set.
+const ListenFDEnv = "REDKIT_LISTEN_FD"
+
+// inheritedListener returns the listener passed down by a parent process, or nil
+// if the process was not started by Restart
+func inheritedListener() (net.Listener, error) {
+	value := os.Getenv(ListenFDEnv)
+	if value == "" {
+		return nil, nil
+	}
+	os.Unsetenv(ListenFDEnv)
+
+	fd, err := strconv.Atoi(value)
+	if err != nil || fd < 0 {
+		return nil, fmt.Errorf("invalid %s value %q", ListenFDEnv, value)
+	}
+
+	file := os.NewFile(uintptr(fd), "redkit-listener")
+	if file == nil {
+		return nil, fmt.Errorf("invalid inherited listener descriptor %d", fd)
+	}
+	defer file.Close()
+
+	listener, err := net.FileListener(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use inherited listener: %w", err)
+	}
+	return listener, nil
+}
+
+// ListenerFile returns a duplicate of the listening socket's file descriptor,
+// for passing to another process. The caller must close the file.
+func (s *Server) ListenerFile() (*os.File, error) {
+	tcpListener, ok := s.netListener.(*net.TCPListener)
+	if !ok {
+		return nil, fmt.Errorf("server is not listening on a TCP socket")
+	}
+	return tcpListener.File()
+}
+
+// Restart performs a zero-downtime binary upgrade. It starts the current
+// executable again with the same arguments, handing it the listening socket
+// through ListenFDEnv, then drains this server and shuts it down once in-flight
+// commands finish or ctx is done. Pending connections queued on the socket are
+// picked up by the new process, so clients only see their existing connections
+// close. It returns the new process.
+func (s *Server) Restart(ctx context.Context) (*os.Process, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find executable: %w", err)
+	}
+
+	file, err := s.ListenerFile()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = []*os.File{file}
+	cmd.Env = append(environWithout(ListenFDEnv), ListenFDEnv+"=3") // ExtraFiles start at descriptor 3
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start new process: %w", err)
+	}
+	s.logger().Info("Started new process %d, draining connections", cmd.Process.Pid)
+
+	if err := s.Drain(ctx); err != nil {
+		s.logger().Warn("Drain before restart did not complete: %v", err)
+	}
+	return cmd.Process, s.Shutdown(ctx)
+}
+
+// environWithout returns the process environment minus the given variable
+func environWithout(name string) []string {
+	env := os.Environ()
+	filtered := env[:0]
+	for _, kv := range env {
+		if !strings.HasPrefix(kv, name+"=") {
+			filtered = append(filtered, kv)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,68 @@
+package redkit
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// TestRestartChildServer is not a real test: it is the new process started by
+// TestListenerHandoff, serving on the inherited socket until it is killed
+func TestRestartChildServer(t *testing.T) {
+	if os.Getenv("REDKIT_TEST_CHILD") != "1" {
+		t.Skip("helper process")
+	}
+
+	server := NewServer("127.0.0.1:0", WithLogger(NewDefaultLogger(nil, LogLevelOff)))
+	server.RegisterCommandFunc("WHO", func(conn *Connection, cmd *Command) RedisValue {
+		return RedisValue{Type: SimpleString, Str: "child"}
+	})
+	if err := server.Listen(); err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	server.Serve()
+}
+
+func TestListenerHandoff(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("listener descriptors cannot be inherited on Windows")
+	}
+
+	server, address := startTestServer(t, nil)
+	server.RegisterCommandFunc("WHO", func(conn *Connection, cmd *Command) RedisValue {
+		return RedisValue{Type: SimpleString, Str: "parent"}
+	})
+
+	file, err := server.ListenerFile()
+	if err != nil {
+		t.Fatalf("ListenerFile failed: %v", err)
+	}
+	defer file.Close()
+
+	child := exec.Command(os.Args[0], "-test.run=^TestRestartChildServer$")
+	child.ExtraFiles = []*os.File{file}
+	child.Env = append(environWithout(ListenFDEnv), ListenFDEnv+"=3", "REDKIT_TEST_CHILD=1")
+	if err := child.Start(); err != nil {
+		t.Fatalf("Failed to start child: %v", err)
+	}
+	defer func() {
+		child.Process.Kill()
+		child.Wait()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := server.Drain(ctx); err != nil {
+		t.Fatalf("Drain failed: %v", err)
+	}
+
+	// The socket stays open in the child, so new connections queue up for it
+	client := dialRaw(t, address)
+	client.send(t, "WHO")
+	if line := client.readLine(t); line != "+child" {
+		t.Fatalf("Expected the child to answer, got %q", line)
+	}
+}
@@ -0,0 +1,534 @@
+package redkit
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// defaultScriptTimeLimit is how long a script runs before other connections
+// are refused with BUSY when ServerConfig.ScriptTimeLimit is zero
+const defaultScriptTimeLimit = 5 * time.Second
+
+// errScriptKilled stops a script for SCRIPT KILL
+var errScriptKilled = errors.New("script killed by user with SCRIPT KILL")
+
+// noScriptCommands can't be called from a script
+var noScriptCommands = commandSet(
+	MULTI, EXEC, DISCARD, WATCH, UNWATCH, EVAL, EVALSHA, EVAL_RO, EVALSHA_RO, SCRIPT,
+	FCALL, FCALL_RO, FUNCTION, AUTH, HELLO, QUIT, RESET, MONITOR,
+	SUBSCRIBE, PSUBSCRIBE, SSUBSCRIBE, UNSUBSCRIBE, PUNSUBSCRIBE, SUNSUBSCRIBE,
+)
+
+// scriptEngine holds the Lua interpreter and the scripts loaded into it
+type scriptEngine struct {
+	mu      sync.Mutex // scripts run one at a time, as they hold execMu
+	state   *lua.LState
+	sandbox *lua.LTable                   // metatable of the globals of a run
+	scripts map[string]*lua.FunctionProto // compiled scripts by SHA1
+
+	// the script being run: redis.call runs commands for conn
+	server   *Server
+	conn     *Connection
+	ctx      context.Context
+	readOnly bool
+
+	running atomic.Pointer[scriptRun]
+}
+
+// scriptRun is a script running, which the commands of other connections
+// wait for until it becomes busy
+type scriptRun struct {
+	busy  chan struct{} // closed once the script has run for the ScriptTimeLimit
+	kill  context.CancelCauseFunc
+	state atomic.Int32 // scriptRunning until it writes or is killed
+}
+
+// The states of a scriptRun: once a script has written it can't be killed,
+// and once killed it can't write
+const (
+	scriptRunning int32 = iota
+	scriptWrote
+	scriptKilled
+)
+
+func newScriptEngine(s *Server) *scriptEngine {
+	return &scriptEngine{server: s, scripts: make(map[string]*lua.FunctionProto)}
+}
+
+func (s *Server) scriptTimeLimit() time.Duration {
+	if s.ScriptTimeLimit != 0 {
+		return s.ScriptTimeLimit
+	}
+	return defaultScriptTimeLimit
+}
+
+// current returns the script running, if any
+func (e *scriptEngine) current() *scriptRun {
+	return e.running.Load()
+}
+
+// sha1hex returns the hex SHA1 digest scripts are identified by
+func sha1hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// load compiles a script, caching it by its SHA1
+func (e *scriptEngine) load(source string) (string, *lua.FunctionProto, error) {
+	sha := sha1hex(source)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if proto, ok := e.scripts[sha]; ok {
+		return sha, proto, nil
+	}
+	chunk, err := parse.Parse(strings.NewReader(source), "user_script")
+	if err != nil {
+		return "", nil, NewError(ErrPrefixGeneric, "Error compiling script (new function): %v", err)
+	}
+	proto, err := lua.Compile(chunk, "user_script")
+	if err != nil {
+		return "", nil, NewError(ErrPrefixGeneric, "Error compiling script (new function): %v", err)
+	}
+	e.scripts[sha] = proto
+	return sha, proto, nil
+}
+
+// lookup returns the script with the given SHA1, if loaded
+func (e *scriptEngine) lookup(sha string) (*lua.FunctionProto, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	proto, ok := e.scripts[strings.ToLower(sha)]
+	return proto, ok
+}
+
+func (e *scriptEngine) exists(sha string) bool {
+	_, ok := e.lookup(sha)
+	return ok
+}
+
+// flush forgets every loaded script and resets the interpreter
+func (e *scriptEngine) flush() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.scripts = make(map[string]*lua.FunctionProto)
+	if e.state != nil {
+		e.state.Close()
+		e.state, e.sandbox = nil, nil
+	}
+}
+
+// interpreter returns the Lua state, creating it on first use with the
+// base, table, string and math libraries and the redis API. Scripts see its
+// globals through a table of their own they can't add to, so that they
+// leave nothing behind for the next.
+func (e *scriptEngine) interpreter() *lua.LState {
+	if e.state != nil {
+		return e.state
+	}
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range []string{"dofile", "loadfile", "load", "loadstring", "getfenv", "setfenv"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+
+	redis := L.NewTable()
+	L.SetFuncs(redis, map[string]lua.LGFunction{
+		"call":         func(L *lua.LState) int { return e.call(L, false) },
+		"pcall":        func(L *lua.LState) int { return e.call(L, true) },
+		"error_reply":  luaErrorReply,
+		"status_reply": luaStatusReply,
+		"sha1hex": func(L *lua.LState) int {
+			L.Push(lua.LString(sha1hex(L.CheckString(1))))
+			return 1
+		},
+		"log": func(L *lua.LState) int { return 0 },
+	})
+	for i, level := range []string{"LOG_DEBUG", "LOG_VERBOSE", "LOG_NOTICE", "LOG_WARNING"} {
+		redis.RawSetString(level, lua.LNumber(i))
+	}
+	L.SetGlobal("redis", redis)
+
+	sandbox := L.NewTable()
+	sandbox.RawSetString("__index", L.G.Global)
+	sandbox.RawSetString("__newindex", L.NewFunction(func(L *lua.LState) int {
+		L.RaiseError("Attempt to modify a readonly table")
+		return 0
+	}))
+	sandbox.RawSetString("__metatable", lua.LFalse)
+	e.state, e.sandbox = L, sandbox
+	return L
+}
+
+// run runs a compiled script for conn with KEYS and ARGV set
+func (e *scriptEngine) run(ctx context.Context, conn *Connection, proto *lua.FunctionProto, keys, argv []string, readOnly bool) RedisValue {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ctx, kill := context.WithCancelCause(ctx)
+	defer kill(nil)
+	run := &scriptRun{busy: make(chan struct{}), kill: kill}
+	if limit := e.server.scriptTimeLimit(); limit > 0 {
+		timer := time.AfterFunc(limit, func() { close(run.busy) })
+		defer timer.Stop()
+	}
+	e.running.Store(run)
+	defer e.running.Store(nil)
+
+	L := e.interpreter()
+	e.conn, e.ctx, e.readOnly = conn, ctx, readOnly
+	defer func() { e.conn, e.ctx = nil, nil }()
+
+	globals := L.CreateTable(0, 3)
+	globals.RawSetString("KEYS", luaStrings(L, keys))
+	globals.RawSetString("ARGV", luaStrings(L, argv))
+	globals.RawSetString("_G", globals)
+	L.SetMetatable(globals, e.sandbox)
+	L.SetContext(ctx)
+	defer L.RemoveContext()
+
+	top := L.GetTop()
+	fn := L.NewFunctionFromProto(proto)
+	fn.Env = globals
+	L.Push(fn)
+	if err := L.PCall(0, 1, nil); err != nil {
+		L.SetTop(top)
+		if context.Cause(ctx) == errScriptKilled {
+			return NewError(ErrPrefixGeneric, "Script killed by user with SCRIPT KILL...").Value()
+		}
+		return scriptError(err)
+	}
+	result := L.Get(-1)
+	L.SetTop(top)
+	return luaToValue(result)
+}
+
+// call implements redis.call and redis.pcall
+func (e *scriptEngine) call(L *lua.LState, protected bool) int {
+	n := L.GetTop()
+	if n == 0 {
+		return e.fail(L, protected, "Please specify at least one argument for this redis lib call")
+	}
+	args := make([]string, n)
+	for i := 1; i <= n; i++ {
+		switch v := L.Get(i).(type) {
+		case lua.LString:
+			args[i-1] = string(v)
+		case lua.LNumber:
+			args[i-1] = luaNumberString(v)
+		default:
+			return e.fail(L, protected, "Lua redis lib command arguments must be strings or integers")
+		}
+	}
+
+	name := strings.ToUpper(args[0])
+	if _, ok := noScriptCommands[name]; ok {
+		return e.fail(L, protected, "This Redis command is not allowed from script")
+	}
+	if e.server.commandIsWrite(name) {
+		if e.readOnly {
+			return e.fail(L, protected, "Write commands are not allowed from read-only scripts.")
+		}
+		run := e.running.Load()
+		if !run.state.CompareAndSwap(scriptRunning, scriptWrote) && run.state.Load() == scriptKilled {
+			return e.fail(L, protected, "Script killed by user with SCRIPT KILL...")
+		}
+	}
+
+	cmd := &Command{Name: args[0], Args: args[1:], ctx: e.ctx}
+	reply := e.server.handleCommand(e.conn, cmd)
+	if reply.Type == ErrorReply && !protected {
+		L.Error(luaErrorTable(L, reply.Str), 1)
+		return 0
+	}
+	L.Push(valueToLua(L, reply))
+	return 1
+}
+
+// luaNumberString converts a number passed to redis.call to its argument as
+// Lua does: integral values without a decimal point, others with %.17g
+func luaNumberString(n lua.LNumber) string {
+	f := float64(n)
+	if f == math.Trunc(f) && math.Abs(f) < 1<<63 {
+		return strconv.FormatInt(int64(f), 10)
+	}
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return formatDouble(f)
+	}
+	return strconv.FormatFloat(f, 'g', 17, 64)
+}
+
+// fail returns an error from redis.pcall, or raises it from redis.call
+func (e *scriptEngine) fail(L *lua.LState, protected bool, msg string) int {
+	errTable := luaErrorTable(L, ErrPrefixGeneric+" "+msg)
+	if !protected {
+		L.Error(errTable, 1)
+		return 0
+	}
+	L.Push(errTable)
+	return 1
+}
+
+func luaErrorReply(L *lua.LState) int {
+	L.Push(luaErrorTable(L, L.CheckString(1)))
+	return 1
+}
+
+func luaStatusReply(L *lua.LState) int {
+	t := L.NewTable()
+	t.RawSetString("ok", lua.LString(L.CheckString(1)))
+	L.Push(t)
+	return 1
+}
+
+func luaErrorTable(L *lua.LState, msg string) *lua.LTable {
+	t := L.NewTable()
+	t.RawSetString("err", lua.LString(msg))
+	return t
+}
+
+func luaStrings(L *lua.LState, values []string) *lua.LTable {
+	t := L.CreateTable(len(values), 0)
+	for _, v := range values {
+		t.Append(lua.LString(v))
+	}
+	return t
+}
+
+// scriptError converts an error raised by a script into its reply
+func scriptError(err error) RedisValue {
+	var apiErr *lua.ApiError
+	if errors.As(err, &apiErr) {
+		if t, ok := apiErr.Object.(*lua.LTable); ok {
+			if msg, ok := t.RawGetString("err").(lua.LString); ok {
+				return luaErrorValue(string(msg))
+			}
+		}
+		if apiErr.Object != nil && apiErr.Object != lua.LNil {
+			return NewError(ErrPrefixGeneric, "Error running script: %s", apiErr.Object.String()).Value()
+		}
+	}
+	return NewError(ErrPrefixGeneric, "Error running script: %v", err).Value()
+}
+
+// luaErrorValue converts an error message from a script into an error reply,
+// adding the ERR prefix unless it starts with an error code
+func luaErrorValue(msg string) RedisValue {
+	code, _, _ := strings.Cut(msg, " ")
+	if code == "" || strings.ToUpper(code) != code {
+		msg = ErrPrefixGeneric + " " + msg
+	}
+	return RedisValue{Type: ErrorReply, Str: msg}
+}
+
+// luaToValue converts a value returned by a script into a reply: numbers
+// become integers, tables become arrays up to their first nil unless they
+// hold an ok or err field, true becomes 1 and false and nil become null
+func luaToValue(v lua.LValue) RedisValue {
+	switch v := v.(type) {
+	case lua.LString:
+		return RedisValue{Type: BulkString, Bulk: []byte(v)}
+	case lua.LNumber:
+		return RedisValue{Type: Integer, Int: int64(v)}
+	case lua.LBool:
+		if v {
+			return RedisValue{Type: Integer, Int: 1}
+		}
+		return RedisValue{Type: Null}
+	case *lua.LTable:
+		if msg, ok := v.RawGetString("err").(lua.LString); ok {
+			return luaErrorValue(string(msg))
+		}
+		if status, ok := v.RawGetString("ok").(lua.LString); ok {
+			return RedisValue{Type: SimpleString, Str: string(status)}
+		}
+		var items []RedisValue
+		for i := 1; ; i++ {
+			item := v.RawGetInt(i)
+			if item == lua.LNil {
+				break
+			}
+			items = append(items, luaToValue(item))
+		}
+		return RedisValue{Type: Array, Array: items}
+	default:
+		return RedisValue{Type: Null}
+	}
+}
+
+// valueToLua converts the reply of redis.call into a Lua value, following the
+// RESP2 conversion rules: null becomes false, status and error replies become
+// tables with an ok or err field, and RESP3 types are downgraded first
+func valueToLua(L *lua.LState, v RedisValue) lua.LValue {
+	switch v.Type {
+	case SimpleString:
+		t := L.NewTable()
+		t.RawSetString("ok", lua.LString(v.Str))
+		return t
+	case ErrorReply:
+		return luaErrorTable(L, v.Str)
+	case Integer:
+		return lua.LNumber(v.Int)
+	case BulkString:
+		return lua.LString(v.Bulk)
+	case Array, Set, Push:
+		t := L.CreateTable(len(v.Array), 0)
+		for _, item := range v.Array {
+			t.Append(valueToLua(L, item))
+		}
+		return t
+	case Map:
+		t := L.CreateTable(len(v.Map)*2, 0)
+		for _, entry := range v.Map {
+			t.Append(valueToLua(L, entry.Key))
+			t.Append(valueToLua(L, entry.Value))
+		}
+		return t
+	case Double:
+		return lua.LString(formatDouble(v.Float))
+	case Boolean:
+		if v.Bool {
+			return lua.LNumber(1)
+		}
+		return lua.LNumber(0)
+	case BigNumber:
+		if v.Big != nil {
+			return lua.LString(v.Big.String())
+		}
+		return lua.LString(v.Str)
+	case Verbatim:
+		return lua.LString(v.Str)
+	case Attribute:
+		if len(v.Array) > 0 {
+			return valueToLua(L, v.Array[0])
+		}
+		return lua.LFalse
+	default:
+		return lua.LFalse
+	}
+}
+
+// scriptKeys splits the numkeys, key and arg arguments of EVAL and EVALSHA
+func scriptKeys(args []string) (keys, argv []string, err *RedisError) {
+	numKeys, convErr := strconv.Atoi(args[0])
+	if convErr != nil {
+		return nil, nil, NewError(ErrPrefixGeneric, "value is not an integer or out of range")
+	}
+	if numKeys < 0 {
+		return nil, nil, NewError(ErrPrefixGeneric, "Number of keys can't be negative")
+	}
+	if numKeys > len(args)-1 {
+		return nil, nil, NewError(ErrPrefixGeneric, "Number of keys can't be greater than number of args")
+	}
+	return args[1 : 1+numKeys], args[1+numKeys:], nil
+}
+
+// evalHandler returns the handler of EVAL or EVAL_RO
+func (s *Server) evalHandler(readOnly bool) func(*Connection, *Command) RedisValue {
+	return func(conn *Connection, cmd *Command) RedisValue {
+		keys, argv, keyErr := scriptKeys(cmd.Args[1:])
+		if keyErr != nil {
+			return keyErr.Value()
+		}
+		_, proto, err := s.scripts.load(cmd.Args[0])
+		if err != nil {
+			return ErrorValue(err)
+		}
+		return s.runScript(conn, cmd, proto, keys, argv, readOnly)
+	}
+}
+
+// evalShaHandler returns the handler of EVALSHA or EVALSHA_RO
+func (s *Server) evalShaHandler(readOnly bool) func(*Connection, *Command) RedisValue {
+	return func(conn *Connection, cmd *Command) RedisValue {
+		keys, argv, keyErr := scriptKeys(cmd.Args[1:])
+		if keyErr != nil {
+			return keyErr.Value()
+		}
+		proto, ok := s.scripts.lookup(cmd.Args[0])
+		if !ok {
+			return NoScript().Value()
+		}
+		return s.runScript(conn, cmd, proto, keys, argv, readOnly)
+	}
+}
+
+// runScript runs a script atomically: commands of other connections wait
+// until it returns
+func (s *Server) runScript(conn *Connection, cmd *Command, proto *lua.FunctionProto, keys, argv []string, readOnly bool) RedisValue {
+	var reply RedisValue
+	s.runExclusive(conn, func() {
+		reply = s.scripts.run(cmd.Context(), conn, proto, keys, argv, readOnly)
+	})
+	return reply
+}
+
+// registerScripting registers EVAL, EVALSHA, their read-only variants and SCRIPT
+func (s *Server) registerScripting() {
+	s.RegisterCommandFunc(string(EVAL), s.evalHandler(false), MinArgs(2), WithKeysFunc(NumKeysAt(2)), exclusive(),
+		WithSummary("Executes a server-side Lua script."))
+	s.RegisterCommandFunc(string(EVALSHA), s.evalShaHandler(false), MinArgs(2), WithKeysFunc(NumKeysAt(2)), exclusive(),
+		WithSummary("Executes a server-side Lua script by SHA1 digest."))
+	s.RegisterCommandFunc(string(EVAL_RO), s.evalHandler(true), MinArgs(2), WithKeysFunc(NumKeysAt(2)), exclusive(),
+		WithFlags(CmdReadOnly), WithSummary("Executes a read-only server-side Lua script."))
+	s.RegisterCommandFunc(string(EVALSHA_RO), s.evalShaHandler(true), MinArgs(2), WithKeysFunc(NumKeysAt(2)), exclusive(),
+		WithFlags(CmdReadOnly), WithSummary("Executes a read-only server-side Lua script by SHA1 digest."))
+
+	s.RegisterSubcommandFunc(string(SCRIPT), "LOAD", func(conn *Connection, cmd *Command) RedisValue {
+		sha, _, err := s.scripts.load(cmd.Args[0])
+		if err != nil {
+			return ErrorValue(err)
+		}
+		return RedisValue{Type: BulkString, Bulk: []byte(sha)}
+	}, ExactArgs(1), WithSummary("Loads a server-side Lua script to the script cache."))
+	s.RegisterSubcommandFunc(string(SCRIPT), "EXISTS", func(conn *Connection, cmd *Command) RedisValue {
+		exists := make([]RedisValue, len(cmd.Args))
+		for i, sha := range cmd.Args {
+			exists[i] = RedisValue{Type: Integer}
+			if s.scripts.exists(sha) {
+				exists[i].Int = 1
+			}
+		}
+		return RedisValue{Type: Array, Array: exists}
+	}, MinArgs(1), WithSummary("Determines whether server-side Lua scripts exist in the script cache."))
+	s.RegisterSubcommandFunc(string(SCRIPT), "KILL", func(conn *Connection, cmd *Command) RedisValue {
+		run := s.scripts.current()
+		switch {
+		case run == nil:
+			return NewError("NOTBUSY", "No scripts in execution right now.").Value()
+		case !run.state.CompareAndSwap(scriptRunning, scriptKilled) && run.state.Load() == scriptWrote:
+			return NewError("UNKILLABLE", "Sorry the script already executed write commands against the dataset. You can either wait the script termination or kill the server in a hard way using the SHUTDOWN NOSAVE command.").Value()
+		}
+		run.kill(errScriptKilled)
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	}, ExactArgs(0), WithSummary("Terminates a server-side Lua script during execution."))
+	s.RegisterSubcommandFunc(string(SCRIPT), "FLUSH", func(conn *Connection, cmd *Command) RedisValue {
+		if len(cmd.Args) == 1 && !strings.EqualFold(cmd.Args[0], "ASYNC") && !strings.EqualFold(cmd.Args[0], "SYNC") {
+			return NewError(ErrPrefixGeneric, "SCRIPT FLUSH only support SYNC|ASYNC option").Value()
+		}
+		s.scripts.flush()
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	}, RangeArgs(0, 1), WithSummary("Removes all server-side Lua scripts from the script cache."))
+}
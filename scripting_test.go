@@ -0,0 +1,183 @@
+package redkit
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestEval(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	values := make(map[string]string)
+	server.RegisterCommandFunc("SET", func(conn *Connection, cmd *Command) RedisValue {
+		values[cmd.Args[0]] = cmd.Args[1]
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	}, ExactArgs(2))
+	server.RegisterCommandFunc("GET", func(conn *Connection, cmd *Command) RedisValue {
+		value, ok := values[cmd.Args[0]]
+		if !ok {
+			return RedisValue{Type: Null}
+		}
+		return RedisValue{Type: BulkString, Bulk: []byte(value)}
+	}, ExactArgs(1), WithFlags(CmdReadOnly))
+
+	rdb := redis.NewClient(&redis.Options{Addr: address, Protocol: 2})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	result, err := rdb.Eval(ctx, `
+		redis.call("SET", KEYS[1], ARGV[1])
+		return {redis.call("GET", KEYS[1]), redis.call("GET", "missing"), 42, true}
+	`, []string{"key"}, "value").Slice()
+	if err != nil {
+		t.Fatalf("EVAL failed: %v", err)
+	}
+	if len(result) != 4 || result[0] != "value" || result[1] != nil || result[2] != int64(42) || result[3] != int64(1) {
+		t.Errorf("Unexpected result %#v", result)
+	}
+
+	for _, tt := range []struct{ number, expected string }{{"1.5", "1.5"}, {"3", "3"}, {"-2.0", "-2"}, {"0.1", "0.10000000000000001"}, {"1e300", "1.0000000000000001e+300"}} {
+		if err := rdb.Eval(ctx, `return redis.call("SET", KEYS[1], `+tt.number+`)`, []string{"n"}).Err(); err != nil {
+			t.Fatalf("EVAL failed: %v", err)
+		}
+		if got, _ := rdb.Get(ctx, "n").Result(); got != tt.expected {
+			t.Errorf("Expected %s to be passed as %q, got %q", tt.number, tt.expected, got)
+		}
+	}
+
+	if status, err := rdb.Eval(ctx, `return redis.status_reply("DONE")`, nil).Text(); err != nil || status != "DONE" {
+		t.Errorf("Expected status DONE, got %q, %v", status, err)
+	}
+	if err := rdb.Eval(ctx, `return redis.error_reply("MYERR custom")`, nil).Err(); err == nil || err.Error() != "MYERR custom" {
+		t.Errorf("Expected the custom error, got %v", err)
+	}
+	if err := rdb.Eval(ctx, `return redis.call("SET", "only-one")`, nil).Err(); err == nil || !strings.Contains(err.Error(), "wrong number of arguments") {
+		t.Errorf("Expected redis.call to raise the arity error, got %v", err)
+	}
+	if got, err := rdb.Eval(ctx, `return redis.pcall("NOPE")["err"]`, nil).Text(); err != nil || !strings.Contains(got, "unknown command") {
+		t.Errorf("Expected redis.pcall to return the error, got %q, %v", got, err)
+	}
+	if err := rdb.Eval(ctx, `redis.call("MULTI")`, nil).Err(); err == nil || !strings.Contains(err.Error(), "not allowed from script") {
+		t.Errorf("Expected MULTI to be refused, got %v", err)
+	}
+	if err := rdb.Do(ctx, "EVAL_RO", `return redis.call("SET", "k", "v")`, "0").Err(); err == nil || !strings.Contains(err.Error(), "read-only scripts") {
+		t.Errorf("Expected writes to be refused from EVAL_RO, got %v", err)
+	}
+	if err := rdb.Eval(ctx, `return 1`, []string{"a"}, "b").Err(); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if err := rdb.Do(ctx, "EVAL", "return 1", "2", "a").Err(); err == nil || !strings.Contains(err.Error(), "greater than number of args") {
+		t.Errorf("Expected a numkeys error, got %v", err)
+	}
+	if err := rdb.Eval(ctx, `return +`, nil).Err(); err == nil || !strings.Contains(err.Error(), "Error compiling script") {
+		t.Errorf("Expected a compile error, got %v", err)
+	}
+
+	// Scripts can't leave globals behind for the next
+	if err := rdb.Eval(ctx, "leaked = 42", nil).Err(); err == nil || !strings.Contains(err.Error(), "Attempt to modify a readonly table") {
+		t.Errorf("Expected new globals to be refused, got %v", err)
+	}
+	for _, script := range []string{"_G.leaked = 42", "KEYS = nil redis = nil", "getmetatable(_G).__index.leaked = 42"} {
+		if err := rdb.Eval(ctx, script, nil).Err(); err == nil {
+			t.Errorf("Expected %q to fail", script)
+		}
+	}
+	if err := rdb.Eval(ctx, `rawset(_G, "leaked", 42) local function f() leaked = 1 end`, nil).Err(); err != redis.Nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if got, err := rdb.Eval(ctx, `return {leaked == nil, type(redis.call)}`, []string{"x"}).Slice(); err != nil || len(got) != 2 || got[0] != int64(1) || got[1] != "function" {
+		t.Errorf("Expected no global to leak, got %v, %v", got, err)
+	}
+
+	if keys := server.ExtractKeys(&Command{Name: "EVAL", Args: []string{"return 1", "2", "a", "b", "c"}}); strings.Join(keys, ",") != "a,b" {
+		t.Errorf("Expected keys a,b, got %v", keys)
+	}
+}
+
+func TestEvalShaAndScript(t *testing.T) {
+	_, address := startTestServer(t, nil)
+	rdb := redis.NewClient(&redis.Options{Addr: address, Protocol: 2})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	script := "return ARGV[1] .. ARGV[2]"
+	if err := rdb.EvalSha(ctx, sha1hex(script), nil, "a", "b").Err(); err == nil || !strings.HasPrefix(err.Error(), "NOSCRIPT") {
+		t.Fatalf("Expected NOSCRIPT, got %v", err)
+	}
+	sha, err := rdb.ScriptLoad(ctx, script).Result()
+	if err != nil || sha != sha1hex(script) {
+		t.Fatalf("SCRIPT LOAD returned %q, %v", sha, err)
+	}
+	if got, err := rdb.EvalSha(ctx, strings.ToUpper(sha), nil, "a", "b").Text(); err != nil || got != "ab" {
+		t.Errorf("Expected ab, got %q, %v", got, err)
+	}
+	if exists, err := rdb.ScriptExists(ctx, sha, "0000").Result(); err != nil || !exists[0] || exists[1] {
+		t.Errorf("Unexpected SCRIPT EXISTS result %v, %v", exists, err)
+	}
+
+	// go-redis falls back to EVAL on NOSCRIPT
+	if got, err := redis.NewScript("return 'x'").Run(ctx, rdb, nil).Text(); err != nil || got != "x" {
+		t.Errorf("Expected x, got %q, %v", got, err)
+	}
+
+	if err := rdb.ScriptFlush(ctx).Err(); err != nil {
+		t.Fatalf("SCRIPT FLUSH failed: %v", err)
+	}
+	if exists, _ := rdb.ScriptExists(ctx, sha).Result(); exists[0] {
+		t.Error("Expected the script to be flushed")
+	}
+}
+
+// TestScriptBusy tests that a script running past the ScriptTimeLimit gets
+// the commands of other connections refused with BUSY until SCRIPT KILL
+func TestScriptBusy(t *testing.T) {
+	config := DefaultServerConfig()
+	config.ScriptTimeLimit = 50 * time.Millisecond
+	config.CommandTimeout = time.Second
+	server, address := startTestServer(t, config)
+	server.EnableBuiltinStore()
+	script := dialRaw(t, address)
+	other := dialRaw(t, address)
+
+	busy := func() {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			other.send(t, "PING")
+			line := other.readLine(t)
+			if strings.HasPrefix(line, "-BUSY") {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected BUSY, got %q", line)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	other.send(t, "SCRIPT", "KILL")
+	expectLines(t, other, "-NOTBUSY No scripts in execution right now.")
+	script.send(t, "EVAL", "while true do end", "0")
+	busy()
+	other.send(t, "SCRIPT", "KILL")
+	expectLines(t, other, "+OK")
+	expectLines(t, script, "-ERR Script killed by user with SCRIPT KILL...")
+	other.send(t, "PING")
+	expectLines(t, other, "+PONG")
+
+	// A script that wrote runs until it returns, here by the CommandTimeout
+	script.send(t, "EVAL", "redis.call('SET', 'k', 'v') while true do end", "0")
+	busy()
+	other.send(t, "SCRIPT", "KILL")
+	if line := other.readLine(t); !strings.HasPrefix(line, "-UNKILLABLE") {
+		t.Errorf("Expected UNKILLABLE, got %q", line)
+	}
+	if line := script.readLine(t); !strings.HasPrefix(line, "-ERR Error running script") {
+		t.Errorf("Expected the script to time out, got %q", line)
+	}
+	other.send(t, "GET", "k")
+	expectLines(t, other, "$1", "v")
+}
@@ -4,24 +4,38 @@ import (
 	"bufio"
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net"
+	"runtime/debug"
+	"sort"
 	"strings"
 	"time"
 )
 
-func NewServer(address string) *Server {
+// NewServer creates a server listening on address with the default configuration
+// adjusted by opts
+func NewServer(address string, opts ...Option) *Server {
 	config := DefaultServerConfig()
 	config.Address = address
-	return NewServerWithConfig(config)
+	return NewServerWithConfig(config, opts...)
 }
 
-func NewServerWithConfig(config *ServerConfig) *Server {
+// NewServerWithConfig creates a server from config adjusted by opts. The config
+// itself is not modified.
+func NewServerWithConfig(config *ServerConfig, opts ...Option) *Server {
 	if config == nil {
 		config = DefaultServerConfig()
 	}
 
+	copied := *config
+	config = &copied
+	for _, opt := range opts {
+		opt(config)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 
 	if config.Logger == nil {
@@ -36,38 +50,103 @@ func NewServerWithConfig(config *ServerConfig) *Server {
 		IdleTimeout:        config.IdleTimeout,
 		IdleCheckFrequency: config.IdleCheckFrequency,
 		MaxConnections:     config.MaxConnections,
+		MaxInlineSize:      config.MaxInlineSize,
+		MaxNestingDepth:    config.MaxNestingDepth,
 		Logger:             config.Logger,
 		ConnStateHook:      config.ConnStateHook,
-		handlers:           make(map[string]CommandHandler),
+		ProtocolTrace:      config.ProtocolTrace,
+		StrictProtocol:     config.StrictProtocol,
+		DrainReject:        config.DrainReject,
+		CommandTimeout:     config.CommandTimeout,
+		CancelOnDisconnect: config.CancelOnDisconnect,
+		AdminAddress:       config.AdminAddress,
+		Databases:          config.Databases,
+		IdleGoodbye:        config.IdleGoodbye,
+		RequireAuth:        config.RequireAuth,
+		Authenticator:      config.Authenticator,
+		AcceptFilter:       config.AcceptFilter,
+		ClientCertHook:     config.ClientCertHook,
+		DeprecationNotice:  config.DeprecationNotice,
+		ExpireFrequency:    config.ExpireFrequency,
+		ExpireEffort:       config.ExpireEffort,
+		PubSubBuffer:       config.PubSubBuffer,
+		ScriptTimeLimit:    config.ScriptTimeLimit,
+		HandshakeTimeout:   config.HandshakeTimeout,
+		KeyspaceEvents:     config.KeyspaceEvents,
 		middlewareChain:    NewMiddlewareChain(),
-		activeConns:        make(map[*Connection]struct{}),
+		tracking:           newTrackingTable(),
+		watches:            newWatchTable(),
+		functions:          newFunctionRegistry(),
+		blocking:           newBlockingTable(),
+		pubsub:             newPubSubRegistry(),
+		stats:              newServerStats(),
+		activeConns:        make(map[uint64]*Connection),
 		ctx:                ctx,
 		cancel:             cancel,
 	}
 
+	server.handlers.Store(&commandTable{})
+	server.scripts = newScriptEngine(server)
+	server.expirer = newExpirer(server)
+	server.expirer.start()
 	server.registerDefaultHandlers()
 	server.startIdleChecker()
+	server.startStatsSampler()
 
 	return server
 }
 
-// RegisterCommand registers a command handler
-func (s *Server) RegisterCommand(name string, handler CommandHandler) error {
+// RegisterCommand registers a command handler. Options such as ExactArgs
+// declare how the command may be called so the dispatcher can validate it.
+func (s *Server) RegisterCommand(name string, handler CommandHandler, opts ...CommandOption) error {
 	if name == "" || handler == nil {
 		return fmt.Errorf("empty command name")
 	}
+	entry := &commandEntry{handler: handler}
+	for _, opt := range opts {
+		opt(entry)
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.handlers[strings.ToUpper(name)] = handler
+	s.editCommands(func(t commandTable) {
+		t.set(strings.ToUpper(name), entry)
+	})
 	return nil
 }
 
 // RegisterCommandFunc registers a function as a command handler
-func (s *Server) RegisterCommandFunc(name string, handler func(*Connection, *Command) RedisValue) error {
+func (s *Server) RegisterCommandFunc(name string, handler func(*Connection, *Command) RedisValue, opts ...CommandOption) error {
 	if name == "" || handler == nil {
 		return fmt.Errorf("empty command name")
 	}
-	return s.RegisterCommand(name, CommandHandlerFunc(handler))
+	return s.RegisterCommand(name, CommandHandlerFunc(handler), opts...)
+}
+
+// RegisterCommandE registers a handler that reports failures as an error
+// instead of building an error reply. It gets the command's context. A
+// returned *RedisError is sent to the client as-is; any other error is sent
+// with the ERR prefix, logged and passed to the OnError hooks.
+func (s *Server) RegisterCommandE(name string, handler func(ctx context.Context, conn *Connection, cmd *Command) (RedisValue, error), opts ...CommandOption) error {
+	if name == "" || handler == nil {
+		return fmt.Errorf("empty command name")
+	}
+	return s.RegisterCommandFunc(name, func(conn *Connection, cmd *Command) RedisValue {
+		value, err := handler(cmd.Context(), conn, cmd)
+		if err != nil {
+			return s.handlerError(conn, cmd, err)
+		}
+		return value
+	}, opts...)
+}
+
+// handlerError converts an error returned by a handler into its reply
+func (s *Server) handlerError(conn *Connection, cmd *Command, err error) RedisValue {
+	var redisErr *RedisError
+	if !errors.As(err, &redisErr) {
+		s.logConn(LogLevelError, conn, "Command failed", slog.String("cmd", cmd.Name), errAttr(err))
+		s.reportError(conn, ErrorPhaseHandler, err)
+	}
+	return ErrorValue(err)
 }
 
 // Use adds a middleware to the server's middleware chain
@@ -82,24 +161,55 @@ func (s *Server) UseFunc(fn func(*Connection, *Command, CommandHandler) RedisVal
 	s.Use(MiddlewareFunc(fn))
 }
 
-// Listen starts listening on the configured address
+// Listen starts listening on the configured address, or on the socket inherited
+// from a parent process when started by Restart
 func (s *Server) Listen() error {
-	var err error
-	if s.TLSConfig != nil {
-		s.listener, err = tls.Listen("tcp", s.Address, s.TLSConfig)
-	} else {
-		s.listener, err = net.Listen("tcp", s.Address)
+	listener, err := inheritedListener()
+	if err != nil {
+		return err
 	}
 
-	if err != nil {
-		return fmt.Errorf("failed to listen on %s: %w", s.Address, err)
+	if listener != nil {
+		s.logger().Info("Server listening on inherited socket %s", listener.Addr())
+	} else {
+		listener, err = net.Listen("tcp", s.Address)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", s.Address, err)
+		}
+		s.logger().Info("Server listening on %s", s.Address)
 	}
 
-	s.Logger.Info("Server listening on %s", s.Address)
+	s.netListener = listener
+	s.listener = s.wrapTLS(listener)
+	s.listening.Store(true)
+
+	if s.AdminAddress != "" {
+		if err := s.startAdmin(); err != nil {
+			s.listener.Close()
+			return err
+		}
+	}
 	return nil
 }
 
-// Serve starts accepting connections (blocking)
+// wrapTLS wraps listener with TLS when the server has a TLS configuration
+func (s *Server) wrapTLS(listener net.Listener) net.Listener {
+	if s.TLSConfig != nil {
+		return tls.NewListener(listener, s.TLSConfig)
+	}
+	return listener
+}
+
+// Accept error backoff bounds
+const (
+	minAcceptDelay = 5 * time.Millisecond
+	maxAcceptDelay = time.Second
+)
+
+// Serve starts accepting connections (blocking). Temporary accept errors, such
+// as running out of file descriptors, are retried with exponential backoff; if
+// the listener fails permanently, the OnListenerError hooks run and the error
+// is returned.
 func (s *Server) Serve() error {
 	if s.listener == nil {
 		if err := s.Listen(); err != nil {
@@ -109,24 +219,52 @@ func (s *Server) Serve() error {
 
 	defer s.listener.Close()
 
+	var acceptDelay time.Duration
 	for {
 		conn, err := s.listener.Accept()
 		if err != nil {
-			if s.inShutdown.Load() {
+			if s.inShutdown.Load() || s.draining.Load() {
+				return nil
+			}
+			s.stats.acceptErrors.Add(1)
+
+			if errors.Is(err, net.ErrClosed) {
+				s.logger().Error("Listener failed: %v", err)
+				s.runListenerErrorHooks(err)
+				return err
+			}
+
+			if acceptDelay == 0 {
+				acceptDelay = minAcceptDelay
+			} else if acceptDelay *= 2; acceptDelay > maxAcceptDelay {
+				acceptDelay = maxAcceptDelay
+			}
+			s.logger().Error("Accept error: %v; retrying in %v", err, acceptDelay)
+			select {
+			case <-time.After(acceptDelay):
+			case <-s.ctx.Done():
 				return nil
 			}
-			s.Logger.Error("Accept error: %v", err)
+			continue
+		}
+		acceptDelay = 0
+
+		if !s.acceptConn(conn.RemoteAddr()) {
+			s.logger().Warn("Rejected connection from %s by access rules", conn.RemoteAddr())
+			s.stats.rejectedConnections.Add(1)
+			conn.Close()
 			continue
 		}
 
 		shouldHandle := true
 
-		if s.MaxConnections > 0 {
+		if maxConns := s.maxConnections(); maxConns > 0 {
 			for {
 				current := s.connCount.Load()
-				if current >= int64(s.MaxConnections) {
-					conn.Close()
-					s.Logger.Warn("Connection limit reached, rejecting connection from %s", conn.RemoteAddr())
+				if current >= int64(maxConns) {
+					s.logger().Warn("Connection limit reached, rejecting connection from %s", conn.RemoteAddr())
+					s.stats.rejectedConnections.Add(1)
+					s.rejectWithError(conn, maxClientsError)
 					shouldHandle = false
 					break
 				}
@@ -151,42 +289,145 @@ func (s *Server) Serve() error {
 	}
 }
 
-// Shutdown gracefully shuts down the server
+// ListenAndServe listens on addr and serves connections until the server is shut
+// down. An empty addr uses the configured Address.
+func (s *Server) ListenAndServe(addr string) error {
+	if addr != "" {
+		s.Address = addr
+	}
+	if err := s.Listen(); err != nil {
+		return err
+	}
+	return s.Serve()
+}
+
+// ListenAndServeTLS is like ListenAndServe but serves TLS using the certificate
+// and key files, which can later be reloaded with ReloadTLS or WatchTLS
+func (s *Server) ListenAndServeTLS(addr, certFile, keyFile string) error {
+	if err := s.SetTLSCertFiles(certFile, keyFile); err != nil {
+		return err
+	}
+	return s.ListenAndServe(addr)
+}
+
+// ListenAndServe creates a server for addr, lets setup register its commands
+// and middleware, and serves until the server is shut down:
+//
+//	redkit.ListenAndServe(":6379", func(s *redkit.Server) {
+//		s.RegisterCommandFunc("HELLO", helloHandler)
+//	})
+func ListenAndServe(addr string, setup func(*Server), opts ...Option) error {
+	server := NewServer(addr, opts...)
+	if setup != nil {
+		setup(server)
+	}
+	return server.ListenAndServe("")
+}
+
+// Drain stops accepting new connections and waits until no command is being
+// processed, or until ctx is done. Existing connections stay open, so clients
+// get the replies to commands already in flight; if DrainReject is set, commands
+// arriving after Drain is called are answered with "-ERR server shutting down".
+// Serve returns nil once the listener is closed. Call Shutdown afterwards to
+// close the remaining connections.
+func (s *Server) Drain(ctx context.Context) error {
+	s.draining.Store(true)
+	if err := s.closeListener(); err != nil {
+		return err
+	}
+	return s.waitInFlight(ctx)
+}
+
+// IsDraining reports whether Drain or Shutdown has been called
+func (s *Server) IsDraining() bool {
+	return s.draining.Load() || s.inShutdown.Load()
+}
+
+// rejectCommands reports whether new commands must be refused instead of run
+func (s *Server) rejectCommands() bool {
+	return s.inShutdown.Load() || (s.DrainReject && s.draining.Load())
+}
+
+// closeListener closes the listener, ignoring a listener that is already closed
+func (s *Server) closeListener() error {
+	if s.listener == nil {
+		return nil
+	}
+	if err := s.listener.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+// waitInFlight blocks until no command is in progress or ctx is done
+func (s *Server) waitInFlight(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for s.inFlight.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// Shutdown gracefully shuts down the server. It stops accepting connections,
+// lets commands already in flight finish (until ctx is done), rejects new ones,
+// closes every connection and then runs the shutdown hooks in reverse order of
+// registration. Every step is attempted even if an earlier one fails; the
+// returned error joins all failures, including ctx expiring.
 func (s *Server) Shutdown(ctx context.Context) error {
 	s.inShutdown.Store(true)
-	s.cancel()
+
+	var errs []error
 
 	// Close listener
-	if s.listener != nil {
-		err := s.listener.Close()
-		if err != nil {
-			return err
-		}
+	if err := s.closeListener(); err != nil {
+		errs = append(errs, fmt.Errorf("closing listener: %w", err))
+	}
+
+	// Let in-flight commands write their replies; on timeout they are cut off
+	if err := s.waitInFlight(ctx); err != nil {
+		s.logger().Warn("Shutdown deadline reached with %d commands in flight", s.inFlight.Load())
 	}
+	s.cancel()
 
 	// Close all active connections
 	s.mu.RLock()
 	conns := make([]*Connection, 0, len(s.activeConns))
-	for conn := range s.activeConns {
+	for _, conn := range s.activeConns {
 		conns = append(conns, conn)
 	}
 	s.mu.RUnlock()
 
-	var firstErr error
 	for _, conn := range conns {
-		if err := conn.Close(); err != nil && firstErr == nil {
-			firstErr = err
-			s.Logger.Warn("Error closing connection during shutdown: %v", err)
+		if err := conn.closeWithReason(ErrServerClosed); err != nil && !errors.Is(err, net.ErrClosed) {
+			s.logger().Warn("Error closing connection during shutdown: %v", err)
+			errs = append(errs, fmt.Errorf("closing connection %d: %w", conn.ID(), err))
 		}
 	}
 
-	// Run shutdown hooks
-	s.mu.Lock()
-	for _, fn := range s.onShutdown {
-		fn()
+	if err := s.stopAdmin(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("stopping admin endpoint: %w", err))
 	}
+
+	// Run shutdown hooks, last registered first. They only run once even if
+	// Shutdown is called again.
+	s.mu.Lock()
+	hooks := s.onShutdown
+	s.onShutdown = nil
 	s.mu.Unlock()
 
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := runShutdownHook(ctx, hooks[i]); err != nil {
+			s.logger().Warn("Shutdown hook failed: %v", err)
+			errs = append(errs, err)
+		}
+	}
+
 	// Wait for all connections to finish
 	done := make(chan struct{})
 	go func() {
@@ -196,10 +437,50 @@ func (s *Server) Shutdown(ctx context.Context) error {
 
 	select {
 	case <-ctx.Done():
-		return ctx.Err()
+		errs = append(errs, ctx.Err())
 	case <-done:
-		return firstErr
 	}
+	return errors.Join(errs...)
+}
+
+// runShutdownHook calls fn, turning a panic into an error so later hooks still run
+func runShutdownHook(ctx context.Context, fn func(context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("shutdown hook panicked: %v", r)
+		}
+	}()
+	return fn(ctx)
+}
+
+// commandContext derives the context of a command from its connection
+func (s *Server) commandContext(conn *Connection) (context.Context, context.CancelCauseFunc) {
+	ctx, cancel := context.WithCancelCause(conn.ctx)
+	if s.CommandTimeout <= 0 {
+		return ctx, cancel
+	}
+	timeoutCtx, cancelTimeout := context.WithTimeout(ctx, s.CommandTimeout)
+	return timeoutCtx, func(cause error) {
+		cancel(cause)
+		cancelTimeout()
+	}
+}
+
+// maxClientsError is sent to clients connecting while MaxConnections is reached
+const maxClientsError = "-ERR max number of clients reached\r\n"
+
+// rejectWithError writes a raw error reply to a connection that will not be
+// served and closes it. It runs in its own goroutine so slow clients (or a
+// TLS handshake) can't stall the accept loop.
+func (s *Server) rejectWithError(conn net.Conn, reply string) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer conn.Close()
+
+		conn.SetDeadline(time.Now().Add(time.Second))
+		conn.Write([]byte(reply))
+	}()
 }
 
 // handleConnectionInternal handles a single client connection
@@ -209,99 +490,258 @@ func (s *Server) handleConnectionInternal(netConn net.Conn) {
 	defer cancel()
 
 	conn := &Connection{
+		id:       s.nextConnID.Add(1),
 		conn:     netConn,
-		reader:   bufio.NewReader(netConn),
-		writer:   bufio.NewWriter(netConn),
 		server:   s,
 		ctx:      ctx,
 		cancel:   cancel,
 		lastUsed: time.Now(),
+		created:  time.Now(),
+	}
+
+	var reader io.Reader = netConn
+	var writer io.Writer = netConn
+	if s.ProtocolTrace != nil {
+		reader = &traceIO{server: s, conn: conn, direction: traceInbound, reader: reader}
+		writer = &traceIO{server: s, conn: conn, direction: traceOutbound, writer: writer}
 	}
+	conn.reader = bufio.NewReader(&countingIO{reader: reader, counter: &s.stats.bytesIn})
+	conn.writer = bufio.NewWriter(&countingIO{writer: writer, counter: &s.stats.bytesOut})
+	s.stats.totalConnections.Add(1)
 
 	conn.setState(StateNew)
 
 	s.mu.Lock()
-	s.activeConns[conn] = struct{}{}
+	s.activeConns[conn.id] = conn
 	s.mu.Unlock()
 
 	defer func() {
-		conn.Close()
+		conn.closeWithReason(net.ErrClosed)
+		s.tracking.remove(conn)
+		s.watches.unwatch(conn)
+		s.pubsub.remove(conn)
 		s.mu.Lock()
-		delete(s.activeConns, conn)
+		delete(s.activeConns, conn.id)
 		s.mu.Unlock()
+		s.runDisconnectHooks(conn)
 	}()
 
+	if err := s.verifyTLSClient(conn); err != nil {
+		s.logConn(LogLevelWarn, conn, "Rejected TLS connection", errAttr(err))
+		conn.setCloseReason(err)
+		s.stats.rejectedConnections.Add(1)
+		conn.WriteValue(ErrorValue(err))
+		return
+	}
+
+	if err := s.runConnectHooks(conn); err != nil {
+		s.logConn(LogLevelDebug, conn, "Connection rejected by OnConnect", errAttr(err))
+		conn.setCloseReason(err)
+		s.stats.rejectedConnections.Add(1)
+		conn.WriteValue(ErrorValue(err))
+		return
+	}
+
 	conn.setState(StateActive)
 
-	s.Logger.Debug("New connection from %s", netConn.RemoteAddr())
+	s.logConn(LogLevelDebug, conn, "New connection")
 
 	for {
 		select {
 		case <-ctx.Done():
+			conn.setCloseReason(ErrServerClosed)
 			return
 		default:
 		}
 
-		if s.ReadTimeout > 0 {
-			if err := netConn.SetReadDeadline(time.Now().Add(s.ReadTimeout)); err != nil {
-				s.Logger.Error("Failed to set read deadline: %v", err)
+		if timeout := s.readTimeout(); timeout > 0 {
+			if err := netConn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+				s.logConn(LogLevelError, conn, "Failed to set read deadline", errAttr(err))
+				conn.setCloseReason(err)
 				return
 			}
 		}
 
 		cmd, err := conn.readCommand()
 		if err != nil {
+			var protoErr *ProtocolError
+			isProtoErr := errors.As(err, &protoErr)
+			if isProtoErr {
+				s.reportError(conn, ErrorPhaseProtocol, err)
+			}
+			if s.StrictProtocol && isProtoErr {
+				s.logConn(LogLevelDebug, conn, "Protocol error", errAttr(err))
+				if !s.replyProtocolError(conn, protoErr) || protoErr.Fatal {
+					conn.setCloseReason(err)
+					return
+				}
+				continue
+			}
+
 			errStr := err.Error()
 			if err == io.EOF || strings.Contains(errStr, "use of closed network connection") {
-				s.Logger.Debug("Connection closed by %s", netConn.RemoteAddr())
+				s.logConn(LogLevelDebug, conn, "Connection closed by client")
 			} else {
-				s.Logger.Error("Error reading command from %s: %v", netConn.RemoteAddr(), err)
+				s.logConn(LogLevelError, conn, "Error reading command", errAttr(err))
+				if !isProtoErr {
+					s.reportError(conn, ErrorPhaseRead, err)
+				}
 			}
+			conn.setCloseReason(err)
 			return
 		}
 
 		conn.mu.Lock()
 		conn.lastUsed = time.Now()
+		conn.lastCommand = strings.ToLower(cmd.Name)
 		conn.mu.Unlock()
 
-		s.Logger.Debug("Command from %s: %s %v", netConn.RemoteAddr(), cmd.Name, cmd.Args)
+		// Paused clients don't count as in flight, so Drain and Shutdown
+		// don't wait for a pause to end
+		s.waitIfPaused(conn, cmd)
+
+		s.inFlight.Add(1)
+		if s.rejectCommands() {
+			ok := s.writeReply(conn, NewError(ErrPrefixGeneric, "server shutting down").Value())
+			s.inFlight.Add(-1)
+			if !ok {
+				return
+			}
+			continue
+		}
 
 		conn.setState(StateProcessing)
+		conn.streamed = false
+		start := time.Now()
+		cmdCtx, cancelCmd := s.commandContext(conn)
+		cmd.ctx = cmdCtx
+		var stopWatch func()
+		if s.CancelOnDisconnect && conn.reader.Buffered() == 0 {
+			stopWatch = conn.watchDisconnect(cancelCmd)
+		}
 		response := s.handleCommand(conn, cmd)
-		conn.setState(StateActive)
+		if stopWatch != nil {
+			stopWatch()
+		}
+		cancelCmd(nil)
+		conn.commands.Add(1)
+		s.stats.commandsProcessed.Add(1)
+		if response.Type == ErrorReply {
+			s.stats.errorReplies.Add(1)
+		}
+		s.logConn(LogLevelDebug, conn, "Command",
+			slog.String("cmd", cmd.Name), slog.Int("args", len(cmd.Args)), slog.Duration("duration", time.Since(start)))
+		conn.setState(conn.restingState())
+
+		// A handler returning with an unfinished ArrayWriter leaves the stream
+		// unframed; Close releases the writer and drops the connection
+		if conn.arrayWriter != nil {
+			if err := conn.arrayWriter.Close(); err != nil {
+				s.logConn(LogLevelError, conn, "Incomplete streamed reply", slog.String("cmd", cmd.Name), errAttr(err))
+				conn.setCloseReason(err)
+			}
+			s.inFlight.Add(-1)
+			return
+		}
+
+		ok := s.writeReply(conn, response)
+		s.inFlight.Add(-1)
+		if !ok {
+			return
+		}
+		if conn.closeAfterReply.Load() {
+			conn.writeMu.Lock()
+			conn.writer.Flush()
+			conn.writeMu.Unlock()
+			conn.setCloseReason(ErrClientKilled)
+			return
+		}
+	}
+}
+
+// writeReply writes the reply to a command, reporting whether the connection is still usable
+func (s *Server) writeReply(conn *Connection, response RedisValue) bool {
+	conn.writeMu.Lock()
+	defer conn.writeMu.Unlock()
 
-		if s.WriteTimeout > 0 {
-			err := netConn.SetWriteDeadline(time.Now().Add(s.WriteTimeout))
+	netConn := conn.conn
+
+	// Handlers streaming through an ArrayWriter have already written their
+	// reply, and replies turned off with CLIENT REPLY are dropped
+	if !conn.streamed && !conn.suppressReply() {
+		if timeout := s.writeTimeout(); timeout > 0 {
+			err := netConn.SetWriteDeadline(time.Now().Add(timeout))
 			if err != nil {
-				return
+				return false
 			}
 		}
 
 		if err := conn.writeValue(response); err != nil {
+			conn.setCloseReason(err)
 			if strings.Contains(err.Error(), "use of closed network connection") {
-				s.Logger.Debug("Connection closed while writing to %s", netConn.RemoteAddr())
+				s.logConn(LogLevelDebug, conn, "Connection closed while writing")
 			} else {
-				s.Logger.Error("Error writing response to %s: %v", netConn.RemoteAddr(), err)
+				s.logConn(LogLevelError, conn, "Error writing response", errAttr(err))
+				s.reportError(conn, ErrorPhaseWrite, err)
 			}
-			return
+			return false
 		}
+	}
 
-		if err := conn.writer.Flush(); err != nil {
-			if strings.Contains(err.Error(), "use of closed network connection") {
-				s.Logger.Debug("Connection closed while flushing to %s", netConn.RemoteAddr())
-			} else {
-				s.Logger.Error("Error flushing response to %s: %v", netConn.RemoteAddr(), err)
-			}
-			return
+	// Pipelined clients send several commands at once; keep serving them from
+	// the read buffer and flush all replies together once no complete command
+	// is left. A command that then blocks or is paused flushes before waiting.
+	if conn.commandBuffered() {
+		return true
+	}
+
+	if err := conn.writer.Flush(); err != nil {
+		conn.setCloseReason(err)
+		if strings.Contains(err.Error(), "use of closed network connection") {
+			s.logConn(LogLevelDebug, conn, "Connection closed while flushing")
+		} else {
+			s.logConn(LogLevelError, conn, "Error flushing response", errAttr(err))
+			s.reportError(conn, ErrorPhaseWrite, err)
+		}
+		return false
+	}
+	return true
+}
+
+// replyProtocolError sends a protocol error reply, reporting whether it was delivered
+func (s *Server) replyProtocolError(conn *Connection, protoErr *ProtocolError) bool {
+	conn.writeMu.Lock()
+	defer conn.writeMu.Unlock()
+
+	if timeout := s.writeTimeout(); timeout > 0 {
+		if err := conn.conn.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+			return false
 		}
 	}
+	if err := conn.writeValue(RedisValue{Type: ErrorReply, Str: "ERR " + protoErr.Error()}); err != nil {
+		return false
+	}
+	return conn.writer.Flush() == nil
 }
 
 // handleCommand processes a Redis command
-func (s *Server) handleCommand(conn *Connection, cmd *Command) RedisValue {
+func (s *Server) handleCommand(conn *Connection, cmd *Command) (result RedisValue) {
+	// Deferred first so the AfterCommand hooks see the reply to a panic
+	if after := s.runBeforeCommandHooks(conn, cmd); after != nil {
+		defer func() { after(result) }()
+	}
 	defer func() {
 		if r := recover(); r != nil {
-			s.Logger.Error("PANIC in command handler '%s': %v", cmd.Name, r)
+			// Handlers may abort with a *RedisError to reply with that error
+			if redisErr, ok := r.(*RedisError); ok {
+				result = redisErr.Value()
+				return
+			}
+			panicErr := &PanicError{Command: cmd.Name, Value: r, Stack: debug.Stack()}
+			s.logConn(LogLevelError, conn, "Panic in command handler", slog.String("cmd", cmd.Name), slog.Any("panic", r), slog.String("stack", string(panicErr.Stack)))
+			s.runPanicHooks(conn, cmd, panicErr)
+			s.reportError(conn, ErrorPhaseHandler, panicErr)
+			result = errInternal.Value()
 		}
 	}()
 
@@ -312,28 +752,114 @@ func (s *Server) handleCommand(conn *Connection, cmd *Command) RedisValue {
 		}
 	}
 
-	s.mu.RLock()
-	handler, exists := s.handlers[strings.ToUpper(cmd.Name)]
-	s.mu.RUnlock()
-
+	name, entry, exists := s.handlerTable().lookup(cmd.Name)
 	if !exists {
-		return RedisValue{
-			Type: ErrorReply,
-			Str:  fmt.Sprintf("ERR unknown command '%s'", cmd.Name),
+		return conn.rejectQueued(UnknownCommand(cmd.Name, cmd.Args).Value())
+	}
+	if entry.disabled.Load() {
+		return conn.rejectQueued(commandDisabled(cmd.Name).Value())
+	}
+
+	counter := s.stats.command(name)
+	start := time.Now()
+	queued := false
+	defer func() {
+		if !queued {
+			counter.record(time.Since(start), result.Type == ErrorReply)
+		}
+	}()
+
+	if entry.arity != nil && !entry.arity.Accepts(len(cmd.Args)) {
+		return conn.rejectQueued(WrongArity(cmd.Name).Value())
+	}
+	if s.requiresAuth(conn, entry, name) {
+		return conn.rejectQueued(NoAuth().Value())
+	}
+	if conn != nil && conn.IsSubscribed() && conn.Protocol() < RESP3 {
+		if _, ok := pubsubCommands[name]; !ok {
+			return conn.rejectQueued(subscribedError(cmd.Name))
+		}
+	}
+	if conn != nil && conn.HasFlag(FlagReadOnly) && entry.isWrite(name) {
+		return conn.rejectQueued(ReadOnly().Value())
+	}
+	if conn.queueCommand(name, cmd) {
+		queued = true
+		return RedisValue{Type: SimpleString, Str: "QUEUED"}
+	}
+	if entry.limit != nil {
+		if err := entry.limit.acquire(cmd); err != nil {
+			return err.Value()
+		}
+		defer entry.limit.release()
+	}
+	// Commands wait while a transaction runs, except those it runs itself
+	if !entry.exclusive && (conn == nil || !conn.inExec) {
+		locked, err := s.lockShared(name, cmd)
+		if err != nil {
+			return err.Value()
+		}
+		if locked {
+			defer s.execMu.RUnlock()
+			if conn != nil {
+				conn.execLocked = true
+				defer func() { conn.execLocked = false }()
+			}
 		}
 	}
 
+	if conn != nil {
+		// Restored for the EXEC or script running this command
+		outer := conn.running
+		conn.running = name
+		defer func() { conn.running = outer }()
+	}
+
 	// Execute through middleware chain
-	return s.middlewareChain.Execute(conn, cmd, handler)
+	reply := s.middlewareChain.Execute(conn, cmd, s.scopedHandler(entry, name))
+	if entry.info.Deprecated {
+		reply = s.deprecationNotice(conn, name, entry.info.ReplacedBy, reply)
+	}
+	return reply
 }
 
 // OnShutdown registers a function to call on shutdown
 func (s *Server) OnShutdown(f func()) {
+	s.OnShutdownContext(func(context.Context) error {
+		f()
+		return nil
+	})
+}
+
+// OnShutdownContext registers a function to call on shutdown with the context
+// passed to Shutdown. Hooks run in reverse order of registration, like defers,
+// and errors they return are included in the error returned by Shutdown.
+func (s *Server) OnShutdownContext(f func(ctx context.Context) error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.onShutdown = append(s.onShutdown, f)
 }
 
+// GetConnection returns the open connection with the given ID, or nil if there is none
+func (s *Server) GetConnection(id uint64) *Connection {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.activeConns[id]
+}
+
+// Connections returns a snapshot of the open connections, ordered by ID
+func (s *Server) Connections() []*Connection {
+	s.mu.RLock()
+	conns := make([]*Connection, 0, len(s.activeConns))
+	for _, conn := range s.activeConns {
+		conns = append(conns, conn)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(conns, func(i, j int) bool { return conns[i].id < conns[j].id })
+	return conns
+}
+
 // GetActiveConnections returns the number of active connections
 func (s *Server) GetActiveConnections() int64 {
 	return s.connCount.Load()
@@ -372,16 +898,17 @@ func (s *Server) startIdleChecker() {
 
 // checkIdleConnections checks all active connections for idle timeout
 func (s *Server) checkIdleConnections() {
-	if s.IdleTimeout <= 0 {
+	idleTimeout := s.idleTimeout()
+	if idleTimeout <= 0 {
 		return // Idle timeout disabled
 	}
 
 	now := time.Now()
-	idleThreshold := now.Add(-s.IdleTimeout)
+	idleThreshold := now.Add(-idleTimeout)
 
 	s.mu.RLock()
 	connsToCheck := make([]*Connection, 0, len(s.activeConns))
-	for conn := range s.activeConns {
+	for _, conn := range s.activeConns {
 		connsToCheck = append(connsToCheck, conn)
 	}
 	s.mu.RUnlock()
@@ -401,9 +928,35 @@ func (s *Server) checkIdleConnections() {
 	}
 
 	for _, conn := range idleConns {
-		s.Logger.Info("Closing idle connection %s", conn.RemoteAddr())
-		conn.Close()
+		s.closeIdle(conn)
+	}
+}
+
+// idleGoodbye is sent to idle clients before they are disconnected when IdleGoodbye is set
+var idleGoodbye = NewError(ErrPrefixGeneric, "idle timeout, closing connection").Value()
+
+// closeIdle disconnects a connection that exceeded the idle timeout, first
+// telling the client why if IdleGoodbye is set
+func (s *Server) closeIdle(conn *Connection) {
+	s.logConn(LogLevelInfo, conn, "Closing idle connection")
+	if !s.IdleGoodbye {
+		conn.closeWithReason(ErrIdleTimeout)
+		return
 	}
+
+	conn.setCloseReason(ErrIdleTimeout)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer conn.Close()
+
+		conn.writeMu.Lock()
+		defer conn.writeMu.Unlock()
+		conn.conn.SetWriteDeadline(time.Now().Add(time.Second))
+		if conn.writeValue(idleGoodbye) == nil {
+			conn.writer.Flush()
+		}
+	}()
 }
 
 // setConnectionActive sets a connection to active state
@@ -411,8 +964,5 @@ func (s *Server) setConnectionActive(conn *Connection) {
 	currentState := ConnState(conn.state.Load())
 	if currentState == StateIdle {
 		conn.setState(StateActive)
-		if s.ConnStateHook != nil {
-			s.ConnStateHook(conn.conn, StateActive)
-		}
 	}
 }
@@ -0,0 +1,585 @@
+package redkit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startTestServer starts a server built from config on a free port and returns it with its address
+func startTestServer(t *testing.T, config *ServerConfig) (*Server, string) {
+	t.Helper()
+	port, err := getFreePort()
+	if err != nil {
+		t.Fatalf("Failed to get free port: %v", err)
+	}
+
+	if config == nil {
+		config = DefaultServerConfig()
+	}
+	config.Address = fmt.Sprintf("127.0.0.1:%d", port)
+	config.Logger = NewDefaultLogger(nil, LogLevelOff)
+
+	server := NewServerWithConfig(config)
+	if err := server.Listen(); err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go server.Serve()
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	})
+
+	return server, config.Address
+}
+
+// rawClient is a minimal RESP client for tests that need to see the exact wire format
+type rawClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dialRaw(t *testing.T, address string) *rawClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatalf("Failed to dial %s: %v", address, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return &rawClient{conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// send writes a command encoded as a RESP array of bulk strings
+func (c *rawClient) send(t *testing.T, args ...string) {
+	t.Helper()
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := c.conn.Write([]byte(b.String())); err != nil {
+		t.Fatalf("Failed to write command: %v", err)
+	}
+}
+
+// sendRaw writes data to the connection as-is
+func (c *rawClient) sendRaw(t *testing.T, data string) {
+	t.Helper()
+	if _, err := c.conn.Write([]byte(data)); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+}
+
+// expectClosed asserts that the server closed the connection
+func (c *rawClient) expectClosed(t *testing.T) {
+	t.Helper()
+	if line, err := c.reader.ReadString('\n'); err == nil {
+		t.Errorf("Expected connection to be closed, got reply %q", line)
+	}
+}
+
+// readLine reads a single CRLF-terminated reply line
+func (c *rawClient) readLine(t *testing.T) string {
+	t.Helper()
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("Failed to read reply: %v", err)
+	}
+	return strings.TrimSuffix(line, "\r\n")
+}
+
+// lockedBuffer is a bytes.Buffer safe for concurrent use
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// TestProtocolTrace tests that inbound and outbound frames are dumped with the connection ID
+func TestProtocolTrace(t *testing.T) {
+	trace := &lockedBuffer{}
+	config := DefaultServerConfig()
+	config.ProtocolTrace = trace
+	_, address := startTestServer(t, config)
+
+	client := dialRaw(t, address)
+	client.send(t, "PING")
+	if reply := client.readLine(t); reply != "+PONG" {
+		t.Fatalf("Expected +PONG, got %s", reply)
+	}
+
+	output := trace.String()
+	if !strings.Contains(output, `conn=1 `) {
+		t.Errorf("Expected connection ID in trace, got:\n%s", output)
+	}
+	if !strings.Contains(output, `<- "*1\r\n$4\r\nPING\r\n"`) {
+		t.Errorf("Expected inbound PING frame in trace, got:\n%s", output)
+	}
+	if !strings.Contains(output, `-> "+PONG\r\n"`) {
+		t.Errorf("Expected outbound PONG frame in trace, got:\n%s", output)
+	}
+}
+
+// TestStrictProtocol tests error replies for malformed frames in strict mode
+func TestStrictProtocol(t *testing.T) {
+	config := DefaultServerConfig()
+	config.StrictProtocol = true
+	_, address := startTestServer(t, config)
+
+	t.Run("Recoverable error keeps the connection", func(t *testing.T) {
+		client := dialRaw(t, address)
+		client.sendRaw(t, "*2\r\n$4\r\nECHO\r\n:abc\r\n")
+		if reply := client.readLine(t); !strings.HasPrefix(reply, "-ERR Protocol error: invalid integer") {
+			t.Errorf("Expected protocol error reply, got %s", reply)
+		}
+
+		client.sendRaw(t, "*2\r\n$4\r\nECHO\r\n!oops\r\n")
+		if reply := client.readLine(t); !strings.HasPrefix(reply, "-ERR Protocol error: invalid RESP protocol indicator") {
+			t.Errorf("Expected protocol error reply, got %s", reply)
+		}
+
+		client.send(t, "PING")
+		if reply := client.readLine(t); reply != "+PONG" {
+			t.Errorf("Expected +PONG after recoverable error, got %s", reply)
+		}
+	})
+
+	t.Run("Fatal error closes the connection", func(t *testing.T) {
+		client := dialRaw(t, address)
+		client.sendRaw(t, "*1\r\n$abc\r\n")
+		if reply := client.readLine(t); !strings.HasPrefix(reply, "-ERR Protocol error: invalid bulk string size") {
+			t.Errorf("Expected protocol error reply, got %s", reply)
+		}
+		client.expectClosed(t)
+	})
+}
+
+// TestNonStrictProtocolCloses tests that malformed frames close the connection by default
+func TestNonStrictProtocolCloses(t *testing.T) {
+	_, address := startTestServer(t, nil)
+
+	client := dialRaw(t, address)
+	client.sendRaw(t, "*2\r\n$4\r\nECHO\r\n:abc\r\n")
+	client.expectClosed(t)
+}
+
+// TestArrayWriter tests streaming an array reply element by element
+// TestPipelinedRepliesFlushed tests that replies held back for pipelined
+// commands are sent once the next command can't be served right away
+func TestPipelinedRepliesFlushed(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		data  string
+		want  string
+		setup func(*Server)
+	}{
+		{
+			name: "partial command",
+			data: "*1\r\n$4\r\nPING\r\n*1\r\n$4\r\nPI",
+			want: "+PONG",
+		},
+		{
+			name: "blocking command",
+			data: "*3\r\n$3\r\nSET\r\n$1\r\na\r\n$1\r\n1\r\n*3\r\n$5\r\nBLPOP\r\n$1\r\nx\r\n$1\r\n1\r\n",
+			want: "+OK",
+		},
+		{
+			name:  "paused command",
+			data:  "*2\r\n$3\r\nGET\r\n$1\r\na\r\n*3\r\n$3\r\nSET\r\n$1\r\na\r\n$1\r\n1\r\n",
+			want:  "$-1",
+			setup: func(s *Server) { s.Pause(2*time.Second, true) },
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server, address := startTestServer(t, nil)
+			server.EnableBuiltinStore()
+			if tc.setup != nil {
+				tc.setup(server)
+				defer server.Unpause()
+			}
+
+			client := dialRaw(t, address)
+			client.sendRaw(t, tc.data)
+			// Well before BLPOP times out or the pause ends
+			client.conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+			if line := client.readLine(t); line != tc.want {
+				t.Fatalf("Expected %q, got %q", tc.want, line)
+			}
+		})
+	}
+}
+
+func TestArrayWriter(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	server.RegisterCommandFunc("STREAM", func(conn *Connection, cmd *Command) RedisValue {
+		w, err := conn.ArrayWriter(3)
+		if err != nil {
+			return ErrorValue(err)
+		}
+		for i := 0; i < 3; i++ {
+			if err := w.Write(RedisValue{Type: Integer, Int: int64(i)}); err != nil {
+				return ErrorValue(err)
+			}
+		}
+		w.Close()
+		return RedisValue{Type: SimpleString, Str: "ignored"}
+	})
+
+	client := dialRaw(t, address)
+	client.send(t, "STREAM")
+	for _, expected := range []string{"*3", ":0", ":1", ":2"} {
+		if reply := client.readLine(t); reply != expected {
+			t.Errorf("Expected %s, got %s", expected, reply)
+		}
+	}
+
+	client.send(t, "PING")
+	if reply := client.readLine(t); reply != "+PONG" {
+		t.Errorf("Expected +PONG after streamed reply, got %s", reply)
+	}
+}
+
+// TestArrayWriterOverflow tests that writing more elements than announced fails
+func TestArrayWriterOverflow(t *testing.T) {
+	conn, out := newTestConnection("")
+	w, err := conn.ArrayWriter(1)
+	if err != nil {
+		t.Fatalf("ArrayWriter failed: %v", err)
+	}
+	if err := w.Write(RedisValue{Type: Integer, Int: 1}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := w.Write(RedisValue{Type: Integer, Int: 2}); err == nil {
+		t.Error("Expected error writing past the announced size")
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+	conn.writer.Flush()
+	if out.String() != "*1\r\n:1\r\n" {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+}
+
+func TestDrainWaitsForInFlightCommands(t *testing.T) {
+	config := DefaultServerConfig()
+	config.DrainReject = true
+	server, address := startTestServer(t, config)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server.RegisterCommandFunc("SLOW", func(conn *Connection, cmd *Command) RedisValue {
+		close(started)
+		<-release
+		return RedisValue{Type: SimpleString, Str: "DONE"}
+	})
+
+	slow := dialRaw(t, address)
+	other := dialRaw(t, address)
+	other.send(t, "PING")
+	if line := other.readLine(t); line != "+PONG" {
+		t.Fatalf("Expected +PONG, got %q", line)
+	}
+
+	slow.send(t, "SLOW")
+	<-started
+
+	drained := make(chan error, 1)
+	go func() { drained <- server.Drain(context.Background()) }()
+
+	select {
+	case err := <-drained:
+		t.Fatalf("Drain returned with a command in flight: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if !server.IsDraining() {
+		t.Fatal("Expected server to report draining")
+	}
+	other.send(t, "PING")
+	if line := other.readLine(t); line != "-ERR server shutting down" {
+		t.Fatalf("Expected shutting down error, got %q", line)
+	}
+	if conn, err := net.DialTimeout("tcp", address, time.Second); err == nil {
+		conn.Close()
+		t.Fatal("Expected new connections to be refused while draining")
+	}
+
+	close(release)
+	if line := slow.readLine(t); line != "+DONE" {
+		t.Fatalf("Expected +DONE, got %q", line)
+	}
+	if err := <-drained; err != nil {
+		t.Fatalf("Drain failed: %v", err)
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	server, address := startTestServer(t, nil)
+
+	release := make(chan struct{})
+	defer close(release)
+	server.RegisterCommandFunc("SLOW", func(conn *Connection, cmd *Command) RedisValue {
+		<-release
+		return RedisValue{Type: SimpleString, Str: "DONE"}
+	})
+
+	client := dialRaw(t, address)
+	client.send(t, "SLOW")
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := server.Drain(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Expected DeadlineExceeded, got %v", err)
+	}
+}
+
+// TestDrainSkipsPausedCommands tests that commands held back by a pause
+// don't count as in flight
+func TestDrainSkipsPausedCommands(t *testing.T) {
+	config := DefaultServerConfig()
+	config.DrainReject = true
+	server, address := startTestServer(t, config)
+	server.Pause(10*time.Second, false)
+
+	client := dialRaw(t, address)
+	client.send(t, "PING")
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := server.Drain(ctx); err != nil {
+		t.Fatalf("Expected Drain not to wait for the paused command, got %v", err)
+	}
+
+	// Once resumed, the command is refused like any other arriving during the drain
+	server.Unpause()
+	if line := client.readLine(t); line != "-ERR server shutting down" {
+		t.Fatalf("Expected shutting down error, got %q", line)
+	}
+}
+
+func TestShutdownHooksRunInReverseOrder(t *testing.T) {
+	server := NewServer("127.0.0.1:0", WithLogger(NewDefaultLogger(nil, LogLevelOff)))
+
+	var order []int
+	hookErr := fmt.Errorf("flush failed")
+	server.OnShutdown(func() { order = append(order, 1) })
+	server.OnShutdownContext(func(ctx context.Context) error {
+		if ctx == nil {
+			t.Error("Expected the shutdown context")
+		}
+		order = append(order, 2)
+		return hookErr
+	})
+	server.OnShutdownContext(func(context.Context) error {
+		order = append(order, 3)
+		panic("boom")
+	})
+
+	err := server.Shutdown(context.Background())
+	if !errors.Is(err, hookErr) {
+		t.Errorf("Expected the hook error to be returned, got %v", err)
+	}
+	if err == nil || !strings.Contains(err.Error(), "panicked") {
+		t.Errorf("Expected the panic to be reported, got %v", err)
+	}
+	if fmt.Sprint(order) != "[3 2 1]" {
+		t.Errorf("Expected hooks to run in LIFO order, got %v", order)
+	}
+
+	// Hooks run only once
+	order = nil
+	server.Shutdown(context.Background())
+	if len(order) != 0 {
+		t.Errorf("Expected hooks not to run again, got %v", order)
+	}
+}
+
+func TestListenAndServe(t *testing.T) {
+	port, err := getFreePort()
+	if err != nil {
+		t.Fatalf("Failed to get free port: %v", err)
+	}
+	address := fmt.Sprintf("127.0.0.1:%d", port)
+
+	ready := make(chan *Server, 1)
+	served := make(chan error, 1)
+	go func() {
+		served <- ListenAndServe(address, func(s *Server) {
+			s.RegisterCommandFunc("HELLO", func(conn *Connection, cmd *Command) RedisValue {
+				return RedisValue{Type: SimpleString, Str: "world"}
+			})
+			ready <- s
+		}, WithLogger(NewDefaultLogger(nil, LogLevelOff)))
+	}()
+	server := <-ready
+
+	var client *rawClient
+	for i := 0; i < 50; i++ {
+		if conn, err := net.Dial("tcp", address); err == nil {
+			conn.Close()
+			client = dialRaw(t, address)
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if client == nil {
+		t.Fatal("Server did not start listening")
+	}
+	client.send(t, "HELLO")
+	if line := client.readLine(t); line != "+world" {
+		t.Fatalf("Expected +world, got %q", line)
+	}
+
+	server.Shutdown(context.Background())
+	if err := <-served; err != nil {
+		t.Errorf("Expected ListenAndServe to return nil after shutdown, got %v", err)
+	}
+}
+
+func TestMaxClientsReply(t *testing.T) {
+	config := DefaultServerConfig()
+	config.MaxConnections = 1
+	server, address := startTestServer(t, config)
+
+	first := dialRaw(t, address)
+	first.send(t, "PING")
+	first.readLine(t)
+
+	second := dialRaw(t, address)
+	if line := second.readLine(t); line != "-ERR max number of clients reached" {
+		t.Fatalf("Expected max clients error, got %q", line)
+	}
+	second.expectClosed(t)
+
+	if rejected := server.Stats().RejectedConnections; rejected != 1 {
+		t.Errorf("Expected 1 rejected connection, got %d", rejected)
+	}
+}
+
+// failingListener returns temporary errors a few times, then fails for good
+type failingListener struct {
+	net.Listener
+	temporary int
+	calls     int
+}
+
+func (l *failingListener) Accept() (net.Conn, error) {
+	l.calls++
+	if l.calls <= l.temporary {
+		return nil, fmt.Errorf("accept: too many open files")
+	}
+	return nil, fmt.Errorf("accept: %w", net.ErrClosed)
+}
+
+func (l *failingListener) Close() error { return nil }
+
+func TestAcceptBackoffAndListenerError(t *testing.T) {
+	server := NewServer("127.0.0.1:0", WithLogger(NewDefaultLogger(nil, LogLevelOff)))
+	defer server.cancel()
+	listener := &failingListener{temporary: 3}
+	server.listener = listener
+
+	var hookErr error
+	server.OnListenerError(func(err error) { hookErr = err })
+
+	start := time.Now()
+	err := server.Serve()
+	if !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("Expected Serve to return the listener error, got %v", err)
+	}
+	if !errors.Is(hookErr, net.ErrClosed) {
+		t.Errorf("Expected OnListenerError to receive the error, got %v", hookErr)
+	}
+	// 5ms + 10ms + 20ms of backoff for the three temporary errors
+	if elapsed := time.Since(start); elapsed < 35*time.Millisecond {
+		t.Errorf("Expected accept retries to back off, took %v", elapsed)
+	}
+	if got := server.Stats().AcceptErrors; got != 4 {
+		t.Errorf("Expected 4 accept errors, got %d", got)
+	}
+}
+
+func TestConnectionRegistry(t *testing.T) {
+	server, address := startTestServer(t, nil)
+
+	var ids []string
+	for i := 0; i < 2; i++ {
+		client := dialRaw(t, address)
+		client.send(t, "CLIENT", "ID")
+		ids = append(ids, strings.TrimPrefix(client.readLine(t), ":"))
+	}
+
+	conns := server.Connections()
+	if len(conns) != 2 {
+		t.Fatalf("Expected 2 connections, got %d", len(conns))
+	}
+	for i, conn := range conns {
+		if fmt.Sprint(conn.ID()) != ids[i] {
+			t.Errorf("Expected connection %d to have ID %s, got %d", i, ids[i], conn.ID())
+		}
+		if server.GetConnection(conn.ID()) != conn {
+			t.Errorf("GetConnection(%d) did not return the connection", conn.ID())
+		}
+	}
+	if server.GetConnection(12345) != nil {
+		t.Error("Expected nil for an unknown ID")
+	}
+}
+
+func TestIdleConnectionsAreClosed(t *testing.T) {
+	for _, goodbye := range []bool{false, true} {
+		config := DefaultServerConfig()
+		config.IdleTimeout = 50 * time.Millisecond
+		config.IdleGoodbye = goodbye
+		server, address := startTestServer(t, config)
+		reasons := make(chan error, 1)
+		server.OnDisconnect(func(conn *Connection, info DisconnectInfo) {
+			reasons <- info.Reason
+		})
+
+		client := dialRaw(t, address)
+		client.send(t, "PING")
+		client.readLine(t)
+		time.Sleep(100 * time.Millisecond)
+		server.TriggerIdleCheck()
+
+		if goodbye {
+			if line := client.readLine(t); line != "-ERR idle timeout, closing connection" {
+				t.Errorf("Expected goodbye error reply, got %q", line)
+			}
+		}
+		client.expectClosed(t)
+		select {
+		case reason := <-reasons:
+			if !errors.Is(reason, ErrIdleTimeout) {
+				t.Errorf("Expected ErrIdleTimeout, got %v", reason)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timed out waiting for the idle connection to close")
+		}
+	}
+}
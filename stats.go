@@ -0,0 +1,202 @@
+package redkit
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the server's runtime statistics. Durations are
+// encoded to JSON in nanoseconds.
+type Stats struct {
+	Uptime              time.Duration `json:"uptime_ns"`
+	TotalConnections    uint64        `json:"total_connections"`    // connections accepted since start
+	CurrentConnections  int64         `json:"current_connections"`  // connections currently open
+	RejectedConnections uint64        `json:"rejected_connections"` // connections refused by limits, access rules, TLS or OnConnect
+	CommandsProcessed   uint64        `json:"commands_processed"`   // commands read and executed, including unknown ones
+	CommandsPerSecond   float64       `json:"commands_per_second"`  // commands per second over the last couple of seconds
+	ErrorReplies        uint64        `json:"error_replies"`        // commands answered with an error reply
+	Errors              uint64        `json:"errors"`               // read, protocol, handler and write failures (see OnError)
+	AcceptErrors        uint64        `json:"accept_errors"`        // failed Accept calls on the listener
+	BytesIn             uint64        `json:"bytes_in"`             // bytes read from clients
+	BytesOut            uint64        `json:"bytes_out"`            // bytes written to clients
+	DeprecatedCalls     uint64        `json:"deprecated_calls"`     // calls to commands registered as Deprecated
+	ExpiredKeys         uint64        `json:"expired_keys"`         // keys of the built-in store or the Expirer that expired
+	// Commands holds per-command counters for registered commands, keyed by upper-case name
+	Commands map[string]CommandStats `json:"commands"`
+}
+
+// CommandStats are the counters of a single command
+type CommandStats struct {
+	Calls    uint64        `json:"calls"`
+	Failed   uint64        `json:"failed"`      // calls answered with an error reply
+	Duration time.Duration `json:"duration_ns"` // total time spent in the handler
+}
+
+// Number of samples CommandsPerSecond is averaged over, and how often they are taken
+const (
+	statsSamples        = 16
+	statsSampleInterval = 100 * time.Millisecond
+)
+
+// serverStats holds the counters behind Stats
+type serverStats struct {
+	started             time.Time
+	totalConnections    atomic.Uint64
+	rejectedConnections atomic.Uint64
+	commandsProcessed   atomic.Uint64
+	errorReplies        atomic.Uint64
+	errors              atomic.Uint64
+	acceptErrors        atomic.Uint64
+	bytesIn             atomic.Uint64
+	bytesOut            atomic.Uint64
+	deprecatedCalls     atomic.Uint64
+	expiredKeys         atomic.Uint64
+	commands            sync.Map // upper-case name -> *commandCounter
+	startupMemory       uint64   // heap in use when the server was created
+	peakMemory          atomic.Uint64
+
+	sampleMu     sync.Mutex
+	samples      [statsSamples]float64
+	sampleIndex  int
+	lastCommands uint64
+	lastSample   time.Time
+}
+
+type commandCounter struct {
+	calls    atomic.Uint64
+	failed   atomic.Uint64
+	duration atomic.Int64
+}
+
+func newServerStats() *serverStats {
+	now := time.Now()
+	st := &serverStats{started: now, lastSample: now}
+	st.startupMemory = st.memory().used
+	return st
+}
+
+// memory reads the memory of the process, recording a new peak
+func (st *serverStats) memory() processMemory {
+	memory := readMemory()
+	for {
+		peak := st.peakMemory.Load()
+		if memory.used <= peak || st.peakMemory.CompareAndSwap(peak, memory.used) {
+			return memory
+		}
+	}
+}
+
+// command returns the counter for a registered command, creating it on first use
+func (st *serverStats) command(name string) *commandCounter {
+	if counter, ok := st.commands.Load(name); ok {
+		return counter.(*commandCounter)
+	}
+	counter, _ := st.commands.LoadOrStore(name, &commandCounter{})
+	return counter.(*commandCounter)
+}
+
+func (c *commandCounter) record(d time.Duration, failed bool) {
+	c.calls.Add(1)
+	c.duration.Add(int64(d))
+	if failed {
+		c.failed.Add(1)
+	}
+}
+
+// sample records the command rate since the previous sample and the peak
+// of the memory
+func (st *serverStats) sample(now time.Time) {
+	st.memory()
+	st.sampleMu.Lock()
+	defer st.sampleMu.Unlock()
+
+	commands := st.commandsProcessed.Load()
+	elapsed := now.Sub(st.lastSample).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	st.samples[st.sampleIndex] = float64(commands-st.lastCommands) / elapsed
+	st.sampleIndex = (st.sampleIndex + 1) % statsSamples
+	st.lastCommands = commands
+	st.lastSample = now
+}
+
+func (st *serverStats) commandsPerSecond() float64 {
+	st.sampleMu.Lock()
+	defer st.sampleMu.Unlock()
+
+	var sum float64
+	for _, rate := range st.samples {
+		sum += rate
+	}
+	return sum / statsSamples
+}
+
+// Stats returns a snapshot of the server's runtime statistics
+func (s *Server) Stats() Stats {
+	st := s.stats
+	stats := Stats{
+		Uptime:              time.Since(st.started),
+		TotalConnections:    st.totalConnections.Load(),
+		CurrentConnections:  s.connCount.Load(),
+		RejectedConnections: st.rejectedConnections.Load(),
+		CommandsProcessed:   st.commandsProcessed.Load(),
+		CommandsPerSecond:   st.commandsPerSecond(),
+		ErrorReplies:        st.errorReplies.Load(),
+		Errors:              st.errors.Load(),
+		AcceptErrors:        st.acceptErrors.Load(),
+		BytesIn:             st.bytesIn.Load(),
+		BytesOut:            st.bytesOut.Load(),
+		DeprecatedCalls:     st.deprecatedCalls.Load(),
+		ExpiredKeys:         st.expiredKeys.Load(),
+		Commands:            make(map[string]CommandStats),
+	}
+	st.commands.Range(func(key, value interface{}) bool {
+		counter := value.(*commandCounter)
+		stats.Commands[key.(string)] = CommandStats{
+			Calls:    counter.calls.Load(),
+			Failed:   counter.failed.Load(),
+			Duration: time.Duration(counter.duration.Load()),
+		}
+		return true
+	})
+	return stats
+}
+
+// startStatsSampler periodically samples the command rate until the server shuts down
+func (s *Server) startStatsSampler() {
+	go func() {
+		ticker := time.NewTicker(statsSampleInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case now := <-ticker.C:
+				s.stats.sample(now)
+			}
+		}
+	}()
+}
+
+// countingIO counts the bytes passing through a connection's reader or writer
+type countingIO struct {
+	reader  io.Reader
+	writer  io.Writer
+	counter *atomic.Uint64
+}
+
+func (c *countingIO) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.counter.Add(uint64(n))
+	return n, err
+}
+
+func (c *countingIO) Write(p []byte) (int, error) {
+	n, err := c.writer.Write(p)
+	c.counter.Add(uint64(n))
+	return n, err
+}
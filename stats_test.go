@@ -0,0 +1,55 @@
+package redkit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	server, address := startTestServer(t, nil)
+
+	client := dialRaw(t, address)
+	client.send(t, "PING")
+	client.readLine(t)
+	client.send(t, "ECHO", "hello")
+	client.readLine(t)
+	client.readLine(t)
+	client.send(t, "ECHO")
+	client.readLine(t)
+	client.send(t, "NOSUCHCOMMAND")
+	client.readLine(t)
+
+	stats := server.Stats()
+	if stats.TotalConnections != 1 || stats.CurrentConnections != 1 {
+		t.Errorf("Expected 1 total and current connection, got %d/%d", stats.TotalConnections, stats.CurrentConnections)
+	}
+	if stats.CommandsProcessed != 4 {
+		t.Errorf("Expected 4 commands processed, got %d", stats.CommandsProcessed)
+	}
+	if stats.ErrorReplies != 2 {
+		t.Errorf("Expected 2 error replies, got %d", stats.ErrorReplies)
+	}
+	if stats.BytesIn == 0 || stats.BytesOut == 0 {
+		t.Errorf("Expected bytes to be counted, got in=%d out=%d", stats.BytesIn, stats.BytesOut)
+	}
+
+	echo := stats.Commands["ECHO"]
+	if echo.Calls != 2 || echo.Failed != 1 {
+		t.Errorf("Expected ECHO calls=2 failed=1, got %+v", echo)
+	}
+	if _, ok := stats.Commands["NOSUCHCOMMAND"]; ok {
+		t.Error("Unknown commands must not get per-command counters")
+	}
+}
+
+func TestStatsCommandsPerSecond(t *testing.T) {
+	stats := newServerStats()
+	start := stats.lastSample
+
+	stats.commandsProcessed.Add(160)
+	stats.sample(start.Add(time.Second))
+
+	if got := stats.commandsPerSecond(); got != 10 {
+		t.Errorf("Expected 160/s averaged over %d samples to be 10, got %v", statsSamples, got)
+	}
+}
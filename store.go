@@ -0,0 +1,354 @@
+package redkit
+
+import (
+	"errors"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/l00pss/redkit/args"
+	"github.com/l00pss/redkit/store"
+)
+
+// EnableBuiltinStore registers data commands such as SET, GET and DEL backed
+// by in-memory keyspaces, one for each database SELECT accepts, replacing
+// handlers registered for them before, and returns the keyspace of database
+// 0 so the application can seed and read the data; Database returns the
+// others. Calling it again returns the same keyspace. Expired keys are
+// removed in the background as ServerConfig.ExpireFrequency and
+// ExpireEffort set.
+func (s *Server) EnableBuiltinStore() *store.Store {
+	if st, ok := s.Storage().(*store.Store); ok {
+		return st
+	}
+	stores := make([]*store.Store, s.databases())
+	dbs := make([]*database, len(stores))
+	for i := range stores {
+		stores[i] = store.New()
+		dbs[i] = newDatabase(stores[i])
+	}
+	s.enableDatabases(dbs)
+	if s.ExpireFrequency >= 0 {
+		for _, st := range stores {
+			st.StartExpiry(s.ctx, store.ExpireConfig{
+				Frequency: s.ExpireFrequency,
+				Effort:    s.ExpireEffort,
+				OnExpire: func(keys []string) {
+					// SWAPDB may have moved the keyspace to another index
+					if db, ok := s.databaseIndex(st); ok {
+						s.keyEvent(db, KeyEventExpired, keys...)
+					}
+				},
+			})
+		}
+	}
+	return stores[0]
+}
+
+// EnableStorage registers the commands of EnableBuiltinStore backed by
+// storage instead of the in-memory keyspaces, replacing the storage of an
+// earlier call. Every database shares storage, so SELECT doesn't change the
+// keys the commands see and FLUSHDB flushes them all.
+func (s *Server) EnableStorage(storage store.Storage) {
+	db := newDatabase(storage)
+	dbs := make([]*database, s.databases())
+	for i := range dbs {
+		dbs[i] = db
+	}
+	s.enableDatabases(dbs)
+}
+
+// enableDatabases registers the commands of EnableStorage backed by dbs[i]
+// for database i, all with storage of the same implementation
+func (s *Server) enableDatabases(dbs []*database) {
+	s.mu.Lock()
+	s.dbs = dbs
+	s.mu.Unlock()
+
+	c := &storeCommands{server: s}
+	db := dbs[0]
+	c.registerStrings()
+	c.registerKeys()
+	if db.hashes != nil {
+		c.registerHashes()
+	}
+	if db.lists != nil {
+		c.registerLists()
+	}
+	if db.sets != nil {
+		c.registerSets()
+	}
+	if db.zsets != nil {
+		c.registerZSets()
+	}
+	if db.streams != nil {
+		c.registerStreams()
+	}
+	if db.objects != nil {
+		c.registerObject()
+	}
+	if db.keyspace != nil {
+		c.registerKeyspace()
+	}
+	if db.memory != nil {
+		c.registerMemory()
+	}
+	if db.flush != nil {
+		c.registerFlush()
+	}
+	if db.access != nil {
+		c.registerRandomKey()
+	}
+	if db.keyStats != nil {
+		c.registerKeyStats()
+	}
+}
+
+// database is the storage of a logical database. The fields for other data
+// types and capabilities are nil unless the storage has them.
+type database struct {
+	store    store.Storage
+	hashes   store.HashStorage
+	lists    store.ListStorage
+	sets     store.SetStorage
+	zsets    store.ZSetStorage
+	streams  store.StreamStorage
+	objects  store.ObjectStorage
+	memory   store.MemoryStorage
+	lazy     store.LazyFreeStorage
+	keyspace store.KeyStorage
+	flush    store.FlushStorage
+	access   store.AccessStorage
+	keyStats store.KeyStatsStorage
+	loader   store.LoaderStorage
+}
+
+func newDatabase(storage store.Storage) *database {
+	db := &database{store: storage}
+	db.hashes, _ = storage.(store.HashStorage)
+	db.lists, _ = storage.(store.ListStorage)
+	db.sets, _ = storage.(store.SetStorage)
+	db.zsets, _ = storage.(store.ZSetStorage)
+	db.streams, _ = storage.(store.StreamStorage)
+	db.objects, _ = storage.(store.ObjectStorage)
+	db.memory, _ = storage.(store.MemoryStorage)
+	db.lazy, _ = storage.(store.LazyFreeStorage)
+	db.keyspace, _ = storage.(store.KeyStorage)
+	db.flush, _ = storage.(store.FlushStorage)
+	db.access, _ = storage.(store.AccessStorage)
+	db.keyStats, _ = storage.(store.KeyStatsStorage)
+	db.loader, _ = storage.(store.LoaderStorage)
+	return db
+}
+
+// storeCommands implements the commands of EnableStorage against the
+// database each connection selected
+type storeCommands struct {
+	server *Server
+}
+
+// db returns the database conn selected
+func (c *storeCommands) db(conn *Connection) *database {
+	return c.server.database(connDB(conn))
+}
+
+// database returns database index, nil if no storage was enabled
+func (s *Server) database(index int) *database {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if index < 0 || index >= len(s.dbs) {
+		return nil
+	}
+	return s.dbs[index]
+}
+
+// databaseIndex returns the index of the database storage is the storage of
+func (s *Server) databaseIndex(storage store.Storage) (int, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i, db := range s.dbs {
+		if db.store == storage {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// distinctDatabases calls fn with the index and the database of every
+// database with a storage of its own, which is only database 0 for the
+// storage of EnableStorage
+func (s *Server) distinctDatabases(fn func(index int, db *database)) {
+	s.mu.RLock()
+	dbs := s.dbs
+	s.mu.RUnlock()
+	for i, db := range dbs {
+		if i == 0 || db != dbs[i-1] {
+			fn(i, db)
+		}
+	}
+}
+
+// swapDatabases exchanges the storages of databases a and b, as SWAPDB does
+func (s *Server) swapDatabases(a, b int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a < len(s.dbs) && b < len(s.dbs) {
+		s.dbs[a], s.dbs[b] = s.dbs[b], s.dbs[a]
+	}
+}
+
+// Storage returns the storage the built-in commands use for database 0, nil
+// if neither EnableStorage nor EnableBuiltinStore was called
+func (s *Server) Storage() store.Storage {
+	return s.Database(0)
+}
+
+// Database returns the storage the built-in commands use for database
+// index, nil if neither EnableStorage nor EnableBuiltinStore was called or
+// index is out of range. Handlers of other data types, such as modules,
+// pick the one of the database a connection selected with
+// Database(conn.DB()).
+func (s *Server) Database(index int) store.Storage {
+	if db := s.database(index); db != nil {
+		return db.store
+	}
+	return nil
+}
+
+// argsError converts an error from parsing the arguments of cmd into an error
+// reply, naming the command in invalid expire time errors as Redis does
+func argsError(cmd *Command, err error) RedisValue {
+	if errors.Is(err, args.ErrInvalidTime) {
+		return NewError(ErrPrefixGeneric, "invalid expire time in '%s' command", strings.ToLower(cmd.Name)).Value()
+	}
+	return ErrorValue(err)
+}
+
+// matchExpiration consumes an EX, PX, EXAT or PXAT option and sets at to the
+// time it gives. seen tracks whether an expiration option was given before,
+// which is a syntax error.
+func matchExpiration(p *args.Parser, at *time.Time, seen *bool) bool {
+	var n int64
+	unit, absolute := time.Second, false
+	switch {
+	case p.MatchKeyword("EX", &n):
+	case p.MatchKeyword("PX", &n):
+		unit = time.Millisecond
+	case p.MatchKeyword("EXAT", &n):
+		absolute = true
+	case p.MatchKeyword("PXAT", &n):
+		unit, absolute = time.Millisecond, true
+	default:
+		return false
+	}
+	if *seen {
+		p.Fail(args.ErrSyntax)
+	}
+	*seen = true
+	if n <= 0 || n > math.MaxInt64/int64(unit) {
+		p.Fail(args.ErrInvalidTime)
+		return true
+	}
+	*at = expirationTime(n, unit, absolute)
+	return true
+}
+
+// expirationTime returns the time n units from now, or n units after the
+// unix epoch if absolute
+func expirationTime(n int64, unit time.Duration, absolute bool) time.Time {
+	if absolute {
+		return time.UnixMilli(n * int64(unit/time.Millisecond))
+	}
+	return time.Now().Add(time.Duration(n) * unit)
+}
+
+// KeysWritten tells WATCH, client tracking, the OnKeyEvent hooks and
+// keyspace notifications that a command changed keys. The built-in commands call it after writing to the
+// storage, and so should handlers of other data types, such as modules,
+// sharing it; conn may be nil.
+func (s *Server) KeysWritten(conn *Connection, keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+	db := connDB(conn)
+	s.TouchKey(db, keys...)
+	s.NotifyKeyModifiedBy(conn, keys...)
+	event := writeEvent(conn)
+	s.runKeyEventHooks(db, event, keys)
+	s.notifyKeyspace(db, event, keys)
+}
+
+// connDB returns the database selected by conn, 0 without a connection
+func connDB(conn *Connection) int {
+	if conn == nil {
+		return 0
+	}
+	return conn.DB()
+}
+
+// KeysRead tells client tracking that a command read keys, as KeysWritten
+// does for writes
+func (s *Server) KeysRead(conn *Connection, keys ...string) {
+	if conn != nil {
+		s.TrackKeyRead(conn, keys...)
+	}
+}
+
+// nextNumKeys consumes numkeys key [key ...], failing p with errNone if
+// numkeys is below 1 and with errTooMany if fewer keys follow
+func nextNumKeys(p *args.Parser, errNone, errTooMany error) []string {
+	n := p.NextInt()
+	if p.Err() != nil {
+		return nil
+	}
+	if n < 1 {
+		p.Fail(errNone)
+		return nil
+	}
+	if n > int64(p.Remaining()) {
+		p.Fail(errTooMany)
+		return nil
+	}
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = p.NextString()
+	}
+	return keys
+}
+
+// randomPicks picks count random elements of a collection of n, distinct
+// ones if count is positive and possibly repeated ones if it is negative, as
+// HRANDFIELD and SRANDMEMBER do. random returns a random element, all every
+// element, and id tells elements apart.
+func randomPicks[T any](n, count int64, random func() T, all func() []T, id func(T) string) []T {
+	switch {
+	case n == 0 || count == 0:
+		return nil
+	case count < 0:
+		// Repeats allowed: pick independently each time
+		picks := make([]T, 0, -count)
+		for range -count {
+			picks = append(picks, random())
+		}
+		return picks
+	case count >= n:
+		return all()
+	case count*3 > n:
+		// Most of the collection: shuffle a copy rather than retry picks
+		picks := all()
+		rand.Shuffle(len(picks), func(i, j int) { picks[i], picks[j] = picks[j], picks[i] })
+		return picks[:count]
+	default:
+		seen := make(map[string]struct{}, count)
+		picks := make([]T, 0, count)
+		for int64(len(picks)) < count {
+			pick := random()
+			if _, ok := seen[id(pick)]; !ok {
+				seen[id(pick)] = struct{}{}
+				picks = append(picks, pick)
+			}
+		}
+		return picks
+	}
+}
@@ -0,0 +1,63 @@
+package store
+
+import "math/rand/v2"
+
+// AccessStorage is a Storage that can also pick a random key and record
+// accesses to keys, as RANDOMKEY and TOUCH need
+type AccessStorage interface {
+	Storage
+	// RandomKey returns a random key, false if there is none
+	RandomKey() (string, bool, error)
+	// Touch records an access to keys, as reading them would, and returns
+	// how many of them exist, counting a key given twice twice
+	Touch(keys ...string) (int, error)
+}
+
+var _ AccessStorage = (*Store)(nil)
+
+// RandomKey returns a random key in constant time on average, false if the
+// store is empty. It picks from a random shard, or the next one holding keys
+// if it is empty. Expired keys it picks are removed, as a write finding them
+// would, and another is picked.
+func (s *Store) RandomKey() (string, bool, error) {
+	start := rand.IntN(len(s.shards))
+	for i := range s.shards {
+		if key, ok := s.shards[(start+i)%len(s.shards)].randomKey(s); ok {
+			return key, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// randomKey returns a random live key of sh, removing the expired ones it
+// picks, and false once it has none
+func (sh *shard) randomKey(s *Store) (string, bool) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	now := nowMillis()
+	for {
+		key, e, ok := sh.keys.random()
+		if !ok {
+			return "", false
+		}
+		if !e.expired(now) {
+			return key, true
+		}
+		s.expireKey(key)
+	}
+}
+
+// Touch records an access to keys, updating what OBJECT IDLETIME and FREQ
+// report of them, and returns how many of them exist
+func (s *Store) Touch(keys ...string) (int, error) {
+	locked := s.rlock(keys...)
+	defer s.runlock(locked)
+	now := nowMillis()
+	n := 0
+	for _, key := range keys {
+		if s.get(key, now) != nil {
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRandomKey(t *testing.T) {
+	s := New()
+	if _, ok, err := s.RandomKey(); ok || err != nil {
+		t.Fatalf("Expected no key from an empty store, got %v, %v", ok, err)
+	}
+
+	for i := range 100 {
+		s.Set(fmt.Sprintf("key:%d", i), []byte("v"), SetOptions{})
+	}
+	seen := make(map[string]bool)
+	for range 10000 {
+		key, ok, _ := s.RandomKey()
+		if !ok {
+			t.Fatal("Expected a key")
+		}
+		seen[key] = true
+	}
+	if len(seen) != 100 {
+		t.Errorf("Expected every key to come up, got %d of them", len(seen))
+	}
+
+	// Expired keys are removed rather than returned, from the shards
+	// RandomKey picks from, so one shard holds them all here
+	s = newStore(1)
+	for i := range 10 {
+		s.Set(fmt.Sprintf("gone:%d", i), []byte("v"), SetOptions{ExpireAt: time.Now().Add(-time.Second)})
+	}
+	s.Set("live", []byte("v"), SetOptions{})
+	for range 20 {
+		if key, _, _ := s.RandomKey(); key != "live" {
+			t.Fatalf("Expected the only live key, got %q", key)
+		}
+	}
+	if n := s.Len(); n != 1 {
+		t.Errorf("Expected the expired keys to be removed, got %d keys", n)
+	}
+}
+
+func TestTouch(t *testing.T) {
+	s := New()
+	s.Set("k", []byte("v"), SetOptions{})
+	e := entryOf(s, "k")
+	e.access.Store(time.Now().Add(-time.Hour).UnixMilli())
+
+	if n, err := s.Touch("k", "missing", "k"); n != 2 || err != nil {
+		t.Errorf("Expected 2 keys touched, got %d, %v", n, err)
+	}
+	if info, _, _ := s.Object("k"); info.Idle > time.Second {
+		t.Errorf("Expected TOUCH to reset the idle time, got %v", info.Idle)
+	}
+}
@@ -0,0 +1,147 @@
+package store
+
+import (
+	"errors"
+	"slices"
+	"sync/atomic"
+)
+
+var (
+	ErrNoSuchKey   = errors.New("no such key")
+	ErrNotCopyable = errors.New("the value of the key can't be copied")
+	// ErrOtherStorage is returned by Copy and Move given a destination of
+	// another implementation than the source
+	ErrOtherStorage = errors.New("the destination is another kind of storage")
+)
+
+// storeIDs numbers stores, so that operations on two lock their shards in
+// order
+var storeIDs atomic.Uint64
+
+// KeyStorage is a Storage that can also rename, copy and move keys, as
+// RENAME, RENAMENX, COPY and MOVE need. The destination of Copy and Move is
+// the storage of another database, which can be the storage itself when it
+// holds the keys of several. Expirations are carried along with the values.
+type KeyStorage interface {
+	Storage
+	// Rename moves the value of src to dst, replacing the value dst had
+	// unless nx, and reports whether it did; nx leaves an existing dst
+	// alone. A missing src is ErrNoSuchKey.
+	Rename(src, dst string, nx bool) (bool, error)
+	// Copy copies the value of src to dst in to, replacing the value dst
+	// had only if replace, and reports whether it did. A missing src isn't
+	// copied.
+	Copy(src string, to KeyStorage, dst string, replace bool) (bool, error)
+	// Move moves key to to unless it is missing or already exists there,
+	// and reports whether it did
+	Move(key string, to KeyStorage) (bool, error)
+}
+
+var _ KeyStorage = (*Store)(nil)
+
+// CopyableValue is a Value that can be copied, which COPY needs of the
+// values of other data types
+type CopyableValue interface {
+	Value
+	// Copy returns a deep copy of the value
+	Copy() Value
+}
+
+// copyValue returns a deep copy of v
+func copyValue(v any) (any, error) {
+	switch v := v.(type) {
+	case []byte:
+		return slices.Clone(v), nil
+	case *Hash:
+		return v.clone(), nil
+	case *List:
+		return v.clone(), nil
+	case *Set:
+		return v.clone(), nil
+	case *ZSet:
+		return v.clone(), nil
+	case *Stream:
+		return v.clone(), nil
+	case CopyableValue:
+		return v.Copy(), nil
+	default:
+		return nil, ErrNotCopyable
+	}
+}
+
+// destination returns to as a *Store
+func destination(to KeyStorage) (*Store, error) {
+	dst, ok := to.(*Store)
+	if !ok {
+		return nil, ErrOtherStorage
+	}
+	return dst, nil
+}
+
+// Rename moves the value of src, with its expiration and access metadata, to
+// dst, replacing the value dst had unless nx, and reports whether it did. A
+// missing src is ErrNoSuchKey.
+func (s *Store) Rename(src, dst string, nx bool) (bool, error) {
+	locked := s.lock(src, dst)
+	defer s.unlock(locked)
+	now := nowMillis()
+	e := s.getForWrite(src, now)
+	if e == nil {
+		return false, ErrNoSuchKey
+	}
+	if src == dst {
+		return !nx, nil
+	}
+	if nx && s.getForWrite(dst, now) != nil {
+		return false, nil
+	}
+	s.drop(src)
+	s.put(dst, e)
+	return true, nil
+}
+
+// Copy copies the value of src and its expiration to dst in to, which can be
+// s, replacing the value dst had only if replace, and reports whether it did.
+// A missing src isn't copied; to must be a *Store.
+func (s *Store) Copy(src string, to KeyStorage, dst string, replace bool) (bool, error) {
+	target, err := destination(to)
+	if err != nil {
+		return false, err
+	}
+	defer lockPair(s.shardOf(src), target.shardOf(dst))()
+	now := nowMillis()
+	e := s.getForWrite(src, now)
+	if e == nil {
+		return false, nil
+	}
+	if existing := target.getForWrite(dst, now); existing != nil && !replace {
+		return false, nil
+	} else if existing == e {
+		return true, nil
+	}
+	value, err := copyValue(e.value)
+	if err != nil {
+		return false, err
+	}
+	target.put(dst, &entry{value: value, expireAt: e.expireAt})
+	return true, nil
+}
+
+// Move moves key with its expiration and access metadata to to, unless it
+// is missing or already exists there, and reports whether it did; to must
+// be a *Store.
+func (s *Store) Move(key string, to KeyStorage) (bool, error) {
+	target, err := destination(to)
+	if err != nil {
+		return false, err
+	}
+	defer lockPair(s.shardOf(key), target.shardOf(key))()
+	now := nowMillis()
+	e := s.getForWrite(key, now)
+	if e == nil || target.getForWrite(key, now) != nil {
+		return false, nil
+	}
+	s.drop(key)
+	target.put(key, e)
+	return true, nil
+}
@@ -0,0 +1,175 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRename(t *testing.T) {
+	s := New()
+	at := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	s.Set("a", []byte("1"), SetOptions{ExpireAt: at})
+	s.Set("b", []byte("2"), SetOptions{})
+
+	if ok, err := s.Rename("b", "a", true); ok || err != nil {
+		t.Errorf("Expected RENAMENX onto an existing key to do nothing, got %v, %v", ok, err)
+	}
+	if ok, err := s.Rename("a", "c", false); !ok || err != nil {
+		t.Fatalf("Expected a to be renamed, got %v, %v", ok, err)
+	}
+	if expireAt, ok, _ := s.ExpireTime("c"); !ok || !expireAt.Equal(at) {
+		t.Errorf("Expected c to keep the expiration of a, got %v", expireAt)
+	}
+	if ok, err := s.Rename("b", "c", false); !ok || err != nil {
+		t.Fatalf("Expected b to replace c, got %v, %v", ok, err)
+	}
+	if value, _, _ := s.Get("c"); string(value) != "2" {
+		t.Errorf("Expected c to hold 2, got %q", value)
+	}
+	if expireAt, _, _ := s.ExpireTime("c"); !expireAt.IsZero() {
+		t.Errorf("Expected c to lose the expiration it had, got %v", expireAt)
+	}
+	if n := volatileKeys(s); n != 0 {
+		t.Errorf("Expected no key with an expiration, got %d", n)
+	}
+	if ok, err := s.Rename("c", "c", true); ok || err != nil {
+		t.Errorf("Expected RENAMENX onto itself to do nothing, got %v, %v", ok, err)
+	}
+	if _, err := s.Rename("a", "d", false); !errors.Is(err, ErrNoSuchKey) {
+		t.Errorf("Expected ErrNoSuchKey for a missing key, got %v", err)
+	}
+	if stats, _ := s.MemoryStats(); stats.Bytes != accounted(s) {
+		t.Errorf("Accounted %d bytes, expected %d", stats.Bytes, accounted(s))
+	}
+}
+
+func TestCopy(t *testing.T) {
+	s, other := New(), New()
+	at := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	s.Set("string", []byte("v"), SetOptions{ExpireAt: at})
+	s.UpdateHash("hash", func(h *Hash) error {
+		h.Set("f", []byte("v"))
+		return nil
+	})
+	s.UpdateList("list", func(l *List) error {
+		l.PushBack([]byte("a"))
+		l.PushBack([]byte("b"))
+		return nil
+	})
+	s.UpdateSet("ints", func(set *Set) error {
+		set.Add("1")
+		return nil
+	})
+	s.UpdateSet("set", func(set *Set) error {
+		set.Add("a")
+		return nil
+	})
+	s.UpdateZSet("zset", func(z *ZSet) error {
+		z.Add("a", 1)
+		z.Add("b", 2)
+		return nil
+	})
+	s.UpdateStream("stream", true, func(st *Stream) error {
+		return st.Add(StreamID{Ms: 1}, [][]byte{[]byte("f"), []byte("v")})
+	})
+
+	for _, key := range []string{"string", "hash", "list", "ints", "set", "zset", "stream"} {
+		if ok, err := s.Copy(key, s, key+":copy", false); !ok || err != nil {
+			t.Errorf("Expected %s to be copied, got %v, %v", key, ok, err)
+		}
+		if ok, err := s.Copy(key, other, key, false); !ok || err != nil {
+			t.Errorf("Expected %s to be copied to another store, got %v, %v", key, ok, err)
+		}
+	}
+	if expireAt, _, _ := other.ExpireTime("string"); !expireAt.Equal(at) {
+		t.Errorf("Expected the copy to keep the expiration, got %v", expireAt)
+	}
+
+	// The copies don't share anything with the originals
+	s.UpdateHash("hash:copy", func(h *Hash) error {
+		h.Set("f", []byte("changed"))
+		return nil
+	})
+	s.UpdateList("list:copy", func(l *List) error {
+		l.PopFront()
+		return nil
+	})
+	s.UpdateZSet("zset:copy", func(z *ZSet) error {
+		z.Add("a", 3)
+		return nil
+	})
+	s.ViewHash("hash", func(h *Hash) {
+		if value, _ := h.Get("f"); string(value) != "v" {
+			t.Errorf("Expected the original hash to be unchanged, got %q", value)
+		}
+	})
+	s.ViewList("list", func(l *List) {
+		if l.Len() != 2 {
+			t.Errorf("Expected the original list to be unchanged, got %d elements", l.Len())
+		}
+	})
+	s.ViewZSet("zset", func(z *ZSet) {
+		if score, _ := z.Score("a"); score != 1 || z.Len() != 2 {
+			t.Errorf("Expected the original sorted set to be unchanged, got %v", score)
+		}
+	})
+	s.ViewZSet("zset:copy", func(z *ZSet) {
+		if rank, _ := z.Rank("a"); rank != 1 {
+			t.Errorf("Expected a to be ranked after b in the copy, got %d", rank)
+		}
+	})
+
+	if ok, err := s.Copy("set", s, "string", false); ok || err != nil {
+		t.Errorf("Expected COPY onto an existing key to do nothing, got %v, %v", ok, err)
+	}
+	if ok, err := s.Copy("set", s, "string", true); !ok || err != nil {
+		t.Errorf("Expected COPY REPLACE to replace, got %v, %v", ok, err)
+	}
+	if typ, _ := s.Type("string"); typ != "set" {
+		t.Errorf("Expected a set, got %s", typ)
+	}
+	if ok, err := s.Copy("missing", s, "dst", false); ok || err != nil {
+		t.Errorf("Expected a missing key not to be copied, got %v, %v", ok, err)
+	}
+	for _, st := range []*Store{s, other} {
+		if stats, _ := st.MemoryStats(); stats.Bytes != accounted(st) {
+			t.Errorf("Accounted %d bytes, expected %d", stats.Bytes, accounted(st))
+		}
+	}
+}
+
+func TestMove(t *testing.T) {
+	s, other := New(), New()
+	at := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	s.Set("a", []byte("1"), SetOptions{ExpireAt: at})
+	s.Set("b", []byte("2"), SetOptions{})
+	other.Set("b", []byte("other"), SetOptions{})
+
+	if ok, err := s.Move("a", other); !ok || err != nil {
+		t.Fatalf("Expected a to be moved, got %v, %v", ok, err)
+	}
+	if n, _ := s.Exists("a"); n != 0 {
+		t.Error("Expected a to be gone from the source")
+	}
+	if expireAt, _, _ := other.ExpireTime("a"); !expireAt.Equal(at) {
+		t.Errorf("Expected a to keep its expiration, got %v", expireAt)
+	}
+	if ok, err := s.Move("b", other); ok || err != nil {
+		t.Errorf("Expected a key existing in the destination not to move, got %v, %v", ok, err)
+	}
+	if ok, err := s.Move("missing", other); ok || err != nil {
+		t.Errorf("Expected a missing key not to move, got %v, %v", ok, err)
+	}
+	if ok, err := s.Move("b", s); ok || err != nil {
+		t.Errorf("Expected a key not to move within its store, got %v, %v", ok, err)
+	}
+	for _, st := range []*Store{s, other} {
+		if stats, _ := st.MemoryStats(); stats.Bytes != accounted(st) || stats.Expires != volatileKeys(st) {
+			t.Errorf("Accounted %d bytes, expected %d", stats.Bytes, accounted(st))
+		}
+	}
+	if n := volatileKeys(other); n != 1 {
+		t.Errorf("Expected the destination to have 1 key with an expiration, got %d", n)
+	}
+}
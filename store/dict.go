@@ -0,0 +1,163 @@
+package store
+
+import (
+	"hash/maphash"
+	"math/bits"
+	"math/rand/v2"
+)
+
+const (
+	minBuckets = 1 // buckets of an empty dict
+	bucketLoad = 8 // average keys per bucket above which the table grows
+)
+
+// seed hashes dict keys to buckets
+var seed = maphash.MakeSeed()
+
+// dict is a hash table of string keys spread over a power of two number of
+// buckets by their hash. Walking the buckets in reverse binary order gives
+// scan a cursor that stays valid while the table grows or shrinks, the way
+// Redis' dictScan does. It is not safe for concurrent use.
+type dict[V any] struct {
+	buckets []map[string]V
+	count   int
+}
+
+// newDict returns an empty dict
+func newDict[V any]() dict[V] {
+	return dict[V]{buckets: []map[string]V{make(map[string]V)}}
+}
+
+// bucket returns the bucket holding key
+func (d *dict[V]) bucket(key string) map[string]V {
+	if len(d.buckets) == 1 {
+		return d.buckets[0]
+	}
+	return d.buckets[maphash.String(seed, key)&uint64(len(d.buckets)-1)]
+}
+
+// get returns the value of key
+func (d *dict[V]) get(key string) (V, bool) {
+	v, ok := d.bucket(key)[key]
+	return v, ok
+}
+
+// set stores v under key and reports whether the key is new
+func (d *dict[V]) set(key string, v V) bool {
+	b := d.bucket(key)
+	_, exists := b[key]
+	b[key] = v
+	if exists {
+		return false
+	}
+	d.count++
+	if d.count > len(d.buckets)*bucketLoad {
+		d.resize(len(d.buckets) * 2)
+	}
+	return true
+}
+
+// delete removes key and reports whether it was present
+func (d *dict[V]) delete(key string) bool {
+	b := d.bucket(key)
+	if _, ok := b[key]; !ok {
+		return false
+	}
+	delete(b, key)
+	d.count--
+	if len(d.buckets) > minBuckets && d.count < len(d.buckets) {
+		d.resize(len(d.buckets) / 2)
+	}
+	return true
+}
+
+// resize moves the keys to n buckets
+func (d *dict[V]) resize(n int) {
+	old := d.buckets
+	d.buckets = make([]map[string]V, n)
+	for i := range d.buckets {
+		d.buckets[i] = make(map[string]V, d.count/n+1)
+	}
+	for _, b := range old {
+		for key, v := range b {
+			d.bucket(key)[key] = v
+		}
+	}
+}
+
+// len returns the number of keys
+func (d *dict[V]) len() int {
+	return d.count
+}
+
+// clone returns a copy of d holding copies of the values made by fn
+func (d *dict[V]) clone(fn func(V) V) dict[V] {
+	c := dict[V]{buckets: make([]map[string]V, len(d.buckets)), count: d.count}
+	for i, b := range d.buckets {
+		c.buckets[i] = make(map[string]V, len(b))
+		for key, v := range b {
+			c.buckets[i][key] = fn(v)
+		}
+	}
+	return c
+}
+
+// forEach calls fn for every key until it returns false
+func (d *dict[V]) forEach(fn func(key string, v V) bool) {
+	for _, b := range d.buckets {
+		for key, v := range b {
+			if !fn(key, v) {
+				return
+			}
+		}
+	}
+}
+
+// scan calls fn for the keys of whole buckets from cursor on, until fn has
+// returned true count times or count*10 buckets were visited, and returns
+// the cursor to continue from, 0 once every bucket was visited
+func (d *dict[V]) scan(cursor uint64, count int, fn func(key string, v V) bool) uint64 {
+	if count <= 0 {
+		count = 10
+	}
+	mask := uint64(len(d.buckets) - 1)
+	found := 0
+	for visits := count * 10; ; visits-- {
+		for key, v := range d.buckets[cursor&mask] {
+			if fn(key, v) {
+				found++
+			}
+		}
+		// Increment the masked bits from the top
+		cursor |= ^mask
+		cursor = bits.Reverse64(bits.Reverse64(cursor) + 1)
+		if cursor == 0 || found >= count || visits <= 1 {
+			return cursor
+		}
+	}
+}
+
+// random returns a random key, not uniformly distributed but in constant
+// time on average
+func (d *dict[V]) random() (string, V, bool) {
+	var zero V
+	if d.count == 0 {
+		return "", zero, false
+	}
+	mask := len(d.buckets) - 1
+	start := rand.IntN(len(d.buckets))
+	for i := range d.buckets {
+		b := d.buckets[(start+i)&mask]
+		if len(b) == 0 {
+			continue
+		}
+		n := rand.IntN(len(b))
+		for key, v := range b {
+			if n == 0 {
+				return key, v, true
+			}
+			n--
+		}
+	}
+	return "", zero, false
+}
@@ -0,0 +1,144 @@
+package store
+
+import (
+	"context"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// Defaults and bounds of ExpireConfig
+const (
+	defaultExpireFrequency = 100 * time.Millisecond
+	minExpireEffort        = 1
+	maxExpireEffort        = 10
+)
+
+// ExpireConfig configures the active expiration StartExpiry runs
+type ExpireConfig struct {
+	// Frequency is the interval between expiration cycles, 100ms if zero
+	Frequency time.Duration
+	// Effort, from 1 to 10, trades CPU time for memory: a higher effort
+	// samples more keys at a time, leaves fewer expired keys behind and
+	// lets a cycle run longer. 1 if zero.
+	Effort int
+	// OnExpire is called after every cycle that removed keys because they
+	// expired, with those keys and the ones writes found expired since the
+	// cycle before. It runs on the goroutine of StartExpiry and may use the
+	// store.
+	OnExpire func(keys []string)
+}
+
+// expiry is the state StartExpiry shares with the store
+type expiry struct {
+	stop    context.CancelFunc
+	mu      sync.Mutex
+	pending []string // keys writes found expired since the last cycle
+}
+
+// expireKey removes the expired key found by a write and records it for
+// OnExpire; the caller holds the shard of key for writing
+func (s *Store) expireKey(key string) {
+	s.drop(key)
+	if x := s.expiry.Load(); x != nil {
+		x.mu.Lock()
+		x.pending = append(x.pending, key)
+		x.mu.Unlock()
+	}
+}
+
+// effortParams returns how many keys a cycle of effort samples at a time,
+// the percentage of expired ones among them up to which it stops, and the
+// share of the interval between cycles it may take, in percent, as Redis'
+// active-expire-effort scales them
+func effortParams(effort int) (sample, stale, share int) {
+	effort = min(max(effort, minExpireEffort), maxExpireEffort) - 1
+	return 20 + 5*effort, 10 - effort, 25 + 2*effort
+}
+
+// StartExpiry runs expiration cycles in the background until ctx is done or
+// StartExpiry is called again, so that keys past their expiration are
+// removed even if nothing accesses them
+func (s *Store) StartExpiry(ctx context.Context, config ExpireConfig) {
+	frequency := config.Frequency
+	if frequency <= 0 {
+		frequency = defaultExpireFrequency
+	}
+	_, _, share := effortParams(config.Effort)
+	budget := frequency * time.Duration(share) / 100
+
+	ctx, stop := context.WithCancel(ctx)
+	x := &expiry{stop: stop}
+	if previous := s.expiry.Swap(x); previous != nil {
+		previous.stop()
+	}
+
+	go func() {
+		ticker := time.NewTicker(frequency)
+		defer ticker.Stop()
+		defer s.expiry.CompareAndSwap(x, nil)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			keys := s.ExpireCycle(config.Effort, budget)
+			x.mu.Lock()
+			keys = append(x.pending, keys...)
+			x.pending = nil
+			x.mu.Unlock()
+			if len(keys) > 0 && config.OnExpire != nil {
+				config.OnExpire(keys)
+			}
+		}
+	}()
+}
+
+// ExpireCycle removes expired keys and returns them. In every shard, it
+// samples random keys having an expiration, removes the expired ones and
+// samples again while they are more than a share of the sample that shrinks
+// as effort grows, until budget has passed. A shard is locked for one sample
+// at a time, so writes aren't held up for a whole cycle.
+func (s *Store) ExpireCycle(effort int, budget time.Duration) []string {
+	sample, stale, _ := effortParams(effort)
+	deadline := time.Now().Add(budget)
+	var removed []string
+	for busy := s.allShards(); busy != 0; {
+		for rest := busy; rest != 0; rest &= rest - 1 {
+			i := bits.TrailingZeros64(rest)
+			var sampled, expired int
+			removed, sampled, expired = s.shards[i].expireSample(removed, sample)
+			if expired*100 <= sampled*stale {
+				busy &^= 1 << i
+			}
+			if !time.Now().Before(deadline) {
+				return removed
+			}
+		}
+	}
+	return removed
+}
+
+// expireSample samples up to sample keys of sh having an expiration and
+// removes the expired ones, appending them to removed, and returns how many
+// it sampled and removed
+func (sh *shard) expireSample(removed []string, sample int) ([]string, int, int) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	now := nowMillis()
+	sampled, expired := 0, 0
+	for ; sampled < sample; sampled++ {
+		key, _, ok := sh.volatile.random()
+		if !ok {
+			break
+		}
+		if e, _ := sh.keys.get(key); e.expired(now) {
+			sh.drop(key)
+			removed = append(removed, key)
+			expired++
+		}
+	}
+	return removed, sampled, expired
+}
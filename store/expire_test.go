@@ -0,0 +1,83 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestExpireCycle(t *testing.T) {
+	s := New()
+	past, future := time.Now().Add(-time.Second), time.Now().Add(time.Hour)
+	for i := range 100 {
+		s.Set(fmt.Sprintf("expired:%d", i), []byte("v"), SetOptions{ExpireAt: past})
+		s.Set(fmt.Sprintf("volatile:%d", i), []byte("v"), SetOptions{ExpireAt: future})
+		s.Set(fmt.Sprintf("persistent:%d", i), []byte("v"), SetOptions{})
+	}
+	s.Expire("volatile:0", time.Time{})
+	if n := volatileKeys(s); n != 199 {
+		t.Fatalf("Expected 199 keys with an expiration, got %d", n)
+	}
+
+	var removed []string
+	for range 100 {
+		removed = append(removed, s.ExpireCycle(10, time.Second)...)
+	}
+	slices.Sort(removed)
+	if len(removed) != 100 || len(slices.Compact(removed)) != 100 {
+		t.Fatalf("Expected the 100 expired keys to be removed once, got %d", len(removed))
+	}
+	for _, key := range removed {
+		if _, err := fmt.Sscanf(key, "expired:%d", new(int)); err != nil {
+			t.Errorf("Removed %s", key)
+		}
+	}
+	if n := s.Len(); n != 200 {
+		t.Errorf("Expected 200 keys left, got %d", n)
+	}
+	if n := volatileKeys(s); n != 99 {
+		t.Errorf("Expected 99 keys with an expiration left, got %d", n)
+	}
+}
+
+func TestStartExpiry(t *testing.T) {
+	s := New()
+	expired := make(chan []string, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.StartExpiry(ctx, ExpireConfig{
+		Frequency: 5 * time.Millisecond,
+		OnExpire:  func(keys []string) { expired <- keys },
+	})
+
+	s.Set("soon", []byte("v"), SetOptions{ExpireAt: time.Now().Add(20 * time.Millisecond)})
+	select {
+	case keys := <-expired:
+		if !slices.Equal(keys, []string{"soon"}) {
+			t.Errorf("Expected soon to expire, got %v", keys)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected soon to expire without being accessed")
+	}
+	if n := s.Len(); n != 0 {
+		t.Errorf("Expected an empty store, got %d keys", n)
+	}
+
+	// A write finding a key expired reports it with the next cycle
+	s = New()
+	s.StartExpiry(ctx, ExpireConfig{
+		Frequency: time.Hour,
+		OnExpire:  func(keys []string) { expired <- keys },
+	})
+	s.Set("gone", []byte("v"), SetOptions{ExpireAt: time.Now().Add(-time.Second)})
+	s.Set("gone", []byte("again"), SetOptions{})
+	x := s.expiry.Load()
+	x.mu.Lock()
+	pending := slices.Clone(x.pending)
+	x.mu.Unlock()
+	if !slices.Equal(pending, []string{"gone"}) {
+		t.Errorf("Expected gone to be pending, got %v", pending)
+	}
+}
@@ -0,0 +1,45 @@
+package store
+
+// FlushStorage is a Storage that can also count and remove all of its keys,
+// as DBSIZE, FLUSHDB and FLUSHALL need
+type FlushStorage interface {
+	Storage
+	// Len returns the number of keys, including expired ones not removed yet
+	Len() int
+	// Flush removes every key, leaving the values to be freed in the
+	// background if async
+	Flush(async bool) error
+}
+
+var _ FlushStorage = (*Store)(nil)
+
+// keyspace is the keys of the shards of a flushed store, as Flush leaves
+// them to be freed
+type keyspace []dict[*entry]
+
+// Flush removes every key. If async, the keyspace they were in is taken
+// apart by the goroutine freeing the values Unlink leaves, so that flushing
+// a large store costs the caller no more than flushing an empty one, unless
+// a snapshot still reads it.
+func (s *Store) Flush(async bool) error {
+	all := s.allShards()
+	s.lockShards(all)
+	var flushed keyspace
+	for i := range s.shards {
+		sh := &s.shards[i]
+		if async && sh.keys.len() > 0 && len(sh.frozen) == 0 {
+			flushed = append(flushed, sh.keys)
+		}
+		sh.detach()
+		sh.keys, sh.volatile = newDict[*entry](), newDict[struct{}]()
+		sh.used = 0
+	}
+	if q := s.shards[0].sink; q != nil {
+		q.recordFlush()
+	}
+	s.unlock(all)
+	if len(flushed) > 0 {
+		s.lazy.add(flushed)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestFlush(t *testing.T) {
+	s := New()
+	s.Set("a", []byte("1"), SetOptions{ExpireAt: time.Now().Add(time.Hour)})
+	s.UpdateList("list", func(l *List) error {
+		l.PushBack([]byte("v"))
+		return nil
+	})
+
+	if err := s.Flush(false); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if n := s.Len(); n != 0 {
+		t.Errorf("Expected an empty store, got %d keys", n)
+	}
+	if stats, _ := s.MemoryStats(); stats.Bytes != 0 || stats.Expires != 0 {
+		t.Errorf("Expected nothing accounted, got %+v", stats)
+	}
+
+	for i := range 100 {
+		s.Set(fmt.Sprintf("key:%d", i), []byte("v"), SetOptions{})
+	}
+	if err := s.Flush(true); err != nil {
+		t.Fatalf("Flush(true) failed: %v", err)
+	}
+	if n := s.Len(); n != 0 {
+		t.Errorf("Expected an empty store, got %d keys", n)
+	}
+	deadline := time.Now().Add(time.Second)
+	for s.LazyFreeStats().Pending > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if stats := s.LazyFreeStats(); stats.Pending != 0 || stats.Freed != 1 {
+		t.Errorf("Expected the keyspace to be freed in the background, got %+v", stats)
+	}
+
+	// The store keeps working after a flush
+	s.Set("a", []byte("2"), SetOptions{})
+	if value, ok, _ := s.Get("a"); !ok || string(value) != "2" {
+		t.Errorf("Expected a to hold 2, got %q, %v", value, ok)
+	}
+}
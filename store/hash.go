@@ -0,0 +1,287 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"maps"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Errors reported by hash operations
+var (
+	ErrHashNotInteger = errors.New("hash value is not an integer")
+	ErrHashNotFloat   = errors.New("hash value is not a float")
+)
+
+// TypeHash is the Storage.Type of hash keys
+const TypeHash = "hash"
+
+// HashStorage is a Storage that also holds hashes, as the hash commands
+// need. Hashes are handed to fn as a Hash; a Storage keeping them elsewhere
+// decodes them into one built with NewHash and stores it back after fn.
+type HashStorage interface {
+	Storage
+	// ViewHash calls fn with the hash held by key, an empty one if key is
+	// missing. fn must not modify the hash.
+	ViewHash(key string, fn func(h *Hash)) error
+	// UpdateHash calls fn with the hash held by key, an empty one if key is
+	// missing, and stores the result, deleting the key if the hash is left
+	// empty. fn should return an error before changing the hash; the error
+	// is returned.
+	UpdateHash(key string, fn func(h *Hash) error) error
+}
+
+var _ HashStorage = (*Store)(nil)
+
+// Hash maps fields to string values, each of which can expire on its own.
+// Expired fields are treated as missing. It is not safe for concurrent use;
+// Store hands hashes to ViewHash and UpdateHash functions under its lock.
+type Hash struct {
+	fields  dict[[]byte]
+	expires map[string]int64 // unix time in milliseconds of fields that expire
+}
+
+// NewHash returns an empty hash
+func NewHash() *Hash {
+	return &Hash{fields: newDict[[]byte]()}
+}
+
+// expired reports whether field has an expiration at or before now
+func (h *Hash) expired(field string, now int64) bool {
+	at, ok := h.expires[field]
+	return ok && at <= now
+}
+
+// now returns the current time if any field expires, the only case it is needed
+func (h *Hash) now() int64 {
+	if len(h.expires) == 0 {
+		return 0
+	}
+	return nowMillis()
+}
+
+// purge deletes the fields that have expired
+func (h *Hash) purge(now int64) {
+	for field, at := range h.expires {
+		if at <= now {
+			h.fields.delete(field)
+			delete(h.expires, field)
+		}
+	}
+}
+
+// Len returns the number of fields
+func (h *Hash) Len() int {
+	return h.lenAt(h.now())
+}
+
+// lenAt is Len at the time now
+func (h *Hash) lenAt(now int64) int {
+	n := h.fields.len()
+	for _, at := range h.expires {
+		if at <= now {
+			n--
+		}
+	}
+	return n
+}
+
+// clone returns a deep copy of h
+func (h *Hash) clone() *Hash {
+	return &Hash{fields: h.fields.clone(bytes.Clone), expires: maps.Clone(h.expires)}
+}
+
+// Get returns the value of field and whether it exists
+func (h *Hash) Get(field string) ([]byte, bool) {
+	value, ok := h.fields.get(field)
+	if !ok || h.expired(field, h.now()) {
+		return nil, false
+	}
+	return value, true
+}
+
+// Set stores value under field, removing its expiration, and reports
+// whether the field is new
+func (h *Hash) Set(field string, value []byte) bool {
+	expired := h.expired(field, h.now())
+	delete(h.expires, field)
+	return h.fields.set(field, value) || expired
+}
+
+// Delete removes field and reports whether it existed
+func (h *Hash) Delete(field string) bool {
+	expired := h.expired(field, h.now())
+	delete(h.expires, field)
+	return h.fields.delete(field) && !expired
+}
+
+// Range calls fn for every field until it returns false
+func (h *Hash) Range(fn func(field string, value []byte) bool) {
+	now := h.now()
+	h.fields.forEach(func(field string, value []byte) bool {
+		return h.expired(field, now) || fn(field, value)
+	})
+}
+
+// Random returns a random field, not uniformly distributed, and false if the
+// hash is empty
+func (h *Hash) Random() (string, []byte, bool) {
+	now := h.now()
+	for range 16 {
+		field, value, ok := h.fields.random()
+		if !ok {
+			return "", nil, false
+		}
+		if !h.expired(field, now) {
+			return field, value, true
+		}
+	}
+	// Mostly expired: fall back to the first live field
+	var field string
+	var value []byte
+	found := false
+	h.Range(func(f string, v []byte) bool {
+		field, value, found = f, v, true
+		return false
+	})
+	return field, value, found
+}
+
+// Scan returns fields matching match, all if it is empty, from cursor on and
+// the cursor to continue from, as Storage.Scan does for keys
+func (h *Hash) Scan(cursor uint64, match string, count int) ([]string, uint64) {
+	now := h.now()
+	var fields []string
+	next := h.fields.scan(cursor, count, func(field string, _ []byte) bool {
+		if h.expired(field, now) || (match != "" && !Match(match, field)) {
+			return false
+		}
+		fields = append(fields, field)
+		return true
+	})
+	return fields, next
+}
+
+// ExpireTime returns when field expires, zero if it doesn't, and whether it exists
+func (h *Hash) ExpireTime(field string) (time.Time, bool) {
+	if _, ok := h.Get(field); !ok {
+		return time.Time{}, false
+	}
+	if at, ok := h.expires[field]; ok {
+		return time.UnixMilli(at), true
+	}
+	return time.Time{}, true
+}
+
+// Expire sets when field expires, or removes its expiration if at is zero,
+// and reports whether the field exists. A time already passed deletes the
+// field.
+func (h *Hash) Expire(field string, at time.Time) bool {
+	if _, ok := h.Get(field); !ok {
+		return false
+	}
+	switch {
+	case at.IsZero():
+		delete(h.expires, field)
+	case at.UnixMilli() <= nowMillis():
+		h.Delete(field)
+	default:
+		if h.expires == nil {
+			h.expires = make(map[string]int64)
+		}
+		h.expires[field] = at.UnixMilli()
+	}
+	return true
+}
+
+// update replaces the value of an existing or new field, keeping its expiration
+func (h *Hash) update(field string, value []byte) {
+	if _, ok := h.Get(field); !ok {
+		delete(h.expires, field)
+	}
+	h.fields.set(field, value)
+}
+
+// IncrBy adds delta to the integer held by field, a missing field counting as
+// 0, and returns the new value
+func (h *Hash) IncrBy(field string, delta int64) (int64, error) {
+	var n int64
+	if old, ok := h.Get(field); ok {
+		if n, ok = parseInt(old); !ok {
+			return 0, ErrHashNotInteger
+		}
+	}
+	if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+		return 0, ErrOverflow
+	}
+	n += delta
+	h.update(field, strconv.AppendInt(nil, n, 10))
+	return n, nil
+}
+
+// IncrByFloat adds delta to the number held by field, a missing field counting
+// as 0, and returns the new value
+func (h *Hash) IncrByFloat(field string, delta float64) (float64, error) {
+	var f float64
+	if old, ok := h.Get(field); ok {
+		var err error
+		if f, err = strconv.ParseFloat(string(old), 64); err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return 0, ErrHashNotFloat
+		}
+	}
+	f += delta
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, ErrNaN
+	}
+	h.update(field, strconv.AppendFloat(nil, f, 'f', -1, 64))
+	return f, nil
+}
+
+// ViewHash calls fn with the hash held by key, an empty one if key is missing
+func (s *Store) ViewHash(key string, fn func(h *Hash)) error {
+	locked := s.rlock(key)
+	defer s.runlock(locked)
+	e := s.get(key, nowMillis())
+	if e == nil {
+		fn(NewHash())
+		return nil
+	}
+	h, err := valueAs[*Hash](e)
+	if err != nil {
+		return err
+	}
+	fn(h)
+	return nil
+}
+
+// UpdateHash calls fn with the hash held by key, an empty one if key is
+// missing, and deletes the key if fn leaves the hash empty
+func (s *Store) UpdateHash(key string, fn func(h *Hash) error) error {
+	locked := s.lock(key)
+	defer s.unlock(locked)
+	now := nowMillis()
+	e := s.getForWrite(key, now)
+	var h *Hash
+	if e == nil {
+		h = NewHash()
+	} else {
+		var err error
+		if h, err = valueAs[*Hash](e); err != nil {
+			return err
+		}
+		h.purge(now)
+	}
+
+	err := fn(h)
+	switch empty := h.fields.len() == 0; {
+	case empty && e != nil:
+		s.drop(key)
+	case !empty && e == nil:
+		s.put(key, &entry{value: h})
+	case !empty:
+		s.account(key, e)
+	}
+	return err
+}
@@ -0,0 +1,133 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestHashFields(t *testing.T) {
+	h := NewHash()
+	if !h.Set("a", []byte("1")) || h.Set("a", []byte("2")) {
+		t.Error("Expected Set to report only the first write as new")
+	}
+	h.Set("b", []byte("3"))
+	if value, ok := h.Get("a"); !ok || string(value) != "2" {
+		t.Errorf("Expected 2, got %q %v", value, ok)
+	}
+	if !h.Delete("b") || h.Delete("b") {
+		t.Error("Expected Delete to report only the first removal")
+	}
+	if h.Len() != 1 {
+		t.Errorf("Expected 1 field, got %d", h.Len())
+	}
+
+	for i := 0; i < 100; i++ {
+		h.Set(fmt.Sprintf("f%d", i), []byte("v"))
+	}
+	seen := make(map[string]bool)
+	var cursor uint64
+	for {
+		var fields []string
+		fields, cursor = h.Scan(cursor, "f*", 10)
+		for _, field := range fields {
+			seen[field] = true
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+	if len(seen) != 100 {
+		t.Errorf("Expected 100 scanned fields, got %d", len(seen))
+	}
+	if field, _, ok := h.Random(); !ok || field == "" {
+		t.Error("Expected a random field")
+	}
+}
+
+func TestHashFieldExpiration(t *testing.T) {
+	h := NewHash()
+	h.Set("a", []byte("1"))
+	h.Set("b", []byte("2"))
+	at := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	if !h.Expire("a", at) || h.Expire("missing", at) {
+		t.Error("Expected Expire to report whether the field exists")
+	}
+	if got, ok := h.ExpireTime("a"); !ok || !got.Equal(at) {
+		t.Errorf("Expected %v, got %v %v", at, got, ok)
+	}
+	h.Set("a", []byte("1"))
+	if got, _ := h.ExpireTime("a"); !got.IsZero() {
+		t.Error("Expected Set to clear the field's expiration")
+	}
+
+	h.Expire("a", at)
+	if n, _ := h.IncrBy("a", 5); n != 6 {
+		t.Errorf("Expected 6, got %d", n)
+	}
+	if got, _ := h.ExpireTime("a"); !got.Equal(at) {
+		t.Error("Expected IncrBy to keep the field's expiration")
+	}
+	if _, err := h.IncrByFloat("c", 1.5); err != nil {
+		t.Errorf("Expected IncrByFloat to create c, got %v", err)
+	}
+	if _, err := h.IncrBy("c", 1); !errors.Is(err, ErrHashNotInteger) {
+		t.Errorf("Expected ErrHashNotInteger, got %v", err)
+	}
+	h.Delete("c")
+
+	// Expiring a field in the past deletes it, and an expired field is missing
+	h.Expire("b", time.Now().Add(-time.Second))
+	if _, ok := h.Get("b"); ok || h.Len() != 1 {
+		t.Errorf("Expected b to be deleted, %d fields left", h.Len())
+	}
+	h.expires["a"] = nowMillis() - 1
+	if _, ok := h.Get("a"); ok || h.Len() != 0 {
+		t.Error("Expected an expired field to be missing")
+	}
+	if !h.Set("a", []byte("new")) {
+		t.Error("Expected setting an expired field to count as new")
+	}
+}
+
+func TestUpdateHash(t *testing.T) {
+	s := New()
+	err := s.UpdateHash("h", func(h *Hash) error {
+		h.Set("f", []byte("v"))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateHash failed: %v", err)
+	}
+	if typ, _ := s.Type("h"); typ != TypeHash {
+		t.Errorf("Expected %s, got %s", TypeHash, typ)
+	}
+	if _, _, err := s.Get("h"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType from Get, got %v", err)
+	}
+
+	s.UpdateHash("h", func(h *Hash) error {
+		h.Delete("f")
+		return nil
+	})
+	if n, _ := s.Exists("h"); n != 0 {
+		t.Error("Expected an empty hash to delete the key")
+	}
+
+	s.Set("str", []byte("v"), SetOptions{})
+	if err := s.ViewHash("str", func(h *Hash) {}); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType from ViewHash, got %v", err)
+	}
+
+	// A hash whose fields all expired reads as a missing key
+	s.UpdateHash("h", func(h *Hash) error {
+		h.Set("f", []byte("v"))
+		h.Expire("f", time.Now().Add(time.Hour))
+		h.expires["f"] = nowMillis() - 1
+		return nil
+	})
+	if n, _ := s.Exists("h"); n != 0 {
+		t.Error("Expected a hash with only expired fields to be missing")
+	}
+}
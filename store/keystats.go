@@ -0,0 +1,109 @@
+package store
+
+import (
+	"cmp"
+	"container/heap"
+	"slices"
+)
+
+// KeyStat is a key of a BigKeys or HotKeys report
+type KeyStat struct {
+	Key  string
+	Type string
+	// Bytes is the approximate bytes the key and its value take, as the
+	// memory accounting estimates them
+	Bytes int64
+	// Elements is the number of elements of a collection, 1 for a string
+	// or a Value
+	Elements int
+	// Freq is the access frequency counter, as Object reports it
+	Freq int
+}
+
+// KeyStatsStorage is a Storage that can also find its largest and most
+// accessed keys, as DEBUG BIGKEYS and HOTKEYS need
+type KeyStatsStorage interface {
+	Storage
+	// BigKeys returns up to n of the keys taking the most memory, largest
+	// first
+	BigKeys(n int) ([]KeyStat, error)
+	// HotKeys returns up to n of the keys with the highest access frequency,
+	// hottest first
+	HotKeys(n int) ([]KeyStat, error)
+}
+
+var _ KeyStatsStorage = (*Store)(nil)
+
+// BigKeys returns up to n of the keys taking the most memory, largest first,
+// as the memory accounting estimates them, without counting as accesses
+func (s *Store) BigKeys(n int) ([]KeyStat, error) {
+	return s.topKeys(n, func(k KeyStat) int64 { return k.Bytes }), nil
+}
+
+// HotKeys returns up to n of the keys with the highest access frequency
+// counter, hottest first, without counting as accesses
+func (s *Store) HotKeys(n int) ([]KeyStat, error) {
+	return s.topKeys(n, func(k KeyStat) int64 { return int64(k.Freq) }), nil
+}
+
+// topKeys returns up to n of the live keys scoring highest, highest first
+// and in the order of their names for equal scores. It goes through the
+// shards one at a time, holding each for reading.
+func (s *Store) topKeys(n int, score func(k KeyStat) int64) []KeyStat {
+	if n <= 0 {
+		return nil
+	}
+	top := &rankedKeys{score: score}
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.RLock()
+		now := nowMillis()
+		sh.keys.forEach(func(key string, e *entry) bool {
+			if e.expired(now) {
+				return true
+			}
+			k := KeyStat{Key: key, Type: e.typeName(), Bytes: e.size, Elements: effort(e.value), Freq: e.counter(now)}
+			if top.Len() < n {
+				heap.Push(top, k)
+			} else if top.less(top.keys[0], k) {
+				top.keys[0] = k
+				heap.Fix(top, 0)
+			}
+			return true
+		})
+		sh.mu.RUnlock()
+	}
+	slices.SortFunc(top.keys, func(a, b KeyStat) int {
+		if c := cmp.Compare(score(b), score(a)); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Key, b.Key)
+	})
+	return top.keys
+}
+
+// rankedKeys is a min-heap of keys by score, the lowest of the highest
+// scoring keys kept at the top so it is the one replaced
+type rankedKeys struct {
+	keys  []KeyStat
+	score func(k KeyStat) int64
+}
+
+// less reports whether a ranks below b: a lower score, or a later name for
+// equal ones
+func (r *rankedKeys) less(a, b KeyStat) bool {
+	if sa, sb := r.score(a), r.score(b); sa != sb {
+		return sa < sb
+	}
+	return a.Key > b.Key
+}
+
+func (r *rankedKeys) Len() int           { return len(r.keys) }
+func (r *rankedKeys) Less(i, j int) bool { return r.less(r.keys[i], r.keys[j]) }
+func (r *rankedKeys) Swap(i, j int)      { r.keys[i], r.keys[j] = r.keys[j], r.keys[i] }
+func (r *rankedKeys) Push(x any)         { r.keys = append(r.keys, x.(KeyStat)) }
+func (r *rankedKeys) Pop() any {
+	k := r.keys[len(r.keys)-1]
+	r.keys = r.keys[:len(r.keys)-1]
+	return k
+}
@@ -0,0 +1,66 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBigKeys(t *testing.T) {
+	s := New()
+	s.Set("small", []byte("v"), SetOptions{})
+	s.Set("medium", []byte(strings.Repeat("x", 1000)), SetOptions{})
+	s.Set("large", []byte(strings.Repeat("x", 10000)), SetOptions{})
+	s.Set("gone", []byte(strings.Repeat("x", 100000)), SetOptions{ExpireAt: time.Now().Add(-time.Second)})
+	s.UpdateSet("set", func(set *Set) error {
+		for i := range 200 {
+			set.Add(fmt.Sprint(i))
+		}
+		return nil
+	})
+
+	keys, err := s.BigKeys(3)
+	if err != nil {
+		t.Fatalf("BigKeys failed: %v", err)
+	}
+	if len(keys) != 3 || keys[0].Key != "large" || keys[1].Key != "set" || keys[2].Key != "medium" {
+		t.Fatalf("Expected large, set and medium, got %+v", keys)
+	}
+	if keys[0].Type != TypeString || keys[0].Elements != 1 {
+		t.Errorf("Expected a string of 1 element, got %+v", keys[0])
+	}
+	if keys[1].Type != TypeSet || keys[1].Elements != 200 {
+		t.Errorf("Expected a set of 200 elements, got %+v", keys[1])
+	}
+	if keys, _ := s.BigKeys(1000); len(keys) != 4 {
+		t.Errorf("Expected every live key, got %d", len(keys))
+	}
+	if keys, _ := s.BigKeys(0); len(keys) != 0 {
+		t.Errorf("Expected no keys for a count of 0, got %d", len(keys))
+	}
+}
+
+func TestHotKeys(t *testing.T) {
+	s := New()
+	for _, key := range []string{"a", "b", "c", "d"} {
+		s.Set(key, []byte("v"), SetOptions{})
+	}
+	for range 5000 {
+		s.Get("c")
+	}
+
+	keys, _ := s.HotKeys(2)
+	if len(keys) != 2 || keys[0].Key != "c" || keys[1].Key != "a" {
+		t.Fatalf("Expected c, then a first of the keys left at equal counters, got %+v", keys)
+	}
+	if keys[0].Freq <= keys[1].Freq {
+		t.Errorf("Expected the hottest key first, got %+v", keys)
+	}
+	// Reporting doesn't count as an access
+	before := keys[0].Freq
+	s.HotKeys(4)
+	if keys, _ := s.HotKeys(1); keys[0].Freq != before {
+		t.Errorf("Expected the counter to stay at %d, got %d", before, keys[0].Freq)
+	}
+}
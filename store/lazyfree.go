@@ -0,0 +1,180 @@
+package store
+
+import (
+	"runtime"
+	"sync"
+)
+
+// lazyFreeThreshold is the number of elements above which Unlink leaves a
+// value to the background, as Redis' LAZYFREE_THRESHOLD
+const lazyFreeThreshold = 64
+
+// lazyFreeBatch is the number of elements the background goroutine releases
+// before yielding to the serving goroutines
+const lazyFreeBatch = 1024
+
+// LazyFreeStats counts the values Unlink left to be freed in the background,
+// and the keyspaces an asynchronous Flush left
+type LazyFreeStats struct {
+	Pending int    // values waiting to be freed or being freed
+	Freed   uint64 // values freed since the store was created
+}
+
+// LazyFreeStorage is a Storage that can also remove keys without freeing
+// their values on the caller's goroutine, as UNLINK needs
+type LazyFreeStorage interface {
+	Storage
+	// Unlink removes keys as Delete does, leaving large values to be freed
+	// in the background, and returns how many existed
+	Unlink(keys ...string) (int, error)
+	// LazyFreeStats returns the counts of the values left to the background
+	LazyFreeStats() LazyFreeStats
+}
+
+var _ LazyFreeStorage = (*Store)(nil)
+
+// lazyFree queues the values removed by Unlink for a goroutine that takes
+// them apart, started by the first value queued and done once the queue
+// drains
+type lazyFree struct {
+	mu      sync.Mutex
+	queue   []any
+	running bool
+	freed   uint64
+}
+
+// effort returns the number of elements of v, the work of freeing it
+func effort(v any) int {
+	switch v := v.(type) {
+	case *Hash:
+		return v.fields.len()
+	case *List:
+		return v.Len()
+	case *Set:
+		return v.Len()
+	case *ZSet:
+		return v.Len()
+	case *Stream:
+		return len(v.entries)
+	default:
+		return 1
+	}
+}
+
+// add queues values to be freed, starting the goroutine freeing them unless
+// it runs already
+func (l *lazyFree) add(values ...any) {
+	if len(values) == 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.queue = append(l.queue, values...)
+	if !l.running {
+		l.running = true
+		go l.run()
+	}
+}
+
+// run frees the queued values until none is left
+func (l *lazyFree) run() {
+	for {
+		l.mu.Lock()
+		if len(l.queue) == 0 {
+			l.running = false
+			l.queue = nil
+			l.mu.Unlock()
+			return
+		}
+		v := l.queue[0]
+		l.mu.Unlock()
+
+		release(v)
+
+		l.mu.Lock()
+		l.queue[0] = nil
+		l.queue = l.queue[1:]
+		l.freed++
+		l.mu.Unlock()
+	}
+}
+
+func (l *lazyFree) stats() LazyFreeStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return LazyFreeStats{Pending: len(l.queue), Freed: l.freed}
+}
+
+// release drops the references v holds to its elements a batch at a time,
+// so that the garbage collector can reclaim them while the goroutines
+// serving commands keep running. No one else references a value once it
+// is removed from the keyspace.
+func release(v any) {
+	switch v := v.(type) {
+	case *Hash:
+		releaseDict(&v.fields)
+		v.expires = nil
+	case *List:
+		for i := 0; i < len(v.items); i += lazyFreeBatch {
+			clear(v.items[i:min(i+lazyFreeBatch, len(v.items))])
+			runtime.Gosched()
+		}
+		*v = List{}
+	case *Set:
+		if v.members != nil {
+			releaseDict(v.members)
+		}
+		*v = Set{}
+	case *ZSet:
+		releaseDict(&v.scores)
+		v.list = newSkiplist()
+	case *Stream:
+		for i := 0; i < len(v.entries); i += lazyFreeBatch {
+			clear(v.entries[i:min(i+lazyFreeBatch, len(v.entries))])
+			runtime.Gosched()
+		}
+		v.entries = nil
+	case keyspace:
+		for i := range v {
+			releaseDict(&v[i])
+		}
+	}
+}
+
+// releaseDict empties d a batch of buckets at a time
+func releaseDict[V any](d *dict[V]) {
+	batch := max(lazyFreeBatch/bucketLoad, 1)
+	for i := 0; i < len(d.buckets); i += batch {
+		clear(d.buckets[i:min(i+batch, len(d.buckets))])
+		runtime.Gosched()
+	}
+	*d = newDict[V]()
+}
+
+// Unlink removes keys as Delete does and returns how many existed. Values
+// of more than lazyFreeThreshold elements are taken apart by a background
+// goroutine instead of the caller's.
+func (s *Store) Unlink(keys ...string) (int, error) {
+	locked := s.lock(keys...)
+	now := nowMillis()
+	deleted := 0
+	var large []any
+	for _, key := range keys {
+		if e := s.getForWrite(key, now); e != nil {
+			if effort(e.value) > lazyFreeThreshold {
+				large = append(large, e.value)
+			}
+			s.drop(key)
+			deleted++
+		}
+	}
+	s.unlock(locked)
+	s.lazy.add(large...)
+	return deleted, nil
+}
+
+// LazyFreeStats returns the counts of the values Unlink left to the
+// background
+func (s *Store) LazyFreeStats() LazyFreeStats {
+	return s.lazy.stats()
+}
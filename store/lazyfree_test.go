@@ -0,0 +1,49 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestUnlink(t *testing.T) {
+	s := New()
+	s.Set("small", []byte("v"), SetOptions{})
+	s.UpdateSet("big", func(set *Set) error {
+		for i := range 10000 {
+			set.Add(fmt.Sprintf("member:%d", i))
+		}
+		return nil
+	})
+	s.UpdateList("list", func(l *List) error {
+		for range 10 {
+			l.PushBack([]byte("v"))
+		}
+		return nil
+	})
+	big := entryOf(s, "big")
+	set := big.value.(*Set)
+
+	n, err := s.Unlink("small", "big", "list", "missing")
+	if err != nil || n != 3 {
+		t.Fatalf("Expected 3 keys unlinked, got %d, %v", n, err)
+	}
+	if n := s.Len(); n != 0 {
+		t.Errorf("Expected an empty store, got %d keys", n)
+	}
+	if stats, _ := s.MemoryStats(); stats.Bytes != 0 {
+		t.Errorf("Expected no memory accounted, got %d bytes", stats.Bytes)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for s.LazyFreeStats().Pending > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	// Only the set is large enough to be left to the background
+	if stats := s.LazyFreeStats(); stats != (LazyFreeStats{Freed: 1}) {
+		t.Errorf("Expected the set to be freed, got %+v", stats)
+	}
+	if n := set.Len(); n != 0 {
+		t.Errorf("Expected the freed set to be empty, got %d members", n)
+	}
+}
@@ -0,0 +1,306 @@
+package store
+
+import "bytes"
+
+// TypeList is the Storage.Type of list keys
+const TypeList = "list"
+
+// ListStorage is a Storage that also holds lists, as the list commands need.
+// Lists are handed to fn as a List, as HashStorage does with hashes.
+type ListStorage interface {
+	Storage
+	// ViewList calls fn with the list held by key, an empty one if key is
+	// missing. fn must not modify the list.
+	ViewList(key string, fn func(l *List)) error
+	// UpdateList calls fn with the list held by key, an empty one if key is
+	// missing, and stores the result, deleting the key if the list is left
+	// empty. fn should return an error before changing the list; the error
+	// is returned.
+	UpdateList(key string, fn func(l *List) error) error
+	// UpdateLists is UpdateList for several keys at once, as LMOVE needs.
+	// lists[i] is the list of keys[i]; a key given twice gets the same list.
+	UpdateLists(keys []string, fn func(lists []*List) error) error
+}
+
+var _ ListStorage = (*Store)(nil)
+
+// List is a sequence of string elements, a double-ended queue that adds and
+// removes elements at both ends and reads any index in constant time.
+// Negative indexes count from the end, -1 being the last element. It is not
+// safe for concurrent use.
+type List struct {
+	items [][]byte // ring buffer whose length is a power of two, or nil
+	head  int      // index in items of the first element
+	n     int
+}
+
+// NewList returns an empty list
+func NewList() *List {
+	return &List{}
+}
+
+// Len returns the number of elements
+func (l *List) Len() int {
+	return l.n
+}
+
+// clone returns a deep copy of l
+func (l *List) clone() *List {
+	c := &List{n: l.n}
+	if l.n > 0 {
+		c.items = make([][]byte, len(l.items))
+		for i := range l.n {
+			c.items[i] = bytes.Clone(l.items[l.slot(i)])
+		}
+	}
+	return c
+}
+
+// slot returns the position in items of the element at index i
+func (l *List) slot(i int) int {
+	return (l.head + i) & (len(l.items) - 1)
+}
+
+// index resolves a possibly negative index and reports whether it is in range
+func (l *List) index(i int) (int, bool) {
+	if i < 0 {
+		i += l.n
+	}
+	return i, i >= 0 && i < l.n
+}
+
+// resize moves the elements to a ring buffer of size capacity
+func (l *List) resize(capacity int) {
+	items := make([][]byte, capacity)
+	for i := 0; i < l.n; i++ {
+		items[i] = l.items[l.slot(i)]
+	}
+	l.items, l.head = items, 0
+}
+
+// grow makes room for one more element
+func (l *List) grow() {
+	if l.n == len(l.items) {
+		l.resize(max(4, 2*len(l.items)))
+	}
+}
+
+// shrink gives memory back once the list uses a quarter of it
+func (l *List) shrink() {
+	if len(l.items) > 16 && l.n < len(l.items)/4 {
+		l.resize(len(l.items) / 2)
+	}
+}
+
+// Index returns the element at index i and whether it exists
+func (l *List) Index(i int) ([]byte, bool) {
+	i, ok := l.index(i)
+	if !ok {
+		return nil, false
+	}
+	return l.items[l.slot(i)], true
+}
+
+// Set replaces the element at index i and reports whether it exists
+func (l *List) Set(i int, value []byte) bool {
+	i, ok := l.index(i)
+	if ok {
+		l.items[l.slot(i)] = value
+	}
+	return ok
+}
+
+// PushFront adds value before the first element
+func (l *List) PushFront(value []byte) {
+	l.grow()
+	l.head = (l.head - 1) & (len(l.items) - 1)
+	l.items[l.head] = value
+	l.n++
+}
+
+// PushBack adds value after the last element
+func (l *List) PushBack(value []byte) {
+	l.grow()
+	l.items[l.slot(l.n)] = value
+	l.n++
+}
+
+// PopFront removes and returns the first element
+func (l *List) PopFront() ([]byte, bool) {
+	if l.n == 0 {
+		return nil, false
+	}
+	value := l.items[l.head]
+	l.items[l.head] = nil
+	l.head = l.slot(1)
+	l.n--
+	l.shrink()
+	return value, true
+}
+
+// PopBack removes and returns the last element
+func (l *List) PopBack() ([]byte, bool) {
+	if l.n == 0 {
+		return nil, false
+	}
+	s := l.slot(l.n - 1)
+	value := l.items[s]
+	l.items[s] = nil
+	l.n--
+	l.shrink()
+	return value, true
+}
+
+// Insert adds value at index i, 0 to Len, moving the elements from i on back
+// by one, and reports whether i was in range
+func (l *List) Insert(i int, value []byte) bool {
+	if i < 0 || i > l.n {
+		return false
+	}
+	l.grow()
+	// Move whichever side of i is shorter
+	if i < l.n/2 {
+		l.head = (l.head - 1) & (len(l.items) - 1)
+		for j := 0; j < i; j++ {
+			l.items[l.slot(j)] = l.items[l.slot(j+1)]
+		}
+	} else {
+		for j := l.n; j > i; j-- {
+			l.items[l.slot(j)] = l.items[l.slot(j-1)]
+		}
+	}
+	l.items[l.slot(i)] = value
+	l.n++
+	return true
+}
+
+// Remove deletes the element at index i and reports whether it existed
+func (l *List) Remove(i int) bool {
+	i, ok := l.index(i)
+	if !ok {
+		return false
+	}
+	if i < l.n/2 {
+		for j := i; j > 0; j-- {
+			l.items[l.slot(j)] = l.items[l.slot(j-1)]
+		}
+		l.items[l.head] = nil
+		l.head = l.slot(1)
+	} else {
+		for j := i; j < l.n-1; j++ {
+			l.items[l.slot(j)] = l.items[l.slot(j+1)]
+		}
+		l.items[l.slot(l.n-1)] = nil
+	}
+	l.n--
+	l.shrink()
+	return true
+}
+
+// Trim keeps only the elements from start to stop, both inclusive and
+// possibly negative, emptying the list if the range is empty
+func (l *List) Trim(start, stop int) {
+	start, stop, ok := NormalizeRange(start, stop, l.n)
+	if !ok {
+		start, stop = l.n, l.n-1
+	}
+	for range l.n - 1 - stop {
+		l.PopBack()
+	}
+	for range start {
+		l.PopFront()
+	}
+}
+
+// RemoveValue deletes elements equal to value and returns how many: the
+// first count of them if count is positive, the last -count if negative,
+// all if 0
+func (l *List) RemoveValue(value []byte, count int) int {
+	removed := 0
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+	// Pack the kept elements at the end the count starts from
+	if count >= 0 {
+		w := 0
+		for r := 0; r < l.n; r++ {
+			item := l.items[l.slot(r)]
+			if (limit == 0 || removed < limit) && bytes.Equal(item, value) {
+				removed++
+				continue
+			}
+			l.items[l.slot(w)] = item
+			w++
+		}
+		for j := w; j < l.n; j++ {
+			l.items[l.slot(j)] = nil
+		}
+	} else {
+		w := l.n - 1
+		for r := l.n - 1; r >= 0; r-- {
+			item := l.items[l.slot(r)]
+			if removed < limit && bytes.Equal(item, value) {
+				removed++
+				continue
+			}
+			l.items[l.slot(w)] = item
+			w--
+		}
+		for j := 0; j <= w; j++ {
+			l.items[l.slot(j)] = nil
+		}
+		l.head = l.slot(removed)
+	}
+	l.n -= removed
+	l.shrink()
+	return removed
+}
+
+// Range calls fn for the elements from start to stop, both inclusive and
+// possibly negative, until it returns false
+func (l *List) Range(start, stop int, fn func(i int, value []byte) bool) {
+	start, stop, ok := NormalizeRange(start, stop, l.n)
+	if !ok {
+		return
+	}
+	for i := start; i <= stop; i++ {
+		if !fn(i, l.items[l.slot(i)]) {
+			return
+		}
+	}
+}
+
+// NormalizeRange resolves the possibly negative start and stop offsets of a
+// sequence of length n the way LRANGE does, clamping them to the sequence,
+// and reports whether the range holds any element
+func NormalizeRange(start, stop, n int) (int, int, bool) {
+	if start < 0 {
+		start = max(n+start, 0)
+	}
+	if stop < 0 {
+		stop += n
+	}
+	stop = min(stop, n-1)
+	return start, stop, start <= stop && start < n
+}
+
+// ViewList calls fn with the list held by key, an empty one if key is missing
+func (s *Store) ViewList(key string, fn func(l *List)) error {
+	return viewValues(s, []string{key}, NewList, func(lists []*List) {
+		fn(lists[0])
+	})
+}
+
+// UpdateList calls fn with the list held by key, an empty one if key is
+// missing, and deletes the key if fn leaves the list empty
+func (s *Store) UpdateList(key string, fn func(l *List) error) error {
+	return s.UpdateLists([]string{key}, func(lists []*List) error {
+		return fn(lists[0])
+	})
+}
+
+// UpdateLists is UpdateList for several keys at once
+func (s *Store) UpdateLists(keys []string, fn func(lists []*List) error) error {
+	return updateValues(s, keys, NewList, fn)
+}
@@ -0,0 +1,147 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// listStrings returns the elements of l as strings
+func listStrings(l *List) []string {
+	var values []string
+	l.Range(0, -1, func(_ int, value []byte) bool {
+		values = append(values, string(value))
+		return true
+	})
+	return values
+}
+
+func TestListEnds(t *testing.T) {
+	l := NewList()
+	// Wrap the ring buffer around and grow it several times
+	for i := 0; i < 50; i++ {
+		l.PushBack([]byte(fmt.Sprint(i)))
+		l.PushFront([]byte(fmt.Sprint(-i - 1)))
+	}
+	if l.Len() != 100 {
+		t.Fatalf("Expected 100 elements, got %d", l.Len())
+	}
+	if value, _ := l.Index(0); string(value) != "-50" {
+		t.Errorf("Expected -50 first, got %q", value)
+	}
+	if value, _ := l.Index(-1); string(value) != "49" {
+		t.Errorf("Expected 49 last, got %q", value)
+	}
+	if _, ok := l.Index(100); ok {
+		t.Error("Expected index 100 to be out of range")
+	}
+	for i := 0; i < 98; i++ {
+		l.PopFront()
+	}
+	if got := fmt.Sprint(listStrings(l)); got != "[48 49]" {
+		t.Errorf("Expected [48 49], got %s", got)
+	}
+	l.PopBack()
+	l.PopBack()
+	if _, ok := l.PopBack(); ok || l.Len() != 0 {
+		t.Error("Expected an empty list")
+	}
+}
+
+func TestListEdits(t *testing.T) {
+	l := NewList()
+	for _, value := range []string{"a", "b", "a", "c", "a"} {
+		l.PushBack([]byte(value))
+	}
+	l.Insert(1, []byte("x"))
+	l.Insert(5, []byte("y"))
+	if got := fmt.Sprint(listStrings(l)); got != "[a x b a c y a]" {
+		t.Errorf("Expected [a x b a c y a], got %s", got)
+	}
+	if l.Insert(8, []byte("z")) {
+		t.Error("Expected Insert past the end to fail")
+	}
+	l.Remove(1)
+	l.Remove(-2)
+	l.Set(-1, []byte("d"))
+	if got := fmt.Sprint(listStrings(l)); got != "[a b a c d]" {
+		t.Errorf("Expected [a b a c d], got %s", got)
+	}
+
+	l.PushBack([]byte("a"))
+	if n := l.RemoveValue([]byte("a"), -1); n != 1 {
+		t.Errorf("Expected 1 removed, got %d", n)
+	}
+	if n := l.RemoveValue([]byte("a"), 1); n != 1 {
+		t.Errorf("Expected 1 removed, got %d", n)
+	}
+	if got := fmt.Sprint(listStrings(l)); got != "[b a c d]" {
+		t.Errorf("Expected [b a c d], got %s", got)
+	}
+	l.Trim(1, -2)
+	if got := fmt.Sprint(listStrings(l)); got != "[a c]" {
+		t.Errorf("Expected [a c], got %s", got)
+	}
+	l.Trim(5, 10)
+	if l.Len() != 0 {
+		t.Error("Expected an empty range to empty the list")
+	}
+}
+
+func TestNormalizeRange(t *testing.T) {
+	tests := []struct {
+		start, stop, n      int
+		wantStart, wantStop int
+		ok                  bool
+	}{
+		{0, -1, 5, 0, 4, true},
+		{-100, 100, 5, 0, 4, true},
+		{-2, -1, 5, 3, 4, true},
+		{3, 1, 5, 3, 1, false},
+		{5, 10, 5, 5, 4, false},
+		{0, -1, 0, 0, -1, false},
+	}
+	for _, tt := range tests {
+		start, stop, ok := NormalizeRange(tt.start, tt.stop, tt.n)
+		if start != tt.wantStart || stop != tt.wantStop || ok != tt.ok {
+			t.Errorf("NormalizeRange(%d, %d, %d) = %d, %d, %v", tt.start, tt.stop, tt.n, start, stop, ok)
+		}
+	}
+}
+
+func TestUpdateLists(t *testing.T) {
+	s := New()
+	err := s.UpdateLists([]string{"a", "b", "a"}, func(lists []*List) error {
+		if lists[0] != lists[2] {
+			t.Error("Expected a key given twice to get the same list")
+		}
+		lists[0].PushBack([]byte("1"))
+		lists[1].PushBack([]byte("2"))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateLists failed: %v", err)
+	}
+	if typ, _ := s.Type("a"); typ != TypeList {
+		t.Errorf("Expected %s, got %s", TypeList, typ)
+	}
+
+	s.UpdateLists([]string{"a", "b"}, func(lists []*List) error {
+		v, _ := lists[0].PopFront()
+		lists[1].PushBack(v)
+		return nil
+	})
+	if n, _ := s.Exists("a", "b"); n != 1 {
+		t.Errorf("Expected the emptied list to be deleted, %d keys exist", n)
+	}
+	s.ViewList("b", func(l *List) {
+		if got := fmt.Sprint(listStrings(l)); got != "[2 1]" {
+			t.Errorf("Expected [2 1], got %s", got)
+		}
+	})
+
+	s.Set("str", []byte("v"), SetOptions{})
+	if err := s.UpdateList("str", func(l *List) error { return nil }); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+}
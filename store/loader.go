@@ -0,0 +1,131 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by a Loader for a key the backing system doesn't
+// have either, so that GetOrLoad reports it missing
+var ErrNotFound = errors.New("key not found")
+
+// Loader fetches the string value of a key missing from the store from the
+// system the store caches, such as a database or an upstream API, along
+// with how long to keep it, zero or less for no expiration. It returns
+// ErrNotFound if that system doesn't have the key either.
+type Loader func(ctx context.Context, key string) (value []byte, ttl time.Duration, err error)
+
+// LoaderStorage is a Storage that can also fill the keys GET misses from a
+// backing system, as cache-aside applications need
+type LoaderStorage interface {
+	Storage
+	// GetOrLoad returns the string value of key as Get does, loading and
+	// storing it first if key is missing
+	GetOrLoad(ctx context.Context, key string) ([]byte, bool, error)
+}
+
+var _ LoaderStorage = (*Store)(nil)
+
+// loads are the Loader of a store and the loads it is running
+type loads struct {
+	mu      sync.Mutex
+	loader  Loader
+	running map[string]*load
+}
+
+// load is a call of the Loader that the GetOrLoad calls for a key share
+type load struct {
+	done  chan struct{}
+	value []byte
+	ok    bool
+	err   error
+}
+
+// SetLoader sets the Loader GetOrLoad calls for missing keys, replacing that
+// of an earlier call; nil removes it. Loads already running finish with the
+// Loader they started with.
+func (s *Store) SetLoader(loader Loader) {
+	s.loads.mu.Lock()
+	defer s.loads.mu.Unlock()
+	s.loads.loader = loader
+}
+
+// GetOrLoad returns the string value of key and whether it exists, as Get
+// does. If key is missing and a Loader is set it loads the value and stores
+// it with the TTL the Loader gave, unless key was written in the meantime,
+// whose value it returns instead. Concurrent calls for the same key share
+// one load, which runs until the Loader returns even if ctx is done first:
+// ctx only bounds how long the caller waits for it.
+func (s *Store) GetOrLoad(ctx context.Context, key string) ([]byte, bool, error) {
+	value, ok, err := s.Get(key)
+	if ok || err != nil {
+		return value, ok, err
+	}
+	s.loads.mu.Lock()
+	loader := s.loads.loader
+	if loader == nil {
+		s.loads.mu.Unlock()
+		return nil, false, nil
+	}
+	l, running := s.loads.running[key]
+	if !running {
+		l = &load{done: make(chan struct{})}
+		if s.loads.running == nil {
+			s.loads.running = make(map[string]*load)
+		}
+		s.loads.running[key] = l
+		go s.load(context.WithoutCancel(ctx), key, loader, l)
+	}
+	s.loads.mu.Unlock()
+
+	select {
+	case <-l.done:
+		return l.value, l.ok, l.err
+	case <-ctx.Done():
+		return nil, false, context.Cause(ctx)
+	}
+}
+
+// load runs loader for key and stores what it returns, then reports it to
+// the GetOrLoad calls waiting on l. A panic of loader is reported to them
+// as an error, as it runs on a goroutine of its own.
+func (s *Store) load(ctx context.Context, key string, loader Loader, l *load) {
+	defer func() {
+		if r := recover(); r != nil {
+			l.value, l.ok, l.err = nil, false, fmt.Errorf("loader panicked: %v", r)
+		}
+		s.loads.mu.Lock()
+		delete(s.loads.running, key)
+		s.loads.mu.Unlock()
+		close(l.done)
+	}()
+	value, ttl, err := loader(ctx, key)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return
+	case err != nil:
+		l.err = err
+		return
+	case len(value) > MaxStringSize:
+		l.err = ErrTooLarge
+		return
+	}
+
+	locked := s.lock(key)
+	defer s.unlock(locked)
+	now := nowMillis()
+	if e := s.getForWrite(key, now); e != nil {
+		l.value, l.err = valueAs[[]byte](e)
+		l.ok = l.err == nil
+		return
+	}
+	e := &entry{value: value}
+	if ttl > 0 {
+		e.expireAt = now + max(ttl.Milliseconds(), 1)
+	}
+	s.put(key, e)
+	l.value, l.ok = value, true
+}
@@ -0,0 +1,133 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetOrLoad(t *testing.T) {
+	s := New()
+	ctx := context.Background()
+	if _, ok, err := s.GetOrLoad(ctx, "k"); ok || err != nil {
+		t.Fatalf("Expected a miss without a Loader, got %v, %v", ok, err)
+	}
+
+	failed := errors.New("upstream down")
+	s.SetLoader(func(ctx context.Context, key string) ([]byte, time.Duration, error) {
+		switch key {
+		case "missing":
+			return nil, 0, ErrNotFound
+		case "failing":
+			return nil, 0, failed
+		case "forever":
+			return []byte("v"), 0, nil
+		case "panicking":
+			panic("boom")
+		}
+		return []byte("loaded:" + key), time.Hour, nil
+	})
+	value, ok, err := s.GetOrLoad(ctx, "k")
+	if !ok || err != nil || string(value) != "loaded:k" {
+		t.Fatalf("Expected the loaded value, got %q, %v, %v", value, ok, err)
+	}
+	if value, _, _ := s.Get("k"); string(value) != "loaded:k" {
+		t.Errorf("Expected the loaded value to be stored, got %q", value)
+	}
+	if at, _, _ := s.ExpireTime("k"); at.IsZero() || time.Until(at) > time.Hour {
+		t.Errorf("Expected the key to expire within the hour, got %v", at)
+	}
+	if _, ok, _ := s.GetOrLoad(ctx, "forever"); !ok {
+		t.Error("Expected the key to be loaded")
+	}
+	if at, _, _ := s.ExpireTime("forever"); !at.IsZero() {
+		t.Errorf("Expected no expiration for a zero TTL, got %v", at)
+	}
+
+	if _, ok, err := s.GetOrLoad(ctx, "missing"); ok || err != nil {
+		t.Errorf("Expected ErrNotFound to be a miss, got %v, %v", ok, err)
+	}
+	if _, ok, err := s.GetOrLoad(ctx, "failing"); ok || !errors.Is(err, failed) {
+		t.Errorf("Expected the Loader's error, got %v, %v", ok, err)
+	}
+	if _, ok, err := s.GetOrLoad(ctx, "panicking"); ok || err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("Expected the Loader's panic as an error, got %v, %v", ok, err)
+	}
+	if n := s.Len(); n != 2 {
+		t.Errorf("Expected only the loaded keys stored, got %d keys", n)
+	}
+
+	s.UpdateHash("hash", func(h *Hash) error {
+		h.Set("f", []byte("v"))
+		return nil
+	})
+	if _, _, err := s.GetOrLoad(ctx, "hash"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+	if stats, _ := s.MemoryStats(); stats.Bytes != accounted(s) {
+		t.Errorf("Accounted %d bytes, expected %d", stats.Bytes, accounted(s))
+	}
+}
+
+func TestGetOrLoadConcurrent(t *testing.T) {
+	s := New()
+	var calls atomic.Int32
+	release := make(chan struct{})
+	s.SetLoader(func(ctx context.Context, key string) ([]byte, time.Duration, error) {
+		calls.Add(1)
+		<-release
+		return []byte("v"), 0, nil
+	})
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if value, ok, err := s.GetOrLoad(context.Background(), "k"); !ok || err != nil || string(value) != "v" {
+				t.Errorf("Expected the loaded value, got %q, %v, %v", value, ok, err)
+			}
+		}()
+	}
+
+	// A waiter giving up doesn't stop the load the others wait on
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := s.GetOrLoad(ctx, "k"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the deadline to end the wait, got %v", err)
+	}
+	close(release)
+	wg.Wait()
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected one load shared by every call, got %d", n)
+	}
+}
+
+func TestGetOrLoadWritten(t *testing.T) {
+	s := New()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s.SetLoader(func(ctx context.Context, key string) ([]byte, time.Duration, error) {
+		close(started)
+		<-release
+		return []byte("stale"), 0, nil
+	})
+	done := make(chan []byte)
+	go func() {
+		value, _, _ := s.GetOrLoad(context.Background(), "k")
+		done <- value
+	}()
+	<-started
+	s.Set("k", []byte("fresh"), SetOptions{})
+	close(release)
+	if value := <-done; string(value) != "fresh" {
+		t.Errorf("Expected the value written during the load, got %q", value)
+	}
+	if value, _, _ := s.Get("k"); string(value) != "fresh" {
+		t.Errorf("Expected the load not to overwrite the key, got %q", value)
+	}
+}
@@ -0,0 +1,180 @@
+package store
+
+// Approximate sizes in bytes of what keys and values are made of on a 64-bit
+// platform, beyond the bytes of the strings themselves: headers, pointers
+// and the hash table slots holding them
+const (
+	keyOverhead      = 96 // the entry, its slot in the keyspace and the key's header
+	volatileOverhead = 32 // the slot of a key with an expiration in the sampled set
+	stringOverhead   = 24 // a byte slice header
+	valueOverhead    = 48 // a collection's own struct
+	fieldOverhead    = 72 // a hash field and value with their slot
+	fieldExpiration  = 40 // the expiration of a hash field and its slot
+	elementOverhead  = 24 // a list element's slice header
+	memberOverhead   = 40 // a set member's slot
+	intsetMember     = 8
+	zmemberOverhead  = 112 // a sorted set member's slot, score and skiplist node
+	streamOverhead   = 40  // a stream entry's ID and fields slice
+)
+
+// DefaultMemorySamples is the number of elements of a collection MemoryUsage
+// looks at unless told otherwise, and the keyspace accounting always does,
+// as MEMORY USAGE does by default
+const DefaultMemorySamples = 5
+
+// MemoryValue is a Value that reports its size, which MemoryUsage and the
+// keyspace accounting count instead of a fixed estimate
+type MemoryValue interface {
+	Value
+	// MemoryUsage returns the approximate bytes the value takes
+	MemoryUsage() int
+}
+
+// MemoryStats is the memory accounting of a keyspace
+type MemoryStats struct {
+	Keys     int   // number of keys, including expired ones not removed yet
+	Expires  int   // number of keys with an expiration
+	Bytes    int64 // approximate bytes of the keys and values
+	Overhead int64 // of Bytes, the bytes of the keyspace's own structures
+}
+
+// MemoryStorage is a Storage that also accounts for the memory its keys
+// take, as MEMORY needs
+type MemoryStorage interface {
+	Storage
+	// MemoryUsage returns the approximate bytes key and its value take and
+	// whether it exists, estimating a collection from samples of its
+	// elements, all of them if samples is 0
+	MemoryUsage(key string, samples int) (int64, bool, error)
+	// MemoryStats returns the memory accounting of the whole keyspace
+	MemoryStats() (MemoryStats, error)
+}
+
+var _ MemoryStorage = (*Store)(nil)
+
+// sampled returns the size of the n elements of a collection estimated from
+// the first samples of them, all if samples is 0: each calls fn with the
+// elements until it returns false
+func sampled(n, samples int, each func(fn func(size int) bool)) int64 {
+	if n == 0 {
+		return 0
+	}
+	total, seen := 0, 0
+	each(func(size int) bool {
+		total += size
+		seen++
+		return samples == 0 || seen < samples
+	})
+	if seen == 0 {
+		return 0
+	}
+	return int64(total) * int64(n) / int64(seen)
+}
+
+// valueSize returns the approximate bytes v takes, estimating a collection
+// from samples of its elements
+func valueSize(v any, samples int) int64 {
+	switch v := v.(type) {
+	case []byte:
+		return stringOverhead + int64(cap(v))
+	case *Hash:
+		size := valueOverhead + sampled(v.fields.len(), samples, func(fn func(int) bool) {
+			v.fields.forEach(func(field string, value []byte) bool {
+				return fn(fieldOverhead + len(field) + cap(value))
+			})
+		})
+		return size + int64(len(v.expires))*fieldExpiration
+	case *List:
+		return valueOverhead + int64(cap(v.items))*elementOverhead + sampled(v.Len(), samples, func(fn func(int) bool) {
+			v.Range(0, -1, func(_ int, value []byte) bool {
+				return fn(cap(value))
+			})
+		})
+	case *Set:
+		if v.members == nil {
+			return valueOverhead + int64(cap(v.ints))*intsetMember
+		}
+		return valueOverhead + sampled(v.members.len(), samples, func(fn func(int) bool) {
+			v.members.forEach(func(member string, _ struct{}) bool {
+				return fn(memberOverhead + len(member))
+			})
+		})
+	case *ZSet:
+		return valueOverhead + sampled(v.scores.len(), samples, func(fn func(int) bool) {
+			v.scores.forEach(func(member string, _ float64) bool {
+				return fn(zmemberOverhead + len(member))
+			})
+		})
+	case *Stream:
+		return valueOverhead + sampled(len(v.entries), samples, func(fn func(int) bool) {
+			for _, entry := range v.entries {
+				size := streamOverhead
+				for _, field := range entry.Fields {
+					size += stringOverhead + cap(field)
+				}
+				if !fn(size) {
+					return
+				}
+			}
+		})
+	case MemoryValue:
+		return int64(v.MemoryUsage())
+	default:
+		return valueOverhead
+	}
+}
+
+// entrySize returns the approximate bytes key and its entry e take
+func entrySize(key string, e *entry, samples int) int64 {
+	size := keyOverhead + int64(len(key)) + valueSize(e.value, samples)
+	if e.expireAt != 0 {
+		size += volatileOverhead
+	}
+	return size
+}
+
+// account updates the memory accounting after the value or expiration of
+// the entry e of key changed, and queues key for the sink of StartSink; the
+// caller holds the shard of key for writing
+func (s *Store) account(key string, e *entry) {
+	s.shardOf(key).account(key, e)
+}
+
+func (sh *shard) account(key string, e *entry) {
+	size := entrySize(key, e, DefaultMemorySamples)
+	sh.used += size - e.size
+	e.size = size
+	if sh.sink != nil {
+		sh.sink.record(key)
+	}
+}
+
+// MemoryUsage returns the approximate bytes key and its value take and
+// whether it exists, estimating a collection from samples of its elements,
+// all of them if samples is 0
+func (s *Store) MemoryUsage(key string, samples int) (int64, bool, error) {
+	locked := s.rlock(key)
+	defer s.runlock(locked)
+	e := s.peek(key, nowMillis())
+	if e == nil {
+		return 0, false, nil
+	}
+	return entrySize(key, e, samples), true, nil
+}
+
+// MemoryStats returns the memory accounting of the keyspace, which
+// estimates collections from a few of their elements as they are written
+func (s *Store) MemoryStats() (MemoryStats, error) {
+	all := s.allShards()
+	s.rlockShards(all)
+	defer s.runlock(all)
+	var stats MemoryStats
+	for i := range s.shards {
+		sh := &s.shards[i]
+		stats.Keys += sh.keys.len()
+		stats.Expires += sh.volatile.len()
+		stats.Bytes += sh.used
+	}
+	stats.Overhead = int64(stats.Keys)*keyOverhead + int64(stats.Expires)*volatileOverhead
+	return stats, nil
+}
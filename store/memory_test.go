@@ -0,0 +1,109 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// accounted returns the sum of the sizes of the keys of s, as the accounting
+// should have it
+func accounted(s *Store) int64 {
+	var total int64
+	for i := range s.shards {
+		s.shards[i].keys.forEach(func(key string, e *entry) bool {
+			total += entrySize(key, e, DefaultMemorySamples)
+			return true
+		})
+	}
+	return total
+}
+
+func TestMemoryAccounting(t *testing.T) {
+	s := New()
+	check := func(step string) {
+		t.Helper()
+		stats, _ := s.MemoryStats()
+		if want := accounted(s); stats.Bytes != want {
+			t.Errorf("%s: accounted %d bytes, expected %d", step, stats.Bytes, want)
+		}
+	}
+
+	s.Set("s", []byte("hello"), SetOptions{})
+	s.Set("s", []byte(strings.Repeat("x", 1000)), SetOptions{})
+	check("set")
+	s.UpdateString("s", func(old []byte, _ bool) ([]byte, error) {
+		return append(old, "more"...), nil
+	})
+	check("update string")
+	s.Expire("s", time.Now().Add(time.Hour))
+	check("expire")
+	s.UpdateHash("h", func(h *Hash) error {
+		h.Set("a", []byte("1"))
+		h.Set("b", []byte("2"))
+		return nil
+	})
+	s.UpdateHash("h", func(h *Hash) error {
+		h.Set("c", []byte(strings.Repeat("y", 100)))
+		return nil
+	})
+	check("hash")
+	s.UpdateList("l", func(l *List) error {
+		l.PushBack([]byte("a"))
+		return nil
+	})
+	s.UpdateLists([]string{"l", "l"}, func(lists []*List) error {
+		lists[0].PushBack([]byte("b"))
+		return nil
+	})
+	check("list")
+	s.UpdateSet("set", func(set *Set) error {
+		set.Add("1")
+		set.Add("x")
+		return nil
+	})
+	s.UpdateZSet("z", func(z *ZSet) error {
+		z.Add("m", 1)
+		return nil
+	})
+	s.UpdateStream("st", true, func(st *Stream) error {
+		return st.Add(StreamID{Ms: 1}, [][]byte{[]byte("f"), []byte("v")})
+	})
+	s.UpdateStream("st", false, func(st *Stream) error {
+		return st.Add(StreamID{Ms: 2}, [][]byte{[]byte("f"), []byte("v")})
+	})
+	check("collections")
+
+	if stats, _ := s.MemoryStats(); stats.Keys != 6 || stats.Expires != 1 || stats.Overhead <= 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	s.Delete("s", "h", "l", "set", "z", "st")
+	if stats, _ := s.MemoryStats(); stats.Bytes != 0 {
+		t.Errorf("Expected nothing accounted for an empty store, got %d", stats.Bytes)
+	}
+}
+
+func TestMemoryUsage(t *testing.T) {
+	s := New()
+	s.Set("s", []byte(strings.Repeat("x", 1000)), SetOptions{})
+	if size, ok, _ := s.MemoryUsage("s", 0); !ok || size < 1000 || size > 1200 {
+		t.Errorf("Expected about 1000 bytes, got %d %v", size, ok)
+	}
+	if _, ok, _ := s.MemoryUsage("missing", 0); ok {
+		t.Error("Expected a missing key to report false")
+	}
+
+	// Elements of the same size are estimated exactly from a sample
+	s.UpdateSet("set", func(set *Set) error {
+		for i := range 1000 {
+			set.Add(fmt.Sprintf("member:%04d", i))
+		}
+		return nil
+	})
+	all, _, _ := s.MemoryUsage("set", 0)
+	some, _, _ := s.MemoryUsage("set", DefaultMemorySamples)
+	if all != some || all < 1000*11 {
+		t.Errorf("Expected the sampled estimate %d to match the full count %d", some, all)
+	}
+}
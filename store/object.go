@@ -0,0 +1,177 @@
+package store
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Encodings reported by Object, named after the representations Redis
+// reports through OBJECT ENCODING for values like them
+const (
+	EncodingInt        = "int"
+	EncodingEmbstr     = "embstr"
+	EncodingRaw        = "raw"
+	EncodingListpack   = "listpack"
+	EncodingListpackEx = "listpackex" // a small hash with field expirations
+	EncodingQuicklist  = "quicklist"
+	EncodingIntset     = "intset"
+	EncodingHashtable  = "hashtable"
+	EncodingSkiplist   = "skiplist"
+	EncodingStream     = "stream"
+)
+
+const (
+	// maxEmbstrLen is the length up to which Redis embeds a string in its
+	// object
+	maxEmbstrLen = 44
+	// maxListpackLen and maxListpackValue are the number of elements and
+	// the length of each up to which Redis keeps a hash, set or sorted set
+	// as a listpack, by default
+	maxListpackLen   = 128
+	maxListpackValue = 64
+	// maxListpackBytes is the size up to which Redis keeps a list as a
+	// single listpack, list-max-listpack-size -2
+	maxListpackBytes = 8 << 10
+)
+
+// Parameters of the access frequency counter, Redis' lfu-log-factor and
+// lfu-decay-time
+const (
+	lfuInitial   = 5  // the counter of a new key, so it isn't the first evicted
+	lfuLogFactor = 10 // how many more hits each increment takes
+	lfuDecay     = time.Minute
+)
+
+// ObjectInfo is what OBJECT reports about a key
+type ObjectInfo struct {
+	Encoding string
+	// RefCount is always 1, as values aren't shared between keys
+	RefCount int
+	// Idle is the time since the key was last read or written
+	Idle time.Duration
+	// Freq is a logarithmic access counter of up to 255, as Redis' LFU
+	// keeps, decremented for every minute the key isn't accessed
+	Freq int
+}
+
+// ObjectStorage is a Storage that also reports the encoding and access
+// metadata of keys, as OBJECT needs
+type ObjectStorage interface {
+	Storage
+	// Object returns what OBJECT reports about key and whether it exists,
+	// without counting as an access
+	Object(key string) (ObjectInfo, bool, error)
+}
+
+var _ ObjectStorage = (*Store)(nil)
+
+// created sets up the access metadata of e, stored at unix time now in
+// milliseconds
+func (e *entry) created(now int64) {
+	e.access.Store(now)
+	e.freq.Store(lfuInitial)
+}
+
+// counter returns the access frequency counter of e decayed by the minutes
+// since it was last accessed
+func (e *entry) counter(now int64) int {
+	idle := now - e.access.Load()
+	return max(int(e.freq.Load())-int(idle/lfuDecay.Milliseconds()), 0)
+}
+
+// touch records an access to e at unix time now in milliseconds. The counter
+// is incremented with a probability falling as it grows, so that it counts
+// up to 255 over about a million accesses.
+func (e *entry) touch(now int64) {
+	counter := e.counter(now)
+	if counter < 255 && rand.Float64() < 1/(float64(max(counter-lfuInitial, 0)*lfuLogFactor)+1) {
+		counter++
+	}
+	e.freq.Store(uint32(counter))
+	e.access.Store(now)
+}
+
+// encoding returns the representation Redis would keep e's value in
+func (e *entry) encoding() string {
+	switch v := e.value.(type) {
+	case []byte:
+		if _, ok := intMember(string(v)); ok {
+			return EncodingInt
+		}
+		if len(v) <= maxEmbstrLen {
+			return EncodingEmbstr
+		}
+		return EncodingRaw
+	case *Hash:
+		small := smallDict(&v.fields, func(field string, value []byte) bool {
+			return len(field) <= maxListpackValue && len(value) <= maxListpackValue
+		})
+		switch {
+		case !small:
+			return EncodingHashtable
+		case len(v.expires) > 0:
+			return EncodingListpackEx
+		default:
+			return EncodingListpack
+		}
+	case *List:
+		size := 0
+		v.Range(0, -1, func(_ int, value []byte) bool {
+			size += len(value)
+			return size <= maxListpackBytes
+		})
+		if size <= maxListpackBytes {
+			return EncodingListpack
+		}
+		return EncodingQuicklist
+	case *Set:
+		if v.members == nil {
+			return EncodingIntset
+		}
+		if smallDict(v.members, func(member string, _ struct{}) bool { return len(member) <= maxListpackValue }) {
+			return EncodingListpack
+		}
+		return EncodingHashtable
+	case *ZSet:
+		if smallDict(&v.scores, func(member string, _ float64) bool { return len(member) <= maxListpackValue }) {
+			return EncodingListpack
+		}
+		return EncodingSkiplist
+	case *Stream:
+		return EncodingStream
+	default:
+		return EncodingRaw
+	}
+}
+
+// smallDict reports whether d has up to maxListpackLen keys, all of which
+// small accepts
+func smallDict[V any](d *dict[V], small func(key string, v V) bool) bool {
+	if d.len() > maxListpackLen {
+		return false
+	}
+	ok := true
+	d.forEach(func(key string, v V) bool {
+		ok = small(key, v)
+		return ok
+	})
+	return ok
+}
+
+// Object returns the encoding and access metadata of key and whether it
+// exists, without counting as an access
+func (s *Store) Object(key string) (ObjectInfo, bool, error) {
+	locked := s.rlock(key)
+	defer s.runlock(locked)
+	now := nowMillis()
+	e := s.peek(key, now)
+	if e == nil {
+		return ObjectInfo{}, false, nil
+	}
+	return ObjectInfo{
+		Encoding: e.encoding(),
+		RefCount: 1,
+		Idle:     time.Duration(now-e.access.Load()) * time.Millisecond,
+		Freq:     e.counter(now),
+	}, true, nil
+}
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestObjectEncoding(t *testing.T) {
+	s := New()
+	long := strings.Repeat("x", 100)
+	s.Set("int", []byte("12345"), SetOptions{})
+	s.Set("embstr", []byte("hello"), SetOptions{})
+	s.Set("raw", []byte(long), SetOptions{})
+	s.UpdateHash("hash", func(h *Hash) error {
+		h.Set("f", []byte("v"))
+		return nil
+	})
+	s.UpdateHash("hashex", func(h *Hash) error {
+		h.Set("f", []byte("v"))
+		h.Expire("f", time.Now().Add(time.Hour))
+		return nil
+	})
+	s.UpdateHash("bighash", func(h *Hash) error {
+		h.Set("f", []byte(long))
+		return nil
+	})
+	s.UpdateList("list", func(l *List) error {
+		l.PushBack([]byte("a"))
+		return nil
+	})
+	s.UpdateList("biglist", func(l *List) error {
+		for range 100 {
+			l.PushBack([]byte(long))
+		}
+		return nil
+	})
+	s.UpdateSet("intset", func(set *Set) error {
+		set.Add("1")
+		return nil
+	})
+	s.UpdateSet("set", func(set *Set) error {
+		set.Add("a")
+		return nil
+	})
+	s.UpdateSet("bigset", func(set *Set) error {
+		for i := range 200 {
+			set.Add(fmt.Sprint("m", i))
+		}
+		return nil
+	})
+	s.UpdateZSet("zset", func(z *ZSet) error {
+		z.Add("a", 1)
+		return nil
+	})
+	s.UpdateZSet("bigzset", func(z *ZSet) error {
+		z.Add(long, 1)
+		return nil
+	})
+
+	expected := map[string]string{
+		"int":     EncodingInt,
+		"embstr":  EncodingEmbstr,
+		"raw":     EncodingRaw,
+		"hash":    EncodingListpack,
+		"hashex":  EncodingListpackEx,
+		"bighash": EncodingHashtable,
+		"list":    EncodingListpack,
+		"biglist": EncodingQuicklist,
+		"intset":  EncodingIntset,
+		"set":     EncodingListpack,
+		"bigset":  EncodingHashtable,
+		"zset":    EncodingListpack,
+		"bigzset": EncodingSkiplist,
+	}
+	for key, encoding := range expected {
+		info, ok, err := s.Object(key)
+		if !ok || err != nil {
+			t.Fatalf("Expected %s to exist, got %v", key, err)
+		}
+		if info.Encoding != encoding {
+			t.Errorf("Expected %s to be encoded as %s, got %s", key, encoding, info.Encoding)
+		}
+	}
+	if _, ok, _ := s.Object("missing"); ok {
+		t.Error("Expected a missing key to report false")
+	}
+}
+
+func TestObjectAccess(t *testing.T) {
+	s := New()
+	s.Set("k", []byte("v"), SetOptions{})
+	info, _, _ := s.Object("k")
+	if info.Freq != lfuInitial || info.RefCount != 1 || info.Idle > time.Second {
+		t.Fatalf("Unexpected metadata of a new key %+v", info)
+	}
+
+	for range 1000 {
+		s.Get("k")
+	}
+	info, _, _ = s.Object("k")
+	if info.Freq <= lfuInitial || info.Freq > 30 {
+		t.Errorf("Expected a thousand reads to raise the counter a little, got %d", info.Freq)
+	}
+
+	// Looking at the key doesn't count as an access
+	e := entryOf(s, "k")
+	e.access.Store(time.Now().Add(-3 * lfuDecay).UnixMilli())
+	s.Exists("k")
+	s.ExpireTime("k")
+	decayed, _, _ := s.Object("k")
+	if decayed.Idle < 3*lfuDecay || decayed.Freq != max(info.Freq-3, 0) {
+		t.Errorf("Expected 3 minutes idle decaying the counter by 3, got %+v", decayed)
+	}
+	s.Get("k")
+	if info, _, _ = s.Object("k"); info.Idle > time.Second {
+		t.Errorf("Expected a read to reset the idle time, got %v", info.Idle)
+	}
+}
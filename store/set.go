@@ -0,0 +1,318 @@
+package store
+
+import (
+	"math/rand/v2"
+	"slices"
+	"strconv"
+)
+
+// TypeSet is the Storage.Type of set keys
+const TypeSet = "set"
+
+// maxIntsetLen is the number of members up to which a set of integers is kept
+// as a sorted slice, as Redis does up to set-max-intset-entries
+const maxIntsetLen = 512
+
+// SetStorage is a Storage that also holds sets, as the set commands need.
+// Sets are handed to fn as a Set, as HashStorage does with hashes.
+type SetStorage interface {
+	Storage
+	// ViewSet calls fn with the set held by key, an empty one if key is
+	// missing. fn must not modify the set.
+	ViewSet(key string, fn func(set *Set)) error
+	// UpdateSet calls fn with the set held by key, an empty one if key is
+	// missing, and stores the result, deleting the key if the set is left
+	// empty. fn should return an error before changing the set; the error is
+	// returned.
+	UpdateSet(key string, fn func(set *Set) error) error
+	// ViewSets is ViewSet for several keys at once, as SINTER needs
+	ViewSets(keys []string, fn func(sets []*Set)) error
+	// UpdateSets is UpdateSet for several keys at once, as SMOVE needs.
+	// sets[i] is the set of keys[i]; a key given twice gets the same set.
+	UpdateSets(keys []string, fn func(sets []*Set) error) error
+	// StoreSet calls fn with the sets held by keys and stores the set it
+	// returns at dst, replacing whatever dst held, or deletes dst if the set
+	// is empty, as SUNIONSTORE needs
+	StoreSet(dst string, keys []string, fn func(sets []*Set) *Set) error
+}
+
+var _ SetStorage = (*Store)(nil)
+
+// Set is an unordered collection of distinct string members. A small set of
+// integers is kept as a sorted slice of them, which takes far less memory
+// than a hash table; adding another member converts it. It is not safe for
+// concurrent use.
+type Set struct {
+	ints    []int64         // the members while the set is an intset
+	members *dict[struct{}] // the members otherwise, nil for an intset
+}
+
+// NewSet returns an empty set
+func NewSet() *Set {
+	return &Set{}
+}
+
+// NewSetOf returns a set holding members
+func NewSetOf(members ...string) *Set {
+	s := NewSet()
+	for _, member := range members {
+		s.Add(member)
+	}
+	return s
+}
+
+// intMember parses member as an integer an intset can hold, one whose
+// decimal form is member exactly
+func intMember(member string) (int64, bool) {
+	n, err := strconv.ParseInt(member, 10, 64)
+	return n, err == nil && strconv.FormatInt(n, 10) == member
+}
+
+// Len returns the number of members
+func (s *Set) Len() int {
+	if s.members == nil {
+		return len(s.ints)
+	}
+	return s.members.len()
+}
+
+// clone returns a deep copy of s
+func (s *Set) clone() *Set {
+	if s.members == nil {
+		return &Set{ints: slices.Clone(s.ints)}
+	}
+	members := s.members.clone(func(struct{}) struct{} { return struct{}{} })
+	return &Set{members: &members}
+}
+
+// convert moves the members of an intset to a hash table
+func (s *Set) convert() {
+	d := newDict[struct{}]()
+	for _, n := range s.ints {
+		d.set(strconv.FormatInt(n, 10), struct{}{})
+	}
+	s.ints, s.members = nil, &d
+}
+
+// Contains reports whether member is in the set
+func (s *Set) Contains(member string) bool {
+	if s.members != nil {
+		_, ok := s.members.get(member)
+		return ok
+	}
+	n, ok := intMember(member)
+	if !ok {
+		return false
+	}
+	_, found := slices.BinarySearch(s.ints, n)
+	return found
+}
+
+// Add adds member and reports whether it is new
+func (s *Set) Add(member string) bool {
+	if s.members == nil {
+		n, ok := intMember(member)
+		if ok {
+			i, found := slices.BinarySearch(s.ints, n)
+			if found {
+				return false
+			}
+			if len(s.ints) < maxIntsetLen {
+				s.ints = slices.Insert(s.ints, i, n)
+				return true
+			}
+		}
+		s.convert()
+	}
+	return s.members.set(member, struct{}{})
+}
+
+// Remove removes member and reports whether it was in the set
+func (s *Set) Remove(member string) bool {
+	if s.members != nil {
+		return s.members.delete(member)
+	}
+	n, ok := intMember(member)
+	if !ok {
+		return false
+	}
+	i, found := slices.BinarySearch(s.ints, n)
+	if found {
+		s.ints = slices.Delete(s.ints, i, i+1)
+	}
+	return found
+}
+
+// Range calls fn for each member until it returns false. An intset yields
+// its members in ascending order.
+func (s *Set) Range(fn func(member string) bool) {
+	if s.members != nil {
+		s.members.forEach(func(member string, _ struct{}) bool {
+			return fn(member)
+		})
+		return
+	}
+	for _, n := range s.ints {
+		if !fn(strconv.FormatInt(n, 10)) {
+			return
+		}
+	}
+}
+
+// Members returns every member
+func (s *Set) Members() []string {
+	members := make([]string, 0, s.Len())
+	s.Range(func(member string) bool {
+		members = append(members, member)
+		return true
+	})
+	return members
+}
+
+// Random returns a random member, false if the set is empty
+func (s *Set) Random() (string, bool) {
+	if s.members != nil {
+		member, _, ok := s.members.random()
+		return member, ok
+	}
+	if len(s.ints) == 0 {
+		return "", false
+	}
+	return strconv.FormatInt(s.ints[rand.IntN(len(s.ints))], 10), true
+}
+
+// Scan returns members matching match, all if it is empty, from cursor on
+// and the cursor to continue from, as Storage.Scan does for keys. An intset
+// is returned whole, as Redis does for small sets.
+func (s *Set) Scan(cursor uint64, match string, count int) ([]string, uint64) {
+	var members []string
+	if s.members == nil {
+		s.Range(func(member string) bool {
+			if match == "" || Match(match, member) {
+				members = append(members, member)
+			}
+			return true
+		})
+		return members, 0
+	}
+	next := s.members.scan(cursor, count, func(member string, _ struct{}) bool {
+		if match != "" && !Match(match, member) {
+			return false
+		}
+		members = append(members, member)
+		return true
+	})
+	return members, next
+}
+
+// smallestFirst returns sets with the one with the fewest members first
+func smallestFirst(sets []*Set) []*Set {
+	i := 0
+	for j, s := range sets {
+		if s.Len() < sets[i].Len() {
+			i = j
+		}
+	}
+	sorted := slices.Clone(sets)
+	sorted[0], sorted[i] = sorted[i], sorted[0]
+	return sorted
+}
+
+// Inter returns the members found in every one of sets
+func Inter(sets []*Set) *Set {
+	result := NewSet()
+	inter(sets, func(member string) bool {
+		result.Add(member)
+		return true
+	})
+	return result
+}
+
+// InterCard returns how many members are found in every one of sets,
+// counting up to limit if it is positive
+func InterCard(sets []*Set, limit int) int {
+	n := 0
+	inter(sets, func(string) bool {
+		n++
+		return limit <= 0 || n < limit
+	})
+	return n
+}
+
+// inter calls fn for the members found in every one of sets until it
+// returns false, walking the smallest of them
+func inter(sets []*Set, fn func(member string) bool) {
+	if len(sets) == 0 {
+		return
+	}
+	sets = smallestFirst(sets)
+	sets[0].Range(func(member string) bool {
+		for _, s := range sets[1:] {
+			if !s.Contains(member) {
+				return true
+			}
+		}
+		return fn(member)
+	})
+}
+
+// Union returns the members found in any of sets
+func Union(sets []*Set) *Set {
+	result := NewSet()
+	for _, s := range sets {
+		s.Range(func(member string) bool {
+			result.Add(member)
+			return true
+		})
+	}
+	return result
+}
+
+// Diff returns the members of the first of sets found in none of the others
+func Diff(sets []*Set) *Set {
+	result := NewSet()
+	if len(sets) == 0 {
+		return result
+	}
+	sets[0].Range(func(member string) bool {
+		for _, s := range sets[1:] {
+			if s.Contains(member) {
+				return true
+			}
+		}
+		result.Add(member)
+		return true
+	})
+	return result
+}
+
+// ViewSet calls fn with the set held by key, an empty one if key is missing
+func (s *Store) ViewSet(key string, fn func(set *Set)) error {
+	return s.ViewSets([]string{key}, func(sets []*Set) {
+		fn(sets[0])
+	})
+}
+
+// ViewSets calls fn with the sets held by keys, empty ones for missing keys
+func (s *Store) ViewSets(keys []string, fn func(sets []*Set)) error {
+	return viewValues(s, keys, NewSet, fn)
+}
+
+// UpdateSet calls fn with the set held by key, an empty one if key is
+// missing, and deletes the key if fn leaves the set empty
+func (s *Store) UpdateSet(key string, fn func(set *Set) error) error {
+	return s.UpdateSets([]string{key}, func(sets []*Set) error {
+		return fn(sets[0])
+	})
+}
+
+// UpdateSets is UpdateSet for several keys at once
+func (s *Store) UpdateSets(keys []string, fn func(sets []*Set) error) error {
+	return updateValues(s, keys, NewSet, fn)
+}
+
+// StoreSet calls fn with the sets held by keys and stores the set it returns
+// at dst, replacing whatever dst held, or deletes dst if the set is empty
+func (s *Store) StoreSet(dst string, keys []string, fn func(sets []*Set) *Set) error {
+	return storeValue(s, dst, keys, NewSet, fn)
+}
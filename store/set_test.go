@@ -0,0 +1,117 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestSetIntset(t *testing.T) {
+	s := NewSetOf("3", "1", "2", "2")
+	if s.Len() != 3 || s.members != nil {
+		t.Fatalf("Expected an intset of 3 members, got %d members, intset %v", s.Len(), s.members == nil)
+	}
+	if got := s.Members(); !slices.Equal(got, []string{"1", "2", "3"}) {
+		t.Errorf("Expected [1 2 3], got %v", got)
+	}
+	// "01" isn't the decimal form of an integer, so it's a distinct member
+	if s.Contains("01") || !s.Contains("2") {
+		t.Error("Expected Contains to match only exact integer members")
+	}
+	if !s.Remove("2") || s.Remove("2") || s.Len() != 2 {
+		t.Error("Expected Remove to report only the first removal")
+	}
+
+	s.Add("a")
+	if s.members == nil || !s.Contains("1") || !s.Contains("a") || s.Len() != 3 {
+		t.Error("Expected a non-integer member to convert the set and keep its members")
+	}
+
+	big := NewSet()
+	for i := 0; i <= maxIntsetLen; i++ {
+		big.Add(fmt.Sprint(i))
+	}
+	if big.members == nil || big.Len() != maxIntsetLen+1 {
+		t.Errorf("Expected a set past %d integers to convert", maxIntsetLen)
+	}
+}
+
+func TestSetScan(t *testing.T) {
+	s := NewSet()
+	for i := 0; i < 100; i++ {
+		s.Add(fmt.Sprintf("m%d", i))
+	}
+	seen := make(map[string]bool)
+	var cursor uint64
+	for {
+		var members []string
+		members, cursor = s.Scan(cursor, "m1*", 10)
+		for _, member := range members {
+			seen[member] = true
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+	if len(seen) != 11 {
+		t.Errorf("Expected 11 members matching m1*, got %d", len(seen))
+	}
+	if member, ok := s.Random(); !ok || !s.Contains(member) {
+		t.Errorf("Expected a random member, got %q", member)
+	}
+}
+
+func TestSetAlgebra(t *testing.T) {
+	a := NewSetOf("1", "2", "3", "x")
+	b := NewSetOf("2", "3", "4")
+	c := NewSetOf("3", "x", "2")
+	sorted := func(s *Set) []string {
+		members := s.Members()
+		slices.Sort(members)
+		return members
+	}
+	if got := sorted(Inter([]*Set{a, b, c})); !slices.Equal(got, []string{"2", "3"}) {
+		t.Errorf("Expected [2 3], got %v", got)
+	}
+	if got := sorted(Union([]*Set{a, b})); !slices.Equal(got, []string{"1", "2", "3", "4", "x"}) {
+		t.Errorf("Expected [1 2 3 4 x], got %v", got)
+	}
+	if got := sorted(Diff([]*Set{a, b, c})); !slices.Equal(got, []string{"1"}) {
+		t.Errorf("Expected [1], got %v", got)
+	}
+	if n := InterCard([]*Set{a, c}, 2); n != 2 {
+		t.Errorf("Expected the limit to stop at 2, got %d", n)
+	}
+	if n := InterCard([]*Set{a, NewSet()}, 0); n != 0 {
+		t.Errorf("Expected an empty set to empty the intersection, got %d", n)
+	}
+}
+
+func TestStoreSet(t *testing.T) {
+	s := New()
+	s.UpdateSets([]string{"a", "b"}, func(sets []*Set) error {
+		sets[0].Add("1")
+		sets[0].Add("2")
+		sets[1].Add("2")
+		return nil
+	})
+	s.Set("dst", []byte("string"), SetOptions{})
+	if err := s.StoreSet("dst", []string{"a", "b"}, Union); err != nil {
+		t.Fatalf("StoreSet failed: %v", err)
+	}
+	if typ, _ := s.Type("dst"); typ != TypeSet {
+		t.Errorf("Expected StoreSet to replace the string, got type %s", typ)
+	}
+	s.StoreSet("dst", []string{"a", "missing"}, Inter)
+	if n, _ := s.Exists("dst"); n != 0 {
+		t.Error("Expected an empty result to delete the destination")
+	}
+	if err := s.StoreSet("dst", []string{"a", "str"}, Union); err != nil {
+		t.Errorf("Expected a missing source to read as empty, got %v", err)
+	}
+	s.Set("str", []byte("v"), SetOptions{})
+	if err := s.ViewSets([]string{"a", "str"}, func([]*Set) {}); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package store
+
+import (
+	"hash/maphash"
+	"math/bits"
+	"sync"
+)
+
+// defaultShards is the number of shards New partitions a store into. Every
+// operation locks only the shards of its keys, so commands on different keys
+// rarely wait for each other; a uint64 holds the set of shards an operation
+// locks, which bounds it to 64.
+const defaultShards = 64
+
+// shard is a partition of the keyspace holding the keys that hash to it,
+// with a lock of its own
+type shard struct {
+	mu       sync.RWMutex
+	keys     dict[*entry]
+	volatile dict[struct{}] // keys with an expiration, sampled by ExpireCycle
+	used     int64          // approximate bytes of the keys, the sum of their sizes
+	frozen   []*frozen      // what the open snapshots keep of the shard
+	sink     *sinkQueue     // queues the keys written for StartSink, if it runs
+	order    uint64         // orders the locking of shards of two stores
+	_        [64]byte       // keeps the locks of neighbouring shards on separate cache lines
+}
+
+// newStore returns an empty store of shards shards, a power of two from 1
+// to 64
+func newStore(shards int) *Store {
+	s := &Store{shards: make([]shard, shards), shardBits: bits.Len(uint(shards - 1)), id: storeIDs.Add(1)}
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.keys, sh.volatile = newDict[*entry](), newDict[struct{}]()
+		sh.order = s.id<<6 | uint64(i)
+	}
+	return s
+}
+
+// shardIndex returns the index of the shard holding key. It takes the top
+// bits of the hash, as dicts index their buckets with the bottom ones.
+func (s *Store) shardIndex(key string) int {
+	if s.shardBits == 0 {
+		return 0
+	}
+	return int(maphash.String(seed, key) >> (64 - s.shardBits))
+}
+
+// shardOf returns the shard holding key
+func (s *Store) shardOf(key string) *shard {
+	return &s.shards[s.shardIndex(key)]
+}
+
+// shardsOf returns the set of the shards holding keys, bit i for shard i
+func (s *Store) shardsOf(keys ...string) uint64 {
+	var set uint64
+	for _, key := range keys {
+		set |= 1 << s.shardIndex(key)
+	}
+	return set
+}
+
+// allShards returns the set of every shard
+func (s *Store) allShards() uint64 {
+	return 1<<len(s.shards) - 1
+}
+
+// lockShards locks the shards of set for writing in the order of their
+// indexes, so that operations locking several never deadlock
+func (s *Store) lockShards(set uint64) {
+	for rest := set; rest != 0; rest &= rest - 1 {
+		s.shards[bits.TrailingZeros64(rest)].mu.Lock()
+	}
+}
+
+// unlock unlocks the shards of set locked by lock or lockShards, then waits
+// for the sink of StartSink to catch up if writes got too far ahead of it
+func (s *Store) unlock(set uint64) {
+	s.unlockShards(set)
+	if q := s.sink.Load(); q != nil {
+		q.wait()
+	}
+}
+
+// unlockShards is unlock for callers that mustn't wait for the sink, as it
+// takes snapshots itself
+func (s *Store) unlockShards(set uint64) {
+	for rest := set; rest != 0; rest &= rest - 1 {
+		s.shards[bits.TrailingZeros64(rest)].mu.Unlock()
+	}
+}
+
+// rlockShards is lockShards for reading
+func (s *Store) rlockShards(set uint64) {
+	for rest := set; rest != 0; rest &= rest - 1 {
+		s.shards[bits.TrailingZeros64(rest)].mu.RLock()
+	}
+}
+
+// runlock unlocks the shards of set locked by rlock or rlockShards
+func (s *Store) runlock(set uint64) {
+	for rest := set; rest != 0; rest &= rest - 1 {
+		s.shards[bits.TrailingZeros64(rest)].mu.RUnlock()
+	}
+}
+
+// lock locks the shards of keys for writing and returns them for
+// unlock
+func (s *Store) lock(keys ...string) uint64 {
+	set := s.shardsOf(keys...)
+	s.lockShards(set)
+	return set
+}
+
+// rlock locks the shards of keys for reading and returns them for runlock
+func (s *Store) rlock(keys ...string) uint64 {
+	set := s.shardsOf(keys...)
+	s.rlockShards(set)
+	return set
+}
+
+// lockPair locks a and b, which can be shards of two stores or the same
+// shard, for writing in their order and returns the function unlocking them
+func lockPair(a, b *shard) func() {
+	if b.order < a.order {
+		a, b = b, a
+	}
+	a.mu.Lock()
+	if b != a {
+		b.mu.Lock()
+	}
+	return func() {
+		if b != a {
+			b.mu.Unlock()
+		}
+		a.mu.Unlock()
+	}
+}
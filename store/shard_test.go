@@ -0,0 +1,111 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestShards(t *testing.T) {
+	s := New()
+	for i := range 1000 {
+		s.Set(fmt.Sprintf("key:%d", i), []byte("v"), SetOptions{})
+	}
+	used := 0
+	for i := range s.shards {
+		if n := s.shards[i].keys.len(); n > 0 {
+			used++
+		}
+	}
+	if used != defaultShards {
+		t.Errorf("Expected the keys to spread over all %d shards, got %d", defaultShards, used)
+	}
+	if n := len(scanAll(t, s, "", 7, nil)); n != 1000 {
+		t.Errorf("Expected a scan across the shards to return 1000 keys, got %d", n)
+	}
+}
+
+// TestShardsConcurrent runs operations on one key and on several, within a
+// store and across two, from many goroutines at once, which the race
+// detector checks and which would deadlock were shards locked out of order
+func TestShardsConcurrent(t *testing.T) {
+	s, other := New(), New()
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 500 {
+				a, b := fmt.Sprintf("key:%d", (g+i)%50), fmt.Sprintf("key:%d", (g*7+i)%50)
+				s.Set(a, []byte("v"), SetOptions{})
+				s.MSet([]string{a, b}, [][]byte{[]byte("x"), []byte("y")})
+				s.Get(b)
+				s.Rename(a, b, false)
+				s.Copy(b, other, a, true)
+				other.Copy(a, s, b, true)
+				other.Move(a, s)
+				s.Move(b, other)
+				s.Delete(a, b)
+				if i%100 == 0 {
+					s.Flush(false)
+					s.Scan(0, "", 10)
+					s.MemoryStats()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// BenchmarkStore compares the store partitioned into shards with one of a
+// single shard, which serializes every write as one lock over the keyspace
+// would. Run it over the core counts of interest:
+//
+//	go test -run - -bench Store -cpu 8,32,64 ./store
+func BenchmarkStore(b *testing.B) {
+	const keys = 1 << 16
+	names := make([]string, keys)
+	for i := range names {
+		names[i] = fmt.Sprintf("key:%d", i)
+	}
+	value := []byte("value-0123456789")
+
+	workloads := []struct {
+		name string
+		op   func(s *Store, i int)
+	}{
+		{"get", func(s *Store, i int) { s.Get(names[i%keys]) }},
+		{"set", func(s *Store, i int) { s.Set(names[i%keys], value, SetOptions{}) }},
+		{"mixed", func(s *Store, i int) {
+			// Nine reads to a write, as caches typically see
+			if i%10 == 0 {
+				s.Set(names[i%keys], value, SetOptions{})
+			} else {
+				s.Get(names[i%keys])
+			}
+		}},
+	}
+	for _, shards := range []int{1, defaultShards} {
+		for _, w := range workloads {
+			b.Run(fmt.Sprintf("shards=%d/%s", shards, w.name), func(b *testing.B) {
+				s := newStore(shards)
+				for _, key := range names {
+					s.Set(key, value, SetOptions{})
+				}
+				var next atomic.Int64
+				b.ReportAllocs()
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					// Goroutines start at keys far apart and walk them in
+					// steps of a large prime, so they rarely share one
+					i := int(next.Add(1)) * 7919
+					for pb.Next() {
+						w.op(s, i)
+						i += 104729
+					}
+				})
+			})
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSinkBatchSize  = 128
+	defaultSinkInterval   = 100 * time.Millisecond
+	defaultSinkMaxPending = 1 << 16
+	defaultSinkBackoff    = 100 * time.Millisecond
+	defaultSinkMaxBackoff = 30 * time.Second
+)
+
+// WriteOp is what a WriteEvent reports happened
+type WriteOp int
+
+const (
+	// WriteSet reports that Key holds Value, expiring at ExpireAt
+	WriteSet WriteOp = iota
+	// WriteDelete reports that Key was deleted or expired
+	WriteDelete
+	// WriteFlush reports that every key was removed, by Flush
+	WriteFlush
+)
+
+// WriteEvent is a change of the store a WriteSink is given. The value is
+// []byte, *Hash, *List, *Set, *ZSet, *Stream or a Value, as a Snapshot has
+// them, and must not be modified or kept once Write returns.
+type WriteEvent struct {
+	Op       WriteOp
+	Key      string // empty for WriteFlush
+	Value    any
+	ExpireAt time.Time // zero if the key doesn't expire
+}
+
+// WriteSink receives the changes of a store from StartSink, to mirror them
+// into another system such as a database, an object store or a log
+type WriteSink interface {
+	// Write stores events, in order, and returns an error to have them
+	// given again later. It must not write to the store.
+	Write(ctx context.Context, events []WriteEvent) error
+}
+
+// SinkConfig configures how StartSink hands changes to a WriteSink
+type SinkConfig struct {
+	// BatchSize is the most events a call of Write gets, 128 if not set
+	BatchSize int
+	// Interval is how long written keys wait for others to share their
+	// batch, unless BatchSize of them are waiting, 100ms if not set
+	Interval time.Duration
+	// MaxPending is how many written keys can wait for the sink before
+	// writes to the store wait for it to catch up, 65536 if not set and no
+	// limit if negative
+	MaxPending int
+	// Backoff is how long to wait before giving a failed batch again,
+	// doubled after every failure up to MaxBackoff; 100ms and 30s if not
+	// set
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// OnError, if set, is called with the error of every failed Write. It
+	// runs on the goroutine of StartSink.
+	OnError func(err error)
+}
+
+// sinkQueue is the keys written since the WriteSink of StartSink was last
+// given them, in the order they were first written in. A key written again
+// before its event is taken keeps its place, and the event reports its
+// value as it is when taken, so the sink sees every key's latest value
+// without an event per write.
+type sinkQueue struct {
+	s      *Store
+	sink   WriteSink
+	config SinkConfig
+	cancel context.CancelFunc // stops run, once StartSink is called again
+
+	mu      sync.Mutex
+	space   sync.Cond // signalled as keys are taken and once stopped
+	flushed bool      // Flush ran before the keys were written
+	keys    []string
+	queued  map[string]struct{}
+	stopped bool
+	full    chan struct{} // signalled once BatchSize keys are waiting
+}
+
+// StartSink hands the changes of the store to sink in the background until
+// ctx is done or StartSink is called again: every key written or deleted
+// from then on, whether by a command, an expiration or Go code, is given to
+// sink.Write in batches of events in the order the keys were written in.
+// The store goes on serving its callers while sink catches up; if it falls
+// MaxPending keys behind, writes wait until it doesn't. Failed batches are
+// given again, after the Backoff. Once ctx is done, the keys still pending
+// are given once more before StartSink stops.
+func (s *Store) StartSink(ctx context.Context, sink WriteSink, config SinkConfig) {
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaultSinkBatchSize
+	}
+	if config.Interval <= 0 {
+		config.Interval = defaultSinkInterval
+	}
+	if config.MaxPending == 0 {
+		config.MaxPending = defaultSinkMaxPending
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = defaultSinkBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = defaultSinkMaxBackoff
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	q := &sinkQueue{s: s, sink: sink, config: config, cancel: cancel, queued: make(map[string]struct{}), full: make(chan struct{}, 1)}
+	q.space.L = &q.mu
+
+	all := s.allShards()
+	s.lockShards(all)
+	for i := range s.shards {
+		s.shards[i].sink = q
+	}
+	previous := s.sink.Swap(q)
+	s.unlockShards(all)
+	if previous != nil {
+		previous.cancel()
+	}
+	go q.run(ctx)
+}
+
+// run hands the queued keys to the sink every Interval, or as soon as a
+// batch is full, until ctx is done
+func (q *sinkQueue) run(ctx context.Context) {
+	ticker := time.NewTicker(q.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			q.detach()
+			q.drain(context.WithoutCancel(ctx), false)
+			q.stop()
+			return
+		case <-ticker.C:
+		case <-q.full:
+		}
+		q.drain(ctx, true)
+	}
+}
+
+// detach stops the store queueing keys for q, unless StartSink already gave
+// it another queue
+func (q *sinkQueue) detach() {
+	s := q.s
+	all := s.allShards()
+	s.lockShards(all)
+	if s.sink.CompareAndSwap(q, nil) {
+		for i := range s.shards {
+			s.shards[i].sink = nil
+		}
+	}
+	s.unlockShards(all)
+}
+
+// stop wakes the writers waiting on q, which no longer waits for anything
+func (q *sinkQueue) stop() {
+	q.mu.Lock()
+	q.stopped = true
+	q.mu.Unlock()
+	q.space.Broadcast()
+}
+
+// drain hands the queued keys to the sink batch by batch, retrying failed
+// batches until ctx is done if retry is set
+func (q *sinkQueue) drain(ctx context.Context, retry bool) {
+	for {
+		flushed, keys := q.take()
+		if !flushed && len(keys) == 0 {
+			return
+		}
+		if !q.write(ctx, flushed, keys, retry) {
+			q.requeue(flushed, keys)
+			return
+		}
+	}
+}
+
+// write gives the sink the events of a batch, as the store has the keys
+// when each attempt is made, and reports whether it took them
+func (q *sinkQueue) write(ctx context.Context, flushed bool, keys []string, retry bool) bool {
+	backoff := q.config.Backoff
+	for {
+		err := q.writeOnce(ctx, flushed, keys)
+		if err == nil {
+			return true
+		}
+		if q.config.OnError != nil {
+			q.config.OnError(err)
+		}
+		if !retry {
+			return false
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, q.config.MaxBackoff)
+	}
+}
+
+// writeOnce gives the sink the events of a batch from a snapshot, which
+// keeps their values as they are until Write returns
+func (q *sinkQueue) writeOnce(ctx context.Context, flushed bool, keys []string) error {
+	sn := q.s.Snapshot()
+	defer sn.Close()
+	events := make([]WriteEvent, 0, len(keys)+1)
+	if flushed {
+		events = append(events, WriteEvent{Op: WriteFlush})
+	}
+	for _, key := range keys {
+		if e, ok := sn.Get(key); ok {
+			events = append(events, WriteEvent{Op: WriteSet, Key: key, Value: e.Value, ExpireAt: e.ExpireAt})
+		} else {
+			events = append(events, WriteEvent{Op: WriteDelete, Key: key})
+		}
+	}
+	return q.sink.Write(ctx, events)
+}
+
+// record queues key, written by the caller holding its shard for writing
+func (q *sinkQueue) record(key string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.queued[key]; ok {
+		return
+	}
+	q.queued[key] = struct{}{}
+	q.keys = append(q.keys, key)
+	if len(q.keys) == q.config.BatchSize {
+		select {
+		case q.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// recordFlush forgets the keys queued, which Flush removed, for a
+// WriteFlush event to report instead
+func (q *sinkQueue) recordFlush() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.flushed = true
+	q.keys = nil
+	clear(q.queued)
+	q.space.Broadcast()
+}
+
+// take removes the next batch from q: whether it starts with a flush, and
+// the keys following it
+func (q *sinkQueue) take() (bool, []string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	flushed := q.flushed
+	n := min(len(q.keys), q.config.BatchSize)
+	keys := q.keys[:n:n]
+	q.flushed, q.keys = false, q.keys[n:]
+	for _, key := range keys {
+		delete(q.queued, key)
+	}
+	q.space.Broadcast()
+	return flushed, keys
+}
+
+// requeue puts a batch the sink didn't take back at the front of q, unless a
+// flush queued since makes it moot
+func (q *sinkQueue) requeue(flushed bool, keys []string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.flushed {
+		return
+	}
+	var front []string
+	for _, key := range keys {
+		if _, ok := q.queued[key]; !ok {
+			q.queued[key] = struct{}{}
+			front = append(front, key)
+		}
+	}
+	q.flushed = flushed
+	q.keys = append(front, q.keys...)
+}
+
+// wait blocks while MaxPending keys are queued, for writers to keep pace
+// with the sink; the caller holds no shard
+func (q *sinkQueue) wait() {
+	if q.config.MaxPending < 0 {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.keys) >= q.config.MaxPending && !q.stopped {
+		q.space.Wait()
+	}
+}
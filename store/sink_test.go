@@ -0,0 +1,175 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingSink keeps the events given to it, failing the first failures
+// calls and blocking while block is set
+type recordingSink struct {
+	mu       sync.Mutex
+	events   []WriteEvent
+	calls    int
+	failures int
+	block    chan struct{}
+}
+
+func (r *recordingSink) Write(ctx context.Context, events []WriteEvent) error {
+	if r.block != nil {
+		<-r.block
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls++
+	if r.calls <= r.failures {
+		return errors.New("sink down")
+	}
+	for _, e := range events {
+		// Values are only valid during Write, so keep strings' contents
+		if value, ok := e.Value.([]byte); ok {
+			e.Value = string(value)
+		}
+		r.events = append(r.events, e)
+	}
+	return nil
+}
+
+// waitEvents waits for the sink to have n events and returns them
+func (r *recordingSink) waitEvents(t *testing.T, n int) []WriteEvent {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		r.mu.Lock()
+		events := append([]WriteEvent(nil), r.events...)
+		r.mu.Unlock()
+		if len(events) >= n || time.Now().After(deadline) {
+			if len(events) != n {
+				t.Fatalf("Expected %d events, got %+v", n, events)
+			}
+			return events
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSink(t *testing.T) {
+	s := New()
+	s.Set("before", []byte("v"), SetOptions{})
+	sink := &recordingSink{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.StartSink(ctx, sink, SinkConfig{Interval: time.Millisecond})
+
+	at := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	s.Set("a", []byte("1"), SetOptions{})
+	s.Set("b", []byte("2"), SetOptions{ExpireAt: at})
+	s.Set("a", []byte("3"), SetOptions{})
+	s.UpdateHash("hash", func(h *Hash) error {
+		h.Set("f", []byte("v"))
+		return nil
+	})
+	s.Delete("before", "missing")
+	events := sink.waitEvents(t, 4)
+	expected := []struct {
+		op    WriteOp
+		key   string
+		value any
+	}{
+		{WriteSet, "a", "3"},
+		{WriteSet, "b", "2"},
+		{WriteSet, "hash", nil},
+		{WriteDelete, "before", nil},
+	}
+	for i, e := range expected {
+		if events[i].Op != e.op || events[i].Key != e.key || (e.value != nil && events[i].Value != e.value) {
+			t.Errorf("Event %d: expected %v %s %v, got %+v", i, e.op, e.key, e.value, events[i])
+		}
+	}
+	if !events[1].ExpireAt.Equal(at) {
+		t.Errorf("Expected the expiration of b, got %v", events[1].ExpireAt)
+	}
+	if h, ok := events[2].Value.(*Hash); !ok || h.Len() != 1 {
+		t.Errorf("Expected the hash, got %#v", events[2].Value)
+	}
+
+	s.Set("c", []byte("v"), SetOptions{})
+	s.Flush(false)
+	s.Set("d", []byte("v"), SetOptions{})
+	events = sink.waitEvents(t, 6)[4:]
+	if events[0].Op != WriteFlush || events[1].Op != WriteSet || events[1].Key != "d" {
+		t.Errorf("Expected a flush then d, got %+v", events)
+	}
+}
+
+func TestSinkRetry(t *testing.T) {
+	s := New()
+	sink := &recordingSink{failures: 2}
+	var errs []error
+	var mu sync.Mutex
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.StartSink(ctx, sink, SinkConfig{Interval: time.Millisecond, Backoff: time.Millisecond, OnError: func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+	}})
+	s.Set("k", []byte("v"), SetOptions{})
+	if events := sink.waitEvents(t, 1); events[0].Key != "k" {
+		t.Errorf("Expected k once the sink recovered, got %+v", events)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) != 2 {
+		t.Errorf("Expected OnError for both failures, got %v", errs)
+	}
+}
+
+func TestSinkBackpressure(t *testing.T) {
+	s := New()
+	sink := &recordingSink{block: make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.StartSink(ctx, sink, SinkConfig{BatchSize: 1, Interval: time.Millisecond, MaxPending: 4})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 10 {
+			s.Set(fmt.Sprint(i), []byte("v"), SetOptions{})
+		}
+	}()
+	select {
+	case <-done:
+		t.Fatal("Expected writes to wait for a sink that fell behind")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if value, ok, _ := s.Get("0"); !ok || string(value) != "v" {
+		t.Error("Expected reads to go on while writes wait")
+	}
+	close(sink.block)
+	<-done
+	sink.waitEvents(t, 10)
+}
+
+func TestSinkStop(t *testing.T) {
+	s := New()
+	sink := &recordingSink{}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.StartSink(ctx, sink, SinkConfig{Interval: time.Hour})
+	s.Set("pending", []byte("v"), SetOptions{})
+	cancel()
+	if events := sink.waitEvents(t, 1); events[0].Key != "pending" {
+		t.Errorf("Expected the pending key once stopped, got %+v", events)
+	}
+	for s.sink.Load() != nil {
+		time.Sleep(time.Millisecond)
+	}
+	s.Set("after", []byte("v"), SetOptions{})
+	time.Sleep(10 * time.Millisecond)
+	sink.waitEvents(t, 1)
+}
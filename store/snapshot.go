@@ -0,0 +1,176 @@
+package store
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// Snapshot is a consistent view of a store as it was at the moment
+// Store.Snapshot took it, for work that reads the whole keyspace while
+// commands keep writing to it, such as saving it to disk or sending it to a
+// replica. Taking one copies nothing: the first write to a key afterwards
+// keeps the entry the key had for the snapshot and works on a copy of the
+// value, as a forked process' pages are copied on write. Values stay
+// shared until then, so Values that don't implement CopyableValue are seen
+// as they are, not as they were. Close the snapshot once done with it, for
+// writes to stop copying.
+type Snapshot struct {
+	store  *Store
+	at     int64 // unix time in milliseconds the snapshot was taken at
+	frozen []*frozen
+	close  sync.Once
+}
+
+// frozen is what a snapshot keeps of a shard, guarded by the shard's lock
+type frozen struct {
+	// entries holds the entries keys written since the snapshot had then,
+	// nil for keys missing
+	entries map[string]*entry
+	// flushed holds the keys of the shard once Flush replaced them, nil
+	// while it reads the shard's own
+	flushed *dict[*entry]
+}
+
+// SnapshotEntry is a key of a snapshot with its value and expiration. The
+// value is []byte, *Hash, *List, *Set, *ZSet, *Stream or a Value, and must
+// not be modified.
+type SnapshotEntry struct {
+	Key      string
+	Value    any
+	ExpireAt time.Time // zero if the key doesn't expire
+}
+
+// Snapshot returns a view of the keyspace as it is now. It locks every
+// shard for as long as it takes to mark them, so that no write spanning
+// several shards is seen in part.
+func (s *Store) Snapshot() *Snapshot {
+	sn := &Snapshot{store: s, frozen: make([]*frozen, len(s.shards))}
+	all := s.allShards()
+	s.lockShards(all)
+	sn.at = nowMillis()
+	for i := range s.shards {
+		sn.frozen[i] = &frozen{entries: make(map[string]*entry)}
+		s.shards[i].frozen = append(s.shards[i].frozen, sn.frozen[i])
+	}
+	s.unlockShards(all)
+	return sn
+}
+
+// Time returns when the snapshot was taken
+func (sn *Snapshot) Time() time.Time {
+	return time.UnixMilli(sn.at)
+}
+
+// Get returns the entry key had in the snapshot and whether it existed
+func (sn *Snapshot) Get(key string) (SnapshotEntry, bool) {
+	i := sn.store.shardIndex(key)
+	sh, f := &sn.store.shards[i], sn.frozen[i]
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	e, ok := f.entries[key]
+	if !ok {
+		e, _ = f.keys(sh).get(key)
+	}
+	if e == nil || e.expired(sn.at) {
+		return SnapshotEntry{}, false
+	}
+	return SnapshotEntry{Key: key, Value: e.value, ExpireAt: e.expireTime()}, true
+}
+
+// ForEach calls fn with every key of the snapshot, in no particular order,
+// until it returns false. The keys of a shard are gathered under its lock,
+// held for reading, and fn is called without it.
+func (sn *Snapshot) ForEach(fn func(e SnapshotEntry) bool) {
+	var entries []SnapshotEntry
+	for i := range sn.store.shards {
+		sh, f := &sn.store.shards[i], sn.frozen[i]
+		add := func(key string, e *entry) {
+			if e != nil && !e.expired(sn.at) {
+				entries = append(entries, SnapshotEntry{Key: key, Value: e.value, ExpireAt: e.expireTime()})
+			}
+		}
+		sh.mu.RLock()
+		for key, e := range f.entries {
+			add(key, e)
+		}
+		f.keys(sh).forEach(func(key string, e *entry) bool {
+			if _, written := f.entries[key]; !written {
+				add(key, e)
+			}
+			return true
+		})
+		sh.mu.RUnlock()
+
+		for _, e := range entries {
+			if !fn(e) {
+				return
+			}
+		}
+		entries = entries[:0]
+	}
+}
+
+// Close releases the snapshot, which must not be used afterwards
+func (sn *Snapshot) Close() {
+	sn.close.Do(func() {
+		for i := range sn.store.shards {
+			sh := &sn.store.shards[i]
+			sh.mu.Lock()
+			sh.frozen = slices.DeleteFunc(sh.frozen, func(f *frozen) bool { return f == sn.frozen[i] })
+			sh.mu.Unlock()
+		}
+	})
+}
+
+// keys returns the keys f reads those not written since the snapshot from
+func (f *frozen) keys(sh *shard) *dict[*entry] {
+	if f.flushed != nil {
+		return f.flushed
+	}
+	return &sh.keys
+}
+
+// preserve records the entry key has, if any, for the snapshots of sh that
+// haven't recorded one yet, before it is written; the caller holds sh for
+// writing
+func (sh *shard) preserve(key string) {
+	for _, f := range sh.frozen {
+		if _, ok := f.entries[key]; !ok {
+			e, _ := sh.keys.get(key)
+			f.entries[key] = e
+		}
+	}
+}
+
+// unshare returns the entry e of key for the caller to change, replacing it
+// with a copy if a snapshot of sh holds it; the caller holds sh for writing
+func (sh *shard) unshare(key string, e *entry) *entry {
+	sh.preserve(key)
+	if !slices.ContainsFunc(sh.frozen, func(f *frozen) bool { return f.entries[key] == e }) {
+		return e
+	}
+	c := &entry{value: e.value, expireAt: e.expireAt, size: e.size}
+	c.access.Store(e.access.Load())
+	c.freq.Store(e.freq.Load())
+	// Strings are replaced rather than changed in place, and Values that
+	// can't be copied are left shared
+	if _, ok := e.value.([]byte); !ok {
+		if value, err := copyValue(e.value); err == nil {
+			c.value = value
+		}
+	}
+	sh.keys.set(key, c)
+	return c
+}
+
+// detach hands the keys of sh over to its snapshots before Flush replaces
+// them, after which writes to sh no longer concern them; the caller holds sh
+// for writing
+func (sh *shard) detach() {
+	for _, f := range sh.frozen {
+		keys := sh.keys
+		f.flushed = &keys
+	}
+	sh.frozen = nil
+}
@@ -0,0 +1,160 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	s := New()
+	at := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	s.Set("string", []byte("old"), SetOptions{ExpireAt: at})
+	s.Set("deleted", []byte("v"), SetOptions{})
+	s.Set("renamed", []byte("v"), SetOptions{})
+	s.UpdateHash("hash", func(h *Hash) error {
+		h.Set("field", []byte("old"))
+		return nil
+	})
+
+	sn := s.Snapshot()
+	defer sn.Close()
+	s.Set("string", []byte("new"), SetOptions{})
+	s.Delete("deleted")
+	s.Rename("renamed", "dst", false)
+	s.Set("added", []byte("v"), SetOptions{})
+	s.UpdateHash("hash", func(h *Hash) error {
+		h.Set("field", []byte("new"))
+		h.Set("other", []byte("new"))
+		return nil
+	})
+
+	if e, ok := sn.Get("string"); !ok || string(e.Value.([]byte)) != "old" || !e.ExpireAt.Equal(at) {
+		t.Errorf("Expected the old string and its expiration, got %+v, %v", e, ok)
+	}
+	for _, key := range []string{"deleted", "renamed"} {
+		if _, ok := sn.Get(key); !ok {
+			t.Errorf("Expected %s in the snapshot", key)
+		}
+	}
+	for _, key := range []string{"added", "dst"} {
+		if _, ok := sn.Get(key); ok {
+			t.Errorf("Expected %s written after the snapshot to be missing from it", key)
+		}
+	}
+	e, _ := sn.Get("hash")
+	if h := e.Value.(*Hash); h.Len() != 1 {
+		t.Errorf("Expected the hash as it was, got %d fields", h.Len())
+	} else if value, _ := h.Get("field"); string(value) != "old" {
+		t.Errorf("Expected the old field, got %q", value)
+	}
+	if value, _, _ := s.Get("string"); string(value) != "new" {
+		t.Errorf("Expected the store to hold the new string, got %q", value)
+	}
+	s.ViewHash("hash", func(h *Hash) {
+		if h.Len() != 2 {
+			t.Errorf("Expected the store to hold the new hash, got %d fields", h.Len())
+		}
+	})
+
+	seen := make(map[string]bool)
+	sn.ForEach(func(e SnapshotEntry) bool {
+		seen[e.Key] = true
+		return true
+	})
+	if len(seen) != 4 || !seen["string"] || !seen["deleted"] || !seen["renamed"] || !seen["hash"] {
+		t.Errorf("Unexpected keys in the snapshot: %v", seen)
+	}
+
+	// Flushing the store leaves the snapshot as it was
+	s.Flush(true)
+	if _, ok := sn.Get("deleted"); !ok {
+		t.Error("Expected a flush to leave the snapshot alone")
+	}
+	n := 0
+	sn.ForEach(func(SnapshotEntry) bool {
+		n++
+		return true
+	})
+	if n != 4 {
+		t.Errorf("Expected 4 keys in the snapshot after a flush, got %d", n)
+	}
+}
+
+func TestSnapshotClose(t *testing.T) {
+	s := New()
+	s.Set("k", []byte("v"), SetOptions{})
+	sn := s.Snapshot()
+	sn.Close()
+	sn.Close()
+	s.Set("k", []byte("w"), SetOptions{})
+	for i := range s.shards {
+		if n := len(s.shards[i].frozen); n != 0 {
+			t.Fatalf("Expected a closed snapshot to be forgotten, shard %d has %d", i, n)
+		}
+	}
+}
+
+func TestSnapshotExpired(t *testing.T) {
+	s := New()
+	s.Set("gone", []byte("v"), SetOptions{ExpireAt: time.Now().Add(-time.Second)})
+	s.Set("later", []byte("v"), SetOptions{ExpireAt: time.Now().Add(50 * time.Millisecond)})
+	sn := s.Snapshot()
+	defer sn.Close()
+	time.Sleep(60 * time.Millisecond)
+	s.ExpireCycle(10, time.Second)
+
+	if _, ok := sn.Get("gone"); ok {
+		t.Error("Expected a key expired before the snapshot to be missing from it")
+	}
+	if _, ok := sn.Get("later"); !ok {
+		t.Error("Expected a key expired since the snapshot to be in it")
+	}
+}
+
+// TestSnapshotConcurrent reads snapshots while writers change the keys in
+// them, which the race detector checks, and checks every snapshot sees the
+// lists at one length, as every update changes them all at once
+func TestSnapshotConcurrent(t *testing.T) {
+	s := New()
+	keys := make([]string, 20)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("list:%d", i)
+	}
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				s.UpdateLists(keys, func(lists []*List) error {
+					for _, l := range lists {
+						l.PushBack([]byte("v"))
+					}
+					return nil
+				})
+			}
+		}()
+	}
+	for range 50 {
+		sn := s.Snapshot()
+		lengths := make(map[int]bool)
+		sn.ForEach(func(e SnapshotEntry) bool {
+			lengths[e.Value.(*List).Len()] = true
+			return true
+		})
+		if len(lengths) > 1 {
+			t.Errorf("Expected the lists at one length, got %v", lengths)
+		}
+		sn.Close()
+	}
+	close(stop)
+	wg.Wait()
+}
@@ -0,0 +1,493 @@
+// Package store is the concurrent in-memory keyspace behind the commands
+// redkit.Server.EnableBuiltinStore registers. Handlers of their own can use
+// the same Store to work on the data those commands see.
+//
+// The commands work against the Storage interface, which Store implements,
+// so an application can serve them from another backend through
+// redkit.Server.EnableStorage.
+//
+// Errors carry the message Redis uses, without the ERR prefix that
+// redkit.ErrorValue adds; ErrWrongType is the exception redkit reports with
+// the WRONGTYPE prefix.
+package store
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// Errors reported by the store
+var (
+	ErrWrongType  = errors.New("Operation against a key holding the wrong kind of value")
+	ErrNotInteger = errors.New("value is not an integer or out of range")
+	ErrNotFloat   = errors.New("value is not a valid float")
+	ErrOverflow   = errors.New("increment or decrement would overflow")
+	ErrNaN        = errors.New("increment would produce NaN or Infinity")
+	ErrTooLarge   = errors.New("string exceeds maximum allowed size (proto-max-bulk-len)")
+	ErrOffset     = errors.New("offset is out of range")
+)
+
+// MaxStringSize is the largest string value the store accepts, 512MB as in Redis
+const MaxStringSize = 512 << 20
+
+// Type names reported by Storage.Type
+const (
+	TypeNone   = "none"
+	TypeString = "string"
+)
+
+// Storage is a keyspace the built-in commands can operate on. Store is the
+// in-memory implementation; others can keep the data in an embedded database
+// or a remote service. Byte slices returned by a Storage are not modified by
+// callers, and ones passed to it are not modified after the call.
+type Storage interface {
+	// Get returns the string value of key and whether it exists
+	Get(key string) ([]byte, bool, error)
+	// Set stores value under key as described by SetOptions
+	Set(key string, value []byte, opts SetOptions) (SetResult, error)
+	// UpdateString atomically replaces the string value of key with the one
+	// fn returns, keeping the key's expiration
+	UpdateString(key string, fn func(old []byte, exists bool) ([]byte, error)) ([]byte, error)
+	// MGet returns the values of keys, nil for missing keys and ones not
+	// holding a string
+	MGet(keys ...string) ([][]byte, error)
+	// MSet atomically stores values[i] under keys[i] without expiration
+	MSet(keys []string, values [][]byte) error
+	// MSetNX is MSet if none of keys exists, and reports whether it stored them
+	MSetNX(keys []string, values [][]byte) (bool, error)
+	// Delete removes keys and returns how many existed
+	Delete(keys ...string) (int, error)
+	// Exists returns how many of keys exist, counting a key given twice twice
+	Exists(keys ...string) (int, error)
+	// Type returns the type name of the value of key, TypeNone if missing
+	Type(key string) (string, error)
+	// Expire sets when key expires, or removes its expiration if at is
+	// zero, and reports whether the key exists
+	Expire(key string, at time.Time) (bool, error)
+	// ExpireTime returns when key expires, zero if it doesn't, and whether
+	// it exists
+	ExpireTime(key string) (time.Time, bool, error)
+	// UpdateExpiration atomically replaces the expiration of key with the
+	// one fn returns given the current one, zero meaning none, unless fn
+	// returns false. It reports whether the key exists.
+	UpdateExpiration(key string, fn func(current time.Time) (time.Time, bool)) (bool, error)
+	// GetDel atomically returns the string value of key and deletes it
+	GetDel(key string) ([]byte, bool, error)
+	// GetEx returns the string value of key and atomically replaces its
+	// expiration as UpdateExpiration does
+	GetEx(key string, fn func(current time.Time) (time.Time, bool)) ([]byte, bool, error)
+	// Scan returns keys matching the glob pattern match, all if it is empty,
+	// from cursor on, and the cursor to continue from, 0 once every key was
+	// returned. count is a hint of how many keys to return. A key present
+	// for the whole iteration is returned at least once.
+	Scan(cursor uint64, match string, count int) ([]string, uint64, error)
+}
+
+var _ Storage = (*Store)(nil)
+
+// entry is a key's value, expiration and access metadata. The metadata is
+// updated by reads holding the shard of the key for reading, hence atomic.
+type entry struct {
+	value    any           // []byte, *Hash, *List, *Set, *ZSet, *Stream or a Value
+	expireAt int64         // unix time in milliseconds, 0 if the key doesn't expire
+	access   atomic.Int64  // unix time in milliseconds of the last access
+	freq     atomic.Uint32 // access frequency counter as of access
+	size     int64         // approximate bytes of the key and entry, as accounted
+}
+
+// expired reports whether the entry's expiration is at or before now, or
+// every field of its hash has expired
+func (e *entry) expired(now int64) bool {
+	if e.expireAt != 0 && e.expireAt <= now {
+		return true
+	}
+	h, ok := e.value.(*Hash)
+	return ok && len(h.expires) > 0 && h.lenAt(now) == 0
+}
+
+// valueAs returns the value of e as a T, or ErrWrongType if e holds another
+// type. Every operation on a key of a type checks it through valueAs, so
+// that all of them fail alike.
+func valueAs[T any](e *entry) (T, error) {
+	v, ok := e.value.(T)
+	if !ok {
+		return v, ErrWrongType
+	}
+	return v, nil
+}
+
+// typeName returns the Type of the entry's value
+func (e *entry) typeName() string {
+	switch v := e.value.(type) {
+	case []byte:
+		return TypeString
+	case *Hash:
+		return TypeHash
+	case *List:
+		return TypeList
+	case *Set:
+		return TypeSet
+	case *ZSet:
+		return TypeZSet
+	case *Stream:
+		return TypeStream
+	case Value:
+		return v.Type()
+	default:
+		return TypeNone
+	}
+}
+
+// Store is a keyspace safe for concurrent use, partitioned into shards by
+// the hash of the keys. Keys with an expiration are treated as missing once
+// it passes and removed by the next write to them, or earlier by the cycles
+// of StartExpiry.
+type Store struct {
+	shards    []shard
+	shardBits int                       // log2 of len(shards)
+	expiry    atomic.Pointer[expiry]    // nil unless StartExpiry runs
+	lazy      lazyFree                  // values Unlink left to the background
+	loads     loads                     // the Loader of GetOrLoad and its loads
+	sink      atomic.Pointer[sinkQueue] // nil unless StartSink runs
+	id        uint64                    // orders the locking of two stores
+}
+
+// New returns an empty store
+func New() *Store {
+	return newStore(defaultShards)
+}
+
+// put stores e under key, replacing the entry it had; the caller holds the
+// shard of key for writing
+func (s *Store) put(key string, e *entry) {
+	if e.access.Load() == 0 {
+		e.created(nowMillis())
+	}
+	sh := s.shardOf(key)
+	sh.preserve(key)
+	if old, ok := sh.keys.get(key); ok {
+		sh.used -= old.size
+	}
+	sh.account(key, e)
+	sh.keys.set(key, e)
+	if e.expireAt != 0 {
+		sh.volatile.set(key, struct{}{})
+	} else {
+		sh.volatile.delete(key)
+	}
+}
+
+// drop removes key; the caller holds the shard of key for writing
+func (s *Store) drop(key string) {
+	s.shardOf(key).drop(key)
+}
+
+// drop removes key from sh; the caller holds sh for writing
+func (sh *shard) drop(key string) {
+	sh.preserve(key)
+	if e, ok := sh.keys.get(key); ok {
+		sh.used -= e.size
+		e.size = 0 // in case the entry is put under another key
+		if sh.sink != nil {
+			sh.sink.record(key)
+		}
+	}
+	sh.keys.delete(key)
+	sh.volatile.delete(key)
+}
+
+// nowMillis is the current time as compared with expireAt
+func nowMillis() int64 {
+	return time.Now().UnixMilli()
+}
+
+// get returns the live entry of key, recording an access to it; the caller
+// holds the shard of key
+func (s *Store) get(key string, now int64) *entry {
+	e := s.peek(key, now)
+	if e != nil {
+		e.touch(now)
+	}
+	return e
+}
+
+// peek is get for callers looking at a key without it counting as an
+// access, such as EXISTS or TTL
+func (s *Store) peek(key string, now int64) *entry {
+	e, _ := s.shardOf(key).keys.get(key)
+	if e == nil || e.expired(now) {
+		return nil
+	}
+	return e
+}
+
+// getForWrite is get for callers holding the shard of key for writing, which
+// also drops the key if it has expired. The entry is the caller's to change,
+// copied from the one a snapshot holds if need be.
+func (s *Store) getForWrite(key string, now int64) *entry {
+	sh := s.shardOf(key)
+	e, _ := sh.keys.get(key)
+	if e != nil && e.expired(now) {
+		s.expireKey(key)
+		return nil
+	}
+	if e != nil && len(sh.frozen) > 0 {
+		e = sh.unshare(key, e)
+	}
+	if e != nil {
+		e.touch(now)
+	}
+	return e
+}
+
+// collection is a value type holding elements, stored only while it has some
+type collection interface {
+	*List | *Set | *ZSet
+	Len() int
+}
+
+// valuesOf returns the values of type T held by keys, newValue() for
+// missing keys, or ErrWrongType if a key holds another type; the caller
+// holds the shards of keys
+func valuesOf[T collection](s *Store, keys []string, newValue func() T) ([]T, error) {
+	now := nowMillis()
+	values := make([]T, len(keys))
+	for i, key := range keys {
+		e := s.get(key, now)
+		if e == nil {
+			values[i] = newValue()
+			continue
+		}
+		var err error
+		if values[i], err = valueAs[T](e); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// viewValues calls fn with the values of type T held by keys, newValue() for
+// missing keys
+func viewValues[T collection](s *Store, keys []string, newValue func() T, fn func(values []T)) error {
+	locked := s.rlock(keys...)
+	defer s.runlock(locked)
+	values, err := valuesOf(s, keys, newValue)
+	if err != nil {
+		return err
+	}
+	fn(values)
+	return nil
+}
+
+// updateValues is viewValues for fn changing the values. It stores the new
+// values that aren't empty and deletes the keys whose value fn emptied. A
+// key given twice gets the same value.
+func updateValues[T collection](s *Store, keys []string, newValue func() T, fn func(values []T) error) error {
+	locked := s.lock(keys...)
+	defer s.unlock(locked)
+	now := nowMillis()
+	values := make([]T, len(keys))
+	existed := make([]bool, len(keys))
+	for i, key := range keys {
+		if j := firstIndex(keys[:i], key); j >= 0 {
+			values[i], existed[i] = values[j], existed[j]
+			continue
+		}
+		e := s.getForWrite(key, now)
+		if e == nil {
+			values[i] = newValue()
+			continue
+		}
+		v, err := valueAs[T](e)
+		if err != nil {
+			return err
+		}
+		values[i], existed[i] = v, true
+	}
+
+	err := fn(values)
+	for i, key := range keys {
+		switch empty := values[i].Len() == 0; {
+		case empty && existed[i]:
+			s.drop(key)
+		case !empty && !existed[i]:
+			s.put(key, &entry{value: values[i]})
+		case !empty && firstIndex(keys[:i], key) < 0:
+			e, _ := s.shardOf(key).keys.get(key)
+			s.account(key, e)
+		}
+	}
+	return err
+}
+
+// storeValue calls fn with the values of type T held by keys, newValue()
+// for missing keys, and stores the value it returns at dst, replacing
+// whatever dst held, or deletes dst if the value is empty
+func storeValue[T collection](s *Store, dst string, keys []string, newValue func() T, fn func(values []T) T) error {
+	locked := s.shardsOf(keys...) | s.shardsOf(dst)
+	s.lockShards(locked)
+	defer s.unlock(locked)
+	values, err := valuesOf(s, keys, newValue)
+	if err != nil {
+		return err
+	}
+	if result := fn(values); result.Len() > 0 {
+		s.put(dst, &entry{value: result})
+	} else {
+		s.drop(dst)
+	}
+	return nil
+}
+
+// firstIndex returns the index of the first key equal to key, or -1
+func firstIndex(keys []string, key string) int {
+	for i, k := range keys {
+		if k == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// Len returns the number of keys, including expired ones not removed yet
+func (s *Store) Len() int {
+	all := s.allShards()
+	s.rlockShards(all)
+	defer s.runlock(all)
+	n := 0
+	for i := range s.shards {
+		n += s.shards[i].keys.len()
+	}
+	return n
+}
+
+// Delete removes keys and returns how many existed
+func (s *Store) Delete(keys ...string) (int, error) {
+	locked := s.lock(keys...)
+	defer s.unlock(locked)
+	now := nowMillis()
+	deleted := 0
+	for _, key := range keys {
+		if s.getForWrite(key, now) != nil {
+			s.drop(key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Exists returns how many of keys exist, counting a key given twice twice
+func (s *Store) Exists(keys ...string) (int, error) {
+	locked := s.rlock(keys...)
+	defer s.runlock(locked)
+	now := nowMillis()
+	n := 0
+	for _, key := range keys {
+		if s.peek(key, now) != nil {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Type returns the type name of the value of key, TypeNone if missing
+func (s *Store) Type(key string) (string, error) {
+	locked := s.rlock(key)
+	defer s.runlock(locked)
+	if e := s.peek(key, nowMillis()); e != nil {
+		return e.typeName(), nil
+	}
+	return TypeNone, nil
+}
+
+// expireTime returns the expiration of e, zero if it has none
+func (e *entry) expireTime() time.Time {
+	if e.expireAt == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(e.expireAt)
+}
+
+// setExpireTime sets when the entry e of key expires, or removes its
+// expiration if at is zero, deleting the key if at passed by now; the caller
+// holds the shard of key for writing
+func (s *Store) setExpireTime(key string, e *entry, at time.Time, now int64) {
+	sh := s.shardOf(key)
+	if at.IsZero() {
+		e.expireAt = 0
+		sh.volatile.delete(key)
+	} else if e.expireAt = at.UnixMilli(); e.expired(now) {
+		s.drop(key)
+		return
+	} else {
+		sh.volatile.set(key, struct{}{})
+	}
+	sh.account(key, e)
+}
+
+// Expire sets when key expires, or removes its expiration if at is zero, and
+// reports whether the key exists. A time already passed deletes the key.
+func (s *Store) Expire(key string, at time.Time) (bool, error) {
+	return s.UpdateExpiration(key, func(time.Time) (time.Time, bool) {
+		return at, true
+	})
+}
+
+// UpdateExpiration replaces the expiration of key with the one fn returns
+// given the current one, zero meaning none, unless fn returns false, and
+// reports whether the key exists. A time already passed deletes the key.
+func (s *Store) UpdateExpiration(key string, fn func(current time.Time) (time.Time, bool)) (bool, error) {
+	locked := s.lock(key)
+	defer s.unlock(locked)
+	now := nowMillis()
+	e := s.getForWrite(key, now)
+	if e == nil {
+		return false, nil
+	}
+	if at, ok := fn(e.expireTime()); ok {
+		s.setExpireTime(key, e, at, now)
+	}
+	return true, nil
+}
+
+// ExpireTime returns when key expires, zero if it doesn't, and whether it exists
+func (s *Store) ExpireTime(key string) (time.Time, bool, error) {
+	locked := s.rlock(key)
+	defer s.runlock(locked)
+	e := s.peek(key, nowMillis())
+	if e == nil {
+		return time.Time{}, false, nil
+	}
+	return e.expireTime(), true, nil
+}
+
+// Scan returns keys matching match from cursor on and the cursor to continue
+// from. The low bits of the cursor are the shard the scan is in and the
+// others the cursor of its keys; shards are scanned one after the other.
+func (s *Store) Scan(cursor uint64, match string, count int) ([]string, uint64, error) {
+	index := int(cursor & uint64(len(s.shards)-1))
+	inner := cursor >> s.shardBits
+	now := nowMillis()
+	var keys []string
+	for {
+		sh := &s.shards[index]
+		sh.mu.RLock()
+		inner = sh.keys.scan(inner, count-len(keys), func(key string, e *entry) bool {
+			if e.expired(now) || (match != "" && !Match(match, key)) {
+				return false
+			}
+			keys = append(keys, key)
+			return true
+		})
+		sh.mu.RUnlock()
+		if inner == 0 {
+			if index++; index == len(s.shards) {
+				return keys, 0, nil
+			}
+		}
+		if inner != 0 || len(keys) >= count {
+			return keys, inner<<s.shardBits | uint64(index), nil
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// scanAll runs a SCAN iteration to its end and returns how often each key came back
+func scanAll(t *testing.T, s *Store, match string, count int, between func()) map[string]int {
+	t.Helper()
+	seen := make(map[string]int)
+	var cursor uint64
+	for i := 0; ; i++ {
+		if i > 100000 {
+			t.Fatal("Expected the scan to finish")
+		}
+		keys, next, err := s.Scan(cursor, match, count)
+		if err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		for _, key := range keys {
+			seen[key]++
+		}
+		if cursor = next; cursor == 0 {
+			return seen
+		}
+		if between != nil {
+			between()
+		}
+	}
+}
+
+// entryOf returns the entry of key in s, nil if it has none
+func entryOf(s *Store, key string) *entry {
+	e, _ := s.shardOf(key).keys.get(key)
+	return e
+}
+
+// volatileKeys returns the number of keys of s with an expiration
+func volatileKeys(s *Store) int {
+	n := 0
+	for i := range s.shards {
+		n += s.shards[i].volatile.len()
+	}
+	return n
+}
+
+func TestScan(t *testing.T) {
+	s := New()
+	for i := 0; i < 1000; i++ {
+		s.Set(fmt.Sprintf("key:%d", i), []byte("v"), SetOptions{})
+	}
+	s.Set("expired", []byte("v"), SetOptions{ExpireAt: time.Now().Add(-time.Second)})
+
+	seen := scanAll(t, s, "", 10, nil)
+	if len(seen) != 1000 {
+		t.Errorf("Expected 1000 keys, got %d", len(seen))
+	}
+	for key, n := range seen {
+		if n != 1 {
+			t.Errorf("Expected %s once without resizes, got %d", key, n)
+		}
+	}
+	if seen := scanAll(t, s, "key:1?", 100, nil); len(seen) != 10 {
+		t.Errorf("Expected 10 keys matching key:1?, got %d", len(seen))
+	}
+}
+
+func TestScanDuringResize(t *testing.T) {
+	s := New()
+	for i := 0; i < 500; i++ {
+		s.Set(fmt.Sprintf("stable:%d", i), []byte("v"), SetOptions{})
+	}
+
+	// Grow the table while the iteration runs, then shrink it again
+	added := 0
+	seen := scanAll(t, s, "", 5, func() {
+		if added < 5000 {
+			for i := 0; i < 100; i++ {
+				s.Set(fmt.Sprintf("grow:%d", added), []byte("v"), SetOptions{})
+				added++
+			}
+		}
+	})
+	for i := 0; i < 500; i++ {
+		if seen[fmt.Sprintf("stable:%d", i)] == 0 {
+			t.Fatalf("Expected stable:%d to be returned while growing", i)
+		}
+	}
+
+	removed := 0
+	seen = scanAll(t, s, "stable:*", 5, func() {
+		for i := 0; i < 100 && removed < added; i++ {
+			s.Delete(fmt.Sprintf("grow:%d", removed))
+			removed++
+		}
+	})
+	if len(seen) != 500 {
+		t.Errorf("Expected all 500 stable keys while shrinking, got %d", len(seen))
+	}
+	if s.Len() != 500 {
+		t.Errorf("Expected 500 keys left, got %d", s.Len())
+	}
+	for i := range s.shards {
+		if keys := &s.shards[i].keys; len(keys.buckets) > max(keys.len(), minBuckets) {
+			t.Errorf("Expected shard %d to shrink back, got %d keys in %d buckets", i, keys.len(), len(keys.buckets))
+		}
+	}
+}
+
+func TestExpire(t *testing.T) {
+	s := New()
+	if ok, _ := s.Expire("missing", time.Now().Add(time.Hour)); ok {
+		t.Error("Expected Expire on a missing key to report false")
+	}
+
+	s.Set("k", []byte("v"), SetOptions{})
+	at := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	if ok, _ := s.Expire("k", at); !ok {
+		t.Error("Expected Expire to find the key")
+	}
+	if got, ok, _ := s.ExpireTime("k"); !ok || !got.Equal(at) {
+		t.Errorf("Expected expiration %v, got %v %v", at, got, ok)
+	}
+	s.Expire("k", time.Time{})
+	if got, ok, _ := s.ExpireTime("k"); !ok || !got.IsZero() {
+		t.Errorf("Expected no expiration, got %v %v", got, ok)
+	}
+
+	s.Expire("k", time.Now().Add(-time.Second))
+	if s.Len() != 0 {
+		t.Error("Expected an expiration in the past to delete the key")
+	}
+}
+
+func TestUpdateExpiration(t *testing.T) {
+	s := New()
+	s.Set("k", []byte("v"), SetOptions{})
+	at := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	var seen []time.Time
+	update := func(next time.Time, ok bool) {
+		t.Helper()
+		exists, err := s.UpdateExpiration("k", func(current time.Time) (time.Time, bool) {
+			seen = append(seen, current)
+			return next, ok
+		})
+		if !exists || err != nil {
+			t.Fatalf("Expected UpdateExpiration to find the key, got %v %v", exists, err)
+		}
+	}
+	update(at, true)
+	update(time.Time{}, false)
+	update(time.Time{}, true)
+	update(time.Time{}, true)
+	if len(seen) != 4 || !seen[0].IsZero() || !seen[1].Equal(at) || !seen[2].Equal(at) || !seen[3].IsZero() {
+		t.Errorf("Unexpected expirations passed to fn: %v", seen)
+	}
+	if volatileKeys(s) != 0 {
+		t.Error("Expected the persisted key not to be sampled for expiration")
+	}
+	if exists, _ := s.UpdateExpiration("missing", nil); exists {
+		t.Error("Expected UpdateExpiration on a missing key to report false")
+	}
+}
+
+func TestType(t *testing.T) {
+	s := New()
+	s.Set("k", []byte("v"), SetOptions{})
+	if typ, _ := s.Type("k"); typ != TypeString {
+		t.Errorf("Expected %s, got %s", TypeString, typ)
+	}
+	if typ, _ := s.Type("missing"); typ != TypeNone {
+		t.Errorf("Expected %s, got %s", TypeNone, typ)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"*", "anything", true},
+		{"user:*", "user:42", true},
+		{"user:*", "session:42", false},
+		{"a/*", "a/b/c", true},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"h[c-a]llo", "hbllo", true},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{"**a", "bba", true},
+		{"*a*b", "xaxxb", true},
+		{"*a*b", "xaxx", false},
+		{"", "", true},
+		{"", "a", false},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.s); got != tt.want {
+			t.Errorf("Match(%q, %q): expected %v", tt.pattern, tt.s, tt.want)
+		}
+	}
+}
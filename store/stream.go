@@ -0,0 +1,337 @@
+package store
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"strconv"
+)
+
+// TypeStream is the Storage.Type of stream keys
+const TypeStream = "stream"
+
+// Errors reported when adding to a stream or setting its last ID
+var (
+	ErrStreamIDZero      = errors.New("The ID specified in XADD must be greater than 0-0")
+	ErrStreamIDTooSmall  = errors.New("The ID specified in XADD is equal or smaller than the target stream top item")
+	ErrStreamExhausted   = errors.New("The stream has exhausted the last possible ID, unable to add more items")
+	ErrSetIDTooSmall     = errors.New("The ID specified in XSETID is smaller than the target stream top item")
+	ErrSetIDAdded        = errors.New("The entries_added specified in XSETID is smaller than the target stream length")
+	ErrSetIDBelowDeleted = errors.New("The ID specified in XSETID is smaller than the provided max_deleted_entry_id")
+)
+
+// StreamStorage is a Storage that also holds streams, as the stream commands
+// need. Unlike the other types, a stream is kept when its last entry is
+// removed.
+type StreamStorage interface {
+	Storage
+	// ViewStream calls fn with the stream held by key, nil if key is
+	// missing. fn must not modify the stream.
+	ViewStream(key string, fn func(st *Stream)) error
+	// ViewStreams is ViewStream for several keys at once, as XREAD needs
+	ViewStreams(keys []string, fn func(streams []*Stream)) error
+	// UpdateStream calls fn with the stream held by key and stores the
+	// result. If key is missing fn gets a new stream, stored unless fn
+	// returns an error, if create is set, and nil otherwise.
+	UpdateStream(key string, create bool, fn func(st *Stream) error) error
+}
+
+var _ StreamStorage = (*Store)(nil)
+
+// StreamID identifies a stream entry: the unix time in milliseconds it was
+// added at and a sequence number for entries added in the same millisecond
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+// MaxStreamID is the greatest stream ID
+var MaxStreamID = StreamID{math.MaxUint64, math.MaxUint64}
+
+// String returns the ID in its ms-seq form
+func (id StreamID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+// Compare returns -1, 0 or 1 as id is before, equal to or after other
+func (id StreamID) Compare(other StreamID) int {
+	switch {
+	case id.Ms < other.Ms || (id.Ms == other.Ms && id.Seq < other.Seq):
+		return -1
+	case id == other:
+		return 0
+	default:
+		return 1
+	}
+}
+
+// Next returns the ID following id, false if id is MaxStreamID
+func (id StreamID) Next() (StreamID, bool) {
+	switch {
+	case id.Seq < math.MaxUint64:
+		return StreamID{id.Ms, id.Seq + 1}, true
+	case id.Ms < math.MaxUint64:
+		return StreamID{id.Ms + 1, 0}, true
+	}
+	return id, false
+}
+
+// Prev returns the ID preceding id, false if id is 0-0
+func (id StreamID) Prev() (StreamID, bool) {
+	switch {
+	case id.Seq > 0:
+		return StreamID{id.Ms, id.Seq - 1}, true
+	case id.Ms > 0:
+		return StreamID{id.Ms - 1, math.MaxUint64}, true
+	}
+	return id, false
+}
+
+// StreamEntry is an entry of a stream. Fields holds its fields and values in
+// turn, in the order they were added.
+type StreamEntry struct {
+	ID     StreamID
+	Fields [][]byte
+}
+
+// Stream is an append-only log of entries ordered by ID. Besides the entries
+// it keeps the last ID ever added, which new IDs must exceed, the greatest
+// ID deleted and how many entries were ever added, as Redis does. It is not
+// safe for concurrent use.
+type Stream struct {
+	entries      []StreamEntry
+	lastID       StreamID
+	maxDeletedID StreamID
+	entriesAdded uint64
+}
+
+// NewStream returns an empty stream
+func NewStream() *Stream {
+	return &Stream{}
+}
+
+// Len returns the number of entries
+func (st *Stream) Len() int {
+	return len(st.entries)
+}
+
+// clone returns a deep copy of st
+func (st *Stream) clone() *Stream {
+	c := *st
+	c.entries = make([]StreamEntry, len(st.entries))
+	for i, entry := range st.entries {
+		c.entries[i] = StreamEntry{ID: entry.ID, Fields: make([][]byte, len(entry.Fields))}
+		for j, field := range entry.Fields {
+			c.entries[i].Fields[j] = slices.Clone(field)
+		}
+	}
+	return &c
+}
+
+// LastID returns the greatest ID added to the stream, 0-0 if none was
+func (st *Stream) LastID() StreamID {
+	return st.lastID
+}
+
+// MaxDeletedID returns the greatest ID deleted from the stream, 0-0 if none
+// was
+func (st *Stream) MaxDeletedID() StreamID {
+	return st.maxDeletedID
+}
+
+// EntriesAdded returns how many entries were ever added to the stream
+func (st *Stream) EntriesAdded() uint64 {
+	return st.entriesAdded
+}
+
+// NextID returns the ID XADD * generates at ms: ms and the first sequence
+// number, or the sequence after the last ID if it is as late
+func (st *Stream) NextID(ms uint64) (StreamID, error) {
+	if ms > st.lastID.Ms {
+		return StreamID{ms, 0}, nil
+	}
+	id, ok := st.lastID.Next()
+	if !ok {
+		return id, ErrStreamExhausted
+	}
+	return id, nil
+}
+
+// NextSeq returns the ID XADD ms-* generates: ms and the sequence after the
+// last ID's if it has the same time, 0 if ms is later
+func (st *Stream) NextSeq(ms uint64) (StreamID, error) {
+	switch {
+	case ms < st.lastID.Ms:
+		return StreamID{}, ErrStreamIDTooSmall
+	case ms > st.lastID.Ms:
+		return StreamID{ms, 0}, nil
+	case st.lastID.Seq == math.MaxUint64:
+		return StreamID{}, ErrStreamIDTooSmall
+	}
+	return StreamID{ms, st.lastID.Seq + 1}, nil
+}
+
+// Add appends an entry with id, which must be greater than the last ID
+func (st *Stream) Add(id StreamID, fields [][]byte) error {
+	switch {
+	case id == StreamID{}:
+		return ErrStreamIDZero
+	case id.Compare(st.lastID) <= 0:
+		return ErrStreamIDTooSmall
+	}
+	st.entries = append(st.entries, StreamEntry{ID: id, Fields: fields})
+	st.lastID = id
+	st.entriesAdded++
+	return nil
+}
+
+// search returns the index of the first entry whose ID is id or greater
+func (st *Stream) search(id StreamID) int {
+	i, _ := slices.BinarySearchFunc(st.entries, id, func(e StreamEntry, id StreamID) int {
+		return e.ID.Compare(id)
+	})
+	return i
+}
+
+// Range calls fn for the entries with IDs from start to end, both inclusive,
+// until it returns false. With reverse the entries come from end down to
+// start.
+func (st *Stream) Range(start, end StreamID, reverse bool, fn func(e StreamEntry) bool) {
+	if start.Compare(end) > 0 {
+		return
+	}
+	first := st.search(start)
+	last := st.search(end)
+	if last < len(st.entries) && st.entries[last].ID == end {
+		last++
+	}
+	entries := st.entries[first:last]
+	if reverse {
+		for i := len(entries) - 1; i >= 0; i-- {
+			if !fn(entries[i]) {
+				return
+			}
+		}
+		return
+	}
+	for _, e := range entries {
+		if !fn(e) {
+			return
+		}
+	}
+}
+
+// Delete removes the entries with ids and returns how many it removed
+func (st *Stream) Delete(ids ...StreamID) int {
+	removed := 0
+	for _, id := range ids {
+		i := st.search(id)
+		if i == len(st.entries) || st.entries[i].ID != id {
+			continue
+		}
+		st.entries = slices.Delete(st.entries, i, i+1)
+		if id.Compare(st.maxDeletedID) > 0 {
+			st.maxDeletedID = id
+		}
+		removed++
+	}
+	return removed
+}
+
+// trim removes the first n entries
+func (st *Stream) trim(n int) int {
+	// Clear the trimmed entries so the array doesn't keep their fields
+	clear(st.entries[:n])
+	st.entries = st.entries[n:]
+	return n
+}
+
+// TrimMaxLen removes the oldest entries beyond the newest maxLen, at most
+// limit of them if it is positive, and returns how many it removed
+func (st *Stream) TrimMaxLen(maxLen, limit int) int {
+	n := max(st.Len()-maxLen, 0)
+	if limit > 0 {
+		n = min(n, limit)
+	}
+	return st.trim(n)
+}
+
+// TrimMinID removes the entries with IDs below minID, at most limit of them
+// if it is positive, and returns how many it removed
+func (st *Stream) TrimMinID(minID StreamID, limit int) int {
+	n := st.search(minID)
+	if limit > 0 {
+		n = min(n, limit)
+	}
+	return st.trim(n)
+}
+
+// SetID sets the last ID, the count of entries ever added and the greatest
+// deleted ID, as XSETID does, after checking they are consistent with the
+// entries. A new greatest deleted ID must not exceed the last ID; one left
+// unchanged isn't checked, as XSETID without MAXDELETEDID doesn't.
+func (st *Stream) SetID(lastID StreamID, entriesAdded uint64, maxDeletedID StreamID) error {
+	switch {
+	case maxDeletedID != st.maxDeletedID && lastID.Compare(maxDeletedID) < 0:
+		return ErrSetIDBelowDeleted
+	case entriesAdded < uint64(st.Len()):
+		return ErrSetIDAdded
+	case st.Len() > 0 && lastID.Compare(st.entries[st.Len()-1].ID) < 0:
+		return ErrSetIDTooSmall
+	}
+	st.lastID, st.entriesAdded, st.maxDeletedID = lastID, entriesAdded, maxDeletedID
+	return nil
+}
+
+// ViewStream calls fn with the stream held by key, nil if key is missing
+func (s *Store) ViewStream(key string, fn func(st *Stream)) error {
+	return s.ViewStreams([]string{key}, func(streams []*Stream) {
+		fn(streams[0])
+	})
+}
+
+// ViewStreams calls fn with the streams held by keys, nil for missing keys
+func (s *Store) ViewStreams(keys []string, fn func(streams []*Stream)) error {
+	locked := s.rlock(keys...)
+	defer s.runlock(locked)
+	now := nowMillis()
+	streams := make([]*Stream, len(keys))
+	for i, key := range keys {
+		e := s.get(key, now)
+		if e == nil {
+			continue
+		}
+		var err error
+		if streams[i], err = valueAs[*Stream](e); err != nil {
+			return err
+		}
+	}
+	fn(streams)
+	return nil
+}
+
+// UpdateStream calls fn with the stream held by key. If key is missing fn
+// gets a new stream, stored unless fn returns an error, if create is set,
+// and nil otherwise.
+func (s *Store) UpdateStream(key string, create bool, fn func(st *Stream) error) error {
+	locked := s.lock(key)
+	defer s.unlock(locked)
+	e := s.getForWrite(key, nowMillis())
+	if e != nil {
+		st, err := valueAs[*Stream](e)
+		if err != nil {
+			return err
+		}
+		defer s.account(key, e)
+		return fn(st)
+	}
+	if !create {
+		return fn(nil)
+	}
+	st := NewStream()
+	if err := fn(st); err != nil {
+		return err
+	}
+	s.put(key, &entry{value: st})
+	return nil
+}
@@ -0,0 +1,109 @@
+package store
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+// ids returns the IDs of the entries of st from start to end
+func ids(st *Stream, start, end StreamID, reverse bool) []StreamID {
+	var got []StreamID
+	st.Range(start, end, reverse, func(e StreamEntry) bool {
+		got = append(got, e.ID)
+		return true
+	})
+	return got
+}
+
+func TestStreamIDs(t *testing.T) {
+	st := NewStream()
+	if err := st.Add(StreamID{}, nil); !errors.Is(err, ErrStreamIDZero) {
+		t.Errorf("Expected 0-0 to be rejected, got %v", err)
+	}
+	id, _ := st.NextSeq(0)
+	if id != (StreamID{0, 1}) {
+		t.Errorf("Expected 0-* to generate 0-1, got %v", id)
+	}
+	st.Add(StreamID{5, 3}, nil)
+	if id, _ := st.NextID(4); id != (StreamID{5, 4}) {
+		t.Errorf("Expected * behind the last ID to continue its sequence, got %v", id)
+	}
+	if id, _ := st.NextID(6); id != (StreamID{6, 0}) {
+		t.Errorf("Expected * after the last ID to start a sequence, got %v", id)
+	}
+	if _, err := st.NextSeq(4); !errors.Is(err, ErrStreamIDTooSmall) {
+		t.Errorf("Expected an earlier time to be rejected, got %v", err)
+	}
+	if err := st.Add(StreamID{5, 3}, nil); !errors.Is(err, ErrStreamIDTooSmall) {
+		t.Errorf("Expected the last ID to be rejected, got %v", err)
+	}
+
+	st.Add(StreamID{math.MaxUint64, math.MaxUint64}, nil)
+	if _, err := st.NextID(1); !errors.Is(err, ErrStreamExhausted) {
+		t.Errorf("Expected the stream to be exhausted, got %v", err)
+	}
+	if got := (StreamID{7, 0}).String(); got != "7-0" {
+		t.Errorf("Expected 7-0, got %s", got)
+	}
+}
+
+func TestStreamRangeAndTrim(t *testing.T) {
+	st := NewStream()
+	for ms := uint64(1); ms <= 5; ms++ {
+		st.Add(StreamID{ms, 0}, [][]byte{[]byte("f"), []byte("v")})
+	}
+	if got := ids(st, StreamID{2, 0}, StreamID{4, 0}, true); len(got) != 3 || got[0] != (StreamID{4, 0}) {
+		t.Errorf("Expected 4-0 3-0 2-0, got %v", got)
+	}
+	if got := ids(st, StreamID{3, 1}, MaxStreamID, false); len(got) != 2 || got[0] != (StreamID{4, 0}) {
+		t.Errorf("Expected 4-0 5-0, got %v", got)
+	}
+
+	if n := st.Delete(StreamID{3, 0}, StreamID{3, 0}, StreamID{9, 0}); n != 1 || st.MaxDeletedID() != (StreamID{3, 0}) {
+		t.Errorf("Expected one deletion recorded as the max deleted ID, got %d %v", n, st.MaxDeletedID())
+	}
+	if n := st.TrimMaxLen(1, 2); n != 2 || st.Len() != 2 {
+		t.Errorf("Expected LIMIT to cap trimming at 2, removed %d leaving %d", n, st.Len())
+	}
+	if n := st.TrimMinID(StreamID{5, 0}, 0); n != 1 || st.Len() != 1 {
+		t.Errorf("Expected 4-0 trimmed, removed %d leaving %d", n, st.Len())
+	}
+	if st.LastID() != (StreamID{5, 0}) || st.EntriesAdded() != 5 {
+		t.Errorf("Expected trimming to keep the last ID and count, got %v %d", st.LastID(), st.EntriesAdded())
+	}
+
+	if err := st.SetID(StreamID{4, 0}, 5, StreamID{}); !errors.Is(err, ErrSetIDTooSmall) {
+		t.Errorf("Expected an ID below the top entry to be rejected, got %v", err)
+	}
+	if err := st.SetID(StreamID{9, 0}, 0, StreamID{}); !errors.Is(err, ErrSetIDAdded) {
+		t.Errorf("Expected entries added below the length to be rejected, got %v", err)
+	}
+	if err := st.SetID(StreamID{9, 0}, 10, StreamID{8, 0}); err != nil || st.LastID() != (StreamID{9, 0}) {
+		t.Errorf("Expected the ID set, got %v %v", err, st.LastID())
+	}
+}
+
+func TestStoreStream(t *testing.T) {
+	s := New()
+	s.UpdateStream("missing", false, func(st *Stream) error {
+		if st != nil {
+			t.Error("Expected no stream without create")
+		}
+		return nil
+	})
+	s.UpdateStream("s", true, func(st *Stream) error {
+		return st.Add(StreamID{1, 0}, nil)
+	})
+	s.UpdateStream("s", false, func(st *Stream) error {
+		st.Delete(StreamID{1, 0})
+		return nil
+	})
+	if typ, _ := s.Type("s"); typ != TypeStream {
+		t.Errorf("Expected an emptied stream to be kept, got type %s", typ)
+	}
+	s.Set("str", []byte("v"), SetOptions{})
+	if err := s.ViewStreams([]string{"s", "str"}, func([]*Stream) {}); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+}
@@ -0,0 +1,299 @@
+package store
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// SetOptions are the conditions and expiration of Set, as given to SET
+type SetOptions struct {
+	NX       bool      // only set the key if it doesn't exist
+	XX       bool      // only set the key if it exists
+	Get      bool      // return the old value, which must be a string
+	KeepTTL  bool      // keep the key's expiration instead of clearing it
+	ExpireAt time.Time // when the key expires, if not zero
+}
+
+// SetResult reports what Set did
+type SetResult struct {
+	Written bool   // the value was stored, false if NX or XX prevented it
+	Old     []byte // the previous value, if SetOptions.Get was given
+	Existed bool   // the key existed before
+}
+
+// Get returns the string value of key and whether it exists. The value is
+// shared with the store and must not be modified.
+func (s *Store) Get(key string) ([]byte, bool, error) {
+	locked := s.rlock(key)
+	defer s.runlock(locked)
+	e := s.get(key, nowMillis())
+	if e == nil {
+		return nil, false, nil
+	}
+	value, err := valueAs[[]byte](e)
+	return value, err == nil, err
+}
+
+// Set stores value under key, replacing a value of any type unless
+// opts.Get is set, which requires the old value to be a string
+func (s *Store) Set(key string, value []byte, opts SetOptions) (SetResult, error) {
+	locked := s.lock(key)
+	defer s.unlock(locked)
+	old := s.getForWrite(key, nowMillis())
+
+	result := SetResult{Existed: old != nil}
+	if old != nil && opts.Get {
+		var err error
+		if result.Old, err = valueAs[[]byte](old); err != nil {
+			return SetResult{}, err
+		}
+	}
+	if (opts.NX && old != nil) || (opts.XX && old == nil) {
+		return result, nil
+	}
+
+	e := &entry{value: value}
+	if !opts.ExpireAt.IsZero() {
+		e.expireAt = opts.ExpireAt.UnixMilli()
+	} else if opts.KeepTTL && old != nil {
+		e.expireAt = old.expireAt
+	}
+	s.put(key, e)
+	result.Written = true
+	return result, nil
+}
+
+// GetDel returns the string value of key and whether it existed, and
+// deletes the key unless it holds another type
+func (s *Store) GetDel(key string) ([]byte, bool, error) {
+	locked := s.lock(key)
+	defer s.unlock(locked)
+	e := s.getForWrite(key, nowMillis())
+	if e == nil {
+		return nil, false, nil
+	}
+	value, err := valueAs[[]byte](e)
+	if err != nil {
+		return nil, false, err
+	}
+	s.drop(key)
+	return value, true, nil
+}
+
+// GetEx returns the string value of key and whether it exists, and replaces
+// its expiration with the one fn returns given the current one, zero meaning
+// none, unless fn returns false. A time already passed deletes the key. The
+// value is shared with the store and must not be modified.
+func (s *Store) GetEx(key string, fn func(current time.Time) (time.Time, bool)) ([]byte, bool, error) {
+	locked := s.lock(key)
+	defer s.unlock(locked)
+	now := nowMillis()
+	e := s.getForWrite(key, now)
+	if e == nil {
+		return nil, false, nil
+	}
+	value, err := valueAs[[]byte](e)
+	if err != nil {
+		return nil, false, err
+	}
+	if at, ok := fn(e.expireTime()); ok {
+		s.setExpireTime(key, e, at, now)
+	}
+	return value, true, nil
+}
+
+// MGet returns the values of keys, nil for the ones missing or not holding a string
+func (s *Store) MGet(keys ...string) ([][]byte, error) {
+	locked := s.rlock(keys...)
+	defer s.runlock(locked)
+	now := nowMillis()
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		if e := s.get(key, now); e != nil {
+			values[i], _ = e.value.([]byte)
+		}
+	}
+	return values, nil
+}
+
+// MSet stores values[i] under keys[i], all at once and without expiration.
+// A key given twice gets the last of its values.
+func (s *Store) MSet(keys []string, values [][]byte) error {
+	locked := s.lock(keys...)
+	defer s.unlock(locked)
+	for i, key := range keys {
+		s.put(key, &entry{value: values[i]})
+	}
+	return nil
+}
+
+// MSetNX is MSet if none of keys exists, and reports whether it stored them
+func (s *Store) MSetNX(keys []string, values [][]byte) (bool, error) {
+	locked := s.lock(keys...)
+	defer s.unlock(locked)
+	now := nowMillis()
+	for _, key := range keys {
+		if s.getForWrite(key, now) != nil {
+			return false, nil
+		}
+	}
+	for i, key := range keys {
+		s.put(key, &entry{value: values[i]})
+	}
+	return true, nil
+}
+
+// UpdateString replaces the string value of key with the one fn returns,
+// keeping its expiration. fn gets nil and false for a missing key; an error
+// from it leaves the key untouched and is returned.
+func (s *Store) UpdateString(key string, fn func(old []byte, exists bool) ([]byte, error)) ([]byte, error) {
+	locked := s.lock(key)
+	defer s.unlock(locked)
+	e := s.getForWrite(key, nowMillis())
+
+	var old []byte
+	if e != nil {
+		var err error
+		if old, err = valueAs[[]byte](e); err != nil {
+			return nil, err
+		}
+	}
+	value, err := fn(old, e != nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(value) > MaxStringSize {
+		return nil, ErrTooLarge
+	}
+	if e == nil {
+		s.put(key, &entry{value: value})
+	} else {
+		e.value = value
+		s.account(key, e)
+	}
+	return value, nil
+}
+
+// parseInt parses an integer the way Redis does, rejecting signs other than a
+// leading minus, leading zeros and spaces
+func parseInt(b []byte) (int64, bool) {
+	digits := b
+	if len(digits) > 0 && digits[0] == '-' {
+		digits = digits[1:]
+	}
+	if len(digits) == 0 || len(b) > 20 || (digits[0] == '0' && len(b) > 1) || digits[0] == '+' {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(string(b), 10, 64)
+	return n, err == nil
+}
+
+// IncrBy adds delta to the integer held as a string by key in st, a missing
+// key counting as 0, and returns the new value
+func IncrBy(st Storage, key string, delta int64) (int64, error) {
+	var n int64
+	_, err := st.UpdateString(key, func(old []byte, exists bool) ([]byte, error) {
+		if exists {
+			var ok bool
+			if n, ok = parseInt(old); !ok {
+				return nil, ErrNotInteger
+			}
+		}
+		if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+			return nil, ErrOverflow
+		}
+		n += delta
+		return strconv.AppendInt(nil, n, 10), nil
+	})
+	return n, err
+}
+
+// IncrByFloat adds delta to the number held as a string by key in st, a
+// missing key counting as 0, and returns the new value
+func IncrByFloat(st Storage, key string, delta float64) (float64, error) {
+	var f float64
+	_, err := st.UpdateString(key, func(old []byte, exists bool) ([]byte, error) {
+		if exists {
+			var err error
+			if f, err = strconv.ParseFloat(string(old), 64); err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+				return nil, ErrNotFloat
+			}
+		}
+		f += delta
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, ErrNaN
+		}
+		return strconv.AppendFloat(nil, f, 'f', -1, 64), nil
+	})
+	return f, err
+}
+
+// Append appends value to the string held by key in st, creating it if
+// missing, and returns the new length
+func Append(st Storage, key string, value []byte) (int, error) {
+	result, err := st.UpdateString(key, func(old []byte, exists bool) ([]byte, error) {
+		if len(old)+len(value) > MaxStringSize {
+			return nil, ErrTooLarge
+		}
+		// Copy rather than append in place: Get callers may hold the old slice
+		grown := make([]byte, len(old)+len(value))
+		copy(grown, old)
+		copy(grown[len(old):], value)
+		return grown, nil
+	})
+	return len(result), err
+}
+
+// SetRange overwrites the string held by key in st at offset with value,
+// padding it with zero bytes as needed, and returns the new length. An empty
+// value leaves the key as it is and creates nothing.
+func SetRange(st Storage, key string, offset int64, value []byte) (int, error) {
+	if offset < 0 {
+		return 0, ErrOffset
+	}
+	if offset+int64(len(value)) > MaxStringSize {
+		return 0, ErrTooLarge
+	}
+	if len(value) == 0 {
+		return StrLen(st, key)
+	}
+	result, err := st.UpdateString(key, func(old []byte, exists bool) ([]byte, error) {
+		size := max(len(old), int(offset)+len(value))
+		updated := make([]byte, size)
+		copy(updated, old)
+		copy(updated[offset:], value)
+		return updated, nil
+	})
+	return len(result), err
+}
+
+// GetRange returns the substring of the string held by key in st between the
+// start and end offsets, both inclusive, negative offsets counting from the end
+func GetRange(st Storage, key string, start, end int64) ([]byte, error) {
+	value, _, err := st.Get(key)
+	if err != nil || len(value) == 0 {
+		return nil, err
+	}
+	if start < 0 && end < 0 && start > end {
+		return nil, nil
+	}
+	n := int64(len(value))
+	if start < 0 {
+		start = max(n+start, 0)
+	}
+	if end < 0 {
+		end = max(n+end, 0)
+	}
+	end = min(end, n-1)
+	if start > end {
+		return nil, nil
+	}
+	return value[start : end+1], nil
+}
+
+// StrLen returns the length of the string held by key in st, 0 if it is missing
+func StrLen(st Storage, key string) (int, error) {
+	value, _, err := st.Get(key)
+	return len(value), err
+}
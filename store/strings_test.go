@@ -0,0 +1,222 @@
+package store
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSetConditions(t *testing.T) {
+	s := New()
+	if r, _ := s.Set("k", []byte("a"), SetOptions{XX: true}); r.Written {
+		t.Error("Expected XX not to create a key")
+	}
+	if r, _ := s.Set("k", []byte("a"), SetOptions{NX: true}); !r.Written || r.Existed {
+		t.Errorf("Expected NX to create the key, got %+v", r)
+	}
+	if r, _ := s.Set("k", []byte("b"), SetOptions{NX: true}); r.Written || !r.Existed {
+		t.Errorf("Expected NX not to overwrite, got %+v", r)
+	}
+	r, err := s.Set("k", []byte("c"), SetOptions{XX: true, Get: true})
+	if err != nil || !r.Written || string(r.Old) != "a" {
+		t.Errorf("Expected XX GET to return a, got %+v %v", r, err)
+	}
+	if value, ok, _ := s.Get("k"); !ok || string(value) != "c" {
+		t.Errorf("Expected c, got %q %v", value, ok)
+	}
+}
+
+func TestSetExpiration(t *testing.T) {
+	s := New()
+	s.Set("k", []byte("a"), SetOptions{ExpireAt: time.Now().Add(time.Hour)})
+	s.Set("k", []byte("b"), SetOptions{KeepTTL: true})
+	if s.get("k", nowMillis()).expireAt == 0 {
+		t.Error("Expected KEEPTTL to keep the expiration")
+	}
+	s.Set("k", []byte("c"), SetOptions{})
+	if s.get("k", nowMillis()).expireAt != 0 {
+		t.Error("Expected a plain Set to clear the expiration")
+	}
+
+	s.Set("gone", []byte("a"), SetOptions{ExpireAt: time.Now().Add(-time.Second)})
+	if _, ok, _ := s.Get("gone"); ok {
+		t.Error("Expected an expired key to be missing")
+	}
+	if n, _ := s.Exists("gone", "k"); n != 1 {
+		t.Errorf("Expected 1 existing key, got %d", n)
+	}
+	if r, _ := s.Set("gone", []byte("b"), SetOptions{NX: true}); !r.Written {
+		t.Error("Expected NX to overwrite an expired key")
+	}
+}
+
+func TestGetDelGetEx(t *testing.T) {
+	s := New()
+	s.Set("k", []byte("v"), SetOptions{})
+	at := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	value, ok, err := s.GetEx("k", func(current time.Time) (time.Time, bool) {
+		return at, current.IsZero()
+	})
+	if string(value) != "v" || !ok || err != nil {
+		t.Fatalf("Unexpected GetEx result %q %v %v", value, ok, err)
+	}
+	if got, _, _ := s.ExpireTime("k"); !got.Equal(at) {
+		t.Errorf("Expected expiration %v, got %v", at, got)
+	}
+
+	if value, ok, _ := s.GetDel("k"); string(value) != "v" || !ok {
+		t.Errorf("Unexpected GetDel result %q %v", value, ok)
+	}
+	if _, ok, _ := s.GetDel("k"); ok || s.Len() != 0 {
+		t.Error("Expected GetDel to have deleted the key")
+	}
+
+	s.UpdateHash("h", func(h *Hash) error {
+		h.Set("f", []byte("v"))
+		return nil
+	})
+	if _, _, err := s.GetDel("h"); err != ErrWrongType {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+	if s.Len() != 1 {
+		t.Error("Expected GetDel to keep a key of another type")
+	}
+}
+
+func TestWrongType(t *testing.T) {
+	s := New()
+	s.shardOf("k").keys.set("k", &entry{value: 1})
+	if _, _, err := s.Get("k"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType from Get, got %v", err)
+	}
+	if _, err := IncrBy(s, "k", 1); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType from IncrBy, got %v", err)
+	}
+	if _, err := s.Set("k", nil, SetOptions{Get: true}); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType from Set GET, got %v", err)
+	}
+	if values, _ := s.MGet("k"); values[0] != nil {
+		t.Errorf("Expected MGet to skip a non-string, got %q", values[0])
+	}
+	if _, err := s.Set("k", []byte("a"), SetOptions{}); err != nil {
+		t.Errorf("Expected Set to replace any type, got %v", err)
+	}
+}
+
+func TestIncrBy(t *testing.T) {
+	s := New()
+	if n, err := IncrBy(s, "n", 5); err != nil || n != 5 {
+		t.Errorf("Expected 5, got %d %v", n, err)
+	}
+	if n, _ := IncrBy(s, "n", -7); n != -2 {
+		t.Errorf("Expected -2, got %d", n)
+	}
+
+	s.Set("max", []byte("9223372036854775807"), SetOptions{})
+	if _, err := IncrBy(s, "max", 1); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Expected ErrOverflow, got %v", err)
+	}
+	for _, value := range []string{"", "abc", " 1", "+1", "01", "-0", "1.5", "99999999999999999999"} {
+		s.Set("bad", []byte(value), SetOptions{})
+		if _, err := IncrBy(s, "bad", 1); !errors.Is(err, ErrNotInteger) {
+			t.Errorf("Expected ErrNotInteger for %q, got %v", value, err)
+		}
+	}
+}
+
+func TestIncrByFloat(t *testing.T) {
+	s := New()
+	s.Set("f", []byte("10.5"), SetOptions{})
+	if f, err := IncrByFloat(s, "f", 0.1); err != nil || f != 10.6 {
+		t.Errorf("Expected 10.6, got %v %v", f, err)
+	}
+	if value, _, _ := s.Get("f"); string(value) != "10.6" {
+		t.Errorf("Expected 10.6 stored, got %q", value)
+	}
+	if _, err := IncrByFloat(s, "f", math.Inf(1)); !errors.Is(err, ErrNaN) {
+		t.Errorf("Expected ErrNaN, got %v", err)
+	}
+	s.Set("bad", []byte("x"), SetOptions{})
+	if _, err := IncrByFloat(s, "bad", 1); !errors.Is(err, ErrNotFloat) {
+		t.Errorf("Expected ErrNotFloat, got %v", err)
+	}
+}
+
+func TestAppendDoesNotShare(t *testing.T) {
+	s := New()
+	s.Set("k", []byte("hello"), SetOptions{})
+	old, _, _ := s.Get("k")
+	if n, err := Append(s, "k", []byte(" world")); err != nil || n != 11 {
+		t.Errorf("Expected 11, got %d %v", n, err)
+	}
+	if string(old) != "hello" {
+		t.Errorf("Expected the old value to be untouched, got %q", old)
+	}
+	if n, _ := Append(s, "new", []byte("x")); n != 1 {
+		t.Errorf("Expected Append to create the key, got %d", n)
+	}
+}
+
+func TestSetRange(t *testing.T) {
+	s := New()
+	if n, err := SetRange(s, "k", 3, []byte("ab")); err != nil || n != 5 {
+		t.Errorf("Expected 5, got %d %v", n, err)
+	}
+	if value, _, _ := s.Get("k"); string(value) != "\x00\x00\x00ab" {
+		t.Errorf("Expected zero padding, got %q", value)
+	}
+	if n, _ := SetRange(s, "k", 0, []byte("xy")); n != 5 {
+		t.Errorf("Expected the length to stay 5, got %d", n)
+	}
+	if n, _ := SetRange(s, "missing", 10, nil); n != 0 || s.Len() != 1 {
+		t.Error("Expected an empty value not to create the key")
+	}
+	if _, err := SetRange(s, "k", -1, []byte("a")); !errors.Is(err, ErrOffset) {
+		t.Errorf("Expected ErrOffset, got %v", err)
+	}
+	if _, err := SetRange(s, "k", MaxStringSize, []byte("a")); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Expected ErrTooLarge, got %v", err)
+	}
+}
+
+func TestGetRange(t *testing.T) {
+	s := New()
+	s.Set("k", []byte("This is a string"), SetOptions{})
+	tests := []struct {
+		start, end int64
+		want       string
+	}{
+		{0, 3, "This"},
+		{-3, -1, "ing"},
+		{0, -1, "This is a string"},
+		{10, 100, "string"},
+		{5, 3, ""},
+		{-1, -5, ""},
+		{-100, 1, "Th"},
+	}
+	for _, tt := range tests {
+		if got, err := GetRange(s, "k", tt.start, tt.end); err != nil || string(got) != tt.want {
+			t.Errorf("GetRange(%d, %d): expected %q, got %q %v", tt.start, tt.end, tt.want, got, err)
+		}
+	}
+	if got, _ := GetRange(s, "missing", 0, -1); len(got) != 0 {
+		t.Errorf("Expected empty for a missing key, got %q", got)
+	}
+}
+
+func TestMSetNX(t *testing.T) {
+	s := New()
+	if ok, _ := s.MSetNX([]string{"a", "b"}, [][]byte{[]byte("1"), []byte("2")}); !ok {
+		t.Error("Expected MSetNX to set new keys")
+	}
+	if ok, _ := s.MSetNX([]string{"b", "c"}, [][]byte{[]byte("3"), []byte("4")}); ok {
+		t.Error("Expected MSetNX to fail when a key exists")
+	}
+	if n, _ := s.Exists("c"); n != 0 {
+		t.Error("Expected MSetNX to set nothing when it fails")
+	}
+	if n, _ := s.Delete("a", "b", "c"); n != 2 {
+		t.Errorf("Expected 2 deleted, got %d", n)
+	}
+}
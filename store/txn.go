@@ -0,0 +1,255 @@
+package store
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+// ErrKeyNotLocked is returned by a Txn asked for a key not given to Update
+var ErrKeyNotLocked = errors.New("the key wasn't given to Update")
+
+// TxnStorage is a Storage that can also run a function over several keys
+// atomically, as handlers composing keys in ways the built-in commands don't
+// need: no other operation sees the keys until the function returns.
+type TxnStorage interface {
+	Storage
+	// Update calls fn with a Txn over keys and returns its error. Writes
+	// aren't undone when fn fails, so fn should return an error before
+	// making any, as the built-in commands do.
+	Update(keys []string, fn func(txn Txn) error) error
+}
+
+var _ TxnStorage = (*Store)(nil)
+
+// Txn reads and writes the keys given to Update while they are locked. It
+// is valid only until the function it was passed to returns. Asking for any
+// other key is ErrKeyNotLocked, and a key holding another type than asked
+// for is ErrWrongType.
+type Txn interface {
+	// Type returns the type name of the value of key, TypeNone if missing
+	Type(key string) (string, error)
+	// Delete removes key and reports whether it existed
+	Delete(key string) (bool, error)
+	// ExpireTime returns when key expires, zero if it doesn't, and whether
+	// it exists
+	ExpireTime(key string) (time.Time, bool, error)
+	// Expire sets when key expires, or removes its expiration if at is
+	// zero, and reports whether the key exists. A time already passed
+	// deletes the key.
+	Expire(key string, at time.Time) (bool, error)
+	// GetString returns the string value of key and whether it exists
+	GetString(key string) ([]byte, bool, error)
+	// SetString stores value under key without expiration, replacing a
+	// value of any type
+	SetString(key string, value []byte) error
+	// Hash, List, Set and ZSet return the collection held by key to change
+	// in place, storing an empty one if key is missing. Once the function
+	// returns, keys whose collection is empty are deleted.
+	Hash(key string) (*Hash, error)
+	List(key string) (*List, error)
+	Set(key string) (*Set, error)
+	ZSet(key string) (*ZSet, error)
+	// Stream returns the stream held by key to change in place. If key is
+	// missing it stores a new stream if create is set and returns nil
+	// otherwise.
+	Stream(key string, create bool) (*Stream, error)
+	// Value returns the Value of type typ held by key to change in place,
+	// nil if key is missing
+	Value(key, typ string) (Value, error)
+	// SetValue stores v under key without expiration, replacing a value of
+	// any type
+	SetValue(key string, v Value) error
+}
+
+// Update calls fn with a Txn over keys, holding the shards of keys for
+// writing until it returns
+func (s *Store) Update(keys []string, fn func(txn Txn) error) error {
+	locked := s.lock(keys...)
+	defer s.unlock(locked)
+	t := &txn{s: s, keys: keys, now: nowMillis(), held: make(map[string]struct{})}
+	err := fn(t)
+	t.finish()
+	return err
+}
+
+// txn is the Txn of Store.Update
+type txn struct {
+	s    *Store
+	keys []string
+	now  int64
+	held map[string]struct{} // keys whose values were handed out to change in place
+}
+
+// entry returns the live entry of key, after checking it was given to Update
+func (t *txn) entry(key string) (*entry, error) {
+	if !slices.Contains(t.keys, key) {
+		return nil, ErrKeyNotLocked
+	}
+	return t.s.getForWrite(key, t.now), nil
+}
+
+// replace stores e under key, or deletes key if e is nil
+func (t *txn) replace(key string, e *entry) error {
+	if !slices.Contains(t.keys, key) {
+		return ErrKeyNotLocked
+	}
+	if e == nil {
+		t.s.drop(key)
+	} else {
+		t.s.put(key, e)
+	}
+	return nil
+}
+
+func (t *txn) Type(key string) (string, error) {
+	e, err := t.entry(key)
+	if err != nil || e == nil {
+		return TypeNone, err
+	}
+	return e.typeName(), nil
+}
+
+func (t *txn) Delete(key string) (bool, error) {
+	e, err := t.entry(key)
+	if err != nil || e == nil {
+		return false, err
+	}
+	return true, t.replace(key, nil)
+}
+
+func (t *txn) ExpireTime(key string) (time.Time, bool, error) {
+	e, err := t.entry(key)
+	if err != nil || e == nil {
+		return time.Time{}, false, err
+	}
+	return e.expireTime(), true, nil
+}
+
+func (t *txn) Expire(key string, at time.Time) (bool, error) {
+	e, err := t.entry(key)
+	if err != nil || e == nil {
+		return false, err
+	}
+	t.s.setExpireTime(key, e, at, t.now)
+	return true, nil
+}
+
+func (t *txn) GetString(key string) ([]byte, bool, error) {
+	e, err := t.entry(key)
+	if err != nil || e == nil {
+		return nil, false, err
+	}
+	value, err := valueAs[[]byte](e)
+	return value, err == nil, err
+}
+
+func (t *txn) SetString(key string, value []byte) error {
+	if len(value) > MaxStringSize {
+		return ErrTooLarge
+	}
+	return t.replace(key, &entry{value: value})
+}
+
+func (t *txn) Hash(key string) (*Hash, error) {
+	h, err := txnValue(t, key, NewHash)
+	if err == nil {
+		h.purge(t.now)
+	}
+	return h, err
+}
+
+func (t *txn) List(key string) (*List, error) {
+	return txnValue(t, key, NewList)
+}
+
+func (t *txn) Set(key string) (*Set, error) {
+	return txnValue(t, key, NewSet)
+}
+
+func (t *txn) ZSet(key string) (*ZSet, error) {
+	return txnValue(t, key, NewZSet)
+}
+
+func (t *txn) Stream(key string, create bool) (*Stream, error) {
+	e, err := t.entry(key)
+	if err != nil || (e == nil && !create) {
+		return nil, err
+	}
+	if e == nil {
+		e = &entry{value: NewStream()}
+		t.s.put(key, e)
+	}
+	st, err := valueAs[*Stream](e)
+	if err == nil {
+		t.held[key] = struct{}{}
+	}
+	return st, err
+}
+
+func (t *txn) Value(key, typ string) (Value, error) {
+	e, err := t.entry(key)
+	if err != nil {
+		return nil, err
+	}
+	v, err := valueOf(e, typ)
+	if v != nil {
+		t.held[key] = struct{}{}
+	}
+	return v, err
+}
+
+func (t *txn) SetValue(key string, v Value) error {
+	return t.replace(key, &entry{value: v})
+}
+
+// txnValue returns the value of type T held by key, storing newValue()
+// under key if it is missing, so that the Txn sees it as the others would
+func txnValue[T any](t *txn, key string, newValue func() T) (T, error) {
+	var v T
+	e, err := t.entry(key)
+	if err != nil {
+		return v, err
+	}
+	if e == nil {
+		e = &entry{value: newValue()}
+		t.s.put(key, e)
+	}
+	v, err = valueAs[T](e)
+	if err == nil {
+		t.held[key] = struct{}{}
+	}
+	return v, err
+}
+
+// finish deletes the keys whose collection was emptied and accounts for the
+// others whose values were handed out
+func (t *txn) finish() {
+	for key := range t.held {
+		e, _ := t.s.shardOf(key).keys.get(key)
+		switch {
+		case e == nil:
+		case emptied(e.value):
+			t.s.drop(key)
+		default:
+			t.s.account(key, e)
+		}
+	}
+}
+
+// emptied reports whether v is a collection left without elements, which
+// the store doesn't keep
+func emptied(v any) bool {
+	switch v := v.(type) {
+	case *Hash:
+		return v.fields.len() == 0
+	case *List:
+		return v.Len() == 0
+	case *Set:
+		return v.Len() == 0
+	case *ZSet:
+		return v.Len() == 0
+	default:
+		return false
+	}
+}
@@ -0,0 +1,125 @@
+package store
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// smove moves member from the set of src to that of dst, as SMOVE does
+func smove(s *Store, src, dst, member string) (bool, error) {
+	moved := false
+	err := s.Update([]string{src, dst}, func(txn Txn) error {
+		if typ, err := txn.Type(dst); err != nil || (typ != TypeSet && typ != TypeNone) {
+			return ErrWrongType
+		}
+		from, err := txn.Set(src)
+		if err != nil {
+			return err
+		}
+		if moved = from.Remove(member); moved {
+			to, _ := txn.Set(dst)
+			to.Add(member)
+		}
+		return nil
+	})
+	return moved, err
+}
+
+func TestUpdate(t *testing.T) {
+	s := New()
+	s.UpdateSet("src", func(set *Set) error {
+		set.Add("a")
+		return nil
+	})
+	if moved, err := smove(s, "src", "dst", "a"); !moved || err != nil {
+		t.Fatalf("Expected the member to move, got %v, %v", moved, err)
+	}
+	if n, _ := s.Exists("src"); n != 0 {
+		t.Error("Expected the emptied set to be deleted")
+	}
+	s.ViewSet("dst", func(set *Set) {
+		if !set.Contains("a") {
+			t.Error("Expected the member in the new set")
+		}
+	})
+	if moved, _ := smove(s, "src", "dst", "a"); moved {
+		t.Error("Expected nothing to move from a missing set")
+	}
+	if n := s.Len(); n != 1 {
+		t.Errorf("Expected an empty set asked for not to be kept, got %d keys", n)
+	}
+
+	s.Set("string", []byte("v"), SetOptions{})
+	if _, err := smove(s, "dst", "string", "a"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+	err := s.Update([]string{"string"}, func(txn Txn) error {
+		if _, err := txn.Hash("string"); !errors.Is(err, ErrWrongType) {
+			t.Errorf("Expected ErrWrongType for a string, got %v", err)
+		}
+		if _, _, err := txn.GetString("other"); !errors.Is(err, ErrKeyNotLocked) {
+			t.Errorf("Expected ErrKeyNotLocked, got %v", err)
+		}
+		if err := txn.SetString("string", []byte("w")); err != nil {
+			return err
+		}
+		if ok, err := txn.Expire("string", time.Now().Add(time.Hour)); !ok || err != nil {
+			t.Errorf("Expected the key to get an expiration, got %v, %v", ok, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if value, _, _ := s.Get("string"); string(value) != "w" {
+		t.Errorf("Expected w, got %q", value)
+	}
+	if at, _, _ := s.ExpireTime("string"); at.IsZero() {
+		t.Error("Expected the expiration set in the transaction")
+	}
+	if stats, _ := s.MemoryStats(); stats.Bytes != accounted(s) {
+		t.Errorf("Accounted %d bytes, expected %d", stats.Bytes, accounted(s))
+	}
+}
+
+// TestUpdateConcurrent moves amounts between counters from several
+// goroutines at once, which only keeps their total if every transfer is
+// atomic
+func TestUpdateConcurrent(t *testing.T) {
+	s := New()
+	keys := []string{"a", "b", "c", "d"}
+	for _, key := range keys {
+		s.Set(key, []byte("100"), SetOptions{})
+	}
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 200 {
+				from, to := keys[(g+i)%len(keys)], keys[(g+i+1)%len(keys)]
+				s.Update([]string{from, to}, func(txn Txn) error {
+					a, _, _ := txn.GetString(from)
+					b, _, _ := txn.GetString(to)
+					x, _ := strconv.Atoi(string(a))
+					y, _ := strconv.Atoi(string(b))
+					txn.SetString(from, strconv.AppendInt(nil, int64(x-1), 10))
+					return txn.SetString(to, strconv.AppendInt(nil, int64(y+1), 10))
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	total := 0
+	for _, key := range keys {
+		value, _, _ := s.Get(key)
+		n, _ := strconv.Atoi(string(value))
+		total += n
+	}
+	if total != 400 {
+		t.Errorf("Expected the counters to total 400, got %d", total)
+	}
+}
@@ -0,0 +1,121 @@
+package store
+
+import "slices"
+
+// Value is a value of a data type defined outside this package, such as the
+// JSON documents of modules/json. The store keeps it as it is, so its keys
+// expire and are deleted and scanned like those of the built-in types.
+type Value interface {
+	// Type returns the name Storage.Type reports for keys holding the value
+	Type() string
+}
+
+// ValueStorage is a Storage that also holds Values, as modules adding data
+// types need
+type ValueStorage interface {
+	Storage
+	// ViewValues calls fn with the Values held by keys, nil for missing
+	// keys. A key holding anything but a Value whose Type is typ is
+	// ErrWrongType. fn must not modify the values.
+	ViewValues(keys []string, typ string, fn func(values []Value)) error
+	// UpdateValues is ViewValues for fn changing the values in place. fn
+	// can also set values[i] to store a new value at keys[i], or to nil to
+	// delete the key; unless fn returns an error, what it leaves in values
+	// is stored. For a key given twice the last position wins.
+	UpdateValues(keys []string, typ string, fn func(values []Value) error) error
+	// ViewAllValues calls fn with every key holding a Value whose Type is
+	// typ and those values, in no particular order, as commands querying
+	// all of a type's keys need. fn must not modify the values.
+	ViewAllValues(typ string, fn func(keys []string, values []Value)) error
+}
+
+var _ ValueStorage = (*Store)(nil)
+
+// valueOf returns the Value of type typ held by e, nil for a missing key, or
+// ErrWrongType
+func valueOf(e *entry, typ string) (Value, error) {
+	if e == nil {
+		return nil, nil
+	}
+	v, ok := e.value.(Value)
+	if !ok || v.Type() != typ {
+		return nil, ErrWrongType
+	}
+	return v, nil
+}
+
+// ViewValues calls fn with the Values of type typ held by keys, nil for
+// missing keys
+func (s *Store) ViewValues(keys []string, typ string, fn func(values []Value)) error {
+	locked := s.rlock(keys...)
+	defer s.runlock(locked)
+	now := nowMillis()
+	values := make([]Value, len(keys))
+	for i, key := range keys {
+		var err error
+		if values[i], err = valueOf(s.get(key, now), typ); err != nil {
+			return err
+		}
+	}
+	fn(values)
+	return nil
+}
+
+// UpdateValues calls fn with the Values of type typ held by keys, nil for
+// missing keys, and stores what fn leaves in values unless it returns an
+// error
+func (s *Store) UpdateValues(keys []string, typ string, fn func(values []Value) error) error {
+	locked := s.lock(keys...)
+	defer s.unlock(locked)
+	now := nowMillis()
+	values := make([]Value, len(keys))
+	entries := make([]*entry, len(keys))
+	for i, key := range keys {
+		entries[i] = s.getForWrite(key, now)
+		var err error
+		if values[i], err = valueOf(entries[i], typ); err != nil {
+			return err
+		}
+	}
+	if err := fn(values); err != nil {
+		return err
+	}
+	for i, key := range keys {
+		if slices.Contains(keys[i+1:], key) {
+			continue
+		}
+		switch {
+		case values[i] == nil:
+			s.drop(key)
+		case entries[i] == nil:
+			s.put(key, &entry{value: values[i]})
+		default:
+			// Replacing the value keeps the key's expiration
+			entries[i].value = values[i]
+			s.account(key, entries[i])
+		}
+	}
+	return nil
+}
+
+// ViewAllValues calls fn with every key holding a Value of type typ and those
+// values
+func (s *Store) ViewAllValues(typ string, fn func(keys []string, values []Value)) error {
+	all := s.allShards()
+	s.rlockShards(all)
+	defer s.runlock(all)
+	now := nowMillis()
+	var keys []string
+	var values []Value
+	for i := range s.shards {
+		s.shards[i].keys.forEach(func(key string, e *entry) bool {
+			if v, ok := e.value.(Value); ok && v.Type() == typ && !e.expired(now) {
+				keys = append(keys, key)
+				values = append(values, v)
+			}
+			return true
+		})
+	}
+	fn(keys, values)
+	return nil
+}
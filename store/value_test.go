@@ -0,0 +1,62 @@
+package store
+
+import (
+	"errors"
+	"testing"
+)
+
+// counter is a Value for testing
+type counter struct{ n int }
+
+func (*counter) Type() string { return "counter" }
+
+func TestStoreValues(t *testing.T) {
+	s := New()
+	err := s.UpdateValues([]string{"a", "b", "a"}, "counter", func(values []Value) error {
+		if values[0] != nil || values[2] != nil {
+			t.Error("Expected nil for missing keys")
+		}
+		values[0], values[1], values[2] = &counter{1}, &counter{2}, &counter{3}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.ViewValues([]string{"a", "b"}, "counter", func(values []Value) {
+		if values[0].(*counter).n != 3 || values[1].(*counter).n != 2 {
+			t.Errorf("Expected the last position to win, got %v %v", values[0], values[1])
+		}
+	})
+	if typ, _ := s.Type("a"); typ != "counter" {
+		t.Errorf("Expected type counter, got %s", typ)
+	}
+
+	s.UpdateValues([]string{"b"}, "counter", func(values []Value) error {
+		values[0] = nil
+		return nil
+	})
+	if n, _ := s.Exists("b"); n != 0 {
+		t.Error("Expected a nil value to delete the key")
+	}
+	s.UpdateValues([]string{"a"}, "counter", func(values []Value) error {
+		values[0] = nil
+		return errors.New("failed")
+	})
+	if n, _ := s.Exists("a"); n != 1 {
+		t.Error("Expected a failed update to keep the key")
+	}
+
+	s.Set("str", []byte("v"), SetOptions{})
+	if err := s.ViewValues([]string{"str"}, "counter", func([]Value) {}); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType for a string, got %v", err)
+	}
+	if err := s.ViewValues([]string{"a"}, "other", func([]Value) {}); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType for another Value type, got %v", err)
+	}
+
+	s.ViewAllValues("counter", func(keys []string, values []Value) {
+		if len(keys) != 1 || keys[0] != "a" || values[0].(*counter).n != 3 {
+			t.Errorf("Expected only a from ViewAllValues, got %v", keys)
+		}
+	})
+}
@@ -0,0 +1,387 @@
+package store
+
+import "math"
+
+// TypeZSet is the Storage.Type of sorted set keys
+const TypeZSet = "zset"
+
+// ZSetStorage is a Storage that also holds sorted sets, as the sorted set
+// commands need. Sorted sets are handed to fn as a ZSet, as HashStorage does
+// with hashes.
+type ZSetStorage interface {
+	Storage
+	// ViewZSet calls fn with the sorted set held by key, an empty one if key
+	// is missing. fn must not modify the sorted set.
+	ViewZSet(key string, fn func(z *ZSet)) error
+	// UpdateZSet calls fn with the sorted set held by key, an empty one if
+	// key is missing, and stores the result, deleting the key if the sorted
+	// set is left empty. fn should return an error before changing the
+	// sorted set; the error is returned.
+	UpdateZSet(key string, fn func(z *ZSet) error) error
+	// ViewZSets is ViewZSet for several keys at once, as ZUNION needs
+	ViewZSets(keys []string, fn func(zsets []*ZSet)) error
+	// StoreZSet calls fn with the sorted sets held by keys and stores the
+	// sorted set it returns at dst, replacing whatever dst held, or deletes
+	// dst if the sorted set is empty, as ZUNIONSTORE needs
+	StoreZSet(dst string, keys []string, fn func(zsets []*ZSet) *ZSet) error
+}
+
+var _ ZSetStorage = (*Store)(nil)
+
+// ZSet is a set of string members ordered by a float score, then by member
+// for equal scores. A hash table maps members to scores and a skiplist keeps
+// the order, so lookups, updates and rank queries are O(log n) or better.
+// Ranks are 0-based and count from the lowest score. It is not safe for
+// concurrent use.
+type ZSet struct {
+	scores dict[float64]
+	list   skiplist
+}
+
+// NewZSet returns an empty sorted set
+func NewZSet() *ZSet {
+	return &ZSet{scores: newDict[float64](), list: newSkiplist()}
+}
+
+// Len returns the number of members
+func (z *ZSet) Len() int {
+	return z.list.length
+}
+
+// clone returns a deep copy of z
+func (z *ZSet) clone() *ZSet {
+	c := NewZSet()
+	z.Range(0, z.Len()-1, false, func(member string, score float64) bool {
+		c.Add(member, score)
+		return true
+	})
+	return c
+}
+
+// Score returns the score of member and whether it is in the sorted set
+func (z *ZSet) Score(member string) (float64, bool) {
+	return z.scores.get(member)
+}
+
+// Add sets the score of member and reports whether the member is new
+func (z *ZSet) Add(member string, score float64) bool {
+	old, ok := z.scores.get(member)
+	if ok {
+		if old != score {
+			z.list.delete(old, member)
+			z.list.insert(score, member)
+			z.scores.set(member, score)
+		}
+		return false
+	}
+	z.list.insert(score, member)
+	z.scores.set(member, score)
+	return true
+}
+
+// Remove removes member and reports whether it was in the sorted set
+func (z *ZSet) Remove(member string) bool {
+	score, ok := z.scores.get(member)
+	if !ok {
+		return false
+	}
+	z.list.delete(score, member)
+	z.scores.delete(member)
+	return true
+}
+
+// Rank returns the rank of member and whether it is in the sorted set
+func (z *ZSet) Rank(member string) (int, bool) {
+	score, ok := z.scores.get(member)
+	if !ok {
+		return 0, false
+	}
+	return z.list.rank(score, member), true
+}
+
+// Range calls fn for the members ranked from start to stop, both inclusive
+// and clamped to the sorted set, until it returns false. With reverse the
+// members come from stop down to start.
+func (z *ZSet) Range(start, stop int, reverse bool, fn func(member string, score float64) bool) {
+	start, stop = max(start, 0), min(stop, z.Len()-1)
+	if start > stop {
+		return
+	}
+	if reverse {
+		n := z.list.byRank(stop)
+		for i := stop; i >= start && n != nil; i, n = i-1, n.backward {
+			if !fn(n.member, n.score) {
+				return
+			}
+		}
+		return
+	}
+	n := z.list.byRank(start)
+	for i := start; i <= stop && n != nil; i, n = i+1, n.level[0].forward {
+		if !fn(n.member, n.score) {
+			return
+		}
+	}
+}
+
+// RemoveRange removes the members ranked from start to stop, both inclusive
+// and clamped to the sorted set, and returns how many it removed
+func (z *ZSet) RemoveRange(start, stop int) int {
+	var members []string
+	z.Range(start, stop, false, func(member string, _ float64) bool {
+		members = append(members, member)
+		return true
+	})
+	for _, member := range members {
+		z.Remove(member)
+	}
+	return len(members)
+}
+
+// ScoreBound is an end of a score range, such as (1.5 or +inf
+type ScoreBound struct {
+	Score     float64
+	Exclusive bool
+}
+
+// belowMin reports whether score is below b as the minimum of a range
+func (b ScoreBound) belowMin(score float64) bool {
+	if b.Exclusive {
+		return score <= b.Score
+	}
+	return score < b.Score
+}
+
+// aboveMax reports whether score is above b as the maximum of a range
+func (b ScoreBound) aboveMax(score float64) bool {
+	if b.Exclusive {
+		return score >= b.Score
+	}
+	return score > b.Score
+}
+
+// ScoreSpan returns the ranks of the first and last members scored from min
+// to max; start is greater than stop if there are none
+func (z *ZSet) ScoreSpan(min, max ScoreBound) (start, stop int) {
+	start = z.list.countWhile(func(n *skiplistNode) bool { return min.belowMin(n.score) })
+	stop = z.list.countWhile(func(n *skiplistNode) bool { return !max.aboveMax(n.score) }) - 1
+	return start, stop
+}
+
+// LexBound is an end of a member range, such as [a, (b, - or +
+type LexBound struct {
+	Member    string
+	Exclusive bool
+	Inf       int // -1 for -, 1 for +, which sort before and after every member
+}
+
+// belowMin reports whether member is below b as the minimum of a range
+func (b LexBound) belowMin(member string) bool {
+	switch {
+	case b.Inf != 0:
+		return b.Inf > 0
+	case b.Exclusive:
+		return member <= b.Member
+	default:
+		return member < b.Member
+	}
+}
+
+// aboveMax reports whether member is above b as the maximum of a range
+func (b LexBound) aboveMax(member string) bool {
+	switch {
+	case b.Inf != 0:
+		return b.Inf < 0
+	case b.Exclusive:
+		return member >= b.Member
+	default:
+		return member > b.Member
+	}
+}
+
+// LexSpan is ScoreSpan for the members from min to max of a sorted set whose
+// members all have the same score, ordered by member
+func (z *ZSet) LexSpan(min, max LexBound) (start, stop int) {
+	start = z.list.countWhile(func(n *skiplistNode) bool { return min.belowMin(n.member) })
+	stop = z.list.countWhile(func(n *skiplistNode) bool { return !max.aboveMax(n.member) }) - 1
+	return start, stop
+}
+
+// Random returns a random member and its score, false if the sorted set is
+// empty
+func (z *ZSet) Random() (string, float64, bool) {
+	return z.scores.random()
+}
+
+// Scan returns members matching match, all if it is empty, from cursor on
+// and the cursor to continue from, as Storage.Scan does for keys
+func (z *ZSet) Scan(cursor uint64, match string, count int) ([]string, uint64) {
+	var members []string
+	next := z.scores.scan(cursor, count, func(member string, _ float64) bool {
+		if match != "" && !Match(match, member) {
+			return false
+		}
+		members = append(members, member)
+		return true
+	})
+	return members, next
+}
+
+// Aggregate is how ZUnion and ZInter combine the scores of a member found in
+// several sorted sets
+type Aggregate int
+
+const (
+	AggregateSum Aggregate = iota
+	AggregateMin
+	AggregateMax
+)
+
+// combine returns the aggregate of x and y. A sum of opposite infinities is
+// 0, as in Redis.
+func (a Aggregate) combine(x, y float64) float64 {
+	switch a {
+	case AggregateMin:
+		return min(x, y)
+	case AggregateMax:
+		return max(x, y)
+	}
+	if sum := x + y; !math.IsNaN(sum) {
+		return sum
+	}
+	return 0
+}
+
+// weighted returns score multiplied by the weight of the i-th input, 1
+// without weights. An infinite score weighted 0 is 0.
+func weighted(score float64, weights []float64, i int) float64 {
+	if weights == nil {
+		return score
+	}
+	if w := score * weights[i]; !math.IsNaN(w) {
+		return w
+	}
+	return 0
+}
+
+// ZUnion returns the members found in any of zsets, scored by agg of their
+// scores multiplied by weights, which is nil or holds one weight per input
+func ZUnion(zsets []*ZSet, weights []float64, agg Aggregate) *ZSet {
+	scores := make(map[string]float64)
+	for i, z := range zsets {
+		z.scores.forEach(func(member string, score float64) bool {
+			score = weighted(score, weights, i)
+			if old, ok := scores[member]; ok {
+				score = agg.combine(old, score)
+			}
+			scores[member] = score
+			return true
+		})
+	}
+	result := NewZSet()
+	for member, score := range scores {
+		result.Add(member, score)
+	}
+	return result
+}
+
+// ZInter returns the members found in every one of zsets, scored as ZUnion
+// does
+func ZInter(zsets []*ZSet, weights []float64, agg Aggregate) *ZSet {
+	result := NewZSet()
+	zinter(zsets, func(member string) bool {
+		var score float64
+		for i, z := range zsets {
+			s, _ := z.Score(member)
+			s = weighted(s, weights, i)
+			if i > 0 {
+				s = agg.combine(score, s)
+			}
+			score = s
+		}
+		result.Add(member, score)
+		return true
+	})
+	return result
+}
+
+// ZInterCard returns how many members are found in every one of zsets,
+// counting up to limit if it is positive
+func ZInterCard(zsets []*ZSet, limit int) int {
+	n := 0
+	zinter(zsets, func(string) bool {
+		n++
+		return limit <= 0 || n < limit
+	})
+	return n
+}
+
+// zinter calls fn for the members found in every one of zsets until it
+// returns false, walking the smallest of them
+func zinter(zsets []*ZSet, fn func(member string) bool) {
+	if len(zsets) == 0 {
+		return
+	}
+	smallest := zsets[0]
+	for _, z := range zsets {
+		if z.Len() < smallest.Len() {
+			smallest = z
+		}
+	}
+	smallest.scores.forEach(func(member string, _ float64) bool {
+		for _, z := range zsets {
+			if _, ok := z.Score(member); !ok {
+				return true
+			}
+		}
+		return fn(member)
+	})
+}
+
+// ZDiff returns the members of the first of zsets found in none of the
+// others, with their scores in the first
+func ZDiff(zsets []*ZSet) *ZSet {
+	result := NewZSet()
+	if len(zsets) == 0 {
+		return result
+	}
+	zsets[0].scores.forEach(func(member string, score float64) bool {
+		for _, z := range zsets[1:] {
+			if _, ok := z.Score(member); ok {
+				return true
+			}
+		}
+		result.Add(member, score)
+		return true
+	})
+	return result
+}
+
+// ViewZSet calls fn with the sorted set held by key, an empty one if key is
+// missing
+func (s *Store) ViewZSet(key string, fn func(z *ZSet)) error {
+	return s.ViewZSets([]string{key}, func(zsets []*ZSet) {
+		fn(zsets[0])
+	})
+}
+
+// ViewZSets calls fn with the sorted sets held by keys, empty ones for
+// missing keys
+func (s *Store) ViewZSets(keys []string, fn func(zsets []*ZSet)) error {
+	return viewValues(s, keys, NewZSet, fn)
+}
+
+// UpdateZSet calls fn with the sorted set held by key, an empty one if key
+// is missing, and deletes the key if fn leaves the sorted set empty
+func (s *Store) UpdateZSet(key string, fn func(z *ZSet) error) error {
+	return updateValues(s, []string{key}, NewZSet, func(zsets []*ZSet) error {
+		return fn(zsets[0])
+	})
+}
+
+// StoreZSet calls fn with the sorted sets held by keys and stores the sorted
+// set it returns at dst, replacing whatever dst held, or deletes dst if the
+// sorted set is empty
+func (s *Store) StoreZSet(dst string, keys []string, fn func(zsets []*ZSet) *ZSet) error {
+	return storeValue(s, dst, keys, NewZSet, fn)
+}
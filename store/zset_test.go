@@ -0,0 +1,149 @@
+package store
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// zsetMembers returns the members of z from start to stop in order
+func zsetMembers(z *ZSet, start, stop int, reverse bool) []string {
+	var members []string
+	z.Range(start, stop, reverse, func(member string, _ float64) bool {
+		members = append(members, member)
+		return true
+	})
+	return members
+}
+
+func TestZSetOrder(t *testing.T) {
+	z := NewZSet()
+	scores := make(map[string]float64)
+	for i := 0; i < 2000; i++ {
+		member := fmt.Sprintf("m%d", rand.IntN(500))
+		switch rand.IntN(3) {
+		case 0:
+			z.Remove(member)
+			delete(scores, member)
+		default:
+			score := float64(rand.IntN(50))
+			z.Add(member, score)
+			scores[member] = score
+		}
+	}
+
+	// The skiplist order and every rank must match a sorted copy
+	want := make([]string, 0, len(scores))
+	for member := range scores {
+		want = append(want, member)
+	}
+	slices.SortFunc(want, func(a, b string) int {
+		if c := cmp.Compare(scores[a], scores[b]); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+	if got := zsetMembers(z, 0, z.Len()-1, false); !slices.Equal(got, want) {
+		t.Fatalf("Expected %d members in order, got %d", len(want), len(got))
+	}
+	for i, member := range want {
+		if rank, ok := z.Rank(member); !ok || rank != i {
+			t.Fatalf("Expected %s at rank %d, got %d", member, i, rank)
+		}
+	}
+	if got := zsetMembers(z, 10, 14, true); len(want) > 15 && !slices.Equal(got, []string{want[14], want[13], want[12], want[11], want[10]}) {
+		t.Errorf("Expected ranks 14 down to 10, got %v", got)
+	}
+}
+
+func TestZSetSpans(t *testing.T) {
+	z := NewZSet()
+	for i, member := range []string{"a", "b", "c", "d", "e"} {
+		z.Add(member, float64(i+1))
+	}
+	tests := []struct {
+		min, max    ScoreBound
+		start, stop int
+	}{
+		{ScoreBound{Score: 2}, ScoreBound{Score: 4}, 1, 3},
+		{ScoreBound{Score: 2, Exclusive: true}, ScoreBound{Score: 4, Exclusive: true}, 2, 2},
+		{ScoreBound{Score: math.Inf(-1)}, ScoreBound{Score: math.Inf(1)}, 0, 4},
+		{ScoreBound{Score: 6}, ScoreBound{Score: 9}, 5, 4},
+	}
+	for _, tt := range tests {
+		if start, stop := z.ScoreSpan(tt.min, tt.max); start != tt.start || stop != tt.stop {
+			t.Errorf("ScoreSpan(%v, %v) = %d, %d, expected %d, %d", tt.min, tt.max, start, stop, tt.start, tt.stop)
+		}
+	}
+
+	lex := NewZSet()
+	for _, member := range []string{"a", "b", "c", "d"} {
+		lex.Add(member, 0)
+	}
+	if start, stop := lex.LexSpan(LexBound{Member: "b"}, LexBound{Inf: 1}); start != 1 || stop != 3 {
+		t.Errorf("Expected [b + to span 1 to 3, got %d to %d", start, stop)
+	}
+	if start, stop := lex.LexSpan(LexBound{Inf: -1}, LexBound{Member: "c", Exclusive: true}); start != 0 || stop != 1 {
+		t.Errorf("Expected - (c to span 0 to 1, got %d to %d", start, stop)
+	}
+	if start, stop := lex.LexSpan(LexBound{Inf: 1}, LexBound{Inf: 1}); start <= stop {
+		t.Error("Expected + + to be empty")
+	}
+
+	if n := z.RemoveRange(1, 2); n != 2 || z.Len() != 3 {
+		t.Errorf("Expected 2 removed and 3 left, got %d and %d", n, z.Len())
+	}
+	if got := zsetMembers(z, 0, z.Len()-1, false); !slices.Equal(got, []string{"a", "d", "e"}) {
+		t.Errorf("Expected [a d e], got %v", got)
+	}
+}
+
+func TestZSetAlgebra(t *testing.T) {
+	a, b := NewZSet(), NewZSet()
+	a.Add("x", 1)
+	a.Add("y", 2)
+	b.Add("y", 3)
+	b.Add("z", math.Inf(1))
+
+	union := ZUnion([]*ZSet{a, b}, []float64{2, 1}, AggregateSum)
+	if score, _ := union.Score("y"); score != 7 {
+		t.Errorf("Expected y to score 2*2+3, got %v", score)
+	}
+	if score, _ := ZUnion([]*ZSet{b}, []float64{0}, AggregateSum).Score("z"); score != 0 {
+		t.Errorf("Expected an infinite score weighted 0 to be 0, got %v", score)
+	}
+	inter := ZInter([]*ZSet{a, b}, nil, AggregateMax)
+	if score, _ := inter.Score("y"); inter.Len() != 1 || score != 3 {
+		t.Errorf("Expected only y scoring 3, got %d members, %v", inter.Len(), score)
+	}
+	if diff := ZDiff([]*ZSet{a, b}); diff.Len() != 1 {
+		t.Errorf("Expected only x, got %d members", diff.Len())
+	}
+	if n := ZInterCard([]*ZSet{a, b}, 0); n != 1 {
+		t.Errorf("Expected 1, got %d", n)
+	}
+}
+
+func TestStoreZSet(t *testing.T) {
+	s := New()
+	s.UpdateZSet("z", func(z *ZSet) error {
+		z.Add("a", 1)
+		return nil
+	})
+	if typ, _ := s.Type("z"); typ != TypeZSet {
+		t.Errorf("Expected %s, got %s", TypeZSet, typ)
+	}
+	err := s.StoreZSet("dst", []string{"z", "missing"}, func(zsets []*ZSet) *ZSet {
+		return ZUnion(zsets, nil, AggregateSum)
+	})
+	if err != nil {
+		t.Fatalf("StoreZSet failed: %v", err)
+	}
+	if n, _ := s.Exists("dst"); n != 1 {
+		t.Error("Expected StoreZSet to store the union")
+	}
+}
@@ -0,0 +1,680 @@
+package redkit
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/l00pss/redkit/args"
+	"github.com/l00pss/redkit/store"
+)
+
+// registerHashes registers the hash commands of the built-in store
+func (c *storeCommands) registerHashes() {
+	s := c.server
+	s.RegisterCommandFunc(string(HSET), c.hset, VariadicArgs(3, 2), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("hash"), WithSummary("Creates or modifies the value of a field in a hash."))
+	s.RegisterCommandFunc(string(HMSET), c.hmset, VariadicArgs(3, 2), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("hash"), WithSummary("Sets the values of multiple fields."), Deprecated("HSET"))
+	s.RegisterCommandFunc(string(HSETNX), c.hsetnx, ExactArgs(3), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("hash"), WithSummary("Sets the value of a field in a hash only when the field doesn't exist."))
+	s.RegisterCommandFunc(string(HGET), c.hget, ExactArgs(2), WithKeys(1, 1, 1), WithFlags(CmdReadOnly|CmdFast), WithCategories("hash"), WithSummary("Returns the value of a field in a hash."))
+	s.RegisterCommandFunc(string(HMGET), c.hmget, MinArgs(2), WithKeys(1, 1, 1), WithFlags(CmdReadOnly|CmdFast), WithCategories("hash"), WithSummary("Returns the values of all fields in a hash."))
+	s.RegisterCommandFunc(string(HGETALL), c.hgetall, ExactArgs(1), WithKeys(1, 1, 1), WithFlags(CmdReadOnly), WithCategories("hash"), WithSummary("Returns all fields and values in a hash."))
+	s.RegisterCommandFunc(string(HKEYS), c.hkeys, ExactArgs(1), WithKeys(1, 1, 1), WithFlags(CmdReadOnly), WithCategories("hash"), WithSummary("Returns all fields in a hash."))
+	s.RegisterCommandFunc(string(HVALS), c.hvals, ExactArgs(1), WithKeys(1, 1, 1), WithFlags(CmdReadOnly), WithCategories("hash"), WithSummary("Returns all values in a hash."))
+	s.RegisterCommandFunc(string(HLEN), c.hlen, ExactArgs(1), WithKeys(1, 1, 1), WithFlags(CmdReadOnly|CmdFast), WithCategories("hash"), WithSummary("Returns the number of fields in a hash."))
+	s.RegisterCommandFunc(string(HEXISTS), c.hexists, ExactArgs(2), WithKeys(1, 1, 1), WithFlags(CmdReadOnly|CmdFast), WithCategories("hash"), WithSummary("Determines whether a field exists in a hash."))
+	s.RegisterCommandFunc(string(HSTRLEN), c.hstrlen, ExactArgs(2), WithKeys(1, 1, 1), WithFlags(CmdReadOnly|CmdFast), WithCategories("hash"), WithSummary("Returns the length of the value of a field."))
+	s.RegisterCommandFunc(string(HDEL), c.hdel, MinArgs(2), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("hash"), WithSummary("Deletes one or more fields and their values from a hash. Deletes the hash if no fields remain."))
+	s.RegisterCommandFunc(string(HINCRBY), c.hincrby, ExactArgs(3), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("hash"), WithSummary("Increments the integer value of a field in a hash by a number. Uses 0 as initial value if the field doesn't exist."))
+	s.RegisterCommandFunc(string(HINCRBYFLOAT), c.hincrbyfloat, ExactArgs(3), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("hash"), WithSummary("Increments the floating point value of a field by a number. Uses 0 as initial value if the field doesn't exist."))
+	s.RegisterCommandFunc(string(HRANDFIELD), c.hrandfield, RangeArgs(1, 3), WithKeys(1, 1, 1), WithFlags(CmdReadOnly), WithCategories("hash"), WithSummary("Returns one or more random fields from a hash."))
+	s.RegisterCommandFunc(string(HSCAN), c.hscan, MinArgs(2), WithKeys(1, 1, 1), WithFlags(CmdReadOnly), WithCategories("hash"), WithSummary("Iterates over fields and values of a hash."))
+	s.RegisterCommandFunc(string(HGETDEL), c.hgetdel, MinArgs(4), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("hash"), WithSummary("Returns the value of a field and deletes it from the hash."))
+	s.RegisterCommandFunc(string(HGETEX), c.hgetex, MinArgs(4), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("hash"), WithSummary("Get the value of one or more fields of a given hash key, and optionally set their expiration."))
+	s.RegisterCommandFunc(string(HSETEX), c.hsetex, MinArgs(5), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("hash"), WithSummary("Set the value of one or more fields of a given hash key, and optionally set their expiration."))
+
+	s.RegisterCommandFunc(string(HEXPIRE), c.hexpire(time.Second, false), MinArgs(5), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("hash"), WithSummary("Set expiry for hash field using relative time to expire (seconds)"))
+	s.RegisterCommandFunc(string(HPEXPIRE), c.hexpire(time.Millisecond, false), MinArgs(5), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("hash"), WithSummary("Set expiry for hash field using relative time to expire (milliseconds)"))
+	s.RegisterCommandFunc(string(HEXPIREAT), c.hexpire(time.Second, true), MinArgs(5), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("hash"), WithSummary("Set expiry for hash field using an absolute Unix timestamp (seconds)"))
+	s.RegisterCommandFunc(string(HPEXPIREAT), c.hexpire(time.Millisecond, true), MinArgs(5), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("hash"), WithSummary("Set expiry for hash field using an absolute Unix timestamp (milliseconds)"))
+	s.RegisterCommandFunc(string(HTTL), c.httl(time.Second, false), MinArgs(4), WithKeys(1, 1, 1), WithFlags(CmdReadOnly|CmdFast), WithCategories("hash"), WithSummary("Returns the TTL in seconds of a hash field."))
+	s.RegisterCommandFunc(string(HPTTL), c.httl(time.Millisecond, false), MinArgs(4), WithKeys(1, 1, 1), WithFlags(CmdReadOnly|CmdFast), WithCategories("hash"), WithSummary("Returns the TTL in milliseconds of a hash field."))
+	s.RegisterCommandFunc(string(HEXPIRETIME), c.httl(time.Second, true), MinArgs(4), WithKeys(1, 1, 1), WithFlags(CmdReadOnly|CmdFast), WithCategories("hash"), WithSummary("Returns the expiration time of a hash field as a Unix timestamp, in seconds."))
+	s.RegisterCommandFunc(string(HPEXPIRETIME), c.httl(time.Millisecond, true), MinArgs(4), WithKeys(1, 1, 1), WithFlags(CmdReadOnly|CmdFast), WithCategories("hash"), WithSummary("Returns the expiration time of a hash field as a Unix timestamp, in msec."))
+	s.RegisterCommandFunc(string(HPERSIST), c.hpersist, MinArgs(4), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("hash"), WithSummary("Removes the expiration time for each specified field"))
+}
+
+// bulkOf returns s as a bulk string
+func bulkOf(s string) RedisValue {
+	return RedisValue{Type: BulkString, Bulk: []byte(s)}
+}
+
+// parseFields parses FIELDS numfields field [field ...] ending the arguments,
+// with step 2 for field value pairs
+func parseFields(p *args.Parser, step int) []string {
+	if !p.MatchFlag("FIELDS") {
+		p.Fail(NewError(ErrPrefixGeneric, "Mandatory argument FIELDS is missing or not at the right position"))
+		return nil
+	}
+	n, err := strconv.ParseInt(p.NextString(), 10, 64)
+	if p.Err() == nil && (err != nil || n < 1) {
+		p.Fail(NewError(ErrPrefixGeneric, "Number of fields must be a positive integer"))
+	}
+	fields := p.Rest()
+	if p.Err() == nil && int64(len(fields)) != n*int64(step) {
+		p.Fail(NewError(ErrPrefixGeneric, "The `numfields` parameter must match the number of arguments"))
+	}
+	return fields
+}
+
+// setFields stores the field value pairs of HSET and HMSET and returns how
+// many fields are new
+func (c *storeCommands) setFields(conn *Connection, cmd *Command) (int, error) {
+	added := 0
+	err := c.db(conn).hashes.UpdateHash(cmd.Args[0], func(h *store.Hash) error {
+		for i := 1; i+1 < len(cmd.Args); i += 2 {
+			if h.Set(cmd.Args[i], []byte(cmd.Args[i+1])) {
+				added++
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		c.server.KeysWritten(conn, cmd.Args[0])
+	}
+	return added, err
+}
+
+// hset implements HSET key field value [field value ...]
+func (c *storeCommands) hset(conn *Connection, cmd *Command) RedisValue {
+	added, err := c.setFields(conn, cmd)
+	if err != nil {
+		return ErrorValue(err)
+	}
+	return RedisValue{Type: Integer, Int: int64(added)}
+}
+
+// hmset implements HMSET key field value [field value ...]
+func (c *storeCommands) hmset(conn *Connection, cmd *Command) RedisValue {
+	if _, err := c.setFields(conn, cmd); err != nil {
+		return ErrorValue(err)
+	}
+	return RedisValue{Type: SimpleString, Str: "OK"}
+}
+
+// hsetnx implements HSETNX key field value
+func (c *storeCommands) hsetnx(conn *Connection, cmd *Command) RedisValue {
+	added := false
+	err := c.db(conn).hashes.UpdateHash(cmd.Args[0], func(h *store.Hash) error {
+		if _, ok := h.Get(cmd.Args[1]); !ok {
+			added = h.Set(cmd.Args[1], []byte(cmd.Args[2]))
+		}
+		return nil
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	if !added {
+		return RedisValue{Type: Integer, Int: 0}
+	}
+	c.server.KeysWritten(conn, cmd.Args[0])
+	return RedisValue{Type: Integer, Int: 1}
+}
+
+// hget implements HGET key field
+func (c *storeCommands) hget(conn *Connection, cmd *Command) RedisValue {
+	var reply RedisValue
+	err := c.db(conn).hashes.ViewHash(cmd.Args[0], func(h *store.Hash) {
+		reply = bulkOrNull(h.Get(cmd.Args[1]))
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysRead(conn, cmd.Args[0])
+	return reply
+}
+
+// hmget implements HMGET key field [field ...]
+func (c *storeCommands) hmget(conn *Connection, cmd *Command) RedisValue {
+	fields := cmd.Args[1:]
+	reply := make([]RedisValue, len(fields))
+	err := c.db(conn).hashes.ViewHash(cmd.Args[0], func(h *store.Hash) {
+		for i, field := range fields {
+			reply[i] = bulkOrNull(h.Get(field))
+		}
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysRead(conn, cmd.Args[0])
+	return RedisValue{Type: Array, Array: reply}
+}
+
+// hgetall implements HGETALL key
+func (c *storeCommands) hgetall(conn *Connection, cmd *Command) RedisValue {
+	var entries []MapEntry
+	err := c.db(conn).hashes.ViewHash(cmd.Args[0], func(h *store.Hash) {
+		entries = make([]MapEntry, 0, h.Len())
+		h.Range(func(field string, value []byte) bool {
+			entries = append(entries, MapEntry{Key: bulkOf(field), Value: RedisValue{Type: BulkString, Bulk: value}})
+			return true
+		})
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysRead(conn, cmd.Args[0])
+	return RedisValue{Type: Map, Map: entries}
+}
+
+// hkeys implements HKEYS key
+func (c *storeCommands) hkeys(conn *Connection, cmd *Command) RedisValue {
+	var reply []RedisValue
+	err := c.db(conn).hashes.ViewHash(cmd.Args[0], func(h *store.Hash) {
+		reply = make([]RedisValue, 0, h.Len())
+		h.Range(func(field string, _ []byte) bool {
+			reply = append(reply, bulkOf(field))
+			return true
+		})
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysRead(conn, cmd.Args[0])
+	return RedisValue{Type: Array, Array: reply}
+}
+
+// hvals implements HVALS key
+func (c *storeCommands) hvals(conn *Connection, cmd *Command) RedisValue {
+	var reply []RedisValue
+	err := c.db(conn).hashes.ViewHash(cmd.Args[0], func(h *store.Hash) {
+		reply = make([]RedisValue, 0, h.Len())
+		h.Range(func(_ string, value []byte) bool {
+			reply = append(reply, RedisValue{Type: BulkString, Bulk: value})
+			return true
+		})
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysRead(conn, cmd.Args[0])
+	return RedisValue{Type: Array, Array: reply}
+}
+
+// hlen implements HLEN key
+func (c *storeCommands) hlen(conn *Connection, cmd *Command) RedisValue {
+	n := 0
+	err := c.db(conn).hashes.ViewHash(cmd.Args[0], func(h *store.Hash) {
+		n = h.Len()
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysRead(conn, cmd.Args[0])
+	return RedisValue{Type: Integer, Int: int64(n)}
+}
+
+// hexists implements HEXISTS key field
+func (c *storeCommands) hexists(conn *Connection, cmd *Command) RedisValue {
+	exists := false
+	err := c.db(conn).hashes.ViewHash(cmd.Args[0], func(h *store.Hash) {
+		_, exists = h.Get(cmd.Args[1])
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysRead(conn, cmd.Args[0])
+	if exists {
+		return RedisValue{Type: Integer, Int: 1}
+	}
+	return RedisValue{Type: Integer, Int: 0}
+}
+
+// hstrlen implements HSTRLEN key field
+func (c *storeCommands) hstrlen(conn *Connection, cmd *Command) RedisValue {
+	n := 0
+	err := c.db(conn).hashes.ViewHash(cmd.Args[0], func(h *store.Hash) {
+		value, _ := h.Get(cmd.Args[1])
+		n = len(value)
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysRead(conn, cmd.Args[0])
+	return RedisValue{Type: Integer, Int: int64(n)}
+}
+
+// hdel implements HDEL key field [field ...]
+func (c *storeCommands) hdel(conn *Connection, cmd *Command) RedisValue {
+	deleted := 0
+	err := c.db(conn).hashes.UpdateHash(cmd.Args[0], func(h *store.Hash) error {
+		for _, field := range cmd.Args[1:] {
+			if h.Delete(field) {
+				deleted++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	if deleted > 0 {
+		c.server.KeysWritten(conn, cmd.Args[0])
+	}
+	return RedisValue{Type: Integer, Int: int64(deleted)}
+}
+
+// hincrby implements HINCRBY key field increment
+func (c *storeCommands) hincrby(conn *Connection, cmd *Command) RedisValue {
+	p := args.New(cmd.Args[2:])
+	delta := p.NextInt()
+	if err := p.Err(); err != nil {
+		return ErrorValue(err)
+	}
+	var n int64
+	err := c.db(conn).hashes.UpdateHash(cmd.Args[0], func(h *store.Hash) error {
+		var err error
+		n, err = h.IncrBy(cmd.Args[1], delta)
+		return err
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysWritten(conn, cmd.Args[0])
+	return RedisValue{Type: Integer, Int: n}
+}
+
+// hincrbyfloat implements HINCRBYFLOAT key field increment
+func (c *storeCommands) hincrbyfloat(conn *Connection, cmd *Command) RedisValue {
+	p := args.New(cmd.Args[2:])
+	delta := p.NextFloat()
+	if err := p.Err(); err != nil {
+		return ErrorValue(err)
+	}
+	var f float64
+	err := c.db(conn).hashes.UpdateHash(cmd.Args[0], func(h *store.Hash) error {
+		var err error
+		f, err = h.IncrByFloat(cmd.Args[1], delta)
+		return err
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysWritten(conn, cmd.Args[0])
+	return RedisValue{Type: BulkString, Bulk: strconv.AppendFloat(nil, f, 'f', -1, 64)}
+}
+
+// hashField is a field and value picked by HRANDFIELD
+type hashField struct {
+	field string
+	value []byte
+}
+
+// hrandfield implements HRANDFIELD key [count [WITHVALUES]]
+func (c *storeCommands) hrandfield(conn *Connection, cmd *Command) RedisValue {
+	if len(cmd.Args) == 1 {
+		var field string
+		var ok bool
+		err := c.db(conn).hashes.ViewHash(cmd.Args[0], func(h *store.Hash) {
+			field, _, ok = h.Random()
+		})
+		if err != nil {
+			return ErrorValue(err)
+		}
+		return bulkOrNull([]byte(field), ok)
+	}
+
+	p := args.New(cmd.Args[1:])
+	count := p.NextInt()
+	withValues := p.More() && p.MatchFlag("WITHVALUES")
+	if err := p.Done(); err != nil {
+		return ErrorValue(err)
+	}
+	if count < -math.MaxInt64/2 || count > math.MaxInt64/2 {
+		return NewError(ErrPrefixGeneric, "value is out of range").Value()
+	}
+
+	var picks []hashField
+	err := c.db(conn).hashes.ViewHash(cmd.Args[0], func(h *store.Hash) {
+		random := func() hashField {
+			field, value, _ := h.Random()
+			return hashField{field, value}
+		}
+		all := func() []hashField {
+			fields := make([]hashField, 0, h.Len())
+			h.Range(func(field string, value []byte) bool {
+				fields = append(fields, hashField{field, value})
+				return true
+			})
+			return fields
+		}
+		picks = randomPicks(int64(h.Len()), count, random, all, func(f hashField) string { return f.field })
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+
+	reply := make([]RedisValue, 0, len(picks))
+	for _, pick := range picks {
+		switch {
+		case !withValues:
+			reply = append(reply, bulkOf(pick.field))
+		case conn != nil && conn.Protocol() >= RESP3:
+			reply = append(reply, RedisValue{Type: Array, Array: []RedisValue{bulkOf(pick.field), {Type: BulkString, Bulk: pick.value}}})
+		default:
+			reply = append(reply, bulkOf(pick.field), RedisValue{Type: BulkString, Bulk: pick.value})
+		}
+	}
+	return RedisValue{Type: Array, Array: reply}
+}
+
+// hscan implements HSCAN key cursor [MATCH pattern] [COUNT count] [NOVALUES]
+func (c *storeCommands) hscan(conn *Connection, cmd *Command) RedisValue {
+	noValues := false
+	scan, err := parseScan(cmd.Args[1:], func(p *args.Parser) bool {
+		if p.MatchFlag("NOVALUES") {
+			noValues = true
+			return true
+		}
+		return false
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+
+	var items []RedisValue
+	var next uint64
+	err = c.db(conn).hashes.ViewHash(cmd.Args[0], func(h *store.Hash) {
+		var fields []string
+		fields, next = h.Scan(scan.cursor, scan.match, scan.count)
+		for _, field := range fields {
+			items = append(items, bulkOf(field))
+			if !noValues {
+				value, _ := h.Get(field)
+				items = append(items, RedisValue{Type: BulkString, Bulk: value})
+			}
+		}
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	return scanReply(next, items)
+}
+
+// hgetdel implements HGETDEL key FIELDS numfields field [field ...]
+func (c *storeCommands) hgetdel(conn *Connection, cmd *Command) RedisValue {
+	p := args.New(cmd.Args[1:])
+	fields := parseFields(p, 1)
+	if err := p.Err(); err != nil {
+		return ErrorValue(err)
+	}
+	reply := make([]RedisValue, len(fields))
+	deleted := false
+	err := c.db(conn).hashes.UpdateHash(cmd.Args[0], func(h *store.Hash) error {
+		for i, field := range fields {
+			value, ok := h.Get(field)
+			reply[i] = bulkOrNull(value, ok)
+			deleted = h.Delete(field) || deleted
+		}
+		return nil
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	if deleted {
+		c.server.KeysWritten(conn, cmd.Args[0])
+	}
+	return RedisValue{Type: Array, Array: reply}
+}
+
+// hgetex implements HGETEX key [EX seconds | PX milliseconds |
+// EXAT unix-time-seconds | PXAT unix-time-milliseconds | PERSIST]
+// FIELDS numfields field [field ...]
+func (c *storeCommands) hgetex(conn *Connection, cmd *Command) RedisValue {
+	p := args.New(cmd.Args[1:])
+	var at time.Time
+	expire, persist := false, false
+	for p.More() && !strings.EqualFold(p.Peek(), "FIELDS") {
+		switch {
+		case matchExpiration(p, &at, &expire):
+		case p.MatchFlag("PERSIST"):
+			if expire {
+				p.Fail(args.ErrSyntax)
+			}
+			expire, persist = true, true
+		default:
+			p.Fail(args.ErrSyntax)
+		}
+	}
+	fields := parseFields(p, 1)
+	if err := p.Err(); err != nil {
+		return argsError(cmd, err)
+	}
+
+	reply := make([]RedisValue, len(fields))
+	changed := false
+	err := c.db(conn).hashes.UpdateHash(cmd.Args[0], func(h *store.Hash) error {
+		for i, field := range fields {
+			value, ok := h.Get(field)
+			reply[i] = bulkOrNull(value, ok)
+			if !ok || !expire {
+				continue
+			}
+			if current, _ := h.ExpireTime(field); persist && current.IsZero() {
+				continue
+			}
+			changed = h.Expire(field, at) || changed
+		}
+		return nil
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	if changed {
+		c.server.KeysWritten(conn, cmd.Args[0])
+	}
+	return RedisValue{Type: Array, Array: reply}
+}
+
+// hsetex implements HSETEX key [FNX | FXX] [EX seconds | PX milliseconds |
+// EXAT unix-time-seconds | PXAT unix-time-milliseconds | KEEPTTL]
+// FIELDS numfields field value [field value ...]
+func (c *storeCommands) hsetex(conn *Connection, cmd *Command) RedisValue {
+	p := args.New(cmd.Args[1:])
+	var at time.Time
+	fnx, fxx, expire, keepTTL := false, false, false, false
+	for p.More() && !strings.EqualFold(p.Peek(), "FIELDS") {
+		switch {
+		case matchExpiration(p, &at, &expire):
+		case p.MatchFlag("KEEPTTL"):
+			if expire {
+				p.Fail(args.ErrSyntax)
+			}
+			expire, keepTTL = true, true
+		case p.MatchFlag("FNX"):
+			fnx = true
+		case p.MatchFlag("FXX"):
+			fxx = true
+		default:
+			p.Fail(args.ErrSyntax)
+		}
+	}
+	pairs := parseFields(p, 2)
+	if fnx && fxx {
+		p.Fail(args.ErrSyntax)
+	}
+	if err := p.Err(); err != nil {
+		return argsError(cmd, err)
+	}
+
+	written := false
+	err := c.db(conn).hashes.UpdateHash(cmd.Args[0], func(h *store.Hash) error {
+		for i := 0; i < len(pairs); i += 2 {
+			if _, exists := h.Get(pairs[i]); (fnx && exists) || (fxx && !exists) {
+				return nil
+			}
+		}
+		for i := 0; i < len(pairs); i += 2 {
+			field := pairs[i]
+			ttl, _ := h.ExpireTime(field)
+			h.Set(field, []byte(pairs[i+1]))
+			switch {
+			case keepTTL && !ttl.IsZero():
+				h.Expire(field, ttl)
+			case !at.IsZero():
+				h.Expire(field, at)
+			}
+		}
+		written = true
+		return nil
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	if !written {
+		return RedisValue{Type: Integer, Int: 0}
+	}
+	c.server.KeysWritten(conn, cmd.Args[0])
+	return RedisValue{Type: Integer, Int: 1}
+}
+
+// Replies of the field expiration commands for each field
+const (
+	fieldMissing    = -2 // the field or key doesn't exist
+	fieldNoTTL      = -1 // HTTL and HPERSIST: the field has no expiration
+	fieldNotChanged = 0  // HEXPIRE: the NX, XX, GT or LT condition wasn't met
+	fieldChanged    = 1  // the expiration was set or removed
+	fieldDeleted    = 2  // HEXPIRE: the time has passed, so the field was deleted
+)
+
+// hexpire returns the handler of HEXPIRE and HPEXPIRE, or HEXPIREAT and
+// HPEXPIREAT if absolute, with times given in unit:
+// key time [NX | XX | GT | LT] FIELDS numfields field [field ...]
+func (c *storeCommands) hexpire(unit time.Duration, absolute bool) func(*Connection, *Command) RedisValue {
+	return func(conn *Connection, cmd *Command) RedisValue {
+		p := args.New(cmd.Args[1:])
+		n := p.NextInt()
+		if p.Err() == nil && n < 0 {
+			p.Fail(NewError(ErrPrefixGeneric, "invalid expire time, must be >= 0"))
+		}
+		if p.Err() == nil && n > math.MaxInt64/int64(unit) {
+			p.Fail(args.ErrInvalidTime)
+		}
+		condition := ""
+		if keyword := strings.ToUpper(p.Peek()); keyword == "NX" || keyword == "XX" || keyword == "GT" || keyword == "LT" {
+			condition = strings.ToUpper(p.NextString())
+		}
+		fields := parseFields(p, 1)
+		if err := p.Err(); err != nil {
+			return argsError(cmd, err)
+		}
+		at := expirationTime(n, unit, absolute)
+
+		reply := make([]RedisValue, len(fields))
+		changed := false
+		err := c.db(conn).hashes.UpdateHash(cmd.Args[0], func(h *store.Hash) error {
+			for i, field := range fields {
+				code := fieldMissing
+				if current, ok := h.ExpireTime(field); ok {
+					code = expireField(h, field, current, at, condition)
+				}
+				changed = changed || code > fieldNotChanged
+				reply[i] = RedisValue{Type: Integer, Int: int64(code)}
+			}
+			return nil
+		})
+		if err != nil {
+			return ErrorValue(err)
+		}
+		if changed {
+			c.server.KeysWritten(conn, cmd.Args[0])
+		}
+		return RedisValue{Type: Array, Array: reply}
+	}
+}
+
+// expireField sets the expiration of an existing field to at, if condition
+// allows given its current expiration, and returns the HEXPIRE reply for it
+func expireField(h *store.Hash, field string, current, at time.Time, condition string) int {
+	if !expireAllowed(condition, current, at) {
+		return fieldNotChanged
+	}
+	deleted := at.UnixMilli() <= time.Now().UnixMilli()
+	h.Expire(field, at)
+	if deleted {
+		return fieldDeleted
+	}
+	return fieldChanged
+}
+
+// httl returns the handler of HTTL and HPTTL, or HEXPIRETIME and
+// HPEXPIRETIME if absolute, replying in unit:
+// key FIELDS numfields field [field ...]
+func (c *storeCommands) httl(unit time.Duration, absolute bool) func(*Connection, *Command) RedisValue {
+	return func(conn *Connection, cmd *Command) RedisValue {
+		p := args.New(cmd.Args[1:])
+		fields := parseFields(p, 1)
+		if err := p.Err(); err != nil {
+			return ErrorValue(err)
+		}
+		reply := make([]RedisValue, len(fields))
+		err := c.db(conn).hashes.ViewHash(cmd.Args[0], func(h *store.Hash) {
+			now := time.Now()
+			for i, field := range fields {
+				at, ok := h.ExpireTime(field)
+				var n int64
+				switch {
+				case !ok:
+					n = fieldMissing
+				case at.IsZero():
+					n = fieldNoTTL
+				case absolute:
+					n = at.UnixMilli() / int64(unit/time.Millisecond)
+				default:
+					n = int64((at.Sub(now) + unit/2) / unit)
+				}
+				reply[i] = RedisValue{Type: Integer, Int: n}
+			}
+		})
+		if err != nil {
+			return ErrorValue(err)
+		}
+		c.server.KeysRead(conn, cmd.Args[0])
+		return RedisValue{Type: Array, Array: reply}
+	}
+}
+
+// hpersist implements HPERSIST key FIELDS numfields field [field ...]
+func (c *storeCommands) hpersist(conn *Connection, cmd *Command) RedisValue {
+	p := args.New(cmd.Args[1:])
+	fields := parseFields(p, 1)
+	if err := p.Err(); err != nil {
+		return ErrorValue(err)
+	}
+	reply := make([]RedisValue, len(fields))
+	changed := false
+	err := c.db(conn).hashes.UpdateHash(cmd.Args[0], func(h *store.Hash) error {
+		for i, field := range fields {
+			at, ok := h.ExpireTime(field)
+			code := fieldChanged
+			switch {
+			case !ok:
+				code = fieldMissing
+			case at.IsZero():
+				code = fieldNoTTL
+			default:
+				h.Expire(field, time.Time{})
+				changed = true
+			}
+			reply[i] = RedisValue{Type: Integer, Int: int64(code)}
+		}
+		return nil
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	if changed {
+		c.server.KeysWritten(conn, cmd.Args[0])
+	}
+	return RedisValue{Type: Array, Array: reply}
+}
@@ -0,0 +1,116 @@
+package redkit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TestBuiltinStoreHashes tests the hash commands over the wire
+func TestBuiltinStoreHashes(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	server.EnableBuiltinStore()
+	client := dialRaw(t, address)
+
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"HSET", "h", "a", "1", "b", "2"}, []string{":2"}},
+		{[]string{"HSET", "h", "a", "3"}, []string{":0"}},
+		{[]string{"HSETNX", "h", "a", "4"}, []string{":0"}},
+		{[]string{"HGET", "h", "a"}, []string{"$1", "3"}},
+		{[]string{"HMGET", "h", "a", "missing"}, []string{"*2", "$1", "3", "$-1"}},
+		{[]string{"HLEN", "h"}, []string{":2"}},
+		{[]string{"HEXISTS", "h", "b"}, []string{":1"}},
+		{[]string{"HSTRLEN", "h", "b"}, []string{":1"}},
+		{[]string{"HINCRBY", "h", "n", "5"}, []string{":5"}},
+		{[]string{"HINCRBY", "h", "a", "x"}, []string{"-ERR value is not an integer or out of range"}},
+		{[]string{"HINCRBYFLOAT", "h", "n", "0.5"}, []string{"$3", "5.5"}},
+		{[]string{"HINCRBY", "h", "n", "1"}, []string{"-ERR hash value is not an integer"}},
+		{[]string{"HDEL", "h", "n", "missing"}, []string{":1"}},
+		{[]string{"HRANDFIELD", "h", "0"}, []string{"*0"}},
+		{[]string{"HRANDFIELD", "h", "-3"}, []string{"*3", "$1"}},
+		{[]string{"HSCAN", "h", "0", "MATCH", "a", "NOVALUES"}, []string{"*2", "$1", "0", "*1", "$1", "a"}},
+		{[]string{"HGETDEL", "h", "FIELDS", "1", "b"}, []string{"*1", "$1", "2"}},
+		{[]string{"HGETDEL", "h", "FIELDS", "2", "b"}, []string{"-ERR The `numfields` parameter must match the number of arguments"}},
+		{[]string{"SET", "s", "v"}, []string{"+OK"}},
+		{[]string{"HGET", "s", "a"}, []string{"-WRONGTYPE Operation against a key holding the wrong kind of value"}},
+		{[]string{"HSET", "h", "a"}, []string{"-ERR wrong number of arguments for 'hset' command"}},
+		{[]string{"HDEL", "h", "a"}, []string{":1"}},
+		{[]string{"EXISTS", "h"}, []string{":0"}},
+	}
+	for _, tt := range tests {
+		client.send(t, tt.args...)
+		expectLines(t, client, tt.expected...)
+		// HRANDFIELD with repeats returns the same field three times
+		if tt.args[0] == "HRANDFIELD" && len(tt.expected) > 1 {
+			for i := 0; i < 5; i++ {
+				client.readLine(t)
+			}
+		}
+	}
+}
+
+// TestBuiltinStoreHashFieldTTL tests the per-field expiration commands through go-redis
+func TestBuiltinStoreHashFieldTTL(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	server.EnableBuiltinStore()
+	rdb := redis.NewClient(&redis.Options{Addr: address, Protocol: 2})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	rdb.HSet(ctx, "h", "a", "1", "b", "2", "c", "3")
+	if got, err := rdb.HExpire(ctx, "h", time.Hour, "a", "missing").Result(); err != nil || got[0] != 1 || got[1] != -2 {
+		t.Errorf("Expected [1 -2], got %v %v", got, err)
+	}
+	if got, _ := rdb.HExpireWithArgs(ctx, "h", time.Minute, redis.HExpireArgs{GT: true}, "a").Result(); got[0] != 0 {
+		t.Errorf("Expected GT with an earlier time not to change the field, got %v", got)
+	}
+	if got, _ := rdb.HExpireWithArgs(ctx, "h", time.Minute, redis.HExpireArgs{NX: true}, "b").Result(); got[0] != 1 {
+		t.Errorf("Expected NX to set the first expiration, got %v", got)
+	}
+	if got, _ := rdb.HTTL(ctx, "h", "a", "c", "missing").Result(); got[0] != 3600 || got[1] != -1 || got[2] != -2 {
+		t.Errorf("Expected [3600 -1 -2], got %v", got)
+	}
+	if got, _ := rdb.HPersist(ctx, "h", "a", "c").Result(); got[0] != 1 || got[1] != -1 {
+		t.Errorf("Expected [1 -1], got %v", got)
+	}
+	at := time.Now().Add(time.Hour).Truncate(time.Second)
+	rdb.HExpireAt(ctx, "h", at, "c")
+	if got, _ := rdb.HExpireTime(ctx, "h", "c").Result(); got[0] != at.Unix() {
+		t.Errorf("Expected %d, got %v", at.Unix(), got)
+	}
+
+	if got, _ := rdb.HPExpire(ctx, "h", 50*time.Millisecond, "b").Result(); got[0] != 1 {
+		t.Errorf("Expected 1, got %v", got)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if exists, _ := rdb.HExists(ctx, "h", "b").Result(); exists {
+		t.Error("Expected b to have expired")
+	}
+	if got, _ := rdb.HExpire(ctx, "h", 0, "c").Result(); got[0] != 2 {
+		t.Errorf("Expected a zero time to delete the field, got %v", got)
+	}
+	if all, _ := rdb.HGetAll(ctx, "h").Result(); len(all) != 1 || all["a"] != "1" {
+		t.Errorf("Expected only a left, got %v", all)
+	}
+
+	if got, err := rdb.Do(ctx, "HSETEX", "h", "FNX", "EX", "100", "FIELDS", "2", "a", "x", "d", "4").Int(); err != nil || got != 0 {
+		t.Errorf("Expected FNX to refuse an existing field, got %d %v", got, err)
+	}
+	if got, _ := rdb.Do(ctx, "HSETEX", "h", "EX", "100", "FIELDS", "1", "d", "4").Int(); got != 1 {
+		t.Errorf("Expected HSETEX to set d, got %d", got)
+	}
+	if got, _ := rdb.Do(ctx, "HGETEX", "h", "PERSIST", "FIELDS", "1", "d").StringSlice(); len(got) != 1 || got[0] != "4" {
+		t.Errorf("Expected [4], got %v", got)
+	}
+	if got, _ := rdb.HTTL(ctx, "h", "d").Result(); got[0] != -1 {
+		t.Errorf("Expected PERSIST to remove the expiration, got %v", got)
+	}
+	if err := rdb.Do(ctx, "HGETEX", "h", "EX", "0", "FIELDS", "1", "d").Err(); err == nil || err.Error() != "ERR invalid expire time in 'hgetex' command" {
+		t.Errorf("Expected an invalid expire time error, got %v", err)
+	}
+}
@@ -0,0 +1,570 @@
+package redkit
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/l00pss/redkit/args"
+	"github.com/l00pss/redkit/store"
+)
+
+// registerKeys registers the generic key commands of the built-in store
+func (c *storeCommands) registerKeys() {
+	s := c.server
+	s.RegisterCommandFunc(string(DEL), c.del, MinArgs(1), WithKeys(1, -1, 1), WithFlags(CmdWrite), WithCategories("keyspace"), WithSummary("Deletes one or more keys."))
+	s.RegisterCommandFunc(string(UNLINK), c.unlink, MinArgs(1), WithKeys(1, -1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("keyspace"), WithSummary("Asynchronously deletes one or more keys."))
+	s.RegisterCommandFunc(string(EXISTS), c.exists, MinArgs(1), WithKeys(1, -1, 1), WithFlags(CmdReadOnly|CmdFast), WithCategories("keyspace"), WithSummary("Determines whether one or more keys exist."))
+	s.RegisterCommandFunc(string(TYPE), c.typ, ExactArgs(1), WithKeys(1, 1, 1), WithFlags(CmdReadOnly|CmdFast), WithCategories("keyspace"), WithSummary("Determines the type of value stored at a key."))
+	s.RegisterCommandFunc(string(TOUCH), c.touch, MinArgs(1), WithKeys(1, -1, 1), WithFlags(CmdReadOnly|CmdFast), WithCategories("keyspace"), WithSummary("Returns the number of existing keys out of those specified after updating the time they were last accessed."))
+	s.RegisterCommandFunc(string(KEYS), c.keys, ExactArgs(1), WithFlags(CmdReadOnly), WithCategories("keyspace", "dangerous"), WithSummary("Returns all key names that match a pattern."))
+	s.RegisterCommandFunc(string(SCAN), c.scan, MinArgs(1), WithFlags(CmdReadOnly), WithCategories("keyspace"), WithSummary("Iterates over the key names in the database."))
+	s.RegisterCommandFunc(string(EXPIRE), c.expire(time.Second, false), MinArgs(2), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("keyspace"), WithSummary("Sets the expiration time of a key in seconds."))
+	s.RegisterCommandFunc(string(PEXPIRE), c.expire(time.Millisecond, false), MinArgs(2), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("keyspace"), WithSummary("Sets the expiration time of a key in milliseconds."))
+	s.RegisterCommandFunc(string(EXPIREAT), c.expire(time.Second, true), MinArgs(2), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("keyspace"), WithSummary("Sets the expiration time of a key to a Unix timestamp."))
+	s.RegisterCommandFunc(string(PEXPIREAT), c.expire(time.Millisecond, true), MinArgs(2), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("keyspace"), WithSummary("Sets the expiration time of a key to a Unix milliseconds timestamp."))
+	s.RegisterCommandFunc(string(TTL), c.ttl(time.Second, false), ExactArgs(1), WithKeys(1, 1, 1), WithFlags(CmdReadOnly|CmdFast), WithCategories("keyspace"), WithSummary("Returns the expiration time in seconds of a key."))
+	s.RegisterCommandFunc(string(PTTL), c.ttl(time.Millisecond, false), ExactArgs(1), WithKeys(1, 1, 1), WithFlags(CmdReadOnly|CmdFast), WithCategories("keyspace"), WithSummary("Returns the expiration time in milliseconds of a key."))
+	s.RegisterCommandFunc(string(EXPIRETIME), c.ttl(time.Second, true), ExactArgs(1), WithKeys(1, 1, 1), WithFlags(CmdReadOnly|CmdFast), WithCategories("keyspace"), WithSummary("Returns the expiration time of a key as a Unix timestamp."))
+	s.RegisterCommandFunc(string(PEXPIRETIME), c.ttl(time.Millisecond, true), ExactArgs(1), WithKeys(1, 1, 1), WithFlags(CmdReadOnly|CmdFast), WithCategories("keyspace"), WithSummary("Returns the expiration time of a key as a Unix milliseconds timestamp."))
+	s.RegisterCommandFunc(string(PERSIST), c.persist, ExactArgs(1), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("keyspace"), WithSummary("Removes the expiration time of a key."))
+}
+
+// del implements DEL key [key ...]
+func (c *storeCommands) del(conn *Connection, cmd *Command) RedisValue {
+	n, err := c.db(conn).store.Delete(cmd.Args...)
+	if err != nil {
+		return ErrorValue(err)
+	}
+	if n > 0 {
+		c.server.KeysWritten(conn, cmd.Args...)
+	}
+	return RedisValue{Type: Integer, Int: int64(n)}
+}
+
+// unlink implements UNLINK key [key ...], which is DEL for storage that
+// can't free values in the background
+func (c *storeCommands) unlink(conn *Connection, cmd *Command) RedisValue {
+	if c.db(conn).lazy == nil {
+		return c.del(conn, cmd)
+	}
+	n, err := c.db(conn).lazy.Unlink(cmd.Args...)
+	if err != nil {
+		return ErrorValue(err)
+	}
+	if n > 0 {
+		c.server.KeysWritten(conn, cmd.Args...)
+	}
+	return RedisValue{Type: Integer, Int: int64(n)}
+}
+
+// exists implements EXISTS key [key ...]
+func (c *storeCommands) exists(conn *Connection, cmd *Command) RedisValue {
+	n, err := c.db(conn).store.Exists(cmd.Args...)
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysRead(conn, cmd.Args...)
+	return RedisValue{Type: Integer, Int: int64(n)}
+}
+
+// typ implements TYPE key
+func (c *storeCommands) typ(conn *Connection, cmd *Command) RedisValue {
+	typ, err := c.db(conn).store.Type(cmd.Args[0])
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysRead(conn, cmd.Args[0])
+	return RedisValue{Type: SimpleString, Str: typ}
+}
+
+// touch implements TOUCH key [key ...], which is EXISTS for storage that
+// doesn't keep access times
+func (c *storeCommands) touch(conn *Connection, cmd *Command) RedisValue {
+	access := c.db(conn).access
+	if access == nil {
+		return c.exists(conn, cmd)
+	}
+	n, err := access.Touch(cmd.Args...)
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysRead(conn, cmd.Args...)
+	return RedisValue{Type: Integer, Int: int64(n)}
+}
+
+// registerRandomKey registers RANDOMKEY
+func (c *storeCommands) registerRandomKey() {
+	c.server.RegisterCommandFunc(string(RANDOMKEY), c.randomKey, ExactArgs(0), WithFlags(CmdReadOnly), WithCategories("keyspace"), WithSummary("Returns a random key name from the database."))
+}
+
+// randomKey implements RANDOMKEY
+func (c *storeCommands) randomKey(conn *Connection, cmd *Command) RedisValue {
+	key, ok, err := c.db(conn).access.RandomKey()
+	if err != nil {
+		return ErrorValue(err)
+	}
+	if !ok {
+		return RedisValue{Type: Null}
+	}
+	return RedisValue{Type: BulkString, Bulk: []byte(key)}
+}
+
+// registerKeyspace registers the commands renaming, copying and moving keys
+func (c *storeCommands) registerKeyspace() {
+	s := c.server
+	s.RegisterCommandFunc(string(RENAME), c.rename(false), ExactArgs(2), WithKeys(1, 2, 1), WithFlags(CmdWrite), WithCategories("keyspace"), WithSummary("Renames a key and overwrites the destination."))
+	s.RegisterCommandFunc(string(RENAMENX), c.rename(true), ExactArgs(2), WithKeys(1, 2, 1), WithFlags(CmdWrite|CmdFast), WithCategories("keyspace"), WithSummary("Renames a key only when the target key name doesn't exist."))
+	s.RegisterCommandFunc(string(COPY), c.copyKey, MinArgs(2), WithKeys(1, 2, 1), WithFlags(CmdWrite), WithCategories("keyspace"), WithSummary("Copies the value of a key to a new key."))
+	s.RegisterCommandFunc(string(MOVE), c.moveKey, ExactArgs(2), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("keyspace"), WithSummary("Moves a key to another database."))
+}
+
+// database returns the storage holding the keys of database db
+func (c *storeCommands) database(db int) store.KeyStorage {
+	return c.server.database(db).keyspace
+}
+
+// Errors of COPY and MOVE
+var (
+	errSameObject = NewError(ErrPrefixGeneric, "source and destination objects are the same")
+	errDBRange    = NewError(ErrPrefixGeneric, "DB index is out of range")
+)
+
+// validDB reports whether db is the index of a database
+func (c *storeCommands) validDB(db int) bool {
+	return db >= 0 && db < c.server.databases()
+}
+
+// rename implements RENAME and, if nx, RENAMENX key newkey
+func (c *storeCommands) rename(nx bool) func(*Connection, *Command) RedisValue {
+	return func(conn *Connection, cmd *Command) RedisValue {
+		src, dst := cmd.Args[0], cmd.Args[1]
+		renamed, err := c.db(conn).keyspace.Rename(src, dst, nx)
+		if err != nil {
+			return ErrorValue(err)
+		}
+		if renamed && src != dst {
+			db := connDB(conn)
+			c.server.keyEventBy(conn, db, KeyEventRenameFrom, src)
+			c.server.keyEventBy(conn, db, KeyEventRenameTo, dst)
+		}
+		if nx {
+			return boolInteger(renamed)
+		}
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	}
+}
+
+// copyKey implements COPY source destination [DB destination-db] [REPLACE]
+func (c *storeCommands) copyKey(conn *Connection, cmd *Command) RedisValue {
+	src, dst := cmd.Args[0], cmd.Args[1]
+	db := connDB(conn)
+	target, replace := db, false
+	p := args.New(cmd.Args[2:])
+	for p.More() {
+		if p.MatchFlag("REPLACE") {
+			replace = true
+		} else if !p.MatchKeyword("DB", &target) {
+			p.Fail(args.ErrSyntax)
+		}
+	}
+	if err := p.Err(); err != nil {
+		return argsError(cmd, err)
+	}
+	if !c.validDB(target) {
+		return errDBRange.Value()
+	}
+	if target == db && src == dst {
+		return errSameObject.Value()
+	}
+	copied, err := c.database(db).Copy(src, c.database(target), dst, replace)
+	if err != nil {
+		return ErrorValue(err)
+	}
+	if copied {
+		c.server.keyEventBy(conn, target, KeyEventCopyTo, dst)
+	}
+	return boolInteger(copied)
+}
+
+// moveKey implements MOVE key db
+func (c *storeCommands) moveKey(conn *Connection, cmd *Command) RedisValue {
+	key, db := cmd.Args[0], connDB(conn)
+	target, err := strconv.Atoi(cmd.Args[1])
+	if err != nil {
+		return ErrorValue(args.ErrNotInteger)
+	}
+	if !c.validDB(target) {
+		return errDBRange.Value()
+	}
+	if target == db {
+		return errSameObject.Value()
+	}
+	moved, err := c.database(db).Move(key, c.database(target))
+	if err != nil {
+		return ErrorValue(err)
+	}
+	if moved {
+		c.server.keyEventBy(conn, db, KeyEventMoveFrom, key)
+		c.server.keyEventBy(conn, target, KeyEventMoveTo, key)
+	}
+	return boolInteger(moved)
+}
+
+// registerFlush registers DBSIZE and the commands removing every key
+func (c *storeCommands) registerFlush() {
+	s := c.server
+	s.RegisterCommandFunc(string(DBSIZE), c.dbsize, ExactArgs(0), WithFlags(CmdReadOnly|CmdFast), WithCategories("keyspace"), WithSummary("Returns the number of keys in the database."))
+	s.RegisterCommandFunc(string(FLUSHDB), c.flushdb, RangeArgs(0, 1), WithFlags(CmdWrite), WithCategories("keyspace", "dangerous"), WithSummary("Removes all keys from the current database."))
+	s.RegisterCommandFunc(string(FLUSHALL), c.flushall, RangeArgs(0, 1), WithFlags(CmdWrite), WithCategories("keyspace", "dangerous"), WithSummary("Removes all keys from all databases."))
+}
+
+// dbsize implements DBSIZE
+func (c *storeCommands) dbsize(conn *Connection, cmd *Command) RedisValue {
+	return RedisValue{Type: Integer, Int: int64(c.db(conn).flush.Len())}
+}
+
+// parseFlushMode parses the ASYNC or SYNC option of FLUSHDB and FLUSHALL
+// and reports whether it is ASYNC
+func parseFlushMode(arguments []string) (bool, error) {
+	async := false
+	p := args.New(arguments)
+	if p.More() && !p.MatchFlag("SYNC") {
+		if !p.MatchFlag("ASYNC") {
+			p.Fail(args.ErrSyntax)
+		}
+		async = true
+	}
+	return async, p.Err()
+}
+
+// flushdb implements FLUSHDB [ASYNC | SYNC]
+func (c *storeCommands) flushdb(conn *Connection, cmd *Command) RedisValue {
+	async, err := parseFlushMode(cmd.Args)
+	if err != nil {
+		return ErrorValue(err)
+	}
+	if err := c.flush(c.db(conn), async); err != nil {
+		return ErrorValue(err)
+	}
+	c.server.NotifyFlush()
+	return RedisValue{Type: SimpleString, Str: "OK"}
+}
+
+// flushall implements FLUSHALL [ASYNC | SYNC]
+func (c *storeCommands) flushall(conn *Connection, cmd *Command) RedisValue {
+	async, err := parseFlushMode(cmd.Args)
+	if err != nil {
+		return ErrorValue(err)
+	}
+	var dbs []*database
+	c.server.distinctDatabases(func(index int, db *database) {
+		dbs = append(dbs, db)
+	})
+	for _, db := range dbs {
+		if err := c.flush(db, async); err != nil {
+			return ErrorValue(err)
+		}
+	}
+	c.server.NotifyFlush()
+	return RedisValue{Type: SimpleString, Str: "OK"}
+}
+
+// flush removes every key of db, aborting the transactions watching keys
+// of the databases it holds
+func (c *storeCommands) flush(db *database, async bool) error {
+	if err := db.flush.Flush(async); err != nil {
+		return err
+	}
+	s := c.server
+	for i := range s.databases() {
+		if s.database(i) == db {
+			s.TouchDB(i)
+		}
+	}
+	return nil
+}
+
+// registerObject registers the OBJECT subcommands reporting how the built-in
+// store keeps keys
+func (c *storeCommands) registerObject() {
+	s := c.server
+	s.RegisterSubcommandFunc(string(OBJECT), "ENCODING", c.object(func(info store.ObjectInfo) RedisValue {
+		return RedisValue{Type: BulkString, Bulk: []byte(info.Encoding)}
+	}), ExactArgs(1), WithFlags(CmdReadOnly), WithCategories("keyspace"), WithSummary("Returns the internal encoding of a Redis object."))
+	s.RegisterSubcommandFunc(string(OBJECT), "FREQ", c.object(func(info store.ObjectInfo) RedisValue {
+		return RedisValue{Type: Integer, Int: int64(info.Freq)}
+	}), ExactArgs(1), WithFlags(CmdReadOnly), WithCategories("keyspace"), WithSummary("Returns the logarithmic access frequency counter of a Redis object."))
+	s.RegisterSubcommandFunc(string(OBJECT), "IDLETIME", c.object(func(info store.ObjectInfo) RedisValue {
+		return RedisValue{Type: Integer, Int: int64(info.Idle / time.Second)}
+	}), ExactArgs(1), WithFlags(CmdReadOnly), WithCategories("keyspace"), WithSummary("Returns the time since the last access to a Redis object."))
+	s.RegisterSubcommandFunc(string(OBJECT), "REFCOUNT", c.object(func(info store.ObjectInfo) RedisValue {
+		return RedisValue{Type: Integer, Int: int64(info.RefCount)}
+	}), ExactArgs(1), WithFlags(CmdReadOnly), WithCategories("keyspace"), WithSummary("Returns the reference count of a value of a key."))
+}
+
+// object returns the handler of an OBJECT subcommand replying with what
+// reply takes of the ObjectInfo of its key, or null if the key is missing:
+// key
+func (c *storeCommands) object(reply func(info store.ObjectInfo) RedisValue) func(*Connection, *Command) RedisValue {
+	return func(conn *Connection, cmd *Command) RedisValue {
+		info, ok, err := c.db(conn).objects.Object(cmd.Args[0])
+		if err != nil {
+			return ErrorValue(err)
+		}
+		if !ok {
+			return RedisValue{Type: Null}
+		}
+		return reply(info)
+	}
+}
+
+// expireAllowed reports whether the NX, XX, GT or LT condition of an
+// expiration command, empty for none, allows replacing the expiration
+// current, zero for none, with at
+func expireAllowed(condition string, current, at time.Time) bool {
+	switch condition {
+	case "NX":
+		return current.IsZero()
+	case "XX":
+		return !current.IsZero()
+	case "GT":
+		// No expiration counts as infinite, which nothing is greater than
+		return !current.IsZero() && at.After(current)
+	case "LT":
+		return current.IsZero() || at.Before(current)
+	}
+	return true
+}
+
+// keyExpireTime returns the time n units from now, or n units after the unix
+// epoch if absolute, in milliseconds, and false if that overflows, as EXPIRE
+// and its variants take it
+func keyExpireTime(n int64, unit time.Duration, absolute bool) (time.Time, bool) {
+	perUnit := int64(unit / time.Millisecond)
+	if n > math.MaxInt64/perUnit || n < math.MinInt64/perUnit {
+		return time.Time{}, false
+	}
+	ms := n * perUnit
+	if !absolute {
+		now := time.Now().UnixMilli()
+		if ms > math.MaxInt64-now {
+			return time.Time{}, false
+		}
+		ms += now
+	}
+	return time.UnixMilli(ms), true
+}
+
+// parseExpireConditions parses the NX, XX, GT and LT options of EXPIRE and
+// its variants, of which NX excludes the others and GT excludes LT
+func parseExpireConditions(p *args.Parser) []string {
+	seen := make(map[string]bool)
+	var conditions []string
+	for p.More() {
+		arg := p.NextString()
+		switch option := strings.ToUpper(arg); option {
+		case "NX", "XX", "GT", "LT":
+			if !seen[option] {
+				seen[option] = true
+				conditions = append(conditions, option)
+			}
+		default:
+			p.Fail(NewError(ErrPrefixGeneric, "Unsupported option %s", arg))
+			return nil
+		}
+	}
+	switch {
+	case seen["NX"] && len(conditions) > 1:
+		p.Fail(NewError(ErrPrefixGeneric, "NX and XX, GT or LT options at the same time are not compatible"))
+	case seen["GT"] && seen["LT"]:
+		p.Fail(NewError(ErrPrefixGeneric, "GT and LT options at the same time are not compatible"))
+	}
+	return conditions
+}
+
+// expire returns the handler of EXPIRE and PEXPIRE, or EXPIREAT and
+// PEXPIREAT if absolute, taking the time in unit:
+// key time [NX | XX | GT | LT]
+func (c *storeCommands) expire(unit time.Duration, absolute bool) func(*Connection, *Command) RedisValue {
+	return func(conn *Connection, cmd *Command) RedisValue {
+		p := args.New(cmd.Args[1:])
+		n := p.NextInt()
+		conditions := parseExpireConditions(p)
+		if err := p.Err(); err != nil {
+			return ErrorValue(err)
+		}
+		at, ok := keyExpireTime(n, unit, absolute)
+		if !ok {
+			return argsError(cmd, args.ErrInvalidTime)
+		}
+
+		changed := false
+		exists, err := c.db(conn).store.UpdateExpiration(cmd.Args[0], func(current time.Time) (time.Time, bool) {
+			for _, condition := range conditions {
+				if !expireAllowed(condition, current, at) {
+					return time.Time{}, false
+				}
+			}
+			changed = true
+			return at, true
+		})
+		if err != nil {
+			return ErrorValue(err)
+		}
+		if !exists || !changed {
+			return RedisValue{Type: Integer, Int: 0}
+		}
+		c.server.KeysWritten(conn, cmd.Args[0])
+		return RedisValue{Type: Integer, Int: 1}
+	}
+}
+
+// Replies of TTL and its variants for keys without a time to reply
+const (
+	ttlMissing = -2 // the key doesn't exist
+	ttlNone    = -1 // the key doesn't expire
+)
+
+// ttl returns the handler of TTL and PTTL, or EXPIRETIME and PEXPIRETIME if
+// absolute, replying in unit: key
+func (c *storeCommands) ttl(unit time.Duration, absolute bool) func(*Connection, *Command) RedisValue {
+	return func(conn *Connection, cmd *Command) RedisValue {
+		at, exists, err := c.db(conn).store.ExpireTime(cmd.Args[0])
+		if err != nil {
+			return ErrorValue(err)
+		}
+		c.server.KeysRead(conn, cmd.Args[0])
+		perUnit := int64(unit / time.Millisecond)
+		var n int64
+		switch {
+		case !exists:
+			n = ttlMissing
+		case at.IsZero():
+			n = ttlNone
+		case absolute:
+			n = at.UnixMilli() / perUnit
+		default:
+			left := max(at.UnixMilli()-time.Now().UnixMilli(), 0)
+			n = (left + perUnit/2) / perUnit
+		}
+		return RedisValue{Type: Integer, Int: n}
+	}
+}
+
+// persist implements PERSIST key
+func (c *storeCommands) persist(conn *Connection, cmd *Command) RedisValue {
+	persisted := false
+	_, err := c.db(conn).store.UpdateExpiration(cmd.Args[0], func(current time.Time) (time.Time, bool) {
+		persisted = !current.IsZero()
+		return time.Time{}, persisted
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	if !persisted {
+		return RedisValue{Type: Integer, Int: 0}
+	}
+	c.server.KeysWritten(conn, cmd.Args[0])
+	return RedisValue{Type: Integer, Int: 1}
+}
+
+// keysBatch is the count hint KEYS scans the keyspace with
+const keysBatch = 1000
+
+// keys implements KEYS pattern
+func (c *storeCommands) keys(conn *Connection, cmd *Command) RedisValue {
+	match := cmd.Args[0]
+	if match == "*" {
+		match = ""
+	}
+	var reply []RedisValue
+	var cursor uint64
+	for {
+		keys, next, err := c.db(conn).store.Scan(cursor, match, keysBatch)
+		if err != nil {
+			return ErrorValue(err)
+		}
+		for _, key := range keys {
+			reply = append(reply, RedisValue{Type: BulkString, Bulk: []byte(key)})
+		}
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	return RedisValue{Type: Array, Array: reply}
+}
+
+// scanArgs are the arguments of SCAN and the commands scanning a key
+type scanArgs struct {
+	cursor uint64
+	match  string // empty to match everything
+	count  int
+}
+
+// parseScan parses cursor [MATCH pattern] [COUNT count] followed by the
+// options extra consumes
+func parseScan(arguments []string, extra func(p *args.Parser) bool) (scanArgs, error) {
+	var scan scanArgs
+	var err error
+	if scan.cursor, err = strconv.ParseUint(arguments[0], 10, 64); err != nil {
+		return scanArgs{}, NewError(ErrPrefixGeneric, "invalid cursor")
+	}
+	scan.count = 10
+	p := args.New(arguments[1:])
+	for p.More() {
+		switch {
+		case p.MatchKeyword("MATCH", &scan.match):
+		case p.MatchKeyword("COUNT", &scan.count):
+			if scan.count < 1 {
+				p.Fail(args.ErrSyntax)
+			}
+		case extra != nil && extra(p):
+		default:
+			p.Fail(args.ErrSyntax)
+		}
+	}
+	if scan.match == "*" {
+		scan.match = ""
+	}
+	return scan, p.Err()
+}
+
+// scanReply is the reply of SCAN and the commands scanning a key
+func scanReply(next uint64, items []RedisValue) RedisValue {
+	return RedisValue{Type: Array, Array: []RedisValue{
+		{Type: BulkString, Bulk: strconv.AppendUint(nil, next, 10)},
+		{Type: Array, Array: items},
+	}}
+}
+
+// scan implements SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+func (c *storeCommands) scan(conn *Connection, cmd *Command) RedisValue {
+	var typ string
+	scan, err := parseScan(cmd.Args, func(p *args.Parser) bool {
+		return p.MatchKeyword("TYPE", &typ)
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+
+	keys, next, err := c.db(conn).store.Scan(scan.cursor, scan.match, scan.count)
+	if err != nil {
+		return ErrorValue(err)
+	}
+	reply := make([]RedisValue, 0, len(keys))
+	for _, key := range keys {
+		if typ != "" {
+			keyType, err := c.db(conn).store.Type(key)
+			if err != nil {
+				return ErrorValue(err)
+			}
+			if !strings.EqualFold(keyType, typ) {
+				continue
+			}
+		}
+		reply = append(reply, RedisValue{Type: BulkString, Bulk: []byte(key)})
+	}
+	return scanReply(next, reply)
+}
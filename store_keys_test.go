@@ -0,0 +1,591 @@
+package redkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/l00pss/redkit/store"
+	"github.com/redis/go-redis/v9"
+)
+
+// TestBuiltinStoreScan tests KEYS and a full SCAN iteration with its options
+func TestBuiltinStoreScan(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	keys := server.EnableBuiltinStore()
+	for i := 0; i < 50; i++ {
+		keys.Set(fmt.Sprintf("user:%d", i), []byte("v"), store.SetOptions{})
+	}
+	keys.Set("other", []byte("v"), store.SetOptions{})
+	client := dialRaw(t, address)
+
+	client.send(t, "KEYS", "user:1*")
+	expectLines(t, client, "*11")
+	for i := 0; i < 22; i++ {
+		client.readLine(t)
+	}
+
+	seen := make(map[string]bool)
+	cursor := "0"
+	for {
+		client.send(t, "SCAN", cursor, "MATCH", "user:*", "COUNT", "7", "TYPE", "string")
+		expectLines(t, client, "*2")
+		client.readLine(t)
+		cursor = client.readLine(t)
+		n, _ := strconv.Atoi(client.readLine(t)[1:])
+		for i := 0; i < n; i++ {
+			client.readLine(t)
+			seen[client.readLine(t)] = true
+		}
+		if cursor == "0" {
+			break
+		}
+	}
+	if len(seen) != 50 || seen["other"] {
+		t.Errorf("Expected the 50 user keys, got %d", len(seen))
+	}
+
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"SCAN", "x"}, "-ERR invalid cursor"},
+		{[]string{"SCAN", "0", "COUNT", "0"}, "-ERR syntax error"},
+		{[]string{"SCAN", "0", "LIMIT", "1"}, "-ERR syntax error"},
+		{[]string{"DEL", "user:1", "user:2", "missing"}, ":2"},
+		{[]string{"EXISTS", "user:1", "user:3"}, ":1"},
+	}
+	for _, tt := range tests {
+		client.send(t, tt.args...)
+		expectLines(t, client, tt.expected)
+	}
+}
+
+// recordingStorage is a Storage that records the keys written through it
+type recordingStorage struct {
+	store.Storage
+	written []string
+	fail    error
+}
+
+func (r *recordingStorage) Set(key string, value []byte, opts store.SetOptions) (store.SetResult, error) {
+	if r.fail != nil {
+		return store.SetResult{}, r.fail
+	}
+	r.written = append(r.written, key)
+	return r.Storage.Set(key, value, opts)
+}
+
+// TestEnableStorage tests that the commands run against a custom Storage
+func TestEnableStorage(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	storage := &recordingStorage{Storage: store.New()}
+	server.EnableStorage(storage)
+	if server.Storage() != storage {
+		t.Fatal("Expected Storage to return the enabled storage")
+	}
+	client := dialRaw(t, address)
+
+	client.send(t, "SET", "b", "1")
+	expectLines(t, client, "+OK")
+	client.send(t, "SET", "a", "2")
+	expectLines(t, client, "+OK")
+	client.send(t, "GET", "a")
+	expectLines(t, client, "$1", "2")
+
+	sort.Strings(storage.written)
+	if fmt.Sprint(storage.written) != "[a b]" {
+		t.Errorf("Expected writes to a and b, got %v", storage.written)
+	}
+
+	storage.fail = errors.New("backend unavailable")
+	client.send(t, "SET", "a", "3")
+	expectLines(t, client, "-ERR backend unavailable")
+
+	// Switching to the built-in store replaces the custom storage
+	builtin := server.EnableBuiltinStore()
+	client.send(t, "GET", "a")
+	expectLines(t, client, "$-1")
+	if server.Storage() != builtin || server.EnableBuiltinStore() != builtin {
+		t.Error("Expected the built-in store to replace the custom storage")
+	}
+}
+
+// TestBuiltinStoreExpire tests the commands setting and reading the
+// expiration of keys
+func TestBuiltinStoreExpire(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	server.EnableBuiltinStore()
+	client := dialRaw(t, address)
+
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"SET", "k", "v"}, []string{"+OK"}},
+		{[]string{"TTL", "k"}, []string{":-1"}},
+		{[]string{"TTL", "missing"}, []string{":-2"}},
+		{[]string{"PEXPIRETIME", "missing"}, []string{":-2"}},
+		{[]string{"EXPIRE", "missing", "10"}, []string{":0"}},
+		{[]string{"EXPIRE", "k", "100", "XX"}, []string{":0"}},
+		{[]string{"EXPIRE", "k", "100", "GT"}, []string{":0"}},
+		{[]string{"EXPIRE", "k", "100", "NX"}, []string{":1"}},
+		{[]string{"TTL", "k"}, []string{":100"}},
+		{[]string{"EXPIRE", "k", "50", "NX"}, []string{":0"}},
+		{[]string{"EXPIRE", "k", "50", "GT"}, []string{":0"}},
+		{[]string{"EXPIRE", "k", "200", "XX", "GT"}, []string{":1"}},
+		{[]string{"EXPIRE", "k", "300", "LT"}, []string{":0"}},
+		{[]string{"TTL", "k"}, []string{":200"}},
+		{[]string{"PEXPIREAT", "k", "32503680000123"}, []string{":1"}},
+		{[]string{"PEXPIRETIME", "k"}, []string{":32503680000123"}},
+		{[]string{"EXPIRETIME", "k"}, []string{":32503680000"}},
+		{[]string{"EXPIREAT", "k", "32503680001", "LT"}, []string{":0"}},
+		{[]string{"PERSIST", "k"}, []string{":1"}},
+		{[]string{"PERSIST", "k"}, []string{":0"}},
+		{[]string{"EXPIRE", "k", "10", "LT"}, []string{":1"}},
+		{[]string{"EXPIRE", "k", "10", "NX", "XX"}, []string{"-ERR NX and XX, GT or LT options at the same time are not compatible"}},
+		{[]string{"EXPIRE", "k", "10", "GT", "LT"}, []string{"-ERR GT and LT options at the same time are not compatible"}},
+		{[]string{"EXPIRE", "k", "10", "ch"}, []string{"-ERR Unsupported option ch"}},
+		{[]string{"EXPIRE", "k", "x"}, []string{"-ERR value is not an integer or out of range"}},
+		{[]string{"EXPIRE", "k", "9223372036854775807"}, []string{"-ERR invalid expire time in 'expire' command"}},
+		{[]string{"PEXPIRE", "k", "9223372036854775807"}, []string{"-ERR invalid expire time in 'pexpire' command"}},
+		{[]string{"EXPIRE", "k", "-1"}, []string{":1"}},
+		{[]string{"EXISTS", "k"}, []string{":0"}},
+		{[]string{"SETEX", "s", "100", "v"}, []string{"+OK"}},
+		{[]string{"TTL", "s"}, []string{":100"}},
+		{[]string{"SETEX", "s", "0", "v"}, []string{"-ERR invalid expire time in 'setex' command"}},
+		{[]string{"PSETEX", "s", "x", "v"}, []string{"-ERR value is not an integer or out of range"}},
+		{[]string{"GETEX", "s", "PERSIST"}, []string{"$1", "v"}},
+		{[]string{"TTL", "s"}, []string{":-1"}},
+		{[]string{"GETEX", "s", "EX", "30"}, []string{"$1", "v"}},
+		{[]string{"TTL", "s"}, []string{":30"}},
+		{[]string{"GETEX", "s"}, []string{"$1", "v"}},
+		{[]string{"TTL", "s"}, []string{":30"}},
+		{[]string{"GETEX", "s", "EX", "10", "PERSIST"}, []string{"-ERR syntax error"}},
+		{[]string{"GETEX", "s", "PX", "0"}, []string{"-ERR invalid expire time in 'getex' command"}},
+		{[]string{"GETEX", "missing", "EX", "10"}, []string{"$-1"}},
+		{[]string{"GETDEL", "s"}, []string{"$1", "v"}},
+		{[]string{"GETDEL", "s"}, []string{"$-1"}},
+		{[]string{"HSET", "h", "f", "v"}, []string{":1"}},
+		{[]string{"GETDEL", "h"}, []string{"-WRONGTYPE Operation against a key holding the wrong kind of value"}},
+		{[]string{"GETEX", "h", "PERSIST"}, []string{"-WRONGTYPE Operation against a key holding the wrong kind of value"}},
+		{[]string{"PEXPIRE", "h", "100000"}, []string{":1"}},
+	}
+	for _, tt := range tests {
+		client.send(t, tt.args...)
+		expectLines(t, client, tt.expected...)
+	}
+
+	client.send(t, "PTTL", "h")
+	if ms, err := strconv.Atoi(client.readLine(t)[1:]); err != nil || ms <= 99000 || ms > 100000 {
+		t.Errorf("Expected a PTTL just under 100000, got %d %v", ms, err)
+	}
+}
+
+// TestBuiltinStoreObject tests the OBJECT subcommands
+func TestBuiltinStoreObject(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	server.EnableBuiltinStore()
+	client := dialRaw(t, address)
+
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"SET", "n", "42"}, []string{"+OK"}},
+		{[]string{"SET", "s", "hello"}, []string{"+OK"}},
+		{[]string{"SADD", "set", "1", "2"}, []string{":2"}},
+		{[]string{"OBJECT", "ENCODING", "n"}, []string{"$3", "int"}},
+		{[]string{"OBJECT", "encoding", "s"}, []string{"$6", "embstr"}},
+		{[]string{"OBJECT", "ENCODING", "set"}, []string{"$6", "intset"}},
+		{[]string{"OBJECT", "ENCODING", "missing"}, []string{"$-1"}},
+		{[]string{"OBJECT", "REFCOUNT", "n"}, []string{":1"}},
+		{[]string{"OBJECT", "IDLETIME", "n"}, []string{":0"}},
+		{[]string{"OBJECT", "FREQ", "missing"}, []string{"$-1"}},
+		{[]string{"OBJECT", "ENCODING"}, []string{"-ERR wrong number of arguments for 'object|encoding' command"}},
+		{[]string{"OBJECT", "SIZE", "n"}, []string{"-ERR unknown subcommand 'SIZE'. Try OBJECT HELP."}},
+	}
+	for _, tt := range tests {
+		client.send(t, tt.args...)
+		expectLines(t, client, tt.expected...)
+	}
+
+	client.send(t, "OBJECT", "FREQ", "n")
+	if freq, err := strconv.Atoi(client.readLine(t)[1:]); err != nil || freq < 5 {
+		t.Errorf("Expected a frequency counter of at least 5, got %d %v", freq, err)
+	}
+}
+
+func TestBuiltinStoreMemory(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	server.EnableBuiltinStore()
+	rdb := redis.NewClient(&redis.Options{Addr: address, Protocol: 2})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	rdb.Set(ctx, "big", strings.Repeat("x", 4096), 0)
+	usage, err := rdb.MemoryUsage(ctx, "big").Result()
+	if err != nil || usage < 4096 {
+		t.Errorf("Expected big to take more than its value, got %d, %v", usage, err)
+	}
+	if usage, err := rdb.MemoryUsage(ctx, "big", 0).Result(); err != nil || usage < 4096 {
+		t.Errorf("Expected MEMORY USAGE with all samples to work, got %d, %v", usage, err)
+	}
+	if err := rdb.MemoryUsage(ctx, "missing").Err(); err != redis.Nil {
+		t.Errorf("Expected nil for a missing key, got %v", err)
+	}
+	if err := rdb.Do(ctx, "MEMORY", "USAGE", "big", "SAMPLES", "-1").Err(); err == nil || err.Error() != "ERR syntax error" {
+		t.Errorf("Expected a syntax error for negative samples, got %v", err)
+	}
+	if err := rdb.Do(ctx, "MEMORY", "USAGE", "big", "COUNT", "1").Err(); err == nil || err.Error() != "ERR syntax error" {
+		t.Errorf("Expected a syntax error for an unknown option, got %v", err)
+	}
+
+	stats, err := rdb.Do(ctx, "MEMORY", "STATS").Slice()
+	if err != nil || len(stats)%2 != 0 {
+		t.Fatalf("MEMORY STATS failed: %v, %v", stats, err)
+	}
+	fields := make(map[string]any)
+	for i := 0; i < len(stats); i += 2 {
+		fields[stats[i].(string)] = stats[i+1]
+	}
+	if fields["keys.count"] != int64(1) {
+		t.Errorf("Expected 1 key, got %v", fields["keys.count"])
+	}
+	if dataset, ok := fields["dataset.bytes"].(int64); !ok || dataset < 4096 {
+		t.Errorf("Expected the dataset to hold big, got %v", fields["dataset.bytes"])
+	}
+	if _, ok := fields["fragmentation"].(string); !ok {
+		t.Errorf("Expected the fragmentation as a double, got %v", fields["fragmentation"])
+	}
+
+	info, err := rdb.Info(ctx, "memory").Result()
+	if err != nil {
+		t.Fatalf("INFO memory failed: %v", err)
+	}
+	if dataset := parseInfo(t, info)["Memory"]["used_memory_dataset"]; dataset != strconv.FormatInt(fields["dataset.bytes"].(int64), 10) {
+		t.Errorf("Expected INFO to report the dataset of MEMORY STATS, got %s", dataset)
+	}
+
+	doctor, err := rdb.Do(ctx, "MEMORY", "DOCTOR").Text()
+	if err != nil || doctor == "" {
+		t.Errorf("Expected a MEMORY DOCTOR report, got %q, %v", doctor, err)
+	}
+}
+
+func TestBuiltinStoreKeyStats(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	server.EnableBuiltinStore()
+	rdb := redis.NewClient(&redis.Options{Addr: address, Protocol: 2})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	rdb.Set(ctx, "small", "v", 0)
+	rdb.Set(ctx, "big", strings.Repeat("x", 4096), 0)
+	rdb.RPush(ctx, "list", "a", "b", "c")
+	pipe := rdb.Pipeline()
+	for range 5000 {
+		pipe.Get(ctx, "small")
+	}
+	pipe.Exec(ctx)
+
+	// keyStats returns the keys of a DEBUG BIGKEYS or HOTKEYS reply, each
+	// with the fields of its map
+	keyStats := func(args ...any) []map[string]any {
+		t.Helper()
+		reply, err := rdb.Do(ctx, args...).Slice()
+		if err != nil {
+			t.Fatalf("%v failed: %v", args, err)
+		}
+		keys := make([]map[string]any, len(reply))
+		for i, k := range reply {
+			pairs := k.([]any)
+			keys[i] = make(map[string]any)
+			for j := 0; j < len(pairs); j += 2 {
+				keys[i][pairs[j].(string)] = pairs[j+1]
+			}
+		}
+		return keys
+	}
+
+	big := keyStats("DEBUG", "BIGKEYS")
+	if len(big) != 3 || big[0]["key"] != "big" || big[0]["type"] != "string" {
+		t.Fatalf("Expected big to come first of 3 keys, got %v", big)
+	}
+	if bytes, ok := big[0]["bytes"].(int64); !ok || bytes < 4096 {
+		t.Errorf("Expected big to take more than its value, got %v", big[0]["bytes"])
+	}
+	if big := keyStats("DEBUG", "BIGKEYS", "COUNT", "1"); len(big) != 1 {
+		t.Errorf("Expected COUNT to limit the keys, got %v", big)
+	}
+	for _, k := range big {
+		if k["key"] == "list" && k["elements"] != int64(3) {
+			t.Errorf("Expected the list to have 3 elements, got %v", k["elements"])
+		}
+	}
+
+	hot := keyStats("DEBUG", "HOTKEYS", "COUNT", "2")
+	if len(hot) != 2 || hot[0]["key"] != "small" {
+		t.Errorf("Expected small to be the hottest key, got %v", hot)
+	}
+
+	if err := rdb.Do(ctx, "DEBUG", "BIGKEYS", "COUNT", "0").Err(); err == nil || err.Error() != "ERR syntax error" {
+		t.Errorf("Expected a syntax error for a zero count, got %v", err)
+	}
+	if err := rdb.Do(ctx, "DEBUG", "HOTKEYS", "SAMPLES", "1").Err(); err == nil || err.Error() != "ERR syntax error" {
+		t.Errorf("Expected a syntax error for an unknown option, got %v", err)
+	}
+	rdb.Do(ctx, "SELECT", "1")
+	if keys := keyStats("DEBUG", "BIGKEYS"); len(keys) != 0 {
+		t.Errorf("Expected no keys in another database, got %v", keys)
+	}
+}
+
+func TestBuiltinStoreUnlink(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	keys := server.EnableBuiltinStore()
+	client := dialRaw(t, address)
+
+	members := make([]string, 1000)
+	for i := range members {
+		members[i] = strconv.Itoa(i)
+	}
+	client.send(t, append([]string{"SADD", "big"}, members...)...)
+	expectLines(t, client, ":1000")
+
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"SET", "small", "v"}, []string{"+OK"}},
+		{[]string{"UNLINK", "big", "small", "missing"}, []string{":2"}},
+		{[]string{"EXISTS", "big", "small"}, []string{":0"}},
+		{[]string{"UNLINK", "big"}, []string{":0"}},
+		{[]string{"UNLINK"}, []string{"-ERR wrong number of arguments for 'unlink' command"}},
+	}
+	for _, tt := range tests {
+		client.send(t, tt.args...)
+		expectLines(t, client, tt.expected...)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for keys.LazyFreeStats().Freed == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if stats := keys.LazyFreeStats(); stats.Freed != 1 {
+		t.Errorf("Expected big to be freed in the background, got %+v", stats)
+	}
+}
+
+func TestBuiltinStoreRenameCopyMove(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	server.EnableBuiltinStore()
+	client := dialRaw(t, address)
+
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"SET", "a", "1", "EX", "100"}, []string{"+OK"}},
+		{[]string{"RENAME", "a", "b"}, []string{"+OK"}},
+		{[]string{"EXISTS", "a"}, []string{":0"}},
+		{[]string{"TTL", "b"}, []string{":100"}},
+		{[]string{"RENAME", "a", "b"}, []string{"-ERR no such key"}},
+		{[]string{"SET", "c", "3"}, []string{"+OK"}},
+		{[]string{"RENAMENX", "b", "c"}, []string{":0"}},
+		{[]string{"RENAMENX", "b", "d"}, []string{":1"}},
+		{[]string{"RENAME", "d", "d"}, []string{"+OK"}},
+		{[]string{"COPY", "d", "c"}, []string{":0"}},
+		{[]string{"COPY", "d", "c", "REPLACE"}, []string{":1"}},
+		{[]string{"TTL", "c"}, []string{":100"}},
+		{[]string{"COPY", "d", "e", "DB", "0"}, []string{":1"}},
+		{[]string{"COPY", "d", "d"}, []string{"-ERR source and destination objects are the same"}},
+		{[]string{"COPY", "d", "f", "DB", "16"}, []string{"-ERR DB index is out of range"}},
+		{[]string{"COPY", "d", "f", "DB", "x"}, []string{"-ERR value is not an integer or out of range"}},
+		{[]string{"COPY", "d", "f", "NOW"}, []string{"-ERR syntax error"}},
+		{[]string{"COPY", "missing", "f"}, []string{":0"}},
+		{[]string{"MOVE", "d", "0"}, []string{"-ERR source and destination objects are the same"}},
+		{[]string{"MOVE", "d", "16"}, []string{"-ERR DB index is out of range"}},
+		{[]string{"MOVE", "missing", "1"}, []string{":0"}},
+	}
+	for _, tt := range tests {
+		client.send(t, tt.args...)
+		expectLines(t, client, tt.expected...)
+	}
+
+	// Renaming a list onto a key a client is blocked on hands it the elements
+	blocked := dialRaw(t, address)
+	blocked.send(t, "BLPOP", "queue", "5")
+	waitForState(t, server, StateBlocked, 1)
+	client.send(t, "RPUSH", "incoming", "job")
+	expectLines(t, client, ":1")
+	client.send(t, "RENAME", "incoming", "queue")
+	expectLines(t, client, "+OK")
+	expectLines(t, blocked, "*2", "$5", "queue", "$3", "job")
+}
+
+func TestBuiltinStoreDatabases(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	server.EnableBuiltinStore()
+	client := dialRaw(t, address)
+
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"SET", "a", "0"}, []string{"+OK"}},
+		{[]string{"SELECT", "1"}, []string{"+OK"}},
+		{[]string{"GET", "a"}, []string{"$-1"}},
+		{[]string{"SET", "a", "1", "EX", "100"}, []string{"+OK"}},
+		{[]string{"SET", "b", "1"}, []string{"+OK"}},
+		{[]string{"DBSIZE"}, []string{":2"}},
+		{[]string{"MOVE", "b", "0"}, []string{":1"}},
+		{[]string{"MOVE", "a", "0"}, []string{":0"}},
+		{[]string{"COPY", "a", "c", "DB", "2"}, []string{":1"}},
+		{[]string{"DBSIZE"}, []string{":1"}},
+		{[]string{"SELECT", "0"}, []string{"+OK"}},
+		{[]string{"GET", "b"}, []string{"$1", "1"}},
+		{[]string{"DBSIZE"}, []string{":2"}},
+		{[]string{"SWAPDB", "0", "1"}, []string{"+OK"}},
+		{[]string{"GET", "a"}, []string{"$1", "1"}},
+		{[]string{"TTL", "a"}, []string{":100"}},
+		{[]string{"DBSIZE"}, []string{":1"}},
+		{[]string{"FLUSHDB", "NOW"}, []string{"-ERR syntax error"}},
+		{[]string{"FLUSHDB"}, []string{"+OK"}},
+		{[]string{"DBSIZE"}, []string{":0"}},
+		{[]string{"SELECT", "1"}, []string{"+OK"}},
+		{[]string{"DBSIZE"}, []string{":2"}},
+	}
+	for _, tt := range tests {
+		client.send(t, tt.args...)
+		expectLines(t, client, tt.expected...)
+	}
+
+	rdb := redis.NewClient(&redis.Options{Addr: address, Protocol: 2})
+	defer rdb.Close()
+	ctx := context.Background()
+	info, err := rdb.Info(ctx, "keyspace").Result()
+	if err != nil {
+		t.Fatalf("INFO keyspace failed: %v", err)
+	}
+	keyspace := parseInfo(t, info)["Keyspace"]
+	expected := map[string]string{"db1": "keys=2,expires=0", "db2": "keys=1,expires=1"}
+	if len(keyspace) != len(expected) {
+		t.Errorf("Expected %v, got %q", expected, info)
+	}
+	for db, keys := range expected {
+		if keyspace[db] != keys {
+			t.Errorf("Expected %s:%s, got %q", db, keys, keyspace[db])
+		}
+	}
+
+	// Swapping in a database holding the key a client is blocked on serves it
+	blocked := dialRaw(t, address)
+	blocked.send(t, "BLPOP", "queue", "5")
+	waitForState(t, server, StateBlocked, 1)
+	client.send(t, "RPUSH", "queue", "job")
+	expectLines(t, client, ":1")
+	client.send(t, "SWAPDB", "1", "0")
+	expectLines(t, client, "+OK")
+	expectLines(t, blocked, "*2", "$5", "queue", "$3", "job")
+
+	client.send(t, "FLUSHALL", "ASYNC")
+	expectLines(t, client, "+OK")
+	for db := range 3 {
+		if n := server.Database(db).(store.FlushStorage).Len(); n != 0 {
+			t.Errorf("Expected database %d to be empty, got %d keys", db, n)
+		}
+	}
+}
+
+func TestBuiltinStoreRandomKeyTouchType(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	server.EnableBuiltinStore()
+	client := dialRaw(t, address)
+
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"RANDOMKEY"}, []string{"$-1"}},
+		{[]string{"SET", "s", "v"}, []string{"+OK"}},
+		{[]string{"RANDOMKEY"}, []string{"$1", "s"}},
+		{[]string{"HSET", "h", "f", "v"}, []string{":1"}},
+		{[]string{"RPUSH", "l", "a"}, []string{":1"}},
+		{[]string{"SADD", "set", "a"}, []string{":1"}},
+		{[]string{"ZADD", "z", "1", "a"}, []string{":1"}},
+		{[]string{"XADD", "x", "1-1", "f", "v"}, []string{"$3", "1-1"}},
+		{[]string{"TYPE", "s"}, []string{"+string"}},
+		{[]string{"TYPE", "h"}, []string{"+hash"}},
+		{[]string{"TYPE", "l"}, []string{"+list"}},
+		{[]string{"TYPE", "set"}, []string{"+set"}},
+		{[]string{"TYPE", "z"}, []string{"+zset"}},
+		{[]string{"TYPE", "x"}, []string{"+stream"}},
+		{[]string{"TYPE", "missing"}, []string{"+none"}},
+		{[]string{"TOUCH", "s", "h", "missing", "s"}, []string{":3"}},
+	}
+	for _, tt := range tests {
+		client.send(t, tt.args...)
+		expectLines(t, client, tt.expected...)
+	}
+
+	keys := server.EnableBuiltinStore()
+	keys.Set("idle", []byte("v"), store.SetOptions{})
+	time.Sleep(1100 * time.Millisecond)
+	client.send(t, "TOUCH", "idle")
+	expectLines(t, client, ":1")
+	client.send(t, "OBJECT", "IDLETIME", "idle")
+	expectLines(t, client, ":0")
+}
+
+// TestBuiltinStoreWrongType tests that the commands of every type reply
+// WRONGTYPE given a key of any other type
+func TestBuiltinStoreWrongType(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	server.EnableBuiltinStore()
+	client := dialRaw(t, address)
+
+	keys := map[string][]string{
+		"string": {"APPEND", "string", "v"},
+		"hash":   {"HSET", "hash", "f", "v"},
+		"list":   {"RPUSH", "list", "a"},
+		"set":    {"SADD", "set", "a"},
+		"zset":   {"ZADD", "zset", "1", "a"},
+		"stream": {"XADD", "stream", "1-1", "f", "v"},
+	}
+	for typ, args := range keys {
+		client.send(t, args...)
+		if typ == "stream" {
+			expectLines(t, client, "$3", "1-1")
+		} else {
+			expectLines(t, client, ":1")
+		}
+	}
+	commands := map[string][][]string{
+		"string": {{"GET"}, {"APPEND", "x"}, {"INCR"}, {"STRLEN"}, {"SETRANGE", "0", "x"}, {"GETRANGE", "0", "1"}},
+		"hash":   {{"HGET", "f"}, {"HSET", "f", "v"}, {"HLEN"}, {"HGETALL"}},
+		"list":   {{"LPUSH", "a"}, {"LRANGE", "0", "-1"}, {"LLEN"}, {"LPOP"}},
+		"set":    {{"SADD", "a"}, {"SMEMBERS"}, {"SCARD"}, {"SISMEMBER", "a"}},
+		"zset":   {{"ZADD", "1", "a"}, {"ZRANGE", "0", "-1"}, {"ZCARD"}, {"ZSCORE", "a"}},
+		"stream": {{"XADD", "*", "f", "v"}, {"XLEN"}, {"XRANGE", "-", "+"}},
+	}
+	for typ, cmds := range commands {
+		for key := range keys {
+			if key == typ {
+				continue
+			}
+			for _, cmd := range cmds {
+				args := append([]string{cmd[0], key}, cmd[1:]...)
+				client.send(t, args...)
+				if line := client.readLine(t); line != "-WRONGTYPE Operation against a key holding the wrong kind of value" {
+					t.Fatalf("Expected WRONGTYPE from %v, got %q", args, line)
+				}
+			}
+		}
+	}
+}
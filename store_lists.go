@@ -0,0 +1,556 @@
+package redkit
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/l00pss/redkit/args"
+	"github.com/l00pss/redkit/store"
+)
+
+// registerLists registers the list commands of the built-in store
+func (c *storeCommands) registerLists() {
+	s := c.server
+	s.RegisterCommandFunc(string(LPUSH), c.push(true, false), MinArgs(2), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("list"), WithSummary("Prepends one or more elements to a list. Creates the key if it doesn't exist."))
+	s.RegisterCommandFunc(string(RPUSH), c.push(false, false), MinArgs(2), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("list"), WithSummary("Appends one or more elements to a list. Creates the key if it doesn't exist."))
+	s.RegisterCommandFunc(string(LPUSHX), c.push(true, true), MinArgs(2), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("list"), WithSummary("Prepends one or more elements to a list only when the list exists."))
+	s.RegisterCommandFunc(string(RPUSHX), c.push(false, true), MinArgs(2), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("list"), WithSummary("Appends an element to a list only when the list exists."))
+	s.RegisterCommandFunc(string(LPOP), c.pop(true), RangeArgs(1, 2), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("list"), WithSummary("Returns the first elements in a list after removing it. Deletes the list if the last element was popped."))
+	s.RegisterCommandFunc(string(RPOP), c.pop(false), RangeArgs(1, 2), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("list"), WithSummary("Returns and removes the last elements of the list. Deletes the list if the last element was popped."))
+	s.RegisterCommandFunc(string(LLEN), c.llen, ExactArgs(1), WithKeys(1, 1, 1), WithFlags(CmdReadOnly|CmdFast), WithCategories("list"), WithSummary("Returns the length of a list."))
+	s.RegisterCommandFunc(string(LRANGE), c.lrange, ExactArgs(3), WithKeys(1, 1, 1), WithFlags(CmdReadOnly), WithCategories("list"), WithSummary("Returns a range of elements from a list."))
+	s.RegisterCommandFunc(string(LINDEX), c.lindex, ExactArgs(2), WithKeys(1, 1, 1), WithFlags(CmdReadOnly), WithCategories("list"), WithSummary("Returns an element from a list by its index."))
+	s.RegisterCommandFunc(string(LINSERT), c.linsert, ExactArgs(4), WithKeys(1, 1, 1), WithFlags(CmdWrite), WithCategories("list"), WithSummary("Inserts an element before or after another element in a list."))
+	s.RegisterCommandFunc(string(LREM), c.lrem, ExactArgs(3), WithKeys(1, 1, 1), WithFlags(CmdWrite), WithCategories("list"), WithSummary("Removes elements from a list. Deletes the list if the last element was removed."))
+	s.RegisterCommandFunc(string(LSET), c.lset, ExactArgs(3), WithKeys(1, 1, 1), WithFlags(CmdWrite), WithCategories("list"), WithSummary("Sets the value of an element in a list by its index."))
+	s.RegisterCommandFunc(string(LTRIM), c.ltrim, ExactArgs(3), WithKeys(1, 1, 1), WithFlags(CmdWrite), WithCategories("list"), WithSummary("Removes elements from both ends a list. Deletes the list if all elements were trimmed."))
+	s.RegisterCommandFunc(string(LPOS), c.lpos, MinArgs(2), WithKeys(1, 1, 1), WithFlags(CmdReadOnly), WithCategories("list"), WithSummary("Returns the index of matching elements in a list."))
+	s.RegisterCommandFunc(string(LMOVE), c.lmove, ExactArgs(4), WithKeys(1, 2, 1), WithFlags(CmdWrite), WithCategories("list"), WithSummary("Returns an element after popping it from one list and pushing it to another. Deletes the list if the last element was moved."))
+	s.RegisterCommandFunc(string(RPOPLPUSH), c.rpoplpush, ExactArgs(2), WithKeys(1, 2, 1), WithFlags(CmdWrite), WithCategories("list"), WithSummary("Returns the last element of a list after removing and pushing it to another list. Deletes the list if the last element was popped."), Deprecated("LMOVE"))
+	s.RegisterCommandFunc(string(LMPOP), c.lmpop, MinArgs(3), WithKeysFunc(NumKeysAt(1)), WithFlags(CmdWrite), WithCategories("list"), WithSummary("Returns multiple elements from a list after removing them. Deletes the list if the last element was popped."))
+
+	s.RegisterCommandFunc(string(BLPOP), c.bpop(true), MinArgs(2), WithKeys(1, -2, 1), WithFlags(CmdWrite|CmdBlocking), WithCategories("list"), WithSummary("Removes and returns the first element in a list. Blocks until an element is available otherwise. Deletes the list if the last element was popped."))
+	s.RegisterCommandFunc(string(BRPOP), c.bpop(false), MinArgs(2), WithKeys(1, -2, 1), WithFlags(CmdWrite|CmdBlocking), WithCategories("list"), WithSummary("Removes and returns the last element in a list. Blocks until an element is available otherwise. Deletes the list if the last element was popped."))
+	s.RegisterCommandFunc(string(BLMOVE), c.blmove, ExactArgs(5), WithKeys(1, 2, 1), WithFlags(CmdWrite|CmdBlocking), WithCategories("list"), WithSummary("Pops an element from a list, pushes it to another list and returns it. Blocks until an element is available otherwise. Deletes the list if the last element was moved."))
+	s.RegisterCommandFunc(string(BRPOPLPUSH), c.brpoplpush, ExactArgs(3), WithKeys(1, 2, 1), WithFlags(CmdWrite|CmdBlocking), WithCategories("list"), WithSummary("Pops an element from a list, pushes it to another list and returns it. Block until an element is available otherwise. Deletes the list if the last element was popped."), Deprecated("BLMOVE"))
+	s.RegisterCommandFunc(string(BLMPOP), c.blmpop, MinArgs(4), WithKeysFunc(NumKeysAt(2)), WithFlags(CmdWrite|CmdBlocking), WithCategories("list"), WithSummary("Pops the first element from one of multiple lists. Blocks until an element is available otherwise. Deletes the list if the last element was popped."))
+}
+
+// pushEnd adds value at the front or the back of l
+func pushEnd(l *store.List, front bool, value []byte) {
+	if front {
+		l.PushFront(value)
+	} else {
+		l.PushBack(value)
+	}
+}
+
+// popEnd removes an element from the front or the back of l
+func popEnd(l *store.List, front bool) ([]byte, bool) {
+	if front {
+		return l.PopFront()
+	}
+	return l.PopBack()
+}
+
+// nextEnd consumes LEFT or RIGHT and reports whether it is LEFT
+func nextEnd(p *args.Parser) bool {
+	return p.NextKeyword("LEFT", "RIGHT") == "LEFT"
+}
+
+// elementsAdded tells WATCH, client tracking and the connections blocked on
+// key that elements were added to it
+func (s *Server) elementsAdded(conn *Connection, key string) {
+	s.KeysWritten(conn, key)
+	s.SignalKey(connDB(conn), key)
+}
+
+// push implements LPUSH, RPUSH, LPUSHX and RPUSHX key element [element ...]
+func (c *storeCommands) push(front, onlyExisting bool) func(*Connection, *Command) RedisValue {
+	return func(conn *Connection, cmd *Command) RedisValue {
+		n := 0
+		err := c.db(conn).lists.UpdateList(cmd.Args[0], func(l *store.List) error {
+			if onlyExisting && l.Len() == 0 {
+				return nil
+			}
+			for _, element := range cmd.Args[1:] {
+				pushEnd(l, front, []byte(element))
+			}
+			n = l.Len()
+			return nil
+		})
+		if err != nil {
+			return ErrorValue(err)
+		}
+		if n > 0 {
+			c.server.elementsAdded(conn, cmd.Args[0])
+		}
+		return RedisValue{Type: Integer, Int: int64(n)}
+	}
+}
+
+// popN removes up to count elements from the front or the back of the list
+// held by key and reports whether key held a list
+func (c *storeCommands) popN(conn *Connection, key string, front bool, count int) ([][]byte, bool, error) {
+	var values [][]byte
+	exists := false
+	err := c.db(conn).lists.UpdateList(key, func(l *store.List) error {
+		exists = l.Len() > 0
+		for len(values) < count {
+			value, ok := popEnd(l, front)
+			if !ok {
+				break
+			}
+			values = append(values, value)
+		}
+		return nil
+	})
+	if len(values) > 0 {
+		c.server.KeysWritten(conn, key)
+	}
+	return values, exists, err
+}
+
+// bulkArray returns values as an array of bulk strings
+func bulkArray(values [][]byte) RedisValue {
+	reply := make([]RedisValue, len(values))
+	for i, value := range values {
+		reply[i] = RedisValue{Type: BulkString, Bulk: value}
+	}
+	return RedisValue{Type: Array, Array: reply}
+}
+
+// pop implements LPOP and RPOP key [count]
+func (c *storeCommands) pop(front bool) func(*Connection, *Command) RedisValue {
+	return func(conn *Connection, cmd *Command) RedisValue {
+		key := cmd.Args[0]
+		if len(cmd.Args) == 1 {
+			values, _, err := c.popN(conn, key, front, 1)
+			if err != nil {
+				return ErrorValue(err)
+			}
+			if len(values) == 0 {
+				return RedisValue{Type: Null}
+			}
+			return RedisValue{Type: BulkString, Bulk: values[0]}
+		}
+
+		count, err := strconv.ParseInt(cmd.Args[1], 10, 64)
+		if err != nil || count < 0 {
+			return NewError(ErrPrefixGeneric, "value is out of range, must be positive").Value()
+		}
+		values, exists, err := c.popN(conn, key, front, int(count))
+		if err != nil {
+			return ErrorValue(err)
+		}
+		if !exists {
+			return RedisValue{Type: NullArray}
+		}
+		return bulkArray(values)
+	}
+}
+
+// llen implements LLEN key
+func (c *storeCommands) llen(conn *Connection, cmd *Command) RedisValue {
+	n := 0
+	err := c.db(conn).lists.ViewList(cmd.Args[0], func(l *store.List) {
+		n = l.Len()
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysRead(conn, cmd.Args[0])
+	return RedisValue{Type: Integer, Int: int64(n)}
+}
+
+// lrange implements LRANGE key start stop
+func (c *storeCommands) lrange(conn *Connection, cmd *Command) RedisValue {
+	p := args.New(cmd.Args[1:])
+	start, stop := p.NextInt(), p.NextInt()
+	if err := p.Done(); err != nil {
+		return ErrorValue(err)
+	}
+	var values [][]byte
+	err := c.db(conn).lists.ViewList(cmd.Args[0], func(l *store.List) {
+		l.Range(int(start), int(stop), func(_ int, value []byte) bool {
+			values = append(values, value)
+			return true
+		})
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysRead(conn, cmd.Args[0])
+	return bulkArray(values)
+}
+
+// lindex implements LINDEX key index
+func (c *storeCommands) lindex(conn *Connection, cmd *Command) RedisValue {
+	index, err := strconv.ParseInt(cmd.Args[1], 10, 64)
+	if err != nil {
+		return ErrorValue(args.ErrNotInteger)
+	}
+	var reply RedisValue
+	err = c.db(conn).lists.ViewList(cmd.Args[0], func(l *store.List) {
+		reply = bulkOrNull(l.Index(int(index)))
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysRead(conn, cmd.Args[0])
+	return reply
+}
+
+// linsert implements LINSERT key BEFORE|AFTER pivot element
+func (c *storeCommands) linsert(conn *Connection, cmd *Command) RedisValue {
+	p := args.New(cmd.Args[1:2])
+	after := p.NextKeyword("BEFORE", "AFTER") == "AFTER"
+	if err := p.Err(); err != nil {
+		return ErrorValue(err)
+	}
+	pivot, element := []byte(cmd.Args[2]), []byte(cmd.Args[3])
+	n := 0
+	err := c.db(conn).lists.UpdateList(cmd.Args[0], func(l *store.List) error {
+		if l.Len() == 0 {
+			return nil
+		}
+		n = -1
+		l.Range(0, -1, func(i int, value []byte) bool {
+			if !bytes.Equal(value, pivot) {
+				return true
+			}
+			if after {
+				i++
+			}
+			l.Insert(i, element)
+			n = l.Len()
+			return false
+		})
+		return nil
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	if n > 0 {
+		c.server.elementsAdded(conn, cmd.Args[0])
+	}
+	return RedisValue{Type: Integer, Int: int64(n)}
+}
+
+// lrem implements LREM key count element
+func (c *storeCommands) lrem(conn *Connection, cmd *Command) RedisValue {
+	count, err := strconv.ParseInt(cmd.Args[1], 10, 64)
+	if err != nil {
+		return ErrorValue(args.ErrNotInteger)
+	}
+	removed := 0
+	err = c.db(conn).lists.UpdateList(cmd.Args[0], func(l *store.List) error {
+		removed = l.RemoveValue([]byte(cmd.Args[2]), int(count))
+		return nil
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	if removed > 0 {
+		c.server.KeysWritten(conn, cmd.Args[0])
+	}
+	return RedisValue{Type: Integer, Int: int64(removed)}
+}
+
+// lset implements LSET key index element
+func (c *storeCommands) lset(conn *Connection, cmd *Command) RedisValue {
+	index, err := strconv.ParseInt(cmd.Args[1], 10, 64)
+	if err != nil {
+		return ErrorValue(args.ErrNotInteger)
+	}
+	err = c.db(conn).lists.UpdateList(cmd.Args[0], func(l *store.List) error {
+		if l.Len() == 0 {
+			return NewError(ErrPrefixGeneric, "no such key")
+		}
+		if !l.Set(int(index), []byte(cmd.Args[2])) {
+			return NewError(ErrPrefixGeneric, "index out of range")
+		}
+		return nil
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysWritten(conn, cmd.Args[0])
+	return RedisValue{Type: SimpleString, Str: "OK"}
+}
+
+// ltrim implements LTRIM key start stop
+func (c *storeCommands) ltrim(conn *Connection, cmd *Command) RedisValue {
+	p := args.New(cmd.Args[1:])
+	start, stop := p.NextInt(), p.NextInt()
+	if err := p.Done(); err != nil {
+		return ErrorValue(err)
+	}
+	changed := false
+	err := c.db(conn).lists.UpdateList(cmd.Args[0], func(l *store.List) error {
+		n := l.Len()
+		l.Trim(int(start), int(stop))
+		changed = l.Len() != n
+		return nil
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	if changed {
+		c.server.KeysWritten(conn, cmd.Args[0])
+	}
+	return RedisValue{Type: SimpleString, Str: "OK"}
+}
+
+// lpos implements LPOS key element [RANK rank] [COUNT num-matches] [MAXLEN len]
+func (c *storeCommands) lpos(conn *Connection, cmd *Command) RedisValue {
+	rank, count, maxLen := 1, -1, 0
+	p := args.New(cmd.Args[2:])
+	for p.More() {
+		switch {
+		case p.MatchKeyword("RANK", &rank):
+			if p.Err() == nil && rank == 0 {
+				p.Fail(NewError(ErrPrefixGeneric, "RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list"))
+			}
+		case p.MatchKeyword("COUNT", &count):
+			if p.Err() == nil && count < 0 {
+				p.Fail(NewError(ErrPrefixGeneric, "COUNT can't be negative"))
+			}
+		case p.MatchKeyword("MAXLEN", &maxLen):
+			if p.Err() == nil && maxLen < 0 {
+				p.Fail(NewError(ErrPrefixGeneric, "MAXLEN can't be negative"))
+			}
+		default:
+			p.Fail(args.ErrSyntax)
+		}
+	}
+	if err := p.Err(); err != nil {
+		return ErrorValue(err)
+	}
+
+	element := []byte(cmd.Args[1])
+	var matches []RedisValue
+	err := c.db(conn).lists.ViewList(cmd.Args[0], func(l *store.List) {
+		n := l.Len()
+		if maxLen == 0 || maxLen > n {
+			maxLen = n
+		}
+		// A negative rank counts matches from the end
+		skip, i, step := rank-1, 0, 1
+		if rank < 0 {
+			skip, i, step = -rank-1, n-1, -1
+		}
+		for ; maxLen > 0; i, maxLen = i+step, maxLen-1 {
+			value, _ := l.Index(i)
+			if !bytes.Equal(value, element) {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			matches = append(matches, RedisValue{Type: Integer, Int: int64(i)})
+			// Without COUNT only the first match is needed, COUNT 0 wants all
+			if count < 0 || len(matches) == count {
+				break
+			}
+		}
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysRead(conn, cmd.Args[0])
+	if count < 0 {
+		if len(matches) == 0 {
+			return RedisValue{Type: Null}
+		}
+		return matches[0]
+	}
+	return RedisValue{Type: Array, Array: matches}
+}
+
+// move pops an element from the list src and pushes it to the list dst,
+// returning false if src is empty
+func (c *storeCommands) move(conn *Connection, src, dst string, from, to bool) (RedisValue, bool) {
+	var value []byte
+	var ok bool
+	err := c.db(conn).lists.UpdateLists([]string{src, dst}, func(lists []*store.List) error {
+		if value, ok = popEnd(lists[0], from); ok {
+			pushEnd(lists[1], to, value)
+		}
+		return nil
+	})
+	if err != nil {
+		return ErrorValue(err), true
+	}
+	if !ok {
+		return RedisValue{Type: Null}, false
+	}
+	c.server.KeysWritten(conn, src)
+	c.server.elementsAdded(conn, dst)
+	return RedisValue{Type: BulkString, Bulk: value}, true
+}
+
+// lmove implements LMOVE source destination LEFT|RIGHT LEFT|RIGHT
+func (c *storeCommands) lmove(conn *Connection, cmd *Command) RedisValue {
+	p := args.New(cmd.Args[2:])
+	from, to := nextEnd(p), nextEnd(p)
+	if err := p.Err(); err != nil {
+		return ErrorValue(err)
+	}
+	reply, _ := c.move(conn, cmd.Args[0], cmd.Args[1], from, to)
+	return reply
+}
+
+// rpoplpush implements RPOPLPUSH source destination
+func (c *storeCommands) rpoplpush(conn *Connection, cmd *Command) RedisValue {
+	reply, _ := c.move(conn, cmd.Args[0], cmd.Args[1], false, true)
+	return reply
+}
+
+// mpopArgs are the arguments of LMPOP, ZMPOP and their blocking forms
+// following the timeout
+type mpopArgs struct {
+	keys  []string
+	front bool // LEFT or MIN rather than RIGHT or MAX
+	count int
+}
+
+// parseMPop parses numkeys key [key ...] followed by the end to pop from,
+// front or back, and [COUNT count]
+func parseMPop(arguments []string, front, back string) (mpopArgs, error) {
+	var mpop mpopArgs
+	p := args.New(arguments)
+	mpop.keys = nextNumKeys(p, NewError(ErrPrefixGeneric, "numkeys should be greater than 0"), args.ErrSyntax)
+	mpop.front = p.NextKeyword(front, back) == front
+	mpop.count = 1
+	if p.MatchKeyword("COUNT", &mpop.count) && p.Err() == nil && mpop.count < 1 {
+		p.Fail(NewError(ErrPrefixGeneric, "count should be greater than 0"))
+	}
+	return mpop, p.Done()
+}
+
+// mpop pops up to count elements from the list held by key, returning false
+// if the list is empty
+func (c *storeCommands) mpop(conn *Connection, key string, mpop mpopArgs) (RedisValue, bool) {
+	values, _, err := c.popN(conn, key, mpop.front, mpop.count)
+	if err != nil {
+		return ErrorValue(err), true
+	}
+	if len(values) == 0 {
+		return RedisValue{}, false
+	}
+	return RedisValue{Type: Array, Array: []RedisValue{bulkOf(key), bulkArray(values)}}, true
+}
+
+// lmpop implements LMPOP numkeys key [key ...] LEFT|RIGHT [COUNT count]
+func (c *storeCommands) lmpop(conn *Connection, cmd *Command) RedisValue {
+	mpop, err := parseMPop(cmd.Args, "LEFT", "RIGHT")
+	if err != nil {
+		return ErrorValue(err)
+	}
+	for _, key := range mpop.keys {
+		if reply, ok := c.mpop(conn, key, mpop); ok {
+			return reply
+		}
+	}
+	return RedisValue{Type: NullArray}
+}
+
+// parseTimeout parses the timeout of a blocking command in seconds
+func parseTimeout(arg string) (time.Duration, error) {
+	seconds, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(seconds) || math.Abs(seconds) > math.MaxInt64/float64(time.Second) {
+		return 0, NewError(ErrPrefixGeneric, "timeout is not a float or out of range")
+	}
+	if seconds < 0 {
+		return 0, NewError(ErrPrefixGeneric, "timeout is negative")
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// block serves a blocking command with wake right away if one of keys
+// allows it, or else blocks conn on keys until wake does
+func block(conn *Connection, keys []string, timeout time.Duration, wake func(key string) (RedisValue, bool)) RedisValue {
+	for _, key := range keys {
+		if reply, ok := wake(key); ok {
+			return reply
+		}
+	}
+	if conn == nil {
+		return RedisValue{Type: NullArray}
+	}
+	return conn.BlockOnKeys(keys, timeout, wake)
+}
+
+// bpop implements BLPOP and BRPOP key [key ...] timeout
+func (c *storeCommands) bpop(front bool) func(*Connection, *Command) RedisValue {
+	return func(conn *Connection, cmd *Command) RedisValue {
+		keys := cmd.Args[:len(cmd.Args)-1]
+		timeout, err := parseTimeout(cmd.Args[len(cmd.Args)-1])
+		if err != nil {
+			return ErrorValue(err)
+		}
+		return block(conn, keys, timeout, func(key string) (RedisValue, bool) {
+			values, _, err := c.popN(conn, key, front, 1)
+			if err != nil {
+				return ErrorValue(err), true
+			}
+			if len(values) == 0 {
+				return RedisValue{}, false
+			}
+			return RedisValue{Type: Array, Array: []RedisValue{bulkOf(key), {Type: BulkString, Bulk: values[0]}}}, true
+		})
+	}
+}
+
+// bmove serves BLMOVE and BRPOPLPUSH, replying null on timeout
+func (c *storeCommands) bmove(conn *Connection, src, dst string, from, to bool, timeout time.Duration) RedisValue {
+	reply := block(conn, []string{src}, timeout, func(string) (RedisValue, bool) {
+		return c.move(conn, src, dst, from, to)
+	})
+	if reply.Type == NullArray {
+		return RedisValue{Type: Null}
+	}
+	return reply
+}
+
+// blmove implements BLMOVE source destination LEFT|RIGHT LEFT|RIGHT timeout
+func (c *storeCommands) blmove(conn *Connection, cmd *Command) RedisValue {
+	p := args.New(cmd.Args[2:4])
+	from, to := nextEnd(p), nextEnd(p)
+	if err := p.Err(); err != nil {
+		return ErrorValue(err)
+	}
+	timeout, err := parseTimeout(cmd.Args[4])
+	if err != nil {
+		return ErrorValue(err)
+	}
+	return c.bmove(conn, cmd.Args[0], cmd.Args[1], from, to, timeout)
+}
+
+// brpoplpush implements BRPOPLPUSH source destination timeout
+func (c *storeCommands) brpoplpush(conn *Connection, cmd *Command) RedisValue {
+	timeout, err := parseTimeout(cmd.Args[2])
+	if err != nil {
+		return ErrorValue(err)
+	}
+	return c.bmove(conn, cmd.Args[0], cmd.Args[1], false, true, timeout)
+}
+
+// blmpop implements BLMPOP timeout numkeys key [key ...] LEFT|RIGHT [COUNT count]
+func (c *storeCommands) blmpop(conn *Connection, cmd *Command) RedisValue {
+	timeout, err := parseTimeout(cmd.Args[0])
+	if err != nil {
+		return ErrorValue(err)
+	}
+	mpop, err := parseMPop(cmd.Args[1:], "LEFT", "RIGHT")
+	if err != nil {
+		return ErrorValue(err)
+	}
+	return block(conn, mpop.keys, timeout, func(key string) (RedisValue, bool) {
+		return c.mpop(conn, key, mpop)
+	})
+}
@@ -0,0 +1,100 @@
+package redkit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TestBuiltinStoreLists tests the list commands over the wire
+func TestBuiltinStoreLists(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	server.EnableBuiltinStore()
+	client := dialRaw(t, address)
+
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"LPUSHX", "l", "a"}, []string{":0"}},
+		{[]string{"RPUSH", "l", "b", "c"}, []string{":2"}},
+		{[]string{"LPUSH", "l", "a"}, []string{":3"}},
+		{[]string{"LRANGE", "l", "0", "-1"}, []string{"*3", "$1", "a", "$1", "b", "$1", "c"}},
+		{[]string{"LINDEX", "l", "-1"}, []string{"$1", "c"}},
+		{[]string{"LINDEX", "l", "5"}, []string{"$-1"}},
+		{[]string{"LINSERT", "l", "BEFORE", "c", "x"}, []string{":4"}},
+		{[]string{"LINSERT", "l", "AFTER", "missing", "x"}, []string{":-1"}},
+		{[]string{"LPOS", "l", "x"}, []string{":2"}},
+		{[]string{"LSET", "l", "2", "b"}, []string{"+OK"}},
+		{[]string{"LPOS", "l", "b", "COUNT", "0"}, []string{"*2", ":1", ":2"}},
+		{[]string{"LPOS", "l", "b", "RANK", "-1"}, []string{":2"}},
+		{[]string{"LPOS", "l", "b", "RANK", "0"}, []string{"-ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list"}},
+		{[]string{"LSET", "l", "9", "z"}, []string{"-ERR index out of range"}},
+		{[]string{"LSET", "missing", "0", "z"}, []string{"-ERR no such key"}},
+		{[]string{"LREM", "l", "0", "b"}, []string{":2"}},
+		{[]string{"LLEN", "l"}, []string{":2"}},
+		{[]string{"LMOVE", "l", "m", "LEFT", "RIGHT"}, []string{"$1", "a"}},
+		{[]string{"RPOPLPUSH", "l", "m"}, []string{"$1", "c"}},
+		{[]string{"EXISTS", "l"}, []string{":0"}},
+		{[]string{"LPOP", "l", "2"}, []string{"*-1"}},
+		{[]string{"LMPOP", "2", "l", "m", "LEFT", "COUNT", "5"}, []string{"*2", "$1", "m", "*2", "$1", "c", "$1", "a"}},
+		{[]string{"LMPOP", "0", "l", "LEFT"}, []string{"-ERR numkeys should be greater than 0"}},
+		{[]string{"RPUSH", "l", "1", "2", "3", "4"}, []string{":4"}},
+		{[]string{"LTRIM", "l", "1", "-2"}, []string{"+OK"}},
+		{[]string{"RPOP", "l", "0"}, []string{"*0"}},
+		{[]string{"RPOP", "l"}, []string{"$1", "3"}},
+		{[]string{"LPOP", "l", "-1"}, []string{"-ERR value is out of range, must be positive"}},
+		{[]string{"SET", "s", "v"}, []string{"+OK"}},
+		{[]string{"LPUSH", "s", "a"}, []string{"-WRONGTYPE Operation against a key holding the wrong kind of value"}},
+		{[]string{"BLPOP", "s", "0"}, []string{"-WRONGTYPE Operation against a key holding the wrong kind of value"}},
+		{[]string{"BLPOP", "l", "-1"}, []string{"-ERR timeout is negative"}},
+		{[]string{"BRPOP", "empty", "l", "0"}, []string{"*2", "$1", "l", "$1", "2"}},
+		{[]string{"BLMOVE", "empty", "l", "LEFT", "LEFT", "0.01"}, []string{"$-1"}},
+	}
+	for _, tt := range tests {
+		client.send(t, tt.args...)
+		expectLines(t, client, tt.expected...)
+	}
+}
+
+// TestBuiltinStoreBlockingLists tests that list pushes wake blocked pops
+func TestBuiltinStoreBlockingLists(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	server.EnableBuiltinStore()
+	blocked := dialRaw(t, address)
+	mover := dialRaw(t, address)
+	pusher := dialRaw(t, address)
+
+	blocked.send(t, "BLPOP", "a", "b", "0")
+	lines := readAsync(blocked, 5)
+	waitForState(t, server, StateBlocked, 1)
+	mover.send(t, "BLMOVE", "src", "b", "RIGHT", "LEFT", "0")
+	moved := readAsync(mover, 2)
+	waitForState(t, server, StateBlocked, 2)
+
+	// The moved element lands on b and wakes the BLPOP in turn
+	pusher.send(t, "RPUSH", "src", "x")
+	pusher.readLine(t)
+	expectLine(t, moved, "$1")
+	expectLine(t, moved, "x")
+	for _, want := range []string{"*2", "$1", "b", "$1", "x"} {
+		expectLine(t, lines, want)
+	}
+
+	rdb := redis.NewClient(&redis.Options{Addr: address, Protocol: 2})
+	defer rdb.Close()
+	ctx := context.Background()
+	if exists, _ := rdb.Exists(ctx, "src", "b").Result(); exists != 0 {
+		t.Errorf("Expected the emptied lists to be deleted, %d exist", exists)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		rdb.RPush(ctx, "c", "1", "2", "3")
+	}()
+	key, values, err := rdb.BLMPop(ctx, time.Second, "right", 2, "c").Result()
+	if err != nil || key != "c" || len(values) != 2 || values[0] != "3" {
+		t.Errorf("Expected c [3 2], got %s %v %v", key, values, err)
+	}
+}
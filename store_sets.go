@@ -0,0 +1,325 @@
+package redkit
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/l00pss/redkit/args"
+	"github.com/l00pss/redkit/store"
+)
+
+// registerSets registers the set commands of the built-in store
+func (c *storeCommands) registerSets() {
+	s := c.server
+	s.RegisterCommandFunc(string(SADD), c.sadd, MinArgs(2), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("set"), WithSummary("Adds one or more members to a set. Creates the key if it doesn't exist."))
+	s.RegisterCommandFunc(string(SREM), c.srem, MinArgs(2), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("set"), WithSummary("Removes one or more members from a set. Deletes the set if the last member was removed."))
+	s.RegisterCommandFunc(string(SMEMBERS), c.smembers, ExactArgs(1), WithKeys(1, 1, 1), WithFlags(CmdReadOnly), WithCategories("set"), WithSummary("Returns all members of a set."))
+	s.RegisterCommandFunc(string(SISMEMBER), c.sismember, ExactArgs(2), WithKeys(1, 1, 1), WithFlags(CmdReadOnly|CmdFast), WithCategories("set"), WithSummary("Determines whether a member belongs to a set."))
+	s.RegisterCommandFunc(string(SMISMEMBER), c.smismember, MinArgs(2), WithKeys(1, 1, 1), WithFlags(CmdReadOnly|CmdFast), WithCategories("set"), WithSummary("Determines whether multiple members belong to a set."))
+	s.RegisterCommandFunc(string(SCARD), c.scard, ExactArgs(1), WithKeys(1, 1, 1), WithFlags(CmdReadOnly|CmdFast), WithCategories("set"), WithSummary("Returns the number of members in a set."))
+	s.RegisterCommandFunc(string(SPOP), c.spop, RangeArgs(1, 2), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("set"), WithSummary("Returns one or more random members from a set after removing them. Deletes the set if the last member was popped."))
+	s.RegisterCommandFunc(string(SRANDMEMBER), c.srandmember, RangeArgs(1, 2), WithKeys(1, 1, 1), WithFlags(CmdReadOnly), WithCategories("set"), WithSummary("Get one or multiple random members from a set"))
+	s.RegisterCommandFunc(string(SMOVE), c.smove, ExactArgs(3), WithKeys(1, 2, 1), WithFlags(CmdWrite|CmdFast), WithCategories("set"), WithSummary("Moves a member from one set to another."))
+	s.RegisterCommandFunc(string(SSCAN), c.sscan, MinArgs(2), WithKeys(1, 1, 1), WithFlags(CmdReadOnly), WithCategories("set"), WithSummary("Iterates over members of a set."))
+
+	s.RegisterCommandFunc(string(SINTER), c.combine(store.Inter), MinArgs(1), WithKeys(1, -1, 1), WithFlags(CmdReadOnly), WithCategories("set"), WithSummary("Returns the intersect of multiple sets."))
+	s.RegisterCommandFunc(string(SUNION), c.combine(store.Union), MinArgs(1), WithKeys(1, -1, 1), WithFlags(CmdReadOnly), WithCategories("set"), WithSummary("Returns the union of multiple sets."))
+	s.RegisterCommandFunc(string(SDIFF), c.combine(store.Diff), MinArgs(1), WithKeys(1, -1, 1), WithFlags(CmdReadOnly), WithCategories("set"), WithSummary("Returns the difference of multiple sets."))
+	s.RegisterCommandFunc(string(SINTERSTORE), c.combineStore(store.Inter), MinArgs(2), WithKeys(1, -1, 1), WithFlags(CmdWrite), WithCategories("set"), WithSummary("Stores the intersect of multiple sets in a key."))
+	s.RegisterCommandFunc(string(SUNIONSTORE), c.combineStore(store.Union), MinArgs(2), WithKeys(1, -1, 1), WithFlags(CmdWrite), WithCategories("set"), WithSummary("Stores the union of multiple sets in a key."))
+	s.RegisterCommandFunc(string(SDIFFSTORE), c.combineStore(store.Diff), MinArgs(2), WithKeys(1, -1, 1), WithFlags(CmdWrite), WithCategories("set"), WithSummary("Stores the difference of multiple sets in a key."))
+	s.RegisterCommandFunc(string(SINTERCARD), c.sintercard, MinArgs(2), WithKeysFunc(NumKeysAt(1)), WithFlags(CmdReadOnly), WithCategories("set"), WithSummary("Returns the number of members of the intersect of multiple sets."))
+}
+
+// membersReply returns members as a set reply
+func membersReply(members []string) RedisValue {
+	reply := make([]RedisValue, len(members))
+	for i, member := range members {
+		reply[i] = bulkOf(member)
+	}
+	return RedisValue{Type: Set, Array: reply}
+}
+
+// boolInteger returns 1 if b is true, else 0
+func boolInteger(b bool) RedisValue {
+	if b {
+		return RedisValue{Type: Integer, Int: 1}
+	}
+	return RedisValue{Type: Integer, Int: 0}
+}
+
+// sadd implements SADD key member [member ...]
+func (c *storeCommands) sadd(conn *Connection, cmd *Command) RedisValue {
+	added := 0
+	err := c.db(conn).sets.UpdateSet(cmd.Args[0], func(set *store.Set) error {
+		for _, member := range cmd.Args[1:] {
+			if set.Add(member) {
+				added++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	if added > 0 {
+		c.server.KeysWritten(conn, cmd.Args[0])
+	}
+	return RedisValue{Type: Integer, Int: int64(added)}
+}
+
+// srem implements SREM key member [member ...]
+func (c *storeCommands) srem(conn *Connection, cmd *Command) RedisValue {
+	removed := 0
+	err := c.db(conn).sets.UpdateSet(cmd.Args[0], func(set *store.Set) error {
+		for _, member := range cmd.Args[1:] {
+			if set.Remove(member) {
+				removed++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	if removed > 0 {
+		c.server.KeysWritten(conn, cmd.Args[0])
+	}
+	return RedisValue{Type: Integer, Int: int64(removed)}
+}
+
+// smembers implements SMEMBERS key
+func (c *storeCommands) smembers(conn *Connection, cmd *Command) RedisValue {
+	var members []string
+	err := c.db(conn).sets.ViewSet(cmd.Args[0], func(set *store.Set) {
+		members = set.Members()
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysRead(conn, cmd.Args[0])
+	return membersReply(members)
+}
+
+// sismember implements SISMEMBER key member
+func (c *storeCommands) sismember(conn *Connection, cmd *Command) RedisValue {
+	var found bool
+	err := c.db(conn).sets.ViewSet(cmd.Args[0], func(set *store.Set) {
+		found = set.Contains(cmd.Args[1])
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysRead(conn, cmd.Args[0])
+	return boolInteger(found)
+}
+
+// smismember implements SMISMEMBER key member [member ...]
+func (c *storeCommands) smismember(conn *Connection, cmd *Command) RedisValue {
+	members := cmd.Args[1:]
+	reply := make([]RedisValue, len(members))
+	err := c.db(conn).sets.ViewSet(cmd.Args[0], func(set *store.Set) {
+		for i, member := range members {
+			reply[i] = boolInteger(set.Contains(member))
+		}
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysRead(conn, cmd.Args[0])
+	return RedisValue{Type: Array, Array: reply}
+}
+
+// scard implements SCARD key
+func (c *storeCommands) scard(conn *Connection, cmd *Command) RedisValue {
+	n := 0
+	err := c.db(conn).sets.ViewSet(cmd.Args[0], func(set *store.Set) {
+		n = set.Len()
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysRead(conn, cmd.Args[0])
+	return RedisValue{Type: Integer, Int: int64(n)}
+}
+
+// spop implements SPOP key [count]
+func (c *storeCommands) spop(conn *Connection, cmd *Command) RedisValue {
+	count := int64(1)
+	if len(cmd.Args) == 2 {
+		var err error
+		count, err = strconv.ParseInt(cmd.Args[1], 10, 64)
+		if err != nil || count < 0 {
+			return NewError(ErrPrefixGeneric, "value is out of range, must be positive").Value()
+		}
+	}
+	var popped []string
+	err := c.db(conn).sets.UpdateSet(cmd.Args[0], func(set *store.Set) error {
+		if count >= int64(set.Len()) {
+			popped = set.Members()
+			for _, member := range popped {
+				set.Remove(member)
+			}
+			return nil
+		}
+		for int64(len(popped)) < count {
+			member, _ := set.Random()
+			set.Remove(member)
+			popped = append(popped, member)
+		}
+		return nil
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	if len(popped) > 0 {
+		c.server.KeysWritten(conn, cmd.Args[0])
+	}
+	if len(cmd.Args) == 2 {
+		return membersReply(popped)
+	}
+	if len(popped) == 0 {
+		return RedisValue{Type: Null}
+	}
+	return bulkOf(popped[0])
+}
+
+// srandmember implements SRANDMEMBER key [count]
+func (c *storeCommands) srandmember(conn *Connection, cmd *Command) RedisValue {
+	if len(cmd.Args) == 1 {
+		var member string
+		var ok bool
+		err := c.db(conn).sets.ViewSet(cmd.Args[0], func(set *store.Set) {
+			member, ok = set.Random()
+		})
+		if err != nil {
+			return ErrorValue(err)
+		}
+		return bulkOrNull([]byte(member), ok)
+	}
+
+	count, err := strconv.ParseInt(cmd.Args[1], 10, 64)
+	if err != nil {
+		return ErrorValue(args.ErrNotInteger)
+	}
+	if count < -math.MaxInt64/2 || count > math.MaxInt64/2 {
+		return NewError(ErrPrefixGeneric, "value is out of range").Value()
+	}
+	var picks []string
+	err = c.db(conn).sets.ViewSet(cmd.Args[0], func(set *store.Set) {
+		random := func() string {
+			member, _ := set.Random()
+			return member
+		}
+		picks = randomPicks(int64(set.Len()), count, random, set.Members, func(member string) string { return member })
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	reply := make([]RedisValue, len(picks))
+	for i, pick := range picks {
+		reply[i] = bulkOf(pick)
+	}
+	return RedisValue{Type: Array, Array: reply}
+}
+
+// smove implements SMOVE source destination member
+func (c *storeCommands) smove(conn *Connection, cmd *Command) RedisValue {
+	moved := false
+	err := c.db(conn).sets.UpdateSets(cmd.Args[:2], func(sets []*store.Set) error {
+		if moved = sets[0].Remove(cmd.Args[2]); moved {
+			sets[1].Add(cmd.Args[2])
+		}
+		return nil
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	if moved {
+		c.server.KeysWritten(conn, cmd.Args[:2]...)
+	}
+	return boolInteger(moved)
+}
+
+// sscan implements SSCAN key cursor [MATCH pattern] [COUNT count]
+func (c *storeCommands) sscan(conn *Connection, cmd *Command) RedisValue {
+	scan, err := parseScan(cmd.Args[1:], nil)
+	if err != nil {
+		return ErrorValue(err)
+	}
+	var members []string
+	var next uint64
+	err = c.db(conn).sets.ViewSet(cmd.Args[0], func(set *store.Set) {
+		members, next = set.Scan(scan.cursor, scan.match, scan.count)
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	items := make([]RedisValue, len(members))
+	for i, member := range members {
+		items[i] = bulkOf(member)
+	}
+	return scanReply(next, items)
+}
+
+// combine implements SINTER, SUNION and SDIFF key [key ...]
+func (c *storeCommands) combine(op func(sets []*store.Set) *store.Set) func(*Connection, *Command) RedisValue {
+	return func(conn *Connection, cmd *Command) RedisValue {
+		var members []string
+		err := c.db(conn).sets.ViewSets(cmd.Args, func(sets []*store.Set) {
+			members = op(sets).Members()
+		})
+		if err != nil {
+			return ErrorValue(err)
+		}
+		c.server.KeysRead(conn, cmd.Args...)
+		return membersReply(members)
+	}
+}
+
+// combineStore implements SINTERSTORE, SUNIONSTORE and SDIFFSTORE
+// destination key [key ...]
+func (c *storeCommands) combineStore(op func(sets []*store.Set) *store.Set) func(*Connection, *Command) RedisValue {
+	return func(conn *Connection, cmd *Command) RedisValue {
+		n := 0
+		err := c.db(conn).sets.StoreSet(cmd.Args[0], cmd.Args[1:], func(sets []*store.Set) *store.Set {
+			result := op(sets)
+			n = result.Len()
+			return result
+		})
+		if err != nil {
+			return ErrorValue(err)
+		}
+		c.server.KeysWritten(conn, cmd.Args[0])
+		return RedisValue{Type: Integer, Int: int64(n)}
+	}
+}
+
+// parseInterCard parses numkeys key [key ...] [LIMIT limit]
+func parseInterCard(arguments []string) ([]string, int, error) {
+	p := args.New(arguments)
+	keys := nextNumKeys(p, NewError(ErrPrefixGeneric, "numkeys should be greater than 0"), NewError(ErrPrefixGeneric, "Number of keys can't be greater than number of args"))
+	limit := 0
+	if p.MatchKeyword("LIMIT", &limit) && p.Err() == nil && limit < 0 {
+		p.Fail(NewError(ErrPrefixGeneric, "LIMIT can't be negative"))
+	}
+	return keys, limit, p.Done()
+}
+
+// sintercard implements SINTERCARD numkeys key [key ...] [LIMIT limit]
+func (c *storeCommands) sintercard(conn *Connection, cmd *Command) RedisValue {
+	keys, limit, err := parseInterCard(cmd.Args)
+	if err != nil {
+		return ErrorValue(err)
+	}
+
+	card := 0
+	err = c.db(conn).sets.ViewSets(keys, func(sets []*store.Set) {
+		card = store.InterCard(sets, limit)
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysRead(conn, keys...)
+	return RedisValue{Type: Integer, Int: int64(card)}
+}
@@ -0,0 +1,76 @@
+package redkit
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TestBuiltinStoreSets tests the set commands over the wire
+func TestBuiltinStoreSets(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	server.EnableBuiltinStore()
+	client := dialRaw(t, address)
+
+	// Sets of integers list their members in order, which keeps replies stable
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"SADD", "a", "3", "1", "2", "1"}, []string{":3"}},
+		{[]string{"SADD", "b", "2", "3", "4"}, []string{":3"}},
+		{[]string{"SMEMBERS", "a"}, []string{"*3", "$1", "1", "$1", "2", "$1", "3"}},
+		{[]string{"SISMEMBER", "a", "2"}, []string{":1"}},
+		{[]string{"SMISMEMBER", "a", "2", "9"}, []string{"*2", ":1", ":0"}},
+		{[]string{"SCARD", "a"}, []string{":3"}},
+		{[]string{"SINTER", "a", "b"}, []string{"*2", "$1", "2", "$1", "3"}},
+		{[]string{"SDIFF", "a", "b"}, []string{"*1", "$1", "1"}},
+		{[]string{"SUNIONSTORE", "u", "a", "b"}, []string{":4"}},
+		{[]string{"SINTERCARD", "2", "a", "b", "LIMIT", "1"}, []string{":1"}},
+		{[]string{"SINTERCARD", "3", "a", "b"}, []string{"-ERR Number of keys can't be greater than number of args"}},
+		{[]string{"SINTERSTORE", "i", "a", "missing"}, []string{":0"}},
+		{[]string{"EXISTS", "i"}, []string{":0"}},
+		{[]string{"SMOVE", "a", "b", "1"}, []string{":1"}},
+		{[]string{"SMOVE", "a", "b", "1"}, []string{":0"}},
+		{[]string{"SREM", "a", "2", "9"}, []string{":1"}},
+		{[]string{"SRANDMEMBER", "a", "5"}, []string{"*1", "$1", "3"}},
+		{[]string{"SRANDMEMBER", "a", "-2"}, []string{"*2", "$1", "3", "$1", "3"}},
+		{[]string{"SSCAN", "b", "0", "MATCH", "4"}, []string{"*2", "$1", "0", "*1", "$1", "4"}},
+		{[]string{"SPOP", "a"}, []string{"$1", "3"}},
+		{[]string{"EXISTS", "a"}, []string{":0"}},
+		{[]string{"SPOP", "a", "2"}, []string{"*0"}},
+		{[]string{"SPOP", "a", "-1"}, []string{"-ERR value is out of range, must be positive"}},
+		{[]string{"SET", "s", "v"}, []string{"+OK"}},
+		{[]string{"SADD", "s", "a"}, []string{"-WRONGTYPE Operation against a key holding the wrong kind of value"}},
+		{[]string{"SUNIONSTORE", "s", "b"}, []string{":4"}},
+	}
+	for _, tt := range tests {
+		client.send(t, tt.args...)
+		expectLines(t, client, tt.expected...)
+	}
+}
+
+// TestBuiltinStoreSetsClient tests the set commands through go-redis
+func TestBuiltinStoreSetsClient(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	server.EnableBuiltinStore()
+	rdb := redis.NewClient(&redis.Options{Addr: address})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	rdb.SAdd(ctx, "s", "a", "b", "c", "1")
+	members, err := rdb.SMembers(ctx, "s").Result()
+	slices.Sort(members)
+	if err != nil || !slices.Equal(members, []string{"1", "a", "b", "c"}) {
+		t.Errorf("Expected [1 a b c], got %v %v", members, err)
+	}
+	popped, err := rdb.SPopN(ctx, "s", 3).Result()
+	if err != nil || len(popped) != 3 {
+		t.Errorf("Expected 3 popped members, got %v %v", popped, err)
+	}
+	if n, _ := rdb.SCard(ctx, "s").Result(); n != 1 {
+		t.Errorf("Expected 1 member left, got %d", n)
+	}
+}
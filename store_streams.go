@@ -0,0 +1,535 @@
+package redkit
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/l00pss/redkit/args"
+	"github.com/l00pss/redkit/store"
+)
+
+// registerStreams registers the stream commands of the built-in store
+func (c *storeCommands) registerStreams() {
+	s := c.server
+	s.RegisterCommandFunc(string(XADD), c.xadd, MinArgs(4), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("stream"), WithSummary("Appends a new message to a stream. Creates the key if it doesn't exist."))
+	s.RegisterCommandFunc(string(XRANGE), c.xrange(false), RangeArgs(3, 5), WithKeys(1, 1, 1), WithFlags(CmdReadOnly), WithCategories("stream"), WithSummary("Returns the messages from a stream within a range of IDs."))
+	s.RegisterCommandFunc(string(XREVRANGE), c.xrange(true), RangeArgs(3, 5), WithKeys(1, 1, 1), WithFlags(CmdReadOnly), WithCategories("stream"), WithSummary("Returns the messages from a stream within a range of IDs in reverse order."))
+	s.RegisterCommandFunc(string(XLEN), c.xlen, ExactArgs(1), WithKeys(1, 1, 1), WithFlags(CmdReadOnly|CmdFast), WithCategories("stream"), WithSummary("Return the number of messages in a stream."))
+	s.RegisterCommandFunc(string(XDEL), c.xdel, MinArgs(2), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("stream"), WithSummary("Returns the number of messages after removing them from a stream."))
+	s.RegisterCommandFunc(string(XTRIM), c.xtrim, MinArgs(3), WithKeys(1, 1, 1), WithFlags(CmdWrite), WithCategories("stream"), WithSummary("Deletes messages from the beginning of a stream."))
+	s.RegisterCommandFunc(string(XSETID), c.xsetid, MinArgs(2), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("stream"), WithSummary("An internal command for replicating stream values."))
+	s.RegisterCommandFunc(string(XREAD), c.xread, MinArgs(3), WithKeysFunc(xreadKeys), WithFlags(CmdReadOnly|CmdBlocking), WithCategories("stream"), WithSummary("Returns messages from multiple streams with IDs greater than the ones requested. Blocks until a message is available otherwise."))
+}
+
+// errStreamID is the reply to a stream ID that doesn't parse
+var errStreamID = NewError(ErrPrefixGeneric, "Invalid stream ID specified as stream command argument")
+
+// parseStreamID parses an ID given as ms-seq, or as ms with sequence seq
+func parseStreamID(arg string, seq uint64) (store.StreamID, error) {
+	msPart, seqPart, hasSeq := strings.Cut(arg, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return store.StreamID{}, errStreamID
+	}
+	if hasSeq {
+		if seq, err = strconv.ParseUint(seqPart, 10, 64); err != nil {
+			return store.StreamID{}, errStreamID
+		}
+	}
+	return store.StreamID{Ms: ms, Seq: seq}, nil
+}
+
+// parseRangeID parses an end of an XRANGE interval: an ID, - or +, or an ID
+// prefixed by ( to exclude it. An ID without a sequence covers the whole
+// millisecond, so it means its first sequence at the start and its last at
+// the end.
+func parseRangeID(arg string, end bool) (store.StreamID, error) {
+	switch arg {
+	case "-":
+		return store.StreamID{}, nil
+	case "+":
+		return store.MaxStreamID, nil
+	}
+	seq := uint64(0)
+	if end {
+		seq = store.MaxStreamID.Seq
+	}
+	exclusive := strings.HasPrefix(arg, "(")
+	id, err := parseStreamID(strings.TrimPrefix(arg, "("), seq)
+	if err != nil || !exclusive {
+		return id, err
+	}
+	ok := false
+	if end {
+		if id, ok = id.Prev(); !ok {
+			return id, NewError(ErrPrefixGeneric, "invalid end ID for the interval")
+		}
+	} else if id, ok = id.Next(); !ok {
+		return id, NewError(ErrPrefixGeneric, "invalid start ID for the interval")
+	}
+	return id, nil
+}
+
+// entryReply returns a stream entry as its ID followed by its fields and
+// values
+func entryReply(e store.StreamEntry) RedisValue {
+	return RedisValue{Type: Array, Array: []RedisValue{bulkOf(e.ID.String()), bulkArray(e.Fields)}}
+}
+
+// streamEntries returns up to count entries of st from start to end, all if
+// count is negative
+func streamEntries(st *store.Stream, start, end store.StreamID, reverse bool, count int64) []RedisValue {
+	entries := []RedisValue{}
+	if st == nil || count == 0 {
+		return entries
+	}
+	st.Range(start, end, reverse, func(e store.StreamEntry) bool {
+		entries = append(entries, entryReply(e))
+		return count < 0 || int64(len(entries)) < count
+	})
+	return entries
+}
+
+// streamTrim is the trimming option of XADD and XTRIM: MAXLEN | MINID [= |
+// ~] threshold [LIMIT count]
+type streamTrim struct {
+	strategy string // MAXLEN or MINID, "" without trimming
+	maxLen   int
+	minID    store.StreamID
+	limit    int
+}
+
+// defaultTrimLimit is how many entries trimming with ~ removes at most
+// without LIMIT, 100 stream nodes of 100 entries in Redis. With ~ Redis
+// trims whole nodes only; this stream has none and trims exactly.
+const defaultTrimLimit = 100 * 100
+
+// matchTrim consumes a trimming option if the next argument starts one
+func matchTrim(p *args.Parser, trim *streamTrim) bool {
+	switch {
+	case p.MatchFlag("MAXLEN"):
+		trim.strategy = "MAXLEN"
+	case p.MatchFlag("MINID"):
+		trim.strategy = "MINID"
+	default:
+		return false
+	}
+	approximate := false
+	if p.MatchFlag("~") {
+		approximate = true
+	} else {
+		p.MatchFlag("=")
+	}
+	threshold := p.NextString()
+	if p.Err() != nil {
+		return true
+	}
+	if trim.strategy == "MAXLEN" {
+		n, err := strconv.ParseInt(threshold, 10, 64)
+		switch {
+		case err != nil:
+			p.Fail(args.ErrNotInteger)
+		case n < 0:
+			p.Fail(NewError(ErrPrefixGeneric, "The MAXLEN argument must be >= 0."))
+		}
+		trim.maxLen = int(n)
+	} else {
+		id, err := parseStreamID(threshold, 0)
+		if err != nil {
+			p.Fail(err)
+		}
+		trim.minID = id
+	}
+
+	limit := -1
+	if p.MatchKeyword("LIMIT", &limit) && p.Err() == nil {
+		switch {
+		case limit < 0:
+			p.Fail(NewError(ErrPrefixGeneric, "The LIMIT argument must be >= 0."))
+		case !approximate:
+			p.Fail(NewError(ErrPrefixGeneric, "syntax error, LIMIT cannot be used without the special ~ option"))
+		}
+	}
+	switch {
+	case limit >= 0:
+		trim.limit = limit
+	case approximate:
+		trim.limit = defaultTrimLimit
+	}
+	return true
+}
+
+// apply trims st and returns how many entries it removed
+func (t *streamTrim) apply(st *store.Stream) int {
+	switch t.strategy {
+	case "MAXLEN":
+		return st.TrimMaxLen(t.maxLen, t.limit)
+	case "MINID":
+		return st.TrimMinID(t.minID, t.limit)
+	}
+	return 0
+}
+
+// xadd implements XADD key [NOMKSTREAM] [MAXLEN | MINID [= | ~] threshold
+// [LIMIT count]] * | id field value [field value ...]
+func (c *storeCommands) xadd(conn *Connection, cmd *Command) RedisValue {
+	key := cmd.Args[0]
+	noMkStream := false
+	var trim streamTrim
+	p := args.New(cmd.Args[1:])
+options:
+	for p.More() {
+		switch {
+		case p.MatchFlag("NOMKSTREAM"):
+			noMkStream = true
+		case matchTrim(p, &trim):
+		default:
+			break options
+		}
+	}
+	idArg := p.NextString()
+	if err := p.Err(); err != nil {
+		return ErrorValue(err)
+	}
+	pairs := p.Rest()
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return NewError(ErrPrefixGeneric, "wrong number of arguments for 'xadd' command").Value()
+	}
+
+	// * and ms-* have the stream generate the ID, or part of it
+	var id store.StreamID
+	var nextID func(st *store.Stream) (store.StreamID, error)
+	switch {
+	case idArg == "*":
+		nextID = func(st *store.Stream) (store.StreamID, error) {
+			return st.NextID(uint64(time.Now().UnixMilli()))
+		}
+	case strings.HasSuffix(idArg, "-*"):
+		ms, err := strconv.ParseUint(strings.TrimSuffix(idArg, "-*"), 10, 64)
+		if err != nil {
+			return ErrorValue(errStreamID)
+		}
+		nextID = func(st *store.Stream) (store.StreamID, error) {
+			return st.NextSeq(ms)
+		}
+	default:
+		var err error
+		if id, err = parseStreamID(idArg, 0); err != nil {
+			return ErrorValue(err)
+		}
+		if id == (store.StreamID{}) {
+			return ErrorValue(store.ErrStreamIDZero)
+		}
+	}
+
+	fields := make([][]byte, len(pairs))
+	for i, arg := range pairs {
+		fields[i] = []byte(arg)
+	}
+	added := false
+	err := c.db(conn).streams.UpdateStream(key, !noMkStream, func(st *store.Stream) error {
+		if st == nil {
+			return nil
+		}
+		if nextID != nil {
+			var err error
+			if id, err = nextID(st); err != nil {
+				return err
+			}
+		}
+		if err := st.Add(id, fields); err != nil {
+			return err
+		}
+		added = true
+		trim.apply(st)
+		return nil
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	if !added {
+		return RedisValue{Type: Null}
+	}
+	c.server.elementsAdded(conn, key)
+	return bulkOf(id.String())
+}
+
+// xrange implements XRANGE key start end [COUNT count] and XREVRANGE key end
+// start [COUNT count]
+func (c *storeCommands) xrange(reverse bool) func(*Connection, *Command) RedisValue {
+	return func(conn *Connection, cmd *Command) RedisValue {
+		startArg, endArg := cmd.Args[1], cmd.Args[2]
+		if reverse {
+			startArg, endArg = endArg, startArg
+		}
+		start, err := parseRangeID(startArg, false)
+		if err != nil {
+			return ErrorValue(err)
+		}
+		end, err := parseRangeID(endArg, true)
+		if err != nil {
+			return ErrorValue(err)
+		}
+		count := int64(-1)
+		p := args.New(cmd.Args[3:])
+		if p.MatchKeyword("COUNT", &count) && count < 0 {
+			count = 0
+		}
+		if err := p.Done(); err != nil {
+			return ErrorValue(err)
+		}
+
+		var entries []RedisValue
+		err = c.db(conn).streams.ViewStream(cmd.Args[0], func(st *store.Stream) {
+			entries = streamEntries(st, start, end, reverse, count)
+		})
+		if err != nil {
+			return ErrorValue(err)
+		}
+		c.server.KeysRead(conn, cmd.Args[0])
+		return RedisValue{Type: Array, Array: entries}
+	}
+}
+
+// xlen implements XLEN key
+func (c *storeCommands) xlen(conn *Connection, cmd *Command) RedisValue {
+	n := 0
+	err := c.db(conn).streams.ViewStream(cmd.Args[0], func(st *store.Stream) {
+		if st != nil {
+			n = st.Len()
+		}
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysRead(conn, cmd.Args[0])
+	return RedisValue{Type: Integer, Int: int64(n)}
+}
+
+// xdel implements XDEL key id [id ...]
+func (c *storeCommands) xdel(conn *Connection, cmd *Command) RedisValue {
+	ids := make([]store.StreamID, len(cmd.Args)-1)
+	for i, arg := range cmd.Args[1:] {
+		var err error
+		if ids[i], err = parseStreamID(arg, 0); err != nil {
+			return ErrorValue(err)
+		}
+	}
+	removed := 0
+	err := c.db(conn).streams.UpdateStream(cmd.Args[0], false, func(st *store.Stream) error {
+		if st != nil {
+			removed = st.Delete(ids...)
+		}
+		return nil
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	if removed > 0 {
+		c.server.KeysWritten(conn, cmd.Args[0])
+	}
+	return RedisValue{Type: Integer, Int: int64(removed)}
+}
+
+// xtrim implements XTRIM key MAXLEN | MINID [= | ~] threshold [LIMIT count]
+func (c *storeCommands) xtrim(conn *Connection, cmd *Command) RedisValue {
+	var trim streamTrim
+	p := args.New(cmd.Args[1:])
+	if !matchTrim(p, &trim) {
+		p.Fail(args.ErrSyntax)
+	}
+	if err := p.Done(); err != nil {
+		return ErrorValue(err)
+	}
+	removed := 0
+	err := c.db(conn).streams.UpdateStream(cmd.Args[0], false, func(st *store.Stream) error {
+		if st != nil {
+			removed = trim.apply(st)
+		}
+		return nil
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	if removed > 0 {
+		c.server.KeysWritten(conn, cmd.Args[0])
+	}
+	return RedisValue{Type: Integer, Int: int64(removed)}
+}
+
+// xsetid implements XSETID key last-id [ENTRIESADDED entries-added]
+// [MAXDELETEDID max-deleted-id]
+func (c *storeCommands) xsetid(conn *Connection, cmd *Command) RedisValue {
+	lastID, err := parseStreamID(cmd.Args[1], 0)
+	if err != nil {
+		return ErrorValue(err)
+	}
+	entriesAdded := int64(-1)
+	var maxDeleted string
+	p := args.New(cmd.Args[2:])
+	for p.More() {
+		switch {
+		case p.MatchKeyword("ENTRIESADDED", &entriesAdded):
+			if p.Err() == nil && entriesAdded < 0 {
+				p.Fail(NewError(ErrPrefixGeneric, "entries_added must be positive"))
+			}
+		case p.MatchKeyword("MAXDELETEDID", &maxDeleted):
+		default:
+			p.Fail(args.ErrSyntax)
+		}
+	}
+	if err := p.Err(); err != nil {
+		return ErrorValue(err)
+	}
+	var maxDeletedID store.StreamID
+	if maxDeleted != "" {
+		if maxDeletedID, err = parseStreamID(maxDeleted, 0); err != nil {
+			return ErrorValue(err)
+		}
+	}
+
+	err = c.db(conn).streams.UpdateStream(cmd.Args[0], false, func(st *store.Stream) error {
+		if st == nil {
+			return NewError(ErrPrefixGeneric, "no such key")
+		}
+		added, deleted := st.EntriesAdded(), st.MaxDeletedID()
+		if entriesAdded >= 0 {
+			added = uint64(entriesAdded)
+		}
+		if maxDeleted != "" {
+			deleted = maxDeletedID
+		}
+		return st.SetID(lastID, added, deleted)
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysWritten(conn, cmd.Args[0])
+	return RedisValue{Type: SimpleString, Str: "OK"}
+}
+
+// xreadKeys returns the keys of XREAD [COUNT count] [BLOCK milliseconds]
+// STREAMS key [key ...] id [id ...]: the first half of the arguments after
+// STREAMS
+func xreadKeys(cmd *Command) []string {
+	for i, arg := range cmd.Args {
+		if strings.EqualFold(arg, "STREAMS") {
+			rest := cmd.Args[i+1:]
+			return rest[:len(rest)/2]
+		}
+	}
+	return nil
+}
+
+// xread implements XREAD [COUNT count] [BLOCK milliseconds] STREAMS key
+// [key ...] id [id ...]
+func (c *storeCommands) xread(conn *Connection, cmd *Command) RedisValue {
+	count := int64(-1)
+	blockMs := int64(-1)
+	streams := false
+	p := args.New(cmd.Args)
+	for p.More() && !streams {
+		switch {
+		case p.MatchFlag("STREAMS"):
+			streams = true
+		case p.MatchKeyword("COUNT", &count):
+		case p.MatchKeyword("BLOCK", &blockMs):
+			if p.Err() == nil && blockMs < 0 {
+				p.Fail(NewError(ErrPrefixGeneric, "timeout is negative"))
+			}
+		default:
+			p.Fail(args.ErrSyntax)
+		}
+	}
+	rest := p.Rest()
+	switch {
+	case p.Err() != nil:
+		return ErrorValue(p.Err())
+	case !streams:
+		return ErrorValue(args.ErrSyntax)
+	case len(rest) == 0 || len(rest)%2 != 0:
+		return NewError(ErrPrefixGeneric, "Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified.").Value()
+	}
+	// COUNT 0 reads every entry, as no COUNT does
+	if count <= 0 {
+		count = -1
+	}
+	keys, idArgs := rest[:len(rest)/2], rest[len(rest)/2:]
+
+	// $ and + are resolved now, so blocking waits for entries added later
+	after := make([]store.StreamID, len(keys))
+	var err error
+	for i, arg := range idArgs {
+		if arg != "$" && arg != "+" {
+			if after[i], err = parseStreamID(arg, 0); err != nil {
+				return ErrorValue(err)
+			}
+		}
+	}
+	err = c.db(conn).streams.ViewStreams(keys, func(streams []*store.Stream) {
+		for i, st := range streams {
+			switch {
+			case st == nil || (idArgs[i] != "$" && idArgs[i] != "+"):
+			case idArgs[i] == "+" && st.Len() > 0:
+				// The last entry, which is the only one after its predecessor
+				st.Range(store.StreamID{}, store.MaxStreamID, true, func(e store.StreamEntry) bool {
+					after[i], _ = e.ID.Prev()
+					return false
+				})
+			default:
+				after[i] = st.LastID()
+			}
+		}
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+
+	read := func(string) (RedisValue, bool) {
+		var reply RedisValue
+		found := false
+		err := c.db(conn).streams.ViewStreams(keys, func(streams []*store.Stream) {
+			reply, found = c.xreadReply(conn, keys, streams, after, count)
+		})
+		if err != nil {
+			return ErrorValue(err), true
+		}
+		return reply, found
+	}
+	c.server.KeysRead(conn, keys...)
+	if reply, ok := read(""); ok {
+		return reply
+	}
+	if blockMs < 0 || conn == nil {
+		return RedisValue{Type: NullArray}
+	}
+	return conn.BlockOnKeys(keys, time.Duration(blockMs)*time.Millisecond, read)
+}
+
+// xreadReply returns the entries of streams after the IDs in after, keyed by
+// stream, and whether there were any
+func (c *storeCommands) xreadReply(conn *Connection, keys []string, streams []*store.Stream, after []store.StreamID, count int64) (RedisValue, bool) {
+	var pairs []MapEntry
+	for i, st := range streams {
+		start, ok := after[i].Next()
+		if !ok {
+			continue
+		}
+		if entries := streamEntries(st, start, store.MaxStreamID, false, count); len(entries) > 0 {
+			pairs = append(pairs, MapEntry{Key: bulkOf(keys[i]), Value: RedisValue{Type: Array, Array: entries}})
+		}
+	}
+	if len(pairs) == 0 {
+		return RedisValue{}, false
+	}
+	if conn != nil && conn.Protocol() >= RESP3 {
+		return RedisValue{Type: Map, Map: pairs}, true
+	}
+	// RESP2 gets an array of key and entries pairs rather than a flat map
+	reply := make([]RedisValue, len(pairs))
+	for i, pair := range pairs {
+		reply[i] = RedisValue{Type: Array, Array: []RedisValue{pair.Key, pair.Value}}
+	}
+	return RedisValue{Type: Array, Array: reply}, true
+}
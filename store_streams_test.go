@@ -0,0 +1,108 @@
+package redkit
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TestBuiltinStoreStreams tests the stream commands over the wire
+func TestBuiltinStoreStreams(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	server.EnableBuiltinStore()
+	client := dialRaw(t, address)
+
+	// entry returns the reply lines of a stream entry
+	entry := func(id string, fields ...string) []string {
+		lines := []string{"*2", "$" + strconv.Itoa(len(id)), id, "*" + strconv.Itoa(len(fields))}
+		for _, f := range fields {
+			lines = append(lines, "$"+strconv.Itoa(len(f)), f)
+		}
+		return lines
+	}
+	concat := func(parts ...[]string) []string {
+		return slices.Concat(parts...)
+	}
+
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"XADD", "s", "1-1", "a", "1"}, []string{"$3", "1-1"}},
+		{[]string{"XADD", "s", "1-*", "b", "2"}, []string{"$3", "1-2"}},
+		{[]string{"XADD", "s", "2", "c", "3"}, []string{"$3", "2-0"}},
+		{[]string{"XADD", "s", "2-0", "d", "4"}, []string{"-ERR The ID specified in XADD is equal or smaller than the target stream top item"}},
+		{[]string{"XADD", "s", "0-0", "d", "4"}, []string{"-ERR The ID specified in XADD must be greater than 0-0"}},
+		{[]string{"XADD", "s", "x", "d", "4"}, []string{"-ERR Invalid stream ID specified as stream command argument"}},
+		{[]string{"XADD", "s", "3-0", "d"}, []string{"-ERR wrong number of arguments for 'xadd' command"}},
+		{[]string{"XADD", "missing", "NOMKSTREAM", "*", "a", "1"}, []string{"$-1"}},
+		{[]string{"EXISTS", "missing"}, []string{":0"}},
+		{[]string{"XLEN", "s"}, []string{":3"}},
+		{[]string{"XRANGE", "s", "-", "+", "COUNT", "2"}, concat([]string{"*2"}, entry("1-1", "a", "1"), entry("1-2", "b", "2"))},
+		{[]string{"XRANGE", "s", "(1-1", "1"}, concat([]string{"*1"}, entry("1-2", "b", "2"))},
+		{[]string{"XREVRANGE", "s", "+", "(1-2"}, concat([]string{"*1"}, entry("2-0", "c", "3"))},
+		{[]string{"XRANGE", "s", "(-", "+"}, []string{"-ERR Invalid stream ID specified as stream command argument"}},
+		{[]string{"XREAD", "COUNT", "1", "STREAMS", "s", "1-1"}, concat([]string{"*1", "*2", "$1", "s", "*1"}, entry("1-2", "b", "2"))},
+		{[]string{"XREAD", "STREAMS", "s", "$"}, []string{"*-1"}},
+		{[]string{"XREAD", "STREAMS", "s", "+"}, concat([]string{"*1", "*2", "$1", "s", "*1"}, entry("2-0", "c", "3"))},
+		{[]string{"XREAD", "STREAMS", "s", "missing", "0"}, []string{"-ERR Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified."}},
+		{[]string{"XDEL", "s", "1-2", "9-9"}, []string{":1"}},
+		{[]string{"XADD", "s", "MAXLEN", "1", "3-0", "e", "5"}, []string{"$3", "3-0"}},
+		{[]string{"XLEN", "s"}, []string{":1"}},
+		{[]string{"XADD", "s", "4-0", "f", "6"}, []string{"$3", "4-0"}},
+		{[]string{"XTRIM", "s", "MINID", "=", "4"}, []string{":1"}},
+		{[]string{"XTRIM", "s", "MAXLEN", "0", "LIMIT", "1"}, []string{"-ERR syntax error, LIMIT cannot be used without the special ~ option"}},
+		{[]string{"XTRIM", "s", "MAXLEN", "~", "0", "LIMIT", "1"}, []string{":1"}},
+		{[]string{"XLEN", "s"}, []string{":0"}},
+		{[]string{"EXISTS", "s"}, []string{":1"}},
+		{[]string{"XADD", "s", "*", "g", "7"}, nil},
+		{[]string{"XSETID", "s", "1-0"}, []string{"-ERR The ID specified in XSETID is smaller than the target stream top item"}},
+		{[]string{"XSETID", "missing", "1-0"}, []string{"-ERR no such key"}},
+		{[]string{"SET", "str", "v"}, []string{"+OK"}},
+		{[]string{"XADD", "str", "*", "a", "1"}, []string{"-WRONGTYPE Operation against a key holding the wrong kind of value"}},
+	}
+	for _, tt := range tests {
+		client.send(t, tt.args...)
+		if tt.expected == nil {
+			client.readLine(t)
+			client.readLine(t)
+			continue
+		}
+		expectLines(t, client, tt.expected...)
+	}
+}
+
+// TestBuiltinStoreStreamsClient tests the stream commands through go-redis,
+// whose XREAD expects a map of streams under RESP3
+func TestBuiltinStoreStreamsClient(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	server.EnableBuiltinStore()
+	rdb := redis.NewClient(&redis.Options{Addr: address})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	id, err := rdb.XAdd(ctx, &redis.XAddArgs{Stream: "s", Values: []string{"k", "v"}}).Result()
+	if err != nil || id == "" {
+		t.Fatalf("Expected a generated ID, got %q %v", id, err)
+	}
+	streams, err := rdb.XRead(ctx, &redis.XReadArgs{Streams: []string{"s", "0"}}).Result()
+	if err != nil || len(streams) != 1 || len(streams[0].Messages) != 1 || streams[0].Messages[0].Values["k"] != "v" {
+		t.Errorf("Expected the entry read back, got %v %v", streams, err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		rdb.XAdd(ctx, &redis.XAddArgs{Stream: "t", ID: "5-0", Values: []string{"n", "1"}})
+	}()
+	streams, err = rdb.XRead(ctx, &redis.XReadArgs{Streams: []string{"s", "t", "$", "$"}, Block: time.Second}).Result()
+	if err != nil || len(streams) != 1 || streams[0].Stream != "t" || streams[0].Messages[0].ID != "5-0" {
+		t.Errorf("Expected the blocked XREAD to get t's new entry, got %v %v", streams, err)
+	}
+	if _, err := rdb.XRead(ctx, &redis.XReadArgs{Streams: []string{"t", "$"}, Block: 20 * time.Millisecond}).Result(); err != redis.Nil {
+		t.Errorf("Expected the XREAD to time out, got %v", err)
+	}
+}
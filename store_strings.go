@@ -0,0 +1,323 @@
+package redkit
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/l00pss/redkit/args"
+	"github.com/l00pss/redkit/store"
+)
+
+// registerStrings registers the string commands of the built-in store
+func (c *storeCommands) registerStrings() {
+	s := c.server
+	s.RegisterCommandFunc(string(GET), c.get, ExactArgs(1), WithKeys(1, 1, 1), WithFlags(CmdReadOnly|CmdFast), WithCategories("string"), WithSummary("Returns the string value of a key."))
+	s.RegisterCommandFunc(string(SET), c.set, MinArgs(2), WithKeys(1, 1, 1), WithFlags(CmdWrite), WithCategories("string"), WithSummary("Sets the string value of a key, ignoring its type. The key is created if it doesn't exist."))
+	s.RegisterCommandFunc(string(SETEX), c.setex(time.Second), ExactArgs(3), WithKeys(1, 1, 1), WithFlags(CmdWrite), WithCategories("string"), WithSummary("Sets the string value and expiration time of a key. Creates the key if it doesn't exist."))
+	s.RegisterCommandFunc(string(PSETEX), c.setex(time.Millisecond), ExactArgs(3), WithKeys(1, 1, 1), WithFlags(CmdWrite), WithCategories("string"), WithSummary("Sets both string value and expiration time in milliseconds of a key. The key is created if it doesn't exist."))
+	s.RegisterCommandFunc(string(GETDEL), c.getdel, ExactArgs(1), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("string"), WithSummary("Returns the string value of a key after deleting the key."))
+	s.RegisterCommandFunc(string(GETEX), c.getex, MinArgs(1), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("string"), WithSummary("Returns the string value of a key after setting its expiration time."))
+	s.RegisterCommandFunc(string(SETNX), c.setnx, ExactArgs(2), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("string"), WithSummary("Set the string value of a key only when the key doesn't exist."))
+	s.RegisterCommandFunc(string(MGET), c.mget, MinArgs(1), WithKeys(1, -1, 1), WithFlags(CmdReadOnly|CmdFast), WithCategories("string"), WithSummary("Atomically returns the string values of one or more keys."))
+	s.RegisterCommandFunc(string(MSET), c.mset, VariadicArgs(2, 2), WithKeys(1, -1, 2), WithFlags(CmdWrite), WithCategories("string"), WithSummary("Atomically creates or modifies the string values of one or more keys."))
+	s.RegisterCommandFunc(string(MSETNX), c.msetnx, VariadicArgs(2, 2), WithKeys(1, -1, 2), WithFlags(CmdWrite), WithCategories("string"), WithSummary("Atomically modifies the string values of one or more keys only when all keys don't exist."))
+	s.RegisterCommandFunc(string(INCR), c.incrBy(1), ExactArgs(1), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("string"), WithSummary("Increments the integer value of a key by one. Uses 0 as initial value if the key doesn't exist."))
+	s.RegisterCommandFunc(string(DECR), c.incrBy(-1), ExactArgs(1), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("string"), WithSummary("Decrements the integer value of a key by one. Uses 0 as initial value if the key doesn't exist."))
+	s.RegisterCommandFunc(string(INCRBY), c.incrBy(1), ExactArgs(2), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("string"), WithSummary("Increments the integer value of a key by a number. Uses 0 as initial value if the key doesn't exist."))
+	s.RegisterCommandFunc(string(DECRBY), c.incrBy(-1), ExactArgs(2), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("string"), WithSummary("Decrements a number from the integer value of a key. Uses 0 as initial value if the key doesn't exist."))
+	s.RegisterCommandFunc(string(INCRBYFLOAT), c.incrbyfloat, ExactArgs(2), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("string"), WithSummary("Increment the floating point value of a key by a number. Uses 0 as initial value if the key doesn't exist."))
+	s.RegisterCommandFunc(string(APPEND), c.append, ExactArgs(2), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("string"), WithSummary("Appends a string to the value of a key. Creates the key if it doesn't exist."))
+	s.RegisterCommandFunc(string(STRLEN), c.strlen, ExactArgs(1), WithKeys(1, 1, 1), WithFlags(CmdReadOnly|CmdFast), WithCategories("string"), WithSummary("Returns the length of a string value."))
+	s.RegisterCommandFunc(string(SETRANGE), c.setrange, ExactArgs(3), WithKeys(1, 1, 1), WithFlags(CmdWrite), WithCategories("string"), WithSummary("Overwrites a part of a string value with another by an offset. Creates the key if it doesn't exist."))
+	s.RegisterCommandFunc(string(GETRANGE), c.getrange, ExactArgs(3), WithKeys(1, 1, 1), WithFlags(CmdReadOnly), WithCategories("string"), WithSummary("Returns a substring of the string stored at a key."))
+}
+
+// bulkOrNull returns value as a bulk string, or null if the key was missing
+func bulkOrNull(value []byte, ok bool) RedisValue {
+	if !ok {
+		return RedisValue{Type: Null}
+	}
+	return RedisValue{Type: BulkString, Bulk: value}
+}
+
+// get implements GET key, loading a missing key if the storage can. Inside
+// MULTI/EXEC or a script it doesn't, as every other connection would wait
+// for the load.
+func (c *storeCommands) get(conn *Connection, cmd *Command) RedisValue {
+	db := c.db(conn)
+	var value []byte
+	var ok bool
+	var err error
+	if db.loader != nil && !conn.inExec {
+		value, ok, err = db.loader.GetOrLoad(cmd.Context(), cmd.Args[0])
+	} else {
+		value, ok, err = db.store.Get(cmd.Args[0])
+	}
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysRead(conn, cmd.Args[0])
+	return bulkOrNull(value, ok)
+}
+
+// set implements SET key value [NX | XX] [GET] [EX seconds | PX milliseconds |
+// EXAT unix-time-seconds | PXAT unix-time-milliseconds | KEEPTTL]
+func (c *storeCommands) set(conn *Connection, cmd *Command) RedisValue {
+	parsed, err := args.ParseSetOptions(cmd.Args[2:])
+	if err != nil {
+		return ErrorValue(err)
+	}
+	opts := store.SetOptions{
+		NX:       parsed.NX,
+		XX:       parsed.XX,
+		Get:      parsed.Get,
+		KeepTTL:  parsed.KeepTTL,
+		ExpireAt: parsed.ExpireAt,
+	}
+	if parsed.TTL > 0 {
+		opts.ExpireAt = time.Now().Add(parsed.TTL)
+	}
+
+	key := cmd.Args[0]
+	result, err := c.db(conn).store.Set(key, []byte(cmd.Args[1]), opts)
+	if err != nil {
+		return ErrorValue(err)
+	}
+	if result.Written {
+		c.server.KeysWritten(conn, key)
+	}
+	switch {
+	case opts.Get:
+		return bulkOrNull(result.Old, result.Existed)
+	case result.Written:
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	default:
+		return RedisValue{Type: Null}
+	}
+}
+
+// setex returns the handler of SETEX, or PSETEX for unit milliseconds:
+// key time value
+func (c *storeCommands) setex(unit time.Duration) func(*Connection, *Command) RedisValue {
+	return func(conn *Connection, cmd *Command) RedisValue {
+		n, err := strconv.ParseInt(cmd.Args[1], 10, 64)
+		if err != nil {
+			return ErrorValue(args.ErrNotInteger)
+		}
+		if n <= 0 || n > math.MaxInt64/int64(unit) {
+			return argsError(cmd, args.ErrInvalidTime)
+		}
+		opts := store.SetOptions{ExpireAt: expirationTime(n, unit, false)}
+		if _, err := c.db(conn).store.Set(cmd.Args[0], []byte(cmd.Args[2]), opts); err != nil {
+			return ErrorValue(err)
+		}
+		c.server.KeysWritten(conn, cmd.Args[0])
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	}
+}
+
+// getdel implements GETDEL key
+func (c *storeCommands) getdel(conn *Connection, cmd *Command) RedisValue {
+	value, ok, err := c.db(conn).store.GetDel(cmd.Args[0])
+	if err != nil {
+		return ErrorValue(err)
+	}
+	if ok {
+		c.server.KeysWritten(conn, cmd.Args[0])
+	}
+	return bulkOrNull(value, ok)
+}
+
+// getex implements GETEX key [EX seconds | PX milliseconds |
+// EXAT unix-time-seconds | PXAT unix-time-milliseconds | PERSIST]
+func (c *storeCommands) getex(conn *Connection, cmd *Command) RedisValue {
+	var at time.Time
+	seen := false
+	p := args.New(cmd.Args[1:])
+	for p.More() {
+		switch {
+		case matchExpiration(p, &at, &seen):
+		case p.MatchFlag("PERSIST"):
+			if seen {
+				p.Fail(args.ErrSyntax)
+			}
+			seen = true
+		default:
+			p.Fail(args.ErrSyntax)
+		}
+	}
+	if err := p.Err(); err != nil {
+		return argsError(cmd, err)
+	}
+
+	value, ok, err := c.db(conn).store.GetEx(cmd.Args[0], func(time.Time) (time.Time, bool) {
+		return at, seen
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	if ok && seen {
+		c.server.KeysWritten(conn, cmd.Args[0])
+	} else {
+		c.server.KeysRead(conn, cmd.Args[0])
+	}
+	return bulkOrNull(value, ok)
+}
+
+// setnx implements SETNX key value
+func (c *storeCommands) setnx(conn *Connection, cmd *Command) RedisValue {
+	result, err := c.db(conn).store.Set(cmd.Args[0], []byte(cmd.Args[1]), store.SetOptions{NX: true})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	if !result.Written {
+		return RedisValue{Type: Integer, Int: 0}
+	}
+	c.server.KeysWritten(conn, cmd.Args[0])
+	return RedisValue{Type: Integer, Int: 1}
+}
+
+// mget implements MGET key [key ...]
+func (c *storeCommands) mget(conn *Connection, cmd *Command) RedisValue {
+	values, err := c.db(conn).store.MGet(cmd.Args...)
+	if err != nil {
+		return ErrorValue(err)
+	}
+	reply := make([]RedisValue, len(values))
+	for i, value := range values {
+		reply[i] = bulkOrNull(value, value != nil)
+	}
+	c.server.KeysRead(conn, cmd.Args...)
+	return RedisValue{Type: Array, Array: reply}
+}
+
+// pairs splits the key value arguments of MSET and MSETNX
+func pairs(arguments []string) ([]string, [][]byte) {
+	keys := make([]string, 0, len(arguments)/2)
+	values := make([][]byte, 0, len(arguments)/2)
+	for i := 0; i+1 < len(arguments); i += 2 {
+		keys = append(keys, arguments[i])
+		values = append(values, []byte(arguments[i+1]))
+	}
+	return keys, values
+}
+
+// mset implements MSET key value [key value ...]
+func (c *storeCommands) mset(conn *Connection, cmd *Command) RedisValue {
+	keys, values := pairs(cmd.Args)
+	if err := c.db(conn).store.MSet(keys, values); err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysWritten(conn, keys...)
+	return RedisValue{Type: SimpleString, Str: "OK"}
+}
+
+// msetnx implements MSETNX key value [key value ...]
+func (c *storeCommands) msetnx(conn *Connection, cmd *Command) RedisValue {
+	keys, values := pairs(cmd.Args)
+	ok, err := c.db(conn).store.MSetNX(keys, values)
+	if err != nil {
+		return ErrorValue(err)
+	}
+	if !ok {
+		return RedisValue{Type: Integer, Int: 0}
+	}
+	c.server.KeysWritten(conn, keys...)
+	return RedisValue{Type: Integer, Int: 1}
+}
+
+// incrBy returns the handler of INCR and INCRBY for sign 1, and of DECR and
+// DECRBY for sign -1
+func (c *storeCommands) incrBy(sign int64) func(*Connection, *Command) RedisValue {
+	return func(conn *Connection, cmd *Command) RedisValue {
+		delta := int64(1)
+		if len(cmd.Args) == 2 {
+			p := args.New(cmd.Args[1:])
+			delta = p.NextInt()
+			if err := p.Err(); err != nil {
+				return ErrorValue(err)
+			}
+		}
+		if sign < 0 {
+			if delta == math.MinInt64 {
+				return NewError(ErrPrefixGeneric, "decrement would overflow").Value()
+			}
+			delta = -delta
+		}
+
+		n, err := store.IncrBy(c.db(conn).store, cmd.Args[0], delta)
+		if err != nil {
+			return ErrorValue(err)
+		}
+		c.server.KeysWritten(conn, cmd.Args[0])
+		return RedisValue{Type: Integer, Int: n}
+	}
+}
+
+// incrbyfloat implements INCRBYFLOAT key increment
+func (c *storeCommands) incrbyfloat(conn *Connection, cmd *Command) RedisValue {
+	p := args.New(cmd.Args[1:])
+	delta := p.NextFloat()
+	if err := p.Err(); err != nil {
+		return ErrorValue(err)
+	}
+	f, err := store.IncrByFloat(c.db(conn).store, cmd.Args[0], delta)
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysWritten(conn, cmd.Args[0])
+	return RedisValue{Type: BulkString, Bulk: strconv.AppendFloat(nil, f, 'f', -1, 64)}
+}
+
+// append implements APPEND key value
+func (c *storeCommands) append(conn *Connection, cmd *Command) RedisValue {
+	n, err := store.Append(c.db(conn).store, cmd.Args[0], []byte(cmd.Args[1]))
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysWritten(conn, cmd.Args[0])
+	return RedisValue{Type: Integer, Int: int64(n)}
+}
+
+// strlen implements STRLEN key
+func (c *storeCommands) strlen(conn *Connection, cmd *Command) RedisValue {
+	n, err := store.StrLen(c.db(conn).store, cmd.Args[0])
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysRead(conn, cmd.Args[0])
+	return RedisValue{Type: Integer, Int: int64(n)}
+}
+
+// setrange implements SETRANGE key offset value
+func (c *storeCommands) setrange(conn *Connection, cmd *Command) RedisValue {
+	p := args.New(cmd.Args[1:2])
+	offset := p.NextInt()
+	if err := p.Err(); err != nil {
+		return ErrorValue(err)
+	}
+	n, err := store.SetRange(c.db(conn).store, cmd.Args[0], offset, []byte(cmd.Args[2]))
+	if err != nil {
+		return ErrorValue(err)
+	}
+	if cmd.Args[2] != "" {
+		c.server.KeysWritten(conn, cmd.Args[0])
+	}
+	return RedisValue{Type: Integer, Int: int64(n)}
+}
+
+// getrange implements GETRANGE key start end
+func (c *storeCommands) getrange(conn *Connection, cmd *Command) RedisValue {
+	p := args.New(cmd.Args[1:])
+	start, end := p.NextInt(), p.NextInt()
+	if err := p.Err(); err != nil {
+		return ErrorValue(err)
+	}
+	value, err := store.GetRange(c.db(conn).store, cmd.Args[0], start, end)
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysRead(conn, cmd.Args[0])
+	return RedisValue{Type: BulkString, Bulk: value}
+}
@@ -0,0 +1,164 @@
+package redkit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/l00pss/redkit/store"
+)
+
+// TestBuiltinStoreStrings tests the string commands over the wire
+func TestBuiltinStoreStrings(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	server.EnableBuiltinStore()
+	client := dialRaw(t, address)
+
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"SET", "k", "v"}, []string{"+OK"}},
+		{[]string{"GET", "k"}, []string{"$1", "v"}},
+		{[]string{"SET", "k", "w", "NX"}, []string{"$-1"}},
+		{[]string{"SET", "k", "w", "XX", "GET"}, []string{"$1", "v"}},
+		{[]string{"SET", "k", "w", "NX", "XX"}, []string{"-ERR syntax error"}},
+		{[]string{"SETNX", "k", "x"}, []string{":0"}},
+		{[]string{"APPEND", "k", "xyz"}, []string{":4"}},
+		{[]string{"STRLEN", "k"}, []string{":4"}},
+		{[]string{"GETRANGE", "k", "1", "-2"}, []string{"$2", "xy"}},
+		{[]string{"SETRANGE", "k", "1", "ab"}, []string{":4"}},
+		{[]string{"GET", "k"}, []string{"$4", "wabz"}},
+		{[]string{"INCR", "n"}, []string{":1"}},
+		{[]string{"INCRBY", "n", "10"}, []string{":11"}},
+		{[]string{"DECRBY", "n", "2"}, []string{":9"}},
+		{[]string{"DECR", "n"}, []string{":8"}},
+		{[]string{"INCRBY", "n", "x"}, []string{"-ERR value is not an integer or out of range"}},
+		{[]string{"INCR", "k"}, []string{"-ERR value is not an integer or out of range"}},
+		{[]string{"INCRBYFLOAT", "n", "0.5"}, []string{"$3", "8.5"}},
+		{[]string{"MSET", "a", "1", "b", "2"}, []string{"+OK"}},
+		{[]string{"MSET", "a", "1", "b"}, []string{"-ERR wrong number of arguments for 'mset' command"}},
+		{[]string{"MGET", "a", "missing", "b"}, []string{"*3", "$1", "1", "$-1", "$1", "2"}},
+		{[]string{"MSETNX", "b", "3", "c", "4"}, []string{":0"}},
+		{[]string{"EXISTS", "a", "a", "c"}, []string{":2"}},
+		{[]string{"DEL", "a", "b", "c"}, []string{":2"}},
+		{[]string{"GET", "a"}, []string{"$-1"}},
+	}
+	for _, tt := range tests {
+		client.send(t, tt.args...)
+		expectLines(t, client, tt.expected...)
+	}
+}
+
+// TestBuiltinStoreLoader tests that GET fills missing keys from the Loader
+// of the store
+func TestBuiltinStoreLoader(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	keys := server.EnableBuiltinStore()
+	keys.SetLoader(func(ctx context.Context, key string) ([]byte, time.Duration, error) {
+		switch key {
+		case "missing":
+			return nil, 0, store.ErrNotFound
+		case "failing":
+			return nil, 0, errors.New("upstream down")
+		}
+		return []byte("db:" + key), time.Minute, nil
+	})
+	client := dialRaw(t, address)
+
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"GET", "user"}, []string{"$7", "db:user"}},
+		{[]string{"TTL", "user"}, []string{":60"}},
+		{[]string{"GET", "missing"}, []string{"$-1"}},
+		{[]string{"GET", "failing"}, []string{"-ERR upstream down"}},
+		{[]string{"SET", "user", "local"}, []string{"+OK"}},
+		{[]string{"GET", "user"}, []string{"$5", "local"}},
+		{[]string{"EXISTS", "other"}, []string{":0"}},
+		{[]string{"EVAL", "return redis.call('GET', KEYS[1])", "1", "other"}, []string{"$-1"}},
+		{[]string{"MULTI"}, []string{"+OK"}},
+		{[]string{"GET", "other"}, []string{"+QUEUED"}},
+		{[]string{"EXEC"}, []string{"*1", "$-1"}},
+		{[]string{"SELECT", "1"}, []string{"+OK"}},
+		{[]string{"GET", "user"}, []string{"$-1"}},
+	}
+	for _, tt := range tests {
+		client.send(t, tt.args...)
+		expectLines(t, client, tt.expected...)
+	}
+}
+
+// TestBuiltinStoreExpiration tests that SET expirations hide keys once passed
+func TestBuiltinStoreExpiration(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	keys := server.EnableBuiltinStore()
+	if server.EnableBuiltinStore() != keys {
+		t.Fatal("Expected EnableBuiltinStore to return the same store twice")
+	}
+	client := dialRaw(t, address)
+
+	client.send(t, "SET", "k", "v", "PX", "50")
+	expectLines(t, client, "+OK")
+	client.send(t, "SET", "k", "w", "KEEPTTL")
+	expectLines(t, client, "+OK")
+	time.Sleep(100 * time.Millisecond)
+	client.send(t, "GET", "k")
+	expectLines(t, client, "$-1")
+	if _, ok, _ := keys.Get("k"); ok {
+		t.Error("Expected the key to have expired in the store")
+	}
+}
+
+// TestBuiltinStoreActiveExpire tests that expired keys are removed without
+// being accessed, aborting transactions watching them
+func TestBuiltinStoreActiveExpire(t *testing.T) {
+	config := DefaultServerConfig()
+	config.ExpireFrequency = 5 * time.Millisecond
+	server, address := startTestServer(t, config)
+	keys := server.EnableBuiltinStore()
+	keys.Set("k", []byte("v"), store.SetOptions{ExpireAt: time.Now().Add(50 * time.Millisecond)})
+	client := dialRaw(t, address)
+
+	client.send(t, "WATCH", "k")
+	expectLines(t, client, "+OK")
+	for deadline := time.Now().Add(time.Second); keys.Len() > 0; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the key to be removed once expired")
+		}
+	}
+	client.send(t, "MULTI")
+	expectLines(t, client, "+OK")
+	client.send(t, "SET", "k", "w")
+	expectLines(t, client, "+QUEUED")
+	client.send(t, "EXEC")
+	expectLines(t, client, "*-1")
+	if n := server.Stats().ExpiredKeys; n != 1 {
+		t.Errorf("Expected 1 expired key, got %d", n)
+	}
+}
+
+// TestBuiltinStoreWatch tests that store writes abort transactions watching the key
+func TestBuiltinStoreWatch(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	server.EnableBuiltinStore()
+	watcher := dialRaw(t, address)
+	writer := dialRaw(t, address)
+
+	watcher.send(t, "WATCH", "k")
+	expectLines(t, watcher, "+OK")
+	writer.send(t, "INCR", "k")
+	expectLines(t, writer, ":1")
+
+	watcher.send(t, "MULTI")
+	expectLines(t, watcher, "+OK")
+	watcher.send(t, "SET", "k", "v")
+	expectLines(t, watcher, "+QUEUED")
+	watcher.send(t, "EXEC")
+	expectLines(t, watcher, "*-1")
+
+	watcher.send(t, "GET", "k")
+	expectLines(t, watcher, "$1", "1")
+}
@@ -0,0 +1,899 @@
+package redkit
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/l00pss/redkit/args"
+	"github.com/l00pss/redkit/store"
+)
+
+// registerZSets registers the sorted set commands of the built-in store
+func (c *storeCommands) registerZSets() {
+	s := c.server
+	s.RegisterCommandFunc(string(ZADD), c.zadd, MinArgs(3), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("sortedset"), WithSummary("Adds one or more members to a sorted set, or updates their scores. Creates the key if it doesn't exist."))
+	s.RegisterCommandFunc(string(ZINCRBY), c.zincrby, ExactArgs(3), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("sortedset"), WithSummary("Increments the score of a member in a sorted set."))
+	s.RegisterCommandFunc(string(ZREM), c.zrem, MinArgs(2), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("sortedset"), WithSummary("Removes one or more members from a sorted set. Deletes the sorted set if all members were removed."))
+	s.RegisterCommandFunc(string(ZSCORE), c.zscore, ExactArgs(2), WithKeys(1, 1, 1), WithFlags(CmdReadOnly|CmdFast), WithCategories("sortedset"), WithSummary("Returns the score of a member in a sorted set."))
+	s.RegisterCommandFunc(string(ZMSCORE), c.zmscore, MinArgs(2), WithKeys(1, 1, 1), WithFlags(CmdReadOnly|CmdFast), WithCategories("sortedset"), WithSummary("Returns the score of one or more members in a sorted set."))
+	s.RegisterCommandFunc(string(ZCARD), c.zcard, ExactArgs(1), WithKeys(1, 1, 1), WithFlags(CmdReadOnly|CmdFast), WithCategories("sortedset"), WithSummary("Returns the number of members in a sorted set."))
+	s.RegisterCommandFunc(string(ZCOUNT), c.zcount, ExactArgs(3), WithKeys(1, 1, 1), WithFlags(CmdReadOnly|CmdFast), WithCategories("sortedset"), WithSummary("Returns the count of members in a sorted set that have scores within a range."))
+	s.RegisterCommandFunc(string(ZLEXCOUNT), c.zlexcount, ExactArgs(3), WithKeys(1, 1, 1), WithFlags(CmdReadOnly|CmdFast), WithCategories("sortedset"), WithSummary("Returns the number of members in a sorted set within a lexicographical range."))
+	s.RegisterCommandFunc(string(ZRANK), c.zrank(false), RangeArgs(2, 3), WithKeys(1, 1, 1), WithFlags(CmdReadOnly|CmdFast), WithCategories("sortedset"), WithSummary("Returns the index of a member in a sorted set ordered by ascending scores."))
+	s.RegisterCommandFunc(string(ZREVRANK), c.zrank(true), RangeArgs(2, 3), WithKeys(1, 1, 1), WithFlags(CmdReadOnly|CmdFast), WithCategories("sortedset"), WithSummary("Returns the index of a member in a sorted set ordered by descending scores."))
+	s.RegisterCommandFunc(string(ZRANDMEMBER), c.zrandmember, RangeArgs(1, 3), WithKeys(1, 1, 1), WithFlags(CmdReadOnly), WithCategories("sortedset"), WithSummary("Returns one or more random members from a sorted set."))
+	s.RegisterCommandFunc(string(ZSCAN), c.zscan, MinArgs(2), WithKeys(1, 1, 1), WithFlags(CmdReadOnly), WithCategories("sortedset"), WithSummary("Iterates over members and scores of a sorted set."))
+
+	s.RegisterCommandFunc(string(ZRANGE), c.zrange("", false), MinArgs(3), WithKeys(1, 1, 1), WithFlags(CmdReadOnly), WithCategories("sortedset"), WithSummary("Returns members in a sorted set within a range of indexes."))
+	s.RegisterCommandFunc(string(ZREVRANGE), c.zrange("", true), MinArgs(3), WithKeys(1, 1, 1), WithFlags(CmdReadOnly), WithCategories("sortedset"), WithSummary("Returns members in a sorted set within a range of indexes in reverse order."), Deprecated("ZRANGE"))
+	s.RegisterCommandFunc(string(ZRANGEBYSCORE), c.zrange("BYSCORE", false), MinArgs(3), WithKeys(1, 1, 1), WithFlags(CmdReadOnly), WithCategories("sortedset"), WithSummary("Returns members in a sorted set within a range of scores."), Deprecated("ZRANGE"))
+	s.RegisterCommandFunc(string(ZREVRANGEBYSCORE), c.zrange("BYSCORE", true), MinArgs(3), WithKeys(1, 1, 1), WithFlags(CmdReadOnly), WithCategories("sortedset"), WithSummary("Returns members in a sorted set within a range of scores in reverse order."), Deprecated("ZRANGE"))
+	s.RegisterCommandFunc(string(ZRANGEBYLEX), c.zrange("BYLEX", false), MinArgs(3), WithKeys(1, 1, 1), WithFlags(CmdReadOnly), WithCategories("sortedset"), WithSummary("Returns members in a sorted set within a lexicographical range."), Deprecated("ZRANGE"))
+	s.RegisterCommandFunc(string(ZREVRANGEBYLEX), c.zrange("BYLEX", true), MinArgs(3), WithKeys(1, 1, 1), WithFlags(CmdReadOnly), WithCategories("sortedset"), WithSummary("Returns members in a sorted set within a lexicographical range in reverse order."), Deprecated("ZRANGE"))
+	s.RegisterCommandFunc(string(ZRANGESTORE), c.zrangestore, MinArgs(4), WithKeys(1, 2, 1), WithFlags(CmdWrite), WithCategories("sortedset"), WithSummary("Stores a range of members from sorted set in a key."))
+	s.RegisterCommandFunc(string(ZREMRANGEBYRANK), c.zremrange(""), ExactArgs(3), WithKeys(1, 1, 1), WithFlags(CmdWrite), WithCategories("sortedset"), WithSummary("Removes members in a sorted set within a range of indexes. Deletes the sorted set if all members were removed."))
+	s.RegisterCommandFunc(string(ZREMRANGEBYSCORE), c.zremrange("BYSCORE"), ExactArgs(3), WithKeys(1, 1, 1), WithFlags(CmdWrite), WithCategories("sortedset"), WithSummary("Removes members in a sorted set within a range of scores. Deletes the sorted set if all members were removed."))
+	s.RegisterCommandFunc(string(ZREMRANGEBYLEX), c.zremrange("BYLEX"), ExactArgs(3), WithKeys(1, 1, 1), WithFlags(CmdWrite), WithCategories("sortedset"), WithSummary("Removes members in a sorted set within a lexicographical range. Deletes the sorted set if all members were removed."))
+
+	s.RegisterCommandFunc(string(ZPOPMIN), c.zpop(true), RangeArgs(1, 2), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("sortedset"), WithSummary("Returns the lowest-scoring members from a sorted set after removing them. Deletes the sorted set if the last member was popped."))
+	s.RegisterCommandFunc(string(ZPOPMAX), c.zpop(false), RangeArgs(1, 2), WithKeys(1, 1, 1), WithFlags(CmdWrite|CmdFast), WithCategories("sortedset"), WithSummary("Returns the highest-scoring members from a sorted set after removing them. Deletes the sorted set if the last member was popped."))
+	s.RegisterCommandFunc(string(ZMPOP), c.zmpop, MinArgs(3), WithKeysFunc(NumKeysAt(1)), WithFlags(CmdWrite), WithCategories("sortedset"), WithSummary("Returns the highest- or lowest-scoring members from one or more sorted sets after removing them. Deletes the sorted set if the last member was popped."))
+	s.RegisterCommandFunc(string(BZPOPMIN), c.bzpop(true), MinArgs(2), WithKeys(1, -2, 1), WithFlags(CmdWrite|CmdFast|CmdBlocking), WithCategories("sortedset"), WithSummary("Removes and returns the member with the lowest score from one or more sorted sets. Blocks until a member is available otherwise. Deletes the sorted set if the last element was popped."))
+	s.RegisterCommandFunc(string(BZPOPMAX), c.bzpop(false), MinArgs(2), WithKeys(1, -2, 1), WithFlags(CmdWrite|CmdFast|CmdBlocking), WithCategories("sortedset"), WithSummary("Removes and returns the member with the highest score from one or more sorted sets. Blocks until a member available otherwise.  Deletes the sorted set if the last element was popped."))
+	s.RegisterCommandFunc(string(BZMPOP), c.bzmpop, MinArgs(4), WithKeysFunc(NumKeysAt(2)), WithFlags(CmdWrite|CmdBlocking), WithCategories("sortedset"), WithSummary("Removes and returns a member by score from one or more sorted sets. Blocks until a member is available otherwise. Deletes the sorted set if the last element was popped."))
+
+	s.RegisterCommandFunc(string(ZUNION), c.zcombine(zunion, true), MinArgs(2), WithKeysFunc(NumKeysAt(1)), WithFlags(CmdReadOnly), WithCategories("sortedset"), WithSummary("Returns the union of multiple sorted sets."))
+	s.RegisterCommandFunc(string(ZINTER), c.zcombine(zinter, true), MinArgs(2), WithKeysFunc(NumKeysAt(1)), WithFlags(CmdReadOnly), WithCategories("sortedset"), WithSummary("Returns the intersect of multiple sorted sets."))
+	s.RegisterCommandFunc(string(ZDIFF), c.zcombine(zdiff, false), MinArgs(2), WithKeysFunc(NumKeysAt(1)), WithFlags(CmdReadOnly), WithCategories("sortedset"), WithSummary("Returns the difference between multiple sorted sets."))
+	s.RegisterCommandFunc(string(ZUNIONSTORE), c.zcombineStore(zunion, true), MinArgs(3), WithKeysFunc(destinationAndNumKeys), WithFlags(CmdWrite), WithCategories("sortedset"), WithSummary("Stores the union of multiple sorted sets in a key."))
+	s.RegisterCommandFunc(string(ZINTERSTORE), c.zcombineStore(zinter, true), MinArgs(3), WithKeysFunc(destinationAndNumKeys), WithFlags(CmdWrite), WithCategories("sortedset"), WithSummary("Stores the intersect of multiple sorted sets in a key."))
+	s.RegisterCommandFunc(string(ZDIFFSTORE), c.zcombineStore(zdiff, false), MinArgs(3), WithKeysFunc(destinationAndNumKeys), WithFlags(CmdWrite), WithCategories("sortedset"), WithSummary("Stores the difference of multiple sorted sets in a key."))
+	s.RegisterCommandFunc(string(ZINTERCARD), c.zintercard, MinArgs(2), WithKeysFunc(NumKeysAt(1)), WithFlags(CmdReadOnly), WithCategories("sortedset"), WithSummary("Returns the number of members of the intersect of multiple sorted sets."))
+}
+
+// destinationAndNumKeys returns the keys of commands such as ZUNIONSTORE
+// destination numkeys key [key ...]
+func destinationAndNumKeys(cmd *Command) []string {
+	if len(cmd.Args) == 0 {
+		return nil
+	}
+	return append([]string{cmd.Args[0]}, NumKeysAt(2)(cmd)...)
+}
+
+// zsetEntry is a member of a sorted set and its score
+type zsetEntry struct {
+	member string
+	score  float64
+}
+
+// scoreValue returns score as a double reply, a bulk string under RESP2
+func scoreValue(score float64) RedisValue {
+	return RedisValue{Type: Double, Float: score}
+}
+
+// entriesReply returns the members of entries, each followed by its score
+// if withScores: in pairs under RESP3 and flat under RESP2
+func entriesReply(conn *Connection, entries []zsetEntry, withScores bool) RedisValue {
+	resp3 := conn != nil && conn.Protocol() >= RESP3
+	reply := make([]RedisValue, 0, len(entries))
+	for _, e := range entries {
+		switch {
+		case !withScores:
+			reply = append(reply, bulkOf(e.member))
+		case resp3:
+			reply = append(reply, pairReply(e))
+		default:
+			reply = append(reply, bulkOf(e.member), scoreValue(e.score))
+		}
+	}
+	return RedisValue{Type: Array, Array: reply}
+}
+
+// pairReply returns the member and score of e as a two-element array
+func pairReply(e zsetEntry) RedisValue {
+	return RedisValue{Type: Array, Array: []RedisValue{bulkOf(e.member), scoreValue(e.score)}}
+}
+
+// errNotFloat is the reply to a score or weight that doesn't parse
+var errNotFloat = NewError(ErrPrefixGeneric, "value is not a valid float")
+
+// parseScore parses a score, accepting inf and -inf but not NaN
+func parseScore(arg string) (float64, error) {
+	f, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, errNotFloat
+	}
+	return f, nil
+}
+
+// parseScoreBound parses an end of a score range such as 1.5, (1.5 or -inf
+func parseScoreBound(arg string) (store.ScoreBound, error) {
+	var b store.ScoreBound
+	if strings.HasPrefix(arg, "(") {
+		b.Exclusive, arg = true, arg[1:]
+	}
+	f, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(f) {
+		return b, NewError(ErrPrefixGeneric, "min or max is not a float")
+	}
+	b.Score = f
+	return b, nil
+}
+
+// parseLexBound parses an end of a member range such as [a, (a, - or +
+func parseLexBound(arg string) (store.LexBound, error) {
+	switch {
+	case arg == "-":
+		return store.LexBound{Inf: -1}, nil
+	case arg == "+":
+		return store.LexBound{Inf: 1}, nil
+	case strings.HasPrefix(arg, "["):
+		return store.LexBound{Member: arg[1:]}, nil
+	case strings.HasPrefix(arg, "("):
+		return store.LexBound{Member: arg[1:], Exclusive: true}, nil
+	}
+	return store.LexBound{}, NewError(ErrPrefixGeneric, "min or max not valid string range item")
+}
+
+// zrangeArgs selects members of a sorted set by rank, score or member, as
+// ZRANGE start stop [BYSCORE | BYLEX] [REV] [LIMIT offset count] does
+type zrangeArgs struct {
+	by         string // "", BYSCORE or BYLEX
+	start      int64  // ranks, without by
+	stop       int64
+	minScore   store.ScoreBound
+	maxScore   store.ScoreBound
+	minLex     store.LexBound
+	maxLex     store.LexBound
+	reverse    bool
+	offset     int64
+	count      int64 // -1 without LIMIT
+	withScores bool
+}
+
+// parseZRange parses start stop [BYSCORE | BYLEX] [REV] [LIMIT offset count]
+// [WITHSCORES]
+func parseZRange(arguments []string) (zrangeArgs, error) {
+	r := zrangeArgs{count: -1}
+	limited := false
+	p := args.New(arguments[2:])
+	for p.More() {
+		switch {
+		case p.MatchFlag("BYSCORE"):
+			r.by = "BYSCORE"
+		case p.MatchFlag("BYLEX"):
+			r.by = "BYLEX"
+		case p.MatchFlag("REV"):
+			r.reverse = true
+		case p.MatchFlag("LIMIT"):
+			r.offset, r.count, limited = p.NextInt(), p.NextInt(), true
+		case p.MatchFlag("WITHSCORES"):
+			r.withScores = true
+		default:
+			p.Fail(args.ErrSyntax)
+		}
+	}
+	if err := p.Err(); err != nil {
+		return r, err
+	}
+	if limited && r.by == "" {
+		return r, NewError(ErrPrefixGeneric, "syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+	if r.withScores && r.by == "BYLEX" {
+		return r, NewError(ErrPrefixGeneric, "syntax error, WITHSCORES not supported in combination with BYLEX")
+	}
+
+	// Scores and members are given from max to min in reverse
+	first, second := arguments[0], arguments[1]
+	if r.reverse && r.by != "" {
+		first, second = second, first
+	}
+	var err error
+	switch r.by {
+	case "BYSCORE":
+		if r.minScore, err = parseScoreBound(first); err == nil {
+			r.maxScore, err = parseScoreBound(second)
+		}
+	case "BYLEX":
+		if r.minLex, err = parseLexBound(first); err == nil {
+			r.maxLex, err = parseLexBound(second)
+		}
+	default:
+		p := args.New(arguments[:2])
+		r.start, r.stop = p.NextInt(), p.NextInt()
+		err = p.Err()
+	}
+	return r, err
+}
+
+// span returns the ranks in z of the first and last members r selects;
+// start is greater than stop if there are none
+func (r *zrangeArgs) span(z *store.ZSet) (start, stop int) {
+	switch r.by {
+	case "BYSCORE":
+		return z.ScoreSpan(r.minScore, r.maxScore)
+	case "BYLEX":
+		return z.LexSpan(r.minLex, r.maxLex)
+	}
+	n := z.Len()
+	start, stop, ok := store.NormalizeRange(int(r.start), int(r.stop), n)
+	if !ok {
+		return 0, -1
+	}
+	// Ranks count from the highest score in reverse
+	if r.reverse {
+		start, stop = n-1-stop, n-1-start
+	}
+	return start, stop
+}
+
+// collect returns the members r selects from z in the order it returns them
+func (r *zrangeArgs) collect(z *store.ZSet) []zsetEntry {
+	start, stop := r.span(z)
+	if start > stop {
+		return nil
+	}
+	if r.count >= 0 || r.offset != 0 {
+		// LIMIT counts in the order the members are returned
+		if r.offset < 0 || r.offset > int64(stop-start) {
+			return nil
+		}
+		if r.reverse {
+			stop -= int(r.offset)
+			if r.count >= 0 && r.count <= int64(stop-start) {
+				start = stop - int(r.count) + 1
+			}
+		} else {
+			start += int(r.offset)
+			if r.count >= 0 && r.count <= int64(stop-start) {
+				stop = start + int(r.count) - 1
+			}
+		}
+	}
+	var entries []zsetEntry
+	z.Range(start, stop, r.reverse, func(member string, score float64) bool {
+		entries = append(entries, zsetEntry{member, score})
+		return true
+	})
+	return entries
+}
+
+// zadd implements ZADD key [NX | XX] [GT | LT] [CH] [INCR] score member
+// [score member ...]
+func (c *storeCommands) zadd(conn *Connection, cmd *Command) RedisValue {
+	var nx, xx, gt, lt, ch, incr bool
+	p := args.New(cmd.Args[1:])
+options:
+	for p.More() {
+		switch {
+		case p.MatchFlag("NX"):
+			nx = true
+		case p.MatchFlag("XX"):
+			xx = true
+		case p.MatchFlag("GT"):
+			gt = true
+		case p.MatchFlag("LT"):
+			lt = true
+		case p.MatchFlag("CH"):
+			ch = true
+		case p.MatchFlag("INCR"):
+			incr = true
+		default:
+			break options
+		}
+	}
+	pairs := p.Rest()
+	switch {
+	case len(pairs) == 0 || len(pairs)%2 != 0:
+		return ErrorValue(args.ErrSyntax)
+	case nx && xx:
+		return NewError(ErrPrefixGeneric, "XX and NX options at the same time are not compatible").Value()
+	case (gt && lt) || (nx && (gt || lt)):
+		return NewError(ErrPrefixGeneric, "GT, LT, and/or NX options at the same time are not compatible").Value()
+	case incr && len(pairs) > 2:
+		return NewError(ErrPrefixGeneric, "INCR option supports a single increment-element pair").Value()
+	}
+	scores := make([]float64, len(pairs)/2)
+	for i := range scores {
+		var err error
+		if scores[i], err = parseScore(pairs[2*i]); err != nil {
+			return ErrorValue(err)
+		}
+	}
+
+	added, changed := 0, 0
+	var result float64
+	updated := false
+	err := c.db(conn).zsets.UpdateZSet(cmd.Args[0], func(z *store.ZSet) error {
+		for i, score := range scores {
+			member := pairs[2*i+1]
+			old, exists := z.Score(member)
+			if (nx && exists) || (xx && !exists) {
+				continue
+			}
+			if incr && exists {
+				if score += old; math.IsNaN(score) {
+					return NewError(ErrPrefixGeneric, "resulting score is not a number (NaN)")
+				}
+			}
+			if exists && ((gt && score <= old) || (lt && score >= old)) {
+				continue
+			}
+			result, updated = score, true
+			if z.Add(member, score) {
+				added++
+				changed++
+			} else if score != old {
+				changed++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	if changed > 0 {
+		c.server.elementsAdded(conn, cmd.Args[0])
+	}
+	if incr {
+		if !updated {
+			return RedisValue{Type: Null}
+		}
+		return scoreValue(result)
+	}
+	if ch {
+		return RedisValue{Type: Integer, Int: int64(changed)}
+	}
+	return RedisValue{Type: Integer, Int: int64(added)}
+}
+
+// zincrby implements ZINCRBY key increment member
+func (c *storeCommands) zincrby(conn *Connection, cmd *Command) RedisValue {
+	delta, err := parseScore(cmd.Args[1])
+	if err != nil {
+		return ErrorValue(err)
+	}
+	var score float64
+	err = c.db(conn).zsets.UpdateZSet(cmd.Args[0], func(z *store.ZSet) error {
+		old, _ := z.Score(cmd.Args[2])
+		if score = old + delta; math.IsNaN(score) {
+			return NewError(ErrPrefixGeneric, "resulting score is not a number (NaN)")
+		}
+		z.Add(cmd.Args[2], score)
+		return nil
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.elementsAdded(conn, cmd.Args[0])
+	return scoreValue(score)
+}
+
+// zrem implements ZREM key member [member ...]
+func (c *storeCommands) zrem(conn *Connection, cmd *Command) RedisValue {
+	removed := 0
+	err := c.db(conn).zsets.UpdateZSet(cmd.Args[0], func(z *store.ZSet) error {
+		for _, member := range cmd.Args[1:] {
+			if z.Remove(member) {
+				removed++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	if removed > 0 {
+		c.server.KeysWritten(conn, cmd.Args[0])
+	}
+	return RedisValue{Type: Integer, Int: int64(removed)}
+}
+
+// scoreOrNull returns the score of member in z, or null if it is missing
+func scoreOrNull(z *store.ZSet, member string) RedisValue {
+	score, ok := z.Score(member)
+	if !ok {
+		return RedisValue{Type: Null}
+	}
+	return scoreValue(score)
+}
+
+// zscore implements ZSCORE key member
+func (c *storeCommands) zscore(conn *Connection, cmd *Command) RedisValue {
+	var reply RedisValue
+	err := c.db(conn).zsets.ViewZSet(cmd.Args[0], func(z *store.ZSet) {
+		reply = scoreOrNull(z, cmd.Args[1])
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysRead(conn, cmd.Args[0])
+	return reply
+}
+
+// zmscore implements ZMSCORE key member [member ...]
+func (c *storeCommands) zmscore(conn *Connection, cmd *Command) RedisValue {
+	members := cmd.Args[1:]
+	reply := make([]RedisValue, len(members))
+	err := c.db(conn).zsets.ViewZSet(cmd.Args[0], func(z *store.ZSet) {
+		for i, member := range members {
+			reply[i] = scoreOrNull(z, member)
+		}
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysRead(conn, cmd.Args[0])
+	return RedisValue{Type: Array, Array: reply}
+}
+
+// zcard implements ZCARD key
+func (c *storeCommands) zcard(conn *Connection, cmd *Command) RedisValue {
+	n := 0
+	err := c.db(conn).zsets.ViewZSet(cmd.Args[0], func(z *store.ZSet) {
+		n = z.Len()
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysRead(conn, cmd.Args[0])
+	return RedisValue{Type: Integer, Int: int64(n)}
+}
+
+// zcountBy serves ZCOUNT and ZLEXCOUNT with the span of r in the sorted set
+// held by key
+func (c *storeCommands) zcountBy(conn *Connection, key string, r *zrangeArgs) RedisValue {
+	n := 0
+	err := c.db(conn).zsets.ViewZSet(key, func(z *store.ZSet) {
+		start, stop := r.span(z)
+		n = max(stop-start+1, 0)
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysRead(conn, key)
+	return RedisValue{Type: Integer, Int: int64(n)}
+}
+
+// zcount implements ZCOUNT key min max
+func (c *storeCommands) zcount(conn *Connection, cmd *Command) RedisValue {
+	r, err := parseZRange([]string{cmd.Args[1], cmd.Args[2], "BYSCORE"})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	return c.zcountBy(conn, cmd.Args[0], &r)
+}
+
+// zlexcount implements ZLEXCOUNT key min max
+func (c *storeCommands) zlexcount(conn *Connection, cmd *Command) RedisValue {
+	r, err := parseZRange([]string{cmd.Args[1], cmd.Args[2], "BYLEX"})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	return c.zcountBy(conn, cmd.Args[0], &r)
+}
+
+// zrank implements ZRANK and ZREVRANK key member [WITHSCORE]
+func (c *storeCommands) zrank(reverse bool) func(*Connection, *Command) RedisValue {
+	return func(conn *Connection, cmd *Command) RedisValue {
+		withScore := false
+		if len(cmd.Args) == 3 {
+			if !strings.EqualFold(cmd.Args[2], "WITHSCORE") {
+				return ErrorValue(args.ErrSyntax)
+			}
+			withScore = true
+		}
+		var rank int
+		var score float64
+		var ok bool
+		err := c.db(conn).zsets.ViewZSet(cmd.Args[0], func(z *store.ZSet) {
+			if rank, ok = z.Rank(cmd.Args[1]); ok {
+				score, _ = z.Score(cmd.Args[1])
+				if reverse {
+					rank = z.Len() - 1 - rank
+				}
+			}
+		})
+		if err != nil {
+			return ErrorValue(err)
+		}
+		c.server.KeysRead(conn, cmd.Args[0])
+		switch {
+		case !ok && withScore:
+			return RedisValue{Type: NullArray}
+		case !ok:
+			return RedisValue{Type: Null}
+		case withScore:
+			return RedisValue{Type: Array, Array: []RedisValue{{Type: Integer, Int: int64(rank)}, scoreValue(score)}}
+		}
+		return RedisValue{Type: Integer, Int: int64(rank)}
+	}
+}
+
+// zrandmember implements ZRANDMEMBER key [count [WITHSCORES]]
+func (c *storeCommands) zrandmember(conn *Connection, cmd *Command) RedisValue {
+	if len(cmd.Args) == 1 {
+		var member string
+		var ok bool
+		err := c.db(conn).zsets.ViewZSet(cmd.Args[0], func(z *store.ZSet) {
+			member, _, ok = z.Random()
+		})
+		if err != nil {
+			return ErrorValue(err)
+		}
+		return bulkOrNull([]byte(member), ok)
+	}
+
+	p := args.New(cmd.Args[1:])
+	count := p.NextInt()
+	withScores := p.More() && p.MatchFlag("WITHSCORES")
+	if err := p.Done(); err != nil {
+		return ErrorValue(err)
+	}
+	if count < -math.MaxInt64/2 || count > math.MaxInt64/2 {
+		return NewError(ErrPrefixGeneric, "value is out of range").Value()
+	}
+	var picks []zsetEntry
+	err := c.db(conn).zsets.ViewZSet(cmd.Args[0], func(z *store.ZSet) {
+		random := func() zsetEntry {
+			member, score, _ := z.Random()
+			return zsetEntry{member, score}
+		}
+		all := func() []zsetEntry {
+			return (&zrangeArgs{stop: -1, count: -1}).collect(z)
+		}
+		picks = randomPicks(int64(z.Len()), count, random, all, func(e zsetEntry) string { return e.member })
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	return entriesReply(conn, picks, withScores)
+}
+
+// zscan implements ZSCAN key cursor [MATCH pattern] [COUNT count] [NOSCORES]
+func (c *storeCommands) zscan(conn *Connection, cmd *Command) RedisValue {
+	noScores := false
+	scan, err := parseScan(cmd.Args[1:], func(p *args.Parser) bool {
+		if p.MatchFlag("NOSCORES") {
+			noScores = true
+			return true
+		}
+		return false
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+
+	var items []RedisValue
+	var next uint64
+	err = c.db(conn).zsets.ViewZSet(cmd.Args[0], func(z *store.ZSet) {
+		var members []string
+		members, next = z.Scan(scan.cursor, scan.match, scan.count)
+		for _, member := range members {
+			items = append(items, bulkOf(member))
+			if !noScores {
+				score, _ := z.Score(member)
+				items = append(items, scoreValue(score))
+			}
+		}
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	return scanReply(next, items)
+}
+
+// zrange implements ZRANGE key start stop [BYSCORE | BYLEX] [REV] [LIMIT
+// offset count] [WITHSCORES], and its older forms such as ZRANGEBYSCORE,
+// which are ZRANGE with by and REV implied
+func (c *storeCommands) zrange(by string, reverse bool) func(*Connection, *Command) RedisValue {
+	return func(conn *Connection, cmd *Command) RedisValue {
+		arguments := cmd.Args[1:]
+		if by != "" || reverse {
+			arguments = append([]string(nil), arguments...)
+			if by != "" {
+				arguments = append(arguments, by)
+			}
+			if reverse {
+				arguments = append(arguments, "REV")
+			}
+		}
+		r, err := parseZRange(arguments)
+		if err != nil {
+			return ErrorValue(err)
+		}
+		var entries []zsetEntry
+		err = c.db(conn).zsets.ViewZSet(cmd.Args[0], func(z *store.ZSet) {
+			entries = r.collect(z)
+		})
+		if err != nil {
+			return ErrorValue(err)
+		}
+		c.server.KeysRead(conn, cmd.Args[0])
+		return entriesReply(conn, entries, r.withScores)
+	}
+}
+
+// zrangestore implements ZRANGESTORE dst src min max [BYSCORE | BYLEX] [REV]
+// [LIMIT offset count]
+func (c *storeCommands) zrangestore(conn *Connection, cmd *Command) RedisValue {
+	r, err := parseZRange(cmd.Args[2:])
+	if err == nil && r.withScores {
+		err = args.ErrSyntax
+	}
+	if err != nil {
+		return ErrorValue(err)
+	}
+	n := 0
+	err = c.db(conn).zsets.StoreZSet(cmd.Args[0], cmd.Args[1:2], func(zsets []*store.ZSet) *store.ZSet {
+		result := store.NewZSet()
+		for _, e := range r.collect(zsets[0]) {
+			result.Add(e.member, e.score)
+		}
+		n = result.Len()
+		return result
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysRead(conn, cmd.Args[1])
+	c.server.elementsAdded(conn, cmd.Args[0])
+	return RedisValue{Type: Integer, Int: int64(n)}
+}
+
+// zremrange implements ZREMRANGEBYRANK, ZREMRANGEBYSCORE and ZREMRANGEBYLEX
+// key min max, removing what ZRANGE with by selects
+func (c *storeCommands) zremrange(by string) func(*Connection, *Command) RedisValue {
+	return func(conn *Connection, cmd *Command) RedisValue {
+		arguments := cmd.Args[1:]
+		if by != "" {
+			arguments = []string{cmd.Args[1], cmd.Args[2], by}
+		}
+		r, err := parseZRange(arguments)
+		if err != nil {
+			return ErrorValue(err)
+		}
+		removed := 0
+		err = c.db(conn).zsets.UpdateZSet(cmd.Args[0], func(z *store.ZSet) error {
+			start, stop := r.span(z)
+			removed = z.RemoveRange(start, stop)
+			return nil
+		})
+		if err != nil {
+			return ErrorValue(err)
+		}
+		if removed > 0 {
+			c.server.KeysWritten(conn, cmd.Args[0])
+		}
+		return RedisValue{Type: Integer, Int: int64(removed)}
+	}
+}
+
+// zpopN removes up to count members with the lowest scores, or the highest
+// unless min, from the sorted set held by key
+func (c *storeCommands) zpopN(conn *Connection, key string, min bool, count int) ([]zsetEntry, error) {
+	var entries []zsetEntry
+	err := c.db(conn).zsets.UpdateZSet(key, func(z *store.ZSet) error {
+		r := zrangeArgs{stop: int64(count) - 1, reverse: !min, count: -1}
+		entries = r.collect(z)
+		for _, e := range entries {
+			z.Remove(e.member)
+		}
+		return nil
+	})
+	if len(entries) > 0 {
+		c.server.KeysWritten(conn, key)
+	}
+	return entries, err
+}
+
+// zpop implements ZPOPMIN and ZPOPMAX key [count]
+func (c *storeCommands) zpop(min bool) func(*Connection, *Command) RedisValue {
+	return func(conn *Connection, cmd *Command) RedisValue {
+		count := int64(1)
+		if len(cmd.Args) == 2 {
+			var err error
+			count, err = strconv.ParseInt(cmd.Args[1], 10, 64)
+			if err != nil || count < 0 {
+				return NewError(ErrPrefixGeneric, "value is out of range, must be positive").Value()
+			}
+		}
+		entries, err := c.zpopN(conn, cmd.Args[0], min, int(count))
+		if err != nil {
+			return ErrorValue(err)
+		}
+		// Without a count the member and score come flat under RESP3 too
+		if len(cmd.Args) == 1 && len(entries) == 1 {
+			return pairReply(entries[0])
+		}
+		return entriesReply(conn, entries, true)
+	}
+}
+
+// zmpopKey pops per mpop from the sorted set held by key, returning false
+// if it is empty
+func (c *storeCommands) zmpopKey(conn *Connection, key string, mpop mpopArgs) (RedisValue, bool) {
+	entries, err := c.zpopN(conn, key, mpop.front, mpop.count)
+	if err != nil {
+		return ErrorValue(err), true
+	}
+	if len(entries) == 0 {
+		return RedisValue{}, false
+	}
+	pairs := make([]RedisValue, len(entries))
+	for i, e := range entries {
+		pairs[i] = pairReply(e)
+	}
+	return RedisValue{Type: Array, Array: []RedisValue{bulkOf(key), {Type: Array, Array: pairs}}}, true
+}
+
+// zmpop implements ZMPOP numkeys key [key ...] MIN|MAX [COUNT count]
+func (c *storeCommands) zmpop(conn *Connection, cmd *Command) RedisValue {
+	mpop, err := parseMPop(cmd.Args, "MIN", "MAX")
+	if err != nil {
+		return ErrorValue(err)
+	}
+	for _, key := range mpop.keys {
+		if reply, ok := c.zmpopKey(conn, key, mpop); ok {
+			return reply
+		}
+	}
+	return RedisValue{Type: NullArray}
+}
+
+// bzpop implements BZPOPMIN and BZPOPMAX key [key ...] timeout
+func (c *storeCommands) bzpop(min bool) func(*Connection, *Command) RedisValue {
+	return func(conn *Connection, cmd *Command) RedisValue {
+		keys := cmd.Args[:len(cmd.Args)-1]
+		timeout, err := parseTimeout(cmd.Args[len(cmd.Args)-1])
+		if err != nil {
+			return ErrorValue(err)
+		}
+		return block(conn, keys, timeout, func(key string) (RedisValue, bool) {
+			entries, err := c.zpopN(conn, key, min, 1)
+			if err != nil {
+				return ErrorValue(err), true
+			}
+			if len(entries) == 0 {
+				return RedisValue{}, false
+			}
+			return RedisValue{Type: Array, Array: []RedisValue{bulkOf(key), bulkOf(entries[0].member), scoreValue(entries[0].score)}}, true
+		})
+	}
+}
+
+// bzmpop implements BZMPOP timeout numkeys key [key ...] MIN|MAX [COUNT count]
+func (c *storeCommands) bzmpop(conn *Connection, cmd *Command) RedisValue {
+	timeout, err := parseTimeout(cmd.Args[0])
+	if err != nil {
+		return ErrorValue(err)
+	}
+	mpop, err := parseMPop(cmd.Args[1:], "MIN", "MAX")
+	if err != nil {
+		return ErrorValue(err)
+	}
+	return block(conn, mpop.keys, timeout, func(key string) (RedisValue, bool) {
+		return c.zmpopKey(conn, key, mpop)
+	})
+}
+
+// zcombineArgs are the arguments of ZUNION, ZINTER, ZDIFF and their STORE
+// forms following the destination
+type zcombineArgs struct {
+	keys       []string
+	weights    []float64
+	aggregate  store.Aggregate
+	withScores bool
+}
+
+// zcombineOp combines sorted sets per the arguments
+type zcombineOp func(zsets []*store.ZSet, a *zcombineArgs) *store.ZSet
+
+func zunion(zsets []*store.ZSet, a *zcombineArgs) *store.ZSet {
+	return store.ZUnion(zsets, a.weights, a.aggregate)
+}
+
+func zinter(zsets []*store.ZSet, a *zcombineArgs) *store.ZSet {
+	return store.ZInter(zsets, a.weights, a.aggregate)
+}
+
+func zdiff(zsets []*store.ZSet, _ *zcombineArgs) *store.ZSet {
+	return store.ZDiff(zsets)
+}
+
+// parseZCombine parses numkeys key [key ...] followed by [WEIGHTS weight
+// [weight ...]] [AGGREGATE SUM | MIN | MAX] if weighted, and by
+// [WITHSCORES] if withScores
+func parseZCombine(cmd *Command, arguments []string, weighted, withScores bool) (zcombineArgs, error) {
+	var a zcombineArgs
+	p := args.New(arguments)
+	a.keys = nextNumKeys(p, NewError(ErrPrefixGeneric, "at least 1 input key is needed for '%s' command", strings.ToLower(cmd.Name)), args.ErrSyntax)
+	for p.More() {
+		switch {
+		case weighted && p.MatchFlag("WEIGHTS"):
+			a.weights = make([]float64, len(a.keys))
+			for i := range a.weights {
+				w, err := strconv.ParseFloat(p.NextString(), 64)
+				if p.Err() == nil && (err != nil || math.IsNaN(w)) {
+					p.Fail(NewError(ErrPrefixGeneric, "weight value is not a float"))
+				}
+				a.weights[i] = w
+			}
+		case weighted && p.MatchFlag("AGGREGATE"):
+			switch p.NextKeyword("SUM", "MIN", "MAX") {
+			case "MIN":
+				a.aggregate = store.AggregateMin
+			case "MAX":
+				a.aggregate = store.AggregateMax
+			default:
+				a.aggregate = store.AggregateSum
+			}
+		case withScores && p.MatchFlag("WITHSCORES"):
+			a.withScores = true
+		default:
+			p.Fail(args.ErrSyntax)
+		}
+	}
+	return a, p.Err()
+}
+
+// zcombine implements ZUNION, ZINTER and ZDIFF numkeys key [key ...] with
+// their options
+func (c *storeCommands) zcombine(op zcombineOp, weighted bool) func(*Connection, *Command) RedisValue {
+	return func(conn *Connection, cmd *Command) RedisValue {
+		a, err := parseZCombine(cmd, cmd.Args, weighted, true)
+		if err != nil {
+			return ErrorValue(err)
+		}
+		var entries []zsetEntry
+		err = c.db(conn).zsets.ViewZSets(a.keys, func(zsets []*store.ZSet) {
+			entries = (&zrangeArgs{stop: -1, count: -1}).collect(op(zsets, &a))
+		})
+		if err != nil {
+			return ErrorValue(err)
+		}
+		c.server.KeysRead(conn, a.keys...)
+		return entriesReply(conn, entries, a.withScores)
+	}
+}
+
+// zcombineStore implements ZUNIONSTORE, ZINTERSTORE and ZDIFFSTORE
+// destination numkeys key [key ...] with their options
+func (c *storeCommands) zcombineStore(op zcombineOp, weighted bool) func(*Connection, *Command) RedisValue {
+	return func(conn *Connection, cmd *Command) RedisValue {
+		a, err := parseZCombine(cmd, cmd.Args[1:], weighted, false)
+		if err != nil {
+			return ErrorValue(err)
+		}
+		n := 0
+		err = c.db(conn).zsets.StoreZSet(cmd.Args[0], a.keys, func(zsets []*store.ZSet) *store.ZSet {
+			result := op(zsets, &a)
+			n = result.Len()
+			return result
+		})
+		if err != nil {
+			return ErrorValue(err)
+		}
+		c.server.KeysRead(conn, a.keys...)
+		c.server.elementsAdded(conn, cmd.Args[0])
+		return RedisValue{Type: Integer, Int: int64(n)}
+	}
+}
+
+// zintercard implements ZINTERCARD numkeys key [key ...] [LIMIT limit]
+func (c *storeCommands) zintercard(conn *Connection, cmd *Command) RedisValue {
+	keys, limit, err := parseInterCard(cmd.Args)
+	if err != nil {
+		return ErrorValue(err)
+	}
+	card := 0
+	err = c.db(conn).zsets.ViewZSets(keys, func(zsets []*store.ZSet) {
+		card = store.ZInterCard(zsets, limit)
+	})
+	if err != nil {
+		return ErrorValue(err)
+	}
+	c.server.KeysRead(conn, keys...)
+	return RedisValue{Type: Integer, Int: int64(card)}
+}
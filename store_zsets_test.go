@@ -0,0 +1,153 @@
+package redkit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TestBuiltinStoreZSets tests the sorted set commands over the wire
+func TestBuiltinStoreZSets(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	server.EnableBuiltinStore()
+	client := dialRaw(t, address)
+
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"ZADD", "z", "1", "a", "2", "b", "3", "c"}, []string{":3"}},
+		{[]string{"ZADD", "z", "NX", "9", "a", "4", "d"}, []string{":1"}},
+		{[]string{"ZADD", "z", "XX", "CH", "1.5", "a", "9", "e"}, []string{":1"}},
+		{[]string{"ZADD", "z", "GT", "CH", "1", "a", "5", "b"}, []string{":1"}},
+		{[]string{"ZADD", "z", "INCR", "1", "a"}, []string{"$3", "2.5"}},
+		{[]string{"ZADD", "z", "LT", "INCR", "1", "a"}, []string{"$-1"}},
+		{[]string{"ZADD", "z", "NX", "XX", "1", "a"}, []string{"-ERR XX and NX options at the same time are not compatible"}},
+		{[]string{"ZADD", "z", "GT", "LT", "1", "a"}, []string{"-ERR GT, LT, and/or NX options at the same time are not compatible"}},
+		{[]string{"ZADD", "z", "INCR", "1", "a", "2", "b"}, []string{"-ERR INCR option supports a single increment-element pair"}},
+		{[]string{"ZADD", "z", "x", "a"}, []string{"-ERR value is not a valid float"}},
+		{[]string{"ZADD", "z", "1", "a", "2"}, []string{"-ERR syntax error"}},
+		// z is now a:2.5 c:3 d:4 b:5
+		{[]string{"ZRANGE", "z", "0", "-1", "WITHSCORES"}, []string{"*8", "$1", "a", "$3", "2.5", "$1", "c", "$1", "3", "$1", "d", "$1", "4", "$1", "b", "$1", "5"}},
+		{[]string{"ZRANGE", "z", "0", "1", "REV"}, []string{"*2", "$1", "b", "$1", "d"}},
+		{[]string{"ZRANGE", "z", "(2.5", "+inf", "BYSCORE", "LIMIT", "1", "2"}, []string{"*2", "$1", "d", "$1", "b"}},
+		{[]string{"ZRANGE", "z", "4", "-inf", "BYSCORE", "REV", "LIMIT", "1", "-1"}, []string{"*2", "$1", "c", "$1", "a"}},
+		{[]string{"ZRANGE", "z", "0", "1", "LIMIT", "0", "1"}, []string{"-ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX"}},
+		{[]string{"ZRANGE", "z", "x", "1", "BYSCORE"}, []string{"-ERR min or max is not a float"}},
+		{[]string{"ZRANGEBYSCORE", "z", "3", "4"}, []string{"*2", "$1", "c", "$1", "d"}},
+		{[]string{"ZREVRANGEBYSCORE", "z", "4", "3"}, []string{"*2", "$1", "d", "$1", "c"}},
+		{[]string{"ZREVRANGE", "z", "0", "0"}, []string{"*1", "$1", "b"}},
+		{[]string{"ZCOUNT", "z", "(2.5", "4"}, []string{":2"}},
+		{[]string{"ZSCORE", "z", "d"}, []string{"$1", "4"}},
+		{[]string{"ZMSCORE", "z", "a", "missing"}, []string{"*2", "$3", "2.5", "$-1"}},
+		{[]string{"ZRANK", "z", "d"}, []string{":2"}},
+		{[]string{"ZREVRANK", "z", "d", "WITHSCORE"}, []string{"*2", ":1", "$1", "4"}},
+		{[]string{"ZRANK", "z", "missing"}, []string{"$-1"}},
+		{[]string{"ZINCRBY", "z", "-4", "b"}, []string{"$1", "1"}},
+		{[]string{"ZCARD", "z"}, []string{":4"}},
+		{[]string{"ZRANGESTORE", "dst", "z", "0", "1"}, []string{":2"}},
+		{[]string{"ZRANGE", "dst", "0", "-1"}, []string{"*2", "$1", "b", "$1", "a"}},
+		{[]string{"ZPOPMIN", "z"}, []string{"*2", "$1", "b", "$1", "1"}},
+		{[]string{"ZPOPMAX", "z", "2"}, []string{"*4", "$1", "d", "$1", "4", "$1", "c", "$1", "3"}},
+		{[]string{"ZPOPMIN", "z", "-1"}, []string{"-ERR value is out of range, must be positive"}},
+		{[]string{"ZMPOP", "2", "missing", "z", "MIN"}, []string{"*2", "$1", "z", "*1", "*2", "$1", "a", "$3", "2.5"}},
+		{[]string{"EXISTS", "z"}, []string{":0"}},
+		{[]string{"ZMPOP", "1", "z", "MAX"}, []string{"*-1"}},
+
+		{[]string{"ZADD", "l", "0", "a", "0", "b", "0", "c", "0", "d"}, []string{":4"}},
+		{[]string{"ZRANGE", "l", "[b", "+", "BYLEX"}, []string{"*3", "$1", "b", "$1", "c", "$1", "d"}},
+		{[]string{"ZRANGEBYLEX", "l", "-", "(c"}, []string{"*2", "$1", "a", "$1", "b"}},
+		{[]string{"ZREVRANGEBYLEX", "l", "+", "[c", "LIMIT", "0", "1"}, []string{"*1", "$1", "d"}},
+		{[]string{"ZLEXCOUNT", "l", "(a", "[c"}, []string{":2"}},
+		{[]string{"ZRANGE", "l", "b", "+", "BYLEX"}, []string{"-ERR min or max not valid string range item"}},
+		{[]string{"ZREMRANGEBYLEX", "l", "[a", "[b"}, []string{":2"}},
+		{[]string{"ZREMRANGEBYRANK", "l", "-1", "-1"}, []string{":1"}},
+		{[]string{"ZREMRANGEBYSCORE", "l", "-inf", "+inf"}, []string{":1"}},
+		{[]string{"EXISTS", "l"}, []string{":0"}},
+
+		{[]string{"ZADD", "x", "1", "a", "2", "b"}, []string{":2"}},
+		{[]string{"ZADD", "y", "10", "b", "20", "c"}, []string{":2"}},
+		{[]string{"ZUNION", "2", "x", "y", "WITHSCORES"}, []string{"*6", "$1", "a", "$1", "1", "$1", "b", "$2", "12", "$1", "c", "$2", "20"}},
+		{[]string{"ZINTER", "2", "x", "y", "WEIGHTS", "2", "1", "AGGREGATE", "MAX", "WITHSCORES"}, []string{"*2", "$1", "b", "$2", "10"}},
+		{[]string{"ZDIFF", "2", "x", "y"}, []string{"*1", "$1", "a"}},
+		{[]string{"ZUNIONSTORE", "u", "2", "x", "y", "AGGREGATE", "MIN"}, []string{":3"}},
+		{[]string{"ZRANGE", "u", "0", "-1", "WITHSCORES"}, []string{"*6", "$1", "a", "$1", "1", "$1", "b", "$1", "2", "$1", "c", "$2", "20"}},
+		{[]string{"ZINTERSTORE", "u", "2", "x", "missing"}, []string{":0"}},
+		{[]string{"EXISTS", "u"}, []string{":0"}},
+		{[]string{"ZDIFFSTORE", "u", "1", "y"}, []string{":2"}},
+		{[]string{"ZINTERCARD", "2", "x", "y"}, []string{":1"}},
+		{[]string{"ZUNION", "0", "x"}, []string{"-ERR at least 1 input key is needed for 'zunion' command"}},
+		{[]string{"ZUNION", "3", "x", "y"}, []string{"-ERR syntax error"}},
+		{[]string{"ZINTER", "2", "x", "y", "WEIGHTS", "1", "w"}, []string{"-ERR weight value is not a float"}},
+		{[]string{"ZDIFF", "2", "x", "y", "WEIGHTS", "1", "1"}, []string{"-ERR syntax error"}},
+		{[]string{"ZRANDMEMBER", "x", "5", "WITHSCORES"}, []string{"*4", "$1", "a", "$1", "1", "$1", "b", "$1", "2"}},
+		{[]string{"ZSCAN", "x", "0", "MATCH", "b"}, []string{"*2", "$1", "0", "*2", "$1", "b", "$1", "2"}},
+		{[]string{"ZSCAN", "x", "0", "MATCH", "b", "NOSCORES"}, []string{"*2", "$1", "0", "*1", "$1", "b"}},
+		{[]string{"SET", "s", "v"}, []string{"+OK"}},
+		{[]string{"ZADD", "s", "1", "a"}, []string{"-WRONGTYPE Operation against a key holding the wrong kind of value"}},
+		{[]string{"ZUNIONSTORE", "s", "1", "x"}, []string{":2"}},
+		{[]string{"ZCARD", "s"}, []string{":2"}},
+	}
+	for _, tt := range tests {
+		client.send(t, tt.args...)
+		expectLines(t, client, tt.expected...)
+	}
+}
+
+// TestBuiltinStoreZSetsClient tests the sorted set commands through go-redis,
+// which speaks RESP3 and gets scores as doubles
+func TestBuiltinStoreZSetsClient(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	server.EnableBuiltinStore()
+	rdb := redis.NewClient(&redis.Options{Addr: address})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	rdb.ZAdd(ctx, "z", redis.Z{Score: 2, Member: "b"}, redis.Z{Score: 1.5, Member: "a"}, redis.Z{Score: 3, Member: "c"})
+	entries, err := rdb.ZRangeWithScores(ctx, "z", 0, -1).Result()
+	if err != nil || len(entries) != 3 || entries[0] != (redis.Z{Score: 1.5, Member: "a"}) || entries[2].Member != "c" {
+		t.Errorf("Expected a b c by score, got %v %v", entries, err)
+	}
+	members, err := rdb.ZRangeArgs(ctx, redis.ZRangeArgs{Key: "z", Start: "(1.5", Stop: "+inf", ByScore: true, Rev: true}).Result()
+	if err != nil || len(members) != 2 || members[0] != "c" {
+		t.Errorf("Expected [c b], got %v %v", members, err)
+	}
+	popped, err := rdb.ZPopMax(ctx, "z", 2).Result()
+	if err != nil || len(popped) != 2 || popped[0] != (redis.Z{Score: 3, Member: "c"}) {
+		t.Errorf("Expected c and b popped, got %v %v", popped, err)
+	}
+	if rank, err := rdb.ZRank(ctx, "z", "a").Result(); err != nil || rank != 0 {
+		t.Errorf("Expected rank 0, got %d %v", rank, err)
+	}
+}
+
+// TestBuiltinStoreBlockingZSets tests that adding members wakes a BZPOPMIN
+func TestBuiltinStoreBlockingZSets(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	server.EnableBuiltinStore()
+	blocked := dialRaw(t, address)
+	adder := dialRaw(t, address)
+
+	blocked.send(t, "BZPOPMIN", "a", "b", "0")
+	lines := readAsync(blocked, 7)
+	waitForState(t, server, StateBlocked, 1)
+	adder.send(t, "ZADD", "b", "2", "y", "1", "x")
+	adder.readLine(t)
+	for _, want := range []string{"*3", "$1", "b", "$1", "x", "$1", "1"} {
+		expectLine(t, lines, want)
+	}
+
+	rdb := redis.NewClient(&redis.Options{Addr: address})
+	defer rdb.Close()
+	ctx := context.Background()
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		rdb.ZAdd(ctx, "c", redis.Z{Score: 5, Member: "m"})
+	}()
+	key, popped, err := rdb.BZMPop(ctx, time.Second, "max", 1, "c").Result()
+	if err != nil || key != "c" || len(popped) != 1 || popped[0] != (redis.Z{Score: 5, Member: "m"}) {
+		t.Errorf("Expected c [m], got %s %v %v", key, popped, err)
+	}
+}
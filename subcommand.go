@@ -0,0 +1,146 @@
+package redkit
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RegisterSubcommand registers handler for the subcommand name of the
+// container command, such as GET of CONFIG. The container is created on first
+// use and routes calls by their first argument, ignoring case; it replies to
+// HELP with the list of subcommands and rejects unknown ones. If container is
+// already registered as a plain command, that handler keeps serving the
+// subcommands not registered separately.
+//
+// The handler gets a command named "container|name" whose Args start after the
+// subcommand, and options such as ExactArgs apply to those arguments.
+func (s *Server) RegisterSubcommand(container, name string, handler CommandHandler, opts ...CommandOption) error {
+	if container == "" || name == "" || handler == nil {
+		return fmt.Errorf("empty command name")
+	}
+	sub := &commandEntry{handler: handler}
+	for _, opt := range opts {
+		opt(sub)
+	}
+
+	key := strings.ToUpper(container)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := s.handlerTable()[key].entry
+	if entry == nil || entry.subcommands == nil {
+		router := &commandEntry{
+			arity:       &Arity{Min: 1, Max: -1},
+			subcommands: make(map[string]*commandEntry),
+		}
+		if entry != nil {
+			router.arity = entry.arity
+			router.info = entry.info
+			router.fallback = entry.handler
+		}
+		router.handler = s.subcommandRouter(key, router)
+		s.editCommands(func(t commandTable) {
+			t.set(key, router)
+		})
+		entry = router
+	}
+	entry.subcommands[strings.ToUpper(name)] = sub
+	return nil
+}
+
+// RegisterSubcommandFunc registers a function as a subcommand handler, see RegisterSubcommand
+func (s *Server) RegisterSubcommandFunc(container, name string, handler func(*Connection, *Command) RedisValue, opts ...CommandOption) error {
+	if handler == nil {
+		return fmt.Errorf("empty command name")
+	}
+	return s.RegisterSubcommand(container, name, CommandHandlerFunc(handler), opts...)
+}
+
+// subcommandRouter returns the handler dispatching the container's subcommands
+func (s *Server) subcommandRouter(container string, entry *commandEntry) CommandHandler {
+	return CommandHandlerFunc(func(conn *Connection, cmd *Command) RedisValue {
+		if len(cmd.Args) == 0 {
+			return WrongArity(cmd.Name).Value()
+		}
+
+		s.mu.RLock()
+		sub := entry.subcommands[strings.ToUpper(cmd.Args[0])]
+		fallback := entry.fallback
+		s.mu.RUnlock()
+
+		if sub == nil {
+			if fallback != nil {
+				return fallback.Handle(conn, cmd)
+			}
+			if strings.EqualFold(cmd.Args[0], "HELP") {
+				return s.subcommandHelp(container, entry)
+			}
+			return UnknownSubcommand(container, cmd.Args[0]).Value()
+		}
+
+		subCmd := subcommand(cmd)
+		if sub.disabled.Load() {
+			return commandDisabled(subCmd.Name).Value()
+		}
+		if sub.arity != nil && !sub.arity.Accepts(len(subCmd.Args)) {
+			return WrongArity(subCmd.Name).Value()
+		}
+		if conn != nil && conn.HasFlag(FlagReadOnly) && sub.info.Has(CmdWrite) {
+			return ReadOnly().Value()
+		}
+		if sub.limit != nil {
+			if err := sub.limit.acquire(subCmd); err != nil {
+				return err.Value()
+			}
+			defer sub.limit.release()
+		}
+		reply := sub.handler.Handle(conn, subCmd)
+		if sub.info.Deprecated {
+			reply = s.deprecationNotice(conn, strings.ToUpper(subCmd.Name), sub.info.ReplacedBy, reply)
+		}
+		return reply
+	})
+}
+
+// subcommand returns the command a subcommand handler gets: named
+// "container|sub" with the subcommand removed from its arguments
+func subcommand(cmd *Command) *Command {
+	sub := *cmd
+	sub.Name = cmd.Name + "|" + cmd.Args[0]
+	sub.Args = cmd.Args[1:]
+	if len(cmd.Raw) == len(cmd.Args)+1 {
+		sub.Raw = cmd.Raw[1:]
+	}
+	return &sub
+}
+
+// subcommandNames returns the container's subcommands in sorted order
+func (s *Server) subcommandNames(entry *commandEntry) []string {
+	s.mu.RLock()
+	names := make([]string, 0, len(entry.subcommands))
+	for name := range entry.subcommands {
+		names = append(names, name)
+	}
+	s.mu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// subcommandHelp generates the reply to CONTAINER HELP from the registered subcommands
+func (s *Server) subcommandHelp(container string, entry *commandEntry) RedisValue {
+	lines := []RedisValue{{Type: SimpleString, Str: container + " <subcommand> [<arg> [value] [opt] ...]. Subcommands are:"}}
+	for _, name := range s.subcommandNames(entry) {
+		s.mu.RLock()
+		summary := entry.subcommands[name].info.Summary
+		s.mu.RUnlock()
+		lines = append(lines, RedisValue{Type: SimpleString, Str: name})
+		if summary != "" {
+			lines = append(lines, RedisValue{Type: SimpleString, Str: "    " + summary})
+		}
+	}
+	lines = append(lines,
+		RedisValue{Type: SimpleString, Str: "HELP"},
+		RedisValue{Type: SimpleString, Str: "    Print this help."})
+	return RedisValue{Type: Array, Array: lines}
+}
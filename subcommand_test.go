@@ -0,0 +1,84 @@
+package redkit
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestSubcommandRouting(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	server.RegisterSubcommandFunc("CONFIG", "GET", func(conn *Connection, cmd *Command) RedisValue {
+		return RedisValue{Type: Array, Array: []RedisValue{
+			{Type: BulkString, Bulk: []byte(cmd.Args[0])},
+			{Type: BulkString, Bulk: []byte(cmd.Name)},
+		}}
+	}, ExactArgs(1), WithSummary("Returns the values of configuration parameters."))
+	server.RegisterSubcommandFunc("config", "set", func(conn *Connection, cmd *Command) RedisValue {
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	}, VariadicArgs(2, 2), WithFlags(CmdWrite|CmdAdmin))
+
+	rdb := redis.NewClient(&redis.Options{Addr: address, Protocol: 2})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	got, err := rdb.Do(ctx, "config", "get", "maxmemory").StringSlice()
+	if err != nil || len(got) != 2 || got[0] != "maxmemory" || got[1] != "config|get" {
+		t.Errorf("Expected the subcommand to get its own arguments and name, got %v, %v", got, err)
+	}
+
+	errTests := []struct {
+		args []interface{}
+		want string
+	}{
+		{[]interface{}{"CONFIG", "GET"}, "ERR wrong number of arguments for 'config|get' command"},
+		{[]interface{}{"CONFIG", "SET", "a"}, "ERR wrong number of arguments for 'config|set' command"},
+		{[]interface{}{"CONFIG", "RESETSTAT"}, "ERR unknown subcommand 'RESETSTAT'. Try CONFIG HELP."},
+		{[]interface{}{"CONFIG"}, "ERR wrong number of arguments for 'config' command"},
+	}
+	for _, tt := range errTests {
+		if err := rdb.Do(ctx, tt.args...).Err(); err == nil || err.Error() != tt.want {
+			t.Errorf("%v: expected %q, got %v", tt.args, tt.want, err)
+		}
+	}
+
+	help, err := rdb.Do(ctx, "CONFIG", "HELP").StringSlice()
+	if err != nil || !strings.HasPrefix(help[0], "CONFIG <subcommand>") || help[1] != "GET" ||
+		help[2] != "    Returns the values of configuration parameters." || help[3] != "SET" {
+		t.Errorf("Unexpected CONFIG HELP: %q, %v", help, err)
+	}
+
+	infos, err := rdb.Command(ctx).Result()
+	if err != nil {
+		t.Fatalf("COMMAND failed: %v", err)
+	}
+	if config := infos["config"]; config == nil || config.Arity != -2 {
+		t.Errorf("Expected the config container in COMMAND, got %+v", config)
+	}
+	info, err := rdb.Do(ctx, "COMMAND", "INFO", "config|set").Slice()
+	if err != nil || len(info) != 1 {
+		t.Fatalf("COMMAND INFO config|set failed: %v, %v", info, err)
+	}
+	if fields := info[0].([]interface{}); fields[0] != "config|set" || fields[1] != int64(-4) {
+		t.Errorf("Unexpected config|set info: %v", fields)
+	}
+}
+
+func TestSubcommandExtendsPlainCommand(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	server.RegisterSubcommandFunc("CLIENT", "WHOAMI", func(conn *Connection, cmd *Command) RedisValue {
+		return RedisValue{Type: SimpleString, Str: "me"}
+	}, ExactArgs(0))
+
+	client := dialRaw(t, address)
+	client.send(t, "CLIENT", "whoami")
+	if line := client.readLine(t); line != "+me" {
+		t.Errorf("Expected +me, got %q", line)
+	}
+	client.send(t, "CLIENT", "ID")
+	if line := client.readLine(t); !strings.HasPrefix(line, ":") {
+		t.Errorf("Expected the built-in CLIENT to keep serving ID, got %q", line)
+	}
+}
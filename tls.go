@@ -0,0 +1,212 @@
+package redkit
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloader serves a certificate loaded from disk through tls.Config.GetCertificate,
+// so it can be swapped without recreating the listener
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// load reads the certificate and key files, keeping the current certificate on failure
+func (r *certReloader) load() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	modTime := latestModTime(r.certFile, r.keyFile)
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.mu.Unlock()
+	return nil
+}
+
+// changed reports whether either file was modified since the last load
+func (r *certReloader) changed() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return latestModTime(r.certFile, r.keyFile).After(r.modTime)
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+func latestModTime(files ...string) time.Time {
+	var latest time.Time
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
+// SetTLSCertFiles enables TLS using the certificate and key at the given paths.
+// The files are read again by ReloadTLS or WatchTLS, and new handshakes pick up
+// the reloaded certificate while existing connections are left untouched.
+// It must be called before Listen; an existing TLSConfig is kept for all other settings.
+func (s *Server) SetTLSCertFiles(certFile, keyFile string) error {
+	reloader := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := reloader.load(); err != nil {
+		return err
+	}
+
+	config := &tls.Config{}
+	if s.TLSConfig != nil {
+		config = s.TLSConfig.Clone()
+	}
+	config.Certificates = nil
+	config.GetCertificate = reloader.getCertificate
+
+	s.mu.Lock()
+	s.TLSConfig = config
+	s.certReloader = reloader
+	s.mu.Unlock()
+	return nil
+}
+
+// ReloadTLS reloads the certificate files set by SetTLSCertFiles. If loading
+// fails the previous certificate stays in use.
+func (s *Server) ReloadTLS() error {
+	s.mu.RLock()
+	reloader := s.certReloader
+	s.mu.RUnlock()
+
+	if reloader == nil {
+		return fmt.Errorf("TLS certificate files not configured")
+	}
+	if err := reloader.load(); err != nil {
+		return err
+	}
+	s.logger().Info("Reloaded TLS certificate from %s", reloader.certFile)
+	return nil
+}
+
+// WatchTLS polls the certificate files every interval and reloads them when they
+// change, until the server shuts down. This covers certificates rotated in place
+// by cert-manager or ACME clients.
+func (s *Server) WatchTLS(interval time.Duration) error {
+	s.mu.RLock()
+	reloader := s.certReloader
+	s.mu.RUnlock()
+
+	if reloader == nil {
+		return fmt.Errorf("TLS certificate files not configured")
+	}
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C:
+				if !reloader.changed() {
+					continue
+				}
+				if err := s.ReloadTLS(); err != nil {
+					s.logger().Error("TLS certificate reload failed: %v", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// TLSState returns the TLS connection state, including the verified client
+// certificate chain when mutual TLS is used, or nil for plain TCP connections
+func (c *Connection) TLSState() *tls.ConnectionState {
+	tlsConn, ok := c.conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	state := tlsConn.ConnectionState()
+	return &state
+}
+
+// TLSIdentity returns the identity the connection authenticated with through its
+// client certificate: the value returned by ClientCertHook, or else the common
+// name of the verified leaf certificate. It is empty without a client certificate.
+func (c *Connection) TLSIdentity() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.tlsIdentity
+}
+
+// defaultHandshakeTimeout bounds the TLS handshake of a client when neither
+// HandshakeTimeout nor ReadTimeout is set
+const defaultHandshakeTimeout = 10 * time.Second
+
+// tlsHandshakeTimeout returns how long a client has to complete its TLS
+// handshake, so that one sending nothing doesn't hold its connection forever
+func (s *Server) tlsHandshakeTimeout() time.Duration {
+	if s.HandshakeTimeout > 0 {
+		return s.HandshakeTimeout
+	}
+	if timeout := s.readTimeout(); timeout > 0 {
+		return timeout
+	}
+	return defaultHandshakeTimeout
+}
+
+// verifyTLSClient completes the TLS handshake and applies the client certificate policy.
+// It returns an error if the connection must be rejected.
+func (s *Server) verifyTLSClient(conn *Connection) error {
+	tlsConn, ok := conn.conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+
+	if err := tlsConn.SetDeadline(time.Now().Add(s.tlsHandshakeTimeout())); err != nil {
+		return err
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		return fmt.Errorf("TLS handshake failed: %w", err)
+	}
+	if err := tlsConn.SetDeadline(time.Time{}); err != nil {
+		return err
+	}
+
+	state := tlsConn.ConnectionState()
+	identity := ""
+	if len(state.VerifiedChains) > 0 && len(state.VerifiedChains[0]) > 0 {
+		identity = state.VerifiedChains[0][0].Subject.CommonName
+	}
+
+	if s.ClientCertHook != nil {
+		hookIdentity, err := s.ClientCertHook(conn, state)
+		if err != nil {
+			return err
+		}
+		if hookIdentity != "" {
+			identity = hookIdentity
+		}
+	}
+
+	conn.mu.Lock()
+	conn.tlsIdentity = identity
+	conn.mu.Unlock()
+	return nil
+}
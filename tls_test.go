@@ -0,0 +1,254 @@
+package redkit
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a self-signed certificate with the given serial number and its key to dir
+func writeTestCert(t *testing.T, dir string, serial int64) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "redkit-test"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+// peerSerial connects over TLS and returns the serial number of the server certificate
+func peerSerial(t *testing.T, address string) int64 {
+	t.Helper()
+	conn, err := tls.Dial("tcp", address, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("TLS dial failed: %v", err)
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+}
+
+// TestReloadTLS tests that reloaded certificates are used for new handshakes
+func TestReloadTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir, 1)
+
+	port, err := getFreePort()
+	if err != nil {
+		t.Fatalf("Failed to get free port: %v", err)
+	}
+	address := fmt.Sprintf("127.0.0.1:%d", port)
+	server := NewServer(address, WithLogger(NewDefaultLogger(nil, LogLevelOff)))
+	if err := server.SetTLSCertFiles(certFile, keyFile); err != nil {
+		t.Fatalf("SetTLSCertFiles failed: %v", err)
+	}
+	go server.Serve()
+	defer server.Shutdown(t.Context())
+	time.Sleep(50 * time.Millisecond)
+
+	if serial := peerSerial(t, address); serial != 1 {
+		t.Fatalf("Expected certificate serial 1, got %d", serial)
+	}
+
+	writeTestCert(t, dir, 2)
+	if err := server.ReloadTLS(); err != nil {
+		t.Fatalf("ReloadTLS failed: %v", err)
+	}
+	if serial := peerSerial(t, address); serial != 2 {
+		t.Errorf("Expected certificate serial 2 after reload, got %d", serial)
+	}
+
+	// A broken key file must not replace the working certificate
+	os.WriteFile(keyFile, []byte("garbage"), 0600)
+	if err := server.ReloadTLS(); err == nil {
+		t.Error("Expected ReloadTLS to fail for a broken key file")
+	}
+	if serial := peerSerial(t, address); serial != 2 {
+		t.Errorf("Expected certificate serial 2 after failed reload, got %d", serial)
+	}
+}
+
+// TestTLSHandshakeTimeout tests that a client that never completes the TLS
+// handshake is disconnected even without a ReadTimeout
+func TestTLSHandshakeTimeout(t *testing.T) {
+	certFile, keyFile := writeTestCert(t, t.TempDir(), 1)
+	port, err := getFreePort()
+	if err != nil {
+		t.Fatalf("Failed to get free port: %v", err)
+	}
+	address := fmt.Sprintf("127.0.0.1:%d", port)
+	server := NewServer(address, WithLogger(NewDefaultLogger(nil, LogLevelOff)), WithHandshakeTimeout(50*time.Millisecond))
+	server.ReadTimeout = 0
+	if err := server.SetTLSCertFiles(certFile, keyFile); err != nil {
+		t.Fatalf("SetTLSCertFiles failed: %v", err)
+	}
+	if err := server.Listen(); err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	go server.Serve()
+	defer server.Shutdown(t.Context())
+
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("Expected the server to hang up, got %v", err)
+	}
+}
+
+// TestWatchTLS tests that certificate changes on disk are picked up automatically
+func TestWatchTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir, 1)
+
+	server := NewServer(":0", WithLogger(NewDefaultLogger(nil, LogLevelOff)))
+	defer server.Shutdown(t.Context())
+	if err := server.SetTLSCertFiles(certFile, keyFile); err != nil {
+		t.Fatalf("SetTLSCertFiles failed: %v", err)
+	}
+	if err := server.WatchTLS(10 * time.Millisecond); err != nil {
+		t.Fatalf("WatchTLS failed: %v", err)
+	}
+
+	// Make sure the rewritten files get a newer modification time
+	time.Sleep(20 * time.Millisecond)
+	writeTestCert(t, dir, 7)
+	future := time.Now().Add(time.Second)
+	os.Chtimes(certFile, future, future)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		cert, _ := server.certReloader.getCertificate(nil)
+		leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+		if leaf.SerialNumber.Int64() == 7 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("Expected watcher to reload the rotated certificate")
+}
+
+// startMTLSServer starts a TLS server requiring client certificates signed by the client's own certificate
+func startMTLSServer(t *testing.T, hook func(*Connection, tls.ConnectionState) (string, error)) (string, tls.Certificate) {
+	t.Helper()
+	serverCertFile, serverKeyFile := writeTestCert(t, t.TempDir(), 1)
+	clientCertFile, clientKeyFile := writeTestCert(t, t.TempDir(), 2)
+
+	clientCert, err := tls.LoadX509KeyPair(clientCertFile, clientKeyFile)
+	if err != nil {
+		t.Fatalf("Failed to load client certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(clientCert.Certificate[0])
+	if err != nil {
+		t.Fatalf("Failed to parse client certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+
+	config := DefaultServerConfig()
+	config.TLSConfig = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	config.ClientCertHook = hook
+
+	port, err := getFreePort()
+	if err != nil {
+		t.Fatalf("Failed to get free port: %v", err)
+	}
+	config.Address = fmt.Sprintf("127.0.0.1:%d", port)
+	config.Logger = NewDefaultLogger(nil, LogLevelOff)
+
+	server := NewServerWithConfig(config)
+	if err := server.SetTLSCertFiles(serverCertFile, serverKeyFile); err != nil {
+		t.Fatalf("SetTLSCertFiles failed: %v", err)
+	}
+	server.RegisterCommandFunc("WHOAMI", func(conn *Connection, cmd *Command) RedisValue {
+		state := conn.TLSState()
+		if state == nil || len(state.PeerCertificates) == 0 {
+			return RedisValue{Type: ErrorReply, Str: "ERR no client certificate"}
+		}
+		return RedisValue{Type: BulkString, Bulk: []byte(conn.TLSIdentity())}
+	})
+	if err := server.Listen(); err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	go server.Serve()
+	t.Cleanup(func() { server.Shutdown(t.Context()) })
+
+	return config.Address, clientCert
+}
+
+// dialMTLS connects with a client certificate and returns a raw client
+func dialMTLS(t *testing.T, address string, cert tls.Certificate) *rawClient {
+	t.Helper()
+	conn, err := tls.Dial("tcp", address, &tls.Config{InsecureSkipVerify: true, Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatalf("TLS dial failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return &rawClient{conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// TestClientCertIdentity tests exposure of the verified client certificate and tagging
+func TestClientCertIdentity(t *testing.T) {
+	address, cert := startMTLSServer(t, func(conn *Connection, state tls.ConnectionState) (string, error) {
+		return "svc:" + state.VerifiedChains[0][0].Subject.CommonName, nil
+	})
+
+	client := dialMTLS(t, address, cert)
+	client.send(t, "WHOAMI")
+	expectLines(t, client, "$15", "svc:redkit-test")
+}
+
+// TestClientCertRejected tests that the hook can reject connections
+func TestClientCertRejected(t *testing.T) {
+	address, cert := startMTLSServer(t, func(conn *Connection, state tls.ConnectionState) (string, error) {
+		return "", NewError(ErrPrefixGeneric, "certificate not allowed")
+	})
+
+	client := dialMTLS(t, address, cert)
+	expectLines(t, client, "-ERR certificate not allowed")
+	client.expectClosed(t)
+}
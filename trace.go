@@ -0,0 +1,54 @@
+package redkit
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Trace directions
+const (
+	traceInbound  = "<-"
+	traceOutbound = "->"
+)
+
+// traceIO wraps a connection's reader or writer and dumps every chunk of raw
+// RESP traffic to the server's ProtocolTrace writer
+type traceIO struct {
+	server    *Server
+	conn      *Connection
+	direction string
+	reader    io.Reader
+	writer    io.Writer
+}
+
+func (t *traceIO) Read(p []byte) (int, error) {
+	n, err := t.reader.Read(p)
+	if n > 0 {
+		t.server.trace(t.conn, t.direction, p[:n])
+	}
+	return n, err
+}
+
+func (t *traceIO) Write(p []byte) (int, error) {
+	n, err := t.writer.Write(p)
+	if n > 0 {
+		t.server.trace(t.conn, t.direction, p[:n])
+	}
+	return n, err
+}
+
+// trace writes a single trace line for data sent or received on conn, tagged
+// with the connection's ID so the frames of concurrent connections, which
+// interleave in the trace, can be told apart
+func (s *Server) trace(conn *Connection, direction string, data []byte) {
+	s.traceMu.Lock()
+	defer s.traceMu.Unlock()
+
+	_, err := fmt.Fprintf(s.ProtocolTrace, "%s conn=%d %s %s %s\n",
+		time.Now().Format(time.RFC3339Nano), conn.ID(), conn.RemoteAddr(), direction, strconv.Quote(string(data)))
+	if err != nil {
+		s.logger().Warn("Failed to write protocol trace: %v", err)
+	}
+}
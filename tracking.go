@@ -0,0 +1,267 @@
+package redkit
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// invalidateChannel is the Pub/Sub channel RESP2 clients receive invalidations on
+const invalidateChannel = "__redis__:invalidate"
+
+// trackingClient holds the CLIENT TRACKING settings of a connection
+type trackingClient struct {
+	redirect uint64
+	bcast    bool
+	noloop   bool
+	prefixes []string
+	keys     map[string]struct{} // keys read by the client in default mode
+}
+
+// trackingTable maps keys to the connections that should be told when they change
+type trackingTable struct {
+	mu      sync.Mutex
+	clients map[*Connection]*trackingClient
+	keys    map[string]map[*Connection]struct{}
+}
+
+func newTrackingTable() *trackingTable {
+	return &trackingTable{
+		clients: make(map[*Connection]*trackingClient),
+		keys:    make(map[string]map[*Connection]struct{}),
+	}
+}
+
+// enable turns tracking on for conn, replacing any previous settings
+func (t *trackingTable) enable(conn *Connection, client *trackingClient) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.removeLocked(conn)
+	client.keys = make(map[string]struct{})
+	t.clients[conn] = client
+}
+
+// remove turns tracking off for conn and forgets every key it was tracking
+func (t *trackingTable) remove(conn *Connection) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.removeLocked(conn)
+}
+
+func (t *trackingTable) removeLocked(conn *Connection) {
+	client, ok := t.clients[conn]
+	if !ok {
+		return
+	}
+	for key := range client.keys {
+		if conns := t.keys[key]; conns != nil {
+			delete(conns, conn)
+			if len(conns) == 0 {
+				delete(t.keys, key)
+			}
+		}
+	}
+	delete(t.clients, conn)
+}
+
+// isTracking reports whether conn has tracking enabled
+func (t *trackingTable) isTracking(conn *Connection) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.clients[conn]
+	return ok
+}
+
+// TrackKeyRead records that conn read keys, so it is sent an invalidation the
+// next time any of them is modified. It is a no-op unless the connection has
+// enabled CLIENT TRACKING in default (non-broadcast) mode.
+func (s *Server) TrackKeyRead(conn *Connection, keys ...string) {
+	t := s.tracking
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	client, ok := t.clients[conn]
+	if !ok || client.bcast {
+		return
+	}
+	for _, key := range keys {
+		conns := t.keys[key]
+		if conns == nil {
+			conns = make(map[*Connection]struct{})
+			t.keys[key] = conns
+		}
+		conns[conn] = struct{}{}
+		client.keys[key] = struct{}{}
+	}
+}
+
+// NotifyKeyModified sends invalidation messages to every client tracking key.
+// Handlers and stores call it whenever they change a key.
+func (s *Server) NotifyKeyModified(keys ...string) {
+	s.NotifyKeyModifiedBy(nil, keys...)
+}
+
+// NotifyKeyModifiedBy is like NotifyKeyModified but names the connection that
+// made the change, so clients that enabled NOLOOP don't hear about their own writes
+func (s *Server) NotifyKeyModifiedBy(modifier *Connection, keys ...string) {
+	t := s.tracking
+	targets := make(map[*Connection][]string)
+
+	t.mu.Lock()
+	for _, key := range keys {
+		// Default mode tracking is one-shot: the client has to read the key again
+		for conn := range t.keys[key] {
+			if client := t.clients[conn]; client != nil {
+				delete(client.keys, key)
+				if !(client.noloop && conn == modifier) {
+					targets[conn] = append(targets[conn], key)
+				}
+			}
+		}
+		delete(t.keys, key)
+
+		for conn, client := range t.clients {
+			if !client.bcast || (client.noloop && conn == modifier) {
+				continue
+			}
+			if client.matchesPrefix(key) {
+				targets[conn] = append(targets[conn], key)
+			}
+		}
+	}
+
+	redirects := make(map[*Connection]uint64, len(targets))
+	for conn := range targets {
+		redirects[conn] = t.clients[conn].redirect
+	}
+	t.mu.Unlock()
+
+	for conn, changed := range targets {
+		keyValues := make([]RedisValue, len(changed))
+		for i, key := range changed {
+			keyValues[i] = RedisValue{Type: BulkString, Bulk: []byte(key)}
+		}
+		s.sendInvalidation(conn, redirects[conn], RedisValue{Type: Array, Array: keyValues})
+	}
+}
+
+// NotifyFlush tells every tracking client that all keys were invalidated, e.g. after FLUSHALL
+func (s *Server) NotifyFlush() {
+	t := s.tracking
+
+	t.mu.Lock()
+	targets := make(map[*Connection]uint64, len(t.clients))
+	for conn, client := range t.clients {
+		targets[conn] = client.redirect
+		client.keys = make(map[string]struct{})
+	}
+	t.keys = make(map[string]map[*Connection]struct{})
+	t.mu.Unlock()
+
+	for conn, redirect := range targets {
+		s.sendInvalidation(conn, redirect, RedisValue{Type: Null})
+	}
+}
+
+// sendInvalidation delivers an invalidation for keys to conn or to its redirect target.
+// RESP3 clients get a push; RESP2 clients only receive invalidations through a
+// redirect connection, as a message on the __redis__:invalidate channel.
+func (s *Server) sendInvalidation(conn *Connection, redirect uint64, keys RedisValue) {
+	target := conn
+	if redirect != 0 {
+		target = s.GetConnection(redirect)
+		if target == nil {
+			s.logger().Debug("Tracking redirect target %d of connection %d is gone", redirect, conn.ID())
+			return
+		}
+	}
+
+	var message RedisValue
+	if target.Protocol() >= RESP3 {
+		message = RedisValue{Type: Push, Array: []RedisValue{
+			{Type: BulkString, Bulk: []byte("invalidate")},
+			keys,
+		}}
+	} else if redirect != 0 {
+		message = RedisValue{Type: Array, Array: []RedisValue{
+			{Type: BulkString, Bulk: []byte("message")},
+			{Type: BulkString, Bulk: []byte(invalidateChannel)},
+			keys,
+		}}
+	} else {
+		return
+	}
+
+	if err := target.WriteValue(message); err != nil {
+		s.logConn(LogLevelDebug, target, "Failed to send invalidation", errAttr(err))
+	}
+}
+
+func (c *trackingClient) matchesPrefix(key string) bool {
+	if len(c.prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range c.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientTracking implements CLIENT TRACKING ON|OFF [REDIRECT id] [PREFIX prefix ...] [BCAST] [NOLOOP]
+func (s *Server) clientTracking(conn *Connection, args []string) RedisValue {
+	if len(args) == 0 {
+		return WrongArity("client|tracking").Value()
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "OFF":
+		if len(args) > 1 {
+			return NewError(ErrPrefixGeneric, "syntax error").Value()
+		}
+		s.tracking.remove(conn)
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	case "ON":
+	default:
+		return NewError(ErrPrefixGeneric, "syntax error").Value()
+	}
+
+	client := &trackingClient{}
+	for i := 1; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "REDIRECT":
+			if i+1 >= len(args) {
+				return NewError(ErrPrefixGeneric, "syntax error").Value()
+			}
+			i++
+			id, err := strconv.ParseUint(args[i], 10, 64)
+			if err != nil {
+				return NewError(ErrPrefixGeneric, "value is not an integer or out of range").Value()
+			}
+			if id != conn.ID() && s.GetConnection(id) == nil {
+				return NewError(ErrPrefixGeneric, "The client ID you want redirect to does not exist").Value()
+			}
+			client.redirect = id
+		case "BCAST":
+			client.bcast = true
+		case "NOLOOP":
+			client.noloop = true
+		case "PREFIX":
+			if i+1 >= len(args) {
+				return NewError(ErrPrefixGeneric, "syntax error").Value()
+			}
+			i++
+			client.prefixes = append(client.prefixes, args[i])
+		default:
+			return NewError(ErrPrefixGeneric, "syntax error").Value()
+		}
+	}
+
+	if len(client.prefixes) > 0 && !client.bcast {
+		return NewError(ErrPrefixGeneric, "PREFIX option requires BCAST mode to be enabled").Value()
+	}
+
+	s.tracking.enable(conn, client)
+	return RedisValue{Type: SimpleString, Str: "OK"}
+}
@@ -0,0 +1,108 @@
+package redkit
+
+import (
+	"fmt"
+	"testing"
+)
+
+// startTrackingServer starts a server with GET/SET handlers that drive client tracking
+func startTrackingServer(t *testing.T) (*Server, string) {
+	server, address := startTestServer(t, nil)
+	server.RegisterCommandFunc("HELLO", func(conn *Connection, cmd *Command) RedisValue {
+		conn.SetProtocol(RESP3)
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	})
+	server.RegisterCommandFunc("GET", func(conn *Connection, cmd *Command) RedisValue {
+		server.TrackKeyRead(conn, cmd.Args[0])
+		return RedisValue{Type: Null}
+	})
+	server.RegisterCommandFunc("SET", func(conn *Connection, cmd *Command) RedisValue {
+		server.NotifyKeyModifiedBy(conn, cmd.Args[0])
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	})
+	return server, address
+}
+
+// expectLines reads reply lines and compares them with expected
+func expectLines(t *testing.T, client *rawClient, expected ...string) {
+	t.Helper()
+	for _, line := range expected {
+		if reply := client.readLine(t); reply != line {
+			t.Fatalf("Expected %q, got %q", line, reply)
+		}
+	}
+}
+
+// TestClientTrackingRESP3 tests default mode invalidation pushes
+func TestClientTrackingRESP3(t *testing.T) {
+	_, address := startTrackingServer(t)
+
+	reader := dialRaw(t, address)
+	writer := dialRaw(t, address)
+
+	reader.send(t, "HELLO", "3")
+	reader.send(t, "CLIENT", "TRACKING", "ON")
+	reader.send(t, "GET", "foo")
+	expectLines(t, reader, "+OK", "+OK", "_")
+
+	writer.send(t, "SET", "foo", "bar")
+	expectLines(t, writer, "+OK")
+	expectLines(t, reader, ">2", "$10", "invalidate", "*1", "$3", "foo")
+
+	// Tracking is one-shot: a second write without a read sends nothing
+	writer.send(t, "SET", "foo", "baz")
+	expectLines(t, writer, "+OK")
+	reader.send(t, "PING")
+	expectLines(t, reader, "+PONG")
+}
+
+// TestClientTrackingBroadcast tests BCAST mode with prefixes and NOLOOP
+func TestClientTrackingBroadcast(t *testing.T) {
+	_, address := startTrackingServer(t)
+
+	client := dialRaw(t, address)
+	client.send(t, "HELLO", "3")
+	client.send(t, "CLIENT", "TRACKING", "ON", "BCAST", "PREFIX", "user:", "NOLOOP")
+	expectLines(t, client, "+OK", "+OK")
+
+	// Own writes are skipped with NOLOOP
+	client.send(t, "SET", "user:1", "x")
+	expectLines(t, client, "+OK")
+
+	other := dialRaw(t, address)
+	other.send(t, "SET", "order:1", "x")
+	other.send(t, "SET", "user:2", "x")
+	expectLines(t, other, "+OK", "+OK")
+	expectLines(t, client, ">2", "$10", "invalidate", "*1", "$6", "user:2")
+}
+
+// TestClientTrackingRedirectRESP2 tests invalidation messages delivered to a redirect connection
+func TestClientTrackingRedirectRESP2(t *testing.T) {
+	_, address := startTrackingServer(t)
+
+	sink := dialRaw(t, address)
+	sink.send(t, "CLIENT", "ID")
+	id := sink.readLine(t)[1:]
+
+	client := dialRaw(t, address)
+	client.send(t, "CLIENT", "TRACKING", "ON", "REDIRECT", id)
+	client.send(t, "GET", "foo")
+	expectLines(t, client, "+OK", "$-1")
+
+	client.send(t, "SET", "foo", "bar")
+	expectLines(t, client, "+OK")
+	expectLines(t, sink, "*3", "$7", "message", fmt.Sprintf("$%d", len(invalidateChannel)), invalidateChannel, "*1", "$3", "foo")
+}
+
+// TestClientTrackingErrors tests argument validation
+func TestClientTrackingErrors(t *testing.T) {
+	_, address := startTrackingServer(t)
+
+	client := dialRaw(t, address)
+	client.send(t, "CLIENT", "TRACKING", "ON", "PREFIX", "a")
+	expectLines(t, client, "-ERR PREFIX option requires BCAST mode to be enabled")
+	client.send(t, "CLIENT", "TRACKING", "ON", "REDIRECT", "99999")
+	expectLines(t, client, "-ERR The client ID you want redirect to does not exist")
+	client.send(t, "CLIENT", "TRACKING", "MAYBE")
+	expectLines(t, client, "-ERR syntax error")
+}
@@ -0,0 +1,309 @@
+package redkit
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RegisterTyped registers a handler whose arguments are parsed into a value
+// of type T, a struct, before it is called. Calls that don't match the struct
+// are answered with the usual Redis errors without running the handler.
+//
+// Fields without a redis tag are positional arguments, bound in order. A tag
+// naming a keyword, such as `redis:"EX"`, makes the field an option that may
+// appear in any order after the positional arguments: a bool is set when the
+// keyword is present, other types take the argument following it. Tag options
+// after the name, separated by commas:
+//
+//	optional       a positional argument that may be left out
+//	enum=A|B       the value must be one of the listed words, ignoring case; it is stored upper-case
+//	unit=s|ms      the unit of a time.Duration, seconds by default
+//	positive       a number must be greater than zero
+//	expire         a time.Duration is an expiration, positive, reported as SET reports EX 0
+//	group=name     at most one option of the group may be given, such as NX and XX
+//
+// A time.Duration can't be negative, but may be zero unless positive or
+// expire is given, as for a timeout where 0 means none.
+//
+// Supported field types are string, []byte, int, int64, uint64, float64, bool
+// (options only), time.Duration, and, as the last positional field, []string
+// collecting the remaining arguments.
+func RegisterTyped[T any](s *Server, name string, handler func(conn *Connection, cmd *Command, args *T) RedisValue, opts ...CommandOption) error {
+	if handler == nil {
+		return fmt.Errorf("empty command name")
+	}
+	binder, err := newArgBinder(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return fmt.Errorf("redkit: %s: %w", name, err)
+	}
+	return s.RegisterCommandFunc(name, func(conn *Connection, cmd *Command) RedisValue {
+		var args T
+		if err := binder.bind(cmd, reflect.ValueOf(&args).Elem()); err != nil {
+			return err.Value()
+		}
+		return handler(conn, cmd, &args)
+	}, opts...)
+}
+
+// argField describes how one struct field is bound
+type argField struct {
+	index    int
+	keyword  string // upper-case option keyword, empty for positional fields
+	optional bool
+	variadic bool
+	enum     []string
+	unit     time.Duration
+	positive bool
+	expire   bool
+	group    string
+}
+
+// argBinder binds command arguments to a struct type
+type argBinder struct {
+	positional []argField
+	options    map[string]argField
+}
+
+func newArgBinder(typ reflect.Type) (*argBinder, error) {
+	if typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("typed arguments must be a struct, got %s", typ)
+	}
+
+	b := &argBinder{options: make(map[string]argField)}
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		tag, hasTag := sf.Tag.Lookup("redis")
+		if tag == "-" {
+			continue
+		}
+
+		f := argField{index: i, unit: time.Second}
+		parts := strings.Split(tag, ",")
+		if hasTag {
+			f.keyword = strings.ToUpper(parts[0])
+		}
+		for _, part := range parts[1:] {
+			key, value, _ := strings.Cut(part, "=")
+			switch key {
+			case "optional":
+				f.optional = true
+			case "positive":
+				f.positive = true
+			case "expire":
+				f.expire = true
+			case "enum":
+				f.enum = strings.Split(strings.ToUpper(value), "|")
+			case "unit":
+				switch value {
+				case "s":
+					f.unit = time.Second
+				case "ms":
+					f.unit = time.Millisecond
+				default:
+					return nil, fmt.Errorf("field %s: unknown unit %q", sf.Name, value)
+				}
+			case "group":
+				f.group = value
+			default:
+				return nil, fmt.Errorf("field %s: unknown tag option %q", sf.Name, part)
+			}
+		}
+
+		if err := checkArgFieldType(sf, f); err != nil {
+			return nil, err
+		}
+		if f.keyword != "" {
+			b.options[f.keyword] = f
+			continue
+		}
+		if n := len(b.positional); n > 0 && b.positional[n-1].variadic {
+			return nil, fmt.Errorf("field %s: positional field after variadic %s", sf.Name, typ.Field(b.positional[n-1].index).Name)
+		}
+		f.variadic = sf.Type == reflect.TypeOf([]string(nil))
+		if n := len(b.positional); n > 0 && b.positional[n-1].optional && !f.optional && !f.variadic {
+			return nil, fmt.Errorf("field %s: required positional field after optional %s", sf.Name, typ.Field(b.positional[n-1].index).Name)
+		}
+		b.positional = append(b.positional, f)
+	}
+	return b, nil
+}
+
+func checkArgFieldType(sf reflect.StructField, f argField) error {
+	if f.expire && sf.Type != reflect.TypeOf(time.Duration(0)) {
+		return fmt.Errorf("field %s: expire needs a time.Duration", sf.Name)
+	}
+	if f.positive {
+		switch sf.Type.Kind() {
+		case reflect.Int, reflect.Int64, reflect.Uint64, reflect.Float64:
+		default:
+			return fmt.Errorf("field %s: positive needs a number", sf.Name)
+		}
+	}
+	switch sf.Type {
+	case reflect.TypeOf(time.Duration(0)), reflect.TypeOf([]byte(nil)):
+		return nil
+	case reflect.TypeOf([]string(nil)):
+		if f.keyword != "" {
+			return fmt.Errorf("field %s: []string must be positional", sf.Name)
+		}
+		return nil
+	}
+	switch sf.Type.Kind() {
+	case reflect.String, reflect.Int, reflect.Int64, reflect.Uint64, reflect.Float64:
+		return nil
+	case reflect.Bool:
+		if f.keyword == "" {
+			return fmt.Errorf("field %s: bool must be an option", sf.Name)
+		}
+		return nil
+	}
+	return fmt.Errorf("field %s: unsupported type %s", sf.Name, sf.Type)
+}
+
+// bind parses cmd.Args into v, a value of the binder's struct type
+func (b *argBinder) bind(cmd *Command, v reflect.Value) *RedisError {
+	args := cmd.Args
+	pos := 0
+	for _, f := range b.positional {
+		if f.optional || f.variadic {
+			break
+		}
+		if pos >= len(args) {
+			return WrongArity(cmd.Name)
+		}
+		if err := f.set(cmd, v.Field(f.index), args[pos]); err != nil {
+			return err
+		}
+		pos++
+	}
+
+	groups := make(map[string]string)
+	next := len(b.positional) // the next optional or variadic field
+	for i, f := range b.positional {
+		if f.optional || f.variadic {
+			next = i
+			break
+		}
+	}
+	for pos < len(args) {
+		if f, ok := b.options[strings.ToUpper(args[pos])]; ok {
+			if f.group != "" {
+				if other, seen := groups[f.group]; seen && other != f.keyword {
+					return NewError(ErrPrefixGeneric, "syntax error")
+				}
+				groups[f.group] = f.keyword
+			}
+			field := v.Field(f.index)
+			if field.Kind() == reflect.Bool {
+				field.SetBool(true)
+				pos++
+				continue
+			}
+			if pos+1 >= len(args) {
+				return NewError(ErrPrefixGeneric, "syntax error")
+			}
+			if err := f.set(cmd, field, args[pos+1]); err != nil {
+				return err
+			}
+			pos += 2
+			continue
+		}
+
+		if next >= len(b.positional) {
+			return NewError(ErrPrefixGeneric, "syntax error")
+		}
+		f := b.positional[next]
+		if f.variadic {
+			v.Field(f.index).Set(reflect.ValueOf(append([]string(nil), args[pos:]...)))
+			return nil
+		}
+		if err := f.set(cmd, v.Field(f.index), args[pos]); err != nil {
+			return err
+		}
+		next++
+		pos++
+	}
+	return nil
+}
+
+// errNotPositive is the reply to a value given for a positive field that isn't
+var errNotPositive = NewError(ErrPrefixGeneric, "value is out of range, must be positive")
+
+// set parses arg into the field
+func (f argField) set(cmd *Command, field reflect.Value, arg string) *RedisError {
+	if f.enum != nil {
+		upper := strings.ToUpper(arg)
+		found := false
+		for _, word := range f.enum {
+			if word == upper {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return NewError(ErrPrefixGeneric, "syntax error")
+		}
+		arg = upper
+	}
+
+	switch field.Type() {
+	case reflect.TypeOf(time.Duration(0)):
+		n, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return NewError(ErrPrefixGeneric, "value is not an integer or out of range")
+		}
+		switch {
+		case f.expire && (n <= 0 || n > math.MaxInt64/int64(f.unit)):
+			return NewError(ErrPrefixGeneric, "invalid expire time in '%s' command", strings.ToLower(cmd.Name))
+		case f.positive && n <= 0:
+			return errNotPositive
+		case n < 0 || n > math.MaxInt64/int64(f.unit):
+			return NewError(ErrPrefixGeneric, "value is out of range")
+		}
+		field.SetInt(n * int64(f.unit))
+		return nil
+	case reflect.TypeOf([]byte(nil)):
+		field.SetBytes([]byte(arg))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(arg)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || field.OverflowInt(n) {
+			return NewError(ErrPrefixGeneric, "value is not an integer or out of range")
+		}
+		if f.positive && n <= 0 {
+			return errNotPositive
+		}
+		field.SetInt(n)
+	case reflect.Uint64:
+		n, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			return NewError(ErrPrefixGeneric, "value is not an integer or out of range")
+		}
+		if f.positive && n == 0 {
+			return errNotPositive
+		}
+		field.SetUint(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(arg, 64)
+		if err != nil || math.IsNaN(n) {
+			return NewError(ErrPrefixGeneric, "value is not a valid float")
+		}
+		if f.positive && n <= 0 {
+			return errNotPositive
+		}
+		field.SetFloat(n)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package redkit
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+type setArgs struct {
+	Key     string
+	Value   []byte
+	EX      time.Duration `redis:"EX,expire,group=expire"`
+	PX      time.Duration `redis:"PX,unit=ms,expire,group=expire"`
+	KeepTTL bool          `redis:"KEEPTTL,group=expire"`
+	NX      bool          `redis:"NX,group=cond"`
+	XX      bool          `redis:"XX,group=cond"`
+	Get     bool          `redis:"GET"`
+}
+
+func TestRegisterTyped(t *testing.T) {
+	server, address := startTestServer(t, nil)
+	err := RegisterTyped(server, "SET", func(conn *Connection, cmd *Command, args *setArgs) RedisValue {
+		return RedisValue{Type: SimpleString, Str: fmt.Sprintf("%s=%s ex=%v px=%v keep=%v nx=%v xx=%v get=%v",
+			args.Key, args.Value, args.EX, args.PX, args.KeepTTL, args.NX, args.XX, args.Get)}
+	})
+	if err != nil {
+		t.Fatalf("RegisterTyped failed: %v", err)
+	}
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"k", "v"}, "+k=v ex=0s px=0s keep=false nx=false xx=false get=false"},
+		{[]string{"k", "v", "ex", "10", "NX", "get"}, "+k=v ex=10s px=0s keep=false nx=true xx=false get=true"},
+		{[]string{"k", "v", "XX", "PX", "1500"}, "+k=v ex=0s px=1.5s keep=false nx=false xx=true get=false"},
+		{[]string{"k"}, "-ERR wrong number of arguments for 'set' command"},
+		{[]string{"k", "v", "NX", "XX"}, "-ERR syntax error"},
+		{[]string{"k", "v", "EX", "1", "KEEPTTL"}, "-ERR syntax error"},
+		{[]string{"k", "v", "EX"}, "-ERR syntax error"},
+		{[]string{"k", "v", "EX", "ten"}, "-ERR value is not an integer or out of range"},
+		{[]string{"k", "v", "EX", "0"}, "-ERR invalid expire time in 'set' command"},
+		{[]string{"k", "v", "BOGUS"}, "-ERR syntax error"},
+	}
+	client := dialRaw(t, address)
+	for _, tt := range tests {
+		client.send(t, append([]string{"SET"}, tt.args...)...)
+		if line := client.readLine(t); line != tt.want {
+			t.Errorf("SET %v: expected %q, got %q", tt.args, tt.want, line)
+		}
+	}
+}
+
+type pauseArgs struct {
+	Timeout int64
+	Mode    string `redis:",optional,enum=WRITE|ALL"`
+}
+
+type delArgs struct {
+	Keys []string
+}
+
+func TestTypedPositionalArguments(t *testing.T) {
+	server := NewServer(":0", WithLogger(NewDefaultLogger(nil, LogLevelOff)))
+	var gotPause pauseArgs
+	RegisterTyped(server, "PAUSE", func(conn *Connection, cmd *Command, args *pauseArgs) RedisValue {
+		gotPause = *args
+		return RedisValue{Type: SimpleString, Str: "OK"}
+	})
+	var gotDel delArgs
+	RegisterTyped(server, "DEL", func(conn *Connection, cmd *Command, args *delArgs) RedisValue {
+		gotDel = *args
+		return RedisValue{Type: Integer, Int: int64(len(args.Keys))}
+	}, MinArgs(1))
+
+	conn, _ := newTestConnection("")
+	if r := server.handleCommand(conn, &Command{Name: "PAUSE", Args: []string{"100", "write"}}); r.Type == ErrorReply {
+		t.Fatalf("PAUSE failed: %s", r.Str)
+	}
+	if gotPause.Timeout != 100 || gotPause.Mode != "WRITE" {
+		t.Errorf("Unexpected pause args: %+v", gotPause)
+	}
+	if r := server.handleCommand(conn, &Command{Name: "PAUSE", Args: []string{"100", "SOME"}}); r.Str != "ERR syntax error" {
+		t.Errorf("Expected syntax error for a bad enum, got %q", r.Str)
+	}
+	if r := server.handleCommand(conn, &Command{Name: "DEL", Args: []string{"a", "b", "c"}}); r.Int != 3 || strings.Join(gotDel.Keys, ",") != "a,b,c" {
+		t.Errorf("Unexpected DEL result %v with keys %v", r, gotDel.Keys)
+	}
+}
+
+type waitArgs struct {
+	Timeout time.Duration `redis:",unit=ms"`
+	Count   int64         `redis:"COUNT,positive"`
+}
+
+func TestTypedPositiveArguments(t *testing.T) {
+	server := NewServer(":0", WithLogger(NewDefaultLogger(nil, LogLevelOff)))
+	RegisterTyped(server, "WAITFOR", func(conn *Connection, cmd *Command, args *waitArgs) RedisValue {
+		return RedisValue{Type: SimpleString, Str: fmt.Sprintf("timeout=%v count=%d", args.Timeout, args.Count)}
+	})
+
+	conn, _ := newTestConnection("")
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"0"}, "timeout=0s count=0"},
+		{[]string{"1500", "COUNT", "2"}, "timeout=1.5s count=2"},
+		{[]string{"-1"}, "ERR value is out of range"},
+		{[]string{"0", "COUNT", "0"}, "ERR value is out of range, must be positive"},
+	}
+	for _, tt := range tests {
+		if r := server.handleCommand(conn, &Command{Name: "WAITFOR", Args: tt.args}); r.Str != tt.want {
+			t.Errorf("WAITFOR %v: expected %q, got %q", tt.args, tt.want, r.Str)
+		}
+	}
+
+	type badArgs struct {
+		Count int64 `redis:"COUNT,expire"`
+	}
+	err := RegisterTyped(server, "BAD", func(conn *Connection, cmd *Command, args *badArgs) RedisValue {
+		return RedisValue{}
+	})
+	if err == nil || !strings.Contains(err.Error(), "expire needs a time.Duration") {
+		t.Errorf("Expected an error for expire on an int64, got %v", err)
+	}
+}
+
+func TestRegisterTypedInvalidStruct(t *testing.T) {
+	server := NewServer(":0", WithLogger(NewDefaultLogger(nil, LogLevelOff)))
+	type badArgs struct {
+		Flag bool
+	}
+	err := RegisterTyped(server, "BAD", func(conn *Connection, cmd *Command, args *badArgs) RedisValue {
+		return RedisValue{}
+	})
+	if err == nil || !strings.Contains(err.Error(), "bool must be an option") {
+		t.Errorf("Expected an error for a positional bool, got %v", err)
+	}
+}
@@ -3,8 +3,12 @@ package redkit
 import (
 	"context"
 	"crypto/tls"
+	"io"
 	"log"
+	"math/big"
 	"net"
+	"net/http"
+	"net/netip"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -140,14 +144,60 @@ const (
 	StateIdle
 	StateClosed
 	StateProcessing
+	// StateSubscribed is the resting state of a connection in Pub/Sub push mode
+	StateSubscribed
+	// StateBlocked is the state of a connection waiting in BlockOnKeys
+	StateBlocked
 )
 
+// String returns the lower-case state name shown by CLIENT LIST
+func (s ConnState) String() string {
+	switch s {
+	case StateNew:
+		return "new"
+	case StateActive:
+		return "active"
+	case StateIdle:
+		return "idle"
+	case StateClosed:
+		return "closed"
+	case StateProcessing:
+		return "processing"
+	case StateSubscribed:
+		return "subscribed"
+	case StateBlocked:
+		return "blocked"
+	default:
+		return "unknown"
+	}
+}
+
 type RedisValue struct {
 	Type  RedisType
 	Str   string
 	Int   int64
 	Bulk  []byte
 	Array []RedisValue
+	Map   []MapEntry
+	Float float64
+	Bool  bool
+	// Big holds the value of a BigNumber; if nil, Str is used as its decimal representation
+	Big *big.Int
+	// Format is the three-character format marker of a Verbatim string (VerbatimText if empty)
+	Format string
+}
+
+// Verbatim string format markers
+const (
+	VerbatimText     = "txt"
+	VerbatimMarkdown = "mkd"
+)
+
+// MapEntry is a single key/value pair of a Map reply. Entries are kept in a
+// slice so that replies are written in the order the handler produced them.
+type MapEntry struct {
+	Key   RedisValue
+	Value RedisValue
 }
 
 type RedisType int
@@ -159,12 +209,30 @@ const (
 	BulkString
 	Array
 	Null
+	Map       // RESP3 map, downgraded to a flat array under RESP2
+	Set       // RESP3 set (uses Array), downgraded to an array under RESP2
+	Double    // RESP3 double (uses Float), downgraded to a bulk string under RESP2
+	Boolean   // RESP3 boolean (uses Bool), downgraded to an integer under RESP2
+	BigNumber // RESP3 big number (uses Big or Str), downgraded to a bulk string under RESP2
+	Verbatim  // RESP3 verbatim string (uses Str and Format), downgraded to a bulk string under RESP2
+	NullArray // null array (*-1) under RESP2, e.g. an aborted EXEC or a BLPOP timeout
+	Raw       // pre-serialized RESP bytes (uses Bulk), written to the wire verbatim
+	Push      // RESP3 out-of-band push (uses Array), downgraded to an array under RESP2
+	Attribute // RESP3 attributes (uses Map) of the reply in Array[0], dropped under RESP2
+)
+
+// Supported RESP protocol versions
+const (
+	RESP2 = 2
+	RESP3 = 3
 )
 
 type Command struct {
 	Name string
 	Args []string
 	Raw  []RedisValue
+
+	ctx context.Context
 }
 
 type ServerConfig struct {
@@ -175,18 +243,90 @@ type ServerConfig struct {
 	IdleTimeout        time.Duration
 	IdleCheckFrequency time.Duration
 	MaxConnections     int
+	MaxInlineSize      int
+	MaxNestingDepth    int
 	Logger             Logger
-	ConnStateHook      func(net.Conn, ConnState)
+	ProtocolTrace      io.Writer // if set, raw inbound/outbound RESP traffic is dumped here
+	StrictProtocol     bool      // reply with "-ERR Protocol error: ..." to malformed frames instead of closing silently
+	DrainReject        bool      // while draining, reply "-ERR server shutting down" to new commands instead of running them
+	// ConnStateHook is called on every connection state transition, exactly
+	// once each: StateNew first, StateClosed last, and StateProcessing and back
+	// around every command. It runs on the goroutine making the change, so it
+	// must be quick and must not block on the connection.
+	ConnStateHook func(net.Conn, ConnState)
+	// CommandTimeout, if set, is the deadline of the context handlers get from
+	// Command.Context. Handlers are not interrupted; they have to check it.
+	CommandTimeout time.Duration
+	// CancelOnDisconnect makes the server watch for the client hanging up while
+	// a command runs and cancel the command's context when it does. It costs a
+	// goroutine and a few syscalls per command, so it is off by default.
+	CancelOnDisconnect bool
+	// AdminAddress, if set, is where an HTTP endpoint serving health checks,
+	// stats and pprof is started by Listen (see Server.AdminHandler)
+	AdminAddress string
+	// IdleGoodbye sends "-ERR idle timeout, closing connection" to clients
+	// before disconnecting them for exceeding IdleTimeout, instead of closing
+	// the socket silently.
+	IdleGoodbye bool
+	// RequireAuth rejects commands other than AUTH, HELLO, QUIT and RESET with NOAUTH
+	// until Connection.SetAuthenticated is called, typically by auth middleware.
+	RequireAuth bool
+	// Authenticator checks the credentials given to the built-in AUTH command.
+	// Setting it implies RequireAuth. A *RedisError it returns is sent to the
+	// client as-is, any other error as WRONGPASS.
+	Authenticator func(conn *Connection, username, password string) error
+	// Databases is the number of logical databases SELECT and SWAPDB accept,
+	// 16 if zero
+	Databases int
+	// AcceptFilter is called with the address of every new client, after the
+	// AllowCIDRs/DenyCIDRs lists; returning false closes the connection unserved.
+	AcceptFilter func(net.Addr) bool
+	// ClientCertHook is called after the TLS handshake of every connection. Returning an
+	// error rejects the connection; a non-empty identity tags it (see Connection.TLSIdentity).
+	ClientCertHook func(conn *Connection, state tls.ConnectionState) (identity string, err error)
+	// DeprecationNotice selects how clients calling a command registered as
+	// Deprecated are told about it. Every such call is logged once per
+	// connection and counted in Stats.DeprecatedCalls regardless.
+	DeprecationNotice DeprecationNotice
+	// ExpireFrequency is the interval between the cycles removing expired
+	// keys of the built-in store in the background, 100ms if zero. A
+	// negative value disables them, leaving expired keys to be removed when
+	// written to.
+	ExpireFrequency time.Duration
+	// ExpireEffort, from 1 to 10, is how hard those cycles work to keep
+	// expired keys from piling up, at the cost of CPU time; 1 if zero
+	ExpireEffort int
+	// PubSubBuffer is the number of messages published to a subscriber that
+	// can wait to be written to it, 1024 if zero. A subscriber reading too
+	// slowly to keep within it is disconnected, so that publishers never
+	// wait for it.
+	PubSubBuffer int
+	// ScriptTimeLimit is how long a script runs before the commands of other
+	// connections, which wait for it, are refused with BUSY instead and SCRIPT
+	// KILL can stop it; 5s if zero, and never if negative
+	ScriptTimeLimit time.Duration
+	// HandshakeTimeout is how long a client has to complete the TLS
+	// handshake before it is disconnected; ReadTimeout if zero, or 10s
+	// without one
+	HandshakeTimeout time.Duration
+	// KeyspaceEvents selects the key events published to Pub/Sub
+	// subscribers, with the letters of Redis' notify-keyspace-events: K for
+	// the __keyspace@<db>__:<key> channels, E for __keyevent@<db>__:<event>,
+	// and the classes g, $, l, s, h, z, x and t, or A for all of them.
+	// Nothing is published if empty.
+	KeyspaceEvents string
 }
 
 func DefaultServerConfig() *ServerConfig {
 	return &ServerConfig{
-		Address:        ":6379",
-		ReadTimeout:    30 * time.Second,
-		WriteTimeout:   30 * time.Second,
-		IdleTimeout:    120 * time.Second,
-		MaxConnections: 1000,
-		Logger:         NewDefaultLogger(nil, LogLevelInfo),
+		Address:         ":6379",
+		ReadTimeout:     30 * time.Second,
+		WriteTimeout:    30 * time.Second,
+		IdleTimeout:     120 * time.Second,
+		MaxConnections:  1000,
+		MaxInlineSize:   defaultMaxInlineSize,
+		MaxNestingDepth: defaultMaxNestingDepth,
+		Logger:          NewDefaultLogger(nil, LogLevelInfo),
 	}
 }
 
@@ -198,18 +338,79 @@ type Server struct {
 	IdleTimeout        time.Duration
 	IdleCheckFrequency time.Duration
 	MaxConnections     int
+	MaxInlineSize      int
+	MaxNestingDepth    int
 	Logger             Logger
 	ConnStateHook      func(net.Conn, ConnState)
-
-	handlers        map[string]CommandHandler
+	ProtocolTrace      io.Writer
+	StrictProtocol     bool
+	DrainReject        bool
+	CommandTimeout     time.Duration
+	CancelOnDisconnect bool
+	AdminAddress       string
+	Databases          int
+	IdleGoodbye        bool
+	RequireAuth        bool
+	Authenticator      func(conn *Connection, username, password string) error
+	AcceptFilter       func(net.Addr) bool
+	ClientCertHook     func(conn *Connection, state tls.ConnectionState) (identity string, err error)
+	DeprecationNotice  DeprecationNotice
+	ExpireFrequency    time.Duration
+	ExpireEffort       int
+	PubSubBuffer       int
+	ScriptTimeLimit    time.Duration
+	HandshakeTimeout   time.Duration
+	KeyspaceEvents     string
+
+	handlers        atomic.Pointer[commandTable]
 	middlewareChain *MiddlewareChain
+	tracking        *trackingTable
+	watches         *watchTable
+	scripts         *scriptEngine
+	functions       *functionRegistry
+	blocking        *blockingTable
+	pubsub          *pubsubRegistry
+	expirer         *Expirer
+	stats           *serverStats
+	certReloader    *certReloader
 	listener        net.Listener
-	activeConns     map[*Connection]struct{}
+	netListener     net.Listener // listener before TLS wrapping
+	admin           *http.Server
+	activeConns     map[uint64]*Connection // open connections by ID
 	connCount       atomic.Int64
+	nextConnID      atomic.Uint64
 	inShutdown      atomic.Bool
+	draining        atomic.Bool
+	listening       atomic.Bool // set once Listen has a listener, for /readyz
+	inFlight        atomic.Int64
 	mu              sync.RWMutex
-	onShutdown      []func()
+	onShutdown      []func(context.Context) error
+	onReload        []func(*ServerConfig)
+	onConnect       []func(*Connection) error
+	onDisconnect    []func(*Connection, DisconnectInfo)
+	onError         []func(*Connection, ErrorPhase, error)
+	onPanic         []func(*Connection, *Command, *PanicError)
+	beforeCommand   []func(*Connection, *Command)
+	afterCommand    []func(*Connection, *Command, RedisValue, time.Duration)
+	onListenerError []func(error)
+	onSwapDB        []func(a, b int)
+	onKeyEvent      []func(db int, event, key string)
+	onReset         []func(*Connection)
+	healthChecks    map[string]HealthCheck
+	pause           pauseState
+	configMu        sync.RWMutex // guards the settings Reload can change
+	execMu          sync.RWMutex // held by commands, exclusively while EXEC runs
+	allowed         []netip.Prefix
+	denied          []netip.Prefix
 	ctx             context.Context
 	cancel          context.CancelFunc
 	wg              sync.WaitGroup
+	traceMu         sync.Mutex
+
+	// middleware added with UseFor and UseForCategory, by command and category
+	commandMiddleware  map[string][]Middleware
+	categoryMiddleware map[string][]Middleware
+	scopedGen          atomic.Uint64 // changed with them, for the chains cached on commands
+
+	dbs []*database // the storage of each database, set by EnableStorage and EnableBuiltinStore
 }
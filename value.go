@@ -0,0 +1,166 @@
+package redkit
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ValueEqual reports whether two values are the same reply. Only the fields
+// meaningful for the value's type are compared, and nested arrays, sets, pushes
+// and maps are compared element by element in order.
+func ValueEqual(a, b RedisValue) bool {
+	return Diff(a, b) == ""
+}
+
+// Diff returns a human-readable description of every difference between the
+// expected and actual values, one per line, or an empty string if they are equal.
+func Diff(expected, actual RedisValue) string {
+	var lines []string
+	diffValue("", expected, actual, &lines)
+	return strings.Join(lines, "\n")
+}
+
+func diffValue(path string, expected, actual RedisValue, lines *[]string) {
+	at := path
+	if at == "" {
+		at = "value"
+	}
+
+	if expected.Type != actual.Type {
+		*lines = append(*lines, fmt.Sprintf("%s: expected %s, got %s", at, describeValue(expected), describeValue(actual)))
+		return
+	}
+
+	switch expected.Type {
+	case Array, Set, Push:
+		if len(expected.Array) != len(actual.Array) {
+			*lines = append(*lines, fmt.Sprintf("%s: expected %d elements, got %d", at, len(expected.Array), len(actual.Array)))
+		}
+		for i := 0; i < len(expected.Array) && i < len(actual.Array); i++ {
+			diffValue(fmt.Sprintf("%s[%d]", path, i), expected.Array[i], actual.Array[i], lines)
+		}
+	case Attribute:
+		diffValue(path+"(attributes)", RedisValue{Type: Map, Map: expected.Map}, RedisValue{Type: Map, Map: actual.Map}, lines)
+		diffValue(path+"(reply)", RedisValue{Type: Array, Array: expected.Array}, RedisValue{Type: Array, Array: actual.Array}, lines)
+	case Map:
+		if len(expected.Map) != len(actual.Map) {
+			*lines = append(*lines, fmt.Sprintf("%s: expected %d entries, got %d", at, len(expected.Map), len(actual.Map)))
+		}
+		for i := 0; i < len(expected.Map) && i < len(actual.Map); i++ {
+			diffValue(fmt.Sprintf("%s{%d}.key", path, i), expected.Map[i].Key, actual.Map[i].Key, lines)
+			diffValue(fmt.Sprintf("%s{%d}.value", path, i), expected.Map[i].Value, actual.Map[i].Value, lines)
+		}
+	default:
+		if !scalarEqual(expected, actual) {
+			*lines = append(*lines, fmt.Sprintf("%s: expected %s, got %s", at, describeValue(expected), describeValue(actual)))
+		}
+	}
+}
+
+// scalarEqual compares two non-aggregate values of the same type
+func scalarEqual(a, b RedisValue) bool {
+	switch a.Type {
+	case SimpleString, ErrorReply:
+		return a.Str == b.Str
+	case Integer:
+		return a.Int == b.Int
+	case BulkString, Raw:
+		return bytes.Equal(a.Bulk, b.Bulk)
+	case Double:
+		return a.Float == b.Float || (math.IsNaN(a.Float) && math.IsNaN(b.Float))
+	case Boolean:
+		return a.Bool == b.Bool
+	case BigNumber:
+		return bigNumberDigits(a) == bigNumberDigits(b)
+	case Verbatim:
+		return a.Str == b.Str && verbatimFormat(a) == verbatimFormat(b)
+	case Null, NullArray:
+		return true
+	default:
+		return false
+	}
+}
+
+func bigNumberDigits(v RedisValue) string {
+	if v.Big != nil {
+		return v.Big.String()
+	}
+	return v.Str
+}
+
+func verbatimFormat(v RedisValue) string {
+	if v.Format == "" {
+		return VerbatimText
+	}
+	return v.Format
+}
+
+// typeName returns the name of a RedisType as used in diffs
+func typeName(t RedisType) string {
+	switch t {
+	case SimpleString:
+		return "SimpleString"
+	case ErrorReply:
+		return "ErrorReply"
+	case Integer:
+		return "Integer"
+	case BulkString:
+		return "BulkString"
+	case Array:
+		return "Array"
+	case Null:
+		return "Null"
+	case Map:
+		return "Map"
+	case Set:
+		return "Set"
+	case Double:
+		return "Double"
+	case Boolean:
+		return "Boolean"
+	case BigNumber:
+		return "BigNumber"
+	case Verbatim:
+		return "Verbatim"
+	case NullArray:
+		return "NullArray"
+	case Raw:
+		return "Raw"
+	case Push:
+		return "Push"
+	case Attribute:
+		return "Attribute"
+	default:
+		return "RedisType(" + strconv.Itoa(int(t)) + ")"
+	}
+}
+
+// describeValue renders a value with its type in a compact, single-line form
+func describeValue(v RedisValue) string {
+	name := typeName(v.Type)
+	switch v.Type {
+	case SimpleString, ErrorReply:
+		return name + " " + strconv.Quote(v.Str)
+	case Verbatim:
+		return name + " " + verbatimFormat(v) + ":" + strconv.Quote(v.Str)
+	case Integer:
+		return name + " " + strconv.FormatInt(v.Int, 10)
+	case BulkString, Raw:
+		return name + " " + strconv.Quote(string(v.Bulk))
+	case Double:
+		return name + " " + formatDouble(v.Float)
+	case Boolean:
+		return name + " " + strconv.FormatBool(v.Bool)
+	case BigNumber:
+		return name + " " + bigNumberDigits(v)
+	case Array, Set, Push:
+		return fmt.Sprintf("%s(%d)", name, len(v.Array))
+	case Map:
+		return fmt.Sprintf("%s(%d)", name, len(v.Map))
+	default:
+		return name
+	}
+}
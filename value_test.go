@@ -0,0 +1,66 @@
+package redkit
+
+import (
+	"math"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// TestValueEqual tests equality across scalar and nested values
+func TestValueEqual(t *testing.T) {
+	nested := func(last string) RedisValue {
+		return RedisValue{Type: Array, Array: []RedisValue{
+			{Type: Integer, Int: 1},
+			{Type: Map, Map: []MapEntry{
+				{Key: RedisValue{Type: BulkString, Bulk: []byte("name")}, Value: RedisValue{Type: BulkString, Bulk: []byte(last)}},
+			}},
+		}}
+	}
+
+	if !ValueEqual(nested("a"), nested("a")) {
+		t.Error("Expected identical nested values to be equal")
+	}
+	if ValueEqual(nested("a"), nested("b")) {
+		t.Error("Expected different nested values not to be equal")
+	}
+
+	equalPairs := [][2]RedisValue{
+		{{Type: Double, Float: math.NaN()}, {Type: Double, Float: math.NaN()}},
+		{{Type: BigNumber, Str: "1267650600228229401496703205376"}, {Type: BigNumber, Big: new(big.Int).Lsh(big.NewInt(1), 100)}},
+		{{Type: Verbatim, Str: "x"}, {Type: Verbatim, Str: "x", Format: VerbatimText}},
+		{{Type: Null, Str: "ignored"}, {Type: Null}},
+	}
+	for _, pair := range equalPairs {
+		if !ValueEqual(pair[0], pair[1]) {
+			t.Errorf("Expected %s to equal %s", describeValue(pair[0]), describeValue(pair[1]))
+		}
+	}
+
+	if ValueEqual(RedisValue{Type: Null}, RedisValue{Type: NullArray}) {
+		t.Error("Expected Null and NullArray to differ")
+	}
+}
+
+// TestDiff tests that differences are reported with their path
+func TestDiff(t *testing.T) {
+	expected := RedisValue{Type: Array, Array: []RedisValue{
+		{Type: BulkString, Bulk: []byte("a")},
+		{Type: Array, Array: []RedisValue{{Type: Integer, Int: 1}}},
+	}}
+	actual := RedisValue{Type: Array, Array: []RedisValue{
+		{Type: BulkString, Bulk: []byte("a")},
+		{Type: Array, Array: []RedisValue{{Type: SimpleString, Str: "1"}, {Type: Null}}},
+	}}
+
+	diff := Diff(expected, actual)
+	if !strings.Contains(diff, "[1]: expected 1 elements, got 2") {
+		t.Errorf("Expected length difference in diff, got:\n%s", diff)
+	}
+	if !strings.Contains(diff, `[1][0]: expected Integer 1, got SimpleString "1"`) {
+		t.Errorf("Expected type difference in diff, got:\n%s", diff)
+	}
+	if Diff(expected, expected) != "" {
+		t.Error("Expected empty diff for equal values")
+	}
+}
@@ -0,0 +1,125 @@
+package redkit
+
+import "sync"
+
+// watchKey is a key of a logical database
+type watchKey struct {
+	db  int
+	key string
+}
+
+// watchState holds the keys a connection is watching
+type watchState struct {
+	keys  map[watchKey]struct{}
+	dirty bool // a watched key was touched, so EXEC aborts
+}
+
+// watchTable maps watched keys to the connections watching them
+type watchTable struct {
+	mu    sync.Mutex
+	conns map[*Connection]*watchState
+	keys  map[watchKey]map[*Connection]struct{}
+}
+
+func newWatchTable() *watchTable {
+	return &watchTable{
+		conns: make(map[*Connection]*watchState),
+		keys:  make(map[watchKey]map[*Connection]struct{}),
+	}
+}
+
+// watch adds keys of db to the keys conn is watching
+func (t *watchTable) watch(conn *Connection, db int, keys []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state := t.conns[conn]
+	if state == nil {
+		state = &watchState{keys: make(map[watchKey]struct{})}
+		t.conns[conn] = state
+	}
+	for _, key := range keys {
+		k := watchKey{db: db, key: key}
+		state.keys[k] = struct{}{}
+		if t.keys[k] == nil {
+			t.keys[k] = make(map[*Connection]struct{})
+		}
+		t.keys[k][conn] = struct{}{}
+	}
+}
+
+// unwatch forgets every key conn is watching and reports whether any of
+// them was touched since it was watched
+func (t *watchTable) unwatch(conn *Connection) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, ok := t.conns[conn]
+	if !ok {
+		return false
+	}
+	for k := range state.keys {
+		if conns := t.keys[k]; conns != nil {
+			delete(conns, conn)
+			if len(conns) == 0 {
+				delete(t.keys, k)
+			}
+		}
+	}
+	delete(t.conns, conn)
+	return state.dirty
+}
+
+// touch marks the connections watching any of keys of db
+func (t *watchTable) touch(db int, keys []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, key := range keys {
+		for conn := range t.keys[watchKey{db: db, key: key}] {
+			t.conns[conn].dirty = true
+		}
+	}
+}
+
+// touchDB marks the connections watching any key of db
+func (t *watchTable) touchDB(db int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, state := range t.conns {
+		if state.dirty {
+			continue
+		}
+		for k := range state.keys {
+			if k.db == db {
+				state.dirty = true
+				break
+			}
+		}
+	}
+}
+
+// TouchKey records that keys of database db were modified, so transactions
+// of connections that WATCHed any of them abort on EXEC. Handlers and stores
+// call it whenever they change, delete or expire a key.
+func (s *Server) TouchKey(db int, keys ...string) {
+	s.watches.touch(db, keys)
+}
+
+// TouchDB records that every key of database db may have changed, e.g. after
+// FLUSHDB, aborting the transactions of connections watching any of them
+func (s *Server) TouchDB(db int) {
+	s.watches.touchDB(db)
+}
+
+// handleWatch implements WATCH key [key ...]
+func (s *Server) handleWatch(conn *Connection, cmd *Command) RedisValue {
+	if conn.tx != nil {
+		return NewError(ErrPrefixGeneric, "WATCH inside MULTI is not allowed").Value()
+	}
+	s.watches.watch(conn, conn.DB(), cmd.Args)
+	return RedisValue{Type: SimpleString, Str: "OK"}
+}
+
+// handleUnwatch implements UNWATCH
+func (s *Server) handleUnwatch(conn *Connection, cmd *Command) RedisValue {
+	s.watches.unwatch(conn)
+	return RedisValue{Type: SimpleString, Str: "OK"}
+}